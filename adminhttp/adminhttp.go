@@ -0,0 +1,234 @@
+// Package adminhttp serves endpoints to operate a keychain, so keys can be
+// inspected, rotated and revoked from dashboards and runbooks without
+// redeploying services. All endpoints require authentication:
+//
+//	GET  /keys              lists the active verifier keys
+//	GET  /status            shows the rotation schedule and health
+//	POST /rotate            forces a rotation of the signing key
+//	POST /keys/{id}/revoke  revokes a keypair
+//
+// Mount the handler under a prefix with http.StripPrefix, e.g.
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", adminhttp.Handler(keychain, options)))
+package adminhttp
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+)
+
+// Options configure the authentication of the admin endpoints. Requests are
+// refused unless Token or Authorize is set.
+type Options struct {
+	// Token, if set, must be sent as a bearer token in the Authorization
+	// header of every request
+	Token string
+	// Authorize, if set, decides if a request is allowed instead of Token,
+	// e.g. by checking a client certificate
+	Authorize func(r *http.Request) bool
+}
+
+// Handler returns an http.Handler serving the admin endpoints of the
+// keychain
+func Handler(keychain ring.Keychain, options Options) http.Handler {
+	return &handler{keychain: keychain, options: options}
+}
+
+type handler struct {
+	keychain ring.Keychain
+	options  Options
+}
+
+type key struct {
+	ID                 string                  `json:"id"`
+	Algorithm          ring.Algorithm          `json:"algorithm"`
+	SignatureAlgorithm ring.SignatureAlgorithm `json:"signature_algorithm,omitempty"`
+	Fingerprint        string                  `json:"fingerprint,omitempty"`
+	CreatedAt          time.Time               `json:"created_at"`
+	ExpiresAt          time.Time               `json:"expires_at"`
+	Current            bool                    `json:"current"`
+}
+
+type status struct {
+	KeyID             string     `json:"key_id"`
+	Fingerprint       string     `json:"fingerprint,omitempty"`
+	NextRotation      time.Time  `json:"next_rotation"`
+	ActiveVerifiers   int        `json:"active_verifiers"`
+	LastRotation      *time.Time `json:"last_rotation,omitempty"`
+	LastRotationError string     `json:"last_rotation_error,omitempty"`
+	Store             storeStats `json:"store"`
+	Healthy           bool       `json:"healthy"`
+	Error             string     `json:"error,omitempty"`
+}
+
+type storeStats struct {
+	PrivateKeys  int        `json:"private_keys"`
+	PublicKeys   int        `json:"public_keys"`
+	OldestExpiry *time.Time `json:"oldest_expiry,omitempty"`
+	NewestExpiry *time.Time `json:"newest_expiry,omitempty"`
+	Bytes        int64      `json:"bytes"`
+}
+
+func (h *handler) authorized(r *http.Request) bool {
+	if h.options.Authorize != nil {
+		return h.options.Authorize(r)
+	}
+	if h.options.Token == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.options.Token)) == 1
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		if h.options.Authorize == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	switch path := strings.TrimSuffix(r.URL.Path, "/"); {
+	case path == "/keys":
+		if allowMethod(w, r, http.MethodGet) {
+			h.listKeys(w, r)
+		}
+	case path == "/status":
+		if allowMethod(w, r, http.MethodGet) {
+			h.status(w, r)
+		}
+	case path == "/rotate":
+		if allowMethod(w, r, http.MethodPost) {
+			h.rotate(w, r)
+		}
+	case strings.HasPrefix(path, "/keys/") && strings.HasSuffix(path, "/revoke"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/keys/"), "/revoke")
+		if id == "" || strings.Contains(id, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if allowMethod(w, r, http.MethodPost) {
+			h.revoke(w, r, id)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// allowMethod responds with 405 unless the request uses method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || method == http.MethodGet && r.Method == http.MethodHead {
+		return true
+	}
+	allow := method
+	if method == http.MethodGet {
+		allow = "GET, HEAD"
+	}
+	w.Header().Set("Allow", allow)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fingerprint renders f, or nothing if it couldn't be computed
+func fingerprint(f ring.Fingerprint) string {
+	if f.IsZero() {
+		return ""
+	}
+	return f.String()
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ring.ErrKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (h *handler) listKeys(w http.ResponseWriter, r *http.Request) {
+	current, err := h.keychain.SigningKeyContext(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	verifiers, err := h.keychain.ListVerifiers()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	keys := make([]key, 0, len(verifiers))
+	for _, v := range verifiers {
+		keys = append(keys, key{
+			ID:                 v.ID,
+			Algorithm:          v.Algorithm,
+			SignatureAlgorithm: v.SignatureAlgorithm,
+			Fingerprint:        fingerprint(v.Fingerprint()),
+			CreatedAt:          v.CreatedAt,
+			ExpiresAt:          v.ExpiresAt,
+			Current:            v.ID == current.ID,
+		})
+	}
+	writeJSON(w, keys)
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	current, err := h.keychain.Status()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s := status{
+		KeyID:           current.KeyID,
+		Fingerprint:     fingerprint(current.Fingerprint),
+		NextRotation:    current.NextRotation,
+		ActiveVerifiers: current.ActiveVerifiers,
+		Healthy:         true,
+	}
+	if !current.LastRotation.IsZero() {
+		s.LastRotation = &current.LastRotation
+	}
+	s.Store = storeStats{
+		PrivateKeys: current.Store.PrivateKeys,
+		PublicKeys:  current.Store.PublicKeys,
+		Bytes:       current.Store.Bytes,
+	}
+	if !current.Store.OldestExpiry.IsZero() {
+		s.Store.OldestExpiry, s.Store.NewestExpiry = &current.Store.OldestExpiry, &current.Store.NewestExpiry
+	}
+	if current.LastRotationError != nil {
+		s.LastRotationError = current.LastRotationError.Error()
+	}
+	if err := h.keychain.Healthy(r.Context()); err != nil {
+		s.Healthy, s.Error = false, err.Error()
+	}
+	writeJSON(w, s)
+}
+
+func (h *handler) rotate(w http.ResponseWriter, r *http.Request) {
+	if err := h.keychain.RotateContext(r.Context()); err != nil {
+		writeError(w, err)
+		return
+	}
+	h.status(w, r)
+}
+
+func (h *handler) revoke(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.keychain.Revoke(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,102 @@
+package adminhttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/adminhttp"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func request(t *testing.T, handler http.Handler, method, path, token string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if out != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHandler(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+	})
+	handler := adminhttp.Handler(keychain, adminhttp.Options{Token: "secret"})
+
+	if code := request(t, handler, http.MethodGet, "/keys", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("got status %v without token want %v", code, http.StatusUnauthorized)
+	}
+	if code := request(t, handler, http.MethodGet, "/keys", "wrong", nil); code != http.StatusUnauthorized {
+		t.Errorf("got status %v with wrong token want %v", code, http.StatusUnauthorized)
+	}
+
+	var before struct {
+		KeyID   string `json:"key_id"`
+		Healthy bool   `json:"healthy"`
+	}
+	if code := request(t, handler, http.MethodGet, "/status", "secret", &before); code != http.StatusOK || !before.Healthy {
+		t.Fatalf("got status %v, %+v", code, before)
+	}
+
+	if code := request(t, handler, http.MethodGet, "/rotate", "secret", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %v want %v", code, http.StatusMethodNotAllowed)
+	}
+	var after struct {
+		KeyID string `json:"key_id"`
+	}
+	if code := request(t, handler, http.MethodPost, "/rotate", "secret", &after); code != http.StatusOK || after.KeyID == before.KeyID {
+		t.Fatalf("expected a new key after rotation, got status %v, %+v", code, after)
+	}
+
+	var keys []struct {
+		ID      string `json:"id"`
+		Current bool   `json:"current"`
+	}
+	if code := request(t, handler, http.MethodGet, "/keys", "secret", &keys); code != http.StatusOK || len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got status %v, %+v", code, keys)
+	}
+	for _, k := range keys {
+		if k.Current != (k.ID == after.KeyID) {
+			t.Errorf("unexpected current flag of key %+v", k)
+		}
+	}
+
+	if code := request(t, handler, http.MethodPost, "/keys/"+before.KeyID+"/revoke", "secret", nil); code != http.StatusNoContent {
+		t.Errorf("got status %v want %v", code, http.StatusNoContent)
+	}
+	if _, err := keychain.GetVerifier(before.KeyID); err == nil {
+		t.Error("expected revoked key to be gone")
+	}
+	if code := request(t, handler, http.MethodPost, "/keys/unknown/revoke", "secret", nil); code != http.StatusNotFound {
+		t.Errorf("got status %v want %v", code, http.StatusNotFound)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if code := request(t, adminhttp.Handler(keychain, adminhttp.Options{}), http.MethodGet, "/keys", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected requests to be refused without authentication, got %v", code)
+	}
+	handler := adminhttp.Handler(keychain, adminhttp.Options{
+		Authorize: func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" },
+	})
+	req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+	req.Header.Set("X-Admin", "yes")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %v want %v", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,227 @@
+// Package agent runs a keychain in a single process and exposes signing and
+// verifier lookups to other local processes over a Unix domain socket,
+// similar to ssh-agent. Applications talking to the agent never load any
+// private key material themselves.
+package agent
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hsson/ring"
+)
+
+// ErrPeerNotAllowed is returned if a connecting process does not run as one
+// of the allowed users
+var ErrPeerNotAllowed = errors.New("hsson/ring/agent: peer not allowed")
+
+const (
+	opSign          = "sign"
+	opGetVerifier   = "get_verifier"
+	opListVerifiers = "list_verifiers"
+)
+
+type request struct {
+	Op     string      `json:"op"`
+	ID     string      `json:"id,omitempty"`
+	Hash   crypto.Hash `json:"hash,omitempty"`
+	Digest []byte      `json:"digest,omitempty"`
+}
+
+type verifier struct {
+	ID                 string                  `json:"id"`
+	Key                []byte                  `json:"key"`
+	ExpiresAt          time.Time               `json:"expires_at"`
+	SignatureAlgorithm ring.SignatureAlgorithm `json:"alg,omitempty"`
+}
+
+type response struct {
+	Error     string     `json:"error,omitempty"`
+	NotFound  bool       `json:"not_found,omitempty"`
+	KeyID     string     `json:"key_id,omitempty"`
+	Signature []byte     `json:"signature,omitempty"`
+	Verifiers []verifier `json:"verifiers,omitempty"`
+}
+
+// ServerOptions customize the behavior of the agent server
+type ServerOptions struct {
+	// AllowedUIDs are the user IDs of processes allowed to connect.
+	// Default: the user running the agent
+	AllowedUIDs []int
+
+	// AllowUnknownPeers accepts connections of processes whose user can't
+	// be determined, on platforms where peer credentials are not available
+	// or on listeners other than Unix domain sockets. The permissions of
+	// the socket file are then all that protects the keys, so it is only
+	// honored while AllowedUIDs is empty. Default: false, such connections
+	// are refused
+	AllowUnknownPeers bool
+}
+
+// Server exposes a keychain over a Unix domain socket
+type Server struct {
+	keychain ring.Keychain
+	// service signs on behalf of clients, counting signatures like
+	// Keychain.Sign
+	service ring.SignatureService
+	options ServerOptions
+}
+
+// NewServer creates a new agent server for the given keychain
+func NewServer(keychain ring.Keychain, options ServerOptions) *Server {
+	return &Server{
+		keychain: keychain,
+		service:  ring.NewSignatureService(keychain, ring.SignatureServiceOptions{}),
+		options:  options,
+	}
+}
+
+// ListenAndServe listens on a Unix domain socket at path and serves
+// incoming connections. The socket is only accessible by the current user,
+// unless AllowedUIDs names other users, in which case anyone may connect
+// and peers are filtered by their credentials.
+func (s *Server) ListenAndServe(path string) error {
+	// The socket is created in a private directory and moved into place
+	// once its permissions are set, so it is never reachable with the
+	// permissions of the umask
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".ring-agent-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "agent.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	l.SetUnlinkOnClose(false)
+	defer l.Close()
+	if err := os.Chmod(tmp, s.socketMode()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	return s.Serve(l)
+}
+
+// socketMode returns the permissions of the socket file. Other users named
+// in AllowedUIDs must be able to connect before their credentials can be
+// checked.
+func (s *Server) socketMode() os.FileMode {
+	uid := os.Getuid()
+	for _, allowed := range s.options.AllowedUIDs {
+		if allowed != uid {
+			return 0666
+		}
+	}
+	return 0600
+}
+
+// Serve accepts connections on l until it is closed. It is only safe on
+// Unix domain sockets, as the user of the peers of other listeners can't be
+// checked, so they are refused unless AllowUnknownPeers is set.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) allowed(conn net.Conn) error {
+	uid, ok, err := peerUID(conn)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if s.options.AllowUnknownPeers && len(s.options.AllowedUIDs) == 0 {
+			return nil
+		}
+		return ErrPeerNotAllowed
+	}
+
+	allowed := s.options.AllowedUIDs
+	if len(allowed) == 0 {
+		allowed = []int{os.Getuid()}
+	}
+	for _, a := range allowed {
+		if a == uid {
+			return nil
+		}
+	}
+	return ErrPeerNotAllowed
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	if err := s.allowed(conn); err != nil {
+		json.NewEncoder(conn).Encode(response{Error: err.Error()})
+		return
+	}
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		if err := enc.Encode(s.handle(req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(req request) response {
+	switch req.Op {
+	case opSign:
+		signature, keyID, err := s.service.SignDigest(context.Background(), req.Hash, req.Digest)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return response{KeyID: keyID, Signature: signature}
+	case opGetVerifier:
+		key, err := s.keychain.GetVerifier(req.ID)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return verifiersResponse([]*ring.VerifierKey{key})
+	case opListVerifiers:
+		keys, err := s.keychain.ListVerifiers()
+		if err != nil {
+			return errorResponse(err)
+		}
+		return verifiersResponse(keys)
+	default:
+		return response{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+	}
+}
+
+func errorResponse(err error) response {
+	return response{Error: err.Error(), NotFound: errors.Is(err, ring.ErrKeyNotFound)}
+}
+
+func verifiersResponse(keys []*ring.VerifierKey) response {
+	res := response{Verifiers: make([]verifier, len(keys))}
+	for i, key := range keys {
+		data, err := x509.MarshalPKIXPublicKey(key.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		res.Verifiers[i] = verifier{ID: key.ID, Key: data, ExpiresAt: key.ExpiresAt, SignatureAlgorithm: key.SignatureAlgorithm}
+	}
+	return res
+}
@@ -0,0 +1,184 @@
+package agent_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/agent"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func startAgent(t *testing.T, options agent.ServerOptions) (*agent.Client, ring.Keychain, func()) {
+	dir, err := ioutil.TempDir("", "ring-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "agent.sock")
+
+	keychain := ring.New(inmem.NewInMemoryStore())
+	go agent.NewServer(keychain, options).ListenAndServe(path)
+
+	var client *agent.Client
+	for i := 0; i < 50; i++ {
+		if client, err = agent.Dial(path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, keychain, func() {
+		client.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	client, keychain, cleanup := startAgent(t, agent.ServerOptions{})
+	defer cleanup()
+
+	digest := sha256.Sum256([]byte("hello"))
+	signature, keyID, err := client.Sign(crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := client.GetVerifier(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier.SignatureAlgorithm != ring.PS256 {
+		t.Errorf("expected PS256, got %v", verifier.SignatureAlgorithm)
+	}
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	if err := rsa.VerifyPSS(verifier.Key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature, opts); err != nil {
+		t.Errorf("signature did not verify: %v", err)
+	}
+	if err := keychain.Verify(keyID, []byte("hello"), signature); err != nil {
+		t.Errorf("expected signature to verify with the keychain, got %v", err)
+	}
+
+	verifiers, err := client.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].ID != keyID {
+		t.Errorf("unexpected verifiers: %v", verifiers)
+	}
+
+	if _, err := client.GetVerifier("unknown"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	if count, err := keychain.SignatureCount(keyID); err != nil || count != 1 {
+		t.Errorf("expected the signature to be counted, got %d, %v", count, err)
+	}
+}
+
+func TestSignRejectsOtherHashes(t *testing.T) {
+	client, _, cleanup := startAgent(t, agent.ServerOptions{})
+	defer cleanup()
+
+	// Without a hash an RSA key would sign the raw data
+	if _, _, err := client.Sign(crypto.Hash(0), []byte("raw data")); err == nil {
+		t.Error("expected signing without a hash to be rejected")
+	}
+	digest := sha256.Sum256([]byte("hello"))
+	if _, _, err := client.Sign(crypto.SHA512, digest[:]); err == nil {
+		t.Error("expected signing with another hash to be rejected")
+	}
+	if _, _, err := client.Sign(crypto.SHA256, digest[:16]); err == nil {
+		t.Error("expected signing a truncated digest to be rejected")
+	}
+}
+
+func TestPeerNotAllowed(t *testing.T) {
+	client, _, cleanup := startAgent(t, agent.ServerOptions{AllowedUIDs: []int{os.Getuid() + 1}})
+	defer cleanup()
+
+	if _, err := client.ListVerifiers(); err == nil {
+		t.Errorf("expected connection to be refused")
+	}
+}
+
+func TestUnknownPeers(t *testing.T) {
+	for _, test := range []struct {
+		options agent.ServerOptions
+		allowed bool
+	}{
+		{agent.ServerOptions{}, false},
+		{agent.ServerOptions{AllowUnknownPeers: true, AllowedUIDs: []int{os.Getuid()}}, false},
+		{agent.ServerOptions{AllowUnknownPeers: true}, true},
+	} {
+		// The user of TCP peers can't be determined
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go agent.NewServer(ring.New(inmem.NewInMemoryStore()), test.options).Serve(l)
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp struct {
+			Error string `json:"error"`
+		}
+		if _, err := conn.Write([]byte(`{"op":"list_verifiers"}` + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if allowed := resp.Error == ""; allowed != test.allowed {
+			t.Errorf("expected allowed %v with %+v, got error %q", test.allowed, test.options, resp.Error)
+		}
+		conn.Close()
+		l.Close()
+	}
+}
+
+func TestSocketPermissions(t *testing.T) {
+	for _, test := range []struct {
+		allowedUIDs []int
+		mode        os.FileMode
+	}{
+		{nil, 0600},
+		{[]int{os.Getuid()}, 0600},
+		// Other allowed users must be able to reach the socket before
+		// their credentials are checked
+		{[]int{os.Getuid(), os.Getuid() + 1}, 0666},
+	} {
+		dir, err := ioutil.TempDir("", "ring-agent")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "agent.sock")
+		go agent.NewServer(ring.New(inmem.NewInMemoryStore()), agent.ServerOptions{AllowedUIDs: test.allowedUIDs}).ListenAndServe(path)
+
+		var info os.FileInfo
+		for i := 0; i < 50; i++ {
+			if info, err = os.Stat(path); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != test.mode {
+			t.Errorf("expected mode %v for AllowedUIDs %v, got %v", test.mode, test.allowedUIDs, info.Mode().Perm())
+		}
+	}
+}
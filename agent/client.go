@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/hsson/ring"
+)
+
+// Client talks to an agent server. It is safe for concurrent use, with
+// requests being sent one at a time over a single connection.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+// Dial connects to an agent listening on a Unix domain socket at path
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(conn),
+	}, nil
+}
+
+// Close closes the connection to the agent
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) call(req request) (response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(req); err != nil {
+		return response{}, err
+	}
+	var res response
+	if err := c.dec.Decode(&res); err != nil {
+		return response{}, err
+	}
+	if res.NotFound {
+		return res, ring.ErrKeyNotFound
+	}
+	if res.Error != "" {
+		return res, errors.New(res.Error)
+	}
+	return res, nil
+}
+
+// Sign signs a digest, created using hash, with the current signing key
+// of the agent. RSA keys sign using their SignatureAlgorithm and ECDSA keys
+// return an ASN.1 encoded signature, while Ed25519 keys expect the full
+// message as digest and a zero hash. The hash must be that of the
+// SignatureAlgorithm of the key, see ring.ErrDigestMismatch. The ID of the
+// key used is returned together with the signature.
+func (c *Client) Sign(hash crypto.Hash, digest []byte) (signature []byte, keyID string, err error) {
+	res, err := c.call(request{Op: opSign, Hash: hash, Digest: digest})
+	if err != nil {
+		return nil, "", err
+	}
+	return res.Signature, res.KeyID, nil
+}
+
+// GetVerifier gets the public key for a specific keypair identified by id
+func (c *Client) GetVerifier(id string) (*ring.VerifierKey, error) {
+	res, err := c.call(request{Op: opGetVerifier, ID: id})
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseVerifiers(res.Verifiers)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != 1 {
+		return nil, ring.ErrKeyNotFound
+	}
+	return keys[0], nil
+}
+
+// ListVerifiers lists all currently active public keys
+func (c *Client) ListVerifiers() ([]*ring.VerifierKey, error) {
+	res, err := c.call(request{Op: opListVerifiers})
+	if err != nil {
+		return nil, err
+	}
+	return parseVerifiers(res.Verifiers)
+}
+
+func parseVerifiers(verifiers []verifier) ([]*ring.VerifierKey, error) {
+	keys := make([]*ring.VerifierKey, len(verifiers))
+	for i, v := range verifiers {
+		untyped, err := x509.ParsePKIXPublicKey(v.Key)
+		if err != nil {
+			return nil, err
+		}
+		algorithm := v.SignatureAlgorithm
+		if algorithm == "" {
+			// Agents of earlier versions don't send the algorithm
+			algorithm = ring.DefaultSignatureAlgorithm(untyped)
+		}
+		keys[i] = &ring.VerifierKey{ID: v.ID, Key: untyped, ExpiresAt: v.ExpiresAt, SignatureAlgorithm: algorithm}
+	}
+	return keys, nil
+}
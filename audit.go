@@ -0,0 +1,107 @@
+package ring
+
+import (
+	"sync"
+	"time"
+)
+
+// AuditEvent identifies what happened to a key in an AuditRecord
+type AuditEvent string
+
+const (
+	// AuditKeyCreated is recorded when a new keypair is stored
+	AuditKeyCreated AuditEvent = "key_created"
+	// AuditKeyUsed is recorded the first time this instance hands out a
+	// signing key
+	AuditKeyUsed AuditEvent = "key_used"
+	// AuditKeyRotated is recorded when this instance replaces its signing
+	// key, with PreviousKeyID set to the replaced key
+	AuditKeyRotated AuditEvent = "key_rotated"
+	// AuditKeyRevoked is recorded when a key is revoked
+	AuditKeyRevoked AuditEvent = "key_revoked"
+	// AuditEmergencyRotated is recorded by EmergencyRotate, with Reason set
+	// to the reason given, after the revocation of all other keys
+	AuditEmergencyRotated AuditEvent = "emergency_rotated"
+	// AuditVerifierFetched is recorded for every successful GetVerifier
+	AuditVerifierFetched AuditEvent = "verifier_fetched"
+	// AuditVerifierExtended is recorded when the expiry of a verifier key
+	// is extended
+	AuditVerifierExtended AuditEvent = "verifier_extended"
+	// AuditKeySigned is recorded by a SignatureService for every signature,
+	// with Caller set to the caller it was made for
+	AuditKeySigned AuditEvent = "key_signed"
+)
+
+// AuditRecord describes an event in the lifecycle of a key
+type AuditRecord struct {
+	Event         AuditEvent
+	KeyID         string
+	PreviousKeyID string
+	InstanceID    string
+	Time          time.Time
+	// Caller is set for records of a SignatureService, see WithCaller
+	Caller string
+	// Reason is set for records of EmergencyRotate
+	Reason string
+	// Fingerprint is the hex Fingerprint of the key, set for records of
+	// signing keys: AuditKeyCreated, AuditKeyUsed, AuditKeyRotated and
+	// AuditEmergencyRotated. It is empty if the fingerprint can't be
+	// computed
+	Fingerprint string
+}
+
+// AuditSink receives audit records. Record is called synchronously, and may
+// be called concurrently.
+type AuditSink interface {
+	Record(record AuditRecord)
+}
+
+func (v *verifier) audit(event AuditEvent, keyID, previousKeyID string) {
+	v.record(AuditRecord{Event: event, KeyID: keyID, PreviousKeyID: previousKeyID})
+}
+
+// auditKey records event for the signing key key, with its fingerprint
+func (r *ring) auditKey(event AuditEvent, key *SigningKey, previousKeyID string) {
+	if r.options.AuditSink == nil {
+		return
+	}
+	r.record(AuditRecord{Event: event, KeyID: key.ID, PreviousKeyID: previousKeyID, Fingerprint: auditFingerprint(key)})
+}
+
+// auditFingerprint returns the Fingerprint of an AuditRecord for key
+func auditFingerprint(key *SigningKey) string {
+	if f := key.Fingerprint(); !f.IsZero() {
+		return f.Hex()
+	}
+	return ""
+}
+
+// record passes record to the AuditSink, if any, stamped with the instance
+// ID and the current time
+func (v *verifier) record(record AuditRecord) {
+	if v.options.AuditSink == nil {
+		return
+	}
+	record.InstanceID = v.options.InstanceID
+	record.Time = v.options.Clock.Now()
+	v.options.AuditSink.Record(record)
+}
+
+// usageAuditor records the first use of every signing key
+type usageAuditor struct {
+	mu       sync.Mutex
+	lastUsed string
+}
+
+func (r *ring) auditUse(key *SigningKey) {
+	if r.options.AuditSink == nil {
+		return
+	}
+	r.usage.mu.Lock()
+	first := r.usage.lastUsed != key.ID
+	r.usage.lastUsed = key.ID
+	r.usage.mu.Unlock()
+	if first {
+		r.auditKey(AuditKeyUsed, key, "")
+	}
+}
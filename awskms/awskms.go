@@ -0,0 +1,265 @@
+// Package awskms implements a ring.KeyGenerator which creates an
+// asymmetric AWS KMS key for every rotation. Signing happens through the
+// KMS Sign API, so private keys never leave KMS: the keychain only stores
+// the ARN of each key, next to its public key.
+//
+// Keys are not deleted by the keychain. Schedule the deletion of expired
+// keys, e.g. by their creation date, to avoid paying for them.
+package awskms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/internal/awsv4"
+)
+
+// ErrUnsupportedAlgorithm is returned when generating a key of an
+// algorithm KMS does not support, such as Ed25519.
+var ErrUnsupportedAlgorithm = errors.New("hsson/ring/awskms: unsupported algorithm")
+
+// Credentials are the AWS credentials used to sign requests
+type Credentials = awsv4.Credentials
+
+// Config configures how keys are created in AWS KMS
+type Config struct {
+	// Region is the AWS region the keys are created in
+	Region string
+	// Endpoint overrides the KMS endpoint.
+	// Default: https://kms.<region>.amazonaws.com
+	Endpoint string
+	// Credentials returns the credentials used to sign requests. It is
+	// called for every request, so temporary credentials can be refreshed.
+	// Default: credentials from the AWS_* environment variables
+	Credentials func() (Credentials, error)
+	// HTTPClient is used to talk to KMS. Default: http.DefaultClient
+	HTTPClient *http.Client
+	// Alias, if set, is pointed at the newest key, e.g. alias/ring-signing
+	Alias string
+	// Description is the description of new keys.
+	// Default: hsson/ring signing key
+	Description string
+}
+
+// New creates a ring.KeyGenerator creating RSA and ECDSA keys in AWS KMS
+func New(config Config) ring.KeyGenerator {
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", config.Region)
+	}
+	if config.Credentials == nil {
+		config.Credentials = awsv4.EnvCredentials
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Description == "" {
+		config.Description = "hsson/ring signing key"
+	}
+	return &generator{config: config}
+}
+
+type generator struct {
+	config Config
+}
+
+// apiError is an error response of KMS
+type apiError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("hsson/ring/awskms: %s: %s", e.Type, e.Message)
+}
+
+func (g *generator) do(operation string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, g.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+operation)
+	creds, err := g.config.Credentials()
+	if err != nil {
+		return err
+	}
+	awsv4.Sign(req, body, creds, g.config.Region, "kms", time.Now())
+
+	res, err := g.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		apiErr := &apiError{}
+		_ = json.Unmarshal(data, apiErr)
+		// The type may be prefixed with a namespace
+		if i := strings.LastIndex(apiErr.Type, "#"); i >= 0 {
+			apiErr.Type = apiErr.Type[i+1:]
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func keySpec(algorithm ring.Algorithm, size int) (string, error) {
+	switch algorithm {
+	case ring.RSA:
+		switch size {
+		case 2048, 3072, 4096:
+			return fmt.Sprintf("RSA_%d", size), nil
+		}
+		return "", fmt.Errorf("%w: RSA keys of %d bits", ErrUnsupportedAlgorithm, size)
+	case ring.ECDSAP256:
+		return "ECC_NIST_P256", nil
+	case ring.ECDSAP384:
+		return "ECC_NIST_P384", nil
+	case ring.ECDSAP521:
+		return "ECC_NIST_P521", nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnsupportedAlgorithm, algorithm)
+}
+
+func (g *generator) GenerateKey(algorithm ring.Algorithm, size int) (crypto.Signer, []byte, error) {
+	spec, err := keySpec(algorithm, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	var out struct {
+		KeyMetadata struct {
+			Arn string
+		}
+	}
+	err = g.do("CreateKey", map[string]interface{}{
+		"KeySpec":     spec,
+		"KeyUsage":    "SIGN_VERIFY",
+		"Description": g.config.Description,
+	}, &out)
+	if err != nil {
+		return nil, nil, err
+	}
+	arn := out.KeyMetadata.Arn
+	signer, err := g.LoadKey([]byte(arn))
+	if err != nil {
+		return nil, nil, err
+	}
+	if g.config.Alias != "" {
+		if err := g.updateAlias(arn); err != nil {
+			return nil, nil, err
+		}
+	}
+	return signer, []byte(arn), nil
+}
+
+// updateAlias points the alias at the key, creating the alias if needed
+func (g *generator) updateAlias(arn string) error {
+	in := map[string]interface{}{"AliasName": g.config.Alias, "TargetKeyId": arn}
+	err := g.do("UpdateAlias", in, nil)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Type == "NotFoundException" {
+		return g.do("CreateAlias", in, nil)
+	}
+	return err
+}
+
+func (g *generator) LoadKey(ref []byte) (crypto.Signer, error) {
+	var out struct {
+		PublicKey []byte
+	}
+	if err := g.do("GetPublicKey", map[string]interface{}{"KeyId": string(ref)}, &out); err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("hsson/ring/awskms: invalid public key: %w", err)
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("hsson/ring/awskms: unsupported key type %T", pub)
+	}
+	return &signer{generator: g, arn: string(ref), pub: pub}, nil
+}
+
+// signer signs with a KMS key
+type signer struct {
+	generator *generator
+	arn       string
+	pub       crypto.PublicKey
+}
+
+func (s *signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+var hashSuffixes = map[crypto.Hash]string{
+	crypto.SHA256: "SHA_256",
+	crypto.SHA384: "SHA_384",
+	crypto.SHA512: "SHA_512",
+}
+
+// signingAlgorithm returns the KMS signing algorithm for opts
+func (s *signer) signingAlgorithm(opts crypto.SignerOpts) (string, error) {
+	hash := opts.HashFunc()
+	suffix, ok := hashSuffixes[hash]
+	if !ok {
+		return "", fmt.Errorf("hsson/ring/awskms: unsupported hash %v", hash)
+	}
+	if _, ok := s.pub.(*ecdsa.PublicKey); ok {
+		return "ECDSA_" + suffix, nil
+	}
+	pss, ok := opts.(*rsa.PSSOptions)
+	if !ok {
+		return "RSASSA_PKCS1_V1_5_" + suffix, nil
+	}
+	// KMS always uses a salt as long as the hash
+	if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != hash.Size() {
+		return "", errors.New("hsson/ring/awskms: PSS salt length must equal the hash length")
+	}
+	return "RSASSA_PSS_" + suffix, nil
+}
+
+// Sign signs digest in KMS. ECDSA signatures are returned ASN.1 encoded, as
+// required by crypto.Signer.
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, err := s.signingAlgorithm(opts)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Signature []byte
+	}
+	err = s.generator.do("Sign", map[string]interface{}{
+		"KeyId":            s.arn,
+		"Message":          digest,
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": algorithm,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
@@ -0,0 +1,198 @@
+package awskms_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/awskms"
+	"github.com/hsson/ring/store/inmem"
+)
+
+// fakeKMS implements the asymmetric key operations used by the generator
+type fakeKMS struct {
+	mu      sync.Mutex
+	keys    map[string]crypto.Signer
+	aliases map[string]string
+}
+
+func newFakeKMS() (*fakeKMS, *httptest.Server) {
+	kms := &fakeKMS{keys: make(map[string]crypto.Signer), aliases: make(map[string]string)}
+	return kms, httptest.NewServer(kms)
+}
+
+func writeError(w http.ResponseWriter, typ string) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"__type": typ, "message": typ})
+}
+
+func (k *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var in struct {
+		KeyId            string
+		KeySpec          string
+		KeyUsage         string
+		AliasName        string
+		TargetKeyId      string
+		Message          []byte
+		MessageType      string
+		SigningAlgorithm string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, "ValidationException")
+		return
+	}
+	switch r.Header.Get("X-Amz-Target") {
+	case "TrentService.CreateKey":
+		var key crypto.Signer
+		var err error
+		switch in.KeySpec {
+		case "ECC_NIST_P256":
+			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		case "RSA_2048":
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
+		default:
+			writeError(w, "ValidationException")
+			return
+		}
+		if err != nil || in.KeyUsage != "SIGN_VERIFY" {
+			writeError(w, "ValidationException")
+			return
+		}
+		arn := fmt.Sprintf("arn:aws:kms:eu-north-1:123456789012:key/%d", len(k.keys))
+		k.keys[arn] = key
+		json.NewEncoder(w).Encode(map[string]interface{}{"KeyMetadata": map[string]string{"Arn": arn}})
+	case "TrentService.GetPublicKey":
+		key, ok := k.keys[in.KeyId]
+		if !ok {
+			writeError(w, "NotFoundException")
+			return
+		}
+		der, _ := x509.MarshalPKIXPublicKey(key.Public())
+		json.NewEncoder(w).Encode(map[string][]byte{"PublicKey": der})
+	case "TrentService.Sign":
+		key, ok := k.keys[in.KeyId]
+		if !ok || in.MessageType != "DIGEST" {
+			writeError(w, "NotFoundException")
+			return
+		}
+		var opts crypto.SignerOpts = crypto.SHA256
+		switch in.SigningAlgorithm {
+		case "ECDSA_SHA_256", "RSASSA_PKCS1_V1_5_SHA_256":
+		case "RSASSA_PSS_SHA_256":
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		default:
+			writeError(w, "ValidationException")
+			return
+		}
+		signature, err := key.Sign(rand.Reader, in.Message, opts)
+		if err != nil {
+			writeError(w, "KMSInternalException")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]byte{"Signature": signature})
+	case "TrentService.UpdateAlias":
+		if _, ok := k.aliases[in.AliasName]; !ok {
+			writeError(w, "com.amazonaws.kms#NotFoundException")
+			return
+		}
+		k.aliases[in.AliasName] = in.TargetKeyId
+	case "TrentService.CreateAlias":
+		k.aliases[in.AliasName] = in.TargetKeyId
+	default:
+		writeError(w, "UnknownOperationException")
+	}
+}
+
+func newGenerator(url string) ring.KeyGenerator {
+	return awskms.New(awskms.Config{
+		Region:   "eu-north-1",
+		Endpoint: url,
+		Credentials: func() (awskms.Credentials, error) {
+			return awskms.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+		},
+		Alias: "alias/ring",
+	})
+}
+
+func TestKeychain(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.ECDSAP256, ring.RSA} {
+		kms, server := newFakeKMS()
+		defer server.Close()
+		s := inmem.NewInMemoryStore()
+		options := ring.Options{Algorithm: algorithm, KeyGenerator: newGenerator(server.URL)}
+		keychain, err := ring.NewKeychain(s, options)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		signature, keyID, err := keychain.Sign([]byte("data"))
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+			t.Errorf("%s: expected valid signature, got %v", algorithm, err)
+		}
+
+		// The stored private key is the ARN of the KMS key
+		stored, err := s.Find(keyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(stored.Data), "arn:aws:kms:") {
+			t.Errorf("%s: expected ARN to be stored, got %q", algorithm, stored.Data)
+		}
+
+		if err := keychain.Rotate(); err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if len(kms.keys) != 2 || kms.aliases["alias/ring"] != "arn:aws:kms:eu-north-1:123456789012:key/1" {
+			t.Errorf("%s: expected alias to point at the new key, got %v", algorithm, kms.aliases)
+		}
+	}
+}
+
+func TestPKCS1v15(t *testing.T) {
+	_, server := newFakeKMS()
+	defer server.Close()
+	signer, _, err := newGenerator(server.URL).GenerateKey(ring.RSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(signer.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	_, server := newFakeKMS()
+	defer server.Close()
+	if _, _, err := newGenerator(server.URL).GenerateKey(ring.Ed25519, 0); !errors.Is(err, awskms.ErrUnsupportedAlgorithm) {
+		t.Errorf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+	if _, _, err := newGenerator(server.URL).GenerateKey(ring.RSA, 1024); !errors.Is(err, awskms.ErrUnsupportedAlgorithm) {
+		t.Errorf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+}
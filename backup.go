@@ -0,0 +1,199 @@
+package ring
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring/internal/pbkdf2"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	backupVersion    = 1
+	backupKDF        = "pbkdf2-sha256"
+	backupIterations = 600000
+	// maxBackupIterations bounds the iterations read from a backup, so a
+	// crafted one can't keep Import busy before the passphrase is checked
+	maxBackupIterations = 10 * backupIterations
+)
+
+// ErrInvalidBackup is returned by Import if the backup is malformed, or the
+// passphrase is wrong.
+var ErrInvalidBackup = errors.New("hsson/ring: invalid backup or passphrase")
+
+// backupEnvelope is the encrypted format written by Export
+type backupEnvelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type backup struct {
+	ExportedAt time.Time   `json:"exported_at"`
+	Keys       []backupKey `json:"keys"`
+}
+
+type backupKey struct {
+	ID        string    `json:"id"`
+	IsPrivate bool      `json:"private"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Data      []byte    `json:"data"`
+	// Metadata is missing from backups of older versions
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func (r *ring) Export(w io.Writer, passphrase []byte) error {
+	ctx := context.Background()
+	keys, err := r.getNonExpiredKeys(ctx, store.KeyFilter{}, func(key store.Key) bool {
+		// Heartbeats only describe the instances using the store
+		return !strings.HasPrefix(key.ID, heartbeatIDPrefix)
+	})
+	if err != nil {
+		return err
+	}
+
+	b := backup{ExportedAt: r.options.Clock.Now().UTC(), Keys: make([]backupKey, len(keys))}
+	for i, key := range keys {
+		data := key.Data
+		// Backups are not tied to the Encryptor of the keychain, so they
+		// can be restored into another store. Private keys are kept as
+		// plain PKCS #8, as in backups of earlier versions, or as the
+		// reference of keys held by a KeyGenerator.
+		if key.IsPrivate {
+			if data, err = r.decodeKeyData(key, privateKeyEncoding(key.Metadata)); err != nil {
+				return err
+			}
+		}
+		b.Keys[i] = backupKey{ID: key.ID, IsPrivate: key.IsPrivate, ExpiresAt: key.ExpiresAt, Data: data, Metadata: key.Metadata}
+	}
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	envelope := backupEnvelope{
+		Version:    backupVersion,
+		KDF:        backupKDF,
+		Iterations: backupIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := io.ReadFull(rand.Reader, envelope.Salt); err != nil {
+		return err
+	}
+	aead, err := backupAEAD(passphrase, envelope.Salt, envelope.Iterations)
+	if err != nil {
+		return err
+	}
+	envelope.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, envelope.Nonce); err != nil {
+		return err
+	}
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, plaintext, nil)
+	return json.NewEncoder(w).Encode(envelope)
+}
+
+func (r *ring) Import(rd io.Reader, passphrase []byte) error {
+	ctx := context.Background()
+	var envelope backupEnvelope
+	if err := json.NewDecoder(rd).Decode(&envelope); err != nil {
+		return &causeError{kind: ErrInvalidBackup, cause: err}
+	}
+	if envelope.Version != backupVersion || envelope.KDF != backupKDF ||
+		envelope.Iterations <= 0 || envelope.Iterations > maxBackupIterations {
+		return fmt.Errorf("%w: unsupported format", ErrInvalidBackup)
+	}
+	aead, err := backupAEAD(passphrase, envelope.Salt, envelope.Iterations)
+	if err != nil {
+		return err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return ErrInvalidBackup
+	}
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, nil)
+	if err != nil {
+		return ErrInvalidBackup
+	}
+	var b backup
+	if err := json.Unmarshal(plaintext, &b); err != nil {
+		return &causeError{kind: ErrInvalidBackup, cause: err}
+	}
+
+	if err := r.store.Lock(ctx); err != nil {
+		return err
+	}
+	// The lock is released even if ctx is done
+	defer r.store.Unlock(context.Background())
+	stopRenewing := r.keepLock()
+	defer stopRenewing()
+
+	// Revoked keys are not restored, whether they were revoked before the
+	// backup was exported or after. revoked holds the keypairs already
+	// looked up.
+	revoked := make(map[string]bool)
+	for _, key := range b.Keys {
+		if strings.HasPrefix(key.ID, revocationIDPrefix) {
+			revoked[strings.TrimPrefix(key.ID, revocationIDPrefix)] = true
+		}
+	}
+
+	now := r.options.Clock.Now()
+	for _, key := range b.Keys {
+		if !key.ExpiresAt.After(now) {
+			continue
+		}
+		id := keypairID(key.ID)
+		if _, ok := revoked[id]; !ok {
+			if revoked[id], err = r.isRevoked(ctx, id); err != nil {
+				return err
+			}
+		}
+		if revoked[id] {
+			continue
+		}
+		data := key.Data
+		if key.IsPrivate {
+			algorithm := Algorithm(key.Metadata[MetadataAlgorithm])
+			if data, err = r.encodeKeyData(privateKeyEncoding(key.Metadata), algorithm, data); err != nil {
+				return err
+			}
+		}
+		err := r.store.Add(ctx, store.Key{ID: key.ID, IsPrivate: key.IsPrivate, ExpiresAt: key.ExpiresAt, Data: data, Metadata: key.Metadata})
+		// Keys already in the store are kept, so importing is idempotent
+		if err != nil && !errors.Is(err, store.ErrKeyIDConflict) {
+			return err
+		}
+		r.cache.forget(strings.TrimPrefix(key.ID, publicKeyIDPrefix))
+	}
+	r.options.Logger.Info("imported backup", "keys", len(b.Keys), "exported_at", b.ExportedAt)
+	return nil
+}
+
+// keypairID returns the ID of the keypair a stored key belongs to
+func keypairID(id string) string {
+	for _, prefix := range []string{publicKeyIDPrefix, certificateIDPrefix, postQuantumIDPrefix, postQuantumKeyIDPrefix} {
+		if strings.HasPrefix(id, prefix) {
+			return strings.TrimPrefix(id, prefix)
+		}
+	}
+	return id
+}
+
+func backupAEAD(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,117 @@
+package ring
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"strings"
+
+	"github.com/hsson/ring/store"
+)
+
+// findMany finds the keys with the provided ids, in a single roundtrip if
+// the store is a store.BatchFinder. Keys which are not found are left out.
+func findMany(ctx context.Context, s store.ContextStore, ids []string) (store.KeyList, error) {
+	if b, ok := store.AsBatchFinder(s); ok {
+		return b.FindMany(ctx, ids)
+	}
+	var keys store.KeyList
+	for _, id := range ids {
+		key, err := s.Find(ctx, id)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (v *verifier) GetVerifiers(ids ...string) (map[string]*VerifierKey, error) {
+	return v.getVerifiers(context.Background(), ids)
+}
+
+func (v *verifier) getVerifiers(ctx context.Context, ids []string) (res map[string]*VerifierKey, err error) {
+	ctx, end := v.startSpan(ctx, "ring.GetVerifiers")
+	defer func() { end(err) }()
+
+	res = make(map[string]*VerifierKey, len(ids))
+	var storeIDs []string
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if cached, ok := v.cache.get(id); ok {
+			if cached != nil {
+				res[id] = cached
+			}
+			continue
+		}
+		storeIDs = append(storeIDs, publicKeyIDPrefix+id)
+		if v.options.certificates() {
+			storeIDs = append(storeIDs, certificateIDPrefix+id)
+		}
+	}
+
+	if len(storeIDs) > 0 {
+		keys, err := findMany(ctx, v.reads, storeIDs)
+		if err != nil {
+			return nil, err
+		}
+		found, err := v.verifiersFromKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, storeID := range storeIDs {
+			if !strings.HasPrefix(storeID, publicKeyIDPrefix) {
+				continue
+			}
+			id := strings.TrimPrefix(storeID, publicKeyIDPrefix)
+			v.cache.put(id, found[id])
+			if found[id] != nil {
+				res[id] = found[id]
+			}
+		}
+	}
+	for id := range res {
+		v.audit(AuditVerifierFetched, id, "")
+	}
+	return res, nil
+}
+
+// verifiersFromKeys parses the non-expired public keys and certificates
+// found in the store, by verifier ID
+func (v *verifier) verifiersFromKeys(keys store.KeyList) (map[string]*VerifierKey, error) {
+	certs := make(map[string]*x509.Certificate)
+	for _, key := range keys {
+		if !strings.HasPrefix(key.ID, certificateIDPrefix) {
+			continue
+		}
+		cert, err := v.parseCertificate(key)
+		if err != nil {
+			return nil, err
+		}
+		certs[strings.TrimPrefix(key.ID, certificateIDPrefix)] = cert
+	}
+	now := v.options.Clock.Now()
+	res := make(map[string]*VerifierKey)
+	for _, key := range keys {
+		if !strings.HasPrefix(key.ID, publicKeyIDPrefix) || v.options.expired(key.ExpiresAt, now) {
+			continue
+		}
+		id := strings.TrimPrefix(key.ID, publicKeyIDPrefix)
+		verifierKey, err := v.verifierFromKey(id, key, certs[id])
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[id] = verifierKey
+	}
+	return res, nil
+}
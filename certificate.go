@@ -0,0 +1,111 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrNoCertificate is returned by EncodeCertPEM if the verifier key has no
+// certificate
+var ErrNoCertificate = errors.New("hsson/ring: verifier key has no certificate")
+
+// CertificateIssuer creates the DER encoded certificate of a new verifier
+// key, e.g. by signing template with a CA using x509.CreateCertificate.
+// template has the key ID as common name, and is valid until the verifier
+// key expires.
+type CertificateIssuer func(template *x509.Certificate, pub crypto.PublicKey) ([]byte, error)
+
+// EncodeCertPEM encodes the certificate of the verifier key in PEM format
+func (vk *VerifierKey) EncodeCertPEM() ([]byte, error) {
+	if vk.Certificate == nil {
+		return nil, ErrNoCertificate
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: vk.Certificate.Raw,
+	}), nil
+}
+
+// withChain attaches the certificate chain of options to vk, if it has a
+// certificate
+func (vk VerifierKey) withChain(options Options) *VerifierKey {
+	if vk.Certificate != nil {
+		vk.CertificateChain = options.CertificateChain
+	}
+	return &vk
+}
+
+func (o *Options) certificates() bool {
+	return o.Certificates || o.CertificateIssuer != nil
+}
+
+// createCertificateStoreKey issues the certificate of signingKey, which is
+// stored next to its verifier key
+func (r *ring) createCertificateStoreKey(signingKey *SigningKey) (store.Key, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return store.Key{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: signingKey.ID},
+		NotBefore:             r.options.Clock.Now(),
+		NotAfter:              signingKey.VerifiableUntil,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	var der []byte
+	if r.options.CertificateIssuer != nil {
+		der, err = r.options.CertificateIssuer(template, signingKey.Key.Public())
+	} else {
+		der, err = x509.CreateCertificate(rand.Reader, template, template, signingKey.Key.Public(), signingKey.Key)
+	}
+	if err != nil {
+		return store.Key{}, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+	data, err := r.encodeKeyData(encodingX509, signingKey.Algorithm, der)
+	if err != nil {
+		return store.Key{}, err
+	}
+	return store.Key{
+		ID:        fmt.Sprintf("%s%s", certificateIDPrefix, signingKey.ID),
+		IsPrivate: false,
+		ExpiresAt: signingKey.VerifiableUntil,
+		Data:      data,
+	}, nil
+}
+
+// findCertificate returns the certificate of the verifier key id, or nil if
+// it has none
+func (v *verifier) findCertificate(ctx context.Context, id string) (*x509.Certificate, error) {
+	if !v.options.certificates() {
+		return nil, nil
+	}
+	key, err := v.reads.Find(ctx, certificateIDPrefix+id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.parseCertificate(key)
+}
+
+// parseCertificate parses the certificate stored in key
+func (v *verifier) parseCertificate(key store.Key) (*x509.Certificate, error) {
+	der, err := v.decodeKeyData(key, encodingX509)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
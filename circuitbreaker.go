@@ -0,0 +1,76 @@
+package ring
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by verifier lookups while the circuit breaker
+// is open, see Options.CircuitBreaker. It matches ErrStoreUnavailable.
+var ErrCircuitOpen = errors.New("hsson/ring: circuit breaker open")
+
+// CircuitBreakerPolicy defines when verifier lookups stop reaching the store
+// after it failed repeatedly.
+type CircuitBreakerPolicy struct {
+	// Failures is how many consecutive lookups failing with an error
+	// matching ErrStoreUnavailable open the circuit. 0 disables the
+	// circuit breaker
+	Failures int
+	// OpenDuration is how long the circuit stays open, after which a single
+	// lookup is let through to probe the store
+	OpenDuration time.Duration
+}
+
+// circuitBreaker counts consecutive store failures of verifier lookups
+type circuitBreaker struct {
+	policy CircuitBreakerPolicy
+	clock  Clock
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newCircuitBreaker(options Options) *circuitBreaker {
+	if options.CircuitBreaker.Failures <= 0 {
+		return nil
+	}
+	return &circuitBreaker{policy: options.CircuitBreaker, clock: options.Clock}
+}
+
+// allow reports whether a lookup may reach the store. Once the circuit has
+// been open for OpenDuration, a single lookup is allowed to probe the store
+// until its result is recorded.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.policy.Failures {
+		return true
+	}
+	now := b.clock.Now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(b.policy.OpenDuration)
+	return true
+}
+
+// record records the result of a lookup allowed to reach the store
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !errors.Is(err, ErrStoreUnavailable) {
+		b.failures = 0
+		return
+	}
+	if b.failures++; b.failures >= b.policy.Failures {
+		b.openUntil = b.clock.Now().Add(b.policy.OpenDuration)
+	}
+}
@@ -0,0 +1,74 @@
+package ring
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hsson/ring/store"
+)
+
+// needsCleanup reports if expired keys must be deleted from s by the keychain
+func needsCleanup(s store.ContextStore) bool {
+	return !store.HandlesTTL(s)
+}
+
+// startCleanup periodically deletes expired keys from the store, until Close
+// is called.
+func (r *ring) startCleanup() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.stopCleanup = cancel
+	r.cleanupDone = done
+	go func() {
+		defer close(done)
+		for {
+			timer := r.newTimer(r.options.CleanupInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			if err := r.PurgeExpiredContext(ctx); err != nil {
+				r.options.Logger.Warn("failed to delete expired keys", "error", err)
+			}
+		}
+	}()
+}
+
+func (r *ring) PurgeExpired() error {
+	return r.PurgeExpiredContext(context.Background())
+}
+
+func (r *ring) PurgeExpiredContext(ctx context.Context) error {
+	now := r.options.Clock.Now()
+	// Only expired keys are kept, so large stores are not listed at once
+	var expiredKeys store.KeyList
+	err := store.Iterate(ctx, r.store, func(key store.Key) bool {
+		if !key.ExpiresAt.After(now) {
+			expiredKeys = append(expiredKeys, key)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	// Keys are about to disappear from the store, so they must be
+	// reported as expired before they are deleted
+	if r.options.OnKeyExpired != nil {
+		r.notifyExpired(expiredKeys, now)
+	}
+	r.zeroizeRetiredKeys()
+	for _, key := range expiredKeys {
+		if id := strings.TrimPrefix(key.ID, publicKeyIDPrefix); id != key.ID {
+			if err := r.addTombstone(ctx, id, TombstoneExpired, key.ExpiresAt); err != nil {
+				return err
+			}
+		}
+		if err := r.deleteKey(ctx, key); err != nil {
+			return err
+		}
+		r.options.Logger.Debug("deleted expired key", "key_id", key.ID)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+// Command ringctl inspects and manages the keys of a keychain store.
+//
+//	ringctl -store file:///var/lib/ring list
+//	ringctl -store file:///var/lib/ring show <id>
+//	ringctl -store file:///var/lib/ring rotate
+//	ringctl -store file:///var/lib/ring revoke <id>
+//	ringctl -store file:///var/lib/ring export-jwks
+//	ringctl -store file:///var/lib/ring purge-expired
+//
+// Commands creating keys (rotate, and revoke of the current key) must be
+// given the same -algorithm, -rotation-frequency and -verification-period
+// as the services using the store.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/internal/storeurl"
+	"github.com/hsson/ring/store"
+)
+
+const usage = `Usage: %s -store URL [flags] COMMAND
+
+Commands:
+  list             list all active verifier keys
+  show ID          show a verifier key, including its PEM encoding
+  rotate           create a new signing key
+  revoke ID        revoke a keypair
+  export-jwks      print all active verifier keys as a JSON Web Key Set
+  purge-expired    delete expired keys left behind in the store
+
+Flags:
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ringctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type config struct {
+	store   store.Store
+	options ring.Options
+	out     io.Writer
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("ringctl", flag.ContinueOnError)
+	storeURL := flags.String("store", "", "URL of the store")
+	namespace := flags.String("namespace", "", "namespace of the keychain")
+	algorithm := flags.String("algorithm", string(ring.RSA), "algorithm of created keys")
+	rotationFrequency := flags.Duration("rotation-frequency", time.Hour, "rotation frequency of the keychain")
+	verificationPeriod := flags.Duration("verification-period", 0, "verification period of the keychain (default 2x rotation frequency)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), usage, "ringctl")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\n%s\n", storeurl.Usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if *storeURL == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	s, err := storeurl.Open(*storeURL)
+	if err != nil {
+		return err
+	}
+	c := &config{
+		store: s,
+		options: ring.Options{
+			Algorithm:          ring.Algorithm(*algorithm),
+			RotationFrequency:  *rotationFrequency,
+			VerificationPeriod: *verificationPeriod,
+			Namespace:          *namespace,
+		},
+		out: out,
+	}
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch {
+	case command == "list" && len(args) == 0:
+		return c.list()
+	case command == "show" && len(args) == 1:
+		return c.show(args[0])
+	case command == "rotate" && len(args) == 0:
+		return c.rotate()
+	case command == "revoke" && len(args) == 1:
+		return c.revoke(args[0])
+	case command == "export-jwks" && len(args) == 0:
+		return c.exportJWKS()
+	case command == "purge-expired" && len(args) == 0:
+		return c.purgeExpired()
+	default:
+		flags.Usage()
+		return errUsage
+	}
+}
+
+func (c *config) list() error {
+	verifiers, err := ring.NewVerifierOnlyWithOptions(c.store, c.options).ListVerifiers()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tEXPIRES AT\tFINGERPRINT")
+	for _, verifier := range verifiers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", verifier.ID, keyType(verifier), verifier.ExpiresAt.UTC().Format(time.RFC3339), verifier.Fingerprint())
+	}
+	return w.Flush()
+}
+
+func (c *config) show(id string) error {
+	verifier, err := ring.NewVerifierOnlyWithOptions(c.store, c.options).GetVerifier(id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "ID:          %s\n", verifier.ID)
+	fmt.Fprintf(c.out, "Type:        %s\n", keyType(verifier))
+	fmt.Fprintf(c.out, "Expires at:  %s\n", verifier.ExpiresAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(c.out, "Fingerprint: %s\n", verifier.Fingerprint())
+	pemData, err := verifier.EncodeToPEM()
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(pemData)
+	return err
+}
+
+func (c *config) rotate() error {
+	keychain, err := ring.NewKeychain(c.store, c.options)
+	if err != nil {
+		return err
+	}
+	if err := keychain.Rotate(); err != nil {
+		return err
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "created %s, active until %s\n", key.ID, key.RotatedAt.UTC().Format(time.RFC3339))
+	return nil
+}
+
+func (c *config) revoke(id string) error {
+	keychain, err := ring.NewKeychain(c.store, c.options)
+	if err != nil {
+		return err
+	}
+	if err := keychain.Revoke(id); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "revoked %s\n", id)
+	return nil
+}
+
+func (c *config) exportJWKS() error {
+	verifiers, err := ring.NewVerifierOnlyWithOptions(c.store, c.options).ListVerifiers()
+	if err != nil {
+		return err
+	}
+	set := ring.JWKSet{Keys: make([]ring.JWK, len(verifiers))}
+	for i, verifier := range verifiers {
+		if set.Keys[i], err = verifier.ToJWK(); err != nil {
+			return err
+		}
+	}
+	for _, verifier := range verifiers {
+		if verifier.PostQuantum == nil {
+			continue
+		}
+		jwk, err := verifier.PostQuantum.ToJWK()
+		if err != nil {
+			return err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(set)
+}
+
+// purgeExpired deletes expired keys from stores which do not expire keys
+// by themselves
+func (c *config) purgeExpired() error {
+	keys, err := c.store.List()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var purged int
+	for _, key := range keys {
+		if key.ExpiresAt.After(now) {
+			continue
+		}
+		if err := c.store.Delete(key.ID); err != nil {
+			return err
+		}
+		purged++
+	}
+	fmt.Fprintf(c.out, "purged %d expired keys\n", purged)
+	return nil
+}
+
+func keyType(verifier *ring.VerifierKey) string {
+	switch key := verifier.Key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", key)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/file"
+)
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ringctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storeURL := "file://" + dir
+
+	ringctl := func(args ...string) string {
+		var out bytes.Buffer
+		args = append([]string{"-store", storeURL, "-algorithm", string(ring.Ed25519)}, args...)
+		if err := run(args, &out); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	out := ringctl("rotate")
+	if !strings.HasPrefix(out, "created ") {
+		t.Fatalf("unexpected output of rotate: %q", out)
+	}
+	id := strings.TrimSuffix(strings.Fields(out)[1], ",")
+
+	if out := ringctl("list"); !strings.Contains(out, id) || !strings.Contains(out, "Ed25519") {
+		t.Errorf("expected %v to be listed, got %q", id, out)
+	}
+	if out := ringctl("show", id); !strings.Contains(out, "BEGIN PUBLIC KEY") {
+		t.Errorf("expected PEM in output of show, got %q", out)
+	}
+	var set ring.JWKSet
+	if err := json.Unmarshal([]byte(ringctl("export-jwks")), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) == 0 {
+		t.Error("expected JWKS to contain keys")
+	}
+
+	ringctl("revoke", id)
+	if out := ringctl("list"); strings.Contains(out, id) {
+		t.Errorf("expected %v to be revoked, got %q", id, out)
+	}
+
+	s, err := file.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(store.Key{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if out := ringctl("purge-expired"); out != "purged 1 expired keys\n" {
+		t.Errorf("unexpected output of purge-expired: %q", out)
+	}
+
+	if err := run([]string{"-store", storeURL, "show"}, ioutil.Discard); err != errUsage {
+		t.Errorf("expected usage error, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// Command ringmigrate copies all keys from one store to another, e.g.
+//
+//	ringmigrate -from file:///var/lib/ring -to etcd+http://localhost:2379/ring/
+//
+// Instances can keep using the source store while copying. Once they have
+// been switched to the destination, run ringmigrate again to pick up any
+// keys created in the meantime.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hsson/ring/internal/storeurl"
+	"github.com/hsson/ring/migrate"
+)
+
+func main() {
+	from := flag.String("from", "", "URL of the store to copy keys from")
+	to := flag.String("to", "", "URL of the store to copy keys to")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -from URL -to URL\n\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\n%s\n", storeurl.Usage)
+	}
+	flag.Parse()
+	if *from == "" || *to == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*from, *to); err != nil {
+		fmt.Fprintf(os.Stderr, "ringmigrate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(from, to string) error {
+	src, err := storeurl.Open(from)
+	if err != nil {
+		return err
+	}
+	dst, err := storeurl.Open(to)
+	if err != nil {
+		return err
+	}
+	return migrate.Copy(src, dst)
+}
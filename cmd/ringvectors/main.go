@@ -0,0 +1,77 @@
+// Command ringvectors exports the signature test vectors of package
+// ringtest/vectors, e.g. to validate verifiers written in other languages:
+//
+//	ringvectors > vectors.json
+//	ringvectors -dir testdata/ring
+//
+// With -dir, every vector is also written as separate files named after
+// its algorithm: the private and public key as .key.pem and .pub.pem, the
+// JWK as .jwk.json, and the raw payload and signature as .payload and .sig.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hsson/ring/ringtest/vectors"
+)
+
+func main() {
+	dir := flag.String("dir", "", "directory to write the vectors to, instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-dir DIR]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*dir); err != nil {
+		fmt.Fprintf(os.Stderr, "ringvectors: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string) error {
+	data, err := vectors.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if dir == "" {
+		_, err := fmt.Printf("%s\n", data)
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "vectors.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	for _, v := range vectors.All() {
+		jwk, err := json.MarshalIndent(v.JWK, "", "  ")
+		if err != nil {
+			return err
+		}
+		name := strings.ToLower(string(v.Algorithm))
+		files := map[string][]byte{
+			".key.pem":  []byte(v.PrivateKeyPEM),
+			".pub.pem":  []byte(v.PublicKeyPEM),
+			".jwk.json": append(jwk, '\n'),
+			".payload":  v.Payload,
+			".sig":      v.Signature,
+		}
+		for ext, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name+ext), content, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
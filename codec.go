@@ -0,0 +1,78 @@
+package ring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// Codec serializes the private and public keys held in store.Key.Data, see
+// Options.Codec. Its output is still wrapped according to
+// Options.KeyDataEncoding and encrypted by Options.Encryptor.
+type Codec interface {
+	// MarshalPrivateKey serializes a private key created by the keychain
+	MarshalPrivateKey(key crypto.Signer) ([]byte, error)
+	// UnmarshalPrivateKey parses data returned by MarshalPrivateKey
+	UnmarshalPrivateKey(data []byte) (crypto.Signer, error)
+	// MarshalPublicKey serializes the public key of a private key created
+	// by the keychain
+	MarshalPublicKey(key crypto.PublicKey) ([]byte, error)
+	// UnmarshalPublicKey parses data returned by MarshalPublicKey
+	UnmarshalPublicKey(data []byte) (crypto.PublicKey, error)
+}
+
+// DefaultCodec serializes private keys as PKCS #8 and public keys as PKIX,
+// both DER encoded
+var DefaultCodec Codec = derCodec{}
+
+type derCodec struct{}
+
+func (derCodec) MarshalPrivateKey(key crypto.Signer) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+func (derCodec) UnmarshalPrivateKey(data []byte) (crypto.Signer, error) {
+	untyped, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	switch key := untyped.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("key has invalid type %T", untyped)
+	}
+}
+
+func (derCodec) MarshalPublicKey(key crypto.PublicKey) ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(key)
+}
+
+func (derCodec) UnmarshalPublicKey(data []byte) (crypto.PublicKey, error) {
+	untyped, err := x509.ParsePKIXPublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	switch pub := untyped.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return pub, nil
+	default:
+		return nil, errors.New("stored public key has unknown type")
+	}
+}
+
+// codec returns Options.Codec, or DefaultCodec if not set
+func (o Options) codec() Codec {
+	if o.Codec == nil {
+		return DefaultCodec
+	}
+	return o.Codec
+}
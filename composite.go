@@ -0,0 +1,90 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// VerifierSource is a Verifier trusted by a CompositeVerifier
+type VerifierSource struct {
+	// Prefix is prepended to the key IDs of the verifier, so that keys of
+	// different sources never collide. Sources without a prefix serve
+	// all key IDs as is.
+	Prefix string
+	// Verifier looks up the keys of the source, e.g. a Keychain or a
+	// Verifier created by NewVerifierOnly
+	Verifier Verifier
+}
+
+// CompositeVerifier resolves key IDs across several sources, e.g. the keys
+// of the old and the new cluster during a migration, or the keys of partner
+// services. Its keys are identified by the key ID within their source,
+// prefixed by the Prefix of the source.
+type CompositeVerifier struct {
+	sources []VerifierSource
+}
+
+// NewCompositeVerifier creates a CompositeVerifier over sources. Key IDs are
+// looked up in every source whose prefix they start with, in order, until
+// the key is found.
+func NewCompositeVerifier(sources ...VerifierSource) *CompositeVerifier {
+	return &CompositeVerifier{sources: sources}
+}
+
+func (c *CompositeVerifier) GetVerifier(id string) (*VerifierKey, error) {
+	return c.GetVerifierContext(context.Background(), id)
+}
+
+// GetVerifierContext returns ErrKeyNotFound only if no source has the key.
+// Otherwise the first error of a source is returned, e.g. as its store
+// could not be reached.
+func (c *CompositeVerifier) GetVerifierContext(ctx context.Context, id string) (*VerifierKey, error) {
+	var firstErr error
+	for _, source := range c.sources {
+		if !strings.HasPrefix(id, source.Prefix) {
+			continue
+		}
+		key, err := source.Verifier.GetVerifierContext(ctx, strings.TrimPrefix(id, source.Prefix))
+		if err == nil {
+			return source.withPrefix(key), nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (c *CompositeVerifier) ListVerifiers() ([]*VerifierKey, error) {
+	return c.ListVerifiersContext(context.Background())
+}
+
+// ListVerifiersContext fails if any of the sources fails
+func (c *CompositeVerifier) ListVerifiersContext(ctx context.Context) ([]*VerifierKey, error) {
+	var res []*VerifierKey
+	for _, source := range c.sources {
+		keys, err := source.Verifier.ListVerifiersContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			res = append(res, source.withPrefix(key))
+		}
+	}
+	sortVerifiers(res)
+	return res, nil
+}
+
+// withPrefix returns key as identified by the composite verifier
+func (s VerifierSource) withPrefix(key *VerifierKey) *VerifierKey {
+	if s.Prefix == "" {
+		return key
+	}
+	prefixed := *key
+	prefixed.ID = s.Prefix + key.ID
+	return &prefixed
+}
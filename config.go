@@ -0,0 +1,140 @@
+package ring
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// DefaultEnvPrefix prefixes the environment variables read by
+// OptionsFromEnv
+const DefaultEnvPrefix = "RING_"
+
+// Duration is a time.Duration encoded as a string such as "1h30m", e.g. in
+// JSON, YAML and environment variables
+type Duration time.Duration
+
+// MarshalText renders the duration like time.Duration.String
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses a duration accepted by time.ParseDuration
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config holds the options of a keychain which can be set from text, e.g.
+// decoded from a JSON or YAML file or read from environment variables by
+// ConfigFromEnv. Each field sets the option of the same name, unless it is
+// the zero value.
+type Config struct {
+	Algorithm               Algorithm            `json:"algorithm,omitempty" yaml:"algorithm,omitempty" env:"ALGORITHM"`
+	KeySize                 int                  `json:"key_size,omitempty" yaml:"key_size,omitempty" env:"KEY_SIZE"`
+	SignatureAlgorithm      SignatureAlgorithm   `json:"signature_algorithm,omitempty" yaml:"signature_algorithm,omitempty" env:"SIGNATURE_ALGORITHM"`
+	RotationFrequency       Duration             `json:"rotation_frequency,omitempty" yaml:"rotation_frequency,omitempty" env:"ROTATION_FREQUENCY"`
+	RotationSchedule        string               `json:"rotation_schedule,omitempty" yaml:"rotation_schedule,omitempty" env:"ROTATION_SCHEDULE"`
+	RotationJitter          float64              `json:"rotation_jitter,omitempty" yaml:"rotation_jitter,omitempty" env:"ROTATION_JITTER"`
+	VerificationPeriod      Duration             `json:"verification_period,omitempty" yaml:"verification_period,omitempty" env:"VERIFICATION_PERIOD"`
+	SigningGracePeriod      Duration             `json:"signing_grace_period,omitempty" yaml:"signing_grace_period,omitempty" env:"SIGNING_GRACE_PERIOD"`
+	RetainSigningKeys       int                  `json:"retain_signing_keys,omitempty" yaml:"retain_signing_keys,omitempty" env:"RETAIN_SIGNING_KEYS"`
+	PrePublishWindow        Duration             `json:"pre_publish_window,omitempty" yaml:"pre_publish_window,omitempty" env:"PRE_PUBLISH_WINDOW"`
+	AutoRotate              bool                 `json:"auto_rotate,omitempty" yaml:"auto_rotate,omitempty" env:"AUTO_ROTATE"`
+	DeferInitialization     bool                 `json:"defer_initialization,omitempty" yaml:"defer_initialization,omitempty" env:"DEFER_INITIALIZATION"`
+	ReadOnly                bool                 `json:"read_only,omitempty" yaml:"read_only,omitempty" env:"READ_ONLY"`
+	CleanupInterval         Duration             `json:"cleanup_interval,omitempty" yaml:"cleanup_interval,omitempty" env:"CLEANUP_INTERVAL"`
+	StoreTimeout            Duration             `json:"store_timeout,omitempty" yaml:"store_timeout,omitempty" env:"STORE_TIMEOUT"`
+	HealthRotationThreshold Duration             `json:"health_rotation_threshold,omitempty" yaml:"health_rotation_threshold,omitempty" env:"HEALTH_ROTATION_THRESHOLD"`
+	VerifierCacheTTL        Duration             `json:"verifier_cache_ttl,omitempty" yaml:"verifier_cache_ttl,omitempty" env:"VERIFIER_CACHE_TTL"`
+	TombstoneTTL            Duration             `json:"tombstone_ttl,omitempty" yaml:"tombstone_ttl,omitempty" env:"TOMBSTONE_TTL"`
+	Namespace               string               `json:"namespace,omitempty" yaml:"namespace,omitempty" env:"NAMESPACE"`
+	InstanceID              string               `json:"instance_id,omitempty" yaml:"instance_id,omitempty" env:"INSTANCE_ID"`
+	KeyMismatch             KeyMismatchPolicy    `json:"key_mismatch,omitempty" yaml:"key_mismatch,omitempty" env:"KEY_MISMATCH"`
+	PostQuantum             PostQuantumAlgorithm `json:"post_quantum,omitempty" yaml:"post_quantum,omitempty" env:"POST_QUANTUM"`
+	ZeroizeKeys             bool                 `json:"zeroize_keys,omitempty" yaml:"zeroize_keys,omitempty" env:"ZEROIZE_KEYS"`
+	FIPS                    bool                 `json:"fips,omitempty" yaml:"fips,omitempty" env:"FIPS"`
+}
+
+// Apply returns options with the fields set in the config replaced
+func (c Config) Apply(options Options) Options {
+	config := reflect.ValueOf(c)
+	target := reflect.ValueOf(&options).Elem()
+	for i := 0; i < config.NumField(); i++ {
+		if value := config.Field(i); !value.IsZero() {
+			field := target.FieldByName(config.Type().Field(i).Name)
+			field.Set(value.Convert(field.Type()))
+		}
+	}
+	return options
+}
+
+// ConfigFromEnv reads a Config from the environment variables named by the
+// env tags of its fields, prefixed by prefix, e.g. RING_ROTATION_FREQUENCY
+// for DefaultEnvPrefix. Unset and empty variables are left out.
+func ConfigFromEnv(prefix string) (Config, error) {
+	var c Config
+	config := reflect.ValueOf(&c).Elem()
+	for i := 0; i < config.NumField(); i++ {
+		name := prefix + config.Type().Field(i).Tag.Get("env")
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if err := setFromEnv(config.Field(i), value); err != nil {
+			return Config{}, fmt.Errorf("hsson/ring: invalid %s: %w", name, err)
+		}
+	}
+	return c, nil
+}
+
+func setFromEnv(field reflect.Value, value string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	}
+	return nil
+}
+
+// OptionsFromEnv returns the options set by environment variables prefixed
+// by DefaultEnvPrefix, see ConfigFromEnv, leaving the others to their
+// defaults. The options are validated like by NewKeychain.
+func OptionsFromEnv() (Options, error) {
+	config, err := ConfigFromEnv(DefaultEnvPrefix)
+	if err != nil {
+		return Options{}, err
+	}
+	options := config.Apply(Options{})
+	if err := options.Validate(); err != nil {
+		return Options{}, err
+	}
+	return options, nil
+}
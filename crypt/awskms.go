@@ -0,0 +1,119 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/hsson/ring/internal/awsv4"
+)
+
+// AWSCredentials are the AWS credentials used to sign requests
+type AWSCredentials = awsv4.Credentials
+
+// AWSKMSConfig configures how AWS KMS is used
+type AWSKMSConfig struct {
+	// KeyID is the ID, ARN or alias of the symmetric KMS key
+	KeyID string
+	// Region is the AWS region of the key
+	Region string
+	// Endpoint overrides the KMS endpoint.
+	// Default: https://kms.<region>.amazonaws.com
+	Endpoint string
+	// Credentials returns the credentials used to sign requests. It is
+	// called for every request, so temporary credentials can be refreshed.
+	// Default: credentials from the AWS_* environment variables
+	Credentials func() (AWSCredentials, error)
+	// HTTPClient is used to talk to KMS. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// AWSKMS encrypts data with a key in AWS KMS. KMS limits the plaintext to
+// 4 KiB, which fits all private keys generated by the keychain.
+type AWSKMS struct {
+	config AWSKMSConfig
+}
+
+// NewAWSKMS creates an encryptor using AWS KMS
+func NewAWSKMS(config AWSKMSConfig) *AWSKMS {
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", config.Region)
+	}
+	if config.Credentials == nil {
+		config.Credentials = awsv4.EnvCredentials
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &AWSKMS{config: config}
+}
+
+// Encrypt encrypts plaintext with the configured KMS key
+func (k *AWSKMS) Encrypt(plaintext []byte) ([]byte, error) {
+	var out struct {
+		CiphertextBlob []byte
+	}
+	err := k.do("Encrypt", map[string]interface{}{
+		"KeyId":     k.config.KeyID,
+		"Plaintext": plaintext,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.CiphertextBlob, nil
+}
+
+// Decrypt decrypts ciphertext created by Encrypt
+func (k *AWSKMS) Decrypt(ciphertext []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte
+	}
+	err := k.do("Decrypt", map[string]interface{}{
+		"KeyId":          k.config.KeyID,
+		"CiphertextBlob": ciphertext,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+func (k *AWSKMS) do(operation string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, k.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+operation)
+	creds, err := k.config.Credentials()
+	if err != nil {
+		return err
+	}
+	awsv4.Sign(req, body, creds, k.config.Region, "kms", time.Now())
+
+	res, err := k.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("hsson/ring/crypt: kms %s failed: %s: %s", operation, apiErr.Type, apiErr.Message)
+	}
+	return json.Unmarshal(data, out)
+}
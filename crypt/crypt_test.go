@@ -0,0 +1,39 @@
+package crypt_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/hsson/ring/crypt"
+)
+
+func TestAESGCM(t *testing.T) {
+	e, err := crypt.NewAESGCM(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("private key")
+	ciphertext, err := e.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Errorf("expected plaintext to be encrypted")
+	}
+	decrypted, err := e.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("got %q want %q", decrypted, plaintext)
+	}
+
+	other, err := crypt.NewAESGCM(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(ciphertext); !errors.Is(err, crypt.ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt with another key, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGCPKMSEndpoint = "https://cloudkms.googleapis.com"
+	gcpMetadataTokenURL   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCPKMSConfig configures how Google Cloud KMS is used
+type GCPKMSConfig struct {
+	// KeyName is the resource name of the symmetric key, i.e.
+	// projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>
+	KeyName string
+	// Endpoint overrides the Cloud KMS endpoint.
+	// Default: https://cloudkms.googleapis.com
+	Endpoint string
+	// Token returns the OAuth 2.0 access token used to authenticate.
+	// Default: the token of the default service account, fetched from the
+	// metadata server
+	Token func() (string, error)
+	// HTTPClient is used to talk to Cloud KMS. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// GCPKMS encrypts data with a key in Google Cloud KMS
+type GCPKMS struct {
+	config GCPKMSConfig
+}
+
+// NewGCPKMS creates an encryptor using Google Cloud KMS
+func NewGCPKMS(config GCPKMSConfig) *GCPKMS {
+	if config.Endpoint == "" {
+		config.Endpoint = defaultGCPKMSEndpoint
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Token == nil {
+		config.Token = (&metadataToken{client: config.HTTPClient}).get
+	}
+	return &GCPKMS{config: config}
+}
+
+// Encrypt encrypts plaintext with the configured Cloud KMS key
+func (k *GCPKMS) Encrypt(plaintext []byte) ([]byte, error) {
+	var out struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	if err := k.do("encrypt", map[string][]byte{"plaintext": plaintext}, &out); err != nil {
+		return nil, err
+	}
+	return out.Ciphertext, nil
+}
+
+// Decrypt decrypts ciphertext created by Encrypt
+func (k *GCPKMS) Decrypt(ciphertext []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := k.do("decrypt", map[string][]byte{"ciphertext": ciphertext}, &out); err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+func (k *GCPKMS) do(method string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s:%s", k.config.Endpoint, k.config.KeyName, method)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	token, err := k.config.Token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := k.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("hsson/ring/crypt: cloud kms %s failed: %s", method, res.Status)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// metadataToken fetches and caches access tokens from the metadata server
+type metadataToken struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func (m *metadataToken) get() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Refresh ahead of expiry so tokens do not expire in flight
+	if m.token != "" && time.Now().Add(time.Minute).Before(m.expiresAt) {
+		return m.token, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("hsson/ring/crypt: metadata server returned %s", res.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("hsson/ring/crypt: metadata server returned no token")
+	}
+	m.token = token.AccessToken
+	m.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return m.token, nil
+}
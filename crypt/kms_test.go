@@ -0,0 +1,155 @@
+package crypt_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hsson/ring/crypt"
+)
+
+type encryptor interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+func testRoundTrip(t *testing.T, e encryptor) {
+	t.Helper()
+	plaintext := []byte("private key")
+	ciphertext, err := e.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Errorf("expected plaintext to be encrypted")
+	}
+	decrypted, err := e.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("got %q want %q", decrypted, plaintext)
+	}
+}
+
+// fakeSeal "encrypts" by prefixing and reversing the data
+func fakeSeal(data []byte) []byte {
+	out := []byte("sealed:")
+	for i := len(data) - 1; i >= 0; i-- {
+		out = append(out, data[i])
+	}
+	return out
+}
+
+func fakeOpen(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("sealed:"))
+	out := make([]byte, 0, len(data))
+	for i := len(data) - 1; i >= 0; i-- {
+		out = append(out, data[i])
+	}
+	return out
+}
+
+func TestAWSKMS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var in struct {
+			KeyId          string
+			Plaintext      []byte
+			CiphertextBlob []byte
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.KeyId != "alias/ring" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"CiphertextBlob": fakeSeal(in.Plaintext)})
+		case "TrentService.Decrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": fakeOpen(in.CiphertextBlob)})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	testRoundTrip(t, crypt.NewAWSKMS(crypt.AWSKMSConfig{
+		KeyID:    "alias/ring",
+		Region:   "eu-north-1",
+		Endpoint: server.URL,
+		Credentials: func() (crypt.AWSCredentials, error) {
+			return crypt.AWSCredentials{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+		},
+	}))
+}
+
+func TestGCPKMS(t *testing.T) {
+	const keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var in map[string][]byte
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/" + keyName + ":encrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"ciphertext": fakeSeal(in["plaintext"])})
+		case "/v1/" + keyName + ":decrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"plaintext": fakeOpen(in["ciphertext"])})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	testRoundTrip(t, crypt.NewGCPKMS(crypt.GCPKMSConfig{
+		KeyName:  keyName,
+		Endpoint: server.URL,
+		Token:    func() (string, error) { return "token", nil },
+	}))
+}
+
+func TestVaultTransit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var in struct {
+			Plaintext  []byte `json:"plaintext"`
+			Ciphertext string `json:"ciphertext"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/ring":
+			ciphertext := "vault:v1:" + base64.StdEncoding.EncodeToString(fakeSeal(in.Plaintext))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": ciphertext}})
+		case "/v1/transit/decrypt/ring":
+			sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(in.Ciphertext, "vault:v1:"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string][]byte{"plaintext": fakeOpen(sealed)}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	testRoundTrip(t, crypt.NewVaultTransit(crypt.VaultTransitConfig{
+		Address: server.URL,
+		Token:   "token",
+		Key:     "ring",
+	}))
+}
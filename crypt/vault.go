@@ -0,0 +1,108 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// VaultTransitConfig configures how the Vault transit secrets engine is used
+type VaultTransitConfig struct {
+	// Address of the Vault server. Default: the VAULT_ADDR environment
+	// variable
+	Address string
+	// Token used to authenticate. Default: the VAULT_TOKEN environment
+	// variable
+	Token string
+	// MountPath is where the transit engine is mounted. Default: transit
+	MountPath string
+	// Key is the name of the transit encryption key
+	Key string
+	// HTTPClient is used to talk to Vault. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// VaultTransit encrypts data with a key in the Vault transit secrets engine.
+// The ciphertext is the "vault:v<version>:..." string returned by Vault, so
+// keys can be rotated in Vault without breaking decryption.
+type VaultTransit struct {
+	config VaultTransitConfig
+}
+
+// NewVaultTransit creates an encryptor using Vault transit
+func NewVaultTransit(config VaultTransitConfig) *VaultTransit {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.MountPath == "" {
+		config.MountPath = "transit"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &VaultTransit{config: config}
+}
+
+// Encrypt encrypts plaintext with the configured transit key
+func (v *VaultTransit) Encrypt(plaintext []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := v.do("encrypt", map[string]interface{}{"plaintext": plaintext}, &out); err != nil {
+		return nil, err
+	}
+	return []byte(out.Data.Ciphertext), nil
+}
+
+// Decrypt decrypts ciphertext created by Encrypt
+func (v *VaultTransit) Decrypt(ciphertext []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Plaintext []byte `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.do("decrypt", map[string]interface{}{"ciphertext": string(ciphertext)}, &out); err != nil {
+		return nil, err
+	}
+	return out.Data.Plaintext, nil
+}
+
+func (v *VaultTransit) do(operation string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", v.config.Address, v.config.MountPath, operation, v.config.Key)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", v.config.Token)
+
+	res, err := v.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("hsson/ring/crypt: vault %s failed: %s %v", operation, res.Status, apiErr.Errors)
+	}
+	return json.Unmarshal(data, out)
+}
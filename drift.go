@@ -0,0 +1,174 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// Drift describes an instance which is signing with another key than the
+// newest active signing key in the store.
+type Drift struct {
+	// InstanceID identifies the drifting instance
+	InstanceID string
+	// KeyID is the signing key the instance last reported using
+	KeyID string
+	// ExpectedKeyID is the newest active signing key in the store
+	ExpectedKeyID string
+	// LastSeen is when the instance last wrote a heartbeat
+	LastSeen time.Time
+	// Duration is how long the instance has been drifting
+	Duration time.Duration
+}
+
+type heartbeat struct {
+	KeyID string    `json:"key_id"`
+	At    time.Time `json:"at"`
+	// RotatedAt is the RotatedAt of the key, as its private key may no
+	// longer be in the store when the instance is found drifting
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+func (r *ring) Heartbeat() error {
+	return r.heartbeat(context.Background())
+}
+
+// maxHeartbeatInterval caps how often the worker refreshes the heartbeat
+// of the instance, see heartbeatInterval
+const maxHeartbeatInterval = 5 * time.Minute
+
+// heartbeatInterval is how often the worker refreshes the heartbeat of the
+// instance, and checks for drift if Options.DriftThreshold is set
+func (r *ring) heartbeatInterval() time.Duration {
+	if interval := r.options.RotationFrequency / 4; interval < maxHeartbeatInterval {
+		return interval
+	}
+	return maxHeartbeatInterval
+}
+
+func (r *ring) heartbeat(ctx context.Context) error {
+	key, ok := r.currentSigningKey.Load().(*SigningKey)
+	if !ok {
+		return errors.New("not initialized")
+	}
+	now := r.options.Clock.Now()
+	data, err := json.Marshal(heartbeat{KeyID: key.ID, At: now, RotatedAt: key.RotatedAt})
+	if err != nil {
+		return err
+	}
+
+	id := fmt.Sprintf("%s%s", heartbeatIDPrefix, r.options.InstanceID)
+	if err := r.store.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.store.Add(ctx, store.Key{
+		ID:        id,
+		IsPrivate: false,
+		// Instances which don't run the worker only write heartbeats when
+		// rotating, so an instance skipping a rotation must still be
+		// reported once the next key has been active for DriftThreshold.
+		// Stopped instances are no longer of interest after that.
+		ExpiresAt: now.Add(2*r.options.RotationFrequency + r.options.DriftThreshold),
+		Data:      data,
+	})
+}
+
+// checkDrift reports instances drifting for longer than
+// Options.DriftThreshold to OnDrift and the MetricsCollector
+func (r *ring) checkDrift() {
+	if r.options.DriftThreshold <= 0 {
+		return
+	}
+	drifts, err := r.DetectDrift(r.options.DriftThreshold)
+	if err != nil {
+		r.options.Logger.Error("failed to detect drift", "error", err)
+		return
+	}
+	if collector, ok := r.options.MetricsCollector.(DriftCollector); ok {
+		collector.DriftingInstances(len(drifts))
+	}
+	for _, drift := range drifts {
+		r.options.Logger.Warn("instance is signing with a stale key", "instance_id", drift.InstanceID, "key_id", drift.KeyID, "expected_key_id", drift.ExpectedKeyID, "duration", drift.Duration)
+		if r.options.OnDrift != nil {
+			r.options.OnDrift(drift)
+		}
+	}
+}
+
+func (r *ring) DetectDrift(threshold time.Duration) ([]Drift, error) {
+	ctx := context.Background()
+	privateKeys, err := r.getNonExpiredPrivateKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Keys become active one rotation period before they expire, and keys
+	// published in advance are not active yet
+	now := r.options.Clock.Now()
+	activeSince := make(map[string]time.Time, len(privateKeys))
+	var newest string
+	for _, key := range privateKeys {
+		since := r.privateKeyRotatedAt(key).Add(-r.options.RotationFrequency)
+		if since.After(now) {
+			continue
+		}
+		activeSince[key.ID] = since
+		if newest == "" || since.After(activeSince[newest]) {
+			newest = key.ID
+		}
+	}
+	if newest == "" {
+		return nil, nil
+	}
+
+	heartbeats, err := r.getNonExpiredKeys(ctx, store.KeyFilter{IsPrivate: &public, IDPrefix: heartbeatIDPrefix}, func(key store.Key) bool {
+		return !key.IsPrivate && strings.HasPrefix(key.ID, heartbeatIDPrefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, key := range heartbeats {
+		var hb heartbeat
+		if err := json.Unmarshal(key.Data, &hb); err != nil {
+			return nil, err
+		}
+		if hb.KeyID == newest {
+			continue
+		}
+		if duration := now.Sub(driftingSince(activeSince, hb)); duration > threshold {
+			drifts = append(drifts, Drift{
+				InstanceID:    strings.TrimPrefix(key.ID, heartbeatIDPrefix),
+				KeyID:         hb.KeyID,
+				ExpectedKeyID: newest,
+				LastSeen:      hb.At,
+				Duration:      duration,
+			})
+		}
+	}
+	return drifts, nil
+}
+
+// driftingSince returns when the instance which wrote hb started drifting:
+// when the first key newer than its key became active, given when each
+// active key became active, or when its key was due to be rotated if that
+// was earlier, e.g. as the newer key was created lazily. Keys which are no
+// longer in the store are older than all active keys.
+func driftingSince(activeSince map[string]time.Time, hb heartbeat) time.Time {
+	used, known := activeSince[hb.KeyID]
+	since := hb.RotatedAt
+	for id, t := range activeSince {
+		if id == hb.KeyID || (known && !t.After(used)) {
+			continue
+		}
+		if since.IsZero() || t.Before(since) {
+			since = t
+		}
+	}
+	return since
+}
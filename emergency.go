@@ -0,0 +1,98 @@
+package ring
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hsson/ring/store"
+)
+
+func (r *ring) EmergencyRotate(reason string) (*SigningKey, error) {
+	ctx := context.Background()
+	if err := r.store.Lock(ctx); err != nil {
+		return nil, err
+	}
+	// The lock is released even if ctx is done
+	defer r.store.Unlock(context.Background())
+	stopRenewing := r.keepLock()
+	defer stopRenewing()
+
+	newKey, err := r.createNewSigningKey()
+	if err != nil {
+		return nil, &RotationError{Cause: err}
+	}
+	if err := r.storeSigningKey(ctx, newKey); err != nil {
+		return nil, &RotationError{Cause: err}
+	}
+	old, _ := r.currentSigningKey.Load().(*SigningKey)
+	r.currentSigningKey.Store(newKey)
+	r.zeroizeRetiredKeys()
+	r.retire(old)
+	r.stagedMu.Lock()
+	r.staged = nil
+	r.stagedMu.Unlock()
+	oldID := ""
+	if old != nil {
+		oldID = old.ID
+	}
+	r.options.Logger.Warn("emergency rotation", "reason", reason, "old_key_id", oldID, "key_id", newKey.ID)
+
+	revoked, err := r.revokeAllExcept(ctx, newKey.ID)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.heartbeat(ctx)
+
+	if r.options.AuditSink != nil {
+		r.record(AuditRecord{
+			Event:         AuditEmergencyRotated,
+			KeyID:         newKey.ID,
+			PreviousKeyID: oldID,
+			Reason:        reason,
+			Fingerprint:   auditFingerprint(newKey),
+		})
+	}
+	if r.options.OnRotate != nil {
+		r.options.OnRotate(old, newKey)
+	}
+	if r.options.OnEmergencyRotate != nil {
+		r.options.OnEmergencyRotate(reason, newKey, revoked)
+	}
+	return newKey, nil
+}
+
+// revokeAllExcept revokes every keypair but keep, returning the IDs of the
+// revoked keys. Private keys without a public key are deleted.
+func (r *ring) revokeAllExcept(ctx context.Context, keep string) ([]string, error) {
+	publicKeys, err := r.getNonExpiredPublicKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var revoked []string
+	for _, publicKey := range publicKeys {
+		id := strings.TrimPrefix(publicKey.ID, publicKeyIDPrefix)
+		if id == keep {
+			continue
+		}
+		if err := r.revoke(ctx, id, publicKey); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, id)
+	}
+
+	privateKeys, err := r.getNonExpiredKeys(ctx, store.KeyFilter{IsPrivate: &private}, func(key store.Key) bool {
+		return key.IsPrivate && !isSecretID(key.ID) && !isPostQuantumKeyID(key.ID)
+	})
+	if err != nil {
+		return revoked, err
+	}
+	for _, key := range privateKeys {
+		if key.ID == keep {
+			continue
+		}
+		if err := store.SecureErase(ctx, r.store, key.ID); err != nil {
+			return revoked, err
+		}
+	}
+	return revoked, nil
+}
@@ -0,0 +1,177 @@
+package ring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrDecrypt is returned when ciphertext can not be decrypted, e.g. because
+// it was encrypted with another key or has been tampered with
+var ErrDecrypt = errors.New("hsson/ring: failed to decrypt")
+
+// Decrypter decrypts data encrypted by an EncryptionKey
+type Decrypter interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// EncryptionKey is an AES-256-GCM key of an EncryptionKeychain. It
+// implements Encryptor, prepending a random nonce to the ciphertext.
+type EncryptionKey struct {
+	ID string
+	// CreatedAt is when the key was created
+	CreatedAt time.Time
+	// RotatedAt is when the key is replaced by a new encryption key
+	RotatedAt time.Time
+	// ExpiresAt is when the key is deleted, after which data encrypted with
+	// it can no longer be decrypted
+	ExpiresAt time.Time
+
+	aead   cipher.AEAD
+	random io.Reader
+}
+
+// Encrypt encrypts plaintext with a fresh random nonce
+func (k *EncryptionKey) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(plaintext)+k.aead.Overhead())
+	if _, err := io.ReadFull(k.random, nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt decrypts ciphertext created by Encrypt
+func (k *EncryptionKey) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < k.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := ciphertext[:k.aead.NonceSize()], ciphertext[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// EncryptionKeychain rotates data-encryption keys, e.g. for encrypting PII
+// fields. Keys are rotated every RotationFrequency and kept for
+// VerificationPeriod, after which data still encrypted with them can no
+// longer be decrypted. VerificationPeriod must therefore exceed the time
+// data is kept before it is re-encrypted with the current key.
+type EncryptionKeychain interface {
+	// EncryptionKey returns the current key, rotating it if it has expired
+	EncryptionKey() (*EncryptionKey, error)
+	// GetDecrypter returns the key identified by id. It returns
+	// ErrKeyNotFound if there is no such key or it has expired.
+	GetDecrypter(id string) (Decrypter, error)
+	// Rotate replaces the current key right away
+	Rotate() error
+	// Encrypt encrypts plaintext with the current key. The ID of the key
+	// is included in the ciphertext.
+	Encrypt(plaintext []byte) ([]byte, error)
+	// Decrypt decrypts ciphertext created by Encrypt, using the key it
+	// was encrypted with
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// NewEncryptionKeychain creates an EncryptionKeychain using the store. Keys
+// are encrypted by the Encryptor of options, which is required. The
+// Algorithm, KeySize, IDStrategy and options of signing keys in general are
+// not used. An encryption keychain may share a namespace with a Keychain or
+// SecretKeychain.
+func NewEncryptionKeychain(s store.Store, options Options) (EncryptionKeychain, error) {
+	options = options.withDefaults()
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	if options.Encryptor == nil {
+		return nil, errors.New("hsson/ring: encryption keychains require an Encryptor")
+	}
+	return &encryptionKeychain{
+		secrets: newSecretKeychain(s, options, encryptionIDPrefix, PurposeEncryption),
+	}, nil
+}
+
+type encryptionKeychain struct {
+	secrets *secretKeychain
+}
+
+func (k *encryptionKeychain) EncryptionKey() (*EncryptionKey, error) {
+	secret, err := k.secrets.SigningSecret()
+	if err != nil {
+		return nil, err
+	}
+	return k.encryptionKey(secret)
+}
+
+func (k *encryptionKeychain) GetDecrypter(id string) (Decrypter, error) {
+	secret, err := k.secrets.GetSecret(id)
+	if err != nil {
+		return nil, err
+	}
+	return k.encryptionKey(secret)
+}
+
+func (k *encryptionKeychain) Rotate() error {
+	return k.secrets.Rotate()
+}
+
+func (k *encryptionKeychain) encryptionKey(secret *Secret) (*EncryptionKey, error) {
+	block, err := aes.NewCipher(secret.Key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	random := k.secrets.options.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+	return &EncryptionKey{
+		ID:        secret.ID,
+		CreatedAt: secret.CreatedAt,
+		RotatedAt: secret.RotatedAt,
+		ExpiresAt: secret.ExpiresAt,
+		aead:      aead,
+		random:    random,
+	}, nil
+}
+
+// Encrypt prefixes the ciphertext with the length of the key ID and the key
+// ID itself
+func (k *encryptionKeychain) Encrypt(plaintext []byte) ([]byte, error) {
+	key, err := k.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(key.ID) > 255 {
+		return nil, errors.New("hsson/ring: encryption key ID is too long")
+	}
+	sealed, err := key.Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, 0, 1+len(key.ID)+len(sealed))
+	ciphertext = append(ciphertext, byte(len(key.ID)))
+	ciphertext = append(ciphertext, key.ID...)
+	return append(ciphertext, sealed...), nil
+}
+
+func (k *encryptionKeychain) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 1 || len(ciphertext) < 1+int(ciphertext[0]) {
+		return nil, ErrDecrypt
+	}
+	id, sealed := string(ciphertext[1:1+ciphertext[0]]), ciphertext[1+ciphertext[0]:]
+	key, err := k.GetDecrypter(id)
+	if err != nil {
+		return nil, err
+	}
+	return key.Decrypt(sealed)
+}
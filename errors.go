@@ -0,0 +1,21 @@
+package ring
+
+// causeError is an error of kind, one of the sentinel errors of the package,
+// caused by another error. Both are matched by errors.Is and errors.As, as
+// fmt.Errorf can only wrap a single error.
+type causeError struct {
+	kind  error
+	cause error
+}
+
+func (e *causeError) Error() string {
+	return e.kind.Error() + ": " + e.cause.Error()
+}
+
+func (e *causeError) Unwrap() error {
+	return e.cause
+}
+
+func (e *causeError) Is(target error) bool {
+	return target == e.kind
+}
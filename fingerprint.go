@@ -0,0 +1,106 @@
+package ring
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// Fingerprint is the SHA-256 digest of the PKIX encoding of a public key
+type Fingerprint [sha256.Size]byte
+
+// Hex renders the fingerprint as a lowercase hex string
+func (f Fingerprint) Hex() string {
+	return hex.EncodeToString(f[:])
+}
+
+// Base64 renders the fingerprint as an unpadded base64url string
+func (f Fingerprint) Base64() string {
+	return base64.RawURLEncoding.EncodeToString(f[:])
+}
+
+// String renders the fingerprint in hex
+func (f Fingerprint) String() string {
+	return f.Hex()
+}
+
+// IsZero reports whether f is the zero Fingerprint, which is returned for
+// public keys that can't be encoded
+func (f Fingerprint) IsZero() bool {
+	return f == Fingerprint{}
+}
+
+// ParseFingerprint parses a fingerprint rendered either by Hex or Base64
+func ParseFingerprint(s string) (Fingerprint, error) {
+	var f Fingerprint
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != len(f) {
+		data, err = base64.RawURLEncoding.DecodeString(s)
+	}
+	if err != nil || len(data) != len(f) {
+		return f, errors.New("hsson/ring: invalid fingerprint")
+	}
+	copy(f[:], data)
+	return f, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the verifier public key,
+// or the zero Fingerprint if the key can't be encoded in PKIX
+func (vk *VerifierKey) Fingerprint() Fingerprint {
+	f, _ := fingerprint(vk.Key)
+	return f
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the public key of the
+// signing key, matching the Fingerprint of its VerifierKey
+func (sk *SigningKey) Fingerprint() Fingerprint {
+	f, _ := fingerprint(sk.Key.Public())
+	return f
+}
+
+// Equal reports whether vk and other hold the same public key, regardless of
+// their IDs and other attributes, e.g. to deduplicate the keys of several
+// verifiers
+func (vk *VerifierKey) Equal(other *VerifierKey) bool {
+	if vk == nil || other == nil {
+		return vk == other
+	}
+	key, ok := vk.Key.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(other.Key)
+}
+
+func fingerprint(pub interface{}) (Fingerprint, error) {
+	bytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	return sha256.Sum256(bytes), nil
+}
+
+// withFingerprint appends the fingerprint of key to the log args, unless it
+// can't be computed
+func withFingerprint(key *SigningKey, args ...interface{}) []interface{} {
+	if f := key.Fingerprint(); !f.IsZero() {
+		args = append(args, "fingerprint", f)
+	}
+	return args
+}
+
+func (r *ring) GetVerifierByFingerprint(fingerprint Fingerprint) (*VerifierKey, error) {
+	if fingerprint.IsZero() {
+		return nil, ErrKeyNotFound
+	}
+	verifiers, err := r.ListVerifiers()
+	if err != nil {
+		return nil, err
+	}
+	for _, verifier := range verifiers {
+		if verifier.Fingerprint() == fingerprint {
+			return verifier, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
@@ -0,0 +1,51 @@
+package ring
+
+import "errors"
+
+// ErrFIPSUnavailable is returned when creating a keychain with Options.FIPS
+// set, unless the binary uses a FIPS 140 validated crypto backend
+var ErrFIPSUnavailable = errors.New("hsson/ring: FIPS 140 crypto backend not enabled")
+
+// minFIPSRSAPublicExponent is the smallest public exponent of RSA keys
+// allowed by FIPS 186
+const minFIPSRSAPublicExponent = 1<<16 + 1
+
+// FIPSEnabled reports if the binary uses a FIPS 140 validated crypto
+// backend, i.e. the Go Cryptographic Module in FIPS 140-3 mode (Go 1.24
+// or later with GODEBUG=fips140=on) or BoringCrypto (built with
+// GOEXPERIMENT=boringcrypto)
+func FIPSEnabled() bool {
+	return fipsEnabled()
+}
+
+// fipsAlgorithm reports if keys of algorithm are approved in FIPS mode.
+// Ed25519 is not, as BoringCrypto does not implement it.
+func fipsAlgorithm(algorithm Algorithm) bool {
+	switch algorithm {
+	case RSA, ECDSAP256, ECDSAP384, ECDSAP521:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateFIPS checks that options only use approved algorithms and
+// parameters, and that the crypto backend is validated
+func (o Options) validateFIPS() error {
+	if !fipsAlgorithm(o.Algorithm) {
+		return errors.New("hsson/ring: Algorithm must be approved by FIPS 186 with FIPS set")
+	}
+	if o.RSAPrimes > 2 {
+		return errors.New("hsson/ring: RSAPrimes can't be used with FIPS set")
+	}
+	if o.RSAPublicExponent != 0 && o.RSAPublicExponent < minFIPSRSAPublicExponent {
+		return errors.New("hsson/ring: RSAPublicExponent must be > 65536 with FIPS set")
+	}
+	if o.Rand != nil {
+		return errors.New("hsson/ring: Rand can't be used with FIPS set")
+	}
+	if !fipsEnabled() {
+		return ErrFIPSUnavailable
+	}
+	return nil
+}
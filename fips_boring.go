@@ -0,0 +1,10 @@
+//go:build boringcrypto && !go1.24
+// +build boringcrypto,!go1.24
+
+package ring
+
+import "crypto/boring"
+
+func fipsEnabled() bool {
+	return boring.Enabled()
+}
@@ -0,0 +1,10 @@
+//go:build go1.24
+// +build go1.24
+
+package ring
+
+import "crypto/fips140"
+
+func fipsEnabled() bool {
+	return fips140.Enabled()
+}
@@ -0,0 +1,8 @@
+//go:build !boringcrypto && !go1.24
+// +build !boringcrypto,!go1.24
+
+package ring
+
+func fipsEnabled() bool {
+	return false
+}
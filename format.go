@@ -0,0 +1,265 @@
+package ring
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrUnsupportedFormat is returned when loading a key stored in a format
+// this version of the keychain does not understand, e.g. one written by a
+// later version.
+var ErrUnsupportedFormat = errors.New("hsson/ring: unsupported storage format")
+
+// storageFormatVersion is the version of the envelope written around the
+// data of stored keys
+const storageFormatVersion = 1
+
+// storageMagic starts key data written with an envelope. Data without it
+// was written by earlier versions, and holds DER directly, which can never
+// start with a zero byte.
+var storageMagic = []byte("\x00hsson/ring\x00")
+
+// Encodings of the payload of stored keys
+const (
+	encodingPKCS8     = "pkcs8"
+	encodingPKIX      = "pkix"
+	encodingX509      = "x509"
+	encodingReference = "ref"
+	encodingSecret    = "secret"
+	// encodingSeed and encodingRaw hold the private and public keys of
+	// post-quantum algorithms
+	encodingSeed = "seed"
+	encodingRaw  = "raw"
+)
+
+// KeyDataEncoding is how the data of stored keys is encoded, see
+// Options.KeyDataEncoding
+type KeyDataEncoding string
+
+const (
+	// KeyDataDER stores DER in a binary envelope
+	KeyDataDER KeyDataEncoding = "der"
+	// KeyDataPEM stores PEM, with the envelope in the PEM headers
+	KeyDataPEM KeyDataEncoding = "pem"
+	// KeyDataCompressed stores DER compressed with DEFLATE in a binary
+	// envelope
+	KeyDataCompressed KeyDataEncoding = "deflate"
+)
+
+// pemTypes are the PEM block types of each encoding
+var pemTypes = map[string]string{
+	encodingPKCS8:     "PRIVATE KEY",
+	encodingPKIX:      "PUBLIC KEY",
+	encodingX509:      "CERTIFICATE",
+	encodingReference: "KEY REFERENCE",
+	encodingSecret:    "SECRET",
+	encodingSeed:      "PRIVATE KEY SEED",
+	encodingRaw:       "PUBLIC KEY DATA",
+}
+
+// pemTypeEncrypted is the PEM block type of encrypted payloads, which are
+// not the standard encrypted PKCS #8
+const pemTypeEncrypted = "RING ENCRYPTED DATA"
+
+// PEM headers holding the fields of storageHeader
+const (
+	pemHeaderVersion    = "Ring-Version"
+	pemHeaderEncoding   = "Ring-Encoding"
+	pemHeaderAlgorithm  = "Ring-Algorithm"
+	pemHeaderEncrypted  = "Ring-Encrypted"
+	pemHeaderCompressed = "Ring-Compressed"
+)
+
+// storageHeader describes the payload of a stored key. Fields unknown to
+// this version are ignored, so they can be added without a new version.
+type storageHeader struct {
+	Version   int       `json:"v"`
+	Encoding  string    `json:"encoding"`
+	Algorithm Algorithm `json:"alg,omitempty"`
+	Encrypted bool      `json:"encrypted,omitempty"`
+	// Compressed is set if the payload is compressed with DEFLATE, before
+	// it is encrypted
+	Compressed bool `json:"compressed,omitempty"`
+}
+
+// encodeKeyData wraps der in an envelope, or PEM, encrypting private keys
+// and secrets if an Encryptor is set
+func (v *verifier) encodeKeyData(encoding string, algorithm Algorithm, der []byte) ([]byte, error) {
+	header := storageHeader{Version: storageFormatVersion, Encoding: encoding, Algorithm: algorithm}
+	payload := der
+	if v.options.KeyDataEncoding == KeyDataCompressed {
+		var err error
+		if payload, err = compress(payload); err != nil {
+			return nil, err
+		}
+		header.Compressed = true
+	}
+	if (encoding == encodingPKCS8 || encoding == encodingSecret || encoding == encodingSeed) && v.options.Encryptor != nil {
+		var err error
+		payload, err = v.options.Encryptor.Encrypt(payload)
+		if err != nil {
+			return nil, fmt.Errorf("private key could not be encrypted: %w", err)
+		}
+		header.Encrypted = true
+	}
+	if v.options.LegacyStorageFormat {
+		return payload, nil
+	}
+	if v.options.KeyDataEncoding == KeyDataPEM {
+		return encodePEM(header, payload), nil
+	}
+
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(storageMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(headerData)))
+	buf.Write(headerData)
+	buf.Write(payload)
+	return buf.Bytes(), nil
+}
+
+// decodeKeyData returns the DER of a stored key, which must have the given
+// encoding. Private keys are decrypted if needed.
+func (v *verifier) decodeKeyData(key store.Key, encoding string) ([]byte, error) {
+	var header storageHeader
+	var payload []byte
+	var err error
+	switch {
+	case bytes.HasPrefix(key.Data, storageMagic):
+		header, payload, err = decodeEnvelope(key.Data[len(storageMagic):])
+	case bytes.HasPrefix(key.Data, pemPrefix):
+		header, payload, err = decodePEM(key.Data)
+	default:
+		// Written by an earlier version, in which private keys are
+		// encrypted if an Encryptor is set
+		if key.IsPrivate && v.options.Encryptor != nil {
+			return v.decrypt(key.Data)
+		}
+		return key.Data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.Version > storageFormatVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedFormat, header.Version)
+	}
+	if header.Encoding != encoding {
+		return nil, fmt.Errorf("%w: encoding %q", ErrUnsupportedFormat, header.Encoding)
+	}
+	if header.Encrypted {
+		if v.options.Encryptor == nil {
+			return nil, errors.New("private key is encrypted, but no Encryptor is set")
+		}
+		if payload, err = v.decrypt(payload); err != nil {
+			return nil, err
+		}
+	}
+	if header.Compressed {
+		return decompress(payload)
+	}
+	return payload, nil
+}
+
+// decodeEnvelope returns the header and payload of data following the
+// storage magic
+func decodeEnvelope(data []byte) (storageHeader, []byte, error) {
+	if len(data) < 4 {
+		return storageHeader{}, nil, fmt.Errorf("%w: truncated header", ErrUnsupportedFormat)
+	}
+	length := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(length) > uint64(len(data)) {
+		return storageHeader{}, nil, fmt.Errorf("%w: truncated header", ErrUnsupportedFormat)
+	}
+	var header storageHeader
+	if err := json.Unmarshal(data[:length], &header); err != nil {
+		return storageHeader{}, nil, &causeError{kind: ErrUnsupportedFormat, cause: err}
+	}
+	return header, data[length:], nil
+}
+
+// pemPrefix starts key data stored as PEM, which DER never does
+var pemPrefix = []byte("-----BEGIN ")
+
+func encodePEM(header storageHeader, payload []byte) []byte {
+	block := &pem.Block{
+		Type: pemTypes[header.Encoding],
+		Headers: map[string]string{
+			pemHeaderVersion:  strconv.Itoa(header.Version),
+			pemHeaderEncoding: header.Encoding,
+		},
+		Bytes: payload,
+	}
+	if header.Algorithm != "" {
+		block.Headers[pemHeaderAlgorithm] = string(header.Algorithm)
+	}
+	if header.Encrypted {
+		block.Type = pemTypeEncrypted
+		block.Headers[pemHeaderEncrypted] = "true"
+	}
+	if header.Compressed {
+		block.Headers[pemHeaderCompressed] = "true"
+	}
+	return pem.EncodeToMemory(block)
+}
+
+func decodePEM(data []byte) (storageHeader, []byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return storageHeader{}, nil, fmt.Errorf("%w: invalid PEM", ErrUnsupportedFormat)
+	}
+	version, err := strconv.Atoi(block.Headers[pemHeaderVersion])
+	if err != nil {
+		return storageHeader{}, nil, &causeError{kind: ErrUnsupportedFormat, cause: err}
+	}
+	return storageHeader{
+		Version:    version,
+		Encoding:   block.Headers[pemHeaderEncoding],
+		Algorithm:  Algorithm(block.Headers[pemHeaderAlgorithm]),
+		Encrypted:  block.Headers[pemHeaderEncrypted] == "true",
+		Compressed: block.Headers[pemHeaderCompressed] == "true",
+	}, block.Bytes, nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	res, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, &causeError{kind: ErrUnsupportedFormat, cause: err}
+	}
+	return res, nil
+}
+
+func (v *verifier) decrypt(data []byte) ([]byte, error) {
+	plaintext, err := v.options.Encryptor.Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("private key could not be decrypted: %w", err)
+	}
+	return plaintext, nil
+}
@@ -2,7 +2,4 @@ module github.com/hsson/ring
 
 go 1.14
 
-require (
-	github.com/hsson/once v1.0.1
-	github.com/matoous/go-nanoid/v2 v2.0.0
-)
+require github.com/matoous/go-nanoid/v2 v2.0.0
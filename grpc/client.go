@@ -0,0 +1,150 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hsson/ring"
+)
+
+// Client calls the keychain service of a gRPC server. It implements
+// ring.Verifier, so it can be used wherever verifier keys are looked up.
+type Client struct {
+	target string
+	client *http.Client
+}
+
+var _ ring.Verifier = (*Client)(nil)
+
+// NewClient creates a client calling the server at target, e.g.
+// https://keys.internal:8443. The http.Client must support HTTP/2, which
+// is the case for clients using the default transport with TLS.
+// Default: http.DefaultClient
+func NewClient(target string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{target: strings.TrimSuffix(target, "/"), client: client}
+}
+
+func (c *Client) call(ctx context.Context, method string, req []byte) ([]byte, error) {
+	httpReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s/%s", c.target, serviceName, method), bytes.NewReader(frame(req)))
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+
+	res, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	// Trailers are only available once the body has been read
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hsson/ring/grpc: unexpected HTTP status %s", res.Status)
+	}
+
+	code, message := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if code == "" {
+		// Responses without a message may carry the status as headers
+		code, message = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	status, err := strconv.ParseUint(code, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("hsson/ring/grpc: invalid status %q", code)
+	}
+	if Code(status) != OK {
+		if Code(status) == NotFound {
+			return nil, ring.ErrKeyNotFound
+		}
+		if unescaped, err := url.PathUnescape(message); err == nil {
+			message = unescaped
+		}
+		return nil, &StatusError{Code: Code(status), Message: message}
+	}
+	return readFrame(bytes.NewReader(body))
+}
+
+// GetVerifier gets the public key for a specific keypair identified by id
+func (c *Client) GetVerifier(id string) (*ring.VerifierKey, error) {
+	return c.GetVerifierContext(context.Background(), id)
+}
+
+// GetVerifierContext is like GetVerifier, but uses the context for the call
+func (c *Client) GetVerifierContext(ctx context.Context, id string) (*ring.VerifierKey, error) {
+	res, err := c.call(ctx, "GetVerifier", appendString(nil, 1, id))
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalVerifier(res)
+}
+
+// ListVerifiers lists all currently active public keys
+func (c *Client) ListVerifiers() ([]*ring.VerifierKey, error) {
+	return c.ListVerifiersContext(context.Background())
+}
+
+// ListVerifiersContext is like ListVerifiers, but uses the context for the
+// call
+func (c *Client) ListVerifiersContext(ctx context.Context) ([]*ring.VerifierKey, error) {
+	res, err := c.call(ctx, "ListVerifiers", nil)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalVerifiers(res)
+}
+
+// Sign signs data with the current signing key of the server, like
+// ring.Keychain.Sign, and returns the signature together with the ID of
+// the key used.
+func (c *Client) Sign(ctx context.Context, data []byte) (signature []byte, keyID string, err error) {
+	return parseSignResponse(c.call(ctx, "Sign", appendBytes(nil, 1, data)))
+}
+
+// SignDigest signs a digest created using hash with the current signing key
+// of the server, like ring.SignatureService.SignDigest. Only SHA-256,
+// SHA-384, SHA-512 and the zero hash of Ed25519 keys are supported.
+func (c *Client) SignDigest(ctx context.Context, hash crypto.Hash, digest []byte) (signature []byte, keyID string, err error) {
+	name, ok := hashNames[hash]
+	if !ok {
+		return nil, "", fmt.Errorf("hsson/ring/grpc: unsupported hash %v", hash)
+	}
+	return parseSignResponse(c.call(ctx, "SignDigest", appendBytes(appendString(nil, 1, name), 2, digest)))
+}
+
+func parseSignResponse(res []byte, err error) (signature []byte, keyID string, _ error) {
+	if err != nil {
+		return nil, "", err
+	}
+	err = parseMessage(res, func(f field) error {
+		switch f.num {
+		case 1:
+			signature = f.bytes
+		case 2:
+			keyID = string(f.bytes)
+		}
+		return nil
+	})
+	return signature, keyID, err
+}
+
+// hashNames are the names of hashes in a SignDigestRequest
+var hashNames = map[crypto.Hash]string{
+	crypto.Hash(0): "",
+	crypto.SHA256:  "SHA-256",
+	crypto.SHA384:  "SHA-384",
+	crypto.SHA512:  "SHA-512",
+}
@@ -0,0 +1,236 @@
+// Package grpc exposes a keychain as the gRPC service defined in
+// ring.proto, so a central key service can run the keychain while other
+// services, possibly written in other languages, fetch verifier keys and
+// request signatures without access to the store.
+//
+// The protocol is implemented on top of net/http, without depending on the
+// gRPC libraries. gRPC requires HTTP/2, which net/http only negotiates over
+// TLS:
+//
+//	server := &http.Server{Addr: ":8443", Handler: grpc.NewServer(keychain, grpc.ServerOptions{})}
+//	err := server.ListenAndServeTLS(certFile, keyFile)
+package grpc
+
+import (
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hsson/ring"
+)
+
+// serviceName is the full name of the service in ring.proto
+const serviceName = "ring.v1.Keychain"
+
+// maxMessageSize is the largest request or response accepted
+const maxMessageSize = 4 << 20
+
+// Code is a gRPC status code
+type Code uint32
+
+// The gRPC status codes used by the service
+const (
+	OK               Code = 0
+	InvalidArgument  Code = 3
+	NotFound         Code = 5
+	PermissionDenied Code = 7
+	// ResourceExhausted is returned when a caller exceeds the rate limit
+	// of the ring.SignatureService
+	ResourceExhausted Code = 8
+	Internal          Code = 13
+	Unimplemented     Code = 12
+	Unauthenticated   Code = 16
+)
+
+// StatusError is returned by the client when a call fails with a status
+// other than OK. Calls failing with NotFound return ring.ErrKeyNotFound
+// instead.
+type StatusError struct {
+	Code    Code
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("hsson/ring/grpc: status %d: %s", e.Code, e.Message)
+}
+
+// frame prefixes message with the gRPC message header, marking it as
+// uncompressed
+func frame(message []byte) []byte {
+	b := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(message)))
+	return append(b, message...)
+}
+
+// readFrame reads a single uncompressed message from r
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, &StatusError{Code: Unimplemented, Message: "compression is not supported"}
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxMessageSize {
+		return nil, &StatusError{Code: InvalidArgument, Message: "message too large"}
+	}
+	message := make([]byte, n)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// ServerOptions customize the behavior of the gRPC server
+type ServerOptions struct {
+	// Authorize, if set, decides if a call is allowed, e.g. by checking
+	// the client certificate of the request. Default: nil, all calls are
+	// allowed, so access must be restricted by the network or by
+	// requiring client certificates in the TLS config of the server
+	Authorize func(r *http.Request) bool
+	// Caller, if set, identifies the caller of a request, e.g. by the
+	// subject of its client certificate. Callers are rate limited
+	// separately and recorded in the audit records of the
+	// ring.SignatureService, see ring.WithCaller
+	Caller func(r *http.Request) string
+}
+
+// Server serves the keychain service as an http.Handler. Signing goes
+// through a ring.SignatureService, so callers never receive private keys.
+type Server struct {
+	service ring.SignatureService
+	options ServerOptions
+}
+
+// NewServer creates a gRPC server for the given keychain, signing without
+// any rate limit
+func NewServer(keychain ring.Keychain, options ServerOptions) *Server {
+	return NewSignatureServer(ring.NewSignatureService(keychain, ring.SignatureServiceOptions{}), options)
+}
+
+// NewSignatureServer creates a gRPC server for the given signature
+// service, e.g. to rate limit and audit signing
+func NewSignatureServer(service ring.SignatureService, options ServerOptions) *Server {
+	return &Server{service: service, options: options}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	res, err := s.call(r)
+	if err == nil {
+		w.Write(frame(res))
+	}
+	status := &StatusError{Code: OK}
+	if err != nil && !errors.As(err, &status) {
+		status = statusFromError(err)
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(status.Code)))
+	w.Header().Set("Grpc-Message", url.PathEscape(status.Message))
+}
+
+// hashesByName are the hashes of SignDigestRequest
+var hashesByName = map[string]crypto.Hash{
+	"":        crypto.Hash(0),
+	"SHA-256": crypto.SHA256,
+	"SHA-384": crypto.SHA384,
+	"SHA-512": crypto.SHA512,
+}
+
+func signResponse(signature []byte, keyID string, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return appendString(appendBytes(nil, 1, signature), 2, keyID), nil
+}
+
+func statusFromError(err error) *StatusError {
+	if errors.Is(err, ring.ErrKeyNotFound) {
+		return &StatusError{Code: NotFound, Message: err.Error()}
+	}
+	if errors.Is(err, ring.ErrRateLimited) {
+		return &StatusError{Code: ResourceExhausted, Message: err.Error()}
+	}
+	return &StatusError{Code: Internal, Message: err.Error()}
+}
+
+func (s *Server) call(r *http.Request) ([]byte, error) {
+	if s.options.Authorize != nil && !s.options.Authorize(r) {
+		return nil, &StatusError{Code: PermissionDenied, Message: "call not allowed"}
+	}
+	req, err := readFrame(r.Body)
+	if err != nil {
+		if errors.As(err, new(*StatusError)) {
+			return nil, err
+		}
+		return nil, &StatusError{Code: InvalidArgument, Message: err.Error()}
+	}
+	// The request must hold a single message
+	if n, _ := io.Copy(ioutil.Discard, r.Body); n > 0 {
+		return nil, &StatusError{Code: InvalidArgument, Message: "expected a single message"}
+	}
+	ctx := r.Context()
+	if s.options.Caller != nil {
+		ctx = ring.WithCaller(ctx, s.options.Caller(r))
+	}
+
+	switch r.URL.Path {
+	case "/" + serviceName + "/GetVerifier":
+		id, err := parseBytesField(req, 1)
+		if err != nil {
+			return nil, &StatusError{Code: InvalidArgument, Message: err.Error()}
+		}
+		key, err := s.service.GetVerifierContext(ctx, string(id))
+		if err != nil {
+			return nil, err
+		}
+		return marshalVerifier(key)
+	case "/" + serviceName + "/ListVerifiers":
+		keys, err := s.service.ListVerifiersContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return marshalVerifiers(keys)
+	case "/" + serviceName + "/Sign":
+		data, err := parseBytesField(req, 1)
+		if err != nil {
+			return nil, &StatusError{Code: InvalidArgument, Message: err.Error()}
+		}
+		return signResponse(s.service.Sign(ctx, data))
+	case "/" + serviceName + "/SignDigest":
+		var hash crypto.Hash
+		var digest []byte
+		err := parseMessage(req, func(f field) error {
+			switch f.num {
+			case 1:
+				h, ok := hashesByName[string(f.bytes)]
+				if !ok {
+					return fmt.Errorf("unsupported hash %q", f.bytes)
+				}
+				hash = h
+			case 2:
+				digest = f.bytes
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, &StatusError{Code: InvalidArgument, Message: err.Error()}
+		}
+		return signResponse(s.service.SignDigest(ctx, hash, digest))
+	default:
+		return nil, &StatusError{Code: Unimplemented, Message: fmt.Sprintf("unknown method %s", r.URL.Path)}
+	}
+}
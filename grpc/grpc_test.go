@@ -0,0 +1,131 @@
+package grpc_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/grpc"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func newServer(t *testing.T, options grpc.ServerOptions) (ring.Keychain, *grpc.Client, func()) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.ECDSAP256,
+		RotationFrequency: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(grpc.NewServer(keychain, options))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	return keychain, grpc.NewClient(server.URL, server.Client()), server.Close
+}
+
+func TestClient(t *testing.T) {
+	var proto int
+	keychain, client, stop := newServer(t, grpc.ServerOptions{
+		Authorize: func(r *http.Request) bool {
+			proto = r.ProtoMajor
+			return true
+		},
+	})
+	defer stop()
+	ctx := context.Background()
+
+	signature, keyID, err := client.Sign(ctx, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proto != 2 {
+		t.Errorf("expected HTTP/2, got HTTP/%d", proto)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+
+	want, err := keychain.GetVerifier(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.GetVerifier(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID || !got.ExpiresAt.Equal(want.ExpiresAt) || !got.CreatedAt.Equal(want.CreatedAt) ||
+		got.Algorithm != want.Algorithm || got.SignatureAlgorithm != ring.ES256 {
+		t.Errorf("got verifier %+v want %+v", got, want)
+	}
+
+	keys, err := client.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != keyID {
+		t.Errorf("expected verifier %v, got %+v", keyID, keys)
+	}
+
+	if _, err := client.GetVerifier("unknown"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	_, client, stop := newServer(t, grpc.ServerOptions{
+		Authorize: func(r *http.Request) bool { return false },
+	})
+	defer stop()
+	_, err := client.ListVerifiers()
+	var status *grpc.StatusError
+	if !errors.As(err, &status) || status.Code != grpc.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestSignDigest(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.ECDSAP256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := ring.NewSignatureService(keychain, ring.SignatureServiceOptions{Limit: 1})
+	server := httptest.NewUnstartedServer(grpc.NewSignatureServer(service, grpc.ServerOptions{
+		Caller: func(r *http.Request) string { return r.Header.Get("X-Caller") },
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	client := grpc.NewClient(server.URL, server.Client())
+
+	digest := sha256.Sum256([]byte("data"))
+	signature, keyID, err := client.SignDigest(context.Background(), crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := client.GetVerifier(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.Verify(verifier.Key.(*ecdsa.PublicKey), digest[:], sig.R, sig.S) {
+		t.Error("expected valid signature")
+	}
+
+	_, _, err = client.SignDigest(context.Background(), crypto.SHA256, digest[:])
+	var status *grpc.StatusError
+	if !errors.As(err, &status) || status.Code != grpc.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package grpc
+
+import (
+	"crypto/x509"
+
+	"github.com/hsson/ring"
+)
+
+func marshalVerifier(key *ring.VerifierKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	b = appendString(b, 1, key.ID)
+	b = appendBytes(b, 2, der)
+	b = appendTimestamp(b, 3, key.ExpiresAt)
+	b = appendString(b, 4, string(key.Algorithm))
+	b = appendString(b, 5, string(key.SignatureAlgorithm))
+	b = appendTimestamp(b, 6, key.CreatedAt)
+	return b, nil
+}
+
+func unmarshalVerifier(b []byte) (*ring.VerifierKey, error) {
+	key := &ring.VerifierKey{}
+	var der []byte
+	err := parseMessage(b, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			key.ID = string(f.bytes)
+		case 2:
+			der = f.bytes
+		case 3:
+			key.ExpiresAt, err = parseTimestamp(f.bytes)
+		case 4:
+			key.Algorithm = ring.Algorithm(f.bytes)
+		case 5:
+			key.SignatureAlgorithm = ring.SignatureAlgorithm(f.bytes)
+		case 6:
+			key.CreatedAt, err = parseTimestamp(f.bytes)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if key.Key, err = x509.ParsePKIXPublicKey(der); err != nil {
+		return nil, err
+	}
+	if key.SignatureAlgorithm == "" {
+		key.SignatureAlgorithm = ring.DefaultSignatureAlgorithm(key.Key)
+	}
+	return key, nil
+}
+
+func marshalVerifiers(keys []*ring.VerifierKey) ([]byte, error) {
+	var b []byte
+	for _, key := range keys {
+		v, err := marshalVerifier(key)
+		if err != nil {
+			return nil, err
+		}
+		b = appendBytes(b, 1, v)
+	}
+	return b, nil
+}
+
+func unmarshalVerifiers(b []byte) ([]*ring.VerifierKey, error) {
+	var keys []*ring.VerifierKey
+	err := parseMessage(b, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		key, err := unmarshalVerifier(f.bytes)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+// parseBytesField returns the bytes of field num of message b, used by the
+// requests and responses holding a single value per field
+func parseBytesField(b []byte, num int) ([]byte, error) {
+	var v []byte
+	err := parseMessage(b, func(f field) error {
+		if f.num == num {
+			v = f.bytes
+		}
+		return nil
+	})
+	return v, err
+}
@@ -0,0 +1,143 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// The messages of ring.proto are few and small, so they are encoded by
+// hand using the protobuf wire format instead of generated code.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errInvalidMessage = errors.New("hsson/ring/grpc: invalid message")
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = appendVarint(b, uint64(field)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	return appendBytes(b, field, []byte(v))
+}
+
+func appendInt(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendVarint(b, uint64(field)<<3|wireVarint)
+	return appendVarint(b, uint64(v))
+}
+
+// appendTimestamp appends t as a google.protobuf.Timestamp, omitting zero
+// times
+func appendTimestamp(b []byte, field int, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var ts []byte
+	ts = appendInt(ts, 1, t.Unix())
+	ts = appendInt(ts, 2, int64(t.Nanosecond()))
+	if len(ts) == 0 {
+		// The Unix epoch itself is an empty, but present, message
+		b = appendVarint(b, uint64(field)<<3|wireBytes)
+		return appendVarint(b, 0)
+	}
+	return appendBytes(b, field, ts)
+}
+
+// field is a decoded field of a message. Only varint and length delimited
+// fields are used by ring.proto, others are skipped.
+type field struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+func readVarint(b []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, nil, errInvalidMessage
+	}
+	return v, b[n:], nil
+}
+
+// parseMessage calls fn for every varint and length delimited field of b
+func parseMessage(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		tag, rest, err := readVarint(b)
+		if err != nil {
+			return err
+		}
+		b = rest
+		f := field{num: int(tag >> 3)}
+		switch tag & 7 {
+		case wireVarint:
+			if f.varint, b, err = readVarint(b); err != nil {
+				return err
+			}
+		case wireBytes:
+			n, rest, err := readVarint(b)
+			if err != nil {
+				return err
+			}
+			if n > uint64(len(rest)) {
+				return errInvalidMessage
+			}
+			f.bytes, b = rest[:n], rest[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errInvalidMessage
+			}
+			b = b[8:]
+			continue
+		case wireFixed32:
+			if len(b) < 4 {
+				return errInvalidMessage
+			}
+			b = b[4:]
+			continue
+		default:
+			return errInvalidMessage
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := parseMessage(b, func(f field) error {
+		switch f.num {
+		case 1:
+			seconds = int64(f.varint)
+		case 2:
+			nanos = int64(f.varint)
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
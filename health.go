@@ -0,0 +1,104 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrUnhealthy is wrapped by the errors returned by Healthy
+var ErrUnhealthy = errors.New("hsson/ring: keychain is unhealthy")
+
+// rotationResult is the outcome of a rotation, kept for Healthy and Status
+type rotationResult struct {
+	at  time.Time
+	err error
+}
+
+// Status describes the rotation schedule of a keychain instance
+type Status struct {
+	// KeyID is the ID of the current signing key
+	KeyID string
+	// Fingerprint is the Fingerprint of the current signing key
+	Fingerprint Fingerprint
+	// NextRotation is when the current signing key is rotated
+	NextRotation time.Time
+	// ActiveVerifiers is the number of verifier keys which have not expired
+	ActiveVerifiers int
+	// LastRotation is when this instance last rotated its signing key, or
+	// tried to. It is zero if it has not rotated since it was created.
+	LastRotation time.Time
+	// LastRotationError is the error of the last rotation, if it failed
+	LastRotationError error
+	// StagedKeyID is the ID of the key staged by Rotate, waiting to be
+	// promoted, see Options.StagedRotation
+	StagedKeyID string
+	// Store summarizes all keys in the store of the keychain, including
+	// expired keys not yet deleted
+	Store store.Stats
+}
+
+func (r *ring) Healthy(ctx context.Context) error {
+	key, ok := r.currentSigningKey.Load().(*SigningKey)
+	if !ok {
+		return fmt.Errorf("%w: not initialized", ErrUnhealthy)
+	}
+	// Looking up the current key checks that the store is reachable
+	if _, err := r.store.Find(ctx, fmt.Sprintf("%s%s", publicKeyIDPrefix, key.ID)); err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return &causeError{kind: ErrUnhealthy, cause: fmt.Errorf("store unreachable: %w", err)}
+	}
+	if overdue := r.options.Clock.Now().Sub(key.RotatedAt); overdue > r.options.HealthRotationThreshold {
+		return fmt.Errorf("%w: signing key %s is %v past its rotation", ErrUnhealthy, key.ID, overdue)
+	}
+	if result, ok := r.lastRotation.Load().(rotationResult); ok && result.err != nil {
+		return &causeError{kind: ErrUnhealthy, cause: fmt.Errorf("last rotation failed: %w", result.err)}
+	}
+	return nil
+}
+
+// alertOverdue calls OnRotationOverdue after a failed rotation of key, if
+// the rotation is past RotationOverdueThreshold and key was not reported yet
+func (r *ring) alertOverdue(key *SigningKey) {
+	if r.options.OnRotationOverdue == nil || key == nil || key.ID == r.overdueAlerted {
+		return
+	}
+	overdue := r.options.Clock.Now().Sub(key.RotatedAt)
+	if overdue <= r.options.RotationOverdueThreshold {
+		return
+	}
+	r.overdueAlerted = key.ID
+	r.options.Logger.Warn("signing key rotation overdue", "key_id", key.ID, "overdue", overdue)
+	r.options.OnRotationOverdue(key, overdue)
+}
+
+func (r *ring) Status() (*Status, error) {
+	key, ok := r.currentSigningKey.Load().(*SigningKey)
+	if !ok {
+		return nil, errors.New("hsson/ring: not initialized")
+	}
+	verifiers, err := r.getNonExpiredPublicKeys(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	stats, err := store.CollectStats(context.Background(), r.store)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{
+		KeyID:           key.ID,
+		Fingerprint:     key.Fingerprint(),
+		NextRotation:    key.RotatedAt,
+		ActiveVerifiers: len(verifiers),
+		Store:           stats,
+	}
+	if result, ok := r.lastRotation.Load().(rotationResult); ok {
+		status.LastRotation, status.LastRotationError = result.at, result.err
+	}
+	if staged := r.stagedKey(); staged != nil {
+		status.StagedKeyID = staged.ID
+	}
+	return status, nil
+}
@@ -0,0 +1,35 @@
+// Package healthhttp serves the health of a keychain, e.g. as the
+// readiness probe of a service.
+package healthhttp
+
+import (
+	"net/http"
+
+	"github.com/hsson/ring"
+)
+
+// Handler returns an http.Handler responding 200 if the keychain is
+// healthy, and 503 with the reason otherwise.
+func Handler(keychain ring.Keychain) http.Handler {
+	return &handler{keychain: keychain}
+}
+
+type handler struct {
+	keychain ring.Keychain
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := h.keychain.Healthy(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,43 @@
+package healthhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/healthhttp"
+	"github.com/hsson/ring/sim"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestHandler(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Clock:             clock,
+	})
+	handler := healthhttp.Handler(keychain)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %v want %v", rec.Code, http.StatusOK)
+	}
+
+	// Without traffic or a background worker, the key is never rotated
+	clock.Advance(3 * time.Hour)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %v want %v", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %v want %v", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
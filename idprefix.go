@@ -0,0 +1,370 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrInvalidKeyID is returned for key IDs which are empty or start with the
+// prefix of another kind of record, as their private key could collide with
+// it in the store
+var ErrInvalidKeyID = errors.New("hsson/ring: invalid key ID")
+
+// reservedIDPrefixes prefix the store IDs of all records but private keys
+var reservedIDPrefixes = []string{
+	publicKeyIDPrefix,
+	revocationIDPrefix,
+	heartbeatIDPrefix,
+	certificateIDPrefix,
+	tombstoneIDPrefix,
+	postQuantumIDPrefix,
+	postQuantumKeyIDPrefix,
+	secretIDPrefix,
+	encryptionIDPrefix,
+}
+
+// companionIDPrefixes prefix the records stored next to a private key under
+// its ID
+var companionIDPrefixes = []string{publicKeyIDPrefix, certificateIDPrefix, postQuantumKeyIDPrefix, postQuantumIDPrefix}
+
+// IDPrefixes are the prefixes of the store IDs of the records kept next to
+// each private key, whose store ID is the key ID itself. Empty prefixes are
+// replaced by those of DefaultIDPrefixes.
+type IDPrefixes struct {
+	// PublicKey prefixes verifier keys
+	PublicKey string
+	// Revocation prefixes revocations
+	Revocation string
+	// Heartbeat prefixes the heartbeats of instances
+	Heartbeat string
+	// Certificate prefixes the certificates of verifier keys
+	Certificate string
+	// Tombstone prefixes the tombstones of verifier keys
+	Tombstone string
+	// PostQuantum prefixes the post-quantum keys published alongside
+	// verifier keys
+	PostQuantum string
+}
+
+// DefaultIDPrefixes are the prefixes used unless overridden by
+// Options.IDPrefixes
+var DefaultIDPrefixes = IDPrefixes{
+	PublicKey:   publicKeyIDPrefix,
+	Revocation:  revocationIDPrefix,
+	Heartbeat:   heartbeatIDPrefix,
+	Certificate: certificateIDPrefix,
+	Tombstone:   tombstoneIDPrefix,
+	PostQuantum: postQuantumIDPrefix,
+}
+
+func (p IDPrefixes) withDefaults() IDPrefixes {
+	if p.PublicKey == "" {
+		p.PublicKey = DefaultIDPrefixes.PublicKey
+	}
+	if p.Revocation == "" {
+		p.Revocation = DefaultIDPrefixes.Revocation
+	}
+	if p.Heartbeat == "" {
+		p.Heartbeat = DefaultIDPrefixes.Heartbeat
+	}
+	if p.Certificate == "" {
+		p.Certificate = DefaultIDPrefixes.Certificate
+	}
+	if p.Tombstone == "" {
+		p.Tombstone = DefaultIDPrefixes.Tombstone
+	}
+	if p.PostQuantum == "" {
+		p.PostQuantum = DefaultIDPrefixes.PostQuantum
+	}
+	return p
+}
+
+// base64URLAlphabet holds the characters of IDs derived from thumbprints
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// mapping returns the internal prefixes used by the keychain, paired with
+// the prefixes used in the store
+func (p IDPrefixes) mapping() [][2]string {
+	return [][2]string{
+		{publicKeyIDPrefix, p.PublicKey},
+		{revocationIDPrefix, p.Revocation},
+		{heartbeatIDPrefix, p.Heartbeat},
+		{certificateIDPrefix, p.Certificate},
+		{tombstoneIDPrefix, p.Tombstone},
+		{postQuantumIDPrefix, p.PostQuantum},
+	}
+}
+
+// validate checks that records can be told apart from each other, and from
+// private keys with IDs of alphabet
+func (p IDPrefixes) validate(alphabet string) error {
+	mapping := p.mapping()
+	for i, a := range mapping {
+		if strings.Trim(a[1], alphabet) == "" {
+			return fmt.Errorf("hsson/ring: ID prefix %q must contain a character outside IDAlphabet", a[1])
+		}
+		for _, b := range mapping[i+1:] {
+			if strings.HasPrefix(a[1], b[1]) || strings.HasPrefix(b[1], a[1]) {
+				return fmt.Errorf("hsson/ring: ID prefixes %q and %q overlap", a[1], b[1])
+			}
+		}
+	}
+	return nil
+}
+
+// validateKeyID checks that id can't collide with the store ID of another
+// record, using either the default or the configured prefixes
+func (p IDPrefixes) validateKeyID(id string) error {
+	if id == "" {
+		return ErrInvalidKeyID
+	}
+	for _, prefix := range reservedIDPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return fmt.Errorf("%w: %q starts with %q", ErrInvalidKeyID, id, prefix)
+		}
+	}
+	for _, m := range p.withDefaults().mapping() {
+		if strings.HasPrefix(id, m[1]) {
+			return fmt.Errorf("%w: %q starts with %q", ErrInvalidKeyID, id, m[1])
+		}
+	}
+	return nil
+}
+
+// toStore returns the store ID of the internal ID id
+func (p IDPrefixes) toStore(id string) string {
+	for _, m := range p.mapping() {
+		if strings.HasPrefix(id, m[0]) {
+			return m[1] + strings.TrimPrefix(id, m[0])
+		}
+	}
+	return id
+}
+
+// fromStore returns the internal ID of the store ID id. Records using the
+// default prefixes instead of configured ones, e.g. written before the
+// prefixes were changed, are reported as not belonging to the keychain.
+func (p IDPrefixes) fromStore(id string) (string, bool) {
+	for _, m := range p.mapping() {
+		if strings.HasPrefix(id, m[1]) {
+			return m[0] + strings.TrimPrefix(id, m[1]), true
+		}
+	}
+	for _, m := range p.mapping() {
+		if strings.HasPrefix(id, m[0]) {
+			return "", false
+		}
+	}
+	return id, true
+}
+
+// prefixedStore stores the records of a keychain under custom ID prefixes
+type prefixedStore struct {
+	store.ContextStore
+	prefixes IDPrefixes
+}
+
+func withIDPrefixes(s store.ContextStore, prefixes IDPrefixes) store.ContextStore {
+	if prefixes.withDefaults() == DefaultIDPrefixes {
+		return s
+	}
+	return &prefixedStore{ContextStore: s, prefixes: prefixes.withDefaults()}
+}
+
+func (s *prefixedStore) Add(ctx context.Context, key store.Key) error {
+	key.ID = s.prefixes.toStore(key.ID)
+	return s.ContextStore.Add(ctx, key)
+}
+
+func (s *prefixedStore) Find(ctx context.Context, id string) (store.Key, error) {
+	key, err := s.ContextStore.Find(ctx, s.prefixes.toStore(id))
+	key.ID = id
+	return key, err
+}
+
+func (s *prefixedStore) Delete(ctx context.Context, id string) error {
+	return s.ContextStore.Delete(ctx, s.prefixes.toStore(id))
+}
+
+func (s *prefixedStore) SecureErase(ctx context.Context, id string) error {
+	return store.SecureErase(ctx, s.ContextStore, s.prefixes.toStore(id))
+}
+
+func (s *prefixedStore) List(ctx context.Context) (store.KeyList, error) {
+	keys, err := s.ContextStore.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res store.KeyList
+	for _, key := range keys {
+		if id, ok := s.prefixes.fromStore(key.ID); ok {
+			key.ID = id
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+// ListFiltered pushes the ID prefix down to the store if it starts with one
+// of the mapped prefixes, otherwise it is only applied to the mapped IDs
+func (s *prefixedStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (store.KeyList, error) {
+	pushed := filter
+	if mapped := s.prefixes.toStore(filter.IDPrefix); mapped != filter.IDPrefix {
+		pushed.IDPrefix = mapped
+	} else {
+		pushed.IDPrefix = ""
+	}
+	keys, err := store.ListFiltered(ctx, s.ContextStore, pushed)
+	if err != nil {
+		return nil, err
+	}
+	var res store.KeyList
+	for _, key := range keys {
+		if id, ok := s.prefixes.fromStore(key.ID); ok {
+			key.ID = id
+			if filter.Match(key) {
+				res = append(res, key)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (s *prefixedStore) Iterate(ctx context.Context, yield func(store.Key) bool) error {
+	return store.Iterate(ctx, s.ContextStore, func(key store.Key) bool {
+		id, ok := s.prefixes.fromStore(key.ID)
+		if !ok {
+			return true
+		}
+		key.ID = id
+		return yield(key)
+	})
+}
+
+func (s *prefixedStore) FindMany(ctx context.Context, ids []string) (store.KeyList, error) {
+	mapped := make([]string, len(ids))
+	for i, id := range ids {
+		mapped[i] = s.prefixes.toStore(id)
+	}
+	keys, err := findMany(ctx, s.ContextStore, mapped)
+	if err != nil {
+		return nil, err
+	}
+	var res store.KeyList
+	for _, key := range keys {
+		if id, ok := s.prefixes.fromStore(key.ID); ok {
+			key.ID = id
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+// withKeyLayout scopes s to the namespace and ID prefixes of options
+func withKeyLayout(s store.ContextStore, options Options) store.ContextStore {
+	return withIDPrefixes(withNamespace(s, namespacePrefix(options)), options.IDPrefixes)
+}
+
+// MigrateIDs copies all non-expired keys stored using the Namespace,
+// NamespaceSeparator and IDPrefixes of from to the layout of to, e.g. before
+// changing the ID prefixes of a deployment. Keys already present are left
+// untouched, so MigrateIDs can be run again while instances still use the
+// old layout. The store is locked during the copy.
+func MigrateIDs(s store.Store, from, to Options) error {
+	ctx := context.Background()
+	locker := store.AsLocker(s)
+	if err := locker.Lock(); err != nil {
+		return fmt.Errorf("failed to lock store: %w", err)
+	}
+	defer locker.Unlock()
+
+	src := withKeyLayout(store.WithContext(s), from)
+	dst := withKeyLayout(store.WithContext(s), to)
+	keys, err := src.List(ctx)
+	if err != nil {
+		return err
+	}
+	// Public keys are copied first, so instances using the new layout never
+	// find a private key without its verifier
+	keys.SortByExpiresAt()
+	now := time.Now()
+	for _, private := range []bool{false, true} {
+		for _, key := range keys {
+			if key.IsPrivate != private || !key.ExpiresAt.After(now) {
+				continue
+			}
+			if err := dst.Add(ctx, key); err != nil && !errors.Is(err, store.ErrKeyIDConflict) {
+				return fmt.Errorf("failed to copy key %s: %w", key.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RenameReservedKeyIDs moves the private keys whose IDs start with a
+// reserved prefix, see ErrInvalidKeyID, e.g. imported before the IDs were
+// validated, to new random IDs. Their verifier keys are copied to the new
+// IDs and kept under the old ones until they expire, so data signed before
+// still verifies. The store is locked during the migration. It returns the
+// new ID of each moved key.
+func RenameReservedKeyIDs(s store.Store, options Options) (map[string]string, error) {
+	ctx := context.Background()
+	options = options.withDefaults()
+	locker := store.AsLocker(s)
+	if err := locker.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock store: %w", err)
+	}
+	defer locker.Unlock()
+
+	cs := withKeyLayout(store.WithContext(s), options)
+	keys, err := cs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	renamed := make(map[string]string)
+	now := time.Now()
+	for _, key := range keys {
+		// Only signing keys store when they stop being verifiable, which
+		// tells them apart from secrets and post-quantum keys
+		if !key.IsPrivate || key.Metadata[MetadataVerifiableUntil] == "" || !key.ExpiresAt.After(now) {
+			continue
+		}
+		if options.IDPrefixes.validateKeyID(key.ID) == nil {
+			continue
+		}
+		id, err := randomID(options)
+		if err != nil {
+			return renamed, err
+		}
+		// The records next to the key are copied first, so the key is never
+		// found without its verifier
+		for _, prefix := range companionIDPrefixes {
+			record, err := cs.Find(ctx, prefix+key.ID)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return renamed, err
+			}
+			record.ID = prefix + id
+			if err := cs.Add(ctx, record); err != nil {
+				return renamed, fmt.Errorf("failed to copy key %s: %w", key.ID, err)
+			}
+		}
+		old := key.ID
+		key.ID = id
+		if err := cs.Add(ctx, key); err != nil {
+			return renamed, fmt.Errorf("failed to copy key %s: %w", old, err)
+		}
+		if err := cs.Delete(ctx, old); err != nil {
+			return renamed, fmt.Errorf("failed to delete key %s: %w", old, err)
+		}
+		renamed[old] = id
+	}
+	return renamed, nil
+}
@@ -0,0 +1,128 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// ImportOptions controls how a key is imported with ImportSigningKey
+type ImportOptions struct {
+	// ID of the imported key, which must not start with the prefix of
+	// another kind of record, see ErrInvalidKeyID. Default: chosen by
+	// Options.IDStrategy
+	ID string
+
+	// VerifiableUntil is when the verifier key of the imported key
+	// expires. Default: Options.VerificationPeriod from now
+	VerifiableUntil time.Time
+
+	// MakeCurrent makes the imported key the current signing key of this
+	// instance, until it is rotated after Options.RotationFrequency. Other
+	// instances pick it up when they rotate or initialize. If false, the
+	// key is only imported as a verifier key.
+	MakeCurrent bool
+}
+
+func (r *ring) ImportSigningKey(key crypto.Signer, opts ImportOptions) (*SigningKey, error) {
+	ctx := context.Background()
+	if err := checkKeyType(key); err != nil {
+		return nil, err
+	}
+	if err := r.options.checkKeyPolicy(key.Public()); err != nil {
+		return nil, err
+	}
+
+	now := r.options.Clock.Now()
+	rotatedAt, _ := r.nextRotation(now)
+	algorithm, _ := keyAlgorithm(key.Public())
+	signingKey := &SigningKey{
+		ID:                 opts.ID,
+		RotatedAt:          rotatedAt,
+		VerifiableUntil:    opts.VerifiableUntil,
+		Key:                key,
+		CreatedAt:          now,
+		Algorithm:          algorithm,
+		SignatureAlgorithm: r.signatureAlgorithm(key.Public()),
+	}
+	if signingKey.ID == "" {
+		id, err := r.generateID(key)
+		if err != nil {
+			return nil, err
+		}
+		signingKey.ID = id
+	}
+	if err := r.options.IDPrefixes.validateKeyID(signingKey.ID); err != nil {
+		return nil, err
+	}
+	if signingKey.VerifiableUntil.IsZero() {
+		signingKey.VerifiableUntil = now.Add(r.options.VerificationPeriod)
+	}
+	if !signingKey.VerifiableUntil.After(now) {
+		return nil, errors.New("hsson/ring: VerifiableUntil of imported key must be in the future")
+	}
+
+	privateStoreKey, publicStoreKey, err := r.createStoreKeyPairFromSigningKey(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	var certificateStoreKey store.Key
+	var records []store.Key
+	if r.options.certificates() {
+		if certificateStoreKey, err = r.createCertificateStoreKey(signingKey); err != nil {
+			return nil, err
+		}
+		records = append(records, certificateStoreKey)
+	}
+	if !opts.MakeCurrent {
+		if certificateStoreKey.ID != "" {
+			if err := r.store.Add(ctx, certificateStoreKey); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.store.Add(ctx, publicStoreKey); err != nil {
+			return nil, err
+		}
+		r.cache.forget(signingKey.ID)
+		r.auditKey(AuditKeyCreated, signingKey, "")
+		return signingKey, nil
+	}
+
+	if signingKey.VerifiableUntil.Before(signingKey.RotatedAt) {
+		return nil, errors.New("hsson/ring: VerifiableUntil of current key must be after its rotation")
+	}
+	if err := r.store.Lock(ctx); err != nil {
+		return nil, err
+	}
+	// The lock is released even if ctx is done
+	defer r.store.Unlock(context.Background())
+	if err := r.storeKeyPair(ctx, signingKey, privateStoreKey, publicStoreKey, records...); err != nil {
+		return nil, err
+	}
+
+	old, _ := r.currentSigningKey.Load().(*SigningKey)
+	r.currentSigningKey.Store(signingKey)
+	_ = r.heartbeat(ctx)
+	r.options.Logger.Info("imported signing key", withFingerprint(signingKey, "key_id", signingKey.ID, "rotated_at", signingKey.RotatedAt)...)
+	if old != nil {
+		r.auditKey(AuditKeyRotated, signingKey, old.ID)
+	}
+	return signingKey, nil
+}
+
+// checkKeyType checks that key is of a type supported by the keychain
+func checkKeyType(key crypto.Signer) error {
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return nil
+	default:
+		return fmt.Errorf("hsson/ring: unsupported key type %T", key)
+	}
+}
@@ -0,0 +1,312 @@
+// Package bson implements the subset of BSON (https://bsonspec.org) needed
+// to talk to MongoDB without depending on its driver.
+//
+// Documents are represented as D, keeping the order of their elements,
+// which matters for commands. Values are decoded to float64, string, D,
+// []interface{} (arrays), []byte (binary), ObjectID, bool, time.Time, nil,
+// int32, Timestamp and int64, and the same types, as well as int, can be
+// encoded.
+package bson
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrMalformed is returned when decoding invalid BSON
+var ErrMalformed = errors.New("bson: malformed document")
+
+const (
+	typeDouble    = 0x01
+	typeString    = 0x02
+	typeDocument  = 0x03
+	typeArray     = 0x04
+	typeBinary    = 0x05
+	typeObjectID  = 0x07
+	typeBool      = 0x08
+	typeDateTime  = 0x09
+	typeNull      = 0x0A
+	typeInt32     = 0x10
+	typeTimestamp = 0x11
+	typeInt64     = 0x12
+)
+
+// E is an element of a document
+type E struct {
+	Key   string
+	Value interface{}
+}
+
+// D is a document, whose elements are kept in order
+type D []E
+
+// ObjectID is the default type of the _id of MongoDB documents
+type ObjectID [12]byte
+
+// Timestamp is the internal timestamp type of MongoDB, e.g. included in
+// responses from replica sets
+type Timestamp uint64
+
+// Lookup returns the value of the first element with the given key, or nil
+// if there is none
+func (d D) Lookup(key string) interface{} {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// Marshal encodes d as BSON
+func Marshal(d D) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeDocument(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeDocument(buf *bytes.Buffer, d D) error {
+	start := buf.Len()
+	buf.Write([]byte{0, 0, 0, 0})
+	for _, e := range d {
+		if err := writeElement(buf, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(0)
+	binary.LittleEndian.PutUint32(buf.Bytes()[start:], uint32(buf.Len()-start))
+	return nil
+}
+
+func writeCString(buf *bytes.Buffer, s string) error {
+	if bytes.IndexByte([]byte(s), 0) >= 0 {
+		return fmt.Errorf("bson: key %q contains a null byte", s)
+	}
+	buf.WriteString(s)
+	buf.WriteByte(0)
+	return nil
+}
+
+func writeElement(buf *bytes.Buffer, key string, value interface{}) error {
+	var scratch [8]byte
+	header := func(t byte) error {
+		buf.WriteByte(t)
+		return writeCString(buf, key)
+	}
+	switch v := value.(type) {
+	case float64:
+		if err := header(typeDouble); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		buf.Write(scratch[:8])
+	case string:
+		if err := header(typeString); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(v)+1))
+		buf.Write(scratch[:4])
+		buf.WriteString(v)
+		buf.WriteByte(0)
+	case D:
+		if err := header(typeDocument); err != nil {
+			return err
+		}
+		return writeDocument(buf, v)
+	case []interface{}:
+		if err := header(typeArray); err != nil {
+			return err
+		}
+		array := make(D, len(v))
+		for i, item := range v {
+			array[i] = E{Key: fmt.Sprint(i), Value: item}
+		}
+		return writeDocument(buf, array)
+	case []byte:
+		if err := header(typeBinary); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(v)))
+		buf.Write(scratch[:4])
+		// Generic binary subtype
+		buf.WriteByte(0)
+		buf.Write(v)
+	case ObjectID:
+		if err := header(typeObjectID); err != nil {
+			return err
+		}
+		buf.Write(v[:])
+	case bool:
+		if err := header(typeBool); err != nil {
+			return err
+		}
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case time.Time:
+		if err := header(typeDateTime); err != nil {
+			return err
+		}
+		millis := v.Unix()*1000 + int64(v.Nanosecond())/int64(time.Millisecond)
+		binary.LittleEndian.PutUint64(scratch[:], uint64(millis))
+		buf.Write(scratch[:8])
+	case nil:
+		return header(typeNull)
+	case int32:
+		if err := header(typeInt32); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(scratch[:], uint32(v))
+		buf.Write(scratch[:4])
+	case Timestamp:
+		if err := header(typeTimestamp); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		buf.Write(scratch[:8])
+	case int:
+		return writeElement(buf, key, int64(v))
+	case int64:
+		if err := header(typeInt64); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		buf.Write(scratch[:8])
+	default:
+		return fmt.Errorf("bson: unsupported type %T", value)
+	}
+	return nil
+}
+
+// Unmarshal decodes a single BSON document, which must make up all of data
+func Unmarshal(data []byte) (D, error) {
+	d, n, err := readDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, ErrMalformed
+	}
+	return d, nil
+}
+
+// readDocument decodes the document at the start of data, and returns the
+// number of bytes it takes up
+func readDocument(data []byte) (D, int, error) {
+	if len(data) < 5 {
+		return nil, 0, ErrMalformed
+	}
+	length := int(binary.LittleEndian.Uint32(data))
+	if length < 5 || length > len(data) || data[length-1] != 0 {
+		return nil, 0, ErrMalformed
+	}
+	body := data[4 : length-1]
+	d := D{}
+	for len(body) > 0 {
+		t := body[0]
+		end := bytes.IndexByte(body[1:], 0)
+		if end < 0 {
+			return nil, 0, ErrMalformed
+		}
+		key := string(body[1 : 1+end])
+		body = body[2+end:]
+		value, n, err := readValue(t, body)
+		if err != nil {
+			return nil, 0, err
+		}
+		d = append(d, E{Key: key, Value: value})
+		body = body[n:]
+	}
+	return d, length, nil
+}
+
+func readValue(t byte, data []byte) (interface{}, int, error) {
+	need := func(n int) error {
+		if len(data) < n {
+			return ErrMalformed
+		}
+		return nil
+	}
+	switch t {
+	case typeDouble:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case typeString:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		length := int(binary.LittleEndian.Uint32(data))
+		if length < 1 || 4+length > len(data) || data[3+length] != 0 {
+			return nil, 0, ErrMalformed
+		}
+		return string(data[4 : 3+length]), 4 + length, nil
+	case typeDocument:
+		return readDocument(data)
+	case typeArray:
+		d, n, err := readDocument(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		array := make([]interface{}, len(d))
+		for i, e := range d {
+			array[i] = e.Value
+		}
+		return array, n, nil
+	case typeBinary:
+		if err := need(5); err != nil {
+			return nil, 0, err
+		}
+		length := int(binary.LittleEndian.Uint32(data))
+		if length < 0 || 5+length > len(data) {
+			return nil, 0, ErrMalformed
+		}
+		return append([]byte{}, data[5:5+length]...), 5 + length, nil
+	case typeObjectID:
+		if err := need(12); err != nil {
+			return nil, 0, err
+		}
+		var id ObjectID
+		copy(id[:], data)
+		return id, 12, nil
+	case typeBool:
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		return data[0] == 1, 1, nil
+	case typeDateTime:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		millis := int64(binary.LittleEndian.Uint64(data))
+		return time.Unix(0, millis*int64(time.Millisecond)), 8, nil
+	case typeNull:
+		return nil, 0, nil
+	case typeInt32:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		return int32(binary.LittleEndian.Uint32(data)), 4, nil
+	case typeTimestamp:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return Timestamp(binary.LittleEndian.Uint64(data)), 8, nil
+	case typeInt64:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return int64(binary.LittleEndian.Uint64(data)), 8, nil
+	default:
+		return nil, 0, fmt.Errorf("bson: unsupported type 0x%02x", t)
+	}
+}
@@ -0,0 +1,65 @@
+package bson_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring/internal/bson"
+)
+
+func TestRoundTrip(t *testing.T) {
+	doc := bson.D{
+		{Key: "insert", Value: "keys"},
+		{Key: "double", Value: 1.5},
+		{Key: "nested", Value: bson.D{{Key: "private", Value: true}}},
+		{Key: "array", Value: []interface{}{"a", int32(2)}},
+		{Key: "data", Value: []byte{1, 2, 3}},
+		{Key: "id", Value: bson.ObjectID{1, 2, 3}},
+		{Key: "false", Value: false},
+		{Key: "date", Value: time.Unix(1577836800, 123000000)},
+		{Key: "null", Value: nil},
+		{Key: "timestamp", Value: bson.Timestamp(42)},
+		{Key: "int64", Value: int64(1) << 40},
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := bson.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, doc) {
+		t.Errorf("got %#v want %#v", got, doc)
+	}
+	if got.Lookup("double") != 1.5 || got.Lookup("missing") != nil {
+		t.Error("unexpected lookup result")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	// {"hello": "world"} from the examples of the specification
+	want := []byte("\x16\x00\x00\x00\x02hello\x00\x06\x00\x00\x00world\x00\x00")
+	got, err := bson.Marshal(bson.D{{Key: "hello", Value: "world"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		[]byte("\x05\x00\x00\x00"),
+		[]byte("\x16\x00\x00\x00\x02hello\x00\x06\x00\x00\x00world\x00"),
+		[]byte("\x0c\x00\x00\x00\x02a\x00\xff\x00\x00\x00\x00"),
+	} {
+		if _, err := bson.Unmarshal(data); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
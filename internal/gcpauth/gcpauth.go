@@ -0,0 +1,72 @@
+// Package gcpauth obtains OAuth2 access tokens for Google Cloud APIs, so
+// stores can talk to Google Cloud without depending on the SDK.
+package gcpauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// MetadataTokenURL is where the metadata server hands out tokens of
+	// the default service account
+	MetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+	// refreshBefore is how long before expiry a cached token is replaced
+	refreshBefore = time.Minute
+)
+
+// TokenSource returns an access token. It is called for every request, so
+// it should cache tokens itself.
+type TokenSource func() (string, error)
+
+// MetadataTokenSource returns tokens of the default service account from
+// the metadata server at url, as available on Cloud Run, Cloud Functions
+// and Compute Engine. Tokens are cached until shortly before they expire.
+func MetadataTokenSource(url string, client *http.Client) TokenSource {
+	var (
+		mu        sync.Mutex
+		token     string
+		expiresAt time.Time
+	)
+	return func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expiresAt.Add(-refreshBefore)) {
+			return token, nil
+		}
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		res, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("hsson/ring: metadata server: unexpected status %d", res.StatusCode)
+		}
+		var out struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int64  `json:"expires_in"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+			return "", err
+		}
+		token = out.AccessToken
+		expiresAt = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+		return token, nil
+	}
+}
+
+// StaticTokenSource always returns token, e.g. for emulators
+func StaticTokenSource(token string) TokenSource {
+	return func() (string, error) {
+		return token, nil
+	}
+}
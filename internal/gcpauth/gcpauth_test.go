@@ -0,0 +1,37 @@
+package gcpauth_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hsson/ring/internal/gcpauth"
+)
+
+func TestMetadataTokenSourceCaches(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		requests++
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600,"token_type":"Bearer"}`, requests)
+	}))
+	defer server.Close()
+
+	tokens := gcpauth.MetadataTokenSource(server.URL, server.Client())
+	for i := 0; i < 3; i++ {
+		token, err := tokens()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "token-1" {
+			t.Errorf("got token %q, want token-1", token)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected token to be cached, got %d requests", requests)
+	}
+}
@@ -0,0 +1,19 @@
+package pbkdf2_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/hsson/ring/internal/pbkdf2"
+)
+
+func TestKey(t *testing.T) {
+	// Test vector from RFC 7914, section 11
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	got := hex.EncodeToString(pbkdf2.Key([]byte("passwd"), []byte("salt"), 1, 64, sha256.New))
+	if got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
@@ -0,0 +1,230 @@
+// Package jose signs and verifies arbitrary payloads, e.g. webhook bodies or
+// receipts, as JSON Web Signatures in the compact serialization (RFC 7515)
+// with the keys of a keychain. The ID of the signing key is put in the kid
+// header, which is used to look up the verifier key on verification.
+//
+// The package has no dependencies outside the standard library.
+package jose
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	// Register the hash functions used for signing
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/hsson/ring"
+)
+
+// ErrInvalidSignature is returned when a JWS is malformed or its signature
+// does not match.
+var ErrInvalidSignature = errors.New("hsson/ring/jose: invalid signature")
+
+// Header is the protected header of a JWS
+type Header struct {
+	// Algorithm is the JWS algorithm, set by Sign
+	Algorithm string `json:"alg"`
+	// Type is the media type of the whole JWS, e.g. "JWT"
+	Type string `json:"typ,omitempty"`
+	// ContentType is the media type of the payload
+	ContentType string `json:"cty,omitempty"`
+	// KeyID is the ID of the signing key, set by Sign
+	KeyID string `json:"kid"`
+}
+
+// SigningKeySource provides the current signing key, e.g. a ring.Keychain or
+// a ring.TenantSigner
+type SigningKeySource interface {
+	SigningKey() (*ring.SigningKey, error)
+}
+
+// Sign signs payload with the current signing key of the keychain, returning
+// a JWS in the compact serialization. The Algorithm and KeyID of header are
+// set from the signing key. The signature is counted towards
+// ring.Options.MaxSignaturesPerKey, see ring.SigningKeyToSign.
+func Sign(keychain SigningKeySource, payload []byte, header Header) (string, error) {
+	signingKey, err := ring.SigningKeyToSign(context.Background(), keychain)
+	if err != nil {
+		return "", err
+	}
+	alg, err := signatureAlgorithm(signingKey.Key.Public(), signingKey.SignatureAlgorithm)
+	if err != nil {
+		return "", err
+	}
+	header.Algorithm = string(alg)
+	header.KeyID = signingKey.ID
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encode(headerJSON) + "." + encode(payload)
+
+	signature, err := sign(signingKey.Key, alg, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encode(signature), nil
+}
+
+// Verify checks the signature of jws against the verifier key named by its
+// kid header, returning the payload and header.
+func Verify(keychain ring.Verifier, jws string) ([]byte, Header, error) {
+	return verifyWith(jws, keychain.GetVerifier)
+}
+
+// verifyWith is like Verify, but looks up the verifier key with lookup
+func verifyWith(jws string, lookup func(keyID string) (*ring.VerifierKey, error)) ([]byte, Header, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return nil, Header{}, ErrInvalidSignature
+	}
+	headerJSON, err := decode(parts[0])
+	if err != nil {
+		return nil, Header{}, ErrInvalidSignature
+	}
+	var h Header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, Header{}, ErrInvalidSignature
+	}
+	verifier, err := lookup(h.KeyID)
+	if err != nil {
+		return nil, Header{}, err
+	}
+	// Only accept the algorithm matching the key, so a JWS can not pick a
+	// weaker one
+	alg, err := signatureAlgorithm(verifier.Key, verifier.SignatureAlgorithm)
+	if err != nil {
+		return nil, Header{}, err
+	}
+	if h.Algorithm != string(alg) {
+		return nil, Header{}, ErrInvalidSignature
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, Header{}, ErrInvalidSignature
+	}
+	if err := verify(verifier.Key, alg, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, Header{}, err
+	}
+	payload, err := decode(parts[1])
+	if err != nil {
+		return nil, Header{}, ErrInvalidSignature
+	}
+	return payload, h, nil
+}
+
+// Algorithm returns the JWS algorithm used for signatures made with the
+// private half of key, if the key has no ring.SignatureAlgorithm: PS256 for
+// RSA keys, ES256, ES384 or ES512 for ECDSA keys depending on the curve, and
+// EdDSA for Ed25519 keys.
+func Algorithm(key crypto.PublicKey) (string, error) {
+	if alg := ring.DefaultSignatureAlgorithm(key); alg != "" {
+		return string(alg), nil
+	}
+	return "", fmt.Errorf("hsson/ring/jose: unsupported key type %T", key)
+}
+
+// signatureAlgorithm returns alg, the algorithm recorded for key, or the
+// default algorithm for keys without one
+func signatureAlgorithm(key crypto.PublicKey, alg ring.SignatureAlgorithm) (ring.SignatureAlgorithm, error) {
+	if alg != "" {
+		return alg, nil
+	}
+	def, err := Algorithm(key)
+	return ring.SignatureAlgorithm(def), err
+}
+
+func digest(hash crypto.Hash, message []byte) []byte {
+	h := hash.New()
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+func sign(signer crypto.Signer, alg ring.SignatureAlgorithm, message []byte) ([]byte, error) {
+	hash := alg.Hash()
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	case *rsa.PublicKey:
+		var opts crypto.SignerOpts = hash
+		if alg.PSS() {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+		}
+		return signer.Sign(rand.Reader, digest(hash, message), opts)
+	case *ecdsa.PublicKey:
+		der, err := signer.Sign(rand.Reader, digest(hash, message), hash)
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed size concatenation of R and S instead of ASN.1
+		var sig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(der, &sig); err != nil {
+			return nil, err
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		out := make([]byte, 2*size)
+		r, s := sig.R.Bytes(), sig.S.Bytes()
+		copy(out[size-len(r):size], r)
+		copy(out[2*size-len(s):], s)
+		return out, nil
+	default:
+		return nil, fmt.Errorf("hsson/ring/jose: unsupported key type %T", pub)
+	}
+}
+
+func verify(key crypto.PublicKey, alg ring.SignatureAlgorithm, message, signature []byte) error {
+	hash := alg.Hash()
+	switch pub := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, message, signature) {
+			return ErrInvalidSignature
+		}
+	case *rsa.PublicKey:
+		if !alg.PSS() {
+			if rsa.VerifyPKCS1v15(pub, hash, digest(hash, message), signature) != nil {
+				return ErrInvalidSignature
+			}
+			return nil
+		}
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}
+		if rsa.VerifyPSS(pub, hash, digest(hash, message), signature, opts) != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest(hash, message), r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("hsson/ring/jose: unsupported key type %T", key)
+	}
+	return nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,163 @@
+package jose_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/jose"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	payload := []byte(`{"event":"invoice.paid"}`)
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.Ed25519, ring.ECDSAP256, ring.ECDSAP384, ring.ECDSAP521} {
+		keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: algorithm})
+		signingKey, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jws, err := jose.Sign(keychain, payload, jose.Header{ContentType: "json"})
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		got, header, err := jose.Verify(keychain, jws)
+		if err != nil {
+			t.Fatalf("%s: expected valid signature, got %v", algorithm, err)
+		}
+		if string(got) != string(payload) {
+			t.Errorf("%s: expected payload %s, got %s", algorithm, payload, got)
+		}
+		if header.KeyID != signingKey.ID || header.ContentType != "json" || header.Algorithm == "" {
+			t.Errorf("%s: unexpected header %+v", algorithm, header)
+		}
+
+		parts := strings.Split(jws, ".")
+		tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+		if _, _, err := jose.Verify(keychain, tampered); !errors.Is(err, jose.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", algorithm, err)
+		}
+	}
+}
+
+func TestVerifyUnknownKey(t *testing.T) {
+	signer := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	jws, err := jose.Sign(signer, []byte("receipt"), jose.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if _, _, err := jose.Verify(other, jws); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestSignForTenant(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	signer, err := keychain.TenantSigner("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws, err := jose.Sign(signer, []byte("receipt"), jose.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, header, err := jose.Verify(keychain, jws)
+	if err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if _, tenantID, ok := ring.ParseTenantKeyID(header.KeyID); !ok || tenantID != "acme" {
+		t.Errorf("expected key ID of tenant acme, got %s", header.KeyID)
+	}
+}
+
+func TestSignCountsSignatures(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:           ring.Ed25519,
+		MaxSignaturesPerKey: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keychain.TenantSigner("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyIDs []string
+	for _, source := range []jose.SigningKeySource{keychain, signer} {
+		jws, err := jose.Sign(source, []byte("receipt"), jose.Header{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, header, err := jose.Verify(keychain, jws)
+		if err != nil {
+			t.Fatalf("expected valid signature, got %v", err)
+		}
+		keyIDs = append(keyIDs, header.KeyID)
+	}
+	root, _, _ := ring.ParseTenantKeyID(keyIDs[1])
+	if root == keyIDs[0] {
+		t.Fatal("expected key to be rotated after MaxSignaturesPerKey")
+	}
+	if count, err := keychain.SignatureCount(root); err != nil || count != 1 {
+		t.Errorf("expected 1 signature with the new key, got %d: %v", count, err)
+	}
+}
+
+func TestSignJWKS(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &ring.SigningKey{ID: "root", Key: private}
+	rootVerifier := &ring.VerifierKey{ID: "root", Key: private.Public()}
+
+	jwks, err := keychain.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws, err := jose.SignJWKS(jwks, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := jose.VerifyJWKS(rootVerifier, jws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != signingKey.ID {
+		t.Errorf("expected the key of the keychain, got %+v", set.Keys)
+	}
+
+	// Signatures of the keychain are not accepted for the key set
+	forged, err := jose.Sign(keychain, jwks, jose.Header{Type: jose.JWKSType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jose.VerifyJWKS(rootVerifier, forged); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	other, err := jose.Sign(staticSource{root}, jwks, jose.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jose.VerifyJWKS(rootVerifier, other); !errors.Is(err, jose.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for another type, got %v", err)
+	}
+}
+
+type staticSource struct {
+	key *ring.SigningKey
+}
+
+func (s staticSource) SigningKey() (*ring.SigningKey, error) {
+	return s.key, nil
+}
@@ -0,0 +1,49 @@
+package jose
+
+import (
+	"encoding/json"
+
+	"github.com/hsson/ring"
+)
+
+// JWKSType is the typ header of a JWS made by SignJWKS
+const JWKSType = "jwk-set+json"
+
+// staticKey is a SigningKeySource of a single key
+type staticKey struct {
+	key *ring.SigningKey
+}
+
+func (s staticKey) SigningKey() (*ring.SigningKey, error) {
+	return s.key, nil
+}
+
+// SignJWKS signs jwks, as returned by Keychain.JWKS, with root, a
+// long-lived key kept outside the keychain, so relying parties fetching the
+// key set over untrusted channels can authenticate it with VerifyJWKS. The
+// ID of root is put in the kid header.
+func SignJWKS(jwks []byte, root *ring.SigningKey) (string, error) {
+	return Sign(staticKey{root}, jwks, Header{Type: JWKSType})
+}
+
+// VerifyJWKS checks that jws is a JWKS signed by SignJWKS with the private
+// half of root, and returns the key set
+func VerifyJWKS(root *ring.VerifierKey, jws string) (ring.JWKSet, error) {
+	payload, header, err := verifyWith(jws, func(keyID string) (*ring.VerifierKey, error) {
+		if keyID != root.ID {
+			return nil, ring.ErrKeyNotFound
+		}
+		return root, nil
+	})
+	if err != nil {
+		return ring.JWKSet{}, err
+	}
+	if header.Type != JWKSType {
+		return ring.JWKSet{}, ErrInvalidSignature
+	}
+	var set ring.JWKSet
+	if err := json.Unmarshal(payload, &set); err != nil {
+		return ring.JWKSet{}, err
+	}
+	return set, nil
+}
@@ -0,0 +1,178 @@
+package ring
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// JWK is a JSON Web Key as defined by RFC 7517, holding a public key
+type JWK struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use,omitempty"`
+	// Algorithm is the SignatureAlgorithm of the key
+	Algorithm string `json:"alg,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	// Public is the public key of post-quantum keys, see PostQuantumKey
+	Public string `json:"pub,omitempty"`
+	// X5C is the certificate chain of the key, as base64 encoded DER
+	X5C []string `json:"x5c,omitempty"`
+	// X5TS256 is the SHA-256 thumbprint of the certificate of the key
+	X5TS256 string `json:"x5t#S256,omitempty"`
+	// Revoked is an extension marking keys which have been revoked, but
+	// have not yet expired, see Keychain.RevocationList. Consumers must not
+	// accept signatures of revoked keys.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set as defined by RFC 7517
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func encodeBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// encodeCoordinate encodes an elliptic curve coordinate padded to the size
+// of the curve, as required by RFC 7518
+func encodeCoordinate(n *big.Int, bitSize int) string {
+	data := make([]byte, (bitSize+7)/8)
+	b := n.Bytes()
+	copy(data[len(data)-len(b):], b)
+	return encodeBase64URL(data)
+}
+
+// ToJWK converts the verifier key into a JSON Web Key, with the key ID
+// as kid. Keys with a certificate include it, followed by its chain, as x5c
+// and its thumbprint as x5t#S256.
+func (vk *VerifierKey) ToJWK() (JWK, error) {
+	jwk := JWK{KeyID: vk.ID, Use: "sig", Algorithm: string(vk.SignatureAlgorithm)}
+	switch pub := vk.Key.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeBase64URL(pub.N.Bytes())
+		jwk.E = encodeBase64URL(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		params := pub.Curve.Params()
+		jwk.KeyType = "EC"
+		jwk.Curve = params.Name
+		jwk.X = encodeCoordinate(pub.X, params.BitSize)
+		jwk.Y = encodeCoordinate(pub.Y, params.BitSize)
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encodeBase64URL(pub)
+	default:
+		return JWK{}, errors.New("hsson/ring: unsupported key type")
+	}
+	if vk.Certificate != nil {
+		thumbprint := sha256.Sum256(vk.Certificate.Raw)
+		jwk.X5TS256 = encodeBase64URL(thumbprint[:])
+		for _, cert := range append([]*x509.Certificate{vk.Certificate}, vk.CertificateChain...) {
+			jwk.X5C = append(jwk.X5C, base64.StdEncoding.EncodeToString(cert.Raw))
+		}
+	}
+	return jwk, nil
+}
+
+// Thumbprint returns the RFC 7638 JWK thumbprint of the verifier public key
+// using SHA-256, as an unpadded base64url string.
+func (vk *VerifierKey) Thumbprint() (string, error) {
+	jwk, err := vk.ToJWK()
+	if err != nil {
+		return "", err
+	}
+	// Only the required members, in lexicographic order
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E       string `json:"e"`
+			KeyType string `json:"kty"`
+			N       string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "EC":
+		members = struct {
+			Curve   string `json:"crv"`
+			KeyType string `json:"kty"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Curve   string `json:"crv"`
+			KeyType string `json:"kty"`
+			X       string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return encodeBase64URL(sum[:]), nil
+}
+
+// HasThumbprint reports whether thumbprint is the Thumbprint of vk, e.g. to
+// match the key against the "kid" of a JWK using thumbprints as key IDs
+func (vk *VerifierKey) HasThumbprint(thumbprint string) bool {
+	own, err := vk.Thumbprint()
+	return err == nil && own == thumbprint
+}
+
+func (r *ring) JWKS() ([]byte, error) {
+	verifiers, err := r.ListVerifiers()
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := r.revokedVerifiers(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return marshalJWKS(verifiers, revoked)
+}
+
+// marshalJWKS renders verifiers, and the post-quantum keys paired with
+// them, as a JSON Web Key Set, followed by the revoked keys flagged as
+// such
+func marshalJWKS(verifiers, revoked []*VerifierKey) ([]byte, error) {
+	var err error
+	set := JWKSet{Keys: make([]JWK, len(verifiers))}
+	for i, verifier := range verifiers {
+		if set.Keys[i], err = verifier.ToJWK(); err != nil {
+			return nil, err
+		}
+	}
+	for _, verifier := range verifiers {
+		if verifier.PostQuantum == nil {
+			continue
+		}
+		jwk, err := verifier.PostQuantum.ToJWK()
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	for _, verifier := range revoked {
+		jwk, err := verifier.ToJWK()
+		if err != nil {
+			return nil, err
+		}
+		jwk.Revoked = true
+		set.Keys = append(set.Keys, jwk)
+	}
+	return json.Marshal(set)
+}
@@ -0,0 +1,63 @@
+package jwkshttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hsson/ring"
+)
+
+// DiscoveryCacheDuration is how long clients may cache the discovery
+// document served by DiscoveryHandler
+const DiscoveryCacheDuration = time.Hour
+
+// DiscoveryDocument is an OpenID Connect discovery document, as defined by
+// OpenID Connect Discovery 1.0, served on
+// /.well-known/openid-configuration
+type DiscoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// NewDiscoveryDocument creates the discovery document of a token issuer
+// whose keys are served on jwksURI, e.g. by Handler, and which signs with
+// keys created with options. Endpoints can be added to the returned
+// document.
+func NewDiscoveryDocument(issuer, jwksURI string, options ring.Options) DiscoveryDocument {
+	doc := DiscoveryDocument{
+		Issuer:                 issuer,
+		JWKSURI:                jwksURI,
+		ResponseTypesSupported: []string{"id_token"},
+		SubjectTypesSupported:  []string{"public"},
+	}
+	for _, alg := range options.SignatureAlgorithms() {
+		doc.IDTokenSigningAlgValuesSupported = append(doc.IDTokenSigningAlgValuesSupported, string(alg))
+	}
+	return doc
+}
+
+// DiscoveryHandler returns an http.Handler serving doc
+func DiscoveryHandler(doc DiscoveryDocument) http.Handler {
+	body, err := json.Marshal(doc)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(DiscoveryCacheDuration.Seconds())))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
@@ -0,0 +1,79 @@
+// Package jwkshttp serves the active verifier keys of a keychain as a JSON
+// Web Key Set, e.g. on /.well-known/jwks.json, and the OpenID Connect
+// discovery document pointing to it.
+package jwkshttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/jose"
+)
+
+// Handler returns an http.Handler serving the JWKS of the keychain. The
+// response may be cached for the MaxAge of Keychain.ListVerifiersWithMeta,
+// so clients pick up new keys as soon as they are in use.
+func Handler(keychain ring.Keychain) http.Handler {
+	return &handler{keychain: keychain}
+}
+
+// SignedHandler is like Handler, but serves the JWKS signed by root as a
+// JWS of type application/jose, see jose.SignJWKS
+func SignedHandler(keychain ring.Keychain, root *ring.SigningKey) http.Handler {
+	return &handler{keychain: keychain, root: root}
+}
+
+type handler struct {
+	keychain ring.Keychain
+	// root, if set, signs the JWKS
+	root *ring.SigningKey
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The meta is looked up first, as it replaces an expired signing key:
+	// the body then lists the key now signing, and a rotation in between
+	// only shortens how long it is cached
+	_, meta, err := h.keychain.ListVerifiersWithMeta(r.Context())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	body, err := h.keychain.JWKS()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:]))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(meta.MaxAge.Seconds())))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if h.root == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+		return
+	}
+	// The ETag is of the unsigned JWKS, as signatures may be randomized
+	signed, err := jose.SignJWKS(body, h.root)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jose")
+	io.WriteString(w, signed)
+}
@@ -0,0 +1,172 @@
+package jwkshttp_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/jose"
+	"github.com/hsson/ring/jwkshttp"
+	"github.com/hsson/ring/sim"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestHandler(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+		RotationFrequency: time.Hour,
+	})
+	handler := jwkshttp.Handler(keychain)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v", rec.Code, http.StatusOK)
+	}
+
+	var set ring.JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 {
+		t.Errorf("got %d keys want 1", len(set.Keys))
+	}
+
+	cacheControl := rec.Header().Get("Cache-Control")
+	if !strings.HasPrefix(cacheControl, "public, max-age=35") {
+		t.Errorf("unexpected Cache-Control: %v", cacheControl)
+	}
+
+	etag := rec.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("got status %v want %v", rec.Code, http.StatusNotModified)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %v want %v", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandlerAfterRotation(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Clock:             clock,
+	})
+	handler := jwkshttp.Handler(keychain)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	// The first request after the rotation time serves the new key, and
+	// the max-age is measured by the clock of the keychain
+	clock.Advance(time.Hour + time.Minute)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set ring.JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, key := range set.Keys {
+		found = found || key.KeyID == current.ID
+	}
+	if !found {
+		t.Errorf("expected the JWKS to list the current signing key %s", current.ID)
+	}
+	// The list may be cached until the previous key expires
+	if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "public, max-age=3540" {
+		t.Errorf("unexpected Cache-Control: %v", cacheControl)
+	}
+}
+
+func TestHandlerRevoked(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	jwkshttp.Handler(keychain).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var set ring.JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, jwk := range set.Keys {
+		if jwk.KeyID == key.ID {
+			found = jwk.Revoked
+		} else if jwk.Revoked {
+			t.Errorf("expected only %s to be revoked, got %+v", key.ID, jwk)
+		}
+	}
+	if !found {
+		t.Errorf("expected %s to be flagged as revoked, got %s", key.ID, rec.Body.Bytes())
+	}
+}
+
+func TestSignedHandler(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := jwkshttp.SignedHandler(keychain, &ring.SigningKey{ID: "root", Key: private})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v", rec.Code, http.StatusOK)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/jose" {
+		t.Errorf("unexpected Content-Type: %v", contentType)
+	}
+	set, err := jose.VerifyJWKS(&ring.VerifierKey{ID: "root", Key: private.Public()}, rec.Body.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 {
+		t.Errorf("got %d keys want 1", len(set.Keys))
+	}
+}
+
+func TestDiscoveryHandler(t *testing.T) {
+	options := ring.Options{Algorithm: ring.ECDSAP256, AllowedAlgorithms: []ring.Algorithm{ring.ECDSAP256, ring.Ed25519}}
+	doc := jwkshttp.NewDiscoveryDocument("https://issuer.example", "https://issuer.example/.well-known/jwks.json", options)
+	handler := jwkshttp.DiscoveryHandler(doc)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v", rec.Code, http.StatusOK)
+	}
+	var got jwkshttp.DiscoveryDocument
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Issuer != "https://issuer.example" || got.JWKSURI != "https://issuer.example/.well-known/jwks.json" {
+		t.Errorf("unexpected document: %+v", got)
+	}
+	algs := strings.Join(got.IDTokenSigningAlgValuesSupported, ",")
+	if algs != "ES256,EdDSA" {
+		t.Errorf("expected ES256 and EdDSA, got %v", algs)
+	}
+}
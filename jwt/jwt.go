@@ -0,0 +1,130 @@
+// Package jwt signs and verifies JSON Web Tokens with the keys of a
+// keychain. Tokens carry the ID of the signing key in the kid header, which
+// is used to look up the verifier key when the token is verified.
+//
+// Tokens are signed using package jose, and the package has no dependencies
+// outside the standard library. To verify tokens with golang-jwt instead,
+// use Keyfunc:
+//
+//	keyfunc := jwt.Keyfunc(keychain)
+//	token, err := gojwt.Parse(raw, func(t *gojwt.Token) (interface{}, error) {
+//		return keyfunc(t.Header)
+//	})
+package jwt
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/jose"
+)
+
+var (
+	// ErrInvalidToken is returned when a token is malformed or its
+	// signature does not match.
+	ErrInvalidToken = errors.New("hsson/ring/jwt: invalid token")
+	// ErrTokenExpired is returned when the exp claim of a token has passed.
+	ErrTokenExpired = errors.New("hsson/ring/jwt: token is expired")
+	// ErrTokenNotValidYet is returned when the nbf claim of a token has not
+	// yet passed.
+	ErrTokenNotValidYet = errors.New("hsson/ring/jwt: token is not valid yet")
+)
+
+// Sign encodes claims as JSON and signs them with the current signing key of
+// the keychain, returning a token in the compact serialization.
+func Sign(keychain ring.Keychain, claims interface{}) (string, error) {
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return jose.Sign(keychain, claimsJSON, jose.Header{Type: "JWT"})
+}
+
+// Verify checks the signature of token against the verifier key named by its
+// kid header, and decodes the claims into claims. If the token has exp or nbf
+// claims, they are checked against the current time.
+func Verify(keychain ring.Verifier, token string, claims interface{}) error {
+	claimsJSON, _, err := jose.Verify(keychain, token)
+	if errors.Is(err, jose.ErrInvalidSignature) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	var registered struct {
+		ExpiresAt *json.Number `json:"exp"`
+		NotBefore *json.Number `json:"nbf"`
+	}
+	if err := json.Unmarshal(claimsJSON, &registered); err != nil {
+		return ErrInvalidToken
+	}
+	now := time.Now()
+	if registered.ExpiresAt != nil {
+		exp, err := registered.ExpiresAt.Int64()
+		if err != nil {
+			return ErrInvalidToken
+		}
+		if !now.Before(time.Unix(exp, 0)) {
+			return ErrTokenExpired
+		}
+	}
+	if registered.NotBefore != nil {
+		nbf, err := registered.NotBefore.Int64()
+		if err != nil {
+			return ErrInvalidToken
+		}
+		if now.Before(time.Unix(nbf, 0)) {
+			return ErrTokenNotValidYet
+		}
+	}
+
+	if claims == nil {
+		return nil
+	}
+	return json.Unmarshal(claimsJSON, claims)
+}
+
+// Keyfunc returns a function resolving the verifier key for the kid in a
+// token header. It matches the shape of the key function used by golang-jwt
+// when passed the header of the token.
+func Keyfunc(keychain ring.Verifier) func(header map[string]interface{}) (interface{}, error) {
+	return func(header map[string]interface{}) (interface{}, error) {
+		kid, ok := header["kid"].(string)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		verifier, err := keychain.GetVerifier(kid)
+		if err != nil {
+			return nil, err
+		}
+		alg, err := signatureAlgorithm(verifier.Key, verifier.SignatureAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		if header["alg"] != string(alg) {
+			return nil, ErrInvalidToken
+		}
+		return verifier.Key, nil
+	}
+}
+
+// Algorithm returns the JWS algorithm used for tokens signed with the
+// private half of key, if the key has no ring.SignatureAlgorithm: PS256 for
+// RSA keys, ES256, ES384 or ES512 for ECDSA keys depending on the curve, and
+// EdDSA for Ed25519 keys.
+func Algorithm(key crypto.PublicKey) (string, error) {
+	return jose.Algorithm(key)
+}
+
+// signatureAlgorithm returns alg, the algorithm recorded for key, or the
+// default algorithm for keys without one
+func signatureAlgorithm(key crypto.PublicKey, alg ring.SignatureAlgorithm) (ring.SignatureAlgorithm, error) {
+	if alg != "" {
+		return alg, nil
+	}
+	def, err := Algorithm(key)
+	return ring.SignatureAlgorithm(def), err
+}
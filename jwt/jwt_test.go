@@ -0,0 +1,95 @@
+package jwt_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/jwt"
+	"github.com/hsson/ring/store/inmem"
+)
+
+type claims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.Ed25519, ring.ECDSAP256, ring.ECDSAP384, ring.ECDSAP521} {
+		keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: algorithm})
+
+		token, err := jwt.Sign(keychain, claims{Subject: "alice", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+
+		var got claims
+		if err := jwt.Verify(keychain, token, &got); err != nil {
+			t.Fatalf("%s: expected valid token, got %v", algorithm, err)
+		}
+		if got.Subject != "alice" {
+			t.Errorf("%s: expected subject alice, got %q", algorithm, got.Subject)
+		}
+
+		parts := strings.Split(token, ".")
+		tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+		if err := jwt.Verify(keychain, tampered, nil); !errors.Is(err, jwt.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", algorithm, err)
+		}
+	}
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	for _, alg := range []ring.SignatureAlgorithm{ring.RS256, ring.RS512, ring.PS384} {
+		keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{SignatureAlgorithm: alg})
+		token, err := jwt.Sign(keychain, claims{Subject: "alice"})
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if err := jwt.Verify(keychain, token, nil); err != nil {
+			t.Errorf("%s: expected valid token, got %v", alg, err)
+		}
+
+		header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(header), `"alg":"`+string(alg)+`"`) {
+			t.Errorf("%s: unexpected header %s", alg, header)
+		}
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	token, err := jwt.Sign(keychain, claims{Subject: "alice", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jwt.Verify(keychain, token, nil); !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestKeyfunc(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyfunc := jwt.Keyfunc(keychain)
+	key, err := keyfunc(map[string]interface{}{"alg": "EdDSA", "kid": signingKey.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == nil {
+		t.Errorf("expected key")
+	}
+	if _, err := keyfunc(map[string]interface{}{"alg": "HS256", "kid": signingKey.ID}); !errors.Is(err, jwt.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for mismatching alg, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package ring
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+// KeyGenerator creates signing keys which are held outside the keychain,
+// e.g. in an HSM, on a PKCS #11 token or in a cloud KMS. The keychain only
+// persists a reference to each private key, next to its public key, and
+// signs through the crypto.Signer returned for it. Keys are not destroyed
+// by the keychain once they expire.
+type KeyGenerator interface {
+	// GenerateKey creates a key of the given algorithm, where size is the
+	// size in bits of RSA keys. It returns a signer for the key, and a
+	// reference which LoadKey resolves to the same key.
+	GenerateKey(algorithm Algorithm, size int) (crypto.Signer, []byte, error)
+	// LoadKey returns a signer for the key of a reference returned by
+	// GenerateKey, possibly by another instance.
+	LoadKey(ref []byte) (crypto.Signer, error)
+}
+
+// referencedSigner is a key created by a KeyGenerator, along with its
+// reference
+type referencedSigner struct {
+	crypto.Signer
+	ref []byte
+}
+
+// setKey makes key the key of signingKey, keeping the reference of keys
+// created by a KeyGenerator
+func (sk *SigningKey) setKey(key crypto.Signer) {
+	if referenced, ok := key.(*referencedSigner); ok {
+		sk.Key = referenced.Signer
+		sk.reference = referenced.ref
+		return
+	}
+	sk.Key = key
+	sk.reference = nil
+}
+
+// privateKeyEncoding returns the encoding of the data of a stored private
+// key with the given metadata
+func privateKeyEncoding(metadata map[string]string) string {
+	if metadata[MetadataKeyReference] == "true" {
+		return encodingReference
+	}
+	return encodingPKCS8
+}
+
+// loadReferencedKey returns a signer for the stored reference of a key
+// created by the KeyGenerator
+func (r *ring) loadReferencedKey(ref []byte) (crypto.Signer, error) {
+	if r.options.KeyGenerator == nil {
+		return nil, errors.New("private key is held by a KeyGenerator, but none is set")
+	}
+	signer, err := r.options.KeyGenerator.LoadKey(ref)
+	if err != nil {
+		return nil, fmt.Errorf("private key could not be loaded: %w", err)
+	}
+	if err := checkKeyType(signer); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
@@ -0,0 +1,76 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// KeyOptions controls the schedule of a key created with NewKeyWithOptions
+type KeyOptions struct {
+	// RotationFrequency is how long the key can be used for signing.
+	// Default: Options.RotationFrequency
+	RotationFrequency time.Duration
+	// VerificationPeriod is how long data signed with the key can be
+	// verified, counted from its creation. Must be at least
+	// RotationFrequency. Default: Options.VerificationPeriod
+	VerificationPeriod time.Duration
+	// KeySize is the size of RSA keys. Default: Options.KeySize
+	KeySize int
+}
+
+// customSchedule reports if a stored private key was created by
+// NewKeyWithOptions
+func customSchedule(key store.Key) bool {
+	return key.Metadata[MetadataCustomSchedule] == "true"
+}
+
+func (r *ring) NewKeyWithOptions(opts KeyOptions) (*SigningKey, error) {
+	if opts.RotationFrequency == 0 {
+		opts.RotationFrequency = r.options.RotationFrequency
+	}
+	if opts.VerificationPeriod == 0 {
+		opts.VerificationPeriod = r.options.VerificationPeriod
+	}
+	if opts.KeySize == 0 {
+		opts.KeySize = r.options.KeySize
+	}
+	if opts.RotationFrequency < 0 || opts.VerificationPeriod < opts.RotationFrequency {
+		return nil, errors.New("hsson/ring: VerificationPeriod of key must be >= RotationFrequency > 0")
+	}
+
+	if r.options.Algorithm == RSA {
+		if err := r.options.checkAlgorithmPolicy(RSA, opts.KeySize); err != nil {
+			return nil, err
+		}
+	}
+
+	privateKey, err := r.generateKeyOfSize(opts.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	id, err := r.generateID(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	now := r.options.Clock.Now()
+	algorithm, _ := keyAlgorithm(privateKey.Public())
+	signingKey := &SigningKey{
+		ID:                 id,
+		RotatedAt:          now.Add(opts.RotationFrequency),
+		VerifiableUntil:    now.Add(opts.VerificationPeriod),
+		CreatedAt:          now,
+		Algorithm:          algorithm,
+		SignatureAlgorithm: r.signatureAlgorithm(privateKey.Public()),
+		customSchedule:     true,
+	}
+	signingKey.setKey(privateKey)
+	if err := r.storeSigningKey(context.Background(), signingKey); err != nil {
+		return nil, err
+	}
+	r.cache.forget(signingKey.ID)
+	r.options.Logger.Info("created key with custom schedule", "key_id", signingKey.ID, "rotated_at", signingKey.RotatedAt, "verifiable_until", signingKey.VerifiableUntil)
+	return signingKey, nil
+}
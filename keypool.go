@@ -0,0 +1,85 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+)
+
+// startKeyPool keeps Options.PregenerateKeys private keys ready in the
+// background, so rotations don't wait for key generation, until Close is
+// called.
+func (r *ring) startKeyPool() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.keyPoolRefill = make(chan struct{}, 1)
+	r.stopKeyPool = cancel
+	r.keyPoolDone = done
+	go func() {
+		defer close(done)
+		for {
+			r.fillKeyPool(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.keyPoolRefill:
+			}
+		}
+	}()
+}
+
+// fillKeyPool generates keys until the pool is full
+func (r *ring) fillKeyPool(ctx context.Context) {
+	for ctx.Err() == nil {
+		r.keyPoolMu.Lock()
+		full := len(r.keyPool) >= r.options.PregenerateKeys
+		r.keyPoolMu.Unlock()
+		if full {
+			return
+		}
+		key, err := r.generateKey()
+		if err != nil {
+			// Rotations generate their own keys, where errors surface
+			r.options.Logger.Warn("failed to pregenerate key", "error", err)
+			return
+		}
+		r.keyPoolMu.Lock()
+		r.keyPool = append(r.keyPool, key)
+		r.keyPoolMu.Unlock()
+	}
+}
+
+// pregenerateKey generates the private key used for the next rotation,
+// unless one is already waiting.
+func (r *ring) pregenerateKey() {
+	r.keyPoolMu.Lock()
+	defer r.keyPoolMu.Unlock()
+	if len(r.keyPool) != 0 {
+		return
+	}
+	key, err := r.generateKey()
+	if err != nil {
+		// The key is generated again during rotation, where errors surface
+		return
+	}
+	r.keyPool = append(r.keyPool, key)
+}
+
+// takePregeneratedKey removes a pregenerated key from the pool, if any, so
+// it is only used once.
+func (r *ring) takePregeneratedKey() crypto.Signer {
+	r.keyPoolMu.Lock()
+	defer r.keyPoolMu.Unlock()
+	if len(r.keyPool) == 0 {
+		return nil
+	}
+	key := r.keyPool[0]
+	r.keyPool[0] = nil
+	r.keyPool = r.keyPool[1:]
+	if r.keyPoolRefill != nil {
+		select {
+		case r.keyPoolRefill <- struct{}{}:
+		default:
+		}
+	}
+	return key
+}
@@ -0,0 +1,54 @@
+package ring
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hsson/ring/store"
+)
+
+// newLockRenewer returns s as a store.LockRenewer, or nil if its lock can
+// not be renewed
+func newLockRenewer(s store.ContextStore) store.LockRenewer {
+	renewer, ok := store.AsLockRenewer(s)
+	if !ok {
+		return nil
+	}
+	return renewer
+}
+
+// keepLock renews the store lock at a third of its TTL until the returned
+// function is called, which must be done before unlocking. Stores whose lock
+// does not expire are left alone.
+func (r *ring) keepLock() (stop func()) {
+	if r.lockRenewer == nil || r.lockRenewer.LockTTL() <= 0 {
+		return func() {}
+	}
+	interval := r.lockRenewer.LockTTL() / 3
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			timer := r.newTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			err := r.lockRenewer.RenewLock()
+			if errors.Is(err, store.ErrLockLost) {
+				r.options.Logger.Error("store lock expired before being renewed")
+				return
+			}
+			if err != nil {
+				r.options.Logger.Warn("failed to renew store lock", "error", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,113 @@
+package ring
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hsson/ring/store"
+)
+
+// Logger receives structured log events from the keychain. Arguments are
+// alternating keys and values. *slog.Logger implements Logger, as do thin
+// wrappers around most structured logging libraries.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// loggedStore logs lock acquisition and failed store operations
+type loggedStore struct {
+	store.ContextStore
+	logger Logger
+}
+
+func (s *loggedStore) logError(op string, err error) {
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		s.logger.Error("store operation failed", "op", op, "error", err)
+	}
+}
+
+func (s *loggedStore) Add(ctx context.Context, key store.Key) error {
+	err := s.ContextStore.Add(ctx, key)
+	s.logError("add", err)
+	return err
+}
+
+func (s *loggedStore) Find(ctx context.Context, id string) (store.Key, error) {
+	key, err := s.ContextStore.Find(ctx, id)
+	s.logError("find", err)
+	return key, err
+}
+
+func (s *loggedStore) Delete(ctx context.Context, id string) error {
+	err := s.ContextStore.Delete(ctx, id)
+	s.logError("delete", err)
+	return err
+}
+
+func (s *loggedStore) SecureErase(ctx context.Context, id string) error {
+	err := store.SecureErase(ctx, s.ContextStore, id)
+	s.logError("delete", err)
+	return err
+}
+
+func (s *loggedStore) Stats(ctx context.Context) (store.Stats, error) {
+	stats, err := store.CollectStats(ctx, s.ContextStore)
+	s.logError("list", err)
+	return stats, err
+}
+
+func (s *loggedStore) List(ctx context.Context) (store.KeyList, error) {
+	keys, err := s.ContextStore.List(ctx)
+	s.logError("list", err)
+	return keys, err
+}
+
+func (s *loggedStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (store.KeyList, error) {
+	keys, err := store.ListFiltered(ctx, s.ContextStore, filter)
+	s.logError("list", err)
+	return keys, err
+}
+
+func (s *loggedStore) Iterate(ctx context.Context, yield func(store.Key) bool) error {
+	err := store.Iterate(ctx, s.ContextStore, yield)
+	s.logError("list", err)
+	return err
+}
+
+func (s *loggedStore) FindMany(ctx context.Context, ids []string) (store.KeyList, error) {
+	keys, err := findMany(ctx, s.ContextStore, ids)
+	s.logError("find", err)
+	return keys, err
+}
+
+func (s *loggedStore) Lock(ctx context.Context) error {
+	err := s.ContextStore.Lock(ctx)
+	switch {
+	case err == nil:
+		s.logger.Debug("acquired store lock")
+	case errors.Is(err, store.ErrLockOccupied):
+		s.logger.Warn("store lock is held by another instance")
+	default:
+		s.logError("lock", err)
+	}
+	return err
+}
+
+func (s *loggedStore) Unlock(ctx context.Context) error {
+	err := s.ContextStore.Unlock(ctx)
+	if err == nil {
+		s.logger.Debug("released store lock")
+	}
+	s.logError("unlock", err)
+	return err
+}
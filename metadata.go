@@ -0,0 +1,113 @@
+package ring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"strconv"
+	"time"
+)
+
+// Keys of the store.Key.Metadata written for keypairs created by the
+// keychain. Keys stored by earlier versions have no metadata.
+const (
+	// MetadataAlgorithm is the Algorithm of the key
+	MetadataAlgorithm = "algorithm"
+	// MetadataKeySize is the size of the key in bits
+	MetadataKeySize = "key_size"
+	// MetadataCreatedAt is when the key was created, in RFC 3339 format
+	MetadataCreatedAt = "created_at"
+	// MetadataPurpose is PurposeSigning for private keys and
+	// PurposeVerification for public keys
+	MetadataPurpose = "purpose"
+	// MetadataInstanceID is the Options.InstanceID of the creating instance
+	MetadataInstanceID = "instance_id"
+	// MetadataSignatureAlgorithm is the SignatureAlgorithm of the key
+	MetadataSignatureAlgorithm = "signature_algorithm"
+	// MetadataKeyReference is "true" for private keys held by a
+	// KeyGenerator, whose data is a reference rather than the key
+	MetadataKeyReference = "key_reference"
+	// MetadataCustomSchedule is "true" for private keys created by
+	// NewKeyWithOptions, which are not part of the rotation
+	MetadataCustomSchedule = "custom_schedule"
+	// MetadataVerifiableUntil is the VerifiableUntil of private keys, in
+	// RFC 3339 format
+	MetadataVerifiableUntil = "verifiable_until"
+	// MetadataRotatedAt is the RotatedAt of private keys and of the secrets
+	// of a SecretKeychain, in RFC 3339 format
+	MetadataRotatedAt = "rotated_at"
+	// MetadataRevokedAt is when the key was revoked, in RFC 3339 format,
+	// set on the revocation records which keep the public keys of revoked
+	// keys until they expire
+	MetadataRevokedAt = "revoked_at"
+	// MetadataDataEncoding is the KeyDataEncoding of the data of the key,
+	// if set in Options.KeyDataEncoding
+	MetadataDataEncoding = "data_encoding"
+)
+
+// Values of MetadataPurpose
+const (
+	PurposeSigning      = "signing"
+	PurposeVerification = "verification"
+	// PurposeSecret marks the shared secrets of a SecretKeychain
+	PurposeSecret = "secret"
+	// PurposeEncryption marks the keys of an EncryptionKeychain
+	PurposeEncryption = "encryption"
+)
+
+// keyAlgorithm returns the Algorithm and size in bits of a public key
+func keyAlgorithm(pub crypto.PublicKey) (Algorithm, int) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return RSA, key.N.BitLen()
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return ECDSAP256, 256
+		case elliptic.P384():
+			return ECDSAP384, 384
+		case elliptic.P521():
+			return ECDSAP521, 521
+		}
+		return "", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return Ed25519, 256
+	default:
+		return "", 0
+	}
+}
+
+// keyMetadata describes one half of signingKey
+func (r *ring) keyMetadata(signingKey *SigningKey, purpose string) map[string]string {
+	algorithm, size := keyAlgorithm(signingKey.Key.Public())
+	metadata := map[string]string{
+		MetadataAlgorithm:  string(algorithm),
+		MetadataKeySize:    strconv.Itoa(size),
+		MetadataPurpose:    purpose,
+		MetadataInstanceID: r.options.InstanceID,
+	}
+	if signingKey.SignatureAlgorithm != "" {
+		metadata[MetadataSignatureAlgorithm] = string(signingKey.SignatureAlgorithm)
+	}
+	if !signingKey.CreatedAt.IsZero() {
+		metadata[MetadataCreatedAt] = signingKey.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if r.options.KeyDataEncoding != "" {
+		metadata[MetadataDataEncoding] = string(r.options.KeyDataEncoding)
+	}
+	return metadata
+}
+
+// parseMetadata returns the algorithm and creation time of a stored key.
+// The algorithm of keys without metadata is derived from pub, while their
+// creation time is unknown and left zero.
+func parseMetadata(metadata map[string]string, pub crypto.PublicKey) (Algorithm, time.Time) {
+	algorithm := Algorithm(metadata[MetadataAlgorithm])
+	if algorithm == "" {
+		algorithm, _ = keyAlgorithm(pub)
+	}
+	createdAt, _ := time.Parse(time.RFC3339Nano, metadata[MetadataCreatedAt])
+	return algorithm, createdAt
+}
@@ -0,0 +1,119 @@
+package ring
+
+import (
+	"context"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// MetricsCollector receives measurements of keychain operations. Methods may
+// be called concurrently.
+type MetricsCollector interface {
+	// Rotated is called after the signing key was rotated
+	Rotated()
+	// RotationFailed is called after an attempt to rotate the signing key
+	// failed
+	RotationFailed()
+	// KeyGenerated is called after a private key was generated
+	KeyGenerated(algorithm Algorithm, duration time.Duration)
+	// StoreOperation is called after every store operation, with op being
+	// one of "add", "find", "delete", "list", "lock" and "unlock"
+	StoreOperation(op string, duration time.Duration, err error)
+}
+
+// DriftCollector is implemented by MetricsCollectors which also record the
+// number of drifting instances, found by the worker if
+// Options.DriftThreshold is set
+type DriftCollector interface {
+	// DriftingInstances is called with the number of drifting instances
+	// after every check
+	DriftingInstances(count int)
+}
+
+// observedStore reports the duration and outcome of all store operations
+type observedStore struct {
+	store.ContextStore
+	collector MetricsCollector
+}
+
+func (s *observedStore) observe(op string, start time.Time, err error) {
+	s.collector.StoreOperation(op, time.Since(start), err)
+}
+
+func (s *observedStore) Add(ctx context.Context, key store.Key) error {
+	start := time.Now()
+	err := s.ContextStore.Add(ctx, key)
+	s.observe("add", start, err)
+	return err
+}
+
+func (s *observedStore) Find(ctx context.Context, id string) (store.Key, error) {
+	start := time.Now()
+	key, err := s.ContextStore.Find(ctx, id)
+	s.observe("find", start, err)
+	return key, err
+}
+
+func (s *observedStore) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.ContextStore.Delete(ctx, id)
+	s.observe("delete", start, err)
+	return err
+}
+
+func (s *observedStore) SecureErase(ctx context.Context, id string) error {
+	start := time.Now()
+	err := store.SecureErase(ctx, s.ContextStore, id)
+	s.observe("delete", start, err)
+	return err
+}
+
+func (s *observedStore) Stats(ctx context.Context) (store.Stats, error) {
+	start := time.Now()
+	stats, err := store.CollectStats(ctx, s.ContextStore)
+	s.observe("list", start, err)
+	return stats, err
+}
+
+func (s *observedStore) List(ctx context.Context) (store.KeyList, error) {
+	start := time.Now()
+	keys, err := s.ContextStore.List(ctx)
+	s.observe("list", start, err)
+	return keys, err
+}
+
+func (s *observedStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (store.KeyList, error) {
+	start := time.Now()
+	keys, err := store.ListFiltered(ctx, s.ContextStore, filter)
+	s.observe("list", start, err)
+	return keys, err
+}
+
+func (s *observedStore) Iterate(ctx context.Context, yield func(store.Key) bool) error {
+	start := time.Now()
+	err := store.Iterate(ctx, s.ContextStore, yield)
+	s.observe("list", start, err)
+	return err
+}
+
+func (s *observedStore) FindMany(ctx context.Context, ids []string) (store.KeyList, error) {
+	start := time.Now()
+	keys, err := findMany(ctx, s.ContextStore, ids)
+	s.observe("find", start, err)
+	return keys, err
+}
+
+func (s *observedStore) Lock(ctx context.Context) error {
+	start := time.Now()
+	err := s.ContextStore.Lock(ctx)
+	s.observe("lock", start, err)
+	return err
+}
+
+func (s *observedStore) Unlock(ctx context.Context) error {
+	start := time.Now()
+	err := s.ContextStore.Unlock(ctx)
+	s.observe("unlock", start, err)
+	return err
+}
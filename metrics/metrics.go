@@ -0,0 +1,174 @@
+// Package metrics collects metrics of a keychain and serves them in the
+// Prometheus text exposition format, without depending on the Prometheus
+// client library.
+//
+//	collector := metrics.NewCollector()
+//	keychain, err := ring.NewKeychain(s, ring.Options{MetricsCollector: collector})
+//	...
+//	http.Handle("/metrics", collector.Handler(keychain))
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+)
+
+// Collector implements ring.MetricsCollector, keeping counters and summaries
+// in memory.
+type Collector struct {
+	mu               sync.Mutex
+	rotations        uint64
+	rotationFailures uint64
+	keyGeneration    map[ring.Algorithm]*summary
+	storeOperations  map[string]*summary
+	storeErrors      map[string]uint64
+	drifting         int
+}
+
+type summary struct {
+	count uint64
+	sum   float64
+}
+
+func (s *summary) observe(d time.Duration) {
+	s.count++
+	s.sum += d.Seconds()
+}
+
+// NewCollector creates an empty Collector
+func NewCollector() *Collector {
+	return &Collector{
+		keyGeneration:   make(map[ring.Algorithm]*summary),
+		storeOperations: make(map[string]*summary),
+		storeErrors:     make(map[string]uint64),
+	}
+}
+
+// Rotated counts a rotation
+func (c *Collector) Rotated() {
+	c.mu.Lock()
+	c.rotations++
+	c.mu.Unlock()
+}
+
+// RotationFailed counts a failed rotation
+func (c *Collector) RotationFailed() {
+	c.mu.Lock()
+	c.rotationFailures++
+	c.mu.Unlock()
+}
+
+// KeyGenerated records the latency of generating a key
+func (c *Collector) KeyGenerated(algorithm ring.Algorithm, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.keyGeneration[algorithm]
+	if !ok {
+		s = &summary{}
+		c.keyGeneration[algorithm] = s
+	}
+	s.observe(duration)
+}
+
+// StoreOperation records the latency and outcome of a store operation.
+// ring.ErrKeyNotFound is not counted as an error.
+func (c *Collector) StoreOperation(op string, duration time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.storeOperations[op]
+	if !ok {
+		s = &summary{}
+		c.storeOperations[op] = s
+	}
+	s.observe(duration)
+	if err != nil && err != ring.ErrKeyNotFound {
+		c.storeErrors[op]++
+	}
+}
+
+// DriftingInstances records the number of drifting instances found by the
+// worker of the keychain
+func (c *Collector) DriftingInstances(count int) {
+	c.mu.Lock()
+	c.drifting = count
+	c.mu.Unlock()
+}
+
+// Handler serves the collected metrics, together with gauges of the number
+// of active verifier keys and the time until the next rotation of keychain.
+func (c *Collector) Handler(keychain ring.Keychain) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		c.write(&buf)
+		writeGauges(&buf, keychain)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+func (c *Collector) write(buf *bytes.Buffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(buf, "# HELP ring_rotations_total Number of signing key rotations.\n")
+	fmt.Fprintf(buf, "# TYPE ring_rotations_total counter\n")
+	fmt.Fprintf(buf, "ring_rotations_total %d\n", c.rotations)
+
+	fmt.Fprintf(buf, "# HELP ring_rotation_failures_total Number of failed signing key rotations.\n")
+	fmt.Fprintf(buf, "# TYPE ring_rotation_failures_total counter\n")
+	fmt.Fprintf(buf, "ring_rotation_failures_total %d\n", c.rotationFailures)
+
+	fmt.Fprintf(buf, "# HELP ring_key_generation_seconds Time spent generating private keys.\n")
+	fmt.Fprintf(buf, "# TYPE ring_key_generation_seconds summary\n")
+	algorithms := make([]string, 0, len(c.keyGeneration))
+	for algorithm := range c.keyGeneration {
+		algorithms = append(algorithms, string(algorithm))
+	}
+	sort.Strings(algorithms)
+	for _, algorithm := range algorithms {
+		s := c.keyGeneration[ring.Algorithm(algorithm)]
+		fmt.Fprintf(buf, "ring_key_generation_seconds_sum{algorithm=%q} %g\n", algorithm, s.sum)
+		fmt.Fprintf(buf, "ring_key_generation_seconds_count{algorithm=%q} %d\n", algorithm, s.count)
+	}
+
+	ops := make([]string, 0, len(c.storeOperations))
+	for op := range c.storeOperations {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	fmt.Fprintf(buf, "# HELP ring_store_operation_seconds Time spent in store operations.\n")
+	fmt.Fprintf(buf, "# TYPE ring_store_operation_seconds summary\n")
+	for _, op := range ops {
+		s := c.storeOperations[op]
+		fmt.Fprintf(buf, "ring_store_operation_seconds_sum{op=%q} %g\n", op, s.sum)
+		fmt.Fprintf(buf, "ring_store_operation_seconds_count{op=%q} %d\n", op, s.count)
+	}
+	fmt.Fprintf(buf, "# HELP ring_store_errors_total Number of failed store operations.\n")
+	fmt.Fprintf(buf, "# TYPE ring_store_errors_total counter\n")
+	for _, op := range ops {
+		fmt.Fprintf(buf, "ring_store_errors_total{op=%q} %d\n", op, c.storeErrors[op])
+	}
+
+	fmt.Fprintf(buf, "# HELP ring_drifting_instances Number of instances signing with a stale key.\n")
+	fmt.Fprintf(buf, "# TYPE ring_drifting_instances gauge\n")
+	fmt.Fprintf(buf, "ring_drifting_instances %d\n", c.drifting)
+}
+
+func writeGauges(buf *bytes.Buffer, keychain ring.Keychain) {
+	if verifiers, err := keychain.ListVerifiers(); err == nil {
+		fmt.Fprintf(buf, "# HELP ring_active_verifiers Number of active verifier keys.\n")
+		fmt.Fprintf(buf, "# TYPE ring_active_verifiers gauge\n")
+		fmt.Fprintf(buf, "ring_active_verifiers %d\n", len(verifiers))
+	}
+	if key, err := keychain.SigningKey(); err == nil {
+		fmt.Fprintf(buf, "# HELP ring_seconds_until_rotation Seconds until the signing key is rotated.\n")
+		fmt.Fprintf(buf, "# TYPE ring_seconds_until_rotation gauge\n")
+		fmt.Fprintf(buf, "ring_seconds_until_rotation %g\n", time.Until(key.RotatedAt).Seconds())
+	}
+}
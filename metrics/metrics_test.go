@@ -0,0 +1,45 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/metrics"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestHandler(t *testing.T) {
+	collector := metrics.NewCollector()
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:        ring.Ed25519,
+		MetricsCollector: collector,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	collector.Handler(keychain).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+
+	for _, want := range []string{
+		"ring_rotations_total 1\n",
+		"ring_rotation_failures_total 0\n",
+		"ring_key_generation_seconds_count{algorithm=\"Ed25519\"} 2\n",
+		"ring_store_operation_seconds_count{op=\"lock\"} 2\n",
+		"ring_store_errors_total{op=\"add\"} 0\n",
+		"ring_active_verifiers 2\n",
+		"ring_drifting_instances 0\n",
+		"ring_seconds_until_rotation ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
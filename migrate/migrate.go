@@ -0,0 +1,65 @@
+// Package migrate copies keys between stores, e.g. to move a keychain from
+// a file store to a shared database without invalidating signed data.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+const (
+	lockRetryInterval = 100 * time.Millisecond
+	lockTimeout       = 30 * time.Second
+)
+
+// Copy adds all non-expired keys of src to dst, keeping their IDs and
+// expiry. Keys already present in dst are left untouched, so Copy can be
+// run again while instances are still using src. Both stores are locked
+// during the copy, so no keys are created in the meantime.
+func Copy(src, dst store.Store) error {
+	srcLock, dstLock := store.AsLocker(src), store.AsLocker(dst)
+	if err := lock(srcLock); err != nil {
+		return fmt.Errorf("failed to lock source: %w", err)
+	}
+	defer srcLock.Unlock()
+	if err := lock(dstLock); err != nil {
+		return fmt.Errorf("failed to lock destination: %w", err)
+	}
+	defer dstLock.Unlock()
+
+	keys, err := src.List()
+	if err != nil {
+		return fmt.Errorf("failed to list source: %w", err)
+	}
+	keys.SortByExpiresAt()
+
+	// Public keys are copied first, so an instance using dst never finds a
+	// private key without its verifier
+	now := time.Now()
+	for _, private := range []bool{false, true} {
+		for _, key := range keys {
+			if key.IsPrivate != private || !key.ExpiresAt.After(now) {
+				continue
+			}
+			if err := dst.Add(key); err != nil && !errors.Is(err, store.ErrKeyIDConflict) {
+				return fmt.Errorf("failed to copy %s: %w", key.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lock locks s, waiting for a lock held by someone else to be released
+func lock(s store.Locker) error {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := s.Lock()
+		if !errors.Is(err, store.ErrLockOccupied) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
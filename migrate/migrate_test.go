@@ -0,0 +1,65 @@
+package migrate_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/migrate"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestCopy(t *testing.T) {
+	src := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(src, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Add(store.Key{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := inmem.NewInMemoryStore()
+	for i := 0; i < 2; i++ {
+		if err := migrate.Copy(src, dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dst.Find("expired"); err == nil {
+		t.Error("expected expired key not to be copied")
+	}
+	srcKey, err := src.Find(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstKey, err := dst.Find(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dstKey.ExpiresAt.Equal(srcKey.ExpiresAt) {
+		t.Errorf("expected expiry %v to be kept, got %v", srcKey.ExpiresAt, dstKey.ExpiresAt)
+	}
+
+	migrated, err := ring.NewKeychain(dst, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrated.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected migrated keychain to verify signature, got %v", err)
+	}
+	if key, err := migrated.SigningKey(); err != nil || key.ID != keyID {
+		t.Errorf("expected migrated keychain to reuse %v, got %v", keyID, key)
+	}
+
+	// Both locks are released after copying
+	for _, s := range []store.Store{src, dst} {
+		if err := s.(store.Locker).Lock(); err != nil {
+			t.Errorf("expected store to be unlocked, got %v", err)
+		}
+	}
+}
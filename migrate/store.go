@@ -0,0 +1,288 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+// Options customize the store of NewStore
+type Options struct {
+	// CutoverAt is when reads, writes and the store lock switch to the new
+	// store. All instances should use the same time, so they switch
+	// together. Default: zero, the new store is used right away
+	CutoverAt time.Time
+
+	// CutoverLockWindow is how long before and after CutoverAt the lock of
+	// both stores is taken, old first, so instances whose clocks straddle
+	// the cutover don't each hold a different lock. It should exceed the
+	// clock skew between instances. Default: 5 minutes
+	CutoverLockWindow time.Duration
+
+	// Clock tells when the cutover is reached. Default: the system clock
+	Clock ring.Clock
+}
+
+const defaultCutoverLockWindow = 5 * time.Minute
+
+// NewStore creates a store for moving a keychain from old to new, e.g. from
+// a file store to Redis, without a gap in which keys can't be verified.
+// Until Options.CutoverAt keys are read from old and written to both
+// stores, so new holds every key created in the meantime, while the keys
+// created before are copied by Copy. From the cutover on, new is used
+// alone. The store lock is the lock of old until the cutover, so instances
+// still using old alone rotate together with those migrating, and the lock
+// of both stores around it, see Options.CutoverLockWindow. The returned
+// store implements store.Locker, store.LockRenewer, store.TTLHandler,
+// store.Watcher and io.Closer using the stores in use.
+func NewStore(old, new store.Store, options Options) store.Store {
+	if options.CutoverLockWindow <= 0 {
+		options.CutoverLockWindow = defaultCutoverLockWindow
+	}
+	return &migrationStore{
+		old:     old,
+		new:     new,
+		oldLock: store.AsLocker(old),
+		newLock: store.AsLocker(new),
+		options: options,
+	}
+}
+
+type migrationStore struct {
+	old, new         store.Store
+	oldLock, newLock store.Locker
+	options          Options
+
+	// locked are the locks taken by Lock, so the same locks are released
+	// and renewed if the cutover passes while holding them
+	mu     sync.Mutex
+	locked []store.Locker
+}
+
+func (s *migrationStore) now() time.Time {
+	if s.options.Clock != nil {
+		return s.options.Clock.Now()
+	}
+	return time.Now()
+}
+
+// newTimer creates a timer on the Clock, if it is a ring.TimerClock, or
+// else on the system time
+func (s *migrationStore) newTimer(d time.Duration) ring.Timer {
+	if clock, ok := s.options.Clock.(ring.TimerClock); ok {
+		return clock.NewTimer(d)
+	}
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// migrating reports if the cutover is still ahead
+func (s *migrationStore) migrating() bool {
+	return s.now().Before(s.options.CutoverAt)
+}
+
+// Add writes key to the new store, and while migrating first to the old
+// one. If the write to the new store fails, the key is deleted from the
+// old store again, so the keychain can retry.
+func (s *migrationStore) Add(key store.Key) error {
+	if !s.migrating() {
+		return s.new.Add(key)
+	}
+	if err := s.old.Add(key); err != nil {
+		return err
+	}
+	if err := s.new.Add(key); err != nil {
+		_ = s.old.Delete(key.ID)
+		return err
+	}
+	return nil
+}
+
+// Find reads from the old store until the cutover, and then from the new
+func (s *migrationStore) Find(id string) (store.Key, error) {
+	if s.migrating() {
+		return s.old.Find(id)
+	}
+	return s.new.Find(id)
+}
+
+// Delete removes the key from the new store, and while migrating from the
+// old one too, returning the first error
+func (s *migrationStore) Delete(id string) error {
+	var err error
+	if s.migrating() {
+		err = s.old.Delete(id)
+	}
+	if newErr := s.new.Delete(id); err == nil {
+		err = newErr
+	}
+	return err
+}
+
+// List lists the old store until the cutover, and then the new one
+func (s *migrationStore) List() (store.KeyList, error) {
+	if s.migrating() {
+		return s.old.List()
+	}
+	return s.new.List()
+}
+
+// locks returns the locks to take now: those of old until the cutover, of
+// new after it, and of both close to it
+func (s *migrationStore) locks() []store.Locker {
+	now := s.now()
+	window := s.options.CutoverLockWindow
+	switch {
+	case now.Before(s.options.CutoverAt.Add(-window)):
+		return []store.Locker{s.oldLock}
+	case now.Before(s.options.CutoverAt.Add(window)):
+		return []store.Locker{s.oldLock, s.newLock}
+	default:
+		return []store.Locker{s.newLock}
+	}
+}
+
+func (s *migrationStore) Lock() error {
+	locks := s.locks()
+	for i, lock := range locks {
+		if err := lock.Lock(); err != nil {
+			for _, locked := range locks[:i] {
+				_ = locked.Unlock()
+			}
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.locked = locks
+	s.mu.Unlock()
+	return nil
+}
+
+// Unlock releases the locks taken by Lock, even if the cutover passed in
+// the meantime, returning the first error
+func (s *migrationStore) Unlock() error {
+	s.mu.Lock()
+	locked := s.locked
+	s.locked = nil
+	s.mu.Unlock()
+	if locked == nil {
+		locked = s.locks()
+	}
+	var err error
+	for i := len(locked) - 1; i >= 0; i-- {
+		if unlockErr := locked[i].Unlock(); err == nil {
+			err = unlockErr
+		}
+	}
+	return err
+}
+
+// LockTTL implements store.LockRenewer, returning the shortest TTL of the
+// locks of the stores, or 0 if none of them expires
+func (s *migrationStore) LockTTL() time.Duration {
+	var ttl time.Duration
+	for _, st := range []store.Store{s.old, s.new} {
+		if renewer, ok := st.(store.LockRenewer); ok {
+			if t := renewer.LockTTL(); t > 0 && (ttl == 0 || t < ttl) {
+				ttl = t
+			}
+		}
+	}
+	return ttl
+}
+
+// RenewLock implements store.LockRenewer, renewing the locks taken by Lock
+// which expire
+func (s *migrationStore) RenewLock() error {
+	s.mu.Lock()
+	locked := s.locked
+	s.mu.Unlock()
+	if locked == nil {
+		return store.ErrLockLost
+	}
+	for _, lock := range locked {
+		if renewer, ok := lock.(store.LockRenewer); ok {
+			if err := renewer.RenewLock(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandlesTTL implements store.TTLHandler, reporting whether the stores in
+// use delete expired keys by themselves
+func (s *migrationStore) HandlesTTL() bool {
+	handles := func(st store.Store) bool {
+		h, ok := st.(store.TTLHandler)
+		return ok && h.HandlesTTL()
+	}
+	if s.migrating() {
+		return handles(s.old) && handles(s.new)
+	}
+	return handles(s.new)
+}
+
+// Watch implements store.Watcher, watching the store read from. A watch of
+// the old store ends at the cutover, so the keychain watches the new store
+// from then on. Stores which can't be watched send no events.
+func (s *migrationStore) Watch(ctx context.Context) (<-chan store.Event, error) {
+	if !s.migrating() {
+		return watch(ctx, s.new)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	events, err := watch(ctx, s.old)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	cutover := s.newTimer(s.options.CutoverAt.Sub(s.now()))
+	go func() {
+		defer cutover.Stop()
+		select {
+		case <-ctx.Done():
+		case <-cutover.C():
+			cancel()
+		}
+	}()
+	return events, nil
+}
+
+// watch watches st if it is a store.Watcher, or else returns a channel which
+// is closed once ctx is done
+func watch(ctx context.Context, st store.Store) (<-chan store.Event, error) {
+	if watcher, ok := st.(store.Watcher); ok {
+		return watcher.Watch(ctx)
+	}
+	events := make(chan store.Event)
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+	return events, nil
+}
+
+// Close implements io.Closer, closing both stores and returning the first
+// error
+func (s *migrationStore) Close() error {
+	var err error
+	for _, st := range []store.Store{s.old, s.new} {
+		if closer, ok := st.(io.Closer); ok {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
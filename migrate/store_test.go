@@ -0,0 +1,138 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/migrate"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/sim"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestStoreConformance(t *testing.T) {
+	t.Run("migrating", func(t *testing.T) {
+		storetest.Run(t, func() store.Store {
+			return migrate.NewStore(inmem.NewInMemoryStore(), inmem.NewInMemoryStore(), migrate.Options{CutoverAt: time.Now().Add(time.Hour)})
+		})
+	})
+	t.Run("cut over", func(t *testing.T) {
+		storetest.Run(t, func() store.Store {
+			return migrate.NewStore(inmem.NewInMemoryStore(), inmem.NewInMemoryStore(), migrate.Options{})
+		})
+	})
+}
+
+func TestStore(t *testing.T) {
+	clock := sim.NewClock(time.Now())
+	old, new := inmem.NewInMemoryStore(), inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, VerificationPeriod: 4 * time.Hour, Clock: clock}
+	keychain, err := ring.NewKeychain(old, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate.Copy(old, new); err != nil {
+		t.Fatal(err)
+	}
+
+	s := migrate.NewStore(old, new, migrate.Options{CutoverAt: clock.Now().Add(2 * time.Hour), Clock: clock})
+	keychain, err = ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(90 * time.Minute)
+	during, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if during.ID == before.ID {
+		t.Fatal("expected the key to be rotated during the migration")
+	}
+	for _, st := range []store.Store{old, new} {
+		if _, err := st.Find("pub:" + during.ID); err != nil {
+			t.Errorf("expected keys created during the migration in both stores, got %v", err)
+		}
+	}
+
+	clock.Advance(time.Hour)
+	if err := old.Delete("pub:" + during.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{before.ID, during.ID} {
+		if _, err := keychain.GetVerifier(id); err != nil {
+			t.Errorf("expected %s to verify from the new store after the cutover, got %v", id, err)
+		}
+	}
+}
+
+func TestStoreLocksBothStoresAroundCutover(t *testing.T) {
+	cutover := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	old, new := inmem.NewInMemoryStore(), inmem.NewInMemoryStore()
+	// The clocks of the instances straddle the cutover
+	early := migrate.NewStore(old, new, migrate.Options{CutoverAt: cutover, Clock: sim.NewClock(cutover.Add(-time.Minute))})
+	late := migrate.NewStore(old, new, migrate.Options{CutoverAt: cutover, Clock: sim.NewClock(cutover.Add(time.Minute))})
+
+	if err := early.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := late.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied while the other instance holds the lock, got %v", err)
+	}
+	if err := early.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := late.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected the lock to be released in both stores, got %v", err)
+	}
+
+	renewer, ok := late.(store.LockRenewer)
+	if !ok {
+		t.Fatal("expected the store to implement store.LockRenewer")
+	}
+	if renewer.LockTTL() <= 0 {
+		t.Errorf("expected the lock TTL of the in-memory stores, got %v", renewer.LockTTL())
+	}
+	if err := renewer.RenewLock(); err != nil {
+		t.Errorf("expected the lock to be renewed, got %v", err)
+	}
+	if err := late.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+		t.Errorf("expected ErrLockLost after unlocking, got %v", err)
+	}
+}
+
+func TestStoreWatchEndsAtCutover(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := migrate.NewStore(inmem.NewInMemoryStore(), inmem.NewInMemoryStore(), migrate.Options{CutoverAt: clock.Now().Add(time.Hour), Clock: clock})
+	events, err := s.(store.Watcher).Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(store.Key{ID: "key", ExpiresAt: clock.Now().Add(2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event.ID != "key" {
+		t.Errorf("expected an event for the added key, got %+v", event)
+	}
+
+	clock.Advance(time.Hour)
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected no more events from the old store")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the watch of the old store to end at the cutover")
+	}
+}
@@ -0,0 +1,196 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hsson/ring/store"
+)
+
+// namespaceSeparator separates the namespace from the key ID in the store,
+// unless overridden by Options.NamespaceSeparator
+const namespaceSeparator = "/"
+
+// namespacePrefix returns the prefix of the store IDs in the namespace of
+// options, if any
+func namespacePrefix(options Options) string {
+	if options.Namespace == "" {
+		return ""
+	}
+	separator := options.NamespaceSeparator
+	if separator == "" {
+		separator = namespaceSeparator
+	}
+	return options.Namespace + separator
+}
+
+// namespacedStore scopes all keys of a keychain to a namespace, so that
+// several keychains can share a single store. The lock is not namespaced, it
+// is still shared by all keychains using the store.
+type namespacedStore struct {
+	store.ContextStore
+	prefix string
+}
+
+func withNamespace(s store.ContextStore, prefix string) store.ContextStore {
+	if prefix == "" {
+		return s
+	}
+	return &namespacedStore{ContextStore: s, prefix: prefix}
+}
+
+func (s *namespacedStore) Add(ctx context.Context, key store.Key) error {
+	key.ID = s.prefix + key.ID
+	return s.ContextStore.Add(ctx, key)
+}
+
+func (s *namespacedStore) Find(ctx context.Context, id string) (store.Key, error) {
+	key, err := s.ContextStore.Find(ctx, s.prefix+id)
+	key.ID = strings.TrimPrefix(key.ID, s.prefix)
+	return key, err
+}
+
+func (s *namespacedStore) Delete(ctx context.Context, id string) error {
+	return s.ContextStore.Delete(ctx, s.prefix+id)
+}
+
+func (s *namespacedStore) SecureErase(ctx context.Context, id string) error {
+	return store.SecureErase(ctx, s.ContextStore, s.prefix+id)
+}
+
+func (s *namespacedStore) List(ctx context.Context) (store.KeyList, error) {
+	keys, err := s.ContextStore.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res store.KeyList
+	for _, key := range keys {
+		if strings.HasPrefix(key.ID, s.prefix) {
+			key.ID = strings.TrimPrefix(key.ID, s.prefix)
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+func (s *namespacedStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (store.KeyList, error) {
+	filter.IDPrefix = s.prefix + filter.IDPrefix
+	keys, err := store.ListFiltered(ctx, s.ContextStore, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i].ID = strings.TrimPrefix(keys[i].ID, s.prefix)
+	}
+	return keys, nil
+}
+
+func (s *namespacedStore) Iterate(ctx context.Context, yield func(store.Key) bool) error {
+	return store.Iterate(ctx, s.ContextStore, func(key store.Key) bool {
+		if !strings.HasPrefix(key.ID, s.prefix) {
+			return true
+		}
+		key.ID = strings.TrimPrefix(key.ID, s.prefix)
+		return yield(key)
+	})
+}
+
+func (s *namespacedStore) FindMany(ctx context.Context, ids []string) (store.KeyList, error) {
+	prefixed := make([]string, len(ids))
+	for i, id := range ids {
+		prefixed[i] = s.prefix + id
+	}
+	keys, err := findMany(ctx, s.ContextStore, prefixed)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i].ID = strings.TrimPrefix(keys[i].ID, s.prefix)
+	}
+	return keys, nil
+}
+
+// ErrKeychainExists is returned by Manager.Add if a keychain with the same
+// name has already been added.
+var ErrKeychainExists = errors.New("hsson/ring: keychain already exists")
+
+// Manager hosts several independently configured keychains, e.g. one per
+// key purpose, over a single shared store. Each keychain is given its own
+// namespace, so the keys of different keychains never collide.
+//
+// All keychains stored in a store used by a Manager must be namespaced,
+// since keychains without a namespace see every key in the store.
+type Manager struct {
+	store store.ContextStore
+
+	mu        sync.RWMutex
+	keychains map[string]Keychain
+}
+
+// NewManager creates a Manager with keychains stored in s
+func NewManager(s store.Store) *Manager {
+	return &Manager{
+		store:     store.WithContext(s),
+		keychains: make(map[string]Keychain),
+	}
+}
+
+// Add creates a keychain named name, using name as Options.Namespace.
+func (m *Manager) Add(name string, options Options) (Keychain, error) {
+	return m.AddContext(context.Background(), name, options)
+}
+
+// AddContext is like Add, but ctx bounds the initialization of the keychain.
+func (m *Manager) AddContext(ctx context.Context, name string, options Options) (Keychain, error) {
+	if name == "" {
+		return nil, errors.New("hsson/ring: keychain name must not be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keychains[name]; ok {
+		return nil, ErrKeychainExists
+	}
+	options.Namespace = name
+	keychain, err := NewKeychainContext(ctx, m.store, options)
+	if err != nil {
+		return nil, err
+	}
+	m.keychains[name] = keychain
+	return keychain, nil
+}
+
+// Keychain returns the keychain named name, if it has been added.
+func (m *Manager) Keychain(name string) (Keychain, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keychain, ok := m.keychains[name]
+	return keychain, ok
+}
+
+// Names returns the names of all keychains, in sorted order.
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.keychains))
+	for name := range m.keychains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops the background workers of all keychains.
+func (m *Manager) Close() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var firstErr error
+	for _, keychain := range m.keychains {
+		if err := keychain.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
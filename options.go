@@ -0,0 +1,270 @@
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// minRSAKeySize is the smallest RSA key size accepted
+	minRSAKeySize = 2048
+	// defaultRSAPublicExponent is the public exponent of RSA keys generated
+	// by the standard library
+	defaultRSAPublicExponent = 65537
+	// minIDEntropy is the least number of bits of entropy of random IDs,
+	// which keeps ID conflicts rare
+	minIDEntropy = 40
+)
+
+// Validate checks the options like NewKeychain does, after filling in the
+// defaults, and returns a descriptive error for the first invalid option.
+func (o Options) Validate() error {
+	return o.withDefaults().validate()
+}
+
+// withDefaults returns the options with defaults filled in for all unset
+// options
+func (o Options) withDefaults() Options {
+	if o.RotationFrequency == 0 && o.RotationSchedule != "" {
+		if schedule, err := parseCronSchedule(o.RotationSchedule); err == nil {
+			o.RotationFrequency = schedule.longestInterval()
+		}
+	}
+	if o.RotationFrequency == 0 {
+		o.RotationFrequency = defaultOptions.RotationFrequency
+	}
+	if o.VerificationPeriod == 0 {
+		o.VerificationPeriod = o.RotationFrequency * 2
+	}
+	if o.HealthRotationThreshold == 0 {
+		o.HealthRotationThreshold = o.RotationFrequency
+	}
+	if o.MaxVerifierExtension == 0 {
+		o.MaxVerifierExtension = o.VerificationPeriod
+	}
+	if o.NamespaceSeparator == "" {
+		o.NamespaceSeparator = namespaceSeparator
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = defaultOptions.Algorithm
+	}
+	if o.KeySize == 0 {
+		o.KeySize = defaultOptions.KeySize
+	}
+	if o.IDAlphabet == "" {
+		o.IDAlphabet = defaultOptions.IDAlphabet
+	}
+	if o.IDLength == 0 {
+		o.IDLength = defaultOptions.IDLength
+	}
+	if o.IDStrategy == "" {
+		o.IDStrategy = defaultOptions.IDStrategy
+	}
+	o.IDPrefixes = o.IDPrefixes.withDefaults()
+	if o.CleanupInterval == 0 {
+		o.CleanupInterval = defaultOptions.CleanupInterval
+	}
+	if o.IDConflictRetries == 0 {
+		o.IDConflictRetries = defaultOptions.IDConflictRetries
+	} else if o.IDConflictRetries < 0 {
+		o.IDConflictRetries = 0
+	}
+	if o.Clock == nil {
+		o.Clock = defaultOptions.Clock
+	}
+	if o.LockRetryPolicy.Attempts == 0 {
+		o.LockRetryPolicy.Attempts = defaultOptions.LockRetryPolicy.Attempts
+	}
+	if o.LockRetryPolicy.Backoff == 0 {
+		o.LockRetryPolicy.Backoff = defaultOptions.LockRetryPolicy.Backoff
+	}
+	if o.LockRetryPolicy.MaxBackoff == 0 {
+		o.LockRetryPolicy.MaxBackoff = defaultOptions.LockRetryPolicy.MaxBackoff
+	}
+	return o
+}
+
+// validate checks options with defaults filled in
+func (o Options) validate() error {
+	if o.RotationFrequency < 0 {
+		return errors.New("hsson/ring: RotationFrequency must be > 0")
+	}
+
+	if o.VerificationPeriod < o.RotationFrequency {
+		return errors.New("hsson/ring: VerificationPeriod must be >= RotationFrequency")
+	}
+	if err := o.validateRotationSchedule(); err != nil {
+		return err
+	}
+
+	switch o.Algorithm {
+	case RSA:
+		if o.KeySize < minRSAKeySize {
+			return fmt.Errorf("hsson/ring: KeySize must be >= %d for RSA keys", minRSAKeySize)
+		}
+	case ECDSAP256, ECDSAP384, ECDSAP521, Ed25519:
+	default:
+		return fmt.Errorf("hsson/ring: unsupported Algorithm %q", o.Algorithm)
+	}
+
+	if o.MinKeySize < 0 {
+		return errors.New("hsson/ring: MinKeySize must be >= 0")
+	}
+	if o.RSAPublicExponent != 0 && (o.RSAPublicExponent < 3 || o.RSAPublicExponent%2 == 0) {
+		return errors.New("hsson/ring: RSAPublicExponent must be an odd number >= 3")
+	}
+	if o.RSAPublicExponent != 0 && o.RSAPublicExponent != defaultRSAPublicExponent && o.Algorithm == RSA && o.GenerateKey == nil && o.KeyGenerator == nil {
+		return fmt.Errorf("hsson/ring: RSAPublicExponent other than %d requires GenerateKey or KeyGenerator", defaultRSAPublicExponent)
+	}
+	if o.RSAPrimes < 0 || o.RSAPrimes == 1 {
+		return errors.New("hsson/ring: RSAPrimes must be >= 2")
+	}
+	if o.TombstoneTTL < 0 {
+		return errors.New("hsson/ring: TombstoneTTL must be >= 0")
+	}
+	if o.DriftThreshold < 0 {
+		return errors.New("hsson/ring: DriftThreshold must be >= 0")
+	}
+	if err := o.validatePostQuantum(); err != nil {
+		return err
+	}
+	if err := o.validateStaticVerifiers(); err != nil {
+		return err
+	}
+	if o.FIPS {
+		if err := o.validateFIPS(); err != nil {
+			return err
+		}
+	}
+	if err := o.checkAlgorithmPolicy(o.Algorithm, o.KeySize); err != nil {
+		return fmt.Errorf("hsson/ring: Algorithm and KeySize must be allowed by the key policy: %w", err)
+	}
+
+	if o.SignatureAlgorithm != "" && !o.SignatureAlgorithm.isRSA() {
+		return fmt.Errorf("hsson/ring: unsupported SignatureAlgorithm %q", o.SignatureAlgorithm)
+	}
+
+	if o.KeyGenerator != nil && o.GenerateKey != nil {
+		return errors.New("hsson/ring: KeyGenerator can't be combined with GenerateKey")
+	}
+	switch o.KeyMismatch {
+	case "", KeyMismatchReuse, KeyMismatchRotate, KeyMismatchError:
+	default:
+		return fmt.Errorf("hsson/ring: unsupported KeyMismatch %q", o.KeyMismatch)
+	}
+	switch o.KeyDataEncoding {
+	case "", KeyDataDER, KeyDataPEM, KeyDataCompressed:
+	default:
+		return fmt.Errorf("hsson/ring: unsupported KeyDataEncoding %q", o.KeyDataEncoding)
+	}
+	if o.KeyDataEncoding != "" && o.LegacyStorageFormat {
+		return errors.New("hsson/ring: KeyDataEncoding can't be combined with LegacyStorageFormat")
+	}
+	if o.KeyGenerator != nil && o.LegacyStorageFormat {
+		return errors.New("hsson/ring: KeyGenerator can't be combined with LegacyStorageFormat")
+	}
+
+	if o.MaxSignaturesPerKey < 0 {
+		return errors.New("hsson/ring: MaxSignaturesPerKey must be >= 0")
+	}
+
+	if o.PregenerateKeys < 0 {
+		return errors.New("hsson/ring: PregenerateKeys must be >= 0")
+	}
+
+	if o.RotationJitter < 0 || o.RotationJitter >= 1 {
+		return errors.New("hsson/ring: RotationJitter must be >= 0 and < 1")
+	}
+
+	if o.PrePublishWindow < 0 || o.PrePublishWindow >= o.RotationFrequency {
+		return errors.New("hsson/ring: PrePublishWindow must be >= 0 and < RotationFrequency")
+	}
+
+	if o.SigningGracePeriod < 0 || o.SigningGracePeriod > o.VerificationPeriod-o.RotationFrequency {
+		return errors.New("hsson/ring: SigningGracePeriod must be >= 0 and <= VerificationPeriod - RotationFrequency")
+	}
+
+	if o.RotationLockWait < 0 {
+		return errors.New("hsson/ring: RotationLockWait must be >= 0")
+	}
+
+	if o.CircuitBreaker.Failures < 0 || o.CircuitBreaker.Failures > 0 && o.CircuitBreaker.OpenDuration <= 0 {
+		return errors.New("hsson/ring: CircuitBreaker must have Failures >= 0 and a positive OpenDuration")
+	}
+
+	if o.StoreTimeout < 0 {
+		return errors.New("hsson/ring: StoreTimeout must be >= 0")
+	}
+
+	if o.ClockSkewTolerance < 0 {
+		return errors.New("hsson/ring: ClockSkewTolerance must be >= 0")
+	}
+
+	if o.PromotionDelay < 0 || o.PromotionDelay > 0 && !o.StagedRotation {
+		return errors.New("hsson/ring: PromotionDelay must be >= 0 and requires StagedRotation")
+	}
+
+	if o.RotationOverdueThreshold < 0 {
+		return errors.New("hsson/ring: RotationOverdueThreshold must be >= 0")
+	}
+	if o.HealthRotationThreshold < 0 {
+		return errors.New("hsson/ring: HealthRotationThreshold must be >= 0")
+	}
+
+	if o.MaxVerifierExtension < 0 {
+		return errors.New("hsson/ring: MaxVerifierExtension must be >= 0")
+	}
+
+	if o.RetainSigningKeys < 0 || o.SigningGracePeriod+time.Duration(o.RetainSigningKeys)*o.RotationFrequency > o.VerificationPeriod-o.RotationFrequency {
+		return errors.New("hsson/ring: SigningGracePeriod + RetainSigningKeys * RotationFrequency must be <= VerificationPeriod - RotationFrequency")
+	}
+
+	if o.LockRetryPolicy.Attempts < 0 || o.LockRetryPolicy.Backoff < 0 || o.LockRetryPolicy.MaxBackoff < 0 {
+		return errors.New("hsson/ring: LockRetryPolicy must not be negative")
+	}
+
+	if strings.Contains(o.Namespace, o.NamespaceSeparator) {
+		return fmt.Errorf("hsson/ring: Namespace must not contain %q", o.NamespaceSeparator)
+	}
+
+	idAlphabet := o.IDAlphabet
+	switch o.IDStrategy {
+	case RandomID:
+		if err := validateIDEntropy(o.IDAlphabet, o.IDLength); err != nil {
+			return err
+		}
+	case JWKThumbprintID, SPKIThumbprintID:
+		idAlphabet = base64URLAlphabet
+	default:
+		return fmt.Errorf("hsson/ring: unsupported IDStrategy %q", o.IDStrategy)
+	}
+	return o.IDPrefixes.validate(idAlphabet)
+}
+
+// validateIDEntropy checks that random IDs of length characters from
+// alphabet are unlikely to conflict
+func validateIDEntropy(alphabet string, length int) error {
+	if length < 0 {
+		return errors.New("hsson/ring: IDLength must be > 0")
+	}
+	unique := make(map[rune]bool)
+	for _, c := range alphabet {
+		unique[c] = true
+	}
+	if len(unique) < 2 {
+		return errors.New("hsson/ring: IDAlphabet must have at least 2 distinct characters")
+	}
+	if bits := float64(length) * math.Log2(float64(len(unique))); bits < minIDEntropy {
+		return fmt.Errorf("hsson/ring: IDAlphabet and IDLength give %.1f bits of entropy, must be >= %d", bits, minIDEntropy)
+	}
+	return nil
+}
+
+// expired reports if a key expiring at expiresAt has expired at now, allowing
+// for ClockSkewTolerance
+func (o Options) expired(expiresAt, now time.Time) bool {
+	return now.After(expiresAt.Add(o.ClockSkewTolerance))
+}
@@ -0,0 +1,82 @@
+package ring
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned by ListVerifiersPage for cursors it did not
+// return itself
+var ErrInvalidCursor = errors.New("hsson/ring: invalid cursor")
+
+// sortVerifiers sorts keys by ExpiresAt, then by ID
+func sortVerifiers(keys []*VerifierKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].ExpiresAt.Equal(keys[j].ExpiresAt) {
+			return keys[i].ExpiresAt.Before(keys[j].ExpiresAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
+
+// verifierCursor returns the cursor of the page following key
+func verifierCursor(key *VerifierKey) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(key.ExpiresAt.UnixNano(), 10) + " " + key.ID))
+}
+
+// after reports if key is ordered after the key of cursor
+func after(key *VerifierKey, expiresAt time.Time, id string) bool {
+	if !key.ExpiresAt.Equal(expiresAt) {
+		return key.ExpiresAt.After(expiresAt)
+	}
+	return key.ID > id
+}
+
+func parseVerifierCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(data), " ", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return time.Unix(0, nanos), parts[1], nil
+}
+
+func (v *verifier) ListVerifiersPage(cursor string, limit int) ([]*VerifierKey, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("hsson/ring: limit must be > 0")
+	}
+	var expiresAt time.Time
+	var id string
+	if cursor != "" {
+		var err error
+		if expiresAt, id, err = parseVerifierCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	keys, err := v.ListVerifiersContext(context.Background())
+	if err != nil {
+		return nil, "", err
+	}
+	if cursor != "" {
+		i := sort.Search(len(keys), func(i int) bool {
+			return after(keys[i], expiresAt, id)
+		})
+		keys = keys[i:]
+	}
+	if len(keys) <= limit {
+		return keys, "", nil
+	}
+	return keys[:limit], verifierCursor(keys[limit-1]), nil
+}
@@ -0,0 +1,113 @@
+package ring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidPEM is returned when parsing PEM data which does not hold a
+// supported key
+var ErrInvalidPEM = errors.New("hsson/ring: invalid PEM data")
+
+// EncodeToPEM encodes the verifier public key in PEM format
+func (vk *VerifierKey) EncodeToPEM() ([]byte, error) {
+	bytes, err := x509.MarshalPKIXPublicKey(vk.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: bytes,
+	}), nil
+}
+
+// EncodeToPEM encodes the signing private key in PKCS #8 PEM format
+func (sk *SigningKey) EncodeToPEM() ([]byte, error) {
+	bytes, err := x509.MarshalPKCS8PrivateKey(sk.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: bytes,
+	}), nil
+}
+
+// VerifierKeyFromPEM parses the first public key or certificate in data.
+// PEM carries no key ID or expiry, so those are left for the caller to set.
+func VerifierKeyFromPEM(data []byte) (*VerifierKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	var untyped interface{}
+	var cert *x509.Certificate
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		untyped, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		untyped, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			untyped = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("%w: unexpected block %q", ErrInvalidPEM, block.Type)
+	}
+	if err != nil {
+		return nil, &causeError{kind: ErrInvalidPEM, cause: err}
+	}
+	switch pub := untyped.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		algorithm, _ := keyAlgorithm(pub)
+		return &VerifierKey{Key: pub, Certificate: cert, Algorithm: algorithm, SignatureAlgorithm: DefaultSignatureAlgorithm(pub)}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPEM, pub)
+	}
+}
+
+// SigningKeyFromPEM parses the first private key in data, in PKCS #8,
+// PKCS #1 or SEC 1 format. PEM carries no key ID or rotation times, so those
+// are left for the caller to set.
+func SigningKeyFromPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	var untyped interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		untyped, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		untyped, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		untyped, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unexpected block %q", ErrInvalidPEM, block.Type)
+	}
+	if err != nil {
+		return nil, &causeError{kind: ErrInvalidPEM, cause: err}
+	}
+	var key crypto.Signer
+	switch priv := untyped.(type) {
+	case *rsa.PrivateKey:
+		key = priv
+	case *ecdsa.PrivateKey:
+		key = priv
+	case ed25519.PrivateKey:
+		key = priv
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPEM, priv)
+	}
+	algorithm, _ := keyAlgorithm(key.Public())
+	return &SigningKey{Key: key, Algorithm: algorithm, SignatureAlgorithm: DefaultSignatureAlgorithm(key.Public())}, nil
+}
@@ -0,0 +1,208 @@
+// Package pkcs11 implements a ring.KeyGenerator which creates and uses keys
+// on a PKCS #11 token, such as a hardware security module. Private keys
+// never leave the token: the keychain only stores the ID of each key on the
+// token, next to its public key.
+//
+// The token is accessed through the pkcs11-tool command of OpenSC, which
+// must be installed, and the PKCS #11 module of the token. The PIN is
+// passed to pkcs11-tool in the environment, using --pin env:NAME, so it
+// never shows up in the process list. As a pkcs11-tool process is started
+// for every signature, signing is limited to a few dozen signatures per
+// second, far fewer than the token itself may manage. For example, using
+// SoftHSM:
+//
+//	keychain, err := ring.NewKeychain(s, ring.Options{
+//		Algorithm: ring.ECDSAP256,
+//		KeyGenerator: pkcs11.New(pkcs11.Config{
+//			Module:     "/usr/lib/softhsm/libsofthsm2.so",
+//			TokenLabel: "ring",
+//			PIN:        pin,
+//		}),
+//	})
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/hsson/ring"
+)
+
+// ErrUnsupportedAlgorithm is returned when generating a key of an
+// algorithm the backend does not support, such as Ed25519.
+var ErrUnsupportedAlgorithm = errors.New("hsson/ring/pkcs11: unsupported algorithm")
+
+// Config configures how the token is accessed
+type Config struct {
+	// Module is the path of the PKCS #11 module of the token
+	Module string
+	// TokenLabel is the label of the token holding the keys
+	TokenLabel string
+	// PIN is the user PIN of the token
+	PIN string
+	// LabelPrefix is prepended to the hex encoded ID of new keys to form
+	// their label on the token. Default: hsson-ring-
+	LabelPrefix string
+	// Tool is the path of the pkcs11-tool command. Default: pkcs11-tool,
+	// looked up in PATH
+	Tool string
+}
+
+// token is the PKCS #11 token holding the keys, identified by their
+// CKA_ID
+type token interface {
+	// generateKeyPair creates a key pair of the given pkcs11-tool key type
+	generateKeyPair(id, label, keyType string) error
+	// publicKey returns the DER encoded SubjectPublicKeyInfo of a key
+	publicKey(id string) ([]byte, error)
+	// sign signs data with the private key using mechanism, returning the
+	// signature as produced by the token
+	sign(id string, mechanism mechanism, data []byte) ([]byte, error)
+}
+
+// mechanism is a PKCS #11 signing mechanism, with the parameters used by
+// RSA-PSS
+type mechanism struct {
+	// Name is the name of the mechanism for pkcs11-tool
+	Name string
+	// Hash and SaltLength are set for RSA-PKCS-PSS
+	Hash       crypto.Hash
+	SaltLength int
+}
+
+// New creates a ring.KeyGenerator creating RSA and ECDSA keys on a PKCS #11
+// token
+func New(config Config) ring.KeyGenerator {
+	if config.LabelPrefix == "" {
+		config.LabelPrefix = "hsson-ring-"
+	}
+	if config.Tool == "" {
+		config.Tool = "pkcs11-tool"
+	}
+	return &generator{config: config, token: &toolToken{config: config}}
+}
+
+type generator struct {
+	config Config
+	token  token
+}
+
+func keyType(algorithm ring.Algorithm, size int) (string, error) {
+	switch algorithm {
+	case ring.RSA:
+		return fmt.Sprintf("rsa:%d", size), nil
+	case ring.ECDSAP256:
+		return "EC:prime256v1", nil
+	case ring.ECDSAP384:
+		return "EC:secp384r1", nil
+	case ring.ECDSAP521:
+		return "EC:secp521r1", nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnsupportedAlgorithm, algorithm)
+}
+
+func (g *generator) GenerateKey(algorithm ring.Algorithm, size int) (crypto.Signer, []byte, error) {
+	typ, err := keyType(algorithm, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	idBytes := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, idBytes); err != nil {
+		return nil, nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	if err := g.token.generateKeyPair(id, g.config.LabelPrefix+id, typ); err != nil {
+		return nil, nil, err
+	}
+	signer, err := g.LoadKey([]byte(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, []byte(id), nil
+}
+
+func (g *generator) LoadKey(ref []byte) (crypto.Signer, error) {
+	id := string(ref)
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, errors.New("hsson/ring/pkcs11: invalid key reference")
+	}
+	der, err := g.token.publicKey(id)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("hsson/ring/pkcs11: invalid public key: %w", err)
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("hsson/ring/pkcs11: unsupported key type %T", pub)
+	}
+	return &signer{token: g.token, id: id, pub: pub}, nil
+}
+
+// signer signs with a private key on the token
+type signer struct {
+	token token
+	id    string
+	pub   crypto.PublicKey
+}
+
+func (s *signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	switch pub := s.pub.(type) {
+	case *ecdsa.PublicKey:
+		// The token returns the concatenation of R and S, while
+		// crypto.Signer returns ASN.1
+		sig, err := s.token.sign(s.id, mechanism{Name: "ECDSA"}, digest)
+		if err != nil {
+			return nil, err
+		}
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return nil, errors.New("hsson/ring/pkcs11: invalid ECDSA signature")
+		}
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{new(big.Int).SetBytes(sig[:len(sig)/2]), new(big.Int).SetBytes(sig[len(sig)/2:])})
+	case *rsa.PublicKey:
+		hash := opts.HashFunc()
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			saltLength := pss.SaltLength
+			if saltLength <= 0 {
+				// Tokens need an explicit length, where the hash size is
+				// what verifiers expect by default
+				saltLength = hash.Size()
+			}
+			return s.token.sign(s.id, mechanism{Name: "RSA-PKCS-PSS", Hash: hash, SaltLength: saltLength}, digest)
+		}
+		// RSA-PKCS signs a DigestInfo, which is built here
+		prefix, ok := digestInfoPrefixes[hash]
+		if !ok {
+			return nil, fmt.Errorf("hsson/ring/pkcs11: unsupported hash %v", hash)
+		}
+		return s.token.sign(s.id, mechanism{Name: "RSA-PKCS"}, append(append([]byte{}, prefix...), digest...))
+	default:
+		return nil, fmt.Errorf("hsson/ring/pkcs11: unsupported key type %T", pub)
+	}
+}
+
+// digestInfoPrefixes are the DER encoded DigestInfo headers of PKCS #1
+// v1.5 signatures, which precede the digest
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
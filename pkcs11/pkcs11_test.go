@@ -0,0 +1,177 @@
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store/inmem"
+)
+
+// fakeToken keeps keys in memory and signs like a PKCS #11 token
+type fakeToken struct {
+	keys map[string]crypto.Signer
+}
+
+func (t *fakeToken) generateKeyPair(id, label, keyType string) error {
+	var key crypto.Signer
+	var err error
+	switch {
+	case keyType == "EC:prime256v1":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case strings.HasPrefix(keyType, "rsa:"):
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return errors.New("unsupported key type " + keyType)
+	}
+	if err != nil {
+		return err
+	}
+	t.keys[id] = key
+	return nil
+}
+
+func (t *fakeToken) publicKey(id string) ([]byte, error) {
+	key, ok := t.keys[id]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return x509.MarshalPKIXPublicKey(key.Public())
+}
+
+func (t *fakeToken) sign(id string, m mechanism, data []byte) ([]byte, error) {
+	switch key := t.keys[id].(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, data)
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+		return sig, nil
+	case *rsa.PrivateKey:
+		if m.Name == "RSA-PKCS-PSS" {
+			return rsa.SignPSS(rand.Reader, key, m.Hash, data, &rsa.PSSOptions{SaltLength: m.SaltLength})
+		}
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.Hash(0), data)
+	}
+	return nil, errors.New("no such key")
+}
+
+func newFakeGenerator() *generator {
+	return &generator{config: Config{LabelPrefix: "test-"}, token: &fakeToken{keys: make(map[string]crypto.Signer)}}
+}
+
+func TestKeychain(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.ECDSAP256, ring.RSA} {
+		generator := newFakeGenerator()
+		s := inmem.NewInMemoryStore()
+		options := ring.Options{Algorithm: algorithm, KeyGenerator: generator}
+		keychain, err := ring.NewKeychain(s, options)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		signature, keyID, err := keychain.Sign([]byte("data"))
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+			t.Errorf("%s: expected valid signature, got %v", algorithm, err)
+		}
+
+		// The key is loaded from the token by other instances
+		other, err := ring.NewKeychain(s, options)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if _, otherID, err := other.Sign([]byte("data")); err != nil || otherID != keyID {
+			t.Errorf("%s: expected signing with key %v, got %v, %v", algorithm, keyID, otherID, err)
+		}
+	}
+}
+
+func TestPKCS1v15(t *testing.T) {
+	generator := newFakeGenerator()
+	signer, _, err := generator.GenerateKey(ring.RSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(signer.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	if _, _, err := newFakeGenerator().GenerateKey(ring.Ed25519, 0); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+	if _, err := newFakeGenerator().LoadKey([]byte("not hex")); err == nil {
+		t.Error("expected invalid reference to fail")
+	}
+}
+
+// TestSoftHSM runs against a real token when PKCS11_MODULE is set, e.g.
+// after initializing SoftHSM with
+//
+//	softhsm2-util --init-token --free --label ring --pin 1234 --so-pin 1234
+func TestToolKeepsPINOutOfArgs(t *testing.T) {
+	token := &toolToken{config: Config{Tool: "pkcs11-tool", PIN: "123456"}}
+	cmd := token.command(nil, "--sign")
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, "123456") {
+			t.Errorf("expected the PIN not to be passed as argument, got %q", cmd.Args)
+		}
+	}
+	found := false
+	for _, env := range cmd.Env {
+		found = found || env == pinEnv+"=123456"
+	}
+	if !found {
+		t.Error("expected the PIN to be passed in the environment")
+	}
+}
+
+func TestSoftHSM(t *testing.T) {
+	module := os.Getenv("PKCS11_MODULE")
+	if module == "" {
+		t.Skip("PKCS11_MODULE is not set")
+	}
+	if _, err := exec.LookPath("pkcs11-tool"); err != nil {
+		t.Skip("pkcs11-tool is not installed")
+	}
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm: ring.ECDSAP256,
+		KeyGenerator: New(Config{
+			Module:     module,
+			TokenLabel: "ring",
+			PIN:        "1234",
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// toolToken accesses the token through the pkcs11-tool command of OpenSC
+type toolToken struct {
+	config Config
+}
+
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// pinEnv is the environment variable passing the PIN to pkcs11-tool
+const pinEnv = "RING_PKCS11_PIN"
+
+// command returns the pkcs11-tool command, logged in to the token, with
+// args and stdin. The PIN would be visible to other users in the process
+// list if passed as an argument, so it is read from the environment.
+func (t *toolToken) command(stdin []byte, args ...string) *exec.Cmd {
+	args = append([]string{
+		"--module", t.config.Module,
+		"--token-label", t.config.TokenLabel,
+		"--login", "--pin", "env:" + pinEnv,
+	}, args...)
+	cmd := exec.Command(t.config.Tool, args...)
+	cmd.Env = append(os.Environ(), pinEnv+"="+t.config.PIN)
+	cmd.Stdin = bytes.NewReader(stdin)
+	return cmd
+}
+
+// run runs pkcs11-tool with args and stdin, returning its output
+func (t *toolToken) run(stdin []byte, args ...string) ([]byte, error) {
+	cmd := t.command(stdin, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("hsson/ring/pkcs11: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+func (t *toolToken) generateKeyPair(id, label, keyType string) error {
+	_, err := t.run(nil, "--keypairgen", "--key-type", keyType, "--id", id, "--label", label, "--usage-sign")
+	return err
+}
+
+func (t *toolToken) publicKey(id string) ([]byte, error) {
+	return t.run(nil, "--read-object", "--type", "pubkey", "--id", id)
+}
+
+func (t *toolToken) sign(id string, m mechanism, data []byte) ([]byte, error) {
+	args := []string{"--sign", "--id", id, "--mechanism", m.Name}
+	if m.Hash != 0 {
+		name, ok := hashNames[m.Hash]
+		if !ok {
+			return nil, fmt.Errorf("hsson/ring/pkcs11: unsupported hash %v", m.Hash)
+		}
+		args = append(args, "--hash-algorithm", name, "--mgf", "MGF1-"+name, "--salt-len", strconv.Itoa(m.SaltLength))
+	}
+	return t.run(data, args...)
+}
@@ -0,0 +1,145 @@
+package ring
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrKeyPolicy is returned for keys not allowed by Options.MinKeySize,
+// Options.AllowedKeySizes, Options.RSAPublicExponent,
+// Options.AllowedAlgorithms or Options.FIPS
+var ErrKeyPolicy = errors.New("hsson/ring: key violates key policy")
+
+// algorithmAllowed reports if keys of algorithm may be used
+func (o Options) algorithmAllowed(algorithm Algorithm) bool {
+	if len(o.AllowedAlgorithms) == 0 {
+		return true
+	}
+	for _, allowed := range o.AllowedAlgorithms {
+		if allowed == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeyPolicy checks that pub is allowed by the key policy
+func (o Options) checkKeyPolicy(pub crypto.PublicKey) error {
+	algorithm, size := keyAlgorithm(pub)
+	if err := o.checkAlgorithmPolicy(algorithm, size); err != nil {
+		return err
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil
+	}
+	if o.RSAPublicExponent != 0 && key.E != o.RSAPublicExponent {
+		return fmt.Errorf("%w: RSA key has public exponent %d, not %d", ErrKeyPolicy, key.E, o.RSAPublicExponent)
+	}
+	if o.FIPS && key.E < minFIPSRSAPublicExponent {
+		return fmt.Errorf("%w: RSA key has public exponent %d, not approved by FIPS 186", ErrKeyPolicy, key.E)
+	}
+	return nil
+}
+
+// minKeySize is the smallest size in bits of allowed RSA keys
+func (o Options) minKeySize() int {
+	if o.FIPS && o.MinKeySize < minRSAKeySize {
+		return minRSAKeySize
+	}
+	return o.MinKeySize
+}
+
+// keySizeAllowed reports if RSA keys of size bits may be used
+func (o Options) keySizeAllowed(size int) bool {
+	if len(o.AllowedKeySizes) == 0 {
+		return true
+	}
+	for _, allowed := range o.AllowedKeySizes {
+		if allowed == size {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) checkAlgorithmPolicy(algorithm Algorithm, size int) error {
+	if !o.algorithmAllowed(algorithm) || (o.FIPS && !fipsAlgorithm(algorithm)) {
+		return fmt.Errorf("%w: algorithm %q is not allowed", ErrKeyPolicy, algorithm)
+	}
+	if algorithm == RSA && size < o.minKeySize() {
+		return fmt.Errorf("%w: RSA key of %d bits is smaller than %d bits", ErrKeyPolicy, size, o.minKeySize())
+	}
+	if algorithm == RSA && !o.keySizeAllowed(size) {
+		return fmt.Errorf("%w: RSA key size of %d bits is not allowed", ErrKeyPolicy, size)
+	}
+	return nil
+}
+
+// storedKeyAllowed reports if the metadata of a stored key shows it to be
+// allowed by the key policy. Keys without metadata are checked once parsed.
+func (o Options) storedKeyAllowed(key store.Key) bool {
+	algorithm := Algorithm(key.Metadata[MetadataAlgorithm])
+	if algorithm == "" {
+		return true
+	}
+	size, _ := strconv.Atoi(key.Metadata[MetadataKeySize])
+	return o.checkAlgorithmPolicy(algorithm, size) == nil
+}
+
+// ErrKeyMismatch is returned with KeyMismatchError for stored signing keys
+// whose algorithm or size differs from Options.Algorithm or Options.KeySize
+var ErrKeyMismatch = errors.New("hsson/ring: stored key does not match options")
+
+// KeyMismatchPolicy is what to do with stored signing keys whose algorithm
+// or size differs from the options, see Options.KeyMismatch
+type KeyMismatchPolicy string
+
+const (
+	// KeyMismatchReuse signs with such keys until they are rotated
+	KeyMismatchReuse KeyMismatchPolicy = "reuse"
+	// KeyMismatchRotate creates a new signing key instead, while the
+	// verifier keys of such keys remain until they expire
+	KeyMismatchRotate KeyMismatchPolicy = "rotate"
+	// KeyMismatchError fails with ErrKeyMismatch instead
+	KeyMismatchError KeyMismatchPolicy = "error"
+)
+
+// keyMatches reports if the metadata of a stored private key shows it to
+// have the algorithm and size of new keys. Keys without metadata match.
+func (o Options) keyMatches(key store.Key) bool {
+	algorithm := Algorithm(key.Metadata[MetadataAlgorithm])
+	if algorithm == "" {
+		return true
+	}
+	if algorithm != o.Algorithm {
+		return false
+	}
+	// Keys of GenerateKey may have any size
+	return algorithm != RSA || o.GenerateKey != nil || key.Metadata[MetadataKeySize] == strconv.Itoa(o.KeySize)
+}
+
+// reusablePrivateKeys returns the keys which may be signed with according
+// to Options.KeyMismatch, failing with ErrKeyMismatch for KeyMismatchError
+func (o Options) reusablePrivateKeys(keys store.KeyList) (store.KeyList, error) {
+	if o.KeyMismatch == "" || o.KeyMismatch == KeyMismatchReuse {
+		return keys, nil
+	}
+	var reusable store.KeyList
+	for _, key := range keys {
+		if o.keyMatches(key) {
+			reusable = append(reusable, key)
+			continue
+		}
+		if o.KeyMismatch == KeyMismatchError {
+			return nil, fmt.Errorf("%w: key %s is %s of %s bits, not %s of %d bits", ErrKeyMismatch, key.ID,
+				key.Metadata[MetadataAlgorithm], key.Metadata[MetadataKeySize], o.Algorithm, o.KeySize)
+		}
+	}
+	return reusable, nil
+}
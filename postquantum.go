@@ -0,0 +1,196 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"strings"
+
+	"github.com/hsson/ring/store"
+)
+
+// PostQuantumAlgorithm is a post-quantum signature algorithm, see
+// Options.PostQuantum
+type PostQuantumAlgorithm string
+
+// Post-quantum algorithms of FIPS 204
+const (
+	MLDSA44 PostQuantumAlgorithm = "ML-DSA-44"
+	MLDSA65 PostQuantumAlgorithm = "ML-DSA-65"
+	MLDSA87 PostQuantumAlgorithm = "ML-DSA-87"
+)
+
+// ErrPostQuantumUnavailable is returned for Options.PostQuantum if this
+// build has no implementation of the algorithm, which requires Go 1.27
+var ErrPostQuantumUnavailable = errors.New("hsson/ring: post-quantum algorithm unavailable")
+
+// PostQuantumKeySuffix is appended to the ID of a keypair to form the ID of
+// the post-quantum key paired with it
+const PostQuantumKeySuffix = ".pq"
+
+// postQuantumKeyIDPrefix prefixes the private post-quantum keys in the
+// store, like the secrets of a SecretKeychain, while their public keys are
+// prefixed by IDPrefixes.PostQuantum
+const postQuantumKeyIDPrefix = "pqkey:"
+
+// PostQuantumKeyID returns the ID of the post-quantum key paired with the
+// keypair id
+func PostQuantumKeyID(id string) string {
+	return id + PostQuantumKeySuffix
+}
+
+// PostQuantumKey is the public post-quantum key published alongside a
+// verifier key, see Options.PostQuantum
+type PostQuantumKey struct {
+	// ID is PostQuantumKeyID of the ID of the verifier key
+	ID        string
+	Algorithm PostQuantumAlgorithm
+	// Key is a *mldsa.PublicKey
+	Key crypto.PublicKey
+}
+
+// Verify checks that signature is a signature of data by the key, made by
+// the Sign method of SigningKey.PostQuantum
+func (k *PostQuantumKey) Verify(data, signature []byte) error {
+	return verifyPostQuantum(k.Key, data, signature)
+}
+
+// ToJWK converts the key into a JSON Web Key of the "AKP" key type, as
+// drafted for ML-DSA by the IETF
+func (k *PostQuantumKey) ToJWK() (JWK, error) {
+	pub, err := marshalPostQuantumPublicKey(k.Key)
+	if err != nil {
+		return JWK{}, err
+	}
+	return JWK{
+		KeyType:   "AKP",
+		KeyID:     k.ID,
+		Use:       "sig",
+		Algorithm: string(k.Algorithm),
+		Public:    encodeBase64URL(pub),
+	}, nil
+}
+
+func (o *Options) validatePostQuantum() error {
+	switch o.PostQuantum {
+	case "":
+		return nil
+	case MLDSA44, MLDSA65, MLDSA87:
+	default:
+		return errors.New("hsson/ring: unsupported PostQuantum algorithm " + string(o.PostQuantum))
+	}
+	if !postQuantumAvailable {
+		return ErrPostQuantumUnavailable
+	}
+	return nil
+}
+
+// isPostQuantumKeyID reports if id is the store ID of a private
+// post-quantum key
+func isPostQuantumKeyID(id string) bool {
+	return strings.HasPrefix(id, postQuantumKeyIDPrefix)
+}
+
+// createPostQuantumStoreKeys returns the store keys of the post-quantum
+// keypair of signingKey, generating it first if needed. The private key
+// is kept as long as privateKey, the public key as long as publicKey.
+func (r *ring) createPostQuantumStoreKeys(signingKey *SigningKey, privateKey, publicKey store.Key) ([]store.Key, error) {
+	if r.options.PostQuantum == "" {
+		return nil, nil
+	}
+	if signingKey.PostQuantum == nil {
+		key, err := generatePostQuantumKey(r.options.PostQuantum)
+		if err != nil {
+			return nil, err
+		}
+		signingKey.PostQuantum = key
+	}
+	seed, err := marshalPostQuantumPrivateKey(signingKey.PostQuantum)
+	if err != nil {
+		return nil, err
+	}
+	privateData, err := r.encodeKeyData(encodingSeed, "", seed)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := marshalPostQuantumPublicKey(signingKey.PostQuantum.Public())
+	if err != nil {
+		return nil, err
+	}
+	publicData, err := r.encodeKeyData(encodingRaw, "", pub)
+	if err != nil {
+		return nil, err
+	}
+	metadata := func(purpose string) map[string]string {
+		return map[string]string{
+			MetadataAlgorithm:  string(r.options.PostQuantum),
+			MetadataPurpose:    purpose,
+			MetadataInstanceID: r.options.InstanceID,
+		}
+	}
+	return []store.Key{{
+		ID:        postQuantumKeyIDPrefix + signingKey.ID,
+		IsPrivate: true,
+		ExpiresAt: privateKey.ExpiresAt,
+		Data:      privateData,
+		Metadata:  metadata(PurposeSigning),
+	}, {
+		ID:        postQuantumIDPrefix + signingKey.ID,
+		ExpiresAt: publicKey.ExpiresAt,
+		Data:      publicData,
+		Metadata:  metadata(PurposeVerification),
+	}}, nil
+}
+
+// loadPostQuantumKey sets the private post-quantum key of signingKey, if
+// it has one
+func (r *ring) loadPostQuantumKey(ctx context.Context, signingKey *SigningKey) error {
+	if r.options.PostQuantum == "" {
+		return nil
+	}
+	key, err := r.store.Find(ctx, postQuantumKeyIDPrefix+signingKey.ID)
+	if errors.Is(err, ErrKeyNotFound) {
+		// Created before PostQuantum was enabled
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	seed, err := r.decodeKeyData(key, encodingSeed)
+	if err != nil {
+		return err
+	}
+	signingKey.PostQuantum, err = parsePostQuantumPrivateKey(PostQuantumAlgorithm(key.Metadata[MetadataAlgorithm]), seed)
+	return err
+}
+
+// findPostQuantumKey returns the post-quantum key of the verifier key id,
+// or nil if it has none
+func (v *verifier) findPostQuantumKey(ctx context.Context, id string) (*PostQuantumKey, error) {
+	if v.options.PostQuantum == "" {
+		return nil, nil
+	}
+	key, err := v.reads.Find(ctx, postQuantumIDPrefix+id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.parsePostQuantumKey(id, key)
+}
+
+// parsePostQuantumKey parses the post-quantum key of the verifier key id
+// stored in key
+func (v *verifier) parsePostQuantumKey(id string, key store.Key) (*PostQuantumKey, error) {
+	data, err := v.decodeKeyData(key, encodingRaw)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := PostQuantumAlgorithm(key.Metadata[MetadataAlgorithm])
+	pub, err := parsePostQuantumPublicKey(algorithm, data)
+	if err != nil {
+		return nil, err
+	}
+	return &PostQuantumKey{ID: PostQuantumKeyID(id), Algorithm: algorithm, Key: pub}, nil
+}
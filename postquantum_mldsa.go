@@ -0,0 +1,72 @@
+//go:build go1.27
+// +build go1.27
+
+package ring
+
+import (
+	"crypto"
+	"crypto/mldsa"
+	"errors"
+)
+
+const postQuantumAvailable = true
+
+func mldsaParameters(algorithm PostQuantumAlgorithm) (mldsa.Parameters, error) {
+	switch algorithm {
+	case MLDSA44:
+		return mldsa.MLDSA44(), nil
+	case MLDSA65:
+		return mldsa.MLDSA65(), nil
+	case MLDSA87:
+		return mldsa.MLDSA87(), nil
+	}
+	return mldsa.Parameters{}, ErrPostQuantumUnavailable
+}
+
+func generatePostQuantumKey(algorithm PostQuantumAlgorithm) (crypto.Signer, error) {
+	params, err := mldsaParameters(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return mldsa.GenerateKey(params)
+}
+
+func marshalPostQuantumPrivateKey(key crypto.Signer) ([]byte, error) {
+	private, ok := key.(*mldsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("hsson/ring: post-quantum key is not an ML-DSA key")
+	}
+	return private.Bytes(), nil
+}
+
+func parsePostQuantumPrivateKey(algorithm PostQuantumAlgorithm, seed []byte) (crypto.Signer, error) {
+	params, err := mldsaParameters(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return mldsa.NewPrivateKey(params, seed)
+}
+
+func marshalPostQuantumPublicKey(key crypto.PublicKey) ([]byte, error) {
+	pub, ok := key.(*mldsa.PublicKey)
+	if !ok {
+		return nil, errors.New("hsson/ring: post-quantum key is not an ML-DSA key")
+	}
+	return pub.Bytes(), nil
+}
+
+func parsePostQuantumPublicKey(algorithm PostQuantumAlgorithm, data []byte) (crypto.PublicKey, error) {
+	params, err := mldsaParameters(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return mldsa.NewPublicKey(params, data)
+}
+
+func verifyPostQuantum(key crypto.PublicKey, data, signature []byte) error {
+	pub, ok := key.(*mldsa.PublicKey)
+	if !ok {
+		return errors.New("hsson/ring: post-quantum key is not an ML-DSA key")
+	}
+	return mldsa.Verify(pub, data, signature, nil)
+}
@@ -0,0 +1,32 @@
+//go:build !go1.27
+// +build !go1.27
+
+package ring
+
+import "crypto"
+
+const postQuantumAvailable = false
+
+func generatePostQuantumKey(algorithm PostQuantumAlgorithm) (crypto.Signer, error) {
+	return nil, ErrPostQuantumUnavailable
+}
+
+func marshalPostQuantumPrivateKey(key crypto.Signer) ([]byte, error) {
+	return nil, ErrPostQuantumUnavailable
+}
+
+func parsePostQuantumPrivateKey(algorithm PostQuantumAlgorithm, seed []byte) (crypto.Signer, error) {
+	return nil, ErrPostQuantumUnavailable
+}
+
+func marshalPostQuantumPublicKey(key crypto.PublicKey) ([]byte, error) {
+	return nil, ErrPostQuantumUnavailable
+}
+
+func parsePostQuantumPublicKey(algorithm PostQuantumAlgorithm, data []byte) (crypto.PublicKey, error) {
+	return nil, ErrPostQuantumUnavailable
+}
+
+func verifyPostQuantum(key crypto.PublicKey, data, signature []byte) error {
+	return ErrPostQuantumUnavailable
+}
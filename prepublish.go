@@ -0,0 +1,74 @@
+package ring
+
+import (
+	"context"
+	"fmt"
+)
+
+// prePublishing reports whether the next signing key of key should be
+// published now.
+func (r *ring) prePublishing(key *SigningKey) bool {
+	if r.options.PrePublishWindow == 0 || r.options.ReadOnly {
+		return false
+	}
+	if r.options.Clock.Now().Before(key.RotatedAt.Add(-r.options.PrePublishWindow)) {
+		return false
+	}
+	r.prePublishedMu.Lock()
+	defer r.prePublishedMu.Unlock()
+	return r.prePublishedFor != key.ID
+}
+
+// prePublishNextKey stores the key which will replace current, so its
+// verifier key is listed before any data is signed with it. Nothing is
+// stored if another instance already published the next key.
+func (r *ring) prePublishNextKey(ctx context.Context, current *SigningKey) error {
+	if err := r.store.Lock(ctx); err != nil {
+		return err
+	}
+	// The lock is released even if ctx is done
+	defer r.store.Unlock(context.Background())
+	stopRenewing := r.keepLock()
+	defer stopRenewing()
+
+	next, err := r.findNextPrivateKey(ctx, current)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		next, err = r.createNewSigningKey()
+		if err != nil {
+			return err
+		}
+		next.RotatedAt, next.VerifiableUntil = r.nextRotation(current.RotatedAt)
+
+		if err := r.storeSigningKey(ctx, next); err != nil {
+			return err
+		}
+		r.options.Logger.Info("published next signing key", "key_id", next.ID, "active_at", current.RotatedAt)
+	}
+
+	r.prePublishedMu.Lock()
+	r.prePublishedFor = current.ID
+	r.prePublishedMu.Unlock()
+	return nil
+}
+
+// findNextPrivateKey returns the stored key which replaces current, if it
+// has been published or created by another instance.
+func (r *ring) findNextPrivateKey(ctx context.Context, current *SigningKey) (*SigningKey, error) {
+	privateKeys, err := r.getReusablePrivateKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range privateKeys {
+		if key.ID != current.ID && r.privateKeyRotatedAt(key).After(current.RotatedAt) {
+			next, err := r.storedPrivateKeyToSigningKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse published key: %w", err)
+			}
+			return next, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotReady is returned by SigningKey and the operations depending on it
+// while a keychain created with Options.DeferInitialization has not loaded
+// or created its signing key yet, see WaitReady
+var ErrNotReady = errors.New("hsson/ring: keychain not ready")
+
+// readiness tracks the initialization of a keychain created with
+// Options.DeferInitialization
+type readiness struct {
+	// ready is closed once the signing key is loaded
+	ready chan struct{}
+	// initializing is held by the caller of WaitReady initializing the
+	// keychain, so concurrent callers wait for it instead
+	initializing chan struct{}
+	// start starts the background workers once the keychain is ready
+	start func() error
+}
+
+func newReadiness(start func() error) *readiness {
+	return &readiness{
+		ready:        make(chan struct{}),
+		initializing: make(chan struct{}, 1),
+		start:        start,
+	}
+}
+
+func (r *ring) WaitReady(ctx context.Context) error {
+	if r.readiness == nil {
+		return nil
+	}
+	select {
+	case <-r.readiness.ready:
+		return nil
+	case r.readiness.initializing <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", ErrNotReady, ctx.Err())
+	}
+	defer func() { <-r.readiness.initializing }()
+	select {
+	case <-r.readiness.ready:
+		// Initialized by the previous holder
+		return nil
+	default:
+	}
+
+	policy := r.options.LockRetryPolicy
+	backoff := policy.Backoff
+	var cause error
+	for {
+		err := r.initialize(ctx)
+		if err == nil {
+			break
+		}
+		// Report why the store failed rather than an attempt cut short
+		if cause == nil || ctx.Err() == nil {
+			cause = err
+		}
+		r.options.Logger.Warn("failed to initialize keychain, retrying", "error", err, "backoff", backoff)
+		timer := r.newTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &causeError{kind: ErrNotReady, cause: cause}
+		case <-timer.C():
+		}
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+	close(r.readiness.ready)
+	return r.readiness.start()
+}
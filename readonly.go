@@ -0,0 +1,72 @@
+package ring
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrReadOnly is returned by operations which would modify the store of a
+// keychain with Options.ReadOnly set
+var ErrReadOnly = errors.New("hsson/ring: keychain is read-only")
+
+// readOnlyStore rejects all operations modifying the store, including
+// taking its lock
+type readOnlyStore struct {
+	store.ContextStore
+}
+
+func (s *readOnlyStore) Add(ctx context.Context, key store.Key) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) Delete(ctx context.Context, id string) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) SecureErase(ctx context.Context, id string) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) Stats(ctx context.Context) (store.Stats, error) {
+	return store.CollectStats(ctx, s.ContextStore)
+}
+
+func (s *readOnlyStore) Lock(ctx context.Context) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) Unlock(ctx context.Context) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (store.KeyList, error) {
+	return store.ListFiltered(ctx, s.ContextStore, filter)
+}
+
+func (s *readOnlyStore) Iterate(ctx context.Context, yield func(store.Key) bool) error {
+	return store.Iterate(ctx, s.ContextStore, yield)
+}
+
+func (s *readOnlyStore) FindMany(ctx context.Context, ids []string) (store.KeyList, error) {
+	return findMany(ctx, s.ContextStore, ids)
+}
+
+// adoptStoredKey replaces the current signing key by the one stored by
+// another instance, as read-only keychains can't create keys
+func (r *ring) adoptStoredKey(ctx context.Context) (*SigningKey, error) {
+	current, ok := r.currentSigningKey.Load().(*SigningKey)
+	if !ok {
+		return nil, ErrReadOnly
+	}
+	next, err := r.findNextPrivateKey(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		return nil, ErrReadOnly
+	}
+	r.currentSigningKey.Store(next)
+	return next, nil
+}
@@ -0,0 +1,64 @@
+package ring
+
+import (
+	"context"
+
+	"github.com/hsson/ring/store"
+)
+
+// withReadReplicas returns the store serving verifier lookups, which reads
+// from the replicas if there are any
+func withReadReplicas(primary store.ContextStore, replicas []store.Store) store.ContextStore {
+	if len(replicas) == 0 {
+		return primary
+	}
+	rs := &replicaStore{ContextStore: primary}
+	for _, replica := range replicas {
+		rs.replicas = append(rs.replicas, store.WithContext(replica))
+	}
+	return rs
+}
+
+// replicaStore reads from the replicas in order, falling back to the next
+// one, and finally the primary, if a read fails or does not find all keys,
+// which may not have been replicated yet. Writes and locks use the primary.
+type replicaStore struct {
+	store.ContextStore
+	replicas []store.ContextStore
+}
+
+func (s *replicaStore) Find(ctx context.Context, id string) (store.Key, error) {
+	for _, replica := range s.replicas {
+		if key, err := replica.Find(ctx, id); err == nil {
+			return key, nil
+		}
+	}
+	return s.ContextStore.Find(ctx, id)
+}
+
+func (s *replicaStore) List(ctx context.Context) (store.KeyList, error) {
+	for _, replica := range s.replicas {
+		if keys, err := replica.List(ctx); err == nil {
+			return keys, nil
+		}
+	}
+	return s.ContextStore.List(ctx)
+}
+
+func (s *replicaStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (store.KeyList, error) {
+	for _, replica := range s.replicas {
+		if keys, err := store.ListFiltered(ctx, replica, filter); err == nil {
+			return keys, nil
+		}
+	}
+	return store.ListFiltered(ctx, s.ContextStore, filter)
+}
+
+func (s *replicaStore) FindMany(ctx context.Context, ids []string) (store.KeyList, error) {
+	for _, replica := range s.replicas {
+		if keys, err := findMany(ctx, replica, ids); err == nil && len(keys) == len(ids) {
+			return keys, nil
+		}
+	}
+	return findMany(ctx, s.ContextStore, ids)
+}
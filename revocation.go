@@ -0,0 +1,174 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// RevocationList is a signed list of revoked key IDs. It allows consumers
+// which cache verifier keys to honor revocations without having to refetch
+// the full set of keys.
+type RevocationList struct {
+	// IssuedAt is when the list was created
+	IssuedAt time.Time `json:"issued_at"`
+	// KeyIDs are the IDs of all revoked, but not yet expired, keys
+	KeyIDs []string `json:"revoked"`
+	// SignerID is the ID of the key used to sign the list
+	SignerID string `json:"kid"`
+	// Signature of the list, using the SignatureAlgorithm of the signing
+	// key
+	Signature []byte `json:"signature"`
+}
+
+func (rl *RevocationList) payload() ([]byte, error) {
+	return json.Marshal(struct {
+		IssuedAt time.Time `json:"issued_at"`
+		KeyIDs   []string  `json:"revoked"`
+		SignerID string    `json:"kid"`
+	}{rl.IssuedAt, rl.KeyIDs, rl.SignerID})
+}
+
+// Verify checks that the revocation list was signed by the given verifier
+// key.
+func (rl *RevocationList) Verify(verifier *VerifierKey) error {
+	if verifier.ID != rl.SignerID {
+		return fmt.Errorf("revocation list signed by %q, not %q", rl.SignerID, verifier.ID)
+	}
+	payload, err := rl.payload()
+	if err != nil {
+		return err
+	}
+	return verifyMessage(verifier, payload, rl.Signature)
+}
+
+func (r *ring) Revoke(id string) error {
+	ctx := context.Background()
+	publicKey, err := r.store.Find(ctx, fmt.Sprintf("%s%s", publicKeyIDPrefix, id))
+	if err != nil {
+		return err
+	}
+	if err := r.revoke(ctx, id, publicKey); err != nil {
+		return err
+	}
+
+	if current, ok := r.currentSigningKey.Load().(*SigningKey); ok && current.ID == id {
+		if _, err := r.rotateSigningKey(ctx); err != nil {
+			return &RotationError{Cause: err}
+		}
+	}
+	return nil
+}
+
+// revoke records the revocation of the keypair id, whose stored public key
+// is publicKey, and deletes the keypair. The public key is kept in the
+// revocation record until it expires, so that JWKS can flag it as revoked.
+func (r *ring) revoke(ctx context.Context, id string, publicKey store.Key) error {
+	metadata := make(map[string]string, len(publicKey.Metadata)+1)
+	for k, v := range publicKey.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataRevokedAt] = r.options.Clock.Now().UTC().Format(time.RFC3339)
+	err := r.store.Add(ctx, store.Key{
+		ID:        fmt.Sprintf("%s%s", revocationIDPrefix, id),
+		IsPrivate: false,
+		ExpiresAt: publicKey.ExpiresAt,
+		Data:      publicKey.Data,
+		Metadata:  metadata,
+	})
+	if err != nil && !errors.Is(err, store.ErrKeyIDConflict) {
+		return err
+	}
+	if err := r.addTombstone(ctx, id, TombstoneRevoked, r.options.Clock.Now()); err != nil {
+		return err
+	}
+
+	if err := store.SecureErase(ctx, r.store, id); err != nil {
+		return err
+	}
+	if err := r.store.Delete(ctx, publicKey.ID); err != nil {
+		return err
+	}
+	if err := r.store.Delete(ctx, fmt.Sprintf("%s%s", certificateIDPrefix, id)); err != nil {
+		return err
+	}
+	if r.options.PostQuantum != "" {
+		if err := store.SecureErase(ctx, r.store, postQuantumKeyIDPrefix+id); err != nil {
+			return err
+		}
+		if err := r.store.Delete(ctx, postQuantumIDPrefix+id); err != nil {
+			return err
+		}
+	}
+	r.cache.forget(id)
+	r.audit(AuditKeyRevoked, id, "")
+	r.options.Logger.Info("revoked key", "key_id", id)
+	if r.options.OnRevoke != nil {
+		r.options.OnRevoke(id)
+	}
+	return nil
+}
+
+// isRevoked reports whether the keypair id has a revocation record
+func (r *ring) isRevoked(ctx context.Context, id string) (bool, error) {
+	_, err := r.store.Find(ctx, revocationIDPrefix+id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// revokedVerifiers returns the verifier keys which have been revoked, but
+// have not yet expired
+func (r *ring) revokedVerifiers(ctx context.Context) ([]*VerifierKey, error) {
+	revocations, err := r.getNonExpiredRevocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*VerifierKey, 0, len(revocations))
+	for _, revocation := range revocations {
+		verifier, err := r.verifierFromKey(strings.TrimPrefix(revocation.ID, revocationIDPrefix), revocation, nil)
+		if err != nil {
+			// Recorded by an earlier version, without the public key
+			continue
+		}
+		res = append(res, verifier)
+	}
+	return res, nil
+}
+
+func (r *ring) RevocationList() (*RevocationList, error) {
+	ctx := context.Background()
+	revocations, err := r.getNonExpiredRevocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := r.signingKeyToSign(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := &RevocationList{
+		IssuedAt: r.options.Clock.Now().UTC(),
+		KeyIDs:   make([]string, len(revocations)),
+		SignerID: signingKey.ID,
+	}
+	for i, revocation := range revocations {
+		rl.KeyIDs[i] = strings.TrimPrefix(revocation.ID, revocationIDPrefix)
+	}
+
+	payload, err := rl.payload()
+	if err != nil {
+		return nil, err
+	}
+	rl.Signature, err = signMessage(signingKey, payload)
+	if err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
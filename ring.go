@@ -1,21 +1,26 @@
 package ring
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto"
 	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/hsson/once"
 	"github.com/hsson/ring/store"
 )
 
 const (
-	publicKeyIDPrefix = "pub:"
+	publicKeyIDPrefix   = "pub:"
+	revocationIDPrefix  = "revoked:"
+	heartbeatIDPrefix   = "heartbeat:"
+	certificateIDPrefix = "cert:"
+	tombstoneIDPrefix   = "tombstone:"
+	postQuantumIDPrefix = "pq:"
 
 	defaultIDAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	defaultIDLength   = 8
@@ -24,64 +29,224 @@ const (
 // ErrKeyNotFound is returned if trying to find a non-existing or expired key
 var ErrKeyNotFound = errors.New("hsson/ring: key not found")
 
+// ErrStoreUnavailable is matched by errors caused by the store not being
+// reachable, such as timeouts. Unlike ErrKeyNotFound it does not mean the
+// key is unknown, so e.g. a token should not be rejected as invalid; the
+// operation may instead be retried. Stores mark such failures with
+// store.Unavailable.
+var ErrStoreUnavailable = store.ErrUnavailable
+
 // ErrKeyRotation is returned if a new key could not be created as part of
 // replacing an expired signing key
 var ErrKeyRotation = errors.New("hsson/ring: could not rotate expired key")
 
+// ErrKeyGeneration is returned if a new private key could not be generated
+var ErrKeyGeneration = errors.New("hsson/ring: could not generate key")
+
+// RotationError is returned if replacing an expired or revoked signing key
+// failed. It matches ErrKeyRotation, and unwraps to the cause, so failures
+// of the store, e.g. ErrStoreUnavailable, can be told apart from failures
+// to generate the key, which match ErrKeyGeneration.
+type RotationError struct {
+	Cause error
+}
+
+func (e *RotationError) Error() string {
+	return ErrKeyRotation.Error() + ": " + e.Cause.Error()
+}
+
+func (e *RotationError) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports if target is ErrKeyRotation
+func (e *RotationError) Is(target error) bool {
+	return target == ErrKeyRotation
+}
+
+// IDConflictError is returned if no free ID could be found for a new key
+// within Options.IDConflictRetries. It wraps store.ErrKeyIDConflict.
+type IDConflictError struct {
+	// Attempts is the number of IDs tried
+	Attempts int
+}
+
+func (e *IDConflictError) Error() string {
+	return fmt.Sprintf("hsson/ring: key id conflict after %d attempts", e.Attempts)
+}
+
+func (e *IDConflictError) Unwrap() error {
+	return store.ErrKeyIDConflict
+}
+
+// ErrExtensionNotAllowed is returned if extending a verifier key would
+// violate the limits set by Options.MaxVerifierExtension
+var ErrExtensionNotAllowed = errors.New("hsson/ring: verifier extension not allowed")
+
 // SigningKey is used to sign new data. It has a corresponding
 // VerifierKey which can be used to verify that the data signed
 // is valid, identified by ID.
 type SigningKey struct {
 	// ID is a unique identifier for a keypair
 	ID string
-	// Key is the actual RSA key used for signing data
-	Key *rsa.PrivateKey
+	// Key is the actual private key used for signing data, either a
+	// *rsa.PrivateKey, *ecdsa.PrivateKey or an ed25519.PrivateKey depending
+	// on the Algorithm of the keychain, or the signer of a KeyGenerator
+	Key crypto.Signer
 	// RotatedAt is when the signing key will be rotated
 	RotatedAt time.Time
 	// VerifiableUntil is the time when the public-key equivalent of
 	// the signing key will expire, and thus any data signed with it
 	// won't be verifiable after this time.
 	VerifiableUntil time.Time
+	// CreatedAt is when the key was created. It is zero for keys stored
+	// by versions of the keychain which did not record it.
+	CreatedAt time.Time
+	// Algorithm of the key, which may differ from Options.Algorithm if it
+	// was changed, or the key was imported.
+	Algorithm Algorithm
+	// SignatureAlgorithm is the algorithm data is meant to be signed with,
+	// see Options.SignatureAlgorithm
+	SignatureAlgorithm SignatureAlgorithm
+	// PostQuantum is the post-quantum key paired with the key, if
+	// Options.PostQuantum is set. It is nil for keys created before.
+	PostQuantum crypto.Signer
+
+	// reference is set for keys held by a KeyGenerator
+	reference []byte
+	// customSchedule is set for keys created by NewKeyWithOptions
+	customSchedule bool
 }
 
 // VerifierKey is the public part only of a SigningKey
 type VerifierKey struct {
 	// ID is a unique identifier for a keypair
 	ID string
-	// Key is the actual RSA public key used for verifying data signature
-	Key *rsa.PublicKey
+	// Key is the actual public key used for verifying data signature,
+	// either a *rsa.PublicKey, *ecdsa.PublicKey or an ed25519.PublicKey
+	Key crypto.PublicKey
 	// ExpiresAt is when this verification key will no longer be usable for
 	// verifying data, as it will have been cleared from storage.
 	ExpiresAt time.Time
+	// Certificate wraps Key in an X.509 certificate, if Options.Certificates
+	// is enabled. It is nil otherwise.
+	Certificate *x509.Certificate
+	// CertificateChain holds the certificates of the issuer of Certificate,
+	// taken from Options.CertificateChain.
+	CertificateChain []*x509.Certificate
+	// CreatedAt is when the keypair was created. It is zero for keys
+	// stored by versions of the keychain which did not record it.
+	CreatedAt time.Time
+	// Algorithm of the key
+	Algorithm Algorithm
+	// SignatureAlgorithm is the algorithm data is meant to be signed with
+	// using the private half of the key
+	SignatureAlgorithm SignatureAlgorithm
+	// TenantID is set if the key was looked up by the key ID of a
+	// TenantSigner, see ForTenant
+	TenantID string
+	// PostQuantum is the post-quantum key published alongside the key, if
+	// Options.PostQuantum is set
+	PostQuantum *PostQuantumKey
 }
 
-// EncodeToPEM encodes the verifier public key in PEM format
-func (vk *VerifierKey) EncodeToPEM() []byte {
-	bytes, err := x509.MarshalPKIXPublicKey(vk.Key)
-	if err != nil {
-		panic("failed to marshal public key")
-	}
-	return pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: bytes,
-	})
-}
+// Algorithm is the type of keys generated by the keychain
+type Algorithm string
+
+const (
+	// RSA keys, with a size determined by Options.KeySize
+	RSA Algorithm = "RSA"
+	// Ed25519 keys
+	Ed25519 Algorithm = "Ed25519"
+	// ECDSAP256 is ECDSA keys using the NIST P-256 curve
+	ECDSAP256 Algorithm = "ECDSA-P256"
+	// ECDSAP384 is ECDSA keys using the NIST P-384 curve
+	ECDSAP384 Algorithm = "ECDSA-P384"
+	// ECDSAP521 is ECDSA keys using the NIST P-521 curve
+	ECDSAP521 Algorithm = "ECDSA-P521"
+)
+
+// IDStrategy determines how the IDs of new keypairs are chosen
+type IDStrategy string
+
+const (
+	// RandomID generates IDs using Options.IDAlphabet and Options.IDLength
+	RandomID IDStrategy = "random"
+	// JWKThumbprintID uses the RFC 7638 JWK thumbprint of the public key,
+	// as an unpadded base64url string
+	JWKThumbprintID IDStrategy = "jwk-thumbprint"
+	// SPKIThumbprintID uses the SHA-256 fingerprint of the PKIX encoded
+	// public key, as an unpadded base64url string
+	SPKIThumbprintID IDStrategy = "spki-thumbprint"
+)
 
 // Options can be specified to customize the behavior of the Keychain
 type Options struct {
+	// Algorithm defines the type of keys generated. Keys of other types
+	// already present in the store are still used. Default: RSA
+	Algorithm Algorithm
+
+	// SignatureAlgorithm is the algorithm new RSA keys are meant to be
+	// signed with, which is recorded with the keys and exposed on
+	// SigningKey, VerifierKey and JWKs. It must be one of the RS and PS
+	// algorithms. Other keys have a single algorithm, see
+	// DefaultSignatureAlgorithm. Default: PS256
+	SignatureAlgorithm SignatureAlgorithm
+
 	// RotationFrequency defines how long signing keys will be active
 	// before they are replaced with a new key. Default: 1 hour
 	RotationFrequency time.Duration
 
+	// RotationJitter is the largest fraction of RotationFrequency by which
+	// the rotation of a new key is brought forward at random, so instances
+	// deployed together don't all rotate at the same moment. E.g. 0.1
+	// rotates keys up to 6 minutes early with the default RotationFrequency.
+	// Must be >= 0 and < 1. Default: 0
+	RotationJitter float64
+
+	// RotationSchedule, if set, rotates signing keys at the times of a cron
+	// schedule instead of RotationFrequency after their creation, e.g.
+	// "0 3 * * *" at 03:00 every day, so all instances rotate together at
+	// a predictable time. The five fields are minute, hour, day of the
+	// month, month and day of the week, with lists, ranges, steps, names
+	// and descriptors such as @daily. Times are in UTC unless prefixed by
+	// CRON_TZ=<location>. RotationFrequency then defaults to the longest
+	// interval of the schedule, and keys stay verifiable for
+	// VerificationPeriod - RotationFrequency after their rotation. Can't be
+	// combined with RotationJitter. Default: "", no schedule
+	RotationSchedule string
+
 	// VerificationPeriod defines how long data will be able to be verified.
 	// After this time, the public key is deleted. Must be longer than
 	// RotationFrequency, preferably at least 2x RotationFrequency.
 	// Default: RotationFrequency * 2
 	VerificationPeriod time.Duration
 
-	// KeySize defines the size in bits of the generated keys. Default: 2048
+	// KeyGenerator, if set, creates the signing keys instead of the
+	// keychain, e.g. inside an HSM or KMS, and only references to the
+	// private keys are stored. Verifier-only instances don't need it.
+	// Can't be combined with LegacyStorageFormat. Default: nil
+	KeyGenerator KeyGenerator
+
+	// GenerateKey, if set, creates new private keys in place of the
+	// standard library, e.g. handing out precomputed or small RSA keys to
+	// keep tests fast. Unlike keys of a KeyGenerator, its keys are stored
+	// like any other. KeySize is not passed on, and the keys must still be
+	// allowed by the key policy. Can't be combined with KeyGenerator.
+	// Default: nil
+	GenerateKey func() (crypto.Signer, error)
+
+	// KeySize defines the size in bits of generated RSA keys. Default: 2048
 	KeySize int
 
+	// Rand, if set, is the source of randomness for generating keys, key
+	// IDs, the InstanceID and RotationJitter, e.g. a seeded reader to reproduce a bug
+	// report or run a fuzzing harness deterministically. Ed25519 keys and
+	// IDs are then fully reproducible, while RSA and ECDSA key generation
+	// of the standard library may still vary between runs. Never set it
+	// in production. Default: crypto/rand.Reader
+	Rand io.Reader
+
 	// IDAlphabet defines which characters are used to generate keypair IDs.
 	// Does NOT support regex syntax, you must specify all characters.
 	// Default: a...zA...Z
@@ -89,30 +254,603 @@ type Options struct {
 
 	// IDLength determines the length of keypair IDs. Default: 8
 	IDLength int
+
+	// IDStrategy determines how keypair IDs are chosen. IDAlphabet and
+	// IDLength are only used by RandomID. Default: RandomID
+	IDStrategy IDStrategy
+
+	// MaxVerifierExtension limits how far into the future ExtendVerifier
+	// may push the expiry of a verifier key, counted from the time of the
+	// extension. Default: VerificationPeriod
+	MaxVerifierExtension time.Duration
+
+	// InstanceID identifies this keychain instance in heartbeat records
+	// used for drift detection. Default: random ID
+	InstanceID string
+
+	// DriftThreshold, if set, makes the worker of AutoRotate check for
+	// instances drifting for longer than the threshold whenever it refreshes
+	// the heartbeat of this instance, reporting them to OnDrift, the Logger
+	// and the MetricsCollector if it implements DriftCollector. Default: 0,
+	// drift is only detected by calling DetectDrift
+	DriftThreshold time.Duration
+
+	// OnDrift, if set, is called with every drifting instance found by the
+	// worker, see DriftThreshold.
+	OnDrift func(drift Drift)
+
+	// Clock is used to tell the current time, and to create timers if it
+	// implements TimerClock. Default: the system clock
+	Clock Clock
+
+	// AutoRotate starts a background worker when the keychain is created,
+	// which rotates signing keys as soon as they expire and generates the
+	// next key ahead of time. Stop it with Close. Default: false
+	AutoRotate bool
+
+	// DeferInitialization creates the keychain without loading or creating
+	// its signing key, which is instead done by WaitReady, retrying failures
+	// of the store until its context is done. Until then SigningKey returns
+	// ErrNotReady and Healthy reports the keychain as unhealthy, so e.g. a
+	// readiness probe can wait for the store instead of the process failing
+	// on start. Background workers are started once ready. Default: false
+	DeferInitialization bool
+
+	// MaxSignaturesPerKey rotates the signing key early once it has made
+	// this many signatures, to bound the exposure of each key as required
+	// by some crypto policies. Signatures made by Sign, RevocationList, a
+	// TenantSigner, a ShardedKeychain, a StreamSigner, a SignatureService
+	// (and so package agent), jose.Sign and tlscert are counted, but not
+	// those made with keys handed out by SigningKey, see SigningKeyToSign.
+	// Default: 0, no limit
+	MaxSignaturesPerKey int
+
+	// SignatureCounter counts the signatures made with each key. Default:
+	// the signatures of this instance are counted in memory
+	SignatureCounter SignatureCounter
+
+	// PregenerateKeys is how many private keys are generated in the
+	// background and kept ready for rotations, so they don't wait for slow
+	// key generation such as of large RSA keys. The pool is stopped by
+	// Close. Default: 0, only AutoRotate generates the next key ahead
+	PregenerateKeys int
+
+	// PrePublishWindow defines how long before a rotation the next signing
+	// key is generated and its verifier key published, so consumers caching
+	// the verifier keys know about it before it is used. Must be shorter
+	// than RotationFrequency. Default: 0, keys are published on rotation
+	PrePublishWindow time.Duration
+
+	// SigningGracePeriod defines how long a rotated private key is kept
+	// after its rotation. Within the period the previous key is still
+	// returned by SigningKey if the rotation fails, e.g. because another
+	// instance is rotating at the same time. Must be at most
+	// VerificationPeriod - RotationFrequency. Default: 0
+	SigningGracePeriod time.Duration
+
+	// ClockSkewTolerance is how far the clocks of instances sharing a store
+	// may differ. A signing key is only rotated once it is this long past
+	// its RotatedAt, and keys are only treated as expired once this long
+	// past their ExpiresAt, so an instance whose clock runs ahead neither
+	// rotates before the others nor misses verifiers they still use.
+	// Default: 0
+	ClockSkewTolerance time.Duration
+
+	// ReadOnly prevents the keychain from ever modifying the store, e.g.
+	// for canary deployments pointed at production stores. It fails to
+	// initialize unless the store holds a signing key, and only adopts
+	// signing keys created by other instances. Rotate and all other
+	// operations modifying the store return ErrReadOnly. Default: false
+	ReadOnly bool
+
+	// StagedRotation makes Rotate stage the next signing key instead of
+	// switching to it. The verifier key of the staged key is published
+	// right away, but it only becomes the signing key when Promote is
+	// called, after PromotionDelay or at the scheduled rotation of the
+	// current key, giving time to confirm relying parties have fetched
+	// it. Default: false
+	StagedRotation bool
+
+	// PromotionDelay is how long after its creation a staged key is
+	// promoted automatically. Requires StagedRotation. Default: 0, staged
+	// keys wait for Promote
+	PromotionDelay time.Duration
+
+	// RotationLockWait defines how long a rotation waits for the signing
+	// key of another instance holding the store lock, instead of failing
+	// right away. The store is polled with the backoff of LockRetryPolicy,
+	// and the new key is used once found. Default: 0, no waiting
+	RotationLockWait time.Duration
+
+	// StoreTimeout bounds every store operation of the keychain, e.g. of a
+	// rotation in the request path of SigningKey, so a slow store fails
+	// with an error matching ErrStoreUnavailable instead of hanging. Within
+	// SigningGracePeriod SigningKey then keeps returning the current key.
+	// Only stores with support for contexts can be interrupted, see
+	// store.ContextStore. Default: 0, no timeout
+	StoreTimeout time.Duration
+
+	// HealthRotationThreshold is how long the current signing key may be
+	// past its RotatedAt before Healthy reports the keychain as unhealthy.
+	// Default: RotationFrequency
+	HealthRotationThreshold time.Duration
+
+	// RetainSigningKeys is how many previous signing keys are kept in the
+	// store, in addition to the SigningGracePeriod, so they can still be
+	// looked up with GetSigningKey after being rotated. The retained keys
+	// must remain verifiable, so SigningGracePeriod + RetainSigningKeys *
+	// RotationFrequency must be at most VerificationPeriod -
+	// RotationFrequency. Default: 0
+	RetainSigningKeys int
+
+	// Encryptor, if set, encrypts private keys before they are persisted
+	// and decrypts them when loaded. Private keys stored unencrypted by
+	// earlier versions, or with LegacyStorageFormat, can not be loaded
+	// once set. See package crypt for implementations. Default: nil, keys
+	// are stored unencrypted
+	Encryptor Encryptor
+
+	// LegacyStorageFormat stores keys as plain DER, without the versioned
+	// envelope describing their encoding and encryption. It lets instances
+	// of earlier versions read keys created by this one during a rolling
+	// upgrade. Keys in either format are always readable. Default: false
+	LegacyStorageFormat bool
+
+	// Codec serializes the private and public keys in the store, e.g. to
+	// encrypt PKCS #8 or use a proprietary envelope. All instances sharing
+	// a store must use the same Codec. Default: DefaultCodec
+	Codec Codec
+
+	// KeyDataEncoding is how the data of stored keys is encoded: KeyDataPEM
+	// suits stores inspected by humans, e.g. files or SQL text columns,
+	// while KeyDataDER keeps the data compact, e.g. in Redis. The DER of
+	// keys is mostly random, so KeyDataCompressed mainly shrinks
+	// certificates. The encoding is recorded in MetadataDataEncoding, and
+	// keys of any encoding are always readable. Can't be combined with
+	// LegacyStorageFormat. Default: KeyDataDER
+	KeyDataEncoding KeyDataEncoding
+
+	// TombstoneTTL, if set, keeps a tombstone of revoked and expired
+	// verifier keys for this long, so that GetVerifier can tell keys which
+	// were valid, with a TombstoneError, from keys which never existed,
+	// e.g. forgeries. Expired keys only get a tombstone while still in the
+	// store, or when deleted by the cleanup, and not when stores expire
+	// them natively. Default: 0, no tombstones
+	TombstoneTTL time.Duration
+
+	// StaticVerifiers are pinned verifier keys, returned by GetVerifier and
+	// ListVerifiers in addition to the keys in the store, e.g. a known-good
+	// key during a store outage, or the static key of a legacy deployment
+	// while migrating. They take precedence over stored keys of the same
+	// ID, and keys without ExpiresAt never expire. Default: nil
+	StaticVerifiers []VerifierKey
+
+	// VerifierCacheTTL enables caching of GetVerifier lookups, and defines
+	// for how long a cached verifier key is used before it is looked up
+	// again. Cached keys are never used past their expiry, but changes
+	// made by other instances, e.g. revocations, are only seen once the
+	// cached entry expires. Default: 0, no caching
+	VerifierCacheTTL time.Duration
+
+	// VerifierNegativeCacheTTL defines for how long lookups of unknown
+	// IDs are cached, when VerifierCacheTTL is set. Default: 0, unknown
+	// IDs are not cached
+	VerifierNegativeCacheTTL time.Duration
+
+	// VerifierCacheSize limits how many lookups are cached. Default: 1024
+	VerifierCacheSize int
+
+	// CircuitBreaker stops GetVerifier from reaching the store after it
+	// failed repeatedly, so lookups fail fast with ErrCircuitOpen instead of
+	// each waiting for the store. While the store is unavailable, verifier
+	// keys cached according to VerifierCacheTTL are used past their TTL,
+	// but never past their expiry. Default: disabled
+	CircuitBreaker CircuitBreakerPolicy
+
+	// ReadReplicas serve the lookups of verifier keys, e.g. from replicas
+	// of a Redis primary for high-QPS token validation, while rotations,
+	// locks and all writes use the store. Replicas are tried in order,
+	// falling back to the next one and finally the store if a lookup fails
+	// or misses a key, e.g. one not replicated yet. ListVerifiers and JWKS
+	// may lag behind the store. Default: nil
+	ReadReplicas []store.Store
+
+	// MetricsCollector, if set, receives measurements of rotations, key
+	// generation and store operations. See package metrics for a Prometheus
+	// compatible implementation. Default: nil
+	MetricsCollector MetricsCollector
+
+	// Tracer, if set, is used to trace signing key lookups, rotations,
+	// verifier lookups and all store operations. Default: nil
+	Tracer Tracer
+
+	// OnRotate, if set, is called after the signing key was rotated. old is
+	// nil if there was no previous key.
+	OnRotate func(old, new *SigningKey)
+
+	// OnRotationError, if set, is called when rotating the signing key
+	// fails.
+	OnRotationError func(err error)
+
+	// OnRotationOverdue, if set, is called when a rotation fails while the
+	// current signing key is more than RotationOverdueThreshold past its
+	// RotatedAt, e.g. because the store is down, to alert before
+	// SigningGracePeriod runs out. It is called once per key, with how long
+	// the rotation is overdue. Failed rotations are retried by SigningKey
+	// and by the worker of AutoRotate.
+	OnRotationOverdue func(key *SigningKey, overdue time.Duration)
+
+	// RotationOverdueThreshold is how long the current signing key may be
+	// past its RotatedAt before OnRotationOverdue is called. Default: 0,
+	// on the first failed rotation after RotatedAt
+	RotationOverdueThreshold time.Duration
+
+	// OnKeyExpired, if set, is called with the ID of every verifier key
+	// found to have expired when listing the store. It is called once per
+	// key and instance, as long as the key remains in the store.
+	OnKeyExpired func(id string)
+
+	// OnRevoke, if set, is called with the ID of every key revoked by this
+	// instance, after both halves of the keypair have been deleted.
+	OnRevoke func(id string)
+
+	// OnEmergencyRotate, if set, is called after EmergencyRotate replaced
+	// the signing key with newKey and revoked the keys with the IDs in
+	// revoked, e.g. to page the team on call.
+	OnEmergencyRotate func(reason string, newKey *SigningKey, revoked []string)
+
+	// Logger, if set, receives structured events about initialization,
+	// rotation, lock acquisition and store errors. Default: nil, nothing is
+	// logged
+	Logger Logger
+
+	// LockRetryPolicy defines how the store lock is retried when it is held
+	// by another instance during initialization. Default: 5 attempts with
+	// a backoff starting at 50 milliseconds
+	LockRetryPolicy LockRetryPolicy
+
+	// IDConflictRetries is how many times a new ID is tried when the ID of
+	// a new key is already taken in the store. Set to a negative value to
+	// disable retries. Default: 3
+	IDConflictRetries int
+
+	// CleanupInterval is how often expired keys are deleted from stores
+	// which don't delete them by themselves, see store.TTLHandler. Set to a
+	// negative value to only delete them when PurgeExpired is called.
+	// Default: 5 minutes
+	CleanupInterval time.Duration
+
+	// AuditSink, if set, receives records of key creation, first use,
+	// rotation, revocation, extension and verifier lookups. Default: nil
+	AuditSink AuditSink
+
+	// Namespace, if set, scopes all keys of the keychain, so that several
+	// keychains can share a store without colliding. It must not contain
+	// NamespaceSeparator. See also Manager. Default: ""
+	Namespace string
+
+	// NamespaceSeparator separates Namespace from the key IDs in the
+	// store, e.g. ":" to follow the key naming of Redis. Default: "/"
+	NamespaceSeparator string
+
+	// MinKeySize is the smallest size in bits of RSA keys loaded from the
+	// store, imported or generated. Weaker keys, e.g. legacy keys in an old
+	// store, are never used for signing or verifying. Default: 0, any size
+	MinKeySize int
+
+	// AllowedKeySizes, if set, limits the sizes in bits of RSA keys loaded
+	// from the store, imported or generated, like MinKeySize, e.g. to 2048,
+	// 3072 and 4096 bits. KeySize must be one of them. Default: nil, all
+	// sizes
+	AllowedKeySizes []int
+
+	// RSAPublicExponent, if set, is the only public exponent allowed for
+	// RSA keys loaded from the store, imported or generated. The standard
+	// library always generates keys with the exponent 65537, so other
+	// exponents require GenerateKey or KeyGenerator. Default: 0, any
+	// exponent
+	RSAPublicExponent int
+
+	// FIPS restricts the keychain to algorithms and parameters approved by
+	// FIPS 186: RSA keys of two primes and ECDSA keys. Keys of other
+	// algorithms loaded from the store violate the key policy, and custom
+	// Rand is not allowed. Creating the keychain fails with
+	// ErrFIPSUnavailable unless FIPSEnabled. Default: false
+	FIPS bool
+
+	// RSAPrimes is the number of primes of generated RSA keys, for systems
+	// requiring multi-prime keys. Such keys are not allowed by FIPS 186,
+	// are rejected by some verifiers, and since Go 1.20 sign more slowly
+	// than keys of two primes. Default: 2
+	RSAPrimes int
+
+	// PostQuantum, if set, pairs every new signing key with a key of this
+	// post-quantum algorithm, whose public key is published alongside the
+	// verifier key and in the JWKS under PostQuantumKeyID. Verifier-only
+	// instances must set it too, to load them. This is experimental, and
+	// requires Go 1.27. Default: "", none
+	PostQuantum PostQuantumAlgorithm
+
+	// ZeroizeKeys, if true, overwrites the private values of signing keys
+	// in memory once they have been rotated out and SigningGracePeriod
+	// has passed, checked on later rotations and cleanups. Such keys can
+	// no longer sign, so they must not be kept, e.g. from OnRotate. This
+	// is best-effort, as the runtime may have copied them. Private keys
+	// deleted from stores implementing store.SecureEraser are erased
+	// regardless. Default: false
+	ZeroizeKeys bool
+
+	// KeyMismatch is what to do with stored signing keys of another
+	// Algorithm or, for RSA, KeySize, e.g. after raising KeySize from 2048
+	// to 4096: KeyMismatchReuse signs with them until they are rotated,
+	// KeyMismatchRotate creates a new key right away, and KeyMismatchError
+	// fails with ErrKeyMismatch. Keys stored without metadata by earlier
+	// versions always match. Default: KeyMismatchReuse
+	KeyMismatch KeyMismatchPolicy
+
+	// AllowedAlgorithms, if set, limits the algorithms of keys loaded from
+	// the store, imported or generated, like MinKeySize. Default: nil, all
+	// algorithms
+	AllowedAlgorithms []Algorithm
+
+	// IDPrefixes overrides the prefixes of the store IDs of verifier keys,
+	// revocations, heartbeats and certificates. Each prefix must contain a
+	// character which IDs never do. Use MigrateIDs to copy the keys of an
+	// existing deployment before changing them. Default: DefaultIDPrefixes
+	IDPrefixes IDPrefixes
+
+	// Certificates, if true, wraps every new verifier key in a self-signed
+	// X.509 certificate valid until the verifier key expires, available as
+	// VerifierKey.Certificate. Verifier-only instances must enable it too,
+	// to load the certificates. Default: false
+	Certificates bool
+
+	// CertificateIssuer, if set, issues the certificates instead of
+	// self-signing them, e.g. using a CA. Implies Certificates.
+	CertificateIssuer CertificateIssuer
+
+	// CertificateChain is the chain of the issuer of the certificates, such
+	// as intermediate and root CA certificates, which is included after the
+	// certificate of each key in JWKs. Default: nil
+	CertificateChain []*x509.Certificate
+}
+
+// LockRetryPolicy defines how acquiring the store lock is retried while it
+// is occupied.
+type LockRetryPolicy struct {
+	// Attempts is the maximum number of attempts, where 1 disables retries
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for every
+	// following retry
+	Backoff time.Duration
+	// MaxBackoff limits the delay between retries
+	MaxBackoff time.Duration
+}
+
+// Encryptor encrypts and decrypts the PKCS #8 encoded private keys
+// persisted in the store.
+type Encryptor interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// Clock tells the current time. It can be replaced to control time in
+// tests and simulations.
+type Clock interface {
+	Now() time.Time
+}
+
+// TimerClock is a Clock which also creates the timers used to wait, e.g. by
+// the background rotation worker and between lock attempts. If the Clock in
+// Options does not implement TimerClock, timers use the system time.
+type TimerClock interface {
+	Clock
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer delivers the time on its channel once it fires, like time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// newTimer creates a timer using the configured clock, if it supports it
+func (r *ring) newTimer(d time.Duration) Timer {
+	if clock, ok := r.options.Clock.(TimerClock); ok {
+		return clock.NewTimer(d)
+	}
+	return systemClock{}.NewTimer(d)
 }
 
 var defaultOptions = Options{
+	Algorithm:          RSA,
 	RotationFrequency:  1 * time.Hour,
 	VerificationPeriod: 2 * time.Hour,
 	KeySize:            2048,
 
 	IDAlphabet: defaultIDAlphabet,
 	IDLength:   defaultIDLength,
+	IDStrategy: RandomID,
+
+	IDConflictRetries: 3,
+
+	CleanupInterval: 5 * time.Minute,
+
+	Clock: systemClock{},
+
+	LockRetryPolicy: LockRetryPolicy{
+		Attempts:   5,
+		Backoff:    50 * time.Millisecond,
+		MaxBackoff: time.Second,
+	},
 }
 
 // Keychain is used to automatically manage asymmetric keys in a
 // secure and easy-to-manage way.
 type Keychain interface {
 	// SigningKey returns a fresh key which can be used for signing data. The
-	// keypair is uniquely identified by an ID.
+	// keypair is uniquely identified by an ID. Signatures made with it are
+	// not counted towards Options.MaxSignaturesPerKey, see
+	// SigningKeyToSign.
 	SigningKey() (*SigningKey, error)
-	// GetVerifier can be used to get the public key for a specific keypair
-	// identified by an ID.
-	GetVerifier(id string) (*VerifierKey, error)
-	// ListPublicKeys lists all currently active public keys
-	ListVerifiers() ([]*VerifierKey, error)
+	// SigningKeyContext is like SigningKey, but the context is used for any
+	// store operations needed to rotate the key.
+	SigningKeyContext(ctx context.Context) (*SigningKey, error)
+	Verifier
+	// ListVerifiersPage lists up to limit active public keys, in the order
+	// of ListVerifiers, starting after cursor. The returned cursor
+	// continues with the next page, and is empty after the last page.
+	ListVerifiersPage(cursor string, limit int) (keys []*VerifierKey, next string, err error)
+	// ListVerifiersWithMeta is like ListVerifiersContext, but also returns
+	// until when the list may be cached, e.g. to set the max-age of JWKS
+	// responses.
+	ListVerifiersWithMeta(ctx context.Context) ([]*VerifierKey, VerifierListMeta, error)
+	// GetVerifiers returns the active public keys with the provided IDs,
+	// fetching those not cached in a single store roundtrip if the store
+	// is a store.BatchFinder. IDs which are not found are left out of the
+	// map, without an error.
+	GetVerifiers(ids ...string) (map[string]*VerifierKey, error)
+	// GetVerifierByFingerprint finds the active public key with the given
+	// fingerprint.
+	GetVerifierByFingerprint(fingerprint Fingerprint) (*VerifierKey, error)
+	// JWKS renders all currently active public keys as a JSON Web Key Set
+	JWKS() ([]byte, error)
 	// Rotate forces a rotation of signing keys
 	Rotate() error
+	// RotateContext is like Rotate, but uses the context for all store
+	// operations.
+	RotateContext(ctx context.Context) error
+	// Promote makes the key staged by Rotate the signing key, if
+	// Options.StagedRotation is set. It returns ErrNoStagedKey if no key
+	// is staged. Other instances switch to the key at their next rotation,
+	// or as soon as they see the change if the store is a store.Watcher.
+	Promote() error
+	// ExtendVerifier extends the expiry of the public key identified by id,
+	// so data signed with it can be verified until expiresAt. The new expiry
+	// must be later than the current one and within the limits set by
+	// Options.MaxVerifierExtension.
+	ExtendVerifier(id string, expiresAt time.Time) (*VerifierKey, error)
+	// GetSigningKey returns the non-expired signing key identified by id,
+	// which may have been rotated but is kept according to
+	// Options.SigningGracePeriod and Options.RetainSigningKeys.
+	GetSigningKey(id string) (*SigningKey, error)
+	// GetSigningKeyContext is like GetSigningKey, but uses the context for
+	// the store lookup.
+	GetSigningKeyContext(ctx context.Context, id string) (*SigningKey, error)
+	// PreviousSigningKey returns the signing key used before the current
+	// one, e.g. to sign with both keys during a migration. It returns
+	// ErrKeyNotFound unless the previous key is still kept according to
+	// Options.SigningGracePeriod and Options.RetainSigningKeys.
+	PreviousSigningKey() (*SigningKey, error)
+	// NewKeyWithOptions creates an additional keypair with its own
+	// schedule, e.g. a long-lived key for offline document signing. The key
+	// never becomes the current signing key, but can be looked up with
+	// GetSigningKey until its RotatedAt, and is verifiable until its
+	// VerifiableUntil.
+	NewKeyWithOptions(opts KeyOptions) (*SigningKey, error)
+	// ImportSigningKey stores an existing private key, e.g. to migrate from
+	// a static key without invalidating data already signed with it. The
+	// key becomes an active verifier, and optionally the current signing
+	// key.
+	ImportSigningKey(key crypto.Signer, opts ImportOptions) (*SigningKey, error)
+	// Export writes all keys, encrypted with a key derived from passphrase,
+	// for backups or for moving the keys to another store.
+	Export(w io.Writer, passphrase []byte) error
+	// Import adds the keys of a backup written by Export to the store. Keys
+	// which have expired since the export, or are already stored, are
+	// skipped.
+	Import(r io.Reader, passphrase []byte) error
+	// PurgeExpired deletes all expired keys of the keychain from the store.
+	// It is done periodically according to Options.CleanupInterval, but
+	// can also be triggered manually, e.g. from a cron job.
+	PurgeExpired() error
+	// PurgeExpiredContext is like PurgeExpired, but uses the context for
+	// all store operations.
+	PurgeExpiredContext(ctx context.Context) error
+	// Revoke immediately removes the keypair identified by id, so it can no
+	// longer be used for signing or verifying. The revocation is recorded
+	// until the verifier key would have expired naturally.
+	Revoke(id string) error
+	// EmergencyRotate is meant for a suspected key compromise. Under the
+	// store lock it creates a new signing key, and then revokes all other
+	// keypairs, including those of NewKeyWithOptions and
+	// ImportSigningKey. reason is logged, recorded in an
+	// AuditEmergencyRotated record and passed to
+	// Options.OnEmergencyRotate. Other instances keep signing with their
+	// revoked key until they notice its deletion, see store.Watcher.
+	EmergencyRotate(reason string) (*SigningKey, error)
+	// RevocationList returns the IDs of all revoked keys which have not yet
+	// expired, signed with the current signing key.
+	RevocationList() (*RevocationList, error)
+	// Heartbeat records which signing key this instance is currently using.
+	// Heartbeats are written on initialization and rotation, and
+	// periodically by the worker of AutoRotate. Instances not running the
+	// worker should additionally write them periodically for drift
+	// detection to be accurate.
+	Heartbeat() error
+	// DetectDrift reports all instances whose latest heartbeat shows them
+	// using another signing key than the newest active one in the store,
+	// for longer than threshold.
+	DetectDrift(threshold time.Duration) ([]Drift, error)
+	// WaitReady blocks until the signing key is loaded or created, for
+	// keychains created with Options.DeferInitialization. Failures are
+	// retried with the backoff of Options.LockRetryPolicy, and the last one
+	// is returned wrapped in ErrNotReady once ctx is done. It returns nil
+	// right away for other keychains.
+	WaitReady(ctx context.Context) error
+	// Healthy returns an error wrapping ErrUnhealthy if the store can't be
+	// reached, the signing key is more than
+	// Options.HealthRotationThreshold past its rotation or the last
+	// rotation failed. It is meant for readiness probes, see package
+	// healthhttp.
+	Healthy(ctx context.Context) error
+	// Status describes the rotation schedule of this instance, e.g. for
+	// status pages.
+	Status() (*Status, error)
+	// SignatureCount returns the number of signatures counted for the key
+	// identified by keyID, see Options.SignatureCounter
+	SignatureCount(keyID string) (uint64, error)
+	// Sign signs data with the current signing key, and returns the
+	// signature together with the ID of the key used. The
+	// SignatureAlgorithm of the key decides the padding of RSA signatures
+	// and the hash; ECDSA signatures are ASN.1 encoded.
+	Sign(data []byte) (signature []byte, keyID string, err error)
+	// Verify checks a signature created by Sign, using the verifier key
+	// identified by keyID. ErrInvalidSignature is returned if the signature
+	// does not match.
+	Verify(keyID string, data, signature []byte) error
+	// TenantSigner returns a signer using the current signing key under
+	// key IDs specific to tenantID, which GetVerifier resolves to the key.
+	// ErrInvalidTenant is returned if tenantID is empty or contains
+	// TenantSeparator.
+	TenantSigner(tenantID string) (*TenantSigner, error)
+	// Start runs a background worker which rotates the signing key when it
+	// expires, instead of waiting for the next call to SigningKey. The
+	// worker stops when ctx is done or Close is called.
+	Start(ctx context.Context) error
+	// Close stops the background worker, if running, the watch of stores
+	// implementing store.Watcher, the deletion of expired keys and the
+	// generation of keys for Options.PregenerateKeys, and waits for them to
+	// exit.
+	Close() error
 }
 
 // New creates a new Keychain with a given store used to persist
@@ -122,194 +860,608 @@ func New(store store.Store) Keychain {
 }
 
 // NewWithOptions creates a new Keychain with a given store used to
-// persist generated keys and together with custom options
+// persist generated keys and together with custom options. It panics if the
+// keychain can not be initialized, use NewKeychain to get an error instead.
 func NewWithOptions(store store.Store, options Options) Keychain {
-	if options.RotationFrequency == 0 {
-		options.RotationFrequency = defaultOptions.RotationFrequency
+	keychain, err := NewKeychain(store, options)
+	if err != nil {
+		panic(err)
 	}
+	return keychain
+}
 
-	if options.VerificationPeriod == 0 {
-		options.VerificationPeriod = options.RotationFrequency * 2
-	}
+// NewKeychain creates a new Keychain with a given store used to persist
+// generated keys and together with custom options. An error is returned if
+// the options are invalid or if the store fails during initialization.
+func NewKeychain(s store.Store, options Options) (Keychain, error) {
+	return NewKeychainContext(context.Background(), store.WithContext(s), options)
+}
 
-	if options.VerificationPeriod < options.RotationFrequency {
-		panic("VerificationPeriod must be at >= RotationFrequency")
+// decorateStore wraps s in the key layout and the timeout, logging,
+// metrics and tracing configured in options
+func decorateStore(s store.ContextStore, options Options) store.ContextStore {
+	s = withKeyLayout(withStoreTimeout(s, options.StoreTimeout), options)
+	if options.Logger != nil {
+		s = &loggedStore{ContextStore: s, logger: options.Logger}
+	}
+	if options.MetricsCollector != nil {
+		s = &observedStore{ContextStore: s, collector: options.MetricsCollector}
 	}
+	if options.Tracer != nil {
+		s = &tracedStore{ContextStore: s, tracer: options.Tracer}
+	}
+	return s
+}
 
-	if options.KeySize == 0 {
-		options.KeySize = defaultOptions.KeySize
+// NewKeychainContext is like NewKeychain, but takes a store with support for
+// contexts. The context is only used during initialization.
+func NewKeychainContext(ctx context.Context, store store.ContextStore, options Options) (Keychain, error) {
+	options = options.withDefaults()
+	if err := options.validate(); err != nil {
+		return nil, err
 	}
 
-	if options.IDAlphabet == "" {
-		options.IDAlphabet = defaultOptions.IDAlphabet
+	if options.InstanceID == "" {
+		id, err := randomID(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate instance id: %w", err)
+		}
+		options.InstanceID = id
 	}
 
-	if options.IDLength == 0 {
-		options.IDLength = defaultOptions.IDLength
+	watcher := newStoreWatcher(store, options)
+	lockRenewer := newLockRenewer(store)
+	cleanup := options.CleanupInterval > 0 && needsCleanup(store) && !options.ReadOnly
+	if options.ReadOnly {
+		store = &readOnlyStore{ContextStore: store}
+	}
+	reads := decorateStore(withReadReplicas(store, options.ReadReplicas), options)
+	store = decorateStore(store, options)
+	if options.Logger == nil {
+		options.Logger = nopLogger{}
 	}
 
 	keychain := &ring{
-		store:   store,
-		options: options,
+		verifier: newVerifier(store, options),
 
-		rotatehOnce: &once.ValueError{},
+		lockRenewer: lockRenewer,
+	}
+	keychain.reads = reads
+	if options.RotationSchedule != "" {
+		keychain.schedule, _ = parseCronSchedule(options.RotationSchedule)
+	}
+	if keychain.options.SignatureCounter == nil {
+		keychain.options.SignatureCounter = newMemoryCounter()
 	}
 
-	keychain.initialize()
-	return keychain
+	start := func() error {
+		if watcher != nil {
+			keychain.startWatching(watcher)
+		}
+		if cleanup {
+			keychain.startCleanup()
+		}
+		if options.PregenerateKeys > 0 && !options.ReadOnly {
+			keychain.startKeyPool()
+		}
+		if options.AutoRotate {
+			return keychain.Start(context.Background())
+		}
+		return nil
+	}
+	if options.DeferInitialization {
+		keychain.readiness = newReadiness(start)
+		return keychain, nil
+	}
+	if err := keychain.initialize(ctx); err != nil {
+		return nil, err
+	}
+	if err := start(); err != nil {
+		return nil, err
+	}
+	return keychain, nil
 }
 
 type ring struct {
-	store   store.Store
-	options Options
+	verifier
 
 	currentSigningKey atomic.Value
 
-	rotatehOnce *once.ValueError
+	// schedule is the parsed Options.RotationSchedule, if set
+	schedule *cronSchedule
+
+	// rotationMu guards rotation, the rotation in progress if any. Callers
+	// of rotateSigningKey while a rotation is in progress wait for its
+	// result instead of rotating again.
+	rotationMu sync.Mutex
+	rotation   *rotation
+
+	// retired holds the signing keys to zeroize, see Options.ZeroizeKeys
+	retiredMu sync.Mutex
+	retired   []retiredKey
+
+	// readiness is set if Options.DeferInitialization is
+	readiness *readiness
+
+	// overdueAlerted is the ID of the last key passed to
+	// OnRotationOverdue, only accessed by rotateOnce
+	overdueAlerted string
+
+	// lastRotation holds the rotationResult of the latest rotation
+	lastRotation atomic.Value
+
+	// lockRenewer is set if the lock of the store expires unless renewed
+	lockRenewer store.LockRenewer
+
+	workerMu   sync.Mutex
+	stopWorker context.CancelFunc
+	workerDone chan struct{}
+
+	keyPoolMu     sync.Mutex
+	keyPool       []crypto.Signer
+	keyPoolRefill chan struct{}
+	stopKeyPool   context.CancelFunc
+	keyPoolDone   chan struct{}
+
+	prePublishedMu  sync.Mutex
+	prePublishedFor string
+
+	// staged is the key staged by Rotate for Options.StagedRotation
+	stagedMu sync.Mutex
+	staged   *SigningKey
+
+	usage usageAuditor
+
+	stopWatch         context.CancelFunc
+	watchDone         chan struct{}
+	deletedSigningKey atomic.Value
+
+	stopCleanup context.CancelFunc
+	cleanupDone chan struct{}
 }
 
-func (r *ring) initialize() {
-	privateKeys, err := r.getNonExpiredPrivateKeys()
+func (r *ring) initialize(ctx context.Context) error {
+	privateKeys, err := r.getReusablePrivateKeys(ctx)
 	if err != nil {
-		panic(fmt.Errorf("failed to get private keys: %w", err))
+		return fmt.Errorf("failed to get private keys: %w", err)
 	}
-	if len(privateKeys) != 0 {
-		keyToUse := privateKeys[0]
-		untyped, err := x509.ParsePKCS8PrivateKey(keyToUse.Data)
+	if len(privateKeys) == 0 && r.options.ReadOnly {
+		return fmt.Errorf("no signing key in the store: %w", ErrReadOnly)
+	}
+	if len(privateKeys) == 0 {
+		var locked bool
+		privateKeys, locked, err = r.lockForInitialization(ctx)
 		if err != nil {
-			panic(fmt.Errorf("private key data could not be parsed: %w", err))
+			return err
 		}
-		privateKey, ok := untyped.(*rsa.PrivateKey)
-		if !ok {
-			panic(fmt.Errorf("key has invalid type: %w", err))
+		if locked {
+			// The lock is released even if ctx is done
+			defer r.store.Unlock(context.Background())
+			stopRenewing := r.keepLock()
+			defer stopRenewing()
 		}
-		signingKey := &SigningKey{
-			ID:              keyToUse.ID,
-			RotatedAt:       keyToUse.ExpiresAt,
-			VerifiableUntil: keyToUse.ExpiresAt.Add(r.options.VerificationPeriod).Add(-r.options.RotationFrequency),
-			Key:             privateKey,
+	}
+
+	if len(privateKeys) != 0 {
+		// Skip keys which are only kept for the grace period
+		current := privateKeys[0]
+		for _, key := range privateKeys {
+			if !r.options.expired(r.privateKeyRotatedAt(key), r.options.Clock.Now()) {
+				current = key
+				break
+			}
+		}
+		signingKey, err := r.storedPrivateKeyToSigningKey(current)
+		if err != nil {
+			return err
 		}
 		r.currentSigningKey.Store(signingKey)
+		r.options.Logger.Info("reusing stored signing key", withFingerprint(signingKey, "key_id", signingKey.ID, "rotated_at", signingKey.RotatedAt)...)
 	} else {
 		signingKey, err := r.createNewSigningKey()
 		if err != nil {
-			panic(fmt.Sprintf("failed to create new signing key: %v", err))
+			return fmt.Errorf("failed to create new signing key: %w", err)
 		}
 
-		privateStoreKey, publicStoreKey, err := createStoreKeyPairFromSigningKey(signingKey)
+		err = r.storeSigningKey(ctx, signingKey)
 		if err != nil {
-			panic(fmt.Errorf("failed to create key pair from signing key: %w", err))
+			return fmt.Errorf("failed to store key pair: %w", err)
+		}
+
+		r.currentSigningKey.Store(signingKey)
+		r.options.Logger.Info("created signing key", withFingerprint(signingKey, "key_id", signingKey.ID, "rotated_at", signingKey.RotatedAt)...)
+	}
+
+	// Heartbeats are only used for drift detection, which should not stop
+	// the keychain from being usable
+	_ = r.heartbeat(ctx)
+	return nil
+}
+
+// lockForInitialization locks the store to create the first signing key.
+// While the lock is occupied it is retried according to the retry policy,
+// and if the instance holding it creates a key in the meantime, that key is
+// returned without locking.
+func (r *ring) lockForInitialization(ctx context.Context) (store.KeyList, bool, error) {
+	policy := r.options.LockRetryPolicy
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := r.store.Lock(ctx)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, store.ErrLockOccupied) || attempt >= policy.Attempts {
+			return nil, false, fmt.Errorf("failed to lock store: %w", err)
 		}
 
-		err = r.storeKeyPair(privateStoreKey, publicStoreKey)
+		timer := r.newTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false, ctx.Err()
+		case <-timer.C():
+		}
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+
+		privateKeys, err := r.getReusablePrivateKeys(ctx)
 		if err != nil {
-			panic(fmt.Errorf("failed to store key pair: %w", err))
+			return nil, false, fmt.Errorf("failed to get private keys: %w", err)
+		}
+		if len(privateKeys) != 0 {
+			return privateKeys, false, nil
 		}
+	}
 
-		r.currentSigningKey.Store(signingKey)
+	// Another instance might have created a key before the lock was
+	// acquired, in which case that key should be used instead
+	privateKeys, err := r.getReusablePrivateKeys(ctx)
+	if err != nil {
+		r.store.Unlock(context.Background())
+		return nil, false, fmt.Errorf("failed to get private keys: %w", err)
+	}
+	return privateKeys, true, nil
+}
+
+// adoptsNextKey reports whether rotating away from current should use a
+// replacement found in the store. Rotations of keys which are still valid,
+// e.g. by Rotate, only do so for keys published in advance.
+func (r *ring) adoptsNextKey(current *SigningKey) bool {
+	return r.options.PrePublishWindow > 0 || r.options.Clock.Now().After(current.RotatedAt) || r.signingKeyDeleted(current)
+}
+
+// waitForReplacement polls the store for the signing key replacing current,
+// created by the instance holding the lock, for up to RotationLockWait. It
+// returns nil if no such key shows up in time.
+func (r *ring) waitForReplacement(ctx context.Context, current *SigningKey) (*SigningKey, error) {
+	policy := r.options.LockRetryPolicy
+	backoff := policy.Backoff
+	for waited := time.Duration(0); waited < r.options.RotationLockWait; {
+		if remaining := r.options.RotationLockWait - waited; backoff > remaining {
+			backoff = remaining
+		}
+		timer := r.newTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C():
+		}
+		waited += backoff
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+
+		next, err := r.findNextPrivateKey(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		if next != nil {
+			return next, nil
+		}
 	}
+	return nil, nil
 }
 
 func (r *ring) SigningKey() (*SigningKey, error) {
+	return r.SigningKeyContext(context.Background())
+}
+
+func (r *ring) SigningKeyContext(ctx context.Context) (key *SigningKey, err error) {
+	ctx, end := r.startSpan(ctx, "ring.SigningKey")
+	defer func() {
+		if err == nil {
+			r.auditUse(key)
+		}
+		end(err)
+	}()
+
 	val := r.currentSigningKey.Load()
 	if val == nil {
-		panic("not initialized")
+		return nil, ErrNotReady
 	}
 	key, ok := val.(*SigningKey)
 	if !ok {
 		panic("stored signing key has incorrect type")
 	}
 
-	if time.Now().After(key.RotatedAt) {
-		newKey, err := r.rotateSigningKey()
+	if r.signingKeyDeleted(key) {
+		newKey, err := r.rotateSigningKeyFrom(ctx, key)
+		if err != nil {
+			return nil, &RotationError{Cause: err}
+		}
+		return newKey, nil
+	}
+
+	if now := r.options.Clock.Now(); r.options.expired(key.RotatedAt, now) {
+		newKey, err := r.rotateSigningKeyFrom(ctx, key)
 		if err != nil {
-			return nil, fmt.Errorf("%w: %v", ErrKeyRotation, err)
+			if now.Before(key.RotatedAt.Add(r.options.SigningGracePeriod)) {
+				return key, nil
+			}
+			return nil, &RotationError{Cause: err}
 		}
 		return newKey, nil
 	}
 
+	if r.promotionDue() {
+		// Like publishing, a failed promotion is retried on the next call
+		if newKey, err := r.rotateSigningKey(ctx); err == nil {
+			return newKey, nil
+		}
+	}
+
+	if r.prePublishing(key) {
+		// The current key is still valid, so failing to publish the next
+		// one is retried on the next call instead of failing this one
+		_ = r.prePublishNextKey(ctx, key)
+	}
+
 	return key, nil
 }
 
-func (r *ring) GetVerifier(id string) (*VerifierKey, error) {
-	key, err := r.store.Find(fmt.Sprintf("%s%s", publicKeyIDPrefix, id))
-	if err != nil {
+func (r *ring) ExtendVerifier(id string, expiresAt time.Time) (*VerifierKey, error) {
+	ctx := context.Background()
+	if err := r.store.Lock(ctx); err != nil {
 		return nil, err
 	}
-	if time.Now().After(key.ExpiresAt) {
-		return nil, ErrKeyNotFound
-	}
+	// The lock is released even if ctx is done
+	defer r.store.Unlock(context.Background())
+	stopRenewing := r.keepLock()
+	defer stopRenewing()
 
-	untyped, err := x509.ParsePKIXPublicKey(key.Data)
+	storeID := fmt.Sprintf("%s%s", publicKeyIDPrefix, id)
+	key, err := r.store.Find(ctx, storeID)
 	if err != nil {
 		return nil, err
 	}
-	pub, ok := untyped.(*rsa.PublicKey)
-	if !ok {
+	if revoked, err := r.isRevoked(ctx, id); err != nil {
+		return nil, err
+	} else if revoked {
 		return nil, ErrKeyNotFound
 	}
-	return &VerifierKey{
-		ID:        id,
-		Key:       pub,
-		ExpiresAt: key.ExpiresAt,
-	}, nil
-}
+	now := r.options.Clock.Now()
+	if r.options.expired(key.ExpiresAt, now) {
+		return nil, ErrKeyNotFound
+	}
+	if !expiresAt.After(key.ExpiresAt) || expiresAt.After(now.Add(r.options.MaxVerifierExtension)) {
+		return nil, ErrExtensionNotAllowed
+	}
 
-func (r *ring) ListVerifiers() ([]*VerifierKey, error) {
-	var res []*VerifierKey
-	keys, err := r.getNonExpiredPublicKeys()
+	pub, err := r.parseVerifierKey(key)
 	if err != nil {
 		return nil, err
 	}
-	for _, key := range keys {
-		untyped, err := x509.ParsePKIXPublicKey(key.Data)
-		if err != nil {
-			return nil, err
+
+	// Stores have no notion of updating a key, so replace the old record,
+	// restoring it if the replacement can't be added
+	if err := r.store.Delete(ctx, storeID); err != nil {
+		return nil, err
+	}
+	extended := key
+	extended.ExpiresAt = expiresAt
+	if err := r.store.Add(ctx, extended); err != nil {
+		if restoreErr := r.store.Add(ctx, key); restoreErr != nil {
+			r.options.Logger.Error("failed to restore verifier after failed extension", "key_id", id, "error", restoreErr)
 		}
-		pub, ok := untyped.(*rsa.PublicKey)
-		if !ok {
-			// Should not happen
-			return nil, errors.New("stored public key has unknown type")
+		return nil, err
+	}
+	r.cache.forget(id)
+	// Revoke does not take the lock, but records the revocation before
+	// deleting the public key, so a revocation which raced the extension
+	// is seen here
+	if revoked, err := r.isRevoked(ctx, id); err != nil {
+		return nil, err
+	} else if revoked {
+		if err := r.store.Delete(ctx, storeID); err != nil {
+			return nil, err
 		}
-		res = append(res, &VerifierKey{
-			ID:        strings.TrimPrefix(key.ID, publicKeyIDPrefix),
-			Key:       pub,
-			ExpiresAt: key.ExpiresAt,
-		})
+		return nil, ErrKeyNotFound
 	}
-	return res, nil
+	r.audit(AuditVerifierExtended, id, "")
+
+	// The certificate is left to expire at its NotAfter
+	cert, err := r.findCertificate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, createdAt := parseMetadata(key.Metadata, pub)
+	return VerifierKey{
+		ID:                 id,
+		Key:                pub,
+		ExpiresAt:          expiresAt,
+		Certificate:        cert,
+		CreatedAt:          createdAt,
+		Algorithm:          algorithm,
+		SignatureAlgorithm: parseSignatureAlgorithm(key.Metadata, pub),
+	}.withChain(r.options), nil
 }
 
 func (r *ring) Rotate() error {
-	_, err := r.rotateSigningKey()
+	return r.RotateContext(context.Background())
+}
+
+func (r *ring) RotateContext(ctx context.Context) (err error) {
+	ctx, end := r.startSpan(ctx, "ring.Rotate")
+	defer func() { end(err) }()
+
+	if r.options.ReadOnly {
+		return ErrReadOnly
+	}
+	if r.options.StagedRotation {
+		return r.stage(ctx)
+	}
+	_, err = r.rotateSigningKey(ctx)
 	return err
 }
 
-func (r *ring) rotateSigningKey() (*SigningKey, error) {
-	val, err := r.rotatehOnce.Do(func() (interface{}, error) {
-		defer func() {
-			r.rotatehOnce = &once.ValueError{}
-		}()
+// rotation is a rotation of the signing key, which is done once closed
+type rotation struct {
+	done chan struct{}
+	key  *SigningKey
+	err  error
+}
 
-		newSigningKey, err := r.createNewSigningKey()
-		if err != nil {
+// rotateSigningKey rotates the signing key, or waits for the rotation in
+// progress and returns its result
+func (r *ring) rotateSigningKey(ctx context.Context) (*SigningKey, error) {
+	return r.rotateSigningKeyFrom(ctx, nil)
+}
+
+// rotateSigningKeyFrom is like rotateSigningKey, but if seen is set and no
+// longer the current signing key, e.g. as another caller rotated it since,
+// it returns the current key instead of rotating again
+func (r *ring) rotateSigningKeyFrom(ctx context.Context, seen *SigningKey) (*SigningKey, error) {
+	r.rotationMu.Lock()
+	if inProgress := r.rotation; inProgress != nil {
+		r.rotationMu.Unlock()
+		select {
+		case <-inProgress.done:
+			return inProgress.key, inProgress.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if current, _ := r.currentSigningKey.Load().(*SigningKey); seen != nil && current != nil && current != seen {
+		r.rotationMu.Unlock()
+		return current, nil
+	}
+	rot := &rotation{done: make(chan struct{})}
+	r.rotation = rot
+	r.rotationMu.Unlock()
+
+	defer func() {
+		r.rotationMu.Lock()
+		r.rotation = nil
+		r.rotationMu.Unlock()
+		close(rot.done)
+	}()
+	rot.key, rot.err = r.rotateOnce(ctx)
+	return rot.key, rot.err
+}
+
+// rotateOnce rotates the signing key and reports the result, and must only
+// be called by rotateSigningKeyFrom
+func (r *ring) rotateOnce(ctx context.Context) (*SigningKey, error) {
+	old, _ := r.currentSigningKey.Load().(*SigningKey)
+	newSigningKey, err := r.rotate(ctx)
+	if err != nil {
+		if r.options.MetricsCollector != nil {
+			r.options.MetricsCollector.RotationFailed()
+		}
+		r.lastRotation.Store(rotationResult{at: r.options.Clock.Now(), err: err})
+		r.options.Logger.Error("failed to rotate signing key", "error", err)
+		if r.options.OnRotationError != nil {
+			r.options.OnRotationError(err)
+		}
+		r.alertOverdue(old)
+		return nil, err
+	}
+	r.lastRotation.Store(rotationResult{at: r.options.Clock.Now()})
+	if r.options.MetricsCollector != nil {
+		r.options.MetricsCollector.Rotated()
+	}
+	// Keys retired by earlier rotations are zeroized first, so old is kept
+	// at least until the next one
+	r.zeroizeRetiredKeys()
+	if old != newSigningKey {
+		r.retire(old)
+	}
+	oldID := ""
+	if old != nil {
+		oldID = old.ID
+	}
+	r.options.Logger.Info("rotated signing key", withFingerprint(newSigningKey, "old_key_id", oldID, "key_id", newSigningKey.ID, "rotated_at", newSigningKey.RotatedAt)...)
+	r.auditKey(AuditKeyRotated, newSigningKey, oldID)
+	if r.options.OnRotate != nil {
+		r.options.OnRotate(old, newSigningKey)
+	}
+	return newSigningKey, nil
+}
+
+// rotate replaces the current signing key, and must only be called by
+// rotateOnce.
+func (r *ring) rotate(ctx context.Context) (*SigningKey, error) {
+	if r.options.ReadOnly {
+		return r.adoptStoredKey(ctx)
+	}
+	if err := r.store.Lock(ctx); err != nil {
+		current, ok := r.currentSigningKey.Load().(*SigningKey)
+		if !ok || !errors.Is(err, store.ErrLockOccupied) || r.options.RotationLockWait <= 0 {
 			return nil, err
 		}
+		replacement, waitErr := r.waitForReplacement(ctx, current)
+		if waitErr != nil {
+			return nil, waitErr
+		}
+		if replacement == nil {
+			return nil, err
+		}
+		r.currentSigningKey.Store(replacement)
+		return replacement, nil
+	}
+	// The lock is released even if ctx is done
+	defer r.store.Unlock(context.Background())
+	stopRenewing := r.keepLock()
+	defer stopRenewing()
 
-		privateStoreKey, publicStoreKey, err := createStoreKeyPairFromSigningKey(newSigningKey)
+	var newSigningKey *SigningKey
+	current, ok := r.currentSigningKey.Load().(*SigningKey)
+	if staged := r.stagedKey(); ok && staged != nil && staged.ID != current.ID {
+		if r.options.Clock.Now().Before(current.RotatedAt) {
+			if err := r.endSigningPeriod(ctx, current); err != nil {
+				return nil, err
+			}
+		}
+		newSigningKey = staged
+	} else if ok && r.adoptsNextKey(current) {
+		// Prefer the key already published in advance, or created by
+		// another instance which rotated first, so only one key is created
+		// per rotation across instances
+		next, err := r.findNextPrivateKey(ctx, current)
 		if err != nil {
 			return nil, err
 		}
+		newSigningKey = next
+	}
 
-		if err = r.storeKeyPair(privateStoreKey, publicStoreKey); err != nil {
+	if newSigningKey == nil {
+		var err error
+		newSigningKey, err = r.createNewSigningKey()
+		if err != nil {
 			return nil, err
 		}
 
-		r.currentSigningKey.Store(newSigningKey)
-		return newSigningKey, nil
-	})
-	if err != nil {
-		return nil, err
+		if err = r.storeSigningKey(ctx, newSigningKey); err != nil {
+			return nil, err
+		}
 	}
-	return val.(*SigningKey), nil
+
+	r.currentSigningKey.Store(newSigningKey)
+	r.stagedMu.Lock()
+	r.staged = nil
+	r.stagedMu.Unlock()
+	_ = r.heartbeat(ctx)
+	return newSigningKey, nil
 }
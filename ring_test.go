@@ -1,13 +1,39 @@
 package ring_test
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hsson/ring"
+	"github.com/hsson/ring/crypt"
+	"github.com/hsson/ring/sim"
+	"github.com/hsson/ring/store"
 	"github.com/hsson/ring/store/inmem"
 )
 
@@ -137,6 +163,77 @@ func TestListVerifierKeys(t *testing.T) {
 	}
 }
 
+func TestConcurrentRotation(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	var rotations int32
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Clock:             clock,
+		OnRotate: func(old, new *ring.SigningKey) {
+			atomic.AddInt32(&rotations, 1)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Callers finding the key expired rotate it once
+	clock.Advance(2 * time.Hour)
+	atomic.StoreInt32(&rotations, 0)
+	var wg sync.WaitGroup
+	keys := make(chan *ring.SigningKey, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := keychain.SigningKey()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			keys <- key
+		}()
+	}
+	wg.Wait()
+	close(keys)
+	for key := range keys {
+		if key.ID == first.ID {
+			t.Errorf("expected the expired key %s to be rotated", first.ID)
+		}
+	}
+	if n := atomic.LoadInt32(&rotations); n != 1 {
+		t.Errorf("expected 1 rotation, got %d", n)
+	}
+
+	// Forced rotations race with callers of SigningKey
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := keychain.Rotate(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			key, err := keychain.SigningKey()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := keychain.GetVerifier(key.ID); err != nil {
+				t.Errorf("expected verifier of signing key %s, got %v", key.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestForceRotation(t *testing.T) {
 	store := inmem.NewInMemoryStore()
 
@@ -190,8 +287,5102 @@ wwIDDf//
 		ExpiresAt: time.Now().Add(5 * time.Hour),
 	}
 
-	verifierKeyPEM := verifierKey.EncodeToPEM()
+	verifierKeyPEM, err := verifierKey.EncodeToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
 	if string(verifierKeyPEM) != expectedPEM {
 		t.Errorf("PEM is not matching, got:\n%v\nwant:\n%v", string(verifierKeyPEM), expectedPEM)
 	}
+
+	if _, err := (&ring.VerifierKey{Key: "not a key"}).EncodeToPEM(); err == nil {
+		t.Error("expected error encoding unsupported key")
+	}
+}
+
+func TestVerifierKeyEncodeToSSHAuthorizedKey(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	line, err := (&ring.VerifierKey{ID: "key-1", Key: priv.Public()}).EncodeToSSHAuthorizedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDtqJ7zOtqQtYqOo0CpvDXNlMhV3HeJDpjrASKGLWdop key-1\n"
+	if string(line) != expected {
+		t.Errorf("expected %q, got %q", expected, line)
+	}
+
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.ECDSAP256, ring.ECDSAP384, ring.ECDSAP521} {
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: algorithm})
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := keychain.GetVerifier(key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := verifier.EncodeToSSHAuthorizedKey()
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) != 3 || fields[2] != key.ID {
+			t.Errorf("%s: unexpected authorized key %q", algorithm, line)
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || !bytes.Contains(blob[:32], []byte(fields[0])) {
+			t.Errorf("%s: expected key blob to start with its type %s", algorithm, fields[0])
+		}
+	}
+}
+
+func TestPEMRoundTrip(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.ECDSAP384, Certificates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM, err := signingKey.EncodeToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedSigningKey, err := ring.SigningKeyFromPEM(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedSigningKey.Key.(*ecdsa.PrivateKey).D.Cmp(signingKey.Key.(*ecdsa.PrivateKey).D) != 0 {
+		t.Error("expected signing key to round-trip")
+	}
+
+	verifier, err := keychain.GetVerifier(signingKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM, err := verifier.EncodeToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := verifier.EncodeCertPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{publicPEM, certPEM} {
+		parsed, err := ring.VerifierKeyFromPEM(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Key.(*ecdsa.PublicKey).X.Cmp(verifier.Key.(*ecdsa.PublicKey).X) != 0 {
+			t.Errorf("expected verifier key to round-trip from %q", data)
+		}
+	}
+
+	if _, err := ring.VerifierKeyFromPEM(privatePEM); !errors.Is(err, ring.ErrInvalidPEM) {
+		t.Errorf("expected ErrInvalidPEM, got %v", err)
+	}
+	if _, err := ring.SigningKeyFromPEM([]byte("garbage")); !errors.Is(err, ring.ErrInvalidPEM) {
+		t.Errorf("expected ErrInvalidPEM, got %v", err)
+	}
+}
+
+func TestExtendVerifier(t *testing.T) {
+	r := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+		RotationFrequency:    1 * time.Hour,
+		MaxVerifierExtension: 5 * time.Hour,
+	})
+
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := key.VerifiableUntil.Add(1 * time.Hour)
+	verifier, err := r.ExtendVerifier(key.ID, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifier.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("got ExpiresAt %v want %v", verifier.ExpiresAt, expiresAt)
+	}
+
+	verifier, err = r.GetVerifier(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifier.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("got stored ExpiresAt %v want %v", verifier.ExpiresAt, expiresAt)
+	}
+
+	_, err = r.ExtendVerifier(key.ID, time.Now().Add(6*time.Hour))
+	if !errors.Is(err, ring.ErrExtensionNotAllowed) {
+		t.Errorf("expected ErrExtensionNotAllowed, got %v", err)
+	}
+
+	_, err = r.ExtendVerifier(key.ID, key.VerifiableUntil)
+	if !errors.Is(err, ring.ErrExtensionNotAllowed) {
+		t.Errorf("expected ErrExtensionNotAllowed, got %v", err)
+	}
+}
+
+// addFailingStore fails to add keys expiring after failAfter, if set
+type addFailingStore struct {
+	store.Store
+	failAfter time.Time
+}
+
+func (s *addFailingStore) Add(key store.Key) error {
+	if !s.failAfter.IsZero() && key.ExpiresAt.After(s.failAfter) {
+		return errors.New("add failed")
+	}
+	return s.Store.Add(key)
+}
+
+func TestExtendVerifierRestoresOnFailure(t *testing.T) {
+	s := &addFailingStore{Store: inmem.NewInMemoryStore()}
+	r := ring.NewWithOptions(s, ring.Options{
+		RotationFrequency:    1 * time.Hour,
+		MaxVerifierExtension: 5 * time.Hour,
+	})
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the extended record fails to be added
+	s.failAfter = key.VerifiableUntil
+	if _, err := r.ExtendVerifier(key.ID, key.VerifiableUntil.Add(time.Hour)); err == nil {
+		t.Fatal("expected the extension to fail")
+	}
+	verifier, err := r.GetVerifier(key.ID)
+	if err != nil {
+		t.Fatalf("expected the verifier to be restored, got %v", err)
+	}
+	if !verifier.ExpiresAt.Equal(key.VerifiableUntil) {
+		t.Errorf("got ExpiresAt %v want %v", verifier.ExpiresAt, key.VerifiableUntil)
+	}
+}
+
+func TestExtendVerifierRevoked(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	r := ring.NewWithOptions(s, ring.Options{
+		RotationFrequency:    1 * time.Hour,
+		MaxVerifierExtension: 5 * time.Hour,
+	})
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A revocation in progress has recorded the revocation, but not yet
+	// deleted the public key
+	if err := s.Add(store.Key{ID: "revoked:" + key.ID, ExpiresAt: key.VerifiableUntil}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ExtendVerifier(key.ID, key.VerifiableUntil.Add(time.Hour)); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound for a revoked key, got %v", err)
+	}
+}
+
+func TestRevokeAndRevocationList(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	var hooked []string
+	r := ring.NewWithOptions(s, ring.Options{
+		RotationFrequency: 1 * time.Hour,
+		OnRevoke: func(id string) {
+			hooked = append(hooked, id)
+		},
+	})
+
+	revoked, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Revoke(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(hooked) != 1 || hooked[0] != revoked.ID {
+		t.Errorf("expected OnRevoke to be called with %v, got %v", revoked.ID, hooked)
+	}
+	if _, err := s.Find(revoked.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected private key to be deleted, got %v", err)
+	}
+
+	if _, err := r.GetVerifier(revoked.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	current, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.ID == revoked.ID {
+		t.Errorf("expected revoked signing key to be rotated")
+	}
+
+	rl, err := r.RevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.KeyIDs) != 1 || rl.KeyIDs[0] != revoked.ID {
+		t.Errorf("got revoked ids %v want [%v]", rl.KeyIDs, revoked.ID)
+	}
+
+	verifier, err := r.GetVerifier(rl.SignerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Verify(verifier); err != nil {
+		t.Errorf("could not verify revocation list: %v", err)
+	}
+
+	rl.KeyIDs = nil
+	if err := rl.Verify(verifier); err == nil {
+		t.Errorf("expected tampered revocation list to fail verification")
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		TombstoneTTL:      24 * time.Hour,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Revoke(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = keychain.GetVerifier(revoked.ID)
+	var tombstone *ring.TombstoneError
+	if !errors.Is(err, ring.ErrKeyRevoked) || !errors.Is(err, ring.ErrKeyNotFound) || !errors.As(err, &tombstone) {
+		t.Fatalf("expected ErrKeyRevoked, got %v", err)
+	}
+	if tombstone.Tombstone.KeyID != revoked.ID || !tombstone.Tombstone.At.Equal(clock.Now()) {
+		t.Errorf("unexpected tombstone %+v", tombstone.Tombstone)
+	}
+	if _, err := keychain.GetVerifier("unknown"); !errors.Is(err, ring.ErrKeyNotFound) || errors.Is(err, ring.ErrKeyRevoked) {
+		t.Errorf("expected ErrKeyNotFound for an unknown key, got %v", err)
+	}
+
+	expired, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(3 * time.Hour)
+	if _, err := keychain.GetVerifier(expired.ID); !errors.Is(err, ring.ErrKeyExpired) {
+		t.Errorf("expected ErrKeyExpired, got %v", err)
+	}
+	if err := keychain.PurgeExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.GetVerifier(expired.ID); !errors.Is(err, ring.ErrKeyExpired) {
+		t.Errorf("expected ErrKeyExpired after the key is purged, got %v", err)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if _, err := keychain.GetVerifier(revoked.ID); err != ring.ErrKeyNotFound {
+		t.Errorf("expected the tombstone to expire, got %v", err)
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	store := inmem.NewInMemoryStore()
+
+	r1 := ring.NewWithOptions(store, ring.Options{
+		RotationFrequency: 1 * time.Hour,
+		InstanceID:        "one",
+	})
+	r2 := ring.NewWithOptions(store, ring.Options{
+		RotationFrequency: 1 * time.Hour,
+		InstanceID:        "two",
+	})
+
+	drifts, err := r1.DetectDrift(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("expected no drift, got %v", drifts)
+	}
+
+	if err := r1.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	drifts, err = r1.DetectDrift(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("expected drift to be below threshold, got %v", drifts)
+	}
+
+	drifts, err = r2.DetectDrift(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 {
+		t.Fatalf("expected one drifting instance, got %v", drifts)
+	}
+	if drifts[0].InstanceID != "two" {
+		t.Errorf("got drifting instance %v want %v", drifts[0].InstanceID, "two")
+	}
+}
+
+// lockFailingStore fails to take the store lock while fail is set, so that
+// rotations fail
+type lockFailingStore struct {
+	store.Store
+	fail int32
+}
+
+func (s *lockFailingStore) Lock() error {
+	if atomic.LoadInt32(&s.fail) != 0 {
+		return errors.New("lock unavailable")
+	}
+	return s.Store.(store.Locker).Lock()
+}
+
+func (s *lockFailingStore) Unlock() error {
+	return s.Store.(store.Locker).Unlock()
+}
+
+// minimalStore only implements store.Store, without a lock of its own
+type minimalStore struct {
+	store.Store
+}
+
+func TestKeychainWithoutStoreLock(t *testing.T) {
+	keychain, err := ring.NewKeychain(minimalStore{Store: inmem.NewInMemoryStore()}, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Rotate(); err != nil {
+		t.Fatalf("expected rotation with a process local lock, got %v", err)
+	}
+	after, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.ID == before.ID {
+		t.Error("expected the key to be rotated")
+	}
+}
+
+// driftCollector records the drifting instances reported to a
+// MetricsCollector
+type driftCollector struct {
+	drifting int32
+}
+
+func (c *driftCollector) Rotated()                                    {}
+func (c *driftCollector) RotationFailed()                             {}
+func (c *driftCollector) KeyGenerated(ring.Algorithm, time.Duration)  {}
+func (c *driftCollector) StoreOperation(string, time.Duration, error) {}
+func (c *driftCollector) DriftingInstances(count int)                 { atomic.StoreInt32(&c.drifting, int32(count)) }
+
+func TestDriftReportedByWorker(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: 3 * time.Hour,
+		Clock:              clock,
+	}
+	one := ring.NewWithOptions(s, options)
+	defer one.Close()
+	initial, err := one.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second instance fails all its rotations, and keeps signing with
+	// the initial key while the first one rotates
+	failing := &lockFailingStore{Store: s}
+	drifts := make(chan ring.Drift, 100)
+	collector := &driftCollector{}
+	options.InstanceID = "stale"
+	options.AutoRotate = true
+	options.DriftThreshold = 10 * time.Minute
+	options.OnDrift = func(drift ring.Drift) { drifts <- drift }
+	options.MetricsCollector = collector
+	two, err := ring.NewKeychain(failing, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer two.Close()
+	atomic.StoreInt32(&failing.fail, 1)
+
+	// The worker is idle while waiting for a timer
+	idle := func() {
+		for clock.PendingTimers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	advance := func(d time.Duration) {
+		idle()
+		clock.Advance(d)
+	}
+	advance(time.Hour + time.Second)
+	next, err := one.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == initial.ID {
+		t.Fatal("expected the first instance to rotate")
+	}
+
+	var drift ring.Drift
+	for drift.InstanceID == "" {
+		select {
+		case drift = <-drifts:
+		default:
+			advance(30 * time.Second)
+		}
+		if clock.Now().After(next.RotatedAt) {
+			t.Fatal("expected the stale instance to be reported")
+		}
+	}
+	if drift.InstanceID != "stale" || drift.KeyID != initial.ID || drift.ExpectedKeyID != next.ID {
+		t.Errorf("expected the stale instance to be reported using %s instead of %s, got %+v", initial.ID, next.ID, drift)
+	}
+	if drift.Duration <= options.DriftThreshold || drift.Duration > 20*time.Minute {
+		t.Errorf("expected drift for just over %v, got %v", options.DriftThreshold, drift.Duration)
+	}
+	if atomic.LoadInt32(&collector.drifting) != 1 {
+		t.Errorf("expected 1 drifting instance to be collected, got %d", atomic.LoadInt32(&collector.drifting))
+	}
+
+	// Drift is counted from the first newer key, not the newest one
+	advance(time.Hour)
+	if _, err := one.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	idle()
+	found, err := one.DetectDrift(options.DriftThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Duration < time.Hour {
+		t.Errorf("expected the stale instance to be drifting for over an hour, got %+v", found)
+	}
+}
+
+func TestGetVerifierByFingerprint(t *testing.T) {
+	r := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+		RotationFrequency: 1 * time.Hour,
+	})
+
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := r.GetVerifier(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Fingerprint() != verifier.Fingerprint() {
+		t.Errorf("expected the signing key fingerprint %v to match its verifier, got %v", verifier.Fingerprint(), key.Fingerprint())
+	}
+	if status, err := r.Status(); err != nil || status.Fingerprint != key.Fingerprint() {
+		t.Errorf("expected status to report fingerprint %v, got %+v (%v)", key.Fingerprint(), status, err)
+	}
+
+	for _, rendered := range []string{verifier.Fingerprint().Hex(), verifier.Fingerprint().Base64()} {
+		fingerprint, err := ring.ParseFingerprint(rendered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, err := r.GetVerifierByFingerprint(fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.ID != key.ID {
+			t.Errorf("got verifier %v want %v", found.ID, key.ID)
+		}
+	}
+
+	if _, err := r.GetVerifierByFingerprint(ring.Fingerprint{}); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestFingerprintOfInvalidKey(t *testing.T) {
+	verifier := &ring.VerifierKey{ID: "invalid", Key: "not a key"}
+	if fingerprint := verifier.Fingerprint(); !fingerprint.IsZero() {
+		t.Errorf("expected the zero fingerprint, got %v", fingerprint)
+	}
+	key, err := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{}).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Fingerprint().IsZero() {
+		t.Error("expected the fingerprint of a valid key not to be zero")
+	}
+}
+
+func TestVerifierKeyEqual(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.ECDSAP256, ring.Ed25519} {
+		r := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+			Algorithm:         algorithm,
+			RotationFrequency: 1 * time.Hour,
+		})
+		key, err := r.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := r.GetVerifier(key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		same := &ring.VerifierKey{ID: "other", Key: key.Key.Public()}
+		if !verifier.Equal(same) || !same.Equal(verifier) {
+			t.Errorf("%s: expected verifiers of the same key to be equal", algorithm)
+		}
+		if err := r.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		next, err := r.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := r.GetVerifier(next.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verifier.Equal(other) || verifier.Equal(nil) {
+			t.Errorf("%s: expected verifiers of different keys not to be equal", algorithm)
+		}
+
+		thumbprint, err := same.Thumbprint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verifier.HasThumbprint(thumbprint) || other.HasThumbprint(thumbprint) {
+			t.Errorf("%s: expected thumbprint %s to only match the verifier of its key", algorithm, thumbprint)
+		}
+	}
+}
+
+func TestEd25519Keys(t *testing.T) {
+	r := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm: ring.Ed25519,
+	})
+
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.Key.(ed25519.PrivateKey); !ok {
+		t.Fatalf("expected ed25519 private key, got %T", key.Key)
+	}
+
+	verifier, err := r.GetVerifier(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, ok := verifier.Key.(ed25519.PublicKey)
+	if !ok {
+		t.Fatalf("expected ed25519 public key, got %T", verifier.Key)
+	}
+
+	message := []byte("hello")
+	if !ed25519.Verify(pub, message, ed25519.Sign(key.Key.(ed25519.PrivateKey), message)) {
+		t.Errorf("signature did not verify")
+	}
+
+	rl, err := r.RevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Verify(verifier); err != nil {
+		t.Errorf("could not verify revocation list: %v", err)
+	}
+}
+
+func TestECDSAKeys(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.ECDSAP256, ring.ECDSAP384, ring.ECDSAP521} {
+		r := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+			Algorithm: algorithm,
+		})
+
+		key, err := r.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := key.Key.(*ecdsa.PrivateKey); !ok {
+			t.Fatalf("expected ecdsa private key, got %T", key.Key)
+		}
+
+		verifiers, err := r.ListVerifiers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := verifiers[0].Key.(*ecdsa.PublicKey); !ok {
+			t.Fatalf("expected ecdsa public key, got %T", verifiers[0].Key)
+		}
+
+		rl, err := r.RevocationList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rl.Verify(verifiers[0]); err != nil {
+			t.Errorf("%v: could not verify revocation list: %v", algorithm, err)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.ECDSAP521, ring.Ed25519} {
+		r := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{
+			Algorithm: algorithm,
+		})
+		key, err := r.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := r.JWKS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var set ring.JWKSet
+		if err := json.Unmarshal(data, &set); err != nil {
+			t.Fatal(err)
+		}
+		if len(set.Keys) != 1 {
+			t.Fatalf("got %d keys want 1", len(set.Keys))
+		}
+
+		jwk := set.Keys[0]
+		if jwk.KeyID != key.ID {
+			t.Errorf("got kid %v want %v", jwk.KeyID, key.ID)
+		}
+		switch algorithm {
+		case ring.RSA:
+			if jwk.KeyType != "RSA" || jwk.E != "AQAB" || jwk.N == "" {
+				t.Errorf("unexpected RSA JWK: %+v", jwk)
+			}
+		case ring.ECDSAP521:
+			if jwk.KeyType != "EC" || jwk.Curve != "P-521" || len(jwk.X) != 88 || len(jwk.Y) != 88 {
+				t.Errorf("unexpected EC JWK: %+v", jwk)
+			}
+		case ring.Ed25519:
+			if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || len(jwk.X) != 43 {
+				t.Errorf("unexpected OKP JWK: %+v", jwk)
+			}
+		}
+	}
+}
+
+func TestJWKSRevoked(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	revoked, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Revoke(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := keychain.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set ring.JWKSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+	flags := map[string]bool{}
+	for _, jwk := range set.Keys {
+		flags[jwk.KeyID] = jwk.Revoked
+	}
+	if len(flags) != 2 || !flags[revoked.ID] || flags[current.ID] {
+		t.Errorf("expected only %s to be flagged as revoked, got %v", revoked.ID, flags)
+	}
+	if !strings.Contains(string(data), `"revoked":true`) || strings.Count(string(data), `"revoked"`) != 1 {
+		t.Errorf("expected a single revoked flag, got %s", data)
+	}
+	if _, err := keychain.GetVerifier(revoked.ID); err == nil {
+		t.Error("expected the revoked key not to be usable for verification")
+	}
+}
+
+func TestNewKeychainReturnsErrors(t *testing.T) {
+	_, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		RotationFrequency:  2 * time.Hour,
+		VerificationPeriod: 1 * time.Hour,
+	})
+	if err == nil {
+		t.Errorf("expected error for invalid options")
+	}
+
+	s := inmem.NewInMemoryStore()
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ring.NewKeychain(s, ring.Options{LockRetryPolicy: ring.LockRetryPolicy{Attempts: 1}})
+	if !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	s := store.WithContext(inmem.NewInMemoryStore())
+	keychain, err := ring.NewKeychainContext(context.Background(), s, ring.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := keychain.GetVerifierContext(ctx, signingKey.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if err := keychain.RotateContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// A failed rotation must not leave the store locked
+	if err := keychain.Rotate(); err != nil {
+		t.Errorf("expected rotation to succeed, got %v", err)
+	}
+}
+
+func TestAutoRotate(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  50 * time.Millisecond,
+		VerificationPeriod: 10 * time.Second,
+		AutoRotate:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+
+	if err := keychain.Start(context.Background()); !errors.Is(err, ring.ErrWorkerRunning) {
+		t.Errorf("expected ErrWorkerRunning, got %v", err)
+	}
+
+	// Keys must be rotated without any calls to SigningKey
+	time.Sleep(300 * time.Millisecond)
+	verifiers, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) < 3 {
+		t.Errorf("expected at least 3 verifiers, got %d", len(verifiers))
+	}
+
+	if err := keychain.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Start(context.Background()); err != nil {
+		t.Errorf("expected restart after Close to succeed, got %v", err)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.Ed25519, ring.ECDSAP256, ring.ECDSAP384} {
+		keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: algorithm})
+
+		data := []byte("hello world")
+		signature, keyID, err := keychain.Sign(data)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if err := keychain.Verify(keyID, data, signature); err != nil {
+			t.Errorf("%s: expected valid signature, got %v", algorithm, err)
+		}
+		if err := keychain.Verify(keyID, []byte("tampered"), signature); !errors.Is(err, ring.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", algorithm, err)
+		}
+		if err := keychain.Verify(keyID, data, append(signature, 0)); !errors.Is(err, ring.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature with a byte appended, got %v", algorithm, err)
+		}
+		if err := keychain.Verify("unknown", data, signature); !errors.Is(err, ring.ErrKeyNotFound) {
+			t.Errorf("%s: expected ErrKeyNotFound, got %v", algorithm, err)
+		}
+	}
+}
+
+func TestListVerifiersWithMeta(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		PrePublishWindow:  10 * time.Minute,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers, meta, err := keychain.ListVerifiersWithMeta(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || !meta.CacheUntil.Equal(current.RotatedAt) {
+		t.Errorf("expected list to be cacheable until rotation at %v, got %v", current.RotatedAt, meta.CacheUntil)
+	}
+	if want := current.RotatedAt.Sub(clock.Now()); meta.MaxAge != want {
+		t.Errorf("expected list to be cacheable for %v on the keychain clock, got %v", want, meta.MaxAge)
+	}
+
+	// Once the next key is published, the list stays valid past the
+	// rotation
+	clock.Advance(55 * time.Minute)
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	verifiers, meta, err = keychain.ListVerifiersWithMeta(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := current.RotatedAt.Add(10 * time.Minute); len(verifiers) != 2 || !meta.CacheUntil.Equal(want) {
+		t.Errorf("expected list of %d keys to be cacheable until %v, got %v", len(verifiers), want, meta.CacheUntil)
+	}
+
+	// Keys expiring earlier limit it further
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := clock.Now().Add(time.Minute)
+	if _, err := keychain.ImportSigningKey(key, ring.ImportOptions{VerifiableUntil: expiresAt}); err != nil {
+		t.Fatal(err)
+	}
+	if _, meta, err := keychain.ListVerifiersWithMeta(context.Background()); err != nil || !meta.CacheUntil.Equal(expiresAt) {
+		t.Errorf("expected list to be cacheable until %v, got %v (%v)", expiresAt, meta.CacheUntil, err)
+	}
+}
+
+func TestStreamSigner(t *testing.T) {
+	data := bytes.Repeat([]byte("hello world "), 100000)
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.Ed25519, ring.ECDSAP256, ring.ECDSAP384} {
+		keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: algorithm})
+
+		signer, err := ring.NewStreamSigner(keychain)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if _, err := io.Copy(signer, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		signature, keyID, err := signer.Finalize()
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if keyID != signer.KeyID() {
+			t.Errorf("%s: expected key ID %v, got %v", algorithm, signer.KeyID(), keyID)
+		}
+		if err := ring.VerifyStream(keychain, keyID, bytes.NewReader(data), signature); err != nil {
+			t.Errorf("%s: expected valid signature, got %v", algorithm, err)
+		}
+		if err := ring.VerifyStream(keychain, keyID, bytes.NewReader(data[1:]), signature); !errors.Is(err, ring.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", algorithm, err)
+		}
+		if err := keychain.Verify(keyID, data, signature); (algorithm != ring.Ed25519) != (err == nil) {
+			t.Errorf("%s: unexpected result of Verify: %v", algorithm, err)
+		}
+	}
+}
+
+func TestPrePublishWindow(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		PrePublishWindow:  10 * time.Minute,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(55 * time.Minute)
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != current.ID {
+		t.Errorf("expected signing key to remain %v, got %v", current.ID, key.ID)
+	}
+	verifiers, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 2 {
+		t.Fatalf("expected next verifier to be published, got %d verifiers", len(verifiers))
+	}
+	var next string
+	for _, verifier := range verifiers {
+		if verifier.ID != current.ID {
+			next = verifier.ID
+		}
+	}
+
+	clock.Advance(6 * time.Minute)
+	key, err = keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != next {
+		t.Errorf("expected published key %v to become active, got %v", next, key.ID)
+	}
+	if want := time.Date(2020, 1, 1, 2, 0, 0, 0, time.UTC); !key.RotatedAt.Equal(want) {
+		t.Errorf("expected key to rotate at %v, got %v", want, key.RotatedAt)
+	}
+}
+
+// generationCounter is a ring.MetricsCollector counting generated keys
+type generationCounter struct {
+	generated int32
+}
+
+func (c *generationCounter) Rotated()        {}
+func (c *generationCounter) RotationFailed() {}
+func (c *generationCounter) KeyGenerated(ring.Algorithm, time.Duration) {
+	atomic.AddInt32(&c.generated, 1)
+}
+func (c *generationCounter) StoreOperation(string, time.Duration, error) {}
+
+func TestPregenerateKeys(t *testing.T) {
+	counter := &generationCounter{}
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:        ring.Ed25519,
+		PregenerateKeys:  2,
+		MetricsCollector: counter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+
+	// The first key and the pool
+	for atomic.LoadInt32(&counter.generated) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := keychain.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := keychain.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if generated := atomic.LoadInt32(&counter.generated); generated != 3 {
+		t.Errorf("expected rotations to use pregenerated keys, got %d generated keys", generated)
+	}
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if generated := atomic.LoadInt32(&counter.generated); generated != 4 {
+		t.Errorf("expected a key to be generated once the pool is empty, got %d generated keys", generated)
+	}
+}
+
+func TestSigningGracePeriod(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		SigningGracePeriod: 5 * time.Minute,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate another instance holding the lock while rotating
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(61 * time.Minute)
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatalf("expected previous key within grace period, got %v", err)
+	}
+	if key.ID != current.ID {
+		t.Errorf("expected previous key %v, got %v", current.ID, key.ID)
+	}
+
+	clock.Advance(5 * time.Minute)
+	if _, err := keychain.SigningKey(); !errors.Is(err, ring.ErrKeyRotation) {
+		t.Errorf("expected ErrKeyRotation after grace period, got %v", err)
+	}
+
+	if err := s.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	key, err = keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID == current.ID {
+		t.Errorf("expected key to be rotated")
+	}
+}
+
+func TestRotationLockWait(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		RotationLockWait:  50 * time.Millisecond,
+		LockRetryPolicy:   ring.LockRetryPolicy{Attempts: 1, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond},
+		// Only the time is faked, so waiting uses real timers
+		Clock: struct{ ring.Clock }{clock},
+	}
+	one, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	two, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(61 * time.Minute)
+	rotated, err := two.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate the other instance still holding the lock
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	key, err := one.SigningKey()
+	if err != nil {
+		t.Fatalf("expected key of other instance, got %v", err)
+	}
+	if key.ID != rotated.ID {
+		t.Errorf("expected key %v of other instance, got %v", rotated.ID, key.ID)
+	}
+
+	clock.Advance(61 * time.Minute)
+	if _, err := one.SigningKey(); !errors.Is(err, ring.ErrKeyRotation) {
+		t.Errorf("expected ErrKeyRotation when no key shows up, got %v", err)
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:               ring.Ed25519,
+		RotationFrequency:       time.Hour,
+		HealthRotationThreshold: 30 * time.Minute,
+		LockRetryPolicy:         ring.LockRetryPolicy{Attempts: 1},
+		Clock:                   clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := keychain.Healthy(ctx); err != nil {
+		t.Errorf("expected healthy keychain, got %v", err)
+	}
+
+	clock.Advance(91 * time.Minute)
+	if err := keychain.Healthy(ctx); !errors.Is(err, ring.ErrUnhealthy) {
+		t.Errorf("expected overdue rotation to be unhealthy, got %v", err)
+	}
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Healthy(ctx); err != nil {
+		t.Errorf("expected healthy keychain after rotation, got %v", err)
+	}
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(61 * time.Minute)
+	if _, err := keychain.SigningKey(); err == nil {
+		t.Fatal("expected rotation to fail")
+	}
+	if err := keychain.Healthy(ctx); !errors.Is(err, ring.ErrUnhealthy) {
+		t.Errorf("expected failed rotation to be unhealthy, got %v", err)
+	}
+	if err := s.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Healthy(ctx); err != nil {
+		t.Errorf("expected healthy keychain after recovering, got %v", err)
+	}
+}
+
+func TestRotationOverdue(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	var alerts []time.Duration
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:                ring.Ed25519,
+		RotationFrequency:        time.Hour,
+		SigningGracePeriod:       time.Hour,
+		RotationOverdueThreshold: 15 * time.Minute,
+		OnRotationOverdue: func(key *ring.SigningKey, overdue time.Duration) {
+			alerts = append(alerts, overdue)
+		},
+		LockRetryPolicy: ring.LockRetryPolicy{Attempts: 1},
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	for _, advance := range []time.Duration{70 * time.Minute, 10 * time.Minute, 10 * time.Minute} {
+		clock.Advance(advance)
+		if _, err := keychain.SigningKey(); err != nil {
+			t.Fatalf("expected the key to be kept within the grace period, got %v", err)
+		}
+	}
+	if len(alerts) != 1 || alerts[0] != 20*time.Minute {
+		t.Errorf("expected a single alert 20m past the rotation, got %v", alerts)
+	}
+
+	if err := s.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Errorf("expected no alert for successful rotations, got %v", alerts)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		LockRetryPolicy:   ring.LockRetryPolicy{Attempts: 1},
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := keychain.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.KeyID != first.ID || !status.NextRotation.Equal(first.RotatedAt) || status.ActiveVerifiers != 1 || !status.LastRotation.IsZero() {
+		t.Errorf("unexpected status before rotation: %+v", status)
+	}
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := keys.Stats(); status.Store != want || status.Store.PrivateKeys == 0 || status.Store.PublicKeys == 0 || status.Store.Bytes == 0 {
+		t.Errorf("unexpected store stats %+v, want %+v", status.Store, want)
+	}
+
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	if err := keychain.Rotate(); err == nil {
+		t.Fatal("expected rotation to fail")
+	}
+	status, err = keychain.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.KeyID == first.ID || status.ActiveVerifiers != 2 || !status.LastRotation.Equal(clock.Now()) || status.LastRotationError == nil {
+		t.Errorf("unexpected status after failed rotation: %+v", status)
+	}
+}
+
+func TestListVerifiersPage(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		clock.Advance(time.Minute)
+		if err := keychain.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 5 {
+		t.Fatalf("expected 5 verifiers, got %d", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].ExpiresAt.Before(all[i-1].ExpiresAt) {
+			t.Fatalf("verifiers not ordered by expiry: %v before %v", all[i-1].ExpiresAt, all[i].ExpiresAt)
+		}
+	}
+
+	var paged []*ring.VerifierKey
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(all) {
+			t.Fatal("pagination did not terminate")
+		}
+		keys, next, err := keychain.ListVerifiersPage(cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("expected %d paged verifiers, got %d", len(all), len(paged))
+	}
+	for i := range all {
+		if paged[i].ID != all[i].ID {
+			t.Errorf("page order differs at %d: %s != %s", i, paged[i].ID, all[i].ID)
+		}
+	}
+
+	if _, _, err := keychain.ListVerifiersPage("not a cursor", 2); err != ring.ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+	if _, _, err := keychain.ListVerifiersPage("", 0); err == nil {
+		t.Error("expected error for zero limit")
+	}
+}
+
+func TestClockSkewTolerance(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	slow := sim.NewClock(start)
+	fast := sim.NewClock(start.Add(30 * time.Second))
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		ClockSkewTolerance: time.Minute,
+	}
+	options.Clock = slow
+	first, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.Clock = fast
+	second, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := first.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The instance ahead waits for the tolerance before rotating
+	slow.Advance(time.Hour)
+	fast.Advance(time.Hour)
+	if current, err := second.SigningKey(); err != nil || current.ID != key.ID {
+		t.Errorf("expected key %s within the tolerance, got %v", key.ID, err)
+	}
+
+	// and still finds verifiers just past their expiry
+	slow.Advance(time.Hour)
+	fast.Advance(time.Hour)
+	if _, err := second.GetVerifier(key.ID); err != nil {
+		t.Errorf("expected verifier within the tolerance, got %v", err)
+	}
+	fast.Advance(time.Minute)
+	if _, err := second.GetVerifier(key.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected verifier to expire after the tolerance, got %v", err)
+	}
+}
+
+func TestAutoRotateClockSkewTolerance(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		ClockSkewTolerance: time.Minute,
+		CleanupInterval:    -1,
+		AutoRotate:         true,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker is idle while waiting for a timer, and doesn't spin on
+	// timers firing right away within the tolerance
+	advance := func(d time.Duration) {
+		deadline := time.Now().Add(5 * time.Second)
+		for clock.PendingTimers() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the worker to be idle")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(d)
+	}
+	for clock.Now().Before(key.RotatedAt.Add(50 * time.Second)) {
+		advance(10 * time.Second)
+	}
+	advance(0)
+	if verifiers, err := keychain.ListVerifiers(); err != nil || len(verifiers) != 1 {
+		t.Fatalf("expected no rotation within the tolerance, got %d verifiers: %v", len(verifiers), err)
+	}
+
+	advance(11 * time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		verifiers, err := keychain.ListVerifiers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(verifiers) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the worker to rotate after the tolerance")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSecretKeychain(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	encryptor, err := crypt.NewAESGCM(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{RotationFrequency: time.Hour, Encryptor: encryptor, Clock: clock}
+	if _, err := ring.NewSecretKeychain(s, ring.Options{}); err == nil {
+		t.Error("expected secret keychains to require an Encryptor")
+	}
+	first, err := ring.NewSecretKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ring.NewSecretKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := first.SigningSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adopted, err := second.SigningSecret(); err != nil || adopted.ID != secret.ID {
+		t.Fatalf("expected instances to share secret %s, got %v", secret.ID, err)
+	}
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || bytes.Contains(keys[0].Data, secret.Key) {
+		t.Errorf("expected a single encrypted secret in the store")
+	}
+
+	signature, keyID, err := first.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected signature to verify, got %v", err)
+	}
+	if err := second.Verify(keyID, []byte("other"), signature); !errors.Is(err, ring.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	// Signing keychains sharing the store ignore the secrets
+	keychain, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519, Encryptor: encryptor, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(61 * time.Minute)
+	rotated, err := second.SigningSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ID == secret.ID {
+		t.Error("expected secret to be rotated")
+	}
+	if err := first.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected rotated secret to still verify, got %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	if err := first.Verify(keyID, []byte("data"), signature); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound after the verification period, got %v", err)
+	}
+}
+
+func TestEncryptionKeychain(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	encryptor, err := crypt.NewAESGCM(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{RotationFrequency: time.Hour, Encryptor: encryptor, Clock: clock}
+	if _, err := ring.NewEncryptionKeychain(s, ring.Options{}); err == nil {
+		t.Error("expected encryption keychains to require an Encryptor")
+	}
+	first, err := ring.NewEncryptionKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ring.NewEncryptionKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Secret keychains sharing the store ignore the encryption keys
+	secrets, err := ring.NewSecretKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := first.Encrypt([]byte("pii"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("pii")) {
+		t.Error("expected plaintext to be encrypted")
+	}
+	if plaintext, err := second.Decrypt(ciphertext); err != nil || string(plaintext) != "pii" {
+		t.Errorf("expected to decrypt %q, got %q: %v", "pii", plaintext, err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := second.Decrypt(ciphertext); !errors.Is(err, ring.ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt, got %v", err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if secret, err := secrets.SigningSecret(); err != nil {
+		t.Fatal(err)
+	} else if _, err := first.GetDecrypter(secret.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected secrets not to be encryption keys, got %v", err)
+	}
+
+	key, err := first.EncryptionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := key.Encrypt([]byte("field"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(61 * time.Minute)
+	if rotated, err := second.EncryptionKey(); err != nil || rotated.ID == key.ID {
+		t.Fatalf("expected key to be rotated, got %v", err)
+	}
+	decrypter, err := second.GetDecrypter(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := decrypter.Decrypt(sealed); err != nil || string(plaintext) != "field" {
+		t.Errorf("expected rotated key to still decrypt, got %q: %v", plaintext, err)
+	}
+
+	clock.Advance(time.Hour)
+	if _, err := first.Decrypt(ciphertext); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound after the verification period, got %v", err)
+	}
+}
+
+func TestTenantSigner(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"", "a" + ring.TenantSeparator + "b"} {
+		if _, err := keychain.TenantSigner(tenantID); !errors.Is(err, ring.ErrInvalidTenant) {
+			t.Errorf("expected ErrInvalidTenant for %q, got %v", tenantID, err)
+		}
+	}
+	signer, err := keychain.TenantSigner("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, keyID, err := signer.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != ring.TenantKeyID(root.ID, "acme") {
+		t.Errorf("expected key ID %s, got %s", ring.TenantKeyID(root.ID, "acme"), keyID)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected tenant signature to verify, got %v", err)
+	}
+	verifier, err := keychain.GetVerifier(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier.ID != keyID || verifier.TenantID != "acme" {
+		t.Errorf("expected verifier of tenant acme, got %s of %q", verifier.ID, verifier.TenantID)
+	}
+	if _, err := keychain.GetVerifier(ring.TenantKeyID("unknown", "acme")); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound for an unknown root key, got %v", err)
+	}
+	if keyID, tenantID, ok := ring.ParseTenantKeyID(root.ID); ok {
+		t.Errorf("expected %s not to be a tenant key ID, got %s and %s", root.ID, keyID, tenantID)
+	}
+}
+
+func TestStagedRotation(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, StagedRotation: true, Clock: clock}
+	first, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := first.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Promote(); !errors.Is(err, ring.ErrNoStagedKey) {
+		t.Errorf("expected ErrNoStagedKey, got %v", err)
+	}
+
+	clock.Advance(5 * time.Minute)
+	if err := first.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := first.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := first.SigningKey(); err != nil || key.ID != current.ID {
+		t.Fatalf("expected staging to keep signing with %s, got %v", current.ID, err)
+	}
+	if status.StagedKeyID == "" || status.StagedKeyID == current.ID {
+		t.Fatalf("expected a new staged key, got %q", status.StagedKeyID)
+	}
+	if _, err := second.GetVerifier(status.StagedKeyID); err != nil {
+		t.Errorf("expected staged key to be published, got %v", err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if err := first.Promote(); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := first.SigningKey(); err != nil || key.ID != status.StagedKeyID {
+		t.Errorf("expected promoted key %s, got %v", status.StagedKeyID, err)
+	}
+	// Instances created after the promotion pick up the promoted key
+	restarted, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := restarted.SigningKey(); err != nil || key.ID != status.StagedKeyID {
+		t.Errorf("expected restarted instance to use %s, got %v", status.StagedKeyID, err)
+	}
+	clock.Advance(46 * time.Minute)
+	if key, err := second.SigningKey(); err != nil || key.ID != status.StagedKeyID {
+		t.Errorf("expected other instance to adopt %s on rotation, got %v", status.StagedKeyID, err)
+	}
+}
+
+func TestPromotionDelay(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	options := ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, PromotionDelay: 10 * time.Minute, Clock: clock}
+	if _, err := ring.NewKeychain(inmem.NewInMemoryStore(), options); err == nil {
+		t.Error("expected PromotionDelay to require StagedRotation")
+	}
+	options.StagedRotation = true
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(9 * time.Minute)
+	if key, err := keychain.SigningKey(); err != nil || key.ID != current.ID {
+		t.Fatalf("expected %s before the promotion delay, got %v", current.ID, err)
+	}
+	clock.Advance(time.Minute)
+	if key, err := keychain.SigningKey(); err != nil || key.ID == current.ID {
+		t.Errorf("expected staged key to be promoted after the delay, got %v", err)
+	}
+}
+
+func TestPreviousSigningKey(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		RetainSigningKeys: 1,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.PreviousSigningKey(); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound before the first rotation, got %v", err)
+	}
+	first, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(61 * time.Minute)
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err := keychain.PreviousSigningKey(); err != nil || previous.ID != first.ID {
+		t.Errorf("expected previous key %s, got %v", first.ID, err)
+	}
+	second, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(61 * time.Minute)
+	if previous, err := keychain.PreviousSigningKey(); err != nil || previous.ID != second.ID {
+		t.Errorf("expected previous key %s, got %v", second.ID, err)
+	}
+	clock.Advance(3 * time.Hour)
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err := keychain.PreviousSigningKey(); err == nil && previous.ID == second.ID {
+		t.Error("expected keys past their retention not to be returned")
+	}
+}
+
+func TestMaxSignaturesPerKey(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:           ring.Ed25519,
+		MaxSignaturesPerKey: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keychain.TenantSigner("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, first, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, keyID, err := signer.Sign([]byte("data")); err != nil || keyID != ring.TenantKeyID(first, "acme") {
+		t.Fatalf("expected tenant signature with %s, got %v", first, err)
+	}
+	if count, err := keychain.SignatureCount(first); err != nil || count != 2 {
+		t.Errorf("expected 2 signatures, got %d: %v", count, err)
+	}
+
+	signature, second, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatal("expected key to be rotated after MaxSignaturesPerKey")
+	}
+	if err := keychain.Verify(second, []byte("data"), signature); err != nil {
+		t.Error(err)
+	}
+	if count, err := keychain.SignatureCount(second); err != nil || count != 1 {
+		t.Errorf("expected 1 signature with the new key, got %d: %v", count, err)
+	}
+}
+
+func TestStreamSignerCountsSignatures(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:           ring.Ed25519,
+		MaxSignaturesPerKey: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func() (string, error) {
+		signer, err := ring.NewStreamSigner(keychain)
+		if err != nil {
+			return "", err
+		}
+		if _, err := signer.Write([]byte("data")); err != nil {
+			return "", err
+		}
+		signature, keyID, err := signer.Finalize()
+		if err != nil {
+			return "", err
+		}
+		return keyID, ring.VerifyStream(keychain, keyID, bytes.NewReader([]byte("data")), signature)
+	}
+
+	first, err := sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := keychain.SignatureCount(first); err != nil || count != 1 {
+		t.Errorf("expected 1 signature, got %d: %v", count, err)
+	}
+	second, err := sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatal("expected key to be rotated after MaxSignaturesPerKey")
+	}
+	if count, err := keychain.SignatureCount(second); err != nil || count != 1 {
+		t.Errorf("expected 1 signature with the new key, got %d: %v", count, err)
+	}
+}
+
+func TestRotationCreatesOneKeyAcrossInstances(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, Clock: clock}
+	var instances []ring.Keychain
+	for i := 0; i < 3; i++ {
+		keychain, err := ring.NewKeychain(s, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, keychain)
+	}
+
+	clock.Advance(61 * time.Minute)
+	var ids []string
+	for _, keychain := range instances {
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, key.ID)
+	}
+	for i := range ids {
+		if ids[i] != ids[0] {
+			t.Errorf("instance %d got key %v want %v", i, ids[i], ids[0])
+		}
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	private := 0
+	for _, key := range keys {
+		if key.IsPrivate {
+			private++
+		}
+	}
+	// Besides the new key, the expired one may not have been deleted yet
+	if private > 2 {
+		t.Errorf("expected a single new private key, got %d private keys", private)
+	}
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{SignatureAlgorithm: ring.RS256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signingKey.SignatureAlgorithm != ring.RS256 {
+		t.Errorf("expected RS256, got %q", signingKey.SignatureAlgorithm)
+	}
+
+	// Verifiers use the algorithm recorded with the key
+	verifierKey, err := ring.NewVerifierOnly(s).GetVerifier(signingKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifierKey.SignatureAlgorithm != ring.RS256 {
+		t.Errorf("expected RS256, got %q", verifierKey.SignatureAlgorithm)
+	}
+	jwk, err := verifierKey.ToJWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk.Algorithm != "RS256" {
+		t.Errorf("expected JWK alg RS256, got %q", jwk.Algorithm)
+	}
+
+	ed, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519, SignatureAlgorithm: ring.RS256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := ed.SigningKey(); err != nil || key.SignatureAlgorithm != ring.EdDSA {
+		t.Errorf("expected EdDSA for Ed25519 keys, got %v, %v", key, err)
+	}
+
+	if _, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{SignatureAlgorithm: ring.ES256}); err == nil {
+		t.Error("expected error for a signature algorithm not for RSA keys")
+	}
+}
+
+// signatureWith signs message with key, hashing it with hash and using PSS
+// padding for RSA keys if pss is set
+func signatureWith(t *testing.T, key crypto.Signer, hash crypto.Hash, pss bool, message []byte) []byte {
+	h := hash.New()
+	h.Write(message)
+	var opts crypto.SignerOpts = hash
+	if pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+	signature, err := key.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func TestSignatureAlgorithmRoundTrip(t *testing.T) {
+	type wrong struct {
+		hash crypto.Hash
+		pss  bool
+	}
+	for _, test := range []struct {
+		options ring.Options
+		alg     ring.SignatureAlgorithm
+		wrong   []wrong
+	}{
+		{ring.Options{SignatureAlgorithm: ring.RS256}, ring.RS256, []wrong{{crypto.SHA256, true}, {crypto.SHA384, false}}},
+		{ring.Options{SignatureAlgorithm: ring.PS384}, ring.PS384, []wrong{{crypto.SHA384, false}, {crypto.SHA256, true}}},
+		{ring.Options{Algorithm: ring.ECDSAP384}, ring.ES384, []wrong{{crypto.SHA256, false}, {crypto.SHA512, false}}},
+	} {
+		data := []byte("hello world")
+		s := inmem.NewInMemoryStore()
+		keychain := ring.NewWithOptions(s, test.options)
+		signingKey, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signingKey.SignatureAlgorithm != test.alg {
+			t.Fatalf("expected %s, got %s", test.alg, signingKey.SignatureAlgorithm)
+		}
+		verifier, err := keychain.GetVerifier(signingKey.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrongSignatures := func(message []byte) [][]byte {
+			var res [][]byte
+			for _, w := range test.wrong {
+				res = append(res, signatureWith(t, signingKey.Key, w.hash, w.pss, message))
+			}
+			return res
+		}
+
+		// Keychain.Sign uses the padding and hash of the algorithm
+		signature, keyID, err := keychain.Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := test.alg.Hash().New()
+		digest.Write(data)
+		switch pub := verifier.Key.(type) {
+		case *rsa.PublicKey:
+			if test.alg.PSS() {
+				err = rsa.VerifyPSS(pub, test.alg.Hash(), digest.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			} else {
+				err = rsa.VerifyPKCS1v15(pub, test.alg.Hash(), digest.Sum(nil), signature)
+			}
+		case *ecdsa.PublicKey:
+			if !ecdsa.VerifyASN1(pub, digest.Sum(nil), signature) {
+				err = errors.New("invalid ECDSA signature")
+			}
+		}
+		if err != nil {
+			t.Errorf("%s: expected signature using %s, got %v", test.alg, test.alg, err)
+		}
+		if err := keychain.Verify(keyID, data, signature); err != nil {
+			t.Errorf("%s: expected valid signature, got %v", test.alg, err)
+		}
+		for i, signature := range wrongSignatures(data) {
+			if err := keychain.Verify(keyID, data, signature); !errors.Is(err, ring.ErrInvalidSignature) {
+				t.Errorf("%s: expected wrong signature %d to be rejected, got %v", test.alg, i, err)
+			}
+		}
+
+		// VerifyStream accepts signatures of both Sign and StreamSigner
+		if err := ring.VerifyStream(keychain, keyID, bytes.NewReader(data), signature); err != nil {
+			t.Errorf("%s: expected valid stream signature, got %v", test.alg, err)
+		}
+		signer, err := ring.NewStreamSigner(keychain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer.Write(data)
+		streamSignature, _, err := signer.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := keychain.Verify(keyID, data, streamSignature); err != nil {
+			t.Errorf("%s: expected stream signature to verify, got %v", test.alg, err)
+		}
+		for i, signature := range wrongSignatures(data) {
+			if err := ring.VerifyStream(keychain, keyID, bytes.NewReader(data), signature); !errors.Is(err, ring.ErrInvalidSignature) {
+				t.Errorf("%s: expected wrong stream signature %d to be rejected, got %v", test.alg, i, err)
+			}
+		}
+
+		// Revocation lists are signed with the algorithm of the signing key
+		rl, err := keychain.RevocationList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rl.Verify(verifier); err != nil {
+			t.Errorf("%s: expected valid revocation list, got %v", test.alg, err)
+		}
+		payload, err := json.Marshal(struct {
+			IssuedAt time.Time `json:"issued_at"`
+			KeyIDs   []string  `json:"revoked"`
+			SignerID string    `json:"kid"`
+		}{rl.IssuedAt, rl.KeyIDs, rl.SignerID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, signature := range wrongSignatures(payload) {
+			forged := *rl
+			forged.Signature = signature
+			if err := forged.Verify(verifier); !errors.Is(err, ring.ErrInvalidSignature) {
+				t.Errorf("%s: expected wrong revocation list signature %d to be rejected, got %v", test.alg, i, err)
+			}
+		}
+
+		// Sharded keychains sign and verify with the algorithm of each shard
+		sharded, err := ring.NewShardedKeychain(inmem.NewInMemoryStore(), test.options, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shardSignature, shardKeyID, err := sharded.Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sharded.Verify(shardKeyID, data, shardSignature); err != nil {
+			t.Errorf("%s: expected valid sharded signature, got %v", test.alg, err)
+		}
+		shardVerifier, err := sharded.GetVerifier(shardKeyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			shardKey, err := sharded.SigningKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shardKey.SignatureAlgorithm != test.alg {
+				t.Errorf("%s: expected shard key using %s, got %s", test.alg, test.alg, shardKey.SignatureAlgorithm)
+			}
+			if !shardVerifier.Equal(&ring.VerifierKey{Key: shardKey.Key.Public()}) {
+				continue
+			}
+			for j, w := range test.wrong {
+				signature := signatureWith(t, shardKey.Key, w.hash, w.pss, data)
+				if err := sharded.Verify(shardKeyID, data, signature); !errors.Is(err, ring.ErrInvalidSignature) {
+					t.Errorf("%s: expected wrong sharded signature %d to be rejected, got %v", test.alg, j, err)
+				}
+			}
+		}
+		sharded.Close()
+	}
+}
+
+func TestRotationJitter(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	options := ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		RotationJitter:    0.5,
+		Clock:             sim.NewClock(start),
+	}
+	rotations := make(map[time.Time]bool)
+	for i := 0; i < 10; i++ {
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.RotatedAt.Before(start.Add(30*time.Minute)) || key.RotatedAt.After(start.Add(time.Hour)) {
+			t.Errorf("expected rotation within the jitter, got %v", key.RotatedAt)
+		}
+		rotations[key.RotatedAt] = true
+	}
+	if len(rotations) < 2 {
+		t.Errorf("expected rotations to be spread out, got %v", rotations)
+	}
+
+	options.RotationJitter = 1
+	if _, err := ring.NewKeychain(inmem.NewInMemoryStore(), options); err == nil {
+		t.Errorf("expected error for jitter of the whole RotationFrequency")
+	}
+}
+
+// fakeHSM is a ring.KeyGenerator keeping its keys in memory, handing out
+// their index as reference
+type fakeHSM struct {
+	mu   sync.Mutex
+	keys []crypto.Signer
+}
+
+func (h *fakeHSM) GenerateKey(algorithm ring.Algorithm, size int) (crypto.Signer, []byte, error) {
+	if algorithm != ring.Ed25519 {
+		return nil, nil, fmt.Errorf("unsupported algorithm %v", algorithm)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.keys = append(h.keys, key)
+	return key, []byte(strconv.Itoa(len(h.keys) - 1)), nil
+}
+
+func (h *fakeHSM) LoadKey(ref []byte) (crypto.Signer, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i, err := strconv.Atoi(string(ref))
+	if err != nil || i < 0 || i >= len(h.keys) {
+		return nil, errors.New("no such key")
+	}
+	return h.keys[i], nil
+}
+
+func TestKeyGenerator(t *testing.T) {
+	hsm := &fakeHSM{}
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, KeyGenerator: hsm}
+	keychain, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hsm.keys) != 1 || !bytes.Equal(signingKey.Key.(ed25519.PrivateKey), hsm.keys[0].(ed25519.PrivateKey)) {
+		t.Fatal("expected the key of the generator")
+	}
+
+	// Only the reference is stored
+	stored, err := s.Find(signingKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Metadata[ring.MetadataKeyReference] != "true" {
+		t.Errorf("expected key to be marked as reference, got %v", stored.Metadata)
+	}
+	if bytes.Contains(stored.Data, hsm.keys[0].(ed25519.PrivateKey).Seed()) {
+		t.Error("expected private key not to be stored")
+	}
+
+	// Other instances load the key from the generator
+	other, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := other.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != signingKey.ID {
+		t.Errorf("expected key %v, got %v", signingKey.ID, keyID)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hsm.keys) != 2 {
+		t.Errorf("expected rotation to generate a key with the generator, got %d keys", len(hsm.keys))
+	}
+}
+
+func TestEncryptor(t *testing.T) {
+	encryptor, err := crypt.NewAESGCM(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, Encryptor: encryptor}
+	keychain, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Find(signingKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(stored.Data); err == nil {
+		t.Errorf("expected stored private key to be encrypted")
+	}
+
+	// Another instance with the same encryptor reuses the stored key
+	other, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := other.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherKey.ID != signingKey.ID {
+		t.Errorf("expected stored key %v to be reused, got %v", signingKey.ID, otherKey.ID)
+	}
+}
+
+// readOnlyStore fails the test on any call which modifies the store
+type readOnlyStore struct {
+	store.Store
+	t *testing.T
+}
+
+func (s readOnlyStore) Add(key store.Key) error {
+	s.t.Errorf("unexpected Add of %v", key.ID)
+	return nil
+}
+
+func (s readOnlyStore) Delete(id string) error {
+	s.t.Errorf("unexpected Delete of %v", id)
+	return nil
+}
+
+func (s readOnlyStore) Lock() error {
+	s.t.Errorf("unexpected Lock")
+	return nil
+}
+
+func TestNewVerifierOnly(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	keychain := ring.NewWithOptions(s, ring.Options{Algorithm: ring.Ed25519})
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := ring.NewVerifierOnly(readOnlyStore{Store: s, t: t})
+	verifiers, err := verifier.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].ID != keyID {
+		t.Errorf("unexpected verifiers: %v", verifiers)
+	}
+	verifierKey, err := verifier.GetVerifier(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(verifierKey.Key.(ed25519.PublicKey), []byte("data"), signature) {
+		t.Errorf("expected signature to be valid")
+	}
+}
+
+func TestDeterministicRand(t *testing.T) {
+	newKey := func() *ring.SigningKey {
+		clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+			Algorithm: ring.Ed25519,
+			Rand:      mathrand.New(mathrand.NewSource(1)),
+			Clock:     clock,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	first, second := newKey(), newKey()
+	if first.ID != second.ID {
+		t.Errorf("expected the same ID, got %s and %s", first.ID, second.ID)
+	}
+	if !bytes.Equal(first.Key.(ed25519.PrivateKey), second.Key.(ed25519.PrivateKey)) {
+		t.Error("expected the same key")
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	precomputed, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := 0
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm: ring.RSA,
+		GenerateKey: func() (crypto.Signer, error) {
+			generated++
+			return precomputed, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected signature to verify, got %v", err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated != 1 || key.Key.(*rsa.PrivateKey).N.Cmp(precomputed.N) != 0 {
+		t.Errorf("expected the precomputed key, generated %d keys", generated)
+	}
+
+	_, err = ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:   ring.RSA,
+		MinKeySize:  2048,
+		GenerateKey: func() (crypto.Signer, error) { return precomputed, nil },
+	})
+	if !errors.Is(err, ring.ErrKeyPolicy) {
+		t.Errorf("expected ErrKeyPolicy for a small key, got %v", err)
+	}
+}
+
+// failingHSM is a fakeHSM which fails to generate keys while broken is set
+type failingHSM struct {
+	fakeHSM
+	broken bool
+}
+
+var errHSMBroken = errors.New("hsm broken")
+
+func (h *failingHSM) GenerateKey(algorithm ring.Algorithm, size int) (crypto.Signer, []byte, error) {
+	if h.broken {
+		return nil, nil, errHSMBroken
+	}
+	return h.fakeHSM.GenerateKey(algorithm, size)
+}
+
+func TestRotationError(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	hsm := &failingHSM{}
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		KeyGenerator:      hsm,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hsm.broken = true
+	clock.Advance(61 * time.Minute)
+	_, err = keychain.SigningKey()
+	var rotationErr *ring.RotationError
+	if !errors.As(err, &rotationErr) {
+		t.Fatalf("expected RotationError, got %v", err)
+	}
+	if !errors.Is(err, ring.ErrKeyRotation) || !errors.Is(err, ring.ErrKeyGeneration) || !errors.Is(err, errHSMBroken) {
+		t.Errorf("expected error to match the rotation and its cause, got %v", err)
+	}
+	if errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected generation failure not to match ErrStoreUnavailable")
+	}
+}
+
+// countingStore counts lookups of single keys
+type countingStore struct {
+	store.Store
+	finds int
+}
+
+func (s *countingStore) Find(id string) (store.Key, error) {
+	s.finds++
+	return s.Store.Find(id)
+}
+
+func TestVerifierCache(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &countingStore{Store: inmem.NewInMemoryStore()}
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:                ring.Ed25519,
+		RotationFrequency:        time.Hour,
+		VerifierCacheTTL:         time.Minute,
+		VerifierNegativeCacheTTL: time.Second,
+		Clock:                    clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := keychain.GetVerifier(key.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keychain.GetVerifier("unknown"); !errors.Is(err, ring.ErrKeyNotFound) {
+			t.Errorf("expected ErrKeyNotFound, got %v", err)
+		}
+	}
+	if s.finds != 2 {
+		t.Errorf("expected 2 store lookups, got %d", s.finds)
+	}
+
+	clock.Advance(2 * time.Second)
+	if _, err := keychain.GetVerifier("unknown"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s.finds != 3 {
+		t.Errorf("expected negative lookup to expire, got %d store lookups", s.finds)
+	}
+
+	clock.Advance(time.Minute)
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s.finds != 4 {
+		t.Errorf("expected cached key to expire, got %d store lookups", s.finds)
+	}
+}
+
+// blockingStore blocks lookups of verifier keys until released
+type blockingStore struct {
+	store.Store
+	finding chan struct{}
+	release chan struct{}
+	finds   int32
+}
+
+func (s *blockingStore) Find(id string) (store.Key, error) {
+	if strings.HasPrefix(id, "pub:") {
+		if atomic.AddInt32(&s.finds, 1) == 1 {
+			close(s.finding)
+		}
+		<-s.release
+	}
+	return s.Store.Find(id)
+}
+
+func TestGetVerifierCoalescesLookups(t *testing.T) {
+	s := &blockingStore{
+		Store:   inmem.NewInMemoryStore(),
+		finding: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	close(s.release)
+	keychain, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.finds, s.finding, s.release = 0, make(chan struct{}), make(chan struct{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keychain.GetVerifier(key.ID)
+			errs <- err
+		}()
+	}
+	<-s.finding
+	// Let the other lookups wait for the one in flight
+	time.Sleep(50 * time.Millisecond)
+	close(s.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if finds := atomic.LoadInt32(&s.finds); finds != 1 {
+		t.Errorf("expected concurrent lookups to be coalesced, got %d store lookups", finds)
+	}
+}
+
+// batchStore counts lookups of several keys at once
+type batchStore struct {
+	countingStore
+	batches int
+}
+
+func (s *batchStore) FindMany(ids []string) (store.KeyList, error) {
+	s.batches++
+	return s.Store.(store.BatchFinder).FindMany(ids)
+}
+
+func TestGetVerifiers(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &batchStore{countingStore: countingStore{Store: inmem.NewInMemoryStore()}}
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Namespace:         "tenant",
+		VerifierCacheTTL:  time.Minute,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, key.ID)
+		clock.Advance(time.Minute)
+		if err := keychain.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifiers, err := keychain.GetVerifiers(append(ids, "unknown")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != len(ids) {
+		t.Errorf("expected %d verifiers, got %d", len(ids), len(verifiers))
+	}
+	for _, id := range ids {
+		if verifiers[id] == nil || verifiers[id].ID != id {
+			t.Errorf("expected verifier %s, got %+v", id, verifiers[id])
+		}
+	}
+	if s.batches != 1 || s.finds != 0 {
+		t.Errorf("expected a single batch lookup, got %d batches and %d finds", s.batches, s.finds)
+	}
+
+	// Verifiers are cached like by GetVerifier
+	if _, err := keychain.GetVerifiers(ids...); err != nil {
+		t.Fatal(err)
+	}
+	if s.batches != 1 {
+		t.Errorf("expected cached verifiers, got %d batches", s.batches)
+	}
+}
+
+// unavailableStore fails lookups as if the store could not be reached
+// while down is set
+type unavailableStore struct {
+	store.Store
+	down  bool
+	finds int
+}
+
+func (s *unavailableStore) Find(id string) (store.Key, error) {
+	s.finds++
+	if s.down {
+		return store.Key{}, store.Unavailable(errors.New("connection refused"))
+	}
+	return s.Store.Find(id)
+}
+
+func TestGetVerifierStoreUnavailable(t *testing.T) {
+	s := &unavailableStore{Store: inmem.NewInMemoryStore()}
+	keychain := ring.NewWithOptions(s, ring.Options{
+		Algorithm:                ring.Ed25519,
+		VerifierNegativeCacheTTL: time.Minute,
+	})
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.down = true
+	_, err = keychain.GetVerifier(key.ID)
+	if !errors.Is(err, ring.ErrStoreUnavailable) || errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrStoreUnavailable, got %v", err)
+	}
+
+	// The failure must not be cached as the key being unknown
+	s.down = false
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Errorf("expected key to be found once the store is back, got %v", err)
+	}
+}
+
+// startingStore fails to list keys until failures reach zero, like a store
+// still starting up
+type startingStore struct {
+	store.Store
+	failures int32
+}
+
+func (s *startingStore) List() (store.KeyList, error) {
+	if atomic.AddInt32(&s.failures, -1) >= 0 {
+		return nil, store.Unavailable(errors.New("connection refused"))
+	}
+	return s.Store.List()
+}
+
+func TestWaitReady(t *testing.T) {
+	s := &startingStore{Store: inmem.NewInMemoryStore(), failures: 3}
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:           ring.Ed25519,
+		DeferInitialization: true,
+		LockRetryPolicy:     ring.LockRetryPolicy{Backoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.SigningKey(); !errors.Is(err, ring.ErrNotReady) {
+		t.Errorf("expected ErrNotReady before WaitReady, got %v", err)
+	}
+	if err := keychain.Healthy(context.Background()); !errors.Is(err, ring.ErrUnhealthy) {
+		t.Errorf("expected the keychain to be unhealthy before WaitReady, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	atomic.StoreInt32(&s.failures, 1<<30)
+	err = keychain.WaitReady(ctx)
+	cancel()
+	if !errors.Is(err, ring.ErrNotReady) || !errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected ErrNotReady caused by the store, got %v", err)
+	}
+
+	atomic.StoreInt32(&s.failures, 3)
+	if err := keychain.WaitReady(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Errorf("expected a signing key once ready, got %v", err)
+	}
+	if err := keychain.WaitReady(context.Background()); err != nil {
+		t.Errorf("expected WaitReady to return right away once ready, got %v", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &unavailableStore{Store: inmem.NewInMemoryStore()}
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:        ring.Ed25519,
+		VerifierCacheTTL: time.Minute,
+		CircuitBreaker:   ring.CircuitBreakerPolicy{Failures: 2, OpenDuration: time.Minute},
+		Clock:            clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	s.down, s.finds = true, 0
+	for i := 0; i < 2; i++ {
+		if verifier, err := keychain.GetVerifier(key.ID); err != nil || verifier.ID != key.ID {
+			t.Errorf("expected outdated cached key while the store is down, got %v", err)
+		}
+	}
+	_, err = keychain.GetVerifier("unknown")
+	if !errors.Is(err, ring.ErrCircuitOpen) || !errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if s.finds != 2 {
+		t.Errorf("expected the open circuit to skip the store, got %d lookups", s.finds)
+	}
+
+	clock.Advance(time.Minute)
+	s.down = false
+	if _, err := keychain.GetVerifier("unknown"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected the store to be probed after OpenDuration, got %v", err)
+	}
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Errorf("expected the circuit to close, got %v", err)
+	}
+}
+
+func TestReadReplicas(t *testing.T) {
+	primary := &unavailableStore{Store: inmem.NewInMemoryStore()}
+	replica := &unavailableStore{Store: inmem.NewInMemoryStore()}
+	keychain, err := ring.NewKeychain(primary, ring.Options{
+		Algorithm:    ring.Ed25519,
+		ReadReplicas: []store.Store{replica},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Errorf("expected fallback to the primary for keys not replicated yet, got %v", err)
+	}
+	if replica.finds != 1 {
+		t.Errorf("expected lookup in the replica first, got %d lookups", replica.finds)
+	}
+
+	keys, err := primary.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if err := replica.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	primary.down = true
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Errorf("expected lookup to be served by the replica, got %v", err)
+	}
+	primary.down, replica.down = false, true
+	if _, err := keychain.GetVerifier(key.ID); err != nil {
+		t.Errorf("expected failover to the primary, got %v", err)
+	}
+}
+
+// hangingStore blocks all operations until their context is done while
+// hang is set
+type hangingStore struct {
+	store.ContextStore
+	hang int32
+}
+
+func (s *hangingStore) wait(ctx context.Context) error {
+	if atomic.LoadInt32(&s.hang) == 0 {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *hangingStore) Lock(ctx context.Context) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.ContextStore.Lock(ctx)
+}
+
+func (s *hangingStore) List(ctx context.Context) (store.KeyList, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.ContextStore.List(ctx)
+}
+
+func TestStoreTimeout(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &hangingStore{ContextStore: store.WithContext(inmem.NewInMemoryStore())}
+	keychain, err := ring.NewKeychainContext(context.Background(), s, ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: 3 * time.Hour,
+		SigningGracePeriod: time.Hour,
+		StoreTimeout:       10 * time.Millisecond,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&s.hang, 1)
+	clock.Advance(61 * time.Minute)
+	if current, err := keychain.SigningKey(); err != nil || current.ID != key.ID {
+		t.Errorf("expected current key within the grace period, got %v", err)
+	}
+	clock.Advance(time.Hour)
+	if _, err := keychain.SigningKey(); !errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected ErrStoreUnavailable, got %v", err)
+	}
+	if _, err := keychain.ListVerifiers(); !errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected ErrStoreUnavailable, got %v", err)
+	}
+}
+
+type recordingTracer struct {
+	spans []string
+}
+
+type recordingSpan struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, ring.Span) {
+	t.spans = append(t.spans, name)
+	return ctx, recordingSpan{}
+}
+
+func (recordingSpan) End(err error) {}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm: ring.Ed25519,
+		Tracer:    tracer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer.spans = nil
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.spans) < 2 || tracer.spans[0] != "ring.Rotate" || tracer.spans[1] != "ring.store.Lock" {
+		t.Errorf("unexpected spans: %v", tracer.spans)
+	}
+
+	tracer.spans = nil
+	if _, err := keychain.GetVerifier("unknown"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	if want := []string{"ring.GetVerifier", "ring.store.Find"}; strings.Join(tracer.spans, ",") != strings.Join(want, ",") {
+		t.Errorf("got spans %v want %v", tracer.spans, want)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	var rotations [][2]string
+	var expired []string
+	var rotationErrors []error
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: time.Hour,
+		Clock:              clock,
+		OnRotate: func(old, new *ring.SigningKey) {
+			rotations = append(rotations, [2]string{old.ID, new.ID})
+		},
+		OnRotationError: func(err error) {
+			rotationErrors = append(rotationErrors, err)
+		},
+		OnKeyExpired: func(id string) {
+			expired = append(expired, id)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(61 * time.Minute)
+	second, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotations) != 1 || rotations[0] != [2]string{first.ID, second.ID} {
+		t.Errorf("unexpected rotations: %v", rotations)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := keychain.ListVerifiers(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(expired) != 1 || expired[0] != first.ID {
+		t.Errorf("expected %v to expire once, got %v", first.ID, expired)
+	}
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Rotate(); err == nil {
+		t.Fatal("expected rotation to fail while locked")
+	}
+	if len(rotationErrors) != 1 || !errors.Is(rotationErrors[0], store.ErrLockOccupied) {
+		t.Errorf("unexpected rotation errors: %v", rotationErrors)
+	}
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+func (l *recordingLogger) Info(msg string, args ...interface{}) { l.messages = append(l.messages, msg) }
+func (l *recordingLogger) Warn(msg string, args ...interface{}) { l.messages = append(l.messages, msg) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func TestLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm: ring.Ed25519,
+		Logger:    logger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	_ = keychain.Rotate()
+
+	want := []string{
+		"acquired store lock",
+		"created signing key",
+		"released store lock",
+		"store lock is held by another instance",
+		"failed to rotate signing key",
+	}
+	if got := strings.Join(logger.messages, ","); got != strings.Join(want, ",") {
+		t.Errorf("got log messages %v want %v", logger.messages, want)
+	}
+}
+
+func TestLockRetryReusesKeyOfLockHolder(t *testing.T) {
+	first := inmem.NewInMemoryStore()
+	signingKey, err := ring.NewWithOptions(first, ring.Options{Algorithm: ring.Ed25519}).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance holds the lock, and stores its key shortly after
+	s := inmem.NewInMemoryStore()
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		keys, _ := first.List()
+		for _, key := range keys {
+			s.Add(key)
+		}
+	}()
+
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:       ring.Ed25519,
+		LockRetryPolicy: ring.LockRetryPolicy{Attempts: 10, Backoff: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != signingKey.ID {
+		t.Errorf("expected key %v of the lock holder to be reused, got %v", signingKey.ID, key.ID)
+	}
+}
+
+type auditLog []ring.AuditRecord
+
+func (a *auditLog) Record(record ring.AuditRecord) {
+	*a = append(*a, record)
+}
+
+func (a auditLog) events(keyID string) []ring.AuditEvent {
+	var events []ring.AuditEvent
+	for _, record := range a {
+		if record.KeyID == keyID {
+			events = append(events, record.Event)
+		}
+	}
+	return events
+}
+
+func TestEmergencyRotate(t *testing.T) {
+	var (
+		log      auditLog
+		notified []string
+	)
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm: ring.Ed25519,
+		AuditSink: &log,
+		OnEmergencyRotate: func(reason string, newKey *ring.SigningKey, revoked []string) {
+			notified = revoked
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := keychain.NewKeyWithOptions(ring.KeyOptions{RotationFrequency: time.Hour, VerificationPeriod: 2 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := keychain.EmergencyRotate("leaked in CI logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := keychain.SigningKey(); err != nil || key.ID != newKey.ID {
+		t.Errorf("expected new signing key %s, got %v", newKey.ID, err)
+	}
+	for _, id := range []string{current.ID, offline.ID} {
+		if _, err := keychain.GetVerifier(id); !errors.Is(err, ring.ErrKeyNotFound) {
+			t.Errorf("expected %s to be revoked, got %v", id, err)
+		}
+		if _, err := keychain.GetSigningKey(id); !errors.Is(err, ring.ErrKeyNotFound) {
+			t.Errorf("expected private key of %s to be deleted, got %v", id, err)
+		}
+	}
+	verifiers, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].ID != newKey.ID {
+		t.Errorf("expected only %s to be active, got %d verifiers", newKey.ID, len(verifiers))
+	}
+	list, err := keychain.RevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.KeyIDs) != 2 || len(notified) != 2 {
+		t.Errorf("expected 2 revoked keys, got %v and %v", list.KeyIDs, notified)
+	}
+	var recorded bool
+	for _, record := range log {
+		if record.Event == ring.AuditEmergencyRotated {
+			recorded = record.Reason == "leaked in CI logs" && record.PreviousKeyID == current.ID
+		}
+	}
+	if !recorded {
+		t.Errorf("expected emergency rotation to be audited, got %v", log)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	options := ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Clock:             clock,
+		ReadOnly:          true,
+	}
+	if _, err := ring.NewKeychain(readOnlyStore{Store: s, t: t}, options); !errors.Is(err, ring.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly without a signing key in the store, got %v", err)
+	}
+
+	writer, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := writer.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keychain, err := ring.NewKeychain(readOnlyStore{Store: s, t: t}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != first.ID {
+		t.Errorf("expected the key of the writer %s, got %s", first.ID, keyID)
+	}
+	if err := writer.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Error(err)
+	}
+	if err := keychain.Rotate(); !errors.Is(err, ring.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly from Rotate, got %v", err)
+	}
+	if err := keychain.Revoke(keyID); !errors.Is(err, ring.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly from Revoke, got %v", err)
+	}
+
+	// Keys rotated by other instances are adopted
+	clock.Advance(61 * time.Minute)
+	second, err := writer.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := keychain.SigningKey(); err != nil || key.ID != second.ID {
+		t.Errorf("expected the rotated key %s, got %v", second.ID, err)
+	}
+	clock.Advance(61 * time.Minute)
+	if _, err := keychain.SigningKey(); !errors.Is(err, ring.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly without a newer key, got %v", err)
+	}
+}
+
+func TestCompositeVerifier(t *testing.T) {
+	oldCluster, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCluster, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	partner := ring.NewVerifierOnly(&unavailableStore{Store: inmem.NewInMemoryStore(), down: true})
+	verifier := ring.NewCompositeVerifier(
+		ring.VerifierSource{Prefix: "old/", Verifier: oldCluster},
+		ring.VerifierSource{Verifier: newCluster},
+		ring.VerifierSource{Prefix: "partner/", Verifier: partner},
+	)
+
+	oldKey, err := oldCluster.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := newCluster.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := verifier.GetVerifier("old/" + oldKey.ID); err != nil || key.ID != "old/"+oldKey.ID {
+		t.Errorf("expected the key of the old cluster, got %v", err)
+	}
+	if key, err := verifier.GetVerifier(newKey.ID); err != nil || key.ID != newKey.ID {
+		t.Errorf("expected the key of the new cluster, got %v", err)
+	}
+	if _, err := verifier.GetVerifier(oldKey.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected keys of prefixed sources to require the prefix, got %v", err)
+	}
+	if _, err := verifier.GetVerifier("partner/" + newKey.ID); !errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected ErrStoreUnavailable from the partner, got %v", err)
+	}
+
+	keys, err := verifier.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, key := range keys {
+		ids[key.ID] = true
+	}
+	if len(keys) != 2 || !ids["old/"+oldKey.ID] || !ids[newKey.ID] {
+		t.Errorf("expected the keys of both clusters, got %v", ids)
+	}
+}
+
+func TestStaticVerifiers(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &unavailableStore{Store: inmem.NewInMemoryStore()}
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:       ring.Ed25519,
+		StaticVerifiers: []ring.VerifierKey{{ID: "legacy", Key: public}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 2 {
+		t.Errorf("expected the stored and the static key, got %d keys", len(verifiers))
+	}
+
+	s.down = true
+	signature := ed25519.Sign(private, []byte("data"))
+	if err := keychain.Verify("legacy", []byte("data"), signature); err != nil {
+		t.Errorf("expected the static key to verify during a store outage, got %v", err)
+	}
+
+	invalid := ring.Options{StaticVerifiers: []ring.VerifierKey{{ID: "legacy"}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected a static verifier without a key to be invalid")
+	}
+}
+
+func TestAuditSink(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	var log auditLog
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: 2 * time.Hour,
+		Clock:              clock,
+		InstanceID:         "instance-a",
+		AuditSink:          &log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.GetVerifier(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ring.AuditEvent{ring.AuditKeyCreated, ring.AuditKeyUsed, ring.AuditVerifierFetched}
+	if got := log.events(first.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v for first key, got %v", want, got)
+	}
+	want = []ring.AuditEvent{ring.AuditKeyCreated, ring.AuditKeyRotated, ring.AuditKeyUsed}
+	if got := log.events(second.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v for second key, got %v", want, got)
+	}
+	for _, record := range log {
+		if record.Event == ring.AuditKeyRotated && record.PreviousKeyID != first.ID {
+			t.Errorf("expected rotation from %v, got %v", first.ID, record.PreviousKeyID)
+		}
+		if record.InstanceID != "instance-a" || !record.Time.Equal(clock.Now()) {
+			t.Errorf("unexpected record: %+v", record)
+		}
+		fingerprint := ""
+		switch {
+		case record.Event == ring.AuditVerifierFetched:
+		case record.KeyID == first.ID:
+			fingerprint = first.Fingerprint().Hex()
+		case record.KeyID == second.ID:
+			fingerprint = second.Fingerprint().Hex()
+		}
+		if record.Fingerprint != fingerprint {
+			t.Errorf("expected fingerprint %q for %v of %v, got %q", fingerprint, record.Event, record.KeyID, record.Fingerprint)
+		}
+	}
+}
+
+func TestRotationSchedule(t *testing.T) {
+	// Friday, 10:20 UTC
+	now := time.Date(2021, 1, 1, 10, 20, 0, 0, time.UTC)
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		schedule  string
+		rotatedAt time.Time
+		frequency time.Duration
+	}{
+		{"0 3 * * *", time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{"*/15 * * * *", time.Date(2021, 1, 1, 10, 30, 0, 0, time.UTC), 15 * time.Minute},
+		{"30 9-17 * * mon-fri", time.Date(2021, 1, 1, 10, 30, 0, 0, time.UTC), 64 * time.Hour},
+		{"0 0 1,15 * *", time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), 17 * 24 * time.Hour},
+		{"@weekly", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC), 7 * 24 * time.Hour},
+		{"CRON_TZ=Europe/Stockholm 0 3 * * *", time.Date(2021, 1, 2, 3, 0, 0, 0, stockholm), 25 * time.Hour},
+	}
+	for _, test := range tests {
+		clock := sim.NewClock(now)
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+			Algorithm:        ring.Ed25519,
+			RotationSchedule: test.schedule,
+			Clock:            clock,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", test.schedule, err)
+		}
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.RotatedAt.Equal(test.rotatedAt) {
+			t.Errorf("%s: expected rotation at %v, got %v", test.schedule, test.rotatedAt, key.RotatedAt)
+		}
+		// RotationFrequency defaults to the longest interval, and
+		// VerificationPeriod to twice that
+		if want := test.rotatedAt.Add(test.frequency); !key.VerifiableUntil.Equal(want) {
+			t.Errorf("%s: expected key to be verifiable until %v, got %v", test.schedule, want, key.VerifiableUntil)
+		}
+
+		clock.Advance(key.RotatedAt.Sub(clock.Now()) + time.Second)
+		next, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.ID == key.ID || !next.RotatedAt.After(key.RotatedAt) {
+			t.Errorf("%s: expected rotation to a key with a later rotation, got %v", test.schedule, next.RotatedAt)
+		}
+	}
+
+	invalid := map[string]ring.Options{
+		"too few fields":  {RotationSchedule: "0 3 * *"},
+		"out of range":    {RotationSchedule: "0 24 * * *"},
+		"never matches":   {RotationSchedule: "0 0 30 2 *"},
+		"with jitter":     {RotationSchedule: "@daily", RotationJitter: 0.1},
+		"short frequency": {RotationSchedule: "@daily", RotationFrequency: time.Hour},
+	}
+	for name, options := range invalid {
+		if err := options.Validate(); err == nil {
+			t.Errorf("expected options with %s schedule to be invalid", name)
+		}
+	}
+}
+
+// setenv sets the environment variable key until the end of the test,
+// like testing.T.Setenv of later Go versions
+func setenv(t *testing.T, key, value string) {
+	previous, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	setenv(t, "RING_ALGORITHM", "RSA")
+	setenv(t, "RING_KEY_SIZE", "3072")
+	setenv(t, "RING_ROTATION_FREQUENCY", "30m")
+	setenv(t, "RING_AUTO_ROTATE", "true")
+	options, err := ring.OptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Algorithm != ring.RSA || options.KeySize != 3072 || options.RotationFrequency != 30*time.Minute || !options.AutoRotate {
+		t.Errorf("unexpected options from the environment: %+v", options)
+	}
+	if options.VerificationPeriod != 0 {
+		t.Errorf("expected unset options to be left to their defaults, got %v", options.VerificationPeriod)
+	}
+
+	setenv(t, "RING_ROTATION_FREQUENCY", "hourly")
+	if _, err := ring.OptionsFromEnv(); err == nil || !strings.Contains(err.Error(), "RING_ROTATION_FREQUENCY") {
+		t.Errorf("expected an error naming the invalid variable, got %v", err)
+	}
+	setenv(t, "RING_ROTATION_FREQUENCY", "2h")
+	setenv(t, "RING_VERIFICATION_PERIOD", "1h")
+	if _, err := ring.OptionsFromEnv(); err == nil {
+		t.Error("expected invalid options to be rejected")
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	var config ring.Config
+	data := []byte(`{"algorithm": "Ed25519", "rotation_frequency": "1h30m", "verification_period": "6h"}`)
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	options := config.Apply(ring.Options{Namespace: "payments"})
+	if options.Algorithm != ring.Ed25519 || options.RotationFrequency != 90*time.Minute || options.VerificationPeriod != 6*time.Hour || options.Namespace != "payments" {
+		t.Errorf("unexpected options from the config: %+v", options)
+	}
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(encoded, []byte(`"rotation_frequency":"1h30m0s"`)) {
+		t.Errorf("expected durations to be encoded as strings, got %s", encoded)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	if err := (ring.Options{}).Validate(); err != nil {
+		t.Errorf("expected default options to be valid, got %v", err)
+	}
+	invalid := map[string]ring.Options{
+		"negative rotation":   {RotationFrequency: -time.Hour},
+		"short verification":  {RotationFrequency: 2 * time.Hour, VerificationPeriod: time.Hour},
+		"small RSA key":       {Algorithm: ring.RSA, KeySize: 512},
+		"unknown algorithm":   {Algorithm: "DSA"},
+		"single character":    {IDAlphabet: "a", IDLength: 64},
+		"low entropy":         {IDAlphabet: "0123456789", IDLength: 6},
+		"negative extension":  {MaxVerifierExtension: -time.Hour},
+		"negative lock retry": {LockRetryPolicy: ring.LockRetryPolicy{Backoff: -time.Second}},
+		"negative skew":       {ClockSkewTolerance: -time.Second},
+		"disallowed key size": {Algorithm: ring.RSA, AllowedKeySizes: []int{3072, 4096}},
+		"even exponent":       {RSAPublicExponent: 4},
+		"generated exponent":  {Algorithm: ring.RSA, RSAPublicExponent: 3},
+		"single prime":        {RSAPrimes: 1},
+		"two generators": {
+			KeyGenerator: &fakeHSM{},
+			GenerateKey:  func() (crypto.Signer, error) { return nil, errors.New("unused") },
+		},
+	}
+	for name, options := range invalid {
+		err := options.Validate()
+		if err == nil {
+			t.Errorf("%s: expected options to be invalid", name)
+			continue
+		}
+		if _, newErr := ring.NewKeychain(inmem.NewInMemoryStore(), options); newErr == nil || newErr.Error() != err.Error() {
+			t.Errorf("%s: expected NewKeychain to fail with %v, got %v", name, err, newErr)
+		}
+	}
+}
+
+func TestKeyPolicy(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	legacy, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.ECDSAP256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := legacy.ImportSigningKey(weakKey, ring.ImportOptions{MakeCurrent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := ring.Options{Algorithm: ring.ECDSAP256, MinKeySize: 2048}
+	keychain, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := keychain.SigningKey(); err != nil || key.ID == weak.ID {
+		t.Errorf("expected weak key not to be used for signing, got %v, %v", key, err)
+	}
+	if _, err := keychain.GetSigningKey(weak.ID); !errors.Is(err, ring.ErrKeyPolicy) {
+		t.Errorf("expected ErrKeyPolicy, got %v", err)
+	}
+	if _, err := keychain.GetVerifier(weak.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected weak verifier not to be found, got %v", err)
+	}
+	verifiers, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, verifier := range verifiers {
+		if verifier.ID == weak.ID {
+			t.Error("expected weak verifier not to be listed")
+		}
+	}
+	if _, err := keychain.ImportSigningKey(weakKey, ring.ImportOptions{}); !errors.Is(err, ring.ErrKeyPolicy) {
+		t.Errorf("expected import of weak key to fail, got %v", err)
+	}
+
+	options.AllowedAlgorithms = []ring.Algorithm{ring.Ed25519}
+	if err := options.Validate(); err == nil {
+		t.Error("expected Algorithm outside AllowedAlgorithms to be invalid")
+	}
+}
+
+// erasingStore records the keys erased through store.SecureEraser
+type erasingStore struct {
+	store.Store
+	erased []string
+}
+
+func (s *erasingStore) SecureErase(id string) error {
+	s.erased = append(s.erased, id)
+	return s.Store.Delete(id)
+}
+
+func TestZeroizeKeys(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &erasingStore{Store: inmem.NewInMemoryStore()}
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		ZeroizeKeys:       true,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour + time.Second)
+	second, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroized := func(key *ring.SigningKey) bool {
+		return bytes.Equal(key.Key.(ed25519.PrivateKey), make(ed25519.PrivateKey, ed25519.PrivateKeySize))
+	}
+	if zeroized(first) {
+		t.Error("expected the retired key to be kept until the next rotation")
+	}
+
+	clock.Advance(time.Hour + time.Second)
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if !zeroized(first) {
+		t.Error("expected the retired key to be zeroized")
+	}
+	if zeroized(second) {
+		t.Error("expected the key retired by this rotation to be kept")
+	}
+
+	if err := keychain.Revoke(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.erased) != 1 || s.erased[0] != second.ID {
+		t.Errorf("expected the revoked private key to be erased, got %v", s.erased)
+	}
+}
+
+func TestKeyMismatch(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.RSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []ring.KeyMismatchPolicy{"", ring.KeyMismatchReuse} {
+		reused, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.RSA, KeySize: 3072, KeyMismatch: policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key, err := reused.SigningKey(); err != nil || key.ID != stored.ID {
+			t.Errorf("expected policy %q to reuse the stored key %s, got %v", policy, stored.ID, err)
+		}
+	}
+	if _, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519, KeyMismatch: ring.KeyMismatchError}); !errors.Is(err, ring.ErrKeyMismatch) {
+		t.Errorf("expected ErrKeyMismatch, got %v", err)
+	}
+
+	rotated, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.RSA, KeySize: 3072, KeyMismatch: ring.KeyMismatchRotate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rotated.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID == stored.ID || key.Key.Public().(*rsa.PublicKey).N.BitLen() != 3072 {
+		t.Errorf("expected a new key of 3072 bits, got %s", key.ID)
+	}
+	if _, err := rotated.GetVerifier(stored.ID); err != nil {
+		t.Errorf("expected the verifier of the stored key to remain, got %v", err)
+	}
+
+	invalid := ring.Options{KeyMismatch: "ignore"}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected unknown KeyMismatch to be invalid")
+	}
+}
+
+func TestRSAParameters(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.RSA,
+		RSAPrimes:         3,
+		RSAPublicExponent: 65537,
+		AllowedKeySizes:   []int{2048, 3072},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primes := len(key.Key.(*rsa.PrivateKey).Primes); primes != 3 {
+		t.Errorf("expected a key of 3 primes, got %d", primes)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Error(err)
+	}
+	if _, err := keychain.NewKeyWithOptions(ring.KeyOptions{KeySize: 4096}); !errors.Is(err, ring.ErrKeyPolicy) {
+		t.Errorf("expected ErrKeyPolicy for a key size which is not allowed, got %v", err)
+	}
+
+	generated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.RSA,
+		RSAPublicExponent: 3,
+		GenerateKey:       func() (crypto.Signer, error) { return generated, nil },
+	})
+	if !errors.Is(err, ring.ErrKeyPolicy) {
+		t.Errorf("expected ErrKeyPolicy for another public exponent, got %v", err)
+	}
+}
+
+func TestFIPS(t *testing.T) {
+	invalid := map[string]ring.Options{
+		"Ed25519":    {Algorithm: ring.Ed25519},
+		"multiprime": {Algorithm: ring.RSA, RSAPrimes: 3},
+		"exponent":   {Algorithm: ring.RSA, RSAPublicExponent: 3, GenerateKey: func() (crypto.Signer, error) { return nil, errors.New("unused") }},
+		"rand":       {Algorithm: ring.ECDSAP256, Rand: mathrand.New(mathrand.NewSource(1))},
+	}
+	for name, options := range invalid {
+		options.FIPS = true
+		if err := options.Validate(); err == nil || errors.Is(err, ring.ErrFIPSUnavailable) {
+			t.Errorf("%s: expected options not to be approved, got %v", name, err)
+		}
+	}
+
+	options := ring.Options{Algorithm: ring.ECDSAP256, FIPS: true}
+	if !ring.FIPSEnabled() {
+		if _, err := ring.NewKeychain(inmem.NewInMemoryStore(), options); !errors.Is(err, ring.ErrFIPSUnavailable) {
+			t.Errorf("expected ErrFIPSUnavailable, got %v", err)
+		}
+		return
+	}
+	s := inmem.NewInMemoryStore()
+	legacy, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Key, err := legacy.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keychain, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.GetVerifier(ed25519Key.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected Ed25519 verifier not to be found, got %v", err)
+	}
+}
+
+func BenchmarkRSAKeyGeneration(b *testing.B) {
+	for _, primes := range []int{2, 3} {
+		b.Run(fmt.Sprintf("primes=%d", primes), func(b *testing.B) {
+			keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.RSA, RSAPrimes: primes})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := keychain.NewKeyWithOptions(ring.KeyOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRSASign(b *testing.B) {
+	for _, primes := range []int{2, 3} {
+		b.Run(fmt.Sprintf("primes=%d", primes), func(b *testing.B) {
+			keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.RSA, RSAPrimes: primes})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := keychain.Sign([]byte("data")); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkKeychain returns an RSA keychain with 10 verifier keys
+func benchmarkKeychain(b *testing.B, options ring.Options) (ring.Keychain, string) {
+	options.Algorithm = ring.RSA
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), options)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var key *ring.SigningKey
+	for i := 0; i < 10; i++ {
+		if key, err = keychain.NewKeyWithOptions(ring.KeyOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return keychain, key.ID
+}
+
+func BenchmarkGetVerifier(b *testing.B) {
+	for name, options := range map[string]ring.Options{
+		"uncached": {},
+		"cached":   {VerifierCacheTTL: time.Minute},
+	} {
+		b.Run(name, func(b *testing.B) {
+			keychain, id := benchmarkKeychain(b, options)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := keychain.GetVerifier(id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListVerifiers(b *testing.B) {
+	keychain, _ := benchmarkKeychain(b, ring.Options{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := keychain.ListVerifiers(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNewKeyWithOptions(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, Clock: clock}
+	keychain, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.NewKeyWithOptions(ring.KeyOptions{RotationFrequency: 2 * time.Hour, VerificationPeriod: time.Hour}); err == nil {
+		t.Error("expected VerificationPeriod shorter than RotationFrequency to fail")
+	}
+	longLived, err := keychain.NewKeyWithOptions(ring.KeyOptions{
+		RotationFrequency:  24 * time.Hour,
+		VerificationPeriod: 30 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !longLived.RotatedAt.Equal(clock.Now().Add(24*time.Hour)) || !longLived.VerifiableUntil.Equal(clock.Now().Add(30*24*time.Hour)) {
+		t.Errorf("unexpected schedule of key: %+v", longLived)
+	}
+	if key, err := keychain.SigningKey(); err != nil || key.ID != current.ID {
+		t.Errorf("expected current key %v to be kept, got %v, %v", current.ID, key, err)
+	}
+
+	// The key is not picked up by rotation or other instances
+	clock.Advance(61 * time.Minute)
+	rotated, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := other.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ID == longLived.ID || otherKey.ID != rotated.ID {
+		t.Errorf("expected rotated key %v to be used, got %v and %v", rotated.ID, rotated.ID, otherKey.ID)
+	}
+
+	stored, err := other.GetSigningKey(longLived.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.RotatedAt.Equal(longLived.RotatedAt) || !stored.VerifiableUntil.Equal(longLived.VerifiableUntil) {
+		t.Errorf("expected stored schedule %v, %v, got %v, %v", longLived.RotatedAt, longLived.VerifiableUntil, stored.RotatedAt, stored.VerifiableUntil)
+	}
+
+	clock.Advance(48 * time.Hour)
+	if _, err := keychain.GetSigningKey(longLived.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound after the key was rotated, got %v", err)
+	}
+	if _, err := keychain.GetVerifier(longLived.ID); err != nil {
+		t.Errorf("expected key to still be verifiable, got %v", err)
+	}
+}
+
+func TestSignatureService(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:          ring.RSA,
+		SignatureAlgorithm: ring.PS256,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log auditLog
+	service := ring.NewSignatureService(keychain, ring.SignatureServiceOptions{
+		Limit:     1,
+		Burst:     2,
+		AuditSink: &log,
+		Clock:     clock,
+	})
+
+	ctx := ring.WithCaller(context.Background(), "billing")
+	signature, keyID, err := service.Sign(ctx, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("data"))
+	signature, _, err = service.SignDigest(ctx, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := service.GetVerifier(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPSS(verifier.Key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature, nil); err != nil {
+		t.Errorf("expected valid PSS signature, got %v", err)
+	}
+	sha1Digest := sha1.Sum([]byte("data"))
+	if _, _, err := service.SignDigest(ring.WithCaller(ctx, "mismatch"), crypto.SHA1, sha1Digest[:]); !errors.Is(err, ring.ErrDigestMismatch) {
+		t.Errorf("expected ErrDigestMismatch for another hash, got %v", err)
+	}
+
+	// The burst is used up, while other callers have their own limit
+	if _, _, err := service.Sign(ctx, []byte("data")); !errors.Is(err, ring.ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+	if _, _, err := service.Sign(context.Background(), []byte("data")); err != nil {
+		t.Errorf("expected other caller to sign, got %v", err)
+	}
+	clock.Advance(time.Second)
+	if _, _, err := service.Sign(ctx, []byte("data")); err != nil {
+		t.Errorf("expected signing to be allowed again, got %v", err)
+	}
+
+	var callers []string
+	for _, record := range log {
+		if record.Event != ring.AuditKeySigned || record.KeyID != keyID {
+			t.Errorf("unexpected record: %+v", record)
+		}
+		callers = append(callers, record.Caller)
+	}
+	if want := []string{"billing", "billing", "", "billing"}; !reflect.DeepEqual(callers, want) {
+		t.Errorf("expected signatures for %q, got %q", want, callers)
+	}
+}
+
+func TestIDPrefixes(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	if _, err := ring.NewKeychain(s, ring.Options{IDPrefixes: ring.IDPrefixes{PublicKey: "pub"}}); err == nil {
+		t.Error("expected prefix within IDAlphabet to fail")
+	}
+	if _, err := ring.NewKeychain(s, ring.Options{IDPrefixes: ring.IDPrefixes{PublicKey: "revoked:x:"}}); err == nil {
+		t.Error("expected overlapping prefixes to fail")
+	}
+
+	old := ring.Options{Algorithm: ring.Ed25519}
+	keychain, err := ring.NewKeychain(s, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := ring.Options{
+		Algorithm:          ring.Ed25519,
+		Namespace:          "tokens",
+		NamespaceSeparator: ":",
+		IDPrefixes:         ring.IDPrefixes{PublicKey: "verifier:"},
+	}
+	if err := ring.MigrateIDs(s, old, options); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find("tokens:verifier:" + keyID); err != nil {
+		t.Errorf("expected verifier key under new prefix, got %v", err)
+	}
+	if _, err := s.Find("tokens:" + keyID); err != nil {
+		t.Errorf("expected private key in new namespace, got %v", err)
+	}
+
+	migrated, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := migrated.SigningKey(); err != nil || key.ID != keyID {
+		t.Errorf("expected migrated key %v, got %v, %v", keyID, key, err)
+	}
+	if err := migrated.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	verifiers, err := ring.NewVerifierOnlyWithOptions(s, options).ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].ID != keyID {
+		t.Errorf("expected only verifier %v, got %+v", keyID, verifiers)
+	}
+}
+
+func TestShardedKeychain(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519}
+	keychain, err := ring.NewShardedKeychain(s, options, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+
+	data := []byte("data")
+	keyIDs := make(map[string]bool)
+	for i := 0; i < 6; i++ {
+		signature, keyID, err := keychain.Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyIDs[keyID] = true
+		if err := keychain.Verify(keyID, data, signature); err != nil {
+			t.Errorf("expected signature of %s to verify, got %v", keyID, err)
+		}
+	}
+	if len(keyIDs) != 3 {
+		t.Errorf("expected signatures by all 3 shards, got %v", keyIDs)
+	}
+
+	first, err := keychain.SigningKeyFor("tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := keychain.SigningKeyFor("tenant-a"); err != nil || again.ID != first.ID {
+		t.Errorf("expected the same shard for the same key, got %v", err)
+	}
+
+	verifiers, err := ring.NewShardedVerifier(s, options, 3).ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 3 {
+		t.Errorf("expected the verifiers of all shards, got %d", len(verifiers))
+	}
+	for _, verifier := range verifiers {
+		if !keyIDs[verifier.ID] {
+			t.Errorf("unexpected verifier %s", verifier.ID)
+		}
+	}
+	jwks, err := keychain.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set ring.JWKSet
+	if err := json.Unmarshal(jwks, &set); err != nil || len(set.Keys) != 3 {
+		t.Errorf("expected a JWKS of all shards, got %s (%v)", jwks, err)
+	}
+
+	if _, err := ring.NewShardedKeychain(s, options, 0); err == nil {
+		t.Error("expected an error without shards")
+	}
+}
+
+func TestManager(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	manager := ring.NewManager(s)
+	access, err := manager.Add("access", ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook, err := manager.Add("webhook", ring.Options{Algorithm: ring.ECDSAP256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Add("access", ring.Options{}); !errors.Is(err, ring.ErrKeychainExists) {
+		t.Errorf("expected ErrKeychainExists, got %v", err)
+	}
+	if names := manager.Names(); !reflect.DeepEqual(names, []string{"access", "webhook"}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if got, ok := manager.Keychain("access"); !ok || got != access {
+		t.Error("expected to get the access keychain")
+	}
+
+	accessKey, err := access.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := access.GetVerifier(accessKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := webhook.GetVerifier(accessKey.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected access key to be invisible to webhook keychain, got %v", err)
+	}
+	verifiers, err := webhook.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 {
+		t.Errorf("expected a single webhook verifier, got %d", len(verifiers))
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key.ID, "access/") && !strings.HasPrefix(key.ID, "webhook/") {
+			t.Errorf("expected key %v to be namespaced", key.ID)
+		}
+	}
+
+	verifier := ring.NewVerifierOnlyWithOptions(s, ring.Options{Namespace: "access"})
+	if _, err := verifier.GetVerifier(accessKey.ID); err != nil {
+		t.Errorf("expected namespaced verifier to find key, got %v", err)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// Example from RFC 7638, section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &ring.VerifierKey{Key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}}
+	thumbprint, err := verifier.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("unexpected thumbprint %v", thumbprint)
+	}
+}
+
+func TestIDStrategy(t *testing.T) {
+	for _, strategy := range []ring.IDStrategy{ring.JWKThumbprintID, ring.SPKIThumbprintID} {
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+			Algorithm:  ring.ECDSAP256,
+			IDStrategy: strategy,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signingKey, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := keychain.GetVerifier(signingKey.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := verifier.Fingerprint().Base64()
+		if strategy == ring.JWKThumbprintID {
+			if expected, err = verifier.Thumbprint(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if signingKey.ID != expected {
+			t.Errorf("%v: expected ID %v, got %v", strategy, expected, signingKey.ID)
+		}
+	}
+
+	if _, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{IDStrategy: "sequential"}); err == nil {
+		t.Error("expected unsupported IDStrategy to be rejected")
+	}
+}
+
+// conflictingStore reports an ID conflict for the next conflicts private
+// keys added
+type conflictingStore struct {
+	store.Store
+	conflicts int
+}
+
+func (s *conflictingStore) Add(key store.Key) error {
+	if key.IsPrivate && s.conflicts > 0 {
+		s.conflicts--
+		return store.ErrKeyIDConflict
+	}
+	return s.Store.Add(key)
+}
+
+func TestIDConflictRetries(t *testing.T) {
+	s := &conflictingStore{Store: inmem.NewInMemoryStore(), conflicts: 2}
+	keychain, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.conflicts = 3
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ring.NewKeychain(&conflictingStore{Store: inmem.NewInMemoryStore(), conflicts: 2}, ring.Options{
+		Algorithm:         ring.Ed25519,
+		IDConflictRetries: 1,
+	})
+	var conflictErr *ring.IDConflictError
+	if !errors.As(err, &conflictErr) || conflictErr.Attempts != 2 {
+		t.Fatalf("expected IDConflictError after 2 attempts, got %v", err)
+	}
+	if !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Error("expected error to wrap ErrKeyIDConflict")
+	}
+}
+
+func TestRenameReservedKeyIDs(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519}
+	keychain, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.ImportSigningKey(key, ring.ImportOptions{ID: "pub:abc"}); !errors.Is(err, ring.ErrInvalidKeyID) {
+		t.Errorf("expected ErrInvalidKeyID, got %v", err)
+	}
+
+	// Move the current key to a reserved ID, like an import before IDs were
+	// validated
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const reserved = "secret:abc"
+	for _, prefix := range []string{"", "pub:"} {
+		record, err := s.Find(prefix + current.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.ID = prefix + reserved
+		if err := s.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete(current.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := ring.RenameReservedKeyIDs(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := renamed[reserved]
+	if len(renamed) != 1 || !ok {
+		t.Fatalf("expected %q to be renamed, got %v", reserved, renamed)
+	}
+	if _, err := s.Find(reserved); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected private key under reserved ID to be deleted, got %v", err)
+	}
+	migrated, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signingKey, err := migrated.GetSigningKey(id); err != nil || signingKey.ID != id {
+		t.Errorf("expected signing key %v, got %v, %v", id, signingKey, err)
+	}
+	if err := migrated.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected signature of original key to verify, got %v", err)
+	}
+	if _, err := migrated.GetVerifier(reserved); err != nil {
+		t.Errorf("expected verifier under old ID to be kept, got %v", err)
+	}
+	if renamed, err := ring.RenameReservedKeyIDs(s, options); err != nil || len(renamed) != 0 {
+		t.Errorf("expected nothing left to rename, got %v, %v", renamed, err)
+	}
+}
+
+func TestImportSigningKey(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, legacy, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiableUntil := clock.Now().Add(24 * time.Hour)
+	if _, err := keychain.ImportSigningKey(legacy, ring.ImportOptions{ID: "legacy", VerifiableUntil: verifiableUntil}); err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := keychain.GetVerifier("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifier.ExpiresAt.Equal(verifiableUntil) || !bytes.Equal(verifier.Key.(ed25519.PublicKey), legacy.Public().(ed25519.PublicKey)) {
+		t.Errorf("unexpected imported verifier: %+v", verifier)
+	}
+	if key, err := keychain.SigningKey(); err != nil || key.ID != current.ID {
+		t.Errorf("expected signing key to remain %v, got %v", current.ID, key)
+	}
+
+	_, next, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := keychain.ImportSigningKey(next, ring.ImportOptions{MakeCurrent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != imported.ID {
+		t.Errorf("expected to sign with imported key %v, got %v", imported.ID, keyID)
+	}
+	if !ed25519.Verify(next.Public().(ed25519.PublicKey), []byte("data"), signature) {
+		t.Error("expected signature by imported key")
+	}
+
+	if _, err := keychain.ImportSigningKey(legacy, ring.ImportOptions{VerifiableUntil: clock.Now().Add(-time.Second)}); err == nil {
+		t.Error("expected import of expired key to fail")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	encryptor, err := crypt.NewAESGCM(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519, Encryptor: encryptor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := source.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backup bytes.Buffer
+	if err := source.Export(&backup, []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := inmem.NewInMemoryStore()
+	destination, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := destination.Import(bytes.NewReader(backup.Bytes()), []byte("wrong")); !errors.Is(err, ring.ErrInvalidBackup) {
+		t.Errorf("expected ErrInvalidBackup for wrong passphrase, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := destination.Import(bytes.NewReader(backup.Bytes()), []byte("passphrase")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := destination.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected imported key to verify signature, got %v", err)
+	}
+	// The destination has no Encryptor, so the key must be stored decrypted
+	if _, err := destination.GetSigningKey(keyID); err != nil {
+		t.Errorf("expected imported private key to be decrypted, got %v", err)
+	}
+}
+
+func TestImportRejectsExcessiveIterations(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backup bytes.Buffer
+	if err := keychain.Export(&backup, []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(backup.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	envelope["iterations"] = 2147483647
+	crafted, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- keychain.Import(bytes.NewReader(crafted), []byte("passphrase")) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ring.ErrInvalidBackup) {
+			t.Errorf("expected ErrInvalidBackup, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the iterations to be rejected before deriving the key")
+	}
+}
+
+func TestImportDoesNotRestoreRevokedKeys(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backup bytes.Buffer
+	if err := keychain.Export(&backup, []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Import(&backup, []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.GetVerifier(key.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected revoked key to stay revoked after import, got %v", err)
+	}
+	if _, err := keychain.GetSigningKey(key.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected revoked private key to stay deleted after import, got %v", err)
+	}
+}
+
+func TestWatchStore(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, VerifierCacheTTL: time.Hour}
+	one, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer one.Close()
+	two, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer two.Close()
+
+	key, err := two.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := two.GetVerifier(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := one.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached verifier is dropped once the deletion has been seen
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := two.GetVerifier(key.ID)
+		if errors.Is(err, ring.ErrKeyNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected revoked verifier to be dropped from cache, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	replaced, err := two.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.ID == key.ID {
+		t.Error("expected revoked signing key to be replaced")
+	}
+}
+
+func TestCertificates(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.ECDSAP256, Certificates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := keychain.GetVerifier(signingKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := verifier.Certificate
+	if cert == nil {
+		t.Fatal("expected verifier to have a certificate")
+	}
+	if cert.Subject.CommonName != signingKey.ID || !cert.NotAfter.Equal(signingKey.VerifiableUntil.Truncate(time.Second)) {
+		t.Errorf("unexpected certificate %v valid until %v", cert.Subject, cert.NotAfter)
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		t.Errorf("expected self-signed certificate, got %v", err)
+	}
+	pemData, err := verifier.EncodeCertPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode(pemData); block == nil || block.Type != "CERTIFICATE" {
+		t.Errorf("unexpected PEM %q", pemData)
+	}
+
+	verifiers, err := ring.NewVerifierOnlyWithOptions(s, ring.Options{Certificates: true}).ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].Certificate == nil {
+		t.Errorf("expected listed verifier to have a certificate, got %v", verifiers)
+	}
+	if _, err := ring.NewVerifierOnly(s).ListVerifiers(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateIssuer(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm: ring.Ed25519,
+		CertificateIssuer: func(template *x509.Certificate, pub crypto.PublicKey) ([]byte, error) {
+			return x509.CreateCertificate(rand.Reader, template, ca, pub, caKey)
+		},
+		CertificateChain: []*x509.Certificate{ca},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].Certificate == nil {
+		t.Fatalf("expected verifier with certificate, got %v", verifiers)
+	}
+	if err := verifiers[0].Certificate.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("expected certificate signed by CA, got %v", err)
+	}
+
+	var set ring.JWKSet
+	data, err := keychain.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+	jwk := set.Keys[0]
+	want := []string{
+		base64.StdEncoding.EncodeToString(verifiers[0].Certificate.Raw),
+		base64.StdEncoding.EncodeToString(ca.Raw),
+	}
+	if !reflect.DeepEqual(jwk.X5C, want) {
+		t.Errorf("expected x5c with certificate and CA, got %v", jwk.X5C)
+	}
+	thumbprint := sha256.Sum256(verifiers[0].Certificate.Raw)
+	if jwk.X5TS256 != base64.RawURLEncoding.EncodeToString(thumbprint[:]) {
+		t.Errorf("unexpected x5t#S256 %v", jwk.X5TS256)
+	}
+	if !strings.Contains(string(data), `"x5t#S256"`) {
+		t.Errorf("expected x5t#S256 member in %s", data)
+	}
+}
+
+func TestRetainSigningKeys(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: 4 * time.Hour,
+		RetainSigningKeys:  2,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []*ring.SigningKey
+	for i := 0; i < 3; i++ {
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		clock.Advance(61 * time.Minute)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.ID == keys[2].ID {
+		t.Fatal("expected key to be rotated")
+	}
+
+	if _, err := keychain.GetSigningKey(keys[0].ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected oldest key to be gone, got %v", err)
+	}
+	for _, key := range keys[1:] {
+		retained, err := keychain.GetSigningKey(key.ID)
+		if err != nil {
+			t.Fatalf("expected %v to be retained, got %v", key.ID, err)
+		}
+		if !retained.RotatedAt.Equal(key.RotatedAt) || !retained.VerifiableUntil.Equal(key.VerifiableUntil) {
+			t.Errorf("got retained key %+v want %+v", retained, key)
+		}
+	}
+	if _, err := keychain.GetSigningKey("pub:" + current.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected verifier key not to be returned, got %v", err)
+	}
+
+	_, err = ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: 2 * time.Hour,
+		RetainSigningKeys:  2,
+	})
+	if err == nil {
+		t.Error("expected retention exceeding the verification period to be rejected")
+	}
+}
+
+func TestGetSigningKey(t *testing.T) {
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: 2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.GetSigningKeyContext(context.Background(), current.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("message")
+	signature, err := key.Key.Sign(rand.Reader, message, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(current.Key.Public().(ed25519.PublicKey), message, signature) {
+		t.Error("expected signature to verify with the current key")
+	}
+	if _, err := keychain.GetSigningKey("unknown"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+// renewingStore has a lock which must be renewed, and blocks when private
+// keys are added until released
+type renewingStore struct {
+	store.Store
+	adding  chan struct{}
+	release chan struct{}
+	renewed chan struct{}
+}
+
+func (s *renewingStore) Add(key store.Key) error {
+	if key.IsPrivate {
+		s.adding <- struct{}{}
+		<-s.release
+	}
+	return s.Store.Add(key)
+}
+
+func (s *renewingStore) LockTTL() time.Duration { return 30 * time.Second }
+
+func (s *renewingStore) HandlesTTL() bool { return true }
+
+func (s *renewingStore) RenewLock() error {
+	s.renewed <- struct{}{}
+	return nil
+}
+
+func TestLockIsRenewed(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := &renewingStore{
+		Store:   inmem.NewInMemoryStore(),
+		adding:  make(chan struct{}),
+		release: make(chan struct{}),
+		renewed: make(chan struct{}, 1),
+	}
+	result := make(chan error, 1)
+	go func() {
+		_, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519, Clock: clock})
+		result <- err
+	}()
+
+	<-s.adding
+	deadline := time.Now().Add(5 * time.Second)
+	for clock.PendingTimers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for lock renewal to be scheduled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(10 * time.Second)
+	select {
+	case <-s.renewed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected lock to be renewed while held")
+	}
+	close(s.release)
+
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if n := clock.PendingTimers(); n != 0 {
+		t.Errorf("expected renewal to stop after unlocking, got %d pending timers", n)
+	}
+}
+
+func TestExpiredKeysAreDeleted(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	var expired []string
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Minute,
+		VerificationPeriod: 2 * time.Minute,
+		Clock:              clock,
+		OnKeyExpired:       func(id string) { expired = append(expired, id) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+	first, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A background timer is left when the keychain is idle, the one of the
+	// cleanup
+	waitForTimers := func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for clock.PendingTimers() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for cleanup to be scheduled")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitForTimers()
+	clock.Advance(5 * time.Minute)
+	waitForTimers()
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if strings.HasSuffix(key.ID, first.ID) {
+			t.Errorf("expected expired key %v to be deleted", key.ID)
+		}
+	}
+	if len(expired) != 1 || expired[0] != first.ID {
+		t.Errorf("expected expiry of %v to be reported, got %v", first.ID, expired)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Minute,
+		VerificationPeriod: 2 * time.Minute,
+		CleanupInterval:    -1,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+	if n := clock.PendingTimers(); n != 0 {
+		t.Errorf("expected no cleanup to be scheduled, got %d pending timers", n)
+	}
+
+	clock.Advance(3 * time.Minute)
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.PurgeExpired(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) >= len(before) {
+		t.Fatalf("expected expired keys to be purged, %d keys before and %d after", len(before), len(after))
+	}
+	for _, key := range after {
+		if !key.ExpiresAt.After(clock.Now()) {
+			t.Errorf("expected expired key %v to be purged", key.ID)
+		}
+	}
+}
+
+func TestMixedRotationFrequency(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	hourly, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  time.Hour,
+		VerificationPeriod: 2 * time.Hour,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := hourly.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:          ring.Ed25519,
+		RotationFrequency:  24 * time.Hour,
+		VerificationPeriod: 48 * time.Hour,
+		SigningGracePeriod: time.Hour,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := daily.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID != key.ID || !loaded.RotatedAt.Equal(key.RotatedAt) || !loaded.VerifiableUntil.Equal(key.VerifiableUntil) {
+		t.Errorf("expected the schedule of the stored key %s, rotated at %v and verifiable until %v, got %s, %v and %v",
+			key.ID, key.RotatedAt, key.VerifiableUntil, loaded.ID, loaded.RotatedAt, loaded.VerifiableUntil)
+	}
+}
+
+func TestKeyMetadata(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:  ring.ECDSAP384,
+		InstanceID: "instance",
+		Clock:      clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Algorithm != ring.ECDSAP384 || !key.CreatedAt.Equal(clock.Now()) {
+		t.Errorf("got algorithm %v created at %v", key.Algorithm, key.CreatedAt)
+	}
+
+	private, err := s.Find(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		ring.MetadataAlgorithm:  "ECDSA-P384",
+		ring.MetadataKeySize:    "384",
+		ring.MetadataCreatedAt:  "2020-01-01T00:00:00Z",
+		ring.MetadataPurpose:    ring.PurposeSigning,
+		ring.MetadataInstanceID: "instance",
+
+		ring.MetadataSignatureAlgorithm: "ES384",
+		ring.MetadataRotatedAt:          "2020-01-01T01:00:00Z",
+		ring.MetadataVerifiableUntil:    "2020-01-01T02:00:00Z",
+	}
+	if !reflect.DeepEqual(private.Metadata, want) {
+		t.Errorf("got metadata %v want %v", private.Metadata, want)
+	}
+
+	verifier, err := keychain.GetVerifier(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier.Algorithm != ring.ECDSAP384 || !verifier.CreatedAt.Equal(key.CreatedAt) {
+		t.Errorf("got verifier algorithm %v created at %v", verifier.Algorithm, verifier.CreatedAt)
+	}
+
+	// Keys stored without metadata get their algorithm from the key
+	public, err := s.Find("pub:" + key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public.ID = "pub:legacy"
+	public.Metadata = nil
+	if err := s.Add(public); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := keychain.GetVerifier("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Algorithm != ring.ECDSAP384 || !legacy.CreatedAt.IsZero() {
+		t.Errorf("got legacy algorithm %v created at %v", legacy.Algorithm, legacy.CreatedAt)
+	}
+}
+
+func TestStorageFormat(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	legacy, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519, LegacyStorageFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := legacy.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.Find(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(stored.Data); err != nil {
+		t.Errorf("expected legacy format to be plain PKCS #8, got %v", err)
+	}
+
+	current, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := current.GetSigningKey(key.ID); err != nil {
+		t.Errorf("expected legacy private key to be readable, got %v", err)
+	}
+	if _, err := current.GetVerifier(key.ID); err != nil {
+		t.Errorf("expected legacy public key to be readable, got %v", err)
+	}
+	if err := current.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := current.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.GetSigningKey(rotated.ID); err != nil {
+		t.Errorf("expected versioned private key to be readable, got %v", err)
+	}
+
+	// A record written by a later version of the format
+	header := []byte(`{"v":2,"encoding":"pkcs8"}`)
+	future := append([]byte("\x00hsson/ring\x00\x00\x00\x00"), byte(len(header)))
+	future = append(append(future, header...), stored.Data...)
+	err = s.Add(store.Key{ID: "future", IsPrivate: true, ExpiresAt: stored.ExpiresAt, Data: future})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := current.GetSigningKey("future"); !errors.Is(err, ring.ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+// taggedCodec prefixes the serialized keys of ring.DefaultCodec with a tag
+type taggedCodec struct{}
+
+var codecTag = []byte("tagged:")
+
+func (taggedCodec) MarshalPrivateKey(key crypto.Signer) ([]byte, error) {
+	data, err := ring.DefaultCodec.MarshalPrivateKey(key)
+	return append(append([]byte{}, codecTag...), data...), err
+}
+
+func (taggedCodec) UnmarshalPrivateKey(data []byte) (crypto.Signer, error) {
+	if !bytes.HasPrefix(data, codecTag) {
+		return nil, errors.New("untagged key")
+	}
+	return ring.DefaultCodec.UnmarshalPrivateKey(data[len(codecTag):])
+}
+
+func (taggedCodec) MarshalPublicKey(key crypto.PublicKey) ([]byte, error) {
+	data, err := ring.DefaultCodec.MarshalPublicKey(key)
+	return append(append([]byte{}, codecTag...), data...), err
+}
+
+func (taggedCodec) UnmarshalPublicKey(data []byte) (crypto.PublicKey, error) {
+	if !bytes.HasPrefix(data, codecTag) {
+		return nil, errors.New("untagged key")
+	}
+	return ring.DefaultCodec.UnmarshalPublicKey(data[len(codecTag):])
+}
+
+func TestCodec(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.Ed25519, Codec: taggedCodec{}}
+	keychain, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{keyID, "pub:" + keyID} {
+		key, err := s.Find(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(key.Data, codecTag) {
+			t.Errorf("expected %s to be serialized by the codec", id)
+		}
+	}
+
+	reloaded, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := reloaded.SigningKey(); err != nil || key.ID != keyID {
+		t.Errorf("expected the stored key %s to be loaded, got %v", keyID, err)
+	}
+	if err := reloaded.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Error(err)
+	}
+	if _, err := ring.NewVerifierOnly(s).GetVerifier(keyID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected keys of another codec not to be found, got %v", err)
+	}
+}
+
+func TestPostQuantum(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	options := ring.Options{Algorithm: ring.ECDSAP256, PostQuantum: ring.MLDSA65}
+	keychain, err := ring.NewKeychain(s, options)
+	if errors.Is(err, ring.ErrPostQuantumUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.PostQuantum == nil {
+		t.Fatal("expected the signing key to be paired with a post-quantum key")
+	}
+	data := []byte("data")
+	signature, err := key.PostQuantum.Sign(rand.Reader, data, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := ring.NewVerifierOnlyWithOptions(s, options).GetVerifier(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier.PostQuantum == nil || verifier.PostQuantum.ID != ring.PostQuantumKeyID(key.ID) {
+		t.Fatalf("expected the post-quantum key %s, got %+v", ring.PostQuantumKeyID(key.ID), verifier.PostQuantum)
+	}
+	if err := verifier.PostQuantum.Verify(data, signature); err != nil {
+		t.Error(err)
+	}
+	if err := verifier.PostQuantum.Verify([]byte("other"), signature); err == nil {
+		t.Error("expected signatures of other data not to verify")
+	}
+
+	reloaded, err := ring.NewKeychain(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := reloaded.SigningKey(); err != nil || key.PostQuantum == nil {
+		t.Errorf("expected the stored post-quantum key to be loaded, got %v", err)
+	}
+
+	data, err = keychain.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set ring.JWKSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, jwk := range set.Keys {
+		if jwk.KeyID == ring.PostQuantumKeyID(key.ID) {
+			found = jwk.KeyType == "AKP" && jwk.Algorithm == string(ring.MLDSA65) && jwk.Public != ""
+		}
+	}
+	if !found {
+		t.Errorf("expected the JWKS to publish the post-quantum key, got %s", data)
+	}
+
+	if err := keychain.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"pqkey:" + key.ID, "pq:" + key.ID} {
+		if _, err := s.Find(id); !errors.Is(err, ring.ErrKeyNotFound) {
+			t.Errorf("expected %s to be deleted on revocation, got %v", id, err)
+		}
+	}
+}
+
+func TestKeyDataEncoding(t *testing.T) {
+	encryptor, err := crypt.NewAESGCM(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoding := range []ring.KeyDataEncoding{ring.KeyDataDER, ring.KeyDataPEM, ring.KeyDataCompressed} {
+		s := inmem.NewInMemoryStore()
+		options := ring.Options{Algorithm: ring.ECDSAP256, Encryptor: encryptor, Certificates: true, KeyDataEncoding: encoding}
+		keychain, err := ring.NewKeychain(s, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := s.Find("pub:" + key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Metadata[ring.MetadataDataEncoding] != string(encoding) {
+			t.Errorf("%s: expected the encoding in the metadata, got %v", encoding, stored.Metadata)
+		}
+		if encoding == ring.KeyDataPEM && !strings.HasPrefix(string(stored.Data), "-----BEGIN PUBLIC KEY-----") {
+			t.Errorf("%s: expected a PEM public key, got %q", encoding, stored.Data)
+		}
+
+		// Keys of any encoding are readable
+		options.KeyDataEncoding = ""
+		reader, err := ring.NewKeychain(s, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reader.GetSigningKey(key.ID); err != nil {
+			t.Errorf("%s: expected private key to be readable, got %v", encoding, err)
+		}
+		verifier, err := reader.GetVerifier(key.ID)
+		if err != nil {
+			t.Fatalf("%s: expected public key to be readable, got %v", encoding, err)
+		}
+		if verifier.Certificate == nil {
+			t.Errorf("%s: expected certificate to be readable", encoding)
+		}
+	}
+
+	options := ring.Options{KeyDataEncoding: ring.KeyDataPEM, LegacyStorageFormat: true}
+	if err := options.Validate(); err == nil {
+		t.Error("expected KeyDataEncoding with LegacyStorageFormat to be invalid")
+	}
 }
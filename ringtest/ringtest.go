@@ -0,0 +1,466 @@
+// Package ringtest provides a fake Keychain for unit tests of code using a
+// keychain. Keys are derived from a counter, so signatures and IDs are the
+// same in every test run, and nothing ever expires unless told to.
+//
+// Store implementations can be tested with package ringtest/storetest, and
+// verifiers in other languages with the test vectors of ringtest/vectors.
+package ringtest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+)
+
+// Forever is the expiry of all keys created by the fake keychain
+var Forever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Keychain is a deterministic, in-memory implementation of ring.Keychain
+// using Ed25519 keys. The first key is "key-1", and every rotation creates
+// the next one.
+type Keychain struct {
+	mu       sync.Mutex
+	keys     map[string]*ring.SigningKey
+	expires  map[string]time.Time
+	revoked  []string
+	current  *ring.SigningKey
+	previous *ring.SigningKey
+	rotation int
+	// signatures counts the signatures made by Sign per key
+	signatures map[string]uint64
+}
+
+var _ ring.Keychain = (*Keychain)(nil)
+
+// NewKeychain creates a fake keychain holding its first key
+func NewKeychain() *Keychain {
+	k := &Keychain{
+		keys:       make(map[string]*ring.SigningKey),
+		expires:    make(map[string]time.Time),
+		signatures: make(map[string]uint64),
+	}
+	k.rotate()
+	return k
+}
+
+func (k *Keychain) rotate() *ring.SigningKey {
+	k.previous = k.current
+	k.current = k.newKey()
+	return k.current
+}
+
+// newKey adds a key which is valid forever
+func (k *Keychain) newKey() *ring.SigningKey {
+	k.rotation++
+	id := fmt.Sprintf("key-%d", k.rotation)
+	seed := sha256.Sum256([]byte("hsson/ring/ringtest:" + id))
+	key := &ring.SigningKey{
+		ID:                 id,
+		Key:                ed25519.NewKeyFromSeed(seed[:]),
+		RotatedAt:          Forever,
+		VerifiableUntil:    Forever,
+		Algorithm:          ring.Ed25519,
+		SignatureAlgorithm: ring.EdDSA,
+	}
+	k.keys[id] = key
+	k.expires[id] = Forever
+	return key
+}
+
+func (k *Keychain) verifier(id string) (*ring.VerifierKey, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, ring.ErrKeyNotFound
+	}
+	return &ring.VerifierKey{
+		ID:                 id,
+		Key:                key.Key.Public(),
+		ExpiresAt:          k.expires[id],
+		Algorithm:          ring.Ed25519,
+		SignatureAlgorithm: ring.EdDSA,
+	}, nil
+}
+
+// Expire removes the key with the given ID, as if it had expired
+func (k *Keychain) Expire(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, id)
+	delete(k.expires, id)
+}
+
+func (k *Keychain) SigningKey() (*ring.SigningKey, error) {
+	return k.SigningKeyContext(context.Background())
+}
+
+func (k *Keychain) SigningKeyContext(ctx context.Context) (*ring.SigningKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[k.current.ID]; !ok {
+		return k.rotate(), nil
+	}
+	return k.current, nil
+}
+
+func (k *Keychain) GetVerifier(id string) (*ring.VerifierKey, error) {
+	return k.GetVerifierContext(context.Background(), id)
+}
+
+func (k *Keychain) GetVerifierContext(ctx context.Context, id string) (*ring.VerifierKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	verifier, err := k.verifier(id)
+	if err == ring.ErrKeyNotFound {
+		if keyID, tenantID, ok := ring.ParseTenantKeyID(id); ok {
+			if verifier, err = k.verifier(keyID); err == nil {
+				verifier = verifier.ForTenant(tenantID)
+			}
+		}
+	}
+	return verifier, err
+}
+
+// GetVerifiers returns the keys with the provided IDs, leaving out those
+// not found
+func (k *Keychain) GetVerifiers(ids ...string) (map[string]*ring.VerifierKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	res := make(map[string]*ring.VerifierKey, len(ids))
+	for _, id := range ids {
+		if verifier, err := k.verifier(id); err == nil {
+			res[id] = verifier
+		}
+	}
+	return res, nil
+}
+
+func (k *Keychain) GetVerifierByFingerprint(fingerprint ring.Fingerprint) (*ring.VerifierKey, error) {
+	verifiers, err := k.ListVerifiers()
+	if err != nil {
+		return nil, err
+	}
+	for _, verifier := range verifiers {
+		if verifier.Fingerprint() == fingerprint {
+			return verifier, nil
+		}
+	}
+	return nil, ring.ErrKeyNotFound
+}
+
+func (k *Keychain) ListVerifiers() ([]*ring.VerifierKey, error) {
+	return k.ListVerifiersContext(context.Background())
+}
+
+func (k *Keychain) ListVerifiersContext(ctx context.Context) ([]*ring.VerifierKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	verifiers := make([]*ring.VerifierKey, 0, len(k.keys))
+	for id := range k.keys {
+		verifier, _ := k.verifier(id)
+		verifiers = append(verifiers, verifier)
+	}
+	sort.Slice(verifiers, func(i, j int) bool {
+		if !verifiers[i].ExpiresAt.Equal(verifiers[j].ExpiresAt) {
+			return verifiers[i].ExpiresAt.Before(verifiers[j].ExpiresAt)
+		}
+		return verifiers[i].ID < verifiers[j].ID
+	})
+	return verifiers, nil
+}
+
+// ListVerifiersPage pages through ListVerifiers, using the offset of the
+// next page as cursor
+func (k *Keychain) ListVerifiersPage(cursor string, limit int) ([]*ring.VerifierKey, string, error) {
+	verifiers, err := k.ListVerifiers()
+	if err != nil {
+		return nil, "", err
+	}
+	offset := 0
+	if cursor != "" {
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 || offset > len(verifiers) {
+			return nil, "", ring.ErrInvalidCursor
+		}
+	}
+	verifiers = verifiers[offset:]
+	if limit <= 0 || len(verifiers) <= limit {
+		return verifiers, "", nil
+	}
+	return verifiers[:limit], strconv.Itoa(offset + limit), nil
+}
+
+// ListVerifiersWithMeta lists all keys, which may be cached until the
+// first of them expires
+func (k *Keychain) ListVerifiersWithMeta(ctx context.Context) ([]*ring.VerifierKey, ring.VerifierListMeta, error) {
+	verifiers, err := k.ListVerifiersContext(ctx)
+	if err != nil {
+		return nil, ring.VerifierListMeta{}, err
+	}
+	until := Forever
+	for _, verifier := range verifiers {
+		if verifier.ExpiresAt.Before(until) {
+			until = verifier.ExpiresAt
+		}
+	}
+	return verifiers, ring.VerifierListMeta{CacheUntil: until, MaxAge: time.Until(until)}, nil
+}
+
+func (k *Keychain) JWKS() ([]byte, error) {
+	verifiers, err := k.ListVerifiers()
+	if err != nil {
+		return nil, err
+	}
+	set := ring.JWKSet{Keys: make([]ring.JWK, len(verifiers))}
+	for i, verifier := range verifiers {
+		if set.Keys[i], err = verifier.ToJWK(); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(set)
+}
+
+func (k *Keychain) Rotate() error {
+	return k.RotateContext(context.Background())
+}
+
+func (k *Keychain) RotateContext(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.rotate()
+	return nil
+}
+
+// Promote always fails with ring.ErrNoStagedKey, as the fake keychain
+// rotates right away
+func (k *Keychain) Promote() error {
+	return ring.ErrNoStagedKey
+}
+
+func (k *Keychain) ExtendVerifier(id string, expiresAt time.Time) (*ring.VerifierKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return nil, ring.ErrKeyNotFound
+	}
+	if !expiresAt.After(k.expires[id]) {
+		return nil, ring.ErrExtensionNotAllowed
+	}
+	k.expires[id] = expiresAt
+	return k.verifier(id)
+}
+
+// GetSigningKey returns any key of the fake keychain which has not been
+// expired or revoked
+func (k *Keychain) GetSigningKey(id string) (*ring.SigningKey, error) {
+	return k.GetSigningKeyContext(context.Background(), id)
+}
+
+// GetSigningKeyContext is like GetSigningKey. The context is ignored.
+func (k *Keychain) GetSigningKeyContext(ctx context.Context, id string) (*ring.SigningKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, ring.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// NewKeyWithOptions adds a key to the fake keychain without making it
+// current. The options are ignored, and the key never expires.
+// PreviousSigningKey returns the signing key used before the current one,
+// unless it was expired
+func (k *Keychain) PreviousSigningKey() (*ring.SigningKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.previous == nil || k.keys[k.previous.ID] == nil {
+		return nil, ring.ErrKeyNotFound
+	}
+	return k.previous, nil
+}
+
+func (k *Keychain) NewKeyWithOptions(opts ring.KeyOptions) (*ring.SigningKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.newKey(), nil
+}
+
+// ImportSigningKey adds key to the fake keychain. Only Ed25519 keys are
+// supported, and opts.ID must be set.
+func (k *Keychain) ImportSigningKey(key crypto.Signer, opts ring.ImportOptions) (*ring.SigningKey, error) {
+	if _, ok := key.(ed25519.PrivateKey); !ok {
+		return nil, fmt.Errorf("ringtest: unsupported key type %T", key)
+	}
+	if opts.ID == "" {
+		return nil, errors.New("ringtest: imported keys must have an ID")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	expires := opts.VerifiableUntil
+	if expires.IsZero() {
+		expires = Forever
+	}
+	imported := &ring.SigningKey{
+		ID:              opts.ID,
+		Key:             key,
+		RotatedAt:       Forever,
+		VerifiableUntil: expires,
+	}
+	k.keys[opts.ID] = imported
+	k.expires[opts.ID] = expires
+	if opts.MakeCurrent {
+		k.previous, k.current = k.current, imported
+	}
+	return imported, nil
+}
+
+// Export is not supported by the fake keychain
+func (k *Keychain) Export(w io.Writer, passphrase []byte) error {
+	return errors.New("ringtest: export not supported")
+}
+
+// Import is not supported by the fake keychain
+func (k *Keychain) Import(r io.Reader, passphrase []byte) error {
+	return errors.New("ringtest: import not supported")
+}
+
+// PurgeExpired does nothing, as keys removed by Expire are already gone
+func (k *Keychain) PurgeExpired() error {
+	return nil
+}
+
+// PurgeExpiredContext does nothing, like PurgeExpired
+func (k *Keychain) PurgeExpiredContext(ctx context.Context) error {
+	return nil
+}
+
+func (k *Keychain) Revoke(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return ring.ErrKeyNotFound
+	}
+	delete(k.keys, id)
+	delete(k.expires, id)
+	k.revoked = append(k.revoked, id)
+	if k.current.ID == id {
+		k.rotate()
+	}
+	return nil
+}
+
+// EmergencyRotate rotates the key and revokes all others
+func (k *Keychain) EmergencyRotate(reason string) (*ring.SigningKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := k.rotate()
+	for id := range k.keys {
+		if id != key.ID {
+			delete(k.keys, id)
+			delete(k.expires, id)
+			k.revoked = append(k.revoked, id)
+		}
+	}
+	return key, nil
+}
+
+func (k *Keychain) RevocationList() (*ring.RevocationList, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	rl := &ring.RevocationList{
+		IssuedAt: time.Time{},
+		KeyIDs:   append([]string{}, k.revoked...),
+		SignerID: k.current.ID,
+	}
+	// Matches the payload signed by the real keychain
+	payload, err := json.Marshal(struct {
+		IssuedAt time.Time `json:"issued_at"`
+		KeyIDs   []string  `json:"revoked"`
+		SignerID string    `json:"kid"`
+	}{rl.IssuedAt, rl.KeyIDs, rl.SignerID})
+	if err != nil {
+		return nil, err
+	}
+	rl.Signature = ed25519.Sign(k.current.Key.(ed25519.PrivateKey), payload)
+	return rl, nil
+}
+
+// Heartbeat does nothing, as the fake keychain has no other instances
+func (k *Keychain) Heartbeat() error {
+	return nil
+}
+
+// WaitReady returns right away, as the fake keychain is always ready
+func (k *Keychain) WaitReady(ctx context.Context) error {
+	return nil
+}
+
+// Healthy always succeeds, as the fake keychain has no store
+func (k *Keychain) Healthy(ctx context.Context) error {
+	return nil
+}
+
+// Status reports the current key, which is never rotated automatically
+func (k *Keychain) Status() (*ring.Status, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return &ring.Status{KeyID: k.current.ID, Fingerprint: k.current.Fingerprint(), NextRotation: Forever, ActiveVerifiers: len(k.keys)}, nil
+}
+
+// DetectDrift never reports any drift
+func (k *Keychain) DetectDrift(threshold time.Duration) ([]ring.Drift, error) {
+	return nil, nil
+}
+
+func (k *Keychain) Sign(data []byte) ([]byte, string, error) {
+	key, err := k.SigningKey()
+	if err != nil {
+		return nil, "", err
+	}
+	k.mu.Lock()
+	k.signatures[key.ID]++
+	k.mu.Unlock()
+	return ed25519.Sign(key.Key.(ed25519.PrivateKey), data), key.ID, nil
+}
+
+// SignatureCount returns the number of signatures made by Sign with the key
+func (k *Keychain) SignatureCount(keyID string) (uint64, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.signatures[keyID], nil
+}
+
+func (k *Keychain) Verify(keyID string, data, signature []byte) error {
+	verifier, err := k.GetVerifier(keyID)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(verifier.Key.(ed25519.PublicKey), data, signature) {
+		return ring.ErrInvalidSignature
+	}
+	return nil
+}
+
+func (k *Keychain) TenantSigner(tenantID string) (*ring.TenantSigner, error) {
+	return ring.NewTenantSigner(k, tenantID)
+}
+
+// Start does nothing, as keys of the fake keychain never expire
+func (k *Keychain) Start(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing
+func (k *Keychain) Close() error {
+	return nil
+}
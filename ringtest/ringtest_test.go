@@ -0,0 +1,57 @@
+package ringtest_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest"
+)
+
+func TestKeychainIsDeterministic(t *testing.T) {
+	one, two := ringtest.NewKeychain(), ringtest.NewKeychain()
+	sig1, id1, err := one.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig2, id2, err := two.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 != "key-1" || id1 != id2 || !bytes.Equal(sig1, sig2) {
+		t.Errorf("expected identical signatures by key-1, got %v and %v", id1, id2)
+	}
+}
+
+func TestKeychainRotateAndRevoke(t *testing.T) {
+	keychain := ringtest.NewKeychain()
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	key, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "key-2" {
+		t.Errorf("expected key-2 after rotation, got %v", key.ID)
+	}
+
+	if err := keychain.Revoke("key-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keychain.GetVerifier("key-1"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected revoked key to be gone, got %v", err)
+	}
+	rl, err := keychain.RevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := keychain.GetVerifier(rl.SignerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Verify(verifier); err != nil {
+		t.Errorf("expected revocation list to verify, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package storetest provides a conformance test suite for store.Store
+// implementations:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func() store.Store {
+//			return mystore.New(...)
+//		})
+//	}
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+// Run tests that stores created by newStore follow the contract of
+// store.Store. Every subtest gets a new, empty store.
+func Run(t *testing.T, newStore func() store.Store) {
+	t.Run("AddFind", func(t *testing.T) { testAddFind(t, newStore()) })
+	t.Run("AddConflict", func(t *testing.T) { testAddConflict(t, newStore()) })
+	t.Run("FindMissing", func(t *testing.T) { testFindMissing(t, newStore()) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStore()) })
+	t.Run("List", func(t *testing.T) { testList(t, newStore()) })
+	t.Run("Iterate", func(t *testing.T) { testIterate(t, newStore()) })
+	t.Run("Lock", func(t *testing.T) { testLock(t, newStore()) })
+	t.Run("RenewLock", func(t *testing.T) { testRenewLock(t, newStore()) })
+	t.Run("Keychain", func(t *testing.T) { testKeychain(t, newStore()) })
+}
+
+func newKey(id string, private bool) store.Key {
+	return store.Key{
+		ID:        id,
+		IsPrivate: private,
+		// Stores are only required to keep second precision
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+		Data:      []byte("data of " + id),
+		Metadata:  map[string]string{"algorithm": "Ed25519", "key id": id},
+	}
+}
+
+func checkEqual(t *testing.T, got, want store.Key) {
+	t.Helper()
+	if got.ID != want.ID || got.IsPrivate != want.IsPrivate || !got.ExpiresAt.Equal(want.ExpiresAt) || string(got.Data) != string(want.Data) || !reflect.DeepEqual(got.Metadata, want.Metadata) {
+		t.Errorf("got key %+v want %+v", got, want)
+	}
+}
+
+func testAddFind(t *testing.T, s store.Store) {
+	for _, key := range []store.Key{newKey("private", true), newKey("pub:public", false)} {
+		if err := s.Add(key); err != nil {
+			t.Fatal(err)
+		}
+		found, err := s.Find(key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, found, key)
+	}
+}
+
+func testAddConflict(t *testing.T, s store.Store) {
+	key := newKey("key", true)
+	if err := s.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	other := newKey("key", false)
+	other.Data = []byte("other")
+	if err := s.Add(other); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+	found, err := s.Find(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, found, key)
+}
+
+func testFindMissing(t *testing.T, s store.Store) {
+	if _, err := s.Find("missing"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func testDelete(t *testing.T, s store.Store) {
+	key := newKey("key", true)
+	if err := s.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(key.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound after delete, got %v", err)
+	}
+	if err := s.Delete("missing"); err != nil {
+		t.Errorf("expected no error deleting a missing key, got %v", err)
+	}
+	if err := s.Add(key); err != nil {
+		t.Errorf("expected a deleted ID to be reusable, got %v", err)
+	}
+}
+
+func testList(t *testing.T, s store.Store) {
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected new store to be empty, got %+v", keys)
+	}
+
+	want := map[string]store.Key{}
+	for _, key := range []store.Key{newKey("a", true), newKey("pub:a", false), newKey("b", true)} {
+		if err := s.Add(key); err != nil {
+			t.Fatal(err)
+		}
+		want[key.ID] = key
+	}
+	keys, err = s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(want) {
+		t.Errorf("got %d keys want %d", len(keys), len(want))
+	}
+	for _, key := range keys {
+		w, ok := want[key.ID]
+		if !ok {
+			t.Errorf("unexpected key %v", key.ID)
+			continue
+		}
+		checkEqual(t, key, w)
+	}
+}
+
+// testIterate is skipped for stores not implementing store.Iterator
+func testIterate(t *testing.T, s store.Store) {
+	it, ok := s.(store.Iterator)
+	if !ok {
+		t.Skip("store does not implement store.Iterator")
+	}
+	for _, key := range []store.Key{newKey("a", true), newKey("pub:a", false), newKey("b", true)} {
+		if err := s.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := map[string]bool{}
+	err := it.Iterate(func(key store.Key) bool {
+		seen[key.ID] = true
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected 3 keys, got %v", seen)
+	}
+	calls := 0
+	err = it.Iterate(func(key store.Key) bool {
+		calls++
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected iteration to stop after the first key, got %d calls", calls)
+	}
+}
+
+// testLock is skipped for stores not implementing store.Locker
+func testLock(t *testing.T, s store.Store) {
+	locker, ok := s.(store.Locker)
+	if !ok {
+		t.Skip("store does not implement store.Locker")
+	}
+	if err := locker.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied while locked, got %v", err)
+	}
+	if err := locker.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+	if err := locker.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testRenewLock is skipped for stores not implementing store.LockRenewer
+func testRenewLock(t *testing.T, s store.Store) {
+	renewer, ok := s.(store.LockRenewer)
+	if !ok {
+		t.Skip("store does not implement store.LockRenewer")
+	}
+	locker, ok := s.(store.Locker)
+	if !ok {
+		t.Skip("store does not implement store.Locker")
+	}
+	if renewer.LockTTL() <= 0 {
+		t.Errorf("expected a positive lock TTL, got %v", renewer.LockTTL())
+	}
+	if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+		t.Errorf("expected ErrLockLost before locking, got %v", err)
+	}
+	if err := locker.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := renewer.RenewLock(); err != nil {
+		t.Errorf("expected lock to be renewed, got %v", err)
+	}
+	if err := locker.Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied after renewing, got %v", err)
+	}
+	if err := locker.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+		t.Errorf("expected ErrLockLost after unlocking, got %v", err)
+	}
+}
+
+func testKeychain(t *testing.T, s store.Store) {
+	keychain, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stops watching stores implementing store.Watcher
+	defer keychain.Close()
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Errorf("expected signature to verify, got %v", err)
+	}
+	if err := keychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	verifiers, err := keychain.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 2 {
+		t.Errorf("expected 2 verifiers after rotation, got %d", len(verifiers))
+	}
+}
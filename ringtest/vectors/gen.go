@@ -0,0 +1,89 @@
+//go:build ignore
+// +build ignore
+
+// gen generates the vectors in data.go by signing the payload of each
+// algorithm with a new key, using a keychain. Keys and signatures change
+// every time it runs, so it is only meant to be run when adding algorithms.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store/inmem"
+)
+
+// algorithms maps the algorithms to the names of their constants
+var algorithms = []struct {
+	algorithm ring.Algorithm
+	name      string
+}{
+	{ring.RSA, "RSA"},
+	{ring.ECDSAP256, "ECDSAP256"},
+	{ring.ECDSAP384, "ECDSAP384"},
+	{ring.ECDSAP521, "ECDSAP521"},
+	{ring.Ed25519, "Ed25519"},
+}
+
+func main() {
+	var out bytes.Buffer
+	out.WriteString("// Code generated by gen.go; DO NOT EDIT.\n\npackage vectors\n\nimport \"github.com/hsson/ring\"\n\nvar vectors = []Vector{\n")
+	for _, a := range algorithms {
+		algorithm := a.algorithm
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: algorithm})
+		if err != nil {
+			log.Fatal(err)
+		}
+		payload := []byte(fmt.Sprintf("hsson/ring test vector: %s", algorithm))
+		signature, keyID, err := keychain.Sign(payload)
+		if err != nil {
+			log.Fatal(err)
+		}
+		key, err := keychain.GetSigningKey(keyID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		verifier, err := keychain.GetVerifier(keyID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		private, err := key.EncodeToPEM()
+		if err != nil {
+			log.Fatal(err)
+		}
+		public, err := verifier.EncodeToPEM()
+		if err != nil {
+			log.Fatal(err)
+		}
+		jwk, err := verifier.ToJWK()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&out, "\t{\n")
+		fmt.Fprintf(&out, "\t\tAlgorithm: ring.%s,\n", a.name)
+		fmt.Fprintf(&out, "\t\tSignatureAlgorithm: ring.%s,\n", verifier.SignatureAlgorithm)
+		fmt.Fprintf(&out, "\t\tKeyID: %q,\n", keyID)
+		fmt.Fprintf(&out, "\t\tPrivateKeyPEM: `%s`,\n", private)
+		fmt.Fprintf(&out, "\t\tPublicKeyPEM: `%s`,\n", public)
+		fmt.Fprintf(&out, "\t\tJWK: %#v,\n", jwk)
+		fmt.Fprintf(&out, "\t\tPayload: []byte(%q),\n", payload)
+		fmt.Fprintf(&out, "\t\tSignature: mustDecode(%q),\n", base64.StdEncoding.EncodeToString(signature))
+		fmt.Fprintf(&out, "\t},\n")
+		if err := keychain.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	out.WriteString("}\n")
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("data.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
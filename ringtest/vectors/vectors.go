@@ -0,0 +1,87 @@
+// Package vectors provides canonical signature test vectors, one for each
+// algorithm supported by ring, so implementations verifying ring-signed data
+// in other languages can be validated against known-good data. The vectors
+// are exported as JSON by command ringvectors.
+//
+// Signatures are created like Keychain.Sign: RSA keys sign using RSASSA-PSS
+// with SHA-256 and a salt as long as the hash, ECDSA keys sign using the
+// hash matching the curve and return an ASN.1 DER encoded signature, and
+// Ed25519 keys sign the payload itself.
+//
+// The keys are published and must never be used for anything but tests.
+package vectors
+
+//go:generate go run gen.go
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/hsson/ring"
+)
+
+// Vector is a signature of a payload created by a known key
+type Vector struct {
+	// Algorithm of the key
+	Algorithm ring.Algorithm `json:"algorithm"`
+	// SignatureAlgorithm is the JWS algorithm of the signature
+	SignatureAlgorithm ring.SignatureAlgorithm `json:"signature_algorithm"`
+	// KeyID is the ID of the key, as returned by Keychain.Sign
+	KeyID string `json:"kid"`
+	// PrivateKeyPEM is the PKCS #8 encoded private key
+	PrivateKeyPEM string `json:"private_key_pem"`
+	// PublicKeyPEM is the PKIX encoded public key
+	PublicKeyPEM string `json:"public_key_pem"`
+	// JWK is the public key as published in the JWKS of a keychain
+	JWK ring.JWK `json:"jwk"`
+	// Payload is the signed data
+	Payload []byte `json:"payload"`
+	// Signature of the payload
+	Signature []byte `json:"signature"`
+}
+
+// All returns the vectors of all algorithms
+func All() []Vector {
+	res := make([]Vector, len(vectors))
+	for i, v := range vectors {
+		res[i] = v
+		res[i].Payload = append([]byte(nil), v.Payload...)
+		res[i].Signature = append([]byte(nil), v.Signature...)
+	}
+	return res
+}
+
+// Get returns the vector of algorithm
+func Get(algorithm ring.Algorithm) (Vector, bool) {
+	for _, v := range All() {
+		if v.Algorithm == algorithm {
+			return v, true
+		}
+	}
+	return Vector{}, false
+}
+
+// MarshalJSON renders all vectors as a JSON array. Payloads and signatures
+// are base64 encoded with padding.
+func MarshalJSON() ([]byte, error) {
+	return json.MarshalIndent(All(), "", "  ")
+}
+
+// VerifierKey returns the public key of the vector, identified by its key
+// ID
+func (v Vector) VerifierKey() (*ring.VerifierKey, error) {
+	key, err := ring.VerifierKeyFromPEM([]byte(v.PublicKeyPEM))
+	if err != nil {
+		return nil, err
+	}
+	key.ID = v.KeyID
+	return key, nil
+}
+
+func mustDecode(s string) []byte {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
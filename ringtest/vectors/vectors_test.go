@@ -0,0 +1,76 @@
+package vectors_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/vectors"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestVectors(t *testing.T) {
+	for _, algorithm := range []ring.Algorithm{ring.RSA, ring.ECDSAP256, ring.ECDSAP384, ring.ECDSAP521, ring.Ed25519} {
+		v, ok := vectors.Get(algorithm)
+		if !ok {
+			t.Errorf("missing vector of %s", algorithm)
+			continue
+		}
+		key, err := ring.SigningKeyFromPEM([]byte(v.PrivateKeyPEM))
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: algorithm})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keychain.ImportSigningKey(key.Key, ring.ImportOptions{ID: v.KeyID, MakeCurrent: true}); err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if err := keychain.Verify(v.KeyID, v.Payload, v.Signature); err != nil {
+			t.Errorf("%s: expected valid signature, got %v", algorithm, err)
+		}
+		if err := keychain.Verify(v.KeyID, append(v.Payload, '.'), v.Signature); !errors.Is(err, ring.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", algorithm, err)
+		}
+
+		verifier, err := keychain.GetVerifier(v.KeyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if public, err := v.VerifierKey(); err != nil || !public.Equal(verifier) || public.ID != v.KeyID {
+			t.Errorf("%s: expected public key to match private key, got %v", algorithm, err)
+		}
+		if jwk, err := verifier.ToJWK(); err != nil || !reflect.DeepEqual(jwk, v.JWK) {
+			t.Errorf("%s: expected JWK %+v, got %+v (%v)", algorithm, v.JWK, jwk, err)
+		}
+		if v.SignatureAlgorithm != verifier.SignatureAlgorithm {
+			t.Errorf("%s: expected signature algorithm %s, got %s", algorithm, verifier.SignatureAlgorithm, v.SignatureAlgorithm)
+		}
+
+		// Ed25519 signatures are deterministic
+		if algorithm == ring.Ed25519 {
+			signature, _, err := keychain.Sign(v.Payload)
+			if err != nil || !bytes.Equal(signature, v.Signature) {
+				t.Errorf("expected Ed25519 signature to be reproduced, got %v", err)
+			}
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := vectors.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []vectors.Vector
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, vectors.All()) {
+		t.Error("expected vectors to survive a JSON round trip")
+	}
+}
@@ -0,0 +1,228 @@
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed Options.RotationSchedule
+type cronSchedule struct {
+	// Bit sets of the matching minutes, hours, days of the month, months
+	// and days of the week
+	minute, hour, dom, month, dow uint64
+	// Days match if both day fields do, unless neither is *, in which case
+	// either may match, like in cron
+	domStar, dowStar bool
+	location         *time.Location
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonths = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDays   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCronSchedule parses a schedule of five fields: minute, hour, day of
+// the month, month and day of the week, in UTC unless prefixed by
+// CRON_TZ=<location>
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	s := &cronSchedule{location: time.UTC}
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") {
+		i := strings.IndexByte(spec, ' ')
+		if i < 0 {
+			return nil, errors.New("hsson/ring: RotationSchedule has no fields")
+		}
+		location, err := time.LoadLocation(spec[len("CRON_TZ="):i])
+		if err != nil {
+			return nil, fmt.Errorf("hsson/ring: invalid RotationSchedule time zone: %w", err)
+		}
+		s.location, spec = location, strings.TrimSpace(spec[i:])
+	}
+	if expanded, ok := cronDescriptors[spec]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("hsson/ring: RotationSchedule must have 5 fields, got %d", len(fields))
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, err
+	}
+	// Sunday is both 0 and 7
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDays); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and *,
+// each optionally followed by a /step, into a bit set
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("hsson/ring: invalid step in RotationSchedule field %q", field)
+			}
+			part = part[:i]
+		}
+		low, high := min, max
+		switch i := strings.IndexByte(part, '-'); {
+		case part == "*":
+		case i >= 0:
+			var err error
+			if low, err = parseCronValue(part[:i], min, max, names); err != nil {
+				return 0, err
+			}
+			if high, err = parseCronValue(part[i+1:], min, max, names); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if low, err = parseCronValue(part, min, max, names); err != nil {
+				return 0, err
+			}
+			if step == 1 {
+				high = low
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("hsson/ring: invalid range in RotationSchedule field %q", field)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(value, name) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("hsson/ring: RotationSchedule value %q must be within %d-%d", value, min, max)
+	}
+	return n, nil
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time matching the schedule after t, or the zero
+// time if there is none within five years, e.g. for February 30th
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.matchesDay(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if !next.After(t) {
+			// Daylight saving time repeated the hour
+			next = t.Truncate(time.Hour).Add(time.Hour)
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+func (o Options) validateRotationSchedule() error {
+	if o.RotationSchedule == "" {
+		return nil
+	}
+	schedule, err := parseCronSchedule(o.RotationSchedule)
+	if err != nil {
+		return err
+	}
+	longest := schedule.longestInterval()
+	if longest == 0 {
+		return errors.New("hsson/ring: RotationSchedule never matches")
+	}
+	if o.RotationJitter != 0 {
+		return errors.New("hsson/ring: RotationSchedule can't be combined with RotationJitter")
+	}
+	if o.RotationFrequency < longest {
+		return fmt.Errorf("hsson/ring: RotationFrequency must be >= %v, the longest interval of RotationSchedule", longest)
+	}
+	return nil
+}
+
+// nextRotation returns when a signing key activated at from is rotated,
+// and until when it is verifiable
+func (r *ring) nextRotation(from time.Time) (rotatedAt, verifiableUntil time.Time) {
+	if r.schedule == nil {
+		return from.Add(r.rotationPeriod()), from.Add(r.options.VerificationPeriod)
+	}
+	rotatedAt = r.schedule.next(from)
+	return rotatedAt, rotatedAt.Add(r.options.VerificationPeriod - r.options.RotationFrequency)
+}
+
+// longestInterval returns the longest time between two consecutive times of
+// the schedule, looking at up to four years, or zero if it never matches
+func (s *cronSchedule) longestInterval() time.Duration {
+	start := time.Date(2001, 1, 1, 0, 0, 0, 0, s.location)
+	limit := start.AddDate(4, 0, 0)
+	var longest time.Duration
+	prev := s.next(start)
+	for i := 0; i < 10000 && !prev.IsZero() && prev.Before(limit); i++ {
+		t := s.next(prev)
+		if t.IsZero() {
+			break
+		}
+		if interval := t.Sub(prev); interval > longest {
+			longest = interval
+		}
+		prev = t
+	}
+	return longest
+}
@@ -0,0 +1,304 @@
+package ring
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+const (
+	secretIDPrefix     = "secret:"
+	encryptionIDPrefix = "enc:"
+	// secretSize is the size in bytes of generated secrets, matching the
+	// block of HMAC-SHA256
+	secretSize = 32
+)
+
+// Secret is a shared secret of a SecretKeychain, used both to sign and to
+// verify
+type Secret struct {
+	ID  string
+	Key []byte
+	// CreatedAt is when the secret was created
+	CreatedAt time.Time
+	// RotatedAt is when the secret is replaced by a new signing secret
+	RotatedAt time.Time
+	// ExpiresAt is when the secret is deleted, after which signatures made
+	// with it no longer verify
+	ExpiresAt time.Time
+}
+
+// SecretKeychain rotates shared secrets instead of keypairs, e.g. for HMAC
+// signatures of webhooks. Secrets are rotated every RotationFrequency and
+// kept for VerificationPeriod, like the keys of a Keychain.
+type SecretKeychain interface {
+	// SigningSecret returns the current secret, rotating it if it has
+	// expired
+	SigningSecret() (*Secret, error)
+	// GetSecret returns the secret identified by id. It returns
+	// ErrKeyNotFound if there is no such secret or it has expired.
+	GetSecret(id string) (*Secret, error)
+	// Rotate replaces the current secret right away
+	Rotate() error
+	// Sign signs data using HMAC-SHA256 with the current secret, and
+	// returns the signature together with the ID of the secret used
+	Sign(data []byte) (signature []byte, keyID string, err error)
+	// Verify checks a signature created by Sign, using the secret
+	// identified by keyID. ErrInvalidSignature is returned if the
+	// signature does not match.
+	Verify(keyID string, data, signature []byte) error
+}
+
+// NewSecretKeychain creates a SecretKeychain using the store. Secrets are
+// encrypted by the Encryptor of options, which is required. The Algorithm,
+// KeySize, IDStrategy and options of signing keys in general are not used.
+// A secret keychain may share a namespace with a Keychain.
+func NewSecretKeychain(s store.Store, options Options) (SecretKeychain, error) {
+	options = options.withDefaults()
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	if options.Encryptor == nil {
+		return nil, errors.New("hsson/ring: secret keychains require an Encryptor")
+	}
+	return newSecretKeychain(s, options, secretIDPrefix, PurposeSecret), nil
+}
+
+// newSecretKeychain creates a secretKeychain keeping its secrets under
+// prefix. options must have been validated.
+func newSecretKeychain(s store.Store, options Options, prefix, purpose string) *secretKeychain {
+	if options.Logger == nil {
+		options.Logger = nopLogger{}
+	}
+	cs := withKeyLayout(withStoreTimeout(store.WithContext(s), options.StoreTimeout), options)
+	return &secretKeychain{
+		verifier: newVerifier(cs, options),
+		prefix:   prefix,
+		purpose:  purpose,
+		secrets:  make(map[string]*Secret),
+	}
+}
+
+type secretKeychain struct {
+	verifier
+	prefix  string
+	purpose string
+
+	mu      sync.Mutex
+	current *Secret
+	// secrets caches the secrets found by ID, which never change
+	secrets map[string]*Secret
+}
+
+func (k *secretKeychain) SigningSecret() (*Secret, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.current != nil && !k.options.expired(k.current.RotatedAt, k.options.Clock.Now()) {
+		return k.current, nil
+	}
+	if err := k.rotate(context.Background(), false); err != nil {
+		return nil, &RotationError{Cause: err}
+	}
+	return k.current, nil
+}
+
+func (k *secretKeychain) Rotate() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.rotate(context.Background(), true)
+}
+
+// rotate makes a new secret current. Unless forced, a current secret created
+// by another instance is adopted instead. k.mu must be held.
+func (k *secretKeychain) rotate(ctx context.Context, force bool) error {
+	if !force {
+		secret, err := k.findCurrent(ctx)
+		if err != nil || secret != nil {
+			k.current = secret
+			return err
+		}
+	}
+	if err := k.store.Lock(ctx); err != nil {
+		return err
+	}
+	// The lock is released even if ctx is done
+	defer k.store.Unlock(context.Background())
+	if !force {
+		// Another instance may have rotated before the lock was acquired
+		secret, err := k.findCurrent(ctx)
+		if err != nil || secret != nil {
+			k.current = secret
+			return err
+		}
+	}
+
+	secret, err := k.addSecret(ctx)
+	if err != nil {
+		return err
+	}
+	k.current = secret
+	k.options.Logger.Info("rotated "+k.purpose+" key", "key_id", secret.ID, "rotated_at", secret.RotatedAt)
+	return nil
+}
+
+// findCurrent returns the stored secret rotated last, if it has not been
+// rotated yet
+func (k *secretKeychain) findCurrent(ctx context.Context) (*Secret, error) {
+	keys, err := k.getNonExpiredKeys(ctx, store.KeyFilter{IsPrivate: &private, IDPrefix: k.prefix}, func(key store.Key) bool {
+		return key.IsPrivate && strings.HasPrefix(key.ID, k.prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var current *Secret
+	for _, key := range keys {
+		secret, err := k.parseSecret(key)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil || secret.RotatedAt.After(current.RotatedAt) {
+			current = secret
+		}
+	}
+	if current == nil || k.options.expired(current.RotatedAt, k.options.Clock.Now()) {
+		return nil, nil
+	}
+	return current, nil
+}
+
+// addSecret creates and stores a new secret, choosing a new ID on conflicts
+func (k *secretKeychain) addSecret(ctx context.Context) (*Secret, error) {
+	now := k.options.Clock.Now()
+	secret := &Secret{
+		Key:       make([]byte, secretSize),
+		CreatedAt: now,
+		RotatedAt: now.Add(k.options.RotationFrequency),
+		ExpiresAt: now.Add(k.options.VerificationPeriod),
+	}
+	random := k.options.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+	if _, err := io.ReadFull(random, secret.Key); err != nil {
+		return nil, &causeError{kind: ErrKeyGeneration, cause: err}
+	}
+	data, err := k.encodeKeyData(encodingSecret, "", secret.Key)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{
+		MetadataPurpose:   k.purpose,
+		MetadataCreatedAt: secret.CreatedAt.UTC().Format(time.RFC3339Nano),
+		MetadataRotatedAt: secret.RotatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if k.options.KeyDataEncoding != "" {
+		metadata[MetadataDataEncoding] = string(k.options.KeyDataEncoding)
+	}
+	for attempt := 0; ; attempt++ {
+		if secret.ID, err = randomID(k.options); err != nil {
+			return nil, err
+		}
+		err = k.store.Add(ctx, store.Key{
+			ID:        k.prefix + secret.ID,
+			IsPrivate: true,
+			ExpiresAt: secret.ExpiresAt,
+			Data:      data,
+			Metadata:  metadata,
+		})
+		if !errors.Is(err, store.ErrKeyIDConflict) {
+			return secret, err
+		}
+		if attempt >= k.options.IDConflictRetries {
+			return nil, &IDConflictError{Attempts: attempt + 1}
+		}
+	}
+}
+
+// isSecretID reports if id is the store ID of the secret of a SecretKeychain
+// or EncryptionKeychain
+func isSecretID(id string) bool {
+	return strings.HasPrefix(id, secretIDPrefix) || strings.HasPrefix(id, encryptionIDPrefix)
+}
+
+// parseSecret decrypts a stored secret
+func (k *secretKeychain) parseSecret(key store.Key) (*Secret, error) {
+	data, err := k.decodeKeyData(key, encodingSecret)
+	if err != nil {
+		return nil, err
+	}
+	secret := &Secret{
+		ID:        strings.TrimPrefix(key.ID, k.prefix),
+		Key:       data,
+		ExpiresAt: key.ExpiresAt,
+		RotatedAt: key.ExpiresAt,
+	}
+	if createdAt, err := time.Parse(time.RFC3339Nano, key.Metadata[MetadataCreatedAt]); err == nil {
+		secret.CreatedAt = createdAt
+	}
+	if rotatedAt, err := time.Parse(time.RFC3339Nano, key.Metadata[MetadataRotatedAt]); err == nil {
+		secret.RotatedAt = rotatedAt
+	}
+	return secret, nil
+}
+
+func (k *secretKeychain) GetSecret(id string) (*Secret, error) {
+	k.mu.Lock()
+	secret, ok := k.secrets[id]
+	k.mu.Unlock()
+	if !ok {
+		key, err := k.store.Find(context.Background(), k.prefix+id)
+		if err != nil {
+			return nil, err
+		}
+		if !key.IsPrivate {
+			return nil, ErrKeyNotFound
+		}
+		if secret, err = k.parseSecret(key); err != nil {
+			return nil, err
+		}
+		k.mu.Lock()
+		k.secrets[id] = secret
+		k.mu.Unlock()
+	}
+	now := k.options.Clock.Now()
+	if k.options.expired(secret.ExpiresAt, now) {
+		k.mu.Lock()
+		delete(k.secrets, id)
+		k.mu.Unlock()
+		return nil, ErrKeyNotFound
+	}
+	return secret, nil
+}
+
+func (k *secretKeychain) Sign(data []byte) ([]byte, string, error) {
+	secret, err := k.SigningSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	return secretMAC(secret.Key, data), secret.ID, nil
+}
+
+func (k *secretKeychain) Verify(keyID string, data, signature []byte) error {
+	secret, err := k.GetSecret(keyID)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(secretMAC(secret.Key, data), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func secretMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
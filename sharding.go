@@ -0,0 +1,212 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/hsson/ring/store"
+)
+
+// ShardSeparator separates the shard from the key ID in the key IDs of a
+// ShardedKeychain
+const ShardSeparator = "."
+
+// ShardedKeychain signs with several concurrently active signing keys, one
+// per shard, so signing throughput scales with the number of keys and the
+// compromise of one key only affects the data signed by its shard. Each
+// shard is a keychain of its own, namespaced within the store, and all
+// their verifier keys are published together. Key IDs are prefixed by the
+// shard and ShardSeparator.
+type ShardedKeychain struct {
+	shards   []Keychain
+	verifier *CompositeVerifier
+	next     uint32
+}
+
+// shardNamespaces returns the namespaces of the shards of a keychain in
+// namespace
+func shardNamespaces(options Options, shards int) []string {
+	namespaces := make([]string, shards)
+	for i := range namespaces {
+		namespaces[i] = namespacePrefix(options) + "shard-" + strconv.Itoa(i)
+	}
+	return namespaces
+}
+
+func shardPrefix(shard int) string {
+	return strconv.Itoa(shard) + ShardSeparator
+}
+
+// NewShardedKeychain creates a keychain of shards signing keys stored in s.
+// The shards share the options, and are namespaced within
+// Options.Namespace. Changing the number of shards later leaves the keys
+// of removed shards unverifiable.
+func NewShardedKeychain(s store.Store, options Options, shards int) (*ShardedKeychain, error) {
+	if shards <= 0 {
+		return nil, errors.New("hsson/ring: number of shards must be > 0")
+	}
+	k := &ShardedKeychain{shards: make([]Keychain, shards)}
+	sources := make([]VerifierSource, shards)
+	for i, namespace := range shardNamespaces(options, shards) {
+		shardOptions := options
+		shardOptions.Namespace = namespace
+		keychain, err := NewKeychain(s, shardOptions)
+		if err != nil {
+			_ = k.Close()
+			return nil, err
+		}
+		k.shards[i] = keychain
+		sources[i] = VerifierSource{Prefix: shardPrefix(i), Verifier: keychain}
+	}
+	k.verifier = NewCompositeVerifier(sources...)
+	return k, nil
+}
+
+// NewShardedVerifier creates a Verifier of the keys of a ShardedKeychain
+// with the same options and number of shards, e.g. for services which only
+// verify.
+func NewShardedVerifier(s store.Store, options Options, shards int) Verifier {
+	sources := make([]VerifierSource, shards)
+	for i, namespace := range shardNamespaces(options, shards) {
+		shardOptions := options
+		shardOptions.Namespace = namespace
+		sources[i] = VerifierSource{Prefix: shardPrefix(i), Verifier: NewVerifierOnlyWithOptions(s, shardOptions)}
+	}
+	return NewCompositeVerifier(sources...)
+}
+
+// Shards returns the number of shards
+func (k *ShardedKeychain) Shards() int {
+	return len(k.shards)
+}
+
+// roundRobin returns the next shard to sign with
+func (k *ShardedKeychain) roundRobin() int {
+	return int((atomic.AddUint32(&k.next, 1) - 1) % uint32(len(k.shards)))
+}
+
+// affinity returns the shard of key
+func (k *ShardedKeychain) affinity(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(k.shards)))
+}
+
+// shardSigningKey returns the signing key of shard, identified by its ID
+// within the sharded keychain
+func (k *ShardedKeychain) shardSigningKey(ctx context.Context, shard int) (*SigningKey, error) {
+	key, err := k.shards[shard].SigningKeyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return shardKey(shard, key), nil
+}
+
+// shardKey returns a copy of key, the signing key of shard, with its ID
+// prefixed by the shard
+func shardKey(shard int, key *SigningKey) *SigningKey {
+	prefixed := *key
+	prefixed.ID = shardPrefix(shard) + key.ID
+	return &prefixed
+}
+
+// signingKeyToSign implements countingSigner, counting the signature
+// towards the key of the next shard, in turn
+func (k *ShardedKeychain) signingKeyToSign(ctx context.Context) (*SigningKey, error) {
+	shard := k.roundRobin()
+	key, err := signingKeyToSignContext(ctx, k.shards[shard])
+	if err != nil {
+		return nil, err
+	}
+	return shardKey(shard, key), nil
+}
+
+// SigningKey returns the signing key of the next shard, in turn
+func (k *ShardedKeychain) SigningKey() (*SigningKey, error) {
+	return k.shardSigningKey(context.Background(), k.roundRobin())
+}
+
+// SigningKeyFor returns the signing key of the shard of key, e.g. a tenant
+// or a worker, so that the same key always signs with the same shard
+func (k *ShardedKeychain) SigningKeyFor(key string) (*SigningKey, error) {
+	return k.shardSigningKey(context.Background(), k.affinity(key))
+}
+
+// Sign signs data like Keychain.Sign, with the signing key of the next
+// shard, in turn
+func (k *ShardedKeychain) Sign(data []byte) ([]byte, string, error) {
+	shard := k.roundRobin()
+	signature, keyID, err := k.shards[shard].Sign(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return signature, shardPrefix(shard) + keyID, nil
+}
+
+// Verify checks a signature created by Sign
+func (k *ShardedKeychain) Verify(keyID string, data, signature []byte) error {
+	verifier, err := k.GetVerifier(keyID)
+	if err != nil {
+		return err
+	}
+	return verifyMessage(verifier, data, signature)
+}
+
+func (k *ShardedKeychain) GetVerifier(id string) (*VerifierKey, error) {
+	return k.verifier.GetVerifier(id)
+}
+
+func (k *ShardedKeychain) GetVerifierContext(ctx context.Context, id string) (*VerifierKey, error) {
+	return k.verifier.GetVerifierContext(ctx, id)
+}
+
+// ListVerifiers lists the active public keys of all shards
+func (k *ShardedKeychain) ListVerifiers() ([]*VerifierKey, error) {
+	return k.verifier.ListVerifiers()
+}
+
+func (k *ShardedKeychain) ListVerifiersContext(ctx context.Context) ([]*VerifierKey, error) {
+	return k.verifier.ListVerifiersContext(ctx)
+}
+
+// JWKS renders the active public keys of all shards as a JSON Web Key Set,
+// followed by their revoked keys
+func (k *ShardedKeychain) JWKS() ([]byte, error) {
+	verifiers, err := k.ListVerifiers()
+	if err != nil {
+		return nil, err
+	}
+	var revoked []*VerifierKey
+	for i, shard := range k.shards {
+		r, ok := shard.(*ring)
+		if !ok {
+			continue
+		}
+		keys, err := r.revokedVerifiers(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			key.ID = shardPrefix(i) + key.ID
+		}
+		revoked = append(revoked, keys...)
+	}
+	return marshalJWKS(verifiers, revoked)
+}
+
+// Close stops the background workers of all shards
+func (k *ShardedKeychain) Close() error {
+	var firstErr error
+	for _, keychain := range k.shards {
+		if keychain == nil {
+			continue
+		}
+		if err := keychain.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
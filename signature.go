@@ -0,0 +1,126 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	// Register the hash functions used for signing
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// ErrInvalidSignature is returned when a signature does not match the
+// signed data.
+var ErrInvalidSignature = errors.New("hsson/ring: invalid signature")
+
+// keySignatureAlgorithm returns alg, the signature algorithm of a key, or
+// the default algorithm of publicKey for keys without one
+func keySignatureAlgorithm(publicKey crypto.PublicKey, alg SignatureAlgorithm) SignatureAlgorithm {
+	if alg == "" {
+		return DefaultSignatureAlgorithm(publicKey)
+	}
+	return alg
+}
+
+// messageHash returns the hash used when signing with a key, that of its
+// signature algorithm. Ed25519 does not use a separate hash function.
+func messageHash(publicKey crypto.PublicKey, alg SignatureAlgorithm) crypto.Hash {
+	return keySignatureAlgorithm(publicKey, alg).Hash()
+}
+
+func digest(hash crypto.Hash, message []byte) []byte {
+	if hash == crypto.Hash(0) {
+		return message
+	}
+	h := hash.New()
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// signMessage signs message using the signature algorithm of key: RSA with
+// PSS or PKCS #1 v1.5 padding, ECDSA or Ed25519.
+func signMessage(key *SigningKey, message []byte) ([]byte, error) {
+	return signDigest(key, digest(messageHash(key.Key.Public(), key.SignatureAlgorithm), message))
+}
+
+// signDigest signs a digest created using the messageHash of the key, or
+// the message itself for Ed25519 keys
+func signDigest(key *SigningKey, digest []byte) ([]byte, error) {
+	alg := keySignatureAlgorithm(key.Key.Public(), key.SignatureAlgorithm)
+	var opts crypto.SignerOpts = alg.Hash()
+	if _, ok := key.Key.Public().(*rsa.PublicKey); ok && alg.PSS() {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.Hash()}
+	}
+	return key.Key.Sign(rand.Reader, digest, opts)
+}
+
+// verifyMessage verifies a signature created by signMessage
+func verifyMessage(key *VerifierKey, message, signature []byte) error {
+	return verifyDigest(key, digest(messageHash(key.Key, key.SignatureAlgorithm), message), signature)
+}
+
+// verifyDigest verifies a signature created by signDigest
+func verifyDigest(key *VerifierKey, digest, signature []byte) error {
+	alg := keySignatureAlgorithm(key.Key, key.SignatureAlgorithm)
+	hash := alg.Hash()
+	switch pub := key.Key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		if alg.PSS() {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		}
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+		// Trailing bytes are rejected, so signatures can't be altered
+		// without invalidating them
+		if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) != 0 {
+			return ErrInvalidSignature
+		}
+		if !ecdsa.Verify(pub, digest, sig.R, sig.S) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return errors.New("hsson/ring: unsupported key type")
+	}
+}
+
+func (r *ring) Sign(data []byte) ([]byte, string, error) {
+	signingKey, err := r.signingKeyToSign(context.Background())
+	if err != nil {
+		return nil, "", err
+	}
+	signature, err := signMessage(signingKey, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return signature, signingKey.ID, nil
+}
+
+func (r *ring) Verify(keyID string, data, signature []byte) error {
+	verifier, err := r.GetVerifier(keyID)
+	if err != nil {
+		return err
+	}
+	return verifyMessage(verifier, data, signature)
+}
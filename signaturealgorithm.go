@@ -0,0 +1,147 @@
+package ring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+)
+
+// SignatureAlgorithm is the JWS algorithm, as defined by RFC 7518 and RFC
+// 8037, which data is meant to be signed with using a key. It tells JWT and
+// JWS implementations which padding and hash to use, and is included as alg
+// in JWKs.
+type SignatureAlgorithm string
+
+const (
+	// RS256 is RSASSA-PKCS1-v1_5 using SHA-256
+	RS256 SignatureAlgorithm = "RS256"
+	// RS384 is RSASSA-PKCS1-v1_5 using SHA-384
+	RS384 SignatureAlgorithm = "RS384"
+	// RS512 is RSASSA-PKCS1-v1_5 using SHA-512
+	RS512 SignatureAlgorithm = "RS512"
+	// PS256 is RSASSA-PSS using SHA-256
+	PS256 SignatureAlgorithm = "PS256"
+	// PS384 is RSASSA-PSS using SHA-384
+	PS384 SignatureAlgorithm = "PS384"
+	// PS512 is RSASSA-PSS using SHA-512
+	PS512 SignatureAlgorithm = "PS512"
+	// ES256 is ECDSA using P-256 and SHA-256
+	ES256 SignatureAlgorithm = "ES256"
+	// ES384 is ECDSA using P-384 and SHA-384
+	ES384 SignatureAlgorithm = "ES384"
+	// ES512 is ECDSA using P-521 and SHA-512
+	ES512 SignatureAlgorithm = "ES512"
+	// EdDSA is Ed25519
+	EdDSA SignatureAlgorithm = "EdDSA"
+)
+
+// Hash returns the hash function of the algorithm, or zero for EdDSA which
+// signs messages directly.
+func (a SignatureAlgorithm) Hash() crypto.Hash {
+	switch a {
+	case RS384, PS384, ES384:
+		return crypto.SHA384
+	case RS512, PS512, ES512:
+		return crypto.SHA512
+	case EdDSA:
+		return crypto.Hash(0)
+	default:
+		return crypto.SHA256
+	}
+}
+
+// PSS reports whether the algorithm uses RSASSA-PSS rather than
+// RSASSA-PKCS1-v1_5 padding.
+func (a SignatureAlgorithm) PSS() bool {
+	return a == PS256 || a == PS384 || a == PS512
+}
+
+// isRSA reports whether a is one of the algorithms for RSA keys
+func (a SignatureAlgorithm) isRSA() bool {
+	switch a {
+	case RS256, RS384, RS512, PS256, PS384, PS512:
+		return true
+	}
+	return false
+}
+
+// DefaultSignatureAlgorithm returns the algorithm used for keys without a
+// configured one: PS256 for RSA keys, ES256, ES384 or ES512 for ECDSA keys
+// depending on the curve, and EdDSA for Ed25519 keys. It returns "" for
+// other keys.
+func DefaultSignatureAlgorithm(pub crypto.PublicKey) SignatureAlgorithm {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return PS256
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return ES256
+		case 384:
+			return ES384
+		case 521:
+			return ES512
+		}
+	case ed25519.PublicKey:
+		return EdDSA
+	}
+	return ""
+}
+
+// algorithmDefault returns the signature algorithm of keys of algorithm, for
+// keys without a configured one
+func algorithmDefault(algorithm Algorithm) SignatureAlgorithm {
+	switch algorithm {
+	case RSA:
+		return PS256
+	case ECDSAP256:
+		return ES256
+	case ECDSAP384:
+		return ES384
+	case ECDSAP521:
+		return ES512
+	case Ed25519:
+		return EdDSA
+	}
+	return ""
+}
+
+// SignatureAlgorithms returns the algorithms of keys used with the options,
+// e.g. to advertise in an OpenID Connect discovery document: the algorithm
+// of new signing keys first, followed by the default algorithms of the
+// other AllowedAlgorithms.
+func (o Options) SignatureAlgorithms() []SignatureAlgorithm {
+	o = o.withDefaults()
+	first := algorithmDefault(o.Algorithm)
+	if o.Algorithm == RSA && o.SignatureAlgorithm != "" {
+		first = o.SignatureAlgorithm
+	}
+	res := []SignatureAlgorithm{first}
+	for _, algorithm := range o.AllowedAlgorithms {
+		alg := algorithmDefault(algorithm)
+		if alg == "" || algorithm == o.Algorithm {
+			continue
+		}
+		res = append(res, alg)
+	}
+	return res
+}
+
+// signatureAlgorithm returns the algorithm new keys of the keychain are
+// signed with, which can only be chosen for RSA keys
+func (r *ring) signatureAlgorithm(pub crypto.PublicKey) SignatureAlgorithm {
+	if _, ok := pub.(*rsa.PublicKey); ok && r.options.SignatureAlgorithm != "" {
+		return r.options.SignatureAlgorithm
+	}
+	return DefaultSignatureAlgorithm(pub)
+}
+
+// parseSignatureAlgorithm returns the signature algorithm of a stored key,
+// defaulting to the algorithm for pub for keys without metadata.
+func parseSignatureAlgorithm(metadata map[string]string, pub crypto.PublicKey) SignatureAlgorithm {
+	if alg := SignatureAlgorithm(metadata[MetadataSignatureAlgorithm]); alg != "" {
+		return alg
+	}
+	return DefaultSignatureAlgorithm(pub)
+}
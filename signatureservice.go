@@ -0,0 +1,179 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"sync"
+)
+
+// ErrRateLimited is returned by a SignatureService when a caller exceeds
+// SignatureServiceOptions.Limit
+var ErrRateLimited = errors.New("hsson/ring: signature rate limit exceeded")
+
+// ErrDigestMismatch is returned by SignatureService.SignDigest if the hash
+// or the length of the digest does not match the signature algorithm of
+// the signing key
+var ErrDigestMismatch = errors.New("hsson/ring: digest does not match the signature algorithm of the key")
+
+// SignatureService signs data on behalf of callers, without ever handing
+// out the private keys of the keychain, so signing can be rate limited and
+// audited centrally. It is served remotely by package grpc.
+type SignatureService interface {
+	Verifier
+	// Sign signs data with the current signing key, like Keychain.Sign
+	Sign(ctx context.Context, data []byte) (signature []byte, keyID string, err error)
+	// SignDigest signs a digest created using hash with the current
+	// signing key. RSA keys sign using their SignatureAlgorithm and ECDSA
+	// keys return an ASN.1 encoded signature, while Ed25519 keys expect the
+	// full message as digest and a zero hash. ErrDigestMismatch is
+	// returned if hash is not the hash of the SignatureAlgorithm of the
+	// key, or the digest is not of its size.
+	SignDigest(ctx context.Context, hash crypto.Hash, digest []byte) (signature []byte, keyID string, err error)
+	// Verify checks a signature created by Sign, like Keychain.Verify
+	Verify(keyID string, data, signature []byte) error
+}
+
+// SignatureServiceOptions customize the behavior of a SignatureService
+type SignatureServiceOptions struct {
+	// Limit is how many signatures per second each caller may request, see
+	// WithCaller. Default: 0, no limit
+	Limit float64
+	// Burst is how many signatures a caller may request at once, in
+	// addition to Limit. Default: 1
+	Burst int
+	// AuditSink, if set, receives an AuditKeySigned record for every
+	// signature
+	AuditSink AuditSink
+	// Clock is used for rate limiting and audit records. Default: the
+	// system time
+	Clock Clock
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context identifying the caller a SignatureService
+// signs for, which is rate limited separately and recorded in audit
+// records
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller set by WithCaller
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// NewSignatureService creates a SignatureService signing with the keys of
+// keychain
+func NewSignatureService(keychain Keychain, options SignatureServiceOptions) SignatureService {
+	if options.Burst <= 0 {
+		options.Burst = 1
+	}
+	if options.Clock == nil {
+		options.Clock = systemClock{}
+	}
+	return &signatureService{
+		Verifier: keychain,
+		keychain: keychain,
+		options:  options,
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+type signatureService struct {
+	Verifier
+	keychain Keychain
+	options  SignatureServiceOptions
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket holds the signatures a caller may still request
+type tokenBucket struct {
+	tokens float64
+	last   int64
+}
+
+// allow takes a token from the bucket of caller, if available
+func (s *signatureService) allow(caller string) bool {
+	if s.options.Limit <= 0 {
+		return true
+	}
+	now := s.options.Clock.Now().UnixNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[caller]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(s.options.Burst), last: now}
+		s.buckets[caller] = bucket
+	}
+	bucket.tokens += float64(now-bucket.last) / 1e9 * s.options.Limit
+	if burst := float64(s.options.Burst); bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// signingKey returns the current signing key, if the caller of ctx is
+// within its limit
+func (s *signatureService) signingKey(ctx context.Context) (*SigningKey, error) {
+	if !s.allow(CallerFromContext(ctx)) {
+		return nil, ErrRateLimited
+	}
+	return signingKeyToSignContext(ctx, s.keychain)
+}
+
+func (s *signatureService) audit(ctx context.Context, keyID string) {
+	if s.options.AuditSink == nil {
+		return
+	}
+	s.options.AuditSink.Record(AuditRecord{
+		Event:  AuditKeySigned,
+		KeyID:  keyID,
+		Time:   s.options.Clock.Now(),
+		Caller: CallerFromContext(ctx),
+	})
+}
+
+func (s *signatureService) Sign(ctx context.Context, data []byte) ([]byte, string, error) {
+	key, err := s.signingKey(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	signature, err := signMessage(key, data)
+	if err != nil {
+		return nil, "", err
+	}
+	s.audit(ctx, key.ID)
+	return signature, key.ID, nil
+}
+
+func (s *signatureService) SignDigest(ctx context.Context, hash crypto.Hash, digest []byte) ([]byte, string, error) {
+	key, err := s.signingKey(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	// The hash is never taken from the caller, which could otherwise e.g.
+	// have raw data signed with PKCS #1 v1.5 padding
+	if keyHash := messageHash(key.Key.Public(), key.SignatureAlgorithm); hash != keyHash || (hash != crypto.Hash(0) && len(digest) != hash.Size()) {
+		return nil, "", ErrDigestMismatch
+	}
+	signature, err := signDigest(key, digest)
+	if err != nil {
+		return nil, "", err
+	}
+	s.audit(ctx, key.ID)
+	return signature, key.ID, nil
+}
+
+func (s *signatureService) Verify(keyID string, data, signature []byte) error {
+	return s.keychain.Verify(keyID, data, signature)
+}
@@ -0,0 +1,273 @@
+// Package sim provides a deterministic harness for simulating several
+// keychain instances sharing a single store. Time is controlled by a fake
+// clock and the shared store can be taken down to simulate outages, so
+// coordination issues can be reproduced without relying on time.Sleep.
+package sim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
+)
+
+// ErrStoreDown is returned by all store operations during a simulated
+// outage.
+var ErrStoreDown = errors.New("hsson/ring/sim: store down")
+
+// Clock is a fake clock which only moves when told to. Timers created by it
+// fire when the clock is advanced past their deadline.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+}
+
+// NewClock creates a new fake clock starting at the given time.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current fake time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d, firing all timers which expire
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// NewTimer creates a timer firing once the clock has advanced by d
+func (c *Clock) NewTimer(d time.Duration) ring.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &timer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	return t
+}
+
+// PendingTimers returns the number of timers which have not yet fired or
+// been stopped. It can be used to wait for background goroutines to start
+// waiting before advancing the clock.
+func (c *Clock) PendingTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+type timer struct {
+	clock    *Clock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Store wraps an in-memory store and can simulate outages. It implements
+// the store.Locker, store.LockRenewer and store.Watcher interfaces of the
+// in-memory store, as well as io.Closer.
+type Store struct {
+	store.Store
+
+	mu   sync.RWMutex
+	down bool
+}
+
+// NewStore creates a new store which can be taken down on demand. Its lock
+// expires on the system clock, see NewStoreWithOptions.
+func NewStore() *Store {
+	return &Store{Store: inmem.NewInMemoryStore()}
+}
+
+// NewStoreWithOptions is like NewStore, but creates the in-memory store
+// with options, e.g. to expire the lock after options.LockTimeout on a
+// fake Clock.
+func NewStoreWithOptions(options inmem.Options) *Store {
+	return &Store{Store: inmem.NewInMemoryStoreWithOptions(options)}
+}
+
+// SetDown starts or ends a simulated outage
+func (s *Store) SetDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *Store) available() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.down {
+		return ErrStoreDown
+	}
+	return nil
+}
+
+// Add implements store.Store
+func (s *Store) Add(key store.Key) error {
+	if err := s.available(); err != nil {
+		return err
+	}
+	return s.Store.Add(key)
+}
+
+// Find implements store.Store
+func (s *Store) Find(id string) (store.Key, error) {
+	if err := s.available(); err != nil {
+		return store.Key{}, err
+	}
+	return s.Store.Find(id)
+}
+
+// Delete implements store.Store
+func (s *Store) Delete(id string) error {
+	if err := s.available(); err != nil {
+		return err
+	}
+	return s.Store.Delete(id)
+}
+
+// List implements store.Store
+func (s *Store) List() (store.KeyList, error) {
+	if err := s.available(); err != nil {
+		return nil, err
+	}
+	return s.Store.List()
+}
+
+// Lock implements store.Locker
+func (s *Store) Lock() error {
+	if err := s.available(); err != nil {
+		return err
+	}
+	return store.AsLocker(s.Store).Lock()
+}
+
+// Unlock implements store.Locker
+func (s *Store) Unlock() error {
+	if err := s.available(); err != nil {
+		return err
+	}
+	return store.AsLocker(s.Store).Unlock()
+}
+
+// LockTTL implements store.LockRenewer, returning the LockTimeout of the
+// in-memory store
+func (s *Store) LockTTL() time.Duration {
+	if renewer, ok := s.Store.(store.LockRenewer); ok {
+		return renewer.LockTTL()
+	}
+	return 0
+}
+
+// RenewLock implements store.LockRenewer
+func (s *Store) RenewLock() error {
+	if err := s.available(); err != nil {
+		return err
+	}
+	if renewer, ok := s.Store.(store.LockRenewer); ok {
+		return renewer.RenewLock()
+	}
+	return nil
+}
+
+// Watch implements store.Watcher. Watches started before an outage keep
+// receiving events.
+func (s *Store) Watch(ctx context.Context) (<-chan store.Event, error) {
+	if err := s.available(); err != nil {
+		return nil, err
+	}
+	if watcher, ok := s.Store.(store.Watcher); ok {
+		return watcher.Watch(ctx)
+	}
+	return nil, errors.New("hsson/ring/sim: store can not be watched")
+}
+
+// Close implements io.Closer, ending all watches of the store
+func (s *Store) Close() error {
+	if closer, ok := s.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Simulation is a set of keychain instances sharing a store and a clock.
+type Simulation struct {
+	Clock     *Clock
+	Store     *Store
+	Instances []ring.Keychain
+}
+
+// New creates a simulation of n keychain instances, all created with the
+// given options. The Clock of the options is replaced by the simulation's
+// fake clock, starting at start, which also expires the lock of the store.
+func New(n int, start time.Time, options ring.Options) *Simulation {
+	clock := NewClock(start)
+	sim := &Simulation{
+		Clock: clock,
+		Store: NewStoreWithOptions(inmem.Options{Clock: clock}),
+	}
+	options.Clock = sim.Clock
+	for i := 0; i < n; i++ {
+		sim.Instances = append(sim.Instances, ring.NewWithOptions(sim.Store, options))
+	}
+	return sim
+}
+
+// Each calls f for every instance, one at a time in instance order. This
+// allows interleavings of operations to be replayed deterministically.
+func (s *Simulation) Each(f func(i int, keychain ring.Keychain)) {
+	for i, keychain := range s.Instances {
+		f(i, keychain)
+	}
+}
+
+// Concurrently calls f for every instance at the same time, and waits for
+// all calls to return.
+func (s *Simulation) Concurrently(f func(i int, keychain ring.Keychain)) {
+	var wg sync.WaitGroup
+	for i, keychain := range s.Instances {
+		wg.Add(1)
+		go func(i int, keychain ring.Keychain) {
+			defer wg.Done()
+			f(i, keychain)
+		}(i, keychain)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,193 @@
+package sim_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/sim"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestInstancesShareKey(t *testing.T) {
+	s := sim.New(3, time.Now(), ring.Options{RotationFrequency: time.Hour})
+
+	ids := make([]string, len(s.Instances))
+	s.Each(func(i int, keychain ring.Keychain) {
+		key, err := keychain.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = key.ID
+	})
+
+	for i := range ids {
+		if ids[i] != ids[0] {
+			t.Errorf("instance %d got key %v want %v", i, ids[i], ids[0])
+		}
+	}
+}
+
+func TestRotationAfterClockAdvance(t *testing.T) {
+	s := sim.New(2, time.Now(), ring.Options{RotationFrequency: time.Hour})
+
+	before, err := s.Instances[0].SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Clock.Advance(61 * time.Minute)
+
+	after, err := s.Instances[0].SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.ID == after.ID {
+		t.Errorf("expected key to be rotated after clock advance")
+	}
+
+	if _, err := s.Instances[1].GetVerifier(before.ID); err != nil {
+		t.Errorf("expected previous verifier to still be available: %v", err)
+	}
+}
+
+func TestStoreOutage(t *testing.T) {
+	s := sim.New(1, time.Now(), ring.Options{RotationFrequency: time.Hour})
+
+	key, err := s.Instances[0].SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Store.SetDown(true)
+	if _, err := s.Instances[0].GetVerifier(key.ID); !errors.Is(err, sim.ErrStoreDown) {
+		t.Errorf("expected ErrStoreDown, got %v", err)
+	}
+
+	s.Clock.Advance(2 * time.Hour)
+	if _, err := s.Instances[0].SigningKey(); !errors.Is(err, ring.ErrKeyRotation) {
+		t.Errorf("expected ErrKeyRotation, got %v", err)
+	}
+
+	s.Store.SetDown(false)
+	if _, err := s.Instances[0].SigningKey(); err != nil {
+		t.Errorf("expected rotation to succeed after outage: %v", err)
+	}
+}
+
+func TestStoreLockExpiresOnFakeClock(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := sim.NewStoreWithOptions(inmem.Options{Clock: clock, LockTimeout: time.Minute})
+	if err := s.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	clock.Advance(time.Minute)
+	if err := s.Lock(); err != nil {
+		t.Errorf("expected the lock to expire with the fake clock, got %v", err)
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	s := sim.New(2, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+	})
+	before, err := s.Instances[0].SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process crashes while holding the lock when the key is due
+	// for rotation, which blocks rotations until the lock expires
+	s.Clock.Advance(time.Hour)
+	if err := s.Store.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Instances[1].Rotate(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied while the lock is held, got %v", err)
+	}
+	s.Clock.Advance(time.Minute)
+	if err := s.Instances[1].Rotate(); err != nil {
+		t.Fatalf("expected rotation to succeed once the lock expired, got %v", err)
+	}
+	after, err := s.Instances[0].SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.ID == before.ID {
+		t.Error("expected the key to be rotated")
+	}
+}
+
+func TestStoreOptionalInterfaces(t *testing.T) {
+	var s interface{} = sim.NewStore()
+	if _, ok := s.(store.LockRenewer); !ok {
+		t.Error("expected the store to implement store.LockRenewer")
+	}
+	if _, ok := s.(store.Watcher); !ok {
+		t.Error("expected the store to implement store.Watcher")
+	}
+	if _, ok := s.(io.Closer); !ok {
+		t.Error("expected the store to implement io.Closer")
+	}
+
+	simStore := sim.NewStore()
+	events, err := simStore.Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := simStore.Add(store.Key{ID: "key", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event.ID != "key" {
+		t.Errorf("expected an event for the added key, got %+v", event)
+	}
+	if err := simStore.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-events; ok {
+		t.Error("expected the watch to end when the store is closed")
+	}
+}
+
+func TestAutoRotateWithFakeClock(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	keychain, err := ring.NewKeychain(sim.NewStore(), ring.Options{
+		Algorithm:         ring.Ed25519,
+		RotationFrequency: time.Hour,
+		Clock:             clock,
+		AutoRotate:        true,
+		// Leaves the timer of the worker as the only one pending
+		CleanupInterval: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+
+	waitFor(t, func() bool { return clock.PendingTimers() == 1 })
+	clock.Advance(61 * time.Minute)
+	waitFor(t, func() bool {
+		verifiers, err := keychain.ListVerifiers()
+		return err == nil && len(verifiers) == 2
+	})
+}
+
+// waitFor waits for a background goroutine to make cond true
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
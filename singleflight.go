@@ -0,0 +1,64 @@
+package ring
+
+import (
+	"context"
+	"sync"
+)
+
+// lookupGroup coalesces concurrent lookups of the same verifier key, so a
+// burst of requests for a newly published key hits the store only once
+type lookupGroup struct {
+	mu    sync.Mutex
+	calls map[string]*lookupCall
+}
+
+type lookupCall struct {
+	done chan struct{}
+	key  *VerifierKey
+	err  error
+	// canceled is set if the context of the caller doing the lookup was
+	// done when it returned
+	canceled bool
+}
+
+// do calls lookup for id, unless a lookup of id is in flight already, in
+// which case it waits for its result instead. Waiting stops when ctx is
+// done, and a lookup failing because the context of its caller is done is
+// repeated for the callers waiting on it.
+func (g *lookupGroup) do(ctx context.Context, id string, lookup func() (*VerifierKey, error)) (*VerifierKey, error) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*lookupCall)
+		}
+		call, inFlight := g.calls[id]
+		if !inFlight {
+			call = &lookupCall{done: make(chan struct{})}
+			g.calls[id] = call
+			g.mu.Unlock()
+
+			call.key, call.err = lookup()
+			call.canceled = ctx.Err() != nil
+			g.mu.Lock()
+			delete(g.calls, id)
+			g.mu.Unlock()
+			close(call.done)
+			return call.key, call.err
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.canceled && ctx.Err() == nil {
+			continue
+		}
+		if call.key == nil {
+			return nil, call.err
+		}
+		copied := *call.key
+		return &copied, call.err
+	}
+}
@@ -0,0 +1,79 @@
+package ring
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// EncodeToSSHAuthorizedKey encodes the verifier public key as a line of an
+// OpenSSH authorized_keys file, with the key ID as comment
+func (vk *VerifierKey) EncodeToSSHAuthorizedKey() ([]byte, error) {
+	keyType, blob, err := sshPublicKey(vk.Key)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(keyType)
+	b.WriteByte(' ')
+	b.WriteString(base64.StdEncoding.EncodeToString(blob))
+	if vk.ID != "" {
+		b.WriteByte(' ')
+		b.WriteString(vk.ID)
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// sshPublicKey returns the key type and wire format of pub, as defined by
+// RFC 4253, RFC 5656 and RFC 8709
+func sshPublicKey(pub interface{}) (string, []byte, error) {
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		return "ssh-ed25519", appendSSHString(appendSSHString(nil, []byte("ssh-ed25519")), key), nil
+	case *rsa.PublicKey:
+		b := appendSSHString(nil, []byte("ssh-rsa"))
+		b = appendSSHMPInt(b, big.NewInt(int64(key.E)))
+		return "ssh-rsa", appendSSHMPInt(b, key.N), nil
+	case *ecdsa.PublicKey:
+		var curve string
+		switch key.Curve {
+		case elliptic.P256():
+			curve = "nistp256"
+		case elliptic.P384():
+			curve = "nistp384"
+		case elliptic.P521():
+			curve = "nistp521"
+		default:
+			return "", nil, fmt.Errorf("hsson/ring: unsupported curve %s", key.Curve.Params().Name)
+		}
+		keyType := "ecdsa-sha2-" + curve
+		b := appendSSHString(nil, []byte(keyType))
+		b = appendSSHString(b, []byte(curve))
+		return keyType, appendSSHString(b, elliptic.Marshal(key.Curve, key.X, key.Y)), nil
+	default:
+		return "", nil, fmt.Errorf("hsson/ring: unsupported key type %T", pub)
+	}
+}
+
+func appendSSHString(b, s []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(s)))
+	return append(append(b, length[:]...), s...)
+}
+
+// appendSSHMPInt appends the non-negative n, with a leading zero byte if its
+// high bit is set so it is not read as negative
+func appendSSHMPInt(b []byte, n *big.Int) []byte {
+	data := n.Bytes()
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		data = append([]byte{0}, data...)
+	}
+	return appendSSHString(b, data)
+}
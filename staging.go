@@ -0,0 +1,85 @@
+package ring
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoStagedKey is returned by Promote if Rotate has not staged a key
+var ErrNoStagedKey = errors.New("hsson/ring: no staged signing key")
+
+// stage stores the next signing key without switching to it, for
+// Options.StagedRotation. A key already published in advance, or staged by
+// another instance, is staged instead of creating a new one.
+func (r *ring) stage(ctx context.Context) error {
+	current, ok := r.currentSigningKey.Load().(*SigningKey)
+	if !ok {
+		return errors.New("hsson/ring: not initialized")
+	}
+	if err := r.store.Lock(ctx); err != nil {
+		return err
+	}
+	// The lock is released even if ctx is done
+	defer r.store.Unlock(context.Background())
+	stopRenewing := r.keepLock()
+	defer stopRenewing()
+
+	next, err := r.findNextPrivateKey(ctx, current)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		if next, err = r.createNewSigningKey(); err != nil {
+			return err
+		}
+		if err := r.storeSigningKey(ctx, next); err != nil {
+			return err
+		}
+	}
+
+	r.stagedMu.Lock()
+	r.staged = next
+	r.stagedMu.Unlock()
+	r.options.Logger.Info("staged signing key", "key_id", next.ID, "current_key_id", current.ID)
+	return nil
+}
+
+// stagedKey returns the key staged by Rotate, if any
+func (r *ring) stagedKey() *SigningKey {
+	r.stagedMu.Lock()
+	defer r.stagedMu.Unlock()
+	return r.staged
+}
+
+// promotionDue reports if the staged key should be promoted because of
+// Options.PromotionDelay
+func (r *ring) promotionDue() bool {
+	if r.options.PromotionDelay == 0 {
+		return false
+	}
+	staged := r.stagedKey()
+	return staged != nil && !r.options.Clock.Now().Before(staged.CreatedAt.Add(r.options.PromotionDelay))
+}
+
+// endSigningPeriod rotates the stored private key of current now, so other
+// instances, and this one once restarted, also stop signing with it. Stores
+// have no notion of updating a key, so the record is replaced.
+func (r *ring) endSigningPeriod(ctx context.Context, current *SigningKey) error {
+	key, err := r.store.Find(ctx, current.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Delete(ctx, current.ID); err != nil {
+		return err
+	}
+	key.ExpiresAt = r.options.Clock.Now().Add(r.privateKeyRetention())
+	return r.store.Add(ctx, key)
+}
+
+func (r *ring) Promote() error {
+	if r.stagedKey() == nil {
+		return ErrNoStagedKey
+	}
+	_, err := r.rotateSigningKey(context.Background())
+	return err
+}
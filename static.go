@@ -0,0 +1,69 @@
+package ring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// staticVerifier returns the key of Options.StaticVerifiers with the ID id,
+// unless it has expired
+func (v *verifier) staticVerifier(id string) (*VerifierKey, bool) {
+	now := v.options.Clock.Now()
+	for i := range v.options.StaticVerifiers {
+		if key := &v.options.StaticVerifiers[i]; key.ID == id && v.staticActive(key, now) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// staticActive reports if the static verifier key has not expired. Keys
+// without ExpiresAt never expire.
+func (v *verifier) staticActive(key *VerifierKey, now time.Time) bool {
+	return key.ExpiresAt.IsZero() || !v.options.expired(key.ExpiresAt, now)
+}
+
+// withStaticVerifiers adds the active static verifiers to keys, replacing
+// stored keys of the same ID
+func (v *verifier) withStaticVerifiers(keys []*VerifierKey) []*VerifierKey {
+	if len(v.options.StaticVerifiers) == 0 {
+		return keys
+	}
+	now := v.options.Clock.Now()
+	var res []*VerifierKey
+	pinned := make(map[string]bool)
+	for i := range v.options.StaticVerifiers {
+		if key := &v.options.StaticVerifiers[i]; v.staticActive(key, now) {
+			res = append(res, key)
+			pinned[key.ID] = true
+		}
+	}
+	for _, key := range keys {
+		if !pinned[key.ID] {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+// validateStaticVerifiers checks that all static verifiers can be used
+func (o Options) validateStaticVerifiers() error {
+	for _, key := range o.StaticVerifiers {
+		if key.ID == "" || key.Key == nil {
+			return errors.New("hsson/ring: StaticVerifiers must have an ID and a Key")
+		}
+		switch key.Key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return fmt.Errorf("hsson/ring: unsupported key type %T in StaticVerifiers", key.Key)
+		}
+		if err := o.checkKeyPolicy(key.Key); err != nil {
+			return fmt.Errorf("hsson/ring: StaticVerifiers must be allowed by the key policy: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package store
+
+import "context"
+
+// BatchFinder is implemented by stores which can find several keys in a
+// single roundtrip.
+type BatchFinder interface {
+	// FindMany returns the keys with the provided ids, in any order. Keys
+	// which are not found are left out, without an error.
+	FindMany(ids []string) (KeyList, error)
+}
+
+// ContextBatchFinder is the BatchFinder of a ContextStore
+type ContextBatchFinder interface {
+	FindMany(ctx context.Context, ids []string) (KeyList, error)
+}
+
+// AsBatchFinder returns s as a ContextBatchFinder, if it, or the Store
+// adapted by WithContext, supports finding several keys at once.
+func AsBatchFinder(s ContextStore) (ContextBatchFinder, bool) {
+	if b, ok := s.(ContextBatchFinder); ok {
+		return b, true
+	}
+	if w, ok := s.(withContext); ok {
+		if b, ok := w.store.(BatchFinder); ok {
+			return batchFinder{b}, true
+		}
+	}
+	return nil, false
+}
+
+type batchFinder struct {
+	BatchFinder
+}
+
+func (b batchFinder) FindMany(ctx context.Context, ids []string) (KeyList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.BatchFinder.FindMany(ids)
+}
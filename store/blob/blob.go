@@ -0,0 +1,267 @@
+// Package blob implements a store on top of object storage, such as Amazon
+// S3 or Google Cloud Storage, for deployments rotating too rarely to
+// warrant a database. Each key is kept as an object, created with a
+// conditional write so existing keys are never overwritten. The store lock
+// is an object holding the owner and expiry of a lease, taken over with a
+// conditional write once the lease has expired.
+//
+// Listing reads every object, so the store is meant for keychains holding
+// a handful of keys. Expired keys are deleted by the keychain; bucket
+// lifecycle rules can be used as well, but only act after whole days.
+package blob
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	defaultPrefix        = "hsson-ring/"
+	defaultLeaseDuration = 30 * time.Second
+	keysDir              = "keys/"
+	lockName             = "lock"
+)
+
+var (
+	// ErrNotFound is returned by a Bucket when an object does not exist
+	ErrNotFound = errors.New("hsson/ring/blob: object not found")
+	// ErrPreconditionFailed is returned by a Bucket when a conditional
+	// write or delete does not match the current object
+	ErrPreconditionFailed = errors.New("hsson/ring/blob: precondition failed")
+)
+
+var nameEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Bucket is an object storage bucket supporting conditional writes. The
+// version of an object identifies its content, such as an ETag or a
+// generation number.
+type Bucket interface {
+	// Get returns the content and version of an object, or ErrNotFound
+	Get(name string) (data []byte, version string, err error)
+	// Create writes an object, failing with ErrPreconditionFailed if it
+	// already exists
+	Create(name string, data []byte) error
+	// Replace overwrites an object, failing with ErrPreconditionFailed if
+	// its version no longer matches
+	Replace(name string, data []byte, version string) error
+	// Delete removes an object. If version is not empty, it fails with
+	// ErrPreconditionFailed if the version no longer matches. Deleting a
+	// missing object is not an error.
+	Delete(name, version string) error
+	// List returns the names of all objects starting with prefix
+	List(prefix string) ([]string, error)
+}
+
+// Config configures how keys are kept in the bucket
+type Config struct {
+	// Prefix of the names of all objects. Default: hsson-ring/
+	Prefix string
+	// Owner identifies this instance as holder of the lock.
+	// Default: the hostname
+	Owner string
+	// LeaseDuration is how long the lock is held before it expires.
+	// Default: 30 seconds
+	LeaseDuration time.Duration
+}
+
+// New creates a new store keeping keys as objects in bucket
+func New(bucket Bucket, config Config) store.Store {
+	if config.Prefix == "" {
+		config.Prefix = defaultPrefix
+	}
+	if config.Owner == "" {
+		config.Owner, _ = os.Hostname()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+	return &blobStore{bucket: bucket, config: config}
+}
+
+type blobStore struct {
+	bucket Bucket
+	config Config
+}
+
+// object is the content of a key object
+type object struct {
+	ID        string            `json:"id"`
+	IsPrivate bool              `json:"is_private"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Data      []byte            `json:"data"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// lease is the content of the lock object
+type lease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *blobStore) keyName(id string) string {
+	return s.config.Prefix + keysDir + strings.ToLower(nameEncoding.EncodeToString([]byte(id)))
+}
+
+func (s *blobStore) lockName() string {
+	return s.config.Prefix + lockName
+}
+
+func (s *blobStore) Add(key store.Key) error {
+	data, err := json.Marshal(object{
+		ID:        key.ID,
+		IsPrivate: key.IsPrivate,
+		ExpiresAt: key.ExpiresAt,
+		Data:      key.Data,
+		Metadata:  key.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	err = s.bucket.Create(s.keyName(key.ID), data)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return store.ErrKeyIDConflict
+	}
+	return err
+}
+
+func (s *blobStore) find(name string) (store.Key, error) {
+	data, _, err := s.bucket.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	if err != nil {
+		return store.Key{}, err
+	}
+	var obj object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return store.Key{}, err
+	}
+	return store.Key{
+		ID:        obj.ID,
+		IsPrivate: obj.IsPrivate,
+		ExpiresAt: obj.ExpiresAt,
+		Data:      obj.Data,
+		Metadata:  obj.Metadata,
+	}, nil
+}
+
+func (s *blobStore) Find(id string) (store.Key, error) {
+	return s.find(s.keyName(id))
+}
+
+func (s *blobStore) Delete(id string) error {
+	return s.bucket.Delete(s.keyName(id), "")
+}
+
+func (s *blobStore) List() (store.KeyList, error) {
+	names, err := s.bucket.List(s.config.Prefix + keysDir)
+	if err != nil {
+		return nil, err
+	}
+	all := make(store.KeyList, 0, len(names))
+	for _, name := range names {
+		key, err := s.find(name)
+		if errors.Is(err, ring.ErrKeyNotFound) {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+// readLease returns the current lease and the version of the lock object,
+// or a nil lease if nobody holds the lock
+func (s *blobStore) readLease() (*lease, string, error) {
+	data, version, err := s.bucket.Get(s.lockName())
+	if errors.Is(err, ErrNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	l := &lease{}
+	return l, version, json.Unmarshal(data, l)
+}
+
+func (s *blobStore) newLease() ([]byte, error) {
+	return json.Marshal(lease{
+		Owner:     s.config.Owner,
+		ExpiresAt: time.Now().Add(s.config.LeaseDuration),
+	})
+}
+
+func (s *blobStore) Lock() error {
+	current, version, err := s.readLease()
+	if err != nil {
+		return err
+	}
+	// The lock can be taken if nobody holds it, or if the lease of the
+	// current holder has run out
+	if current != nil && time.Now().Before(current.ExpiresAt) {
+		return store.ErrLockOccupied
+	}
+	data, err := s.newLease()
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		err = s.bucket.Create(s.lockName(), data)
+	} else {
+		err = s.bucket.Replace(s.lockName(), data, version)
+	}
+	if errors.Is(err, ErrPreconditionFailed) {
+		return store.ErrLockOccupied
+	}
+	return err
+}
+
+func (s *blobStore) LockTTL() time.Duration {
+	return s.config.LeaseDuration
+}
+
+// RenewLock extends the lease, as long as it is still held by this instance
+func (s *blobStore) RenewLock() error {
+	current, version, err := s.readLease()
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Owner != s.config.Owner || !time.Now().Before(current.ExpiresAt) {
+		return store.ErrLockLost
+	}
+	data, err := s.newLease()
+	if err != nil {
+		return err
+	}
+	err = s.bucket.Replace(s.lockName(), data, version)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return store.ErrLockLost
+	}
+	return err
+}
+
+func (s *blobStore) Unlock() error {
+	current, version, err := s.readLease()
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Owner != s.config.Owner {
+		// The lease expired and was taken over by another instance
+		return nil
+	}
+	err = s.bucket.Delete(s.lockName(), version)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return nil
+	}
+	return err
+}
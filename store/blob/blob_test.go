@@ -0,0 +1,327 @@
+package blob_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/blob"
+)
+
+const pageSize = 2
+
+type storedObject struct {
+	data       []byte
+	generation int
+}
+
+// fakeObjects is the state shared by the fake S3 and Cloud Storage APIs
+type fakeObjects struct {
+	mu          sync.Mutex
+	objects     map[string]storedObject
+	generations int
+}
+
+func (f *fakeObjects) put(name string, data []byte) {
+	f.generations++
+	f.objects[name] = storedObject{data: data, generation: f.generations}
+}
+
+// list returns a page of the names starting with prefix, and the token of
+// the next page
+func (f *fakeObjects) list(prefix, token string) ([]string, string) {
+	var names []string
+	for name := range f.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	start, _ := strconv.Atoi(token)
+	end := start + pageSize
+	if end >= len(names) {
+		return names[start:], ""
+	}
+	return names[start:end], strconv.Itoa(end)
+}
+
+// fakeS3 implements path-style object requests with If-Match and
+// If-None-Match, and ListObjectsV2
+type fakeS3 struct {
+	fakeObjects
+}
+
+func etag(generation int) string {
+	return `"` + strconv.Itoa(generation) + `"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) == 1 {
+		names, next := f.list(r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+		type content struct {
+			Key string
+		}
+		out := struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			Contents              []content
+			IsTruncated           bool
+			NextContinuationToken string
+		}{IsTruncated: next != "", NextContinuationToken: next}
+		for _, name := range names {
+			out.Contents = append(out.Contents, content{Key: name})
+		}
+		xml.NewEncoder(w).Encode(out)
+		return
+	}
+	name := parts[1]
+	existing, exists := f.objects[name]
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!exists || ifMatch != etag(existing.generation)) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+			return
+		}
+		w.Header().Set("ETag", etag(existing.generation))
+		w.Write(existing.data)
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		f.put(name, data)
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// fakeGCS implements the media upload, object and list requests of the
+// Cloud Storage JSON API, with generation preconditions
+type fakeGCS struct {
+	fakeObjects
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	precondition := func(name string) bool {
+		want := query.Get("ifGenerationMatch")
+		if want == "" {
+			return true
+		}
+		return strconv.Itoa(f.objects[name].generation) == want
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+		name := query.Get("name")
+		if !precondition(name) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		f.put(name, data)
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/bucket/o":
+		names, next := f.list(query.Get("prefix"), query.Get("pageToken"))
+		var items []map[string]string
+		for _, name := range names {
+			items = append(items, map[string]string{"name": name})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "nextPageToken": next})
+	case strings.HasPrefix(r.URL.EscapedPath(), "/storage/v1/b/bucket/o/"):
+		name, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/storage/v1/b/bucket/o/"))
+		existing, exists := f.objects[name]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !precondition(name) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(f.objects, name)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("X-Goog-Generation", strconv.Itoa(existing.generation))
+		w.Write(existing.data)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newS3Bucket(t *testing.T) blob.Bucket {
+	server := httptest.NewServer(&fakeS3{fakeObjects{objects: make(map[string]storedObject)}})
+	t.Cleanup(server.Close)
+	return blob.NewS3Bucket(blob.S3Config{
+		Bucket:   "bucket",
+		Region:   "eu-north-1",
+		Endpoint: server.URL,
+		Credentials: func() (blob.Credentials, error) {
+			return blob.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+		},
+	})
+}
+
+func newGCSBucket(t *testing.T) blob.Bucket {
+	server := httptest.NewServer(&fakeGCS{fakeObjects{objects: make(map[string]storedObject)}})
+	t.Cleanup(server.Close)
+	return blob.NewGCSBucket(blob.GCSConfig{
+		Bucket:   "bucket",
+		Endpoint: server.URL,
+		Token:    func() (string, error) { return "token", nil },
+	})
+}
+
+var buckets = map[string]func(t *testing.T) blob.Bucket{
+	"s3":  newS3Bucket,
+	"gcs": newGCSBucket,
+}
+
+func getStore(bucket blob.Bucket, owner string, leaseDuration time.Duration) store.Store {
+	return blob.New(bucket, blob.Config{Owner: owner, LeaseDuration: leaseDuration})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	for name, newBucket := range buckets {
+		t.Run(name, func(t *testing.T) {
+			s := getStore(newBucket(t), "one", time.Minute)
+
+			k := store.Key{
+				ID:        "ns/pub:AbCd",
+				IsPrivate: true,
+				ExpiresAt: time.Now().Add(time.Hour),
+				Data:      []byte{1, 2, 3},
+			}
+			if err := s.Add(k); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+				t.Errorf("expected ErrKeyIDConflict, got %v", err)
+			}
+			found, err := s.Find(k.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found.ID != k.ID || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+				t.Errorf("got key %+v want %+v", found, k)
+			}
+
+			// The lock object is not listed, and listing follows pages
+			if err := s.(store.Locker).Lock(); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"pub:1", "pub:2"} {
+				if err := s.Add(store.Key{ID: id, ExpiresAt: k.ExpiresAt}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			list, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 3 {
+				t.Errorf("expected 3 keys, got %d", len(list))
+			}
+
+			if err := s.Delete(k.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(k.ID); err != nil {
+				t.Errorf("expected deleting a missing key to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLeaseLock(t *testing.T) {
+	for name, newBucket := range buckets {
+		t.Run(name, func(t *testing.T) {
+			bucket := newBucket(t)
+			one := getStore(bucket, "one", time.Minute)
+			two := getStore(bucket, "two", time.Minute)
+
+			if err := one.(store.Locker).Lock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+				t.Errorf("expected ErrLockOccupied, got %v", err)
+			}
+			if err := two.(store.Locker).Unlock(); err != nil {
+				t.Errorf("expected unlocking a lock held by another owner to be a no-op, got %v", err)
+			}
+			if err := one.(store.Locker).Unlock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := two.(store.Locker).Lock(); err != nil {
+				t.Errorf("expected lock to be released, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	for name, newBucket := range buckets {
+		t.Run(name, func(t *testing.T) {
+			bucket := newBucket(t)
+			crashed := getStore(bucket, "crashed", time.Millisecond)
+			other := getStore(bucket, "other", time.Minute)
+
+			if err := crashed.(store.Locker).Lock(); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			if err := other.(store.Locker).Lock(); err != nil {
+				t.Errorf("expected expired lease to be taken over, got %v", err)
+			}
+			renewer, _ := store.AsLockRenewer(store.WithContext(crashed))
+			if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+				t.Errorf("expected ErrLockLost, got %v", err)
+			}
+		})
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for name, newBucket := range buckets {
+		newBucket := newBucket
+		t.Run(name, func(t *testing.T) {
+			storetest.Run(t, func() store.Store {
+				return getStore(newBucket(t), "one", time.Minute)
+			})
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package blob
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hsson/ring/internal/gcpauth"
+	"github.com/hsson/ring/store"
+)
+
+const defaultGCSEndpoint = "https://storage.googleapis.com"
+
+// TokenSource returns the OAuth2 access token used to authenticate
+type TokenSource = gcpauth.TokenSource
+
+// GCSConfig configures how to connect to a Google Cloud Storage bucket
+type GCSConfig struct {
+	// Bucket is the name of the bucket
+	Bucket string
+	// Endpoint overrides the Cloud Storage endpoint.
+	// Default: https://storage.googleapis.com
+	Endpoint string
+	// Token returns the access token used to authenticate. Default: the
+	// token of the default service account, from the metadata server
+	Token TokenSource
+	// HTTPClient is used to talk to Cloud Storage.
+	// Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// NewGCSBucket creates a Bucket talking to Google Cloud Storage, using
+// generation preconditions for conditional writes
+func NewGCSBucket(config GCSConfig) Bucket {
+	if config.Endpoint == "" {
+		config.Endpoint = defaultGCSEndpoint
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Token == nil {
+		config.Token = gcpauth.MetadataTokenSource(gcpauth.MetadataTokenURL, config.HTTPClient)
+	}
+	return &gcsBucket{config: config}
+}
+
+type gcsBucket struct {
+	config GCSConfig
+}
+
+// do sends an authenticated request to path, relative to the endpoint
+func (b *gcsBucket) do(method, path string, query url.Values, body []byte) (*http.Response, []byte, error) {
+	u := strings.TrimSuffix(b.config.Endpoint, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := b.config.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := b.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, store.Unavailable(err)
+	}
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return res, data, nil
+	case http.StatusNotFound:
+		return nil, nil, ErrNotFound
+	case http.StatusPreconditionFailed:
+		return nil, nil, ErrPreconditionFailed
+	}
+	var out struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err = fmt.Errorf("hsson/ring/blob: gcs: %s: unexpected status %d", method, res.StatusCode)
+	if json.Unmarshal(data, &out) == nil && out.Error.Message != "" {
+		err = fmt.Errorf("hsson/ring/blob: gcs: %s", out.Error.Message)
+	}
+	if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+		return nil, nil, store.Unavailable(err)
+	}
+	return nil, nil, err
+}
+
+func (b *gcsBucket) objectPath(name string) string {
+	return "/storage/v1/b/" + url.PathEscape(b.config.Bucket) + "/o/" + url.PathEscape(name)
+}
+
+func (b *gcsBucket) Get(name string) ([]byte, string, error) {
+	res, data, err := b.do(http.MethodGet, b.objectPath(name), url.Values{"alt": {"media"}}, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, res.Header.Get("X-Goog-Generation"), nil
+}
+
+func (b *gcsBucket) upload(name string, data []byte, generation string) error {
+	_, _, err := b.do(http.MethodPost, "/upload/storage/v1/b/"+url.PathEscape(b.config.Bucket)+"/o", url.Values{
+		"uploadType":        {"media"},
+		"name":              {name},
+		"ifGenerationMatch": {generation},
+	}, data)
+	return err
+}
+
+func (b *gcsBucket) Create(name string, data []byte) error {
+	// Generation 0 matches only if there is no live object
+	return b.upload(name, data, "0")
+}
+
+func (b *gcsBucket) Replace(name string, data []byte, version string) error {
+	return b.upload(name, data, version)
+}
+
+func (b *gcsBucket) Delete(name, version string) error {
+	var query url.Values
+	if version != "" {
+		query = url.Values{"ifGenerationMatch": {version}}
+	}
+	_, _, err := b.do(http.MethodDelete, b.objectPath(name), query, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (b *gcsBucket) List(prefix string) ([]string, error) {
+	var names []string
+	query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+	for {
+		_, data, err := b.do(http.MethodGet, "/storage/v1/b/"+url.PathEscape(b.config.Bucket)+"/o", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, err
+		}
+		for _, item := range out.Items {
+			names = append(names, item.Name)
+		}
+		if out.NextPageToken == "" {
+			return names, nil
+		}
+		query.Set("pageToken", out.NextPageToken)
+	}
+}
@@ -0,0 +1,169 @@
+package blob
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring/internal/awsv4"
+	"github.com/hsson/ring/store"
+)
+
+// Credentials are the AWS credentials used to sign requests
+type Credentials = awsv4.Credentials
+
+// S3Config configures how to connect to an Amazon S3 bucket, or another
+// service compatible with its API and conditional writes
+type S3Config struct {
+	// Bucket is the name of the bucket
+	Bucket string
+	// Region is the AWS region of the bucket
+	Region string
+	// Endpoint overrides the S3 endpoint, e.g. for S3 compatible services.
+	// The bucket is addressed by path. Default: https://s3.<region>.amazonaws.com
+	Endpoint string
+	// Credentials returns the credentials used to sign requests. It is
+	// called for every request, so temporary credentials can be refreshed.
+	// Default: credentials from the AWS_* environment variables
+	Credentials func() (Credentials, error)
+	// HTTPClient is used to talk to S3. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// NewS3Bucket creates a Bucket talking to Amazon S3
+func NewS3Bucket(config S3Config) Bucket {
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	if config.Credentials == nil {
+		config.Credentials = awsv4.EnvCredentials
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &s3Bucket{config: config}
+}
+
+type s3Bucket struct {
+	config S3Config
+}
+
+// do sends a signed request for the object name, or the bucket itself if
+// name is empty
+func (b *s3Bucket) do(method, name string, query url.Values, header http.Header, body []byte) (*http.Response, []byte, error) {
+	u, err := url.Parse(strings.TrimSuffix(b.config.Endpoint, "/") + "/" + b.config.Bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	if name != "" {
+		u.Path += "/" + name
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	creds, err := b.config.Credentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	awsv4.Sign(req, body, creds, b.config.Region, "s3", time.Now())
+
+	res, err := b.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, store.Unavailable(err)
+	}
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return res, data, nil
+	case http.StatusNotFound:
+		return nil, nil, ErrNotFound
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// S3 responds with 409 if a concurrent conditional write won
+		return nil, nil, ErrPreconditionFailed
+	}
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	err = fmt.Errorf("hsson/ring/blob: s3: %s: unexpected status %d", method, res.StatusCode)
+	if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		err = fmt.Errorf("hsson/ring/blob: s3: %s: %s", s3Err.Code, s3Err.Message)
+	}
+	// S3 responds with 503 SlowDown when throttling
+	if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+		return nil, nil, store.Unavailable(err)
+	}
+	return nil, nil, err
+}
+
+func (b *s3Bucket) Get(name string) ([]byte, string, error) {
+	res, data, err := b.do(http.MethodGet, name, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, res.Header.Get("ETag"), nil
+}
+
+func (b *s3Bucket) Create(name string, data []byte) error {
+	_, _, err := b.do(http.MethodPut, name, nil, http.Header{"If-None-Match": {"*"}}, data)
+	return err
+}
+
+func (b *s3Bucket) Replace(name string, data []byte, version string) error {
+	_, _, err := b.do(http.MethodPut, name, nil, http.Header{"If-Match": {version}}, data)
+	return err
+}
+
+func (b *s3Bucket) Delete(name, version string) error {
+	var header http.Header
+	if version != "" {
+		header = http.Header{"If-Match": {version}}
+	}
+	_, _, err := b.do(http.MethodDelete, name, nil, header, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (b *s3Bucket) List(prefix string) ([]string, error) {
+	var names []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		_, data, err := b.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(data, &out); err != nil {
+			return nil, err
+		}
+		for _, c := range out.Contents {
+			names = append(names, c.Key)
+		}
+		if !out.IsTruncated {
+			return names, nil
+		}
+		query.Set("continuation-token", out.NextContinuationToken)
+	}
+}
@@ -0,0 +1,332 @@
+// Package consul implements a store on top of the key/value store of
+// HashiCorp Consul. Each key is kept as a KV entry written with
+// check-and-set, so existing keys are never overwritten. The store lock is
+// a KV entry acquired with a session, which Consul releases if the session
+// is not renewed within its TTL, e.g. because its holder disappeared.
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	defaultAddress       = "http://127.0.0.1:8500"
+	defaultPrefix        = "hsson-ring"
+	defaultLeaseDuration = 30 * time.Second
+	lockName             = "lock"
+	keysDir              = "keys/"
+)
+
+// Config configures how the store connects to Consul
+type Config struct {
+	// Address of the Consul agent. Default: the CONSUL_HTTP_ADDR
+	// environment variable, or http://127.0.0.1:8500
+	Address string
+	// Token used to authenticate. Default: the CONSUL_HTTP_TOKEN
+	// environment variable
+	Token string
+	// Prefix is the KV path keys are kept under. Default: hsson-ring
+	Prefix string
+	// Owner names the session holding the lock. Default: the hostname
+	Owner string
+	// LeaseDuration is the TTL of the session holding the lock. Consul
+	// requires at least 10 seconds. Default: 30 seconds
+	LeaseDuration time.Duration
+	// HTTPClient is used to talk to Consul. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New creates a new store keeping keys in Consul
+func New(config Config) store.Store {
+	if config.Address == "" {
+		config.Address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if config.Address == "" {
+		config.Address = defaultAddress
+	}
+	if !strings.Contains(config.Address, "://") {
+		config.Address = "http://" + config.Address
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if config.Prefix == "" {
+		config.Prefix = defaultPrefix
+	}
+	if config.Owner == "" {
+		config.Owner, _ = os.Hostname()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	return &consulStore{config: config}
+}
+
+type entry struct {
+	ID        string            `json:"id"`
+	IsPrivate bool              `json:"private"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Data      []byte            `json:"data"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// kvPair is an entry as returned by the KV API
+type kvPair struct {
+	Key         string `json:"Key"`
+	Value       []byte `json:"Value"`
+	ModifyIndex uint64 `json:"ModifyIndex"`
+	Session     string `json:"Session"`
+}
+
+// apiError is returned for unexpected responses from Consul
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("hsson/ring/consul: status %d: %s", e.status, e.message)
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.status == status
+}
+
+type consulStore struct {
+	config Config
+
+	mu sync.Mutex
+	// session holds the lock while it is taken
+	session string
+}
+
+func (s *consulStore) do(method, path string, query url.Values, body []byte, out interface{}) error {
+	u := s.config.Address + "/v1/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if s.config.Token != "" {
+		req.Header.Set("X-Consul-Token", s.config.Token)
+	}
+
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		err := &apiError{status: res.StatusCode, message: strings.TrimSpace(string(data))}
+		if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+			return store.Unavailable(err)
+		}
+		return err
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func (s *consulStore) kvPath(name string) string {
+	return "kv/" + s.config.Prefix + "/" + name
+}
+
+func (s *consulStore) keyName(id string) string {
+	return keysDir + url.PathEscape(id)
+}
+
+// put writes a KV entry with the given query, e.g. check-and-set or
+// acquire, reporting whether the write took place
+func (s *consulStore) put(name string, query url.Values, value []byte) (bool, error) {
+	var ok bool
+	err := s.do(http.MethodPut, s.kvPath(name), query, value, &ok)
+	return ok, err
+}
+
+func (s *consulStore) Add(key store.Key) error {
+	value, err := json.Marshal(entry{
+		ID:        key.ID,
+		IsPrivate: key.IsPrivate,
+		ExpiresAt: key.ExpiresAt,
+		Data:      key.Data,
+		Metadata:  key.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	// A check-and-set index of 0 only writes entries which do not exist
+	ok, err := s.put(s.keyName(key.ID), url.Values{"cas": {"0"}}, value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrKeyIDConflict
+	}
+	return nil
+}
+
+func pairToKey(pair kvPair) (store.Key, error) {
+	var e entry
+	if err := json.Unmarshal(pair.Value, &e); err != nil {
+		return store.Key{}, err
+	}
+	return store.Key{
+		ID:        e.ID,
+		IsPrivate: e.IsPrivate,
+		ExpiresAt: e.ExpiresAt,
+		Data:      e.Data,
+		Metadata:  e.Metadata,
+	}, nil
+}
+
+func (s *consulStore) Find(id string) (store.Key, error) {
+	var pairs []kvPair
+	err := s.do(http.MethodGet, s.kvPath(s.keyName(id)), nil, nil, &pairs)
+	if isStatus(err, http.StatusNotFound) || (err == nil && len(pairs) == 0) {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	if err != nil {
+		return store.Key{}, err
+	}
+	return pairToKey(pairs[0])
+}
+
+func (s *consulStore) Delete(id string) error {
+	return s.do(http.MethodDelete, s.kvPath(s.keyName(id)), nil, nil, nil)
+}
+
+func (s *consulStore) List() (store.KeyList, error) {
+	var pairs []kvPair
+	err := s.do(http.MethodGet, s.kvPath(keysDir), url.Values{"recurse": {"true"}}, nil, &pairs)
+	if isStatus(err, http.StatusNotFound) {
+		return store.KeyList{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	all := make(store.KeyList, 0, len(pairs))
+	for _, pair := range pairs {
+		key, err := pairToKey(pair)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+func (s *consulStore) createSession() (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"Name": "hsson-ring: " + s.config.Owner,
+		"TTL":  s.config.LeaseDuration.String(),
+		// Release the lock if the session is invalidated, and allow it
+		// to be taken right away
+		"Behavior":  "release",
+		"LockDelay": "0s",
+	})
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		ID string `json:"ID"`
+	}
+	if err := s.do(http.MethodPut, "session/create", nil, body, &out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+func (s *consulStore) destroySession(session string) error {
+	return s.do(http.MethodPut, "session/destroy/"+session, nil, nil, nil)
+}
+
+func (s *consulStore) Lock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.createSession()
+	if err != nil {
+		return err
+	}
+	ok, err := s.put(lockName, url.Values{"acquire": {session}}, []byte(s.config.Owner))
+	if err != nil || !ok {
+		_ = s.destroySession(session)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrLockOccupied
+	}
+	s.session = session
+	return nil
+}
+
+func (s *consulStore) LockTTL() time.Duration {
+	return s.config.LeaseDuration
+}
+
+// RenewLock renews the session holding the lock. Consul only responds with
+// 404 once the session has been invalidated and the lock released.
+func (s *consulStore) RenewLock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session == "" {
+		return store.ErrLockLost
+	}
+	err := s.do(http.MethodPut, "session/renew/"+s.session, nil, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		s.session = ""
+		return store.ErrLockLost
+	}
+	return err
+}
+
+func (s *consulStore) Unlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session == "" {
+		return nil
+	}
+	session := s.session
+	s.session = ""
+	// Destroying the session releases the lock as well, but releasing it
+	// explicitly first works even if destroying fails
+	if _, err := s.put(lockName, url.Values{"release": {session}}, nil); err != nil {
+		return err
+	}
+	err := s.destroySession(session)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
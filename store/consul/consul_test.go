@@ -0,0 +1,268 @@
+package consul_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/consul"
+)
+
+type kvEntry struct {
+	value       []byte
+	modifyIndex uint64
+	session     string
+}
+
+// fakeConsul implements the KV and session endpoints used by the store.
+// Sessions are invalidated once their TTL runs out without a renewal,
+// releasing the locks they hold.
+type fakeConsul struct {
+	mu       sync.Mutex
+	kv       map[string]*kvEntry
+	sessions map[string]time.Duration
+	renewed  map[string]time.Time
+	index    uint64
+}
+
+func newFakeConsul() *httptest.Server {
+	return httptest.NewServer(&fakeConsul{
+		kv:       make(map[string]*kvEntry),
+		sessions: make(map[string]time.Duration),
+		renewed:  make(map[string]time.Time),
+	})
+}
+
+func (c *fakeConsul) invalidateExpired() {
+	for id, ttl := range c.sessions {
+		if time.Since(c.renewed[id]) > ttl {
+			c.destroy(id)
+		}
+	}
+}
+
+func (c *fakeConsul) destroy(session string) {
+	delete(c.sessions, session)
+	for _, e := range c.kv {
+		if e.session == session {
+			e.session = ""
+		}
+	}
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateExpired()
+
+	if r.Header.Get("X-Consul-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "session/create":
+		var req struct {
+			TTL      string
+			Behavior string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || req.Behavior != "release" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.index++
+		id := fmt.Sprintf("session-%d", c.index)
+		c.sessions[id] = ttl
+		c.renewed[id] = time.Now()
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case strings.HasPrefix(path, "session/renew/"):
+		id := strings.TrimPrefix(path, "session/renew/")
+		if _, ok := c.sessions[id]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.renewed[id] = time.Now()
+		w.Write([]byte("[{}]"))
+	case strings.HasPrefix(path, "session/destroy/"):
+		c.destroy(strings.TrimPrefix(path, "session/destroy/"))
+		w.Write([]byte("true"))
+	case strings.HasPrefix(path, "kv/"):
+		c.serveKV(w, r, strings.TrimPrefix(path, "kv/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (c *fakeConsul) serveKV(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		var keys []string
+		for k := range c.kv {
+			if k == key || (query.Get("recurse") != "" && strings.HasPrefix(k, key)) {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Strings(keys)
+		var pairs []map[string]interface{}
+		for _, k := range keys {
+			e := c.kv[k]
+			pairs = append(pairs, map[string]interface{}{
+				"Key": k, "Value": e.value, "ModifyIndex": e.modifyIndex, "Session": e.session,
+			})
+		}
+		json.NewEncoder(w).Encode(pairs)
+	case http.MethodPut:
+		value, _ := ioutil.ReadAll(r.Body)
+		existing := c.kv[key]
+		ok := true
+		var holder string
+		if existing != nil {
+			holder = existing.session
+		}
+		switch {
+		case query.Get("cas") == "0":
+			ok = existing == nil
+		case query.Get("acquire") != "":
+			session := query.Get("acquire")
+			_, valid := c.sessions[session]
+			ok = valid && (holder == "" || holder == session)
+			holder = session
+		case query.Get("release") != "":
+			ok = existing != nil && existing.session == query.Get("release")
+			if ok {
+				existing.session = ""
+			}
+			json.NewEncoder(w).Encode(ok)
+			return
+		}
+		if ok {
+			c.index++
+			c.kv[key] = &kvEntry{value: value, modifyIndex: c.index, session: holder}
+		}
+		json.NewEncoder(w).Encode(ok)
+	case http.MethodDelete:
+		delete(c.kv, key)
+		w.Write([]byte("true"))
+	}
+}
+
+func getStore(address, owner string, leaseDuration time.Duration) store.Store {
+	return consul.New(consul.Config{
+		Address:       address,
+		Token:         "token",
+		Owner:         owner,
+		LeaseDuration: leaseDuration,
+	})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+	s := getStore(server.URL, "one", time.Minute)
+
+	k := store.Key{
+		ID:        "ns/pub:AbCd",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	// The lock entry is not listed
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Errorf("expected 1 key, got %d", len(list))
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); err == nil {
+		t.Error("expected deleted key to be gone")
+	}
+}
+
+func TestSessionLock(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+	one := getStore(server.URL, "one", time.Minute)
+	two := getStore(server.URL, "two", time.Minute)
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := two.(store.Locker).Unlock(); err != nil {
+		t.Errorf("expected unlocking a lock held by another owner to be a no-op, got %v", err)
+	}
+	if err := one.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestExpiredSessionReleasesLock(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+	crashed := getStore(server.URL, "crashed", time.Millisecond)
+	other := getStore(server.URL, "other", time.Minute)
+
+	if err := crashed.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := other.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock of expired session to be taken over, got %v", err)
+	}
+	renewer, _ := store.AsLockRenewer(store.WithContext(crashed))
+	if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		server := newFakeConsul()
+		t.Cleanup(server.Close)
+		return getStore(server.URL, "one", time.Minute)
+	})
+}
@@ -0,0 +1,110 @@
+package store
+
+import "context"
+
+// ContextStore is a Store whose operations accept a context, allowing
+// network backed stores to honor cancellation and deadlines. The semantics
+// of each operation are the same as for Store and Locker.
+type ContextStore interface {
+	Add(ctx context.Context, key Key) error
+	Find(ctx context.Context, id string) (Key, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) (KeyList, error)
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
+// WithContext adapts a Store to a ContextStore. The context is only checked
+// before each operation is started, as the Store can not be interrupted.
+// Stores which don't implement Locker are locked by a process local lock
+// of the returned ContextStore, see AsLocker. Stores created by
+// WithoutContext are unwrapped, so their context support is kept.
+func WithContext(s Store) ContextStore {
+	if w, ok := s.(withoutContext); ok {
+		return w.store
+	}
+	return withContext{store: s, locker: AsLocker(s)}
+}
+
+// WithoutContext adapts a ContextStore to a Store, using a background
+// context for all operations.
+func WithoutContext(s ContextStore) Store {
+	if w, ok := s.(withContext); ok {
+		return w.store
+	}
+	return withoutContext{store: s}
+}
+
+type withContext struct {
+	store  Store
+	locker Locker
+}
+
+func (s withContext) Add(ctx context.Context, key Key) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Add(key)
+}
+
+func (s withContext) Find(ctx context.Context, id string) (Key, error) {
+	if err := ctx.Err(); err != nil {
+		return Key{}, err
+	}
+	return s.store.Find(id)
+}
+
+func (s withContext) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Delete(id)
+}
+
+func (s withContext) List(ctx context.Context) (KeyList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.store.List()
+}
+
+func (s withContext) Lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.locker.Lock()
+}
+
+// Unlock always releases the lock, even if the context is done, so a
+// cancelled operation never leaves the store locked.
+func (s withContext) Unlock(ctx context.Context) error {
+	return s.locker.Unlock()
+}
+
+type withoutContext struct {
+	store ContextStore
+}
+
+func (s withoutContext) Add(key Key) error {
+	return s.store.Add(context.Background(), key)
+}
+
+func (s withoutContext) Find(id string) (Key, error) {
+	return s.store.Find(context.Background(), id)
+}
+
+func (s withoutContext) Delete(id string) error {
+	return s.store.Delete(context.Background(), id)
+}
+
+func (s withoutContext) List() (KeyList, error) {
+	return s.store.List(context.Background())
+}
+
+func (s withoutContext) Lock() error {
+	return s.store.Lock(context.Background())
+}
+
+func (s withoutContext) Unlock() error {
+	return s.store.Unlock(context.Background())
+}
@@ -0,0 +1,365 @@
+// Package dynamodb implements a store on top of Amazon DynamoDB. Keys are
+// kept as items in a table with the string partition key "id". Conditional
+// writes detect ID conflicts, the "ttl" attribute can be enabled as the
+// table's TTL attribute to have DynamoDB remove expired keys, and the store
+// lock is a lease item which expires if its holder disappears.
+package dynamodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/internal/awsv4"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	lockItemID           = "hsson-ring:lock"
+	defaultLeaseDuration = 30 * time.Second
+
+	conditionalCheckFailed = "ConditionalCheckFailedException"
+)
+
+// throttlingErrors are the error types DynamoDB responds with when
+// requests exceed the capacity of the table or account
+var throttlingErrors = []string{
+	"ProvisionedThroughputExceededException",
+	"ThrottlingException",
+	"RequestLimitExceeded",
+}
+
+// Credentials are the AWS credentials used to sign requests
+type Credentials = awsv4.Credentials
+
+// Config configures how the store connects to DynamoDB
+type Config struct {
+	// Table is the name of the table keys are kept in
+	Table string
+	// Region is the AWS region of the table
+	Region string
+	// Endpoint overrides the DynamoDB endpoint, e.g. for DynamoDB Local.
+	// Default: https://dynamodb.<region>.amazonaws.com
+	Endpoint string
+	// Credentials returns the credentials used to sign requests. It is
+	// called for every request, so temporary credentials can be refreshed.
+	// Default: credentials from the AWS_* environment variables
+	Credentials func() (Credentials, error)
+	// Owner identifies this instance as holder of the lock.
+	// Default: the hostname
+	Owner string
+	// LeaseDuration is how long the lock is held before it expires.
+	// Default: 30 seconds
+	LeaseDuration time.Duration
+	// HTTPClient is used to talk to DynamoDB. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New creates a new store keeping keys in a DynamoDB table
+func New(config Config) store.Store {
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://dynamodb.%s.amazonaws.com", config.Region)
+	}
+	if config.Credentials == nil {
+		config.Credentials = awsv4.EnvCredentials
+	}
+	if config.Owner == "" {
+		config.Owner, _ = os.Hostname()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &dynamoStore{config: config}
+}
+
+// attributeValue is the DynamoDB JSON representation of a value
+type attributeValue struct {
+	S    *string `json:"S,omitempty"`
+	N    *string `json:"N,omitempty"`
+	B    []byte  `json:"B,omitempty"`
+	BOOL *bool   `json:"BOOL,omitempty"`
+	M    item    `json:"M,omitempty"`
+}
+
+type item map[string]attributeValue
+
+func stringValue(s string) attributeValue {
+	return attributeValue{S: &s}
+}
+
+func numberValue(n int64) attributeValue {
+	s := strconv.FormatInt(n, 10)
+	return attributeValue{N: &s}
+}
+
+func boolValue(b bool) attributeValue {
+	return attributeValue{BOOL: &b}
+}
+
+func mapValue(m map[string]string) attributeValue {
+	it := make(item, len(m))
+	for k, v := range m {
+		it[k] = stringValue(v)
+	}
+	return attributeValue{M: it}
+}
+
+type apiError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("hsson/ring/dynamodb: %s: %s", e.Type, e.Message)
+}
+
+func (e *apiError) is(errorType string) bool {
+	return strings.HasSuffix(e.Type, "#"+errorType)
+}
+
+type dynamoStore struct {
+	config Config
+}
+
+func (s *dynamoStore) do(operation string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+operation)
+	creds, err := s.config.Credentials()
+	if err != nil {
+		return err
+	}
+	awsv4.Sign(req, body, creds, s.config.Region, "dynamodb", time.Now())
+
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		if res.StatusCode >= http.StatusInternalServerError {
+			return store.Unavailable(fmt.Errorf("hsson/ring/dynamodb: %s: unexpected status %d", operation, res.StatusCode))
+		}
+		apiErr := &apiError{}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Type == "" {
+			return fmt.Errorf("hsson/ring/dynamodb: %s: unexpected status %d", operation, res.StatusCode)
+		}
+		for _, throttling := range throttlingErrors {
+			if apiErr.is(throttling) {
+				return store.Unavailable(apiErr)
+			}
+		}
+		return apiErr
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.is(conditionalCheckFailed)
+}
+
+func (s *dynamoStore) Add(key store.Key) error {
+	it := item{
+		"id":         stringValue(key.ID),
+		"is_private": boolValue(key.IsPrivate),
+		"expires_at": numberValue(key.ExpiresAt.UnixNano()),
+		"ttl":        numberValue(key.ExpiresAt.Unix()),
+		"data":       {B: key.Data},
+	}
+	if len(key.Metadata) != 0 {
+		it["metadata"] = mapValue(key.Metadata)
+	}
+	err := s.do("PutItem", map[string]interface{}{
+		"TableName":           s.config.Table,
+		"Item":                it,
+		"ConditionExpression": "attribute_not_exists(id)",
+	}, nil)
+	if isConditionalCheckFailed(err) {
+		return store.ErrKeyIDConflict
+	}
+	return err
+}
+
+func itemToKey(it item) (store.Key, error) {
+	if it["id"].S == nil || it["expires_at"].N == nil {
+		return store.Key{}, errors.New("hsson/ring/dynamodb: malformed key item")
+	}
+	expiresAt, err := strconv.ParseInt(*it["expires_at"].N, 10, 64)
+	if err != nil {
+		return store.Key{}, err
+	}
+	var metadata map[string]string
+	if m := it["metadata"].M; m != nil {
+		metadata = make(map[string]string, len(m))
+		for k, v := range m {
+			if v.S != nil {
+				metadata[k] = *v.S
+			}
+		}
+	}
+	return store.Key{
+		ID:        *it["id"].S,
+		IsPrivate: it["is_private"].BOOL != nil && *it["is_private"].BOOL,
+		ExpiresAt: time.Unix(0, expiresAt),
+		Data:      it["data"].B,
+		Metadata:  metadata,
+	}, nil
+}
+
+func (s *dynamoStore) Find(id string) (store.Key, error) {
+	var out struct {
+		Item item `json:"Item"`
+	}
+	err := s.do("GetItem", map[string]interface{}{
+		"TableName":      s.config.Table,
+		"Key":            item{"id": stringValue(id)},
+		"ConsistentRead": true,
+	}, &out)
+	if err != nil {
+		return store.Key{}, err
+	}
+	if out.Item == nil || id == lockItemID {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	return itemToKey(out.Item)
+}
+
+func (s *dynamoStore) Delete(id string) error {
+	return s.do("DeleteItem", map[string]interface{}{
+		"TableName": s.config.Table,
+		"Key":       item{"id": stringValue(id)},
+	}, nil)
+}
+
+func (s *dynamoStore) List() (store.KeyList, error) {
+	var all store.KeyList
+	var startKey item
+	for {
+		in := map[string]interface{}{
+			"TableName":      s.config.Table,
+			"ConsistentRead": true,
+		}
+		if startKey != nil {
+			in["ExclusiveStartKey"] = startKey
+		}
+		var out struct {
+			Items            []item `json:"Items"`
+			LastEvaluatedKey item   `json:"LastEvaluatedKey"`
+		}
+		if err := s.do("Scan", in, &out); err != nil {
+			return nil, err
+		}
+		for _, it := range out.Items {
+			if it["id"].S != nil && *it["id"].S == lockItemID {
+				continue
+			}
+			key, err := itemToKey(it)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, key)
+		}
+		if out.LastEvaluatedKey == nil {
+			return all, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+func (s *dynamoStore) Lock() error {
+	now := time.Now()
+	expiresAt := now.Add(s.config.LeaseDuration)
+	err := s.do("PutItem", map[string]interface{}{
+		"TableName": s.config.Table,
+		"Item": item{
+			"id":         stringValue(lockItemID),
+			"owner":      stringValue(s.config.Owner),
+			"expires_at": numberValue(expiresAt.UnixNano()),
+			"ttl":        numberValue(expiresAt.Unix()),
+		},
+		// The lock can be taken if nobody holds it, or if the lease of the
+		// current holder has run out
+		"ConditionExpression": "attribute_not_exists(id) OR expires_at < :now",
+		"ExpressionAttributeValues": item{
+			":now": numberValue(now.UnixNano()),
+		},
+	}, nil)
+	if isConditionalCheckFailed(err) {
+		return store.ErrLockOccupied
+	}
+	return err
+}
+
+func (s *dynamoStore) LockTTL() time.Duration {
+	return s.config.LeaseDuration
+}
+
+// RenewLock extends the lease, as long as it is still held by this instance
+func (s *dynamoStore) RenewLock() error {
+	expiresAt := time.Now().Add(s.config.LeaseDuration)
+	err := s.do("PutItem", map[string]interface{}{
+		"TableName": s.config.Table,
+		"Item": item{
+			"id":         stringValue(lockItemID),
+			"owner":      stringValue(s.config.Owner),
+			"expires_at": numberValue(expiresAt.UnixNano()),
+			"ttl":        numberValue(expiresAt.Unix()),
+		},
+		"ConditionExpression": "#owner = :owner",
+		"ExpressionAttributeNames": map[string]string{
+			"#owner": "owner",
+		},
+		"ExpressionAttributeValues": item{
+			":owner": stringValue(s.config.Owner),
+		},
+	}, nil)
+	if isConditionalCheckFailed(err) {
+		return store.ErrLockLost
+	}
+	return err
+}
+
+func (s *dynamoStore) Unlock() error {
+	err := s.do("DeleteItem", map[string]interface{}{
+		"TableName":           s.config.Table,
+		"Key":                 item{"id": stringValue(lockItemID)},
+		"ConditionExpression": "#owner = :owner",
+		"ExpressionAttributeNames": map[string]string{
+			"#owner": "owner",
+		},
+		"ExpressionAttributeValues": item{
+			":owner": stringValue(s.config.Owner),
+		},
+	}, nil)
+	if isConditionalCheckFailed(err) {
+		// The lease expired and was taken over by another instance
+		return nil
+	}
+	return err
+}
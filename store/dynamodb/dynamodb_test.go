@@ -0,0 +1,209 @@
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/dynamodb"
+)
+
+type attributeValue map[string]interface{}
+
+// fakeDynamoDB implements the operations and condition expressions used by
+// the store.
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	items map[string]map[string]attributeValue
+}
+
+type request struct {
+	Item                      map[string]attributeValue
+	Key                       map[string]attributeValue
+	ConditionExpression       string
+	ExpressionAttributeValues map[string]attributeValue
+}
+
+func (db *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var req request
+	json.NewDecoder(r.Body).Decode(&req)
+
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+	switch operation {
+	case "PutItem":
+		id := req.Item["id"]["S"].(string)
+		existing, ok := db.items[id]
+		// Conditions on attributes fail for missing items
+		if (ok && !db.conditionHolds(req, existing)) || (!ok && req.ConditionExpression == "#owner = :owner") {
+			db.conditionFailed(w)
+			return
+		}
+		db.items[id] = req.Item
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	case "GetItem":
+		out := map[string]interface{}{}
+		if existing, ok := db.items[req.Key["id"]["S"].(string)]; ok {
+			out["Item"] = existing
+		}
+		json.NewEncoder(w).Encode(out)
+	case "DeleteItem":
+		id := req.Key["id"]["S"].(string)
+		if existing, ok := db.items[id]; ok && req.ConditionExpression != "" && !db.conditionHolds(req, existing) {
+			db.conditionFailed(w)
+			return
+		}
+		delete(db.items, id)
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	case "Scan":
+		var items []interface{}
+		for _, it := range db.items {
+			items = append(items, it)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Items": items})
+	}
+}
+
+func (db *fakeDynamoDB) conditionHolds(req request, existing map[string]attributeValue) bool {
+	switch req.ConditionExpression {
+	case "attribute_not_exists(id) OR expires_at < :now":
+		expiresAt, _ := strconv.ParseInt(existing["expires_at"]["N"].(string), 10, 64)
+		now, _ := strconv.ParseInt(req.ExpressionAttributeValues[":now"]["N"].(string), 10, 64)
+		return expiresAt < now
+	case "#owner = :owner":
+		return existing["owner"]["S"] == req.ExpressionAttributeValues[":owner"]["S"]
+	default:
+		return false
+	}
+}
+
+func (db *fakeDynamoDB) conditionFailed(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",
+		"message": "The conditional request failed",
+	})
+}
+
+func newFakeDynamoDB() *httptest.Server {
+	return httptest.NewServer(&fakeDynamoDB{items: make(map[string]map[string]attributeValue)})
+}
+
+func getStore(endpoint, owner string, leaseDuration time.Duration) store.Store {
+	return dynamodb.New(dynamodb.Config{
+		Table:    "keys",
+		Region:   "eu-north-1",
+		Endpoint: endpoint,
+		Credentials: func() (dynamodb.Credentials, error) {
+			return dynamodb.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+		},
+		Owner:         owner,
+		LeaseDuration: leaseDuration,
+	})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	server := newFakeDynamoDB()
+	defer server.Close()
+	s := getStore(server.URL, "one", time.Minute)
+
+	k := store.Key{
+		ID:        "pub:AbCd",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour).Round(0),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != k.ID {
+		t.Errorf("got keys %+v", keys)
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestLeaseLock(t *testing.T) {
+	server := newFakeDynamoDB()
+	defer server.Close()
+	one := getStore(server.URL, "one", time.Minute)
+	two := getStore(server.URL, "two", time.Minute)
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := two.(store.Locker).Unlock(); err != nil {
+		t.Errorf("expected unlocking a lock held by another owner to be a no-op, got %v", err)
+	}
+	if err := one.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	server := newFakeDynamoDB()
+	defer server.Close()
+	crashed := getStore(server.URL, "crashed", time.Millisecond)
+	other := getStore(server.URL, "other", time.Minute)
+
+	if err := crashed.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := other.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected expired lease to be taken over, got %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		server := newFakeDynamoDB()
+		t.Cleanup(server.Close)
+		return getStore(server.URL, "one", time.Minute)
+	})
+}
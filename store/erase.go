@@ -0,0 +1,39 @@
+package store
+
+import "context"
+
+// SecureEraser is implemented by stores which can erase the data of a key
+// beyond deleting it, e.g. by overwriting a file before unlinking it. The
+// keychain erases private keys this way once they are no longer needed.
+// Like Delete, erasing a key which does not exist should NOT give an error.
+type SecureEraser interface {
+	SecureErase(id string) error
+}
+
+// ContextSecureEraser is the SecureEraser of a ContextStore
+type ContextSecureEraser interface {
+	SecureErase(ctx context.Context, id string) error
+}
+
+// SecureErase erases the key id of s, if s, or the Store adapted by
+// WithContext, implements SecureEraser. Keys of other stores are deleted.
+func SecureErase(ctx context.Context, s ContextStore, id string) error {
+	if e, ok := s.(ContextSecureEraser); ok {
+		return e.SecureErase(ctx, id)
+	}
+	return s.Delete(ctx, id)
+}
+
+func (s withContext) SecureErase(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e, ok := s.store.(SecureEraser); ok {
+		return e.SecureErase(id)
+	}
+	return s.store.Delete(id)
+}
+
+func (s withoutContext) SecureErase(id string) error {
+	return SecureErase(context.Background(), s.store, id)
+}
@@ -0,0 +1,308 @@
+// Package etcd implements a store on top of etcd v3, talking to its JSON
+// gRPC gateway. Keys are attached to leases so etcd removes them when they
+// expire, and the store lock is a key attached to a short lived lease, so it
+// is released if its holder disappears.
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	defaultPrefix  = "/hsson-ring/"
+	defaultLockTTL = 30 * time.Second
+	lockKey        = "lock"
+	keysKey        = "keys/"
+)
+
+// Config configures how the store connects to etcd
+type Config struct {
+	// Endpoint is the base URL of an etcd member, e.g. http://localhost:2379
+	Endpoint string
+	// Prefix is prepended to all keys written by the store.
+	// Default: /hsson-ring/
+	Prefix string
+	// Owner identifies this instance as holder of the lock.
+	// Default: the hostname
+	Owner string
+	// LockTTL is how long the lock is held before it expires.
+	// Default: 30 seconds
+	LockTTL time.Duration
+	// HTTPClient is used to talk to etcd, and can be configured with
+	// client certificates. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New creates a new store keeping keys in etcd
+func New(config Config) store.Store {
+	if config.Prefix == "" {
+		config.Prefix = defaultPrefix
+	}
+	if config.Owner == "" {
+		config.Owner, _ = os.Hostname()
+	}
+	if config.LockTTL == 0 {
+		config.LockTTL = defaultLockTTL
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &etcdStore{config: config}
+}
+
+type keyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type value struct {
+	IsPrivate bool              `json:"private"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Data      []byte            `json:"data"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+type etcdStore struct {
+	config Config
+
+	mu        sync.Mutex
+	lockLease int64
+}
+
+func (s *etcdStore) do(path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := s.config.HTTPClient.Post(s.config.Endpoint+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&apiErr)
+		err := fmt.Errorf("hsson/ring/etcd: %s: status %d: %s", path, res.StatusCode, apiErr.Message)
+		if res.StatusCode >= http.StatusInternalServerError {
+			return store.Unavailable(err)
+		}
+		return err
+	}
+	if out != nil {
+		return json.NewDecoder(res.Body).Decode(out)
+	}
+	return nil
+}
+
+func (s *etcdStore) grantLease(ttl time.Duration) (int64, error) {
+	var out struct {
+		ID int64 `json:"ID,string"`
+	}
+	seconds := int64(math.Ceil(ttl.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	if err := s.do("/v3/lease/grant", map[string]interface{}{"TTL": fmt.Sprint(seconds)}, &out); err != nil {
+		return 0, err
+	}
+	return out.ID, nil
+}
+
+func (s *etcdStore) revokeLease(id int64) error {
+	return s.do("/v3/lease/revoke", map[string]interface{}{"ID": fmt.Sprint(id)}, nil)
+}
+
+// putIfAbsent writes a value only if the key does not already exist
+func (s *etcdStore) putIfAbsent(key string, val []byte, lease int64) (bool, error) {
+	var out struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err := s.do("/v3/kv/txn", map[string]interface{}{
+		"compare": []map[string]interface{}{{
+			"target":          "CREATE",
+			"key":             []byte(key),
+			"create_revision": "0",
+		}},
+		"success": []map[string]interface{}{{
+			"request_put": map[string]interface{}{
+				"key":   []byte(key),
+				"value": val,
+				"lease": fmt.Sprint(lease),
+			},
+		}},
+	}, &out)
+	return out.Succeeded, err
+}
+
+func (s *etcdStore) keyPath(id string) string {
+	return s.config.Prefix + keysKey + id
+}
+
+func (s *etcdStore) Add(key store.Key) error {
+	val, err := json.Marshal(value{
+		IsPrivate: key.IsPrivate,
+		ExpiresAt: key.ExpiresAt,
+		Data:      key.Data,
+		Metadata:  key.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	lease, err := s.grantLease(time.Until(key.ExpiresAt))
+	if err != nil {
+		return err
+	}
+	ok, err := s.putIfAbsent(s.keyPath(key.ID), val, lease)
+	if err != nil || !ok {
+		s.revokeLease(lease)
+		if err != nil {
+			return err
+		}
+		return store.ErrKeyIDConflict
+	}
+	return nil
+}
+
+func (s *etcdStore) decode(kv keyValue) (store.Key, error) {
+	var val value
+	if err := json.Unmarshal(kv.Value, &val); err != nil {
+		return store.Key{}, err
+	}
+	return store.Key{
+		ID:        strings.TrimPrefix(string(kv.Key), s.keyPath("")),
+		IsPrivate: val.IsPrivate,
+		ExpiresAt: val.ExpiresAt,
+		Data:      val.Data,
+		Metadata:  val.Metadata,
+	}, nil
+}
+
+// HandlesTTL reports true, as keys are attached to leases expiring with them
+func (s *etcdStore) HandlesTTL() bool {
+	return true
+}
+
+func (s *etcdStore) Find(id string) (store.Key, error) {
+	var out struct {
+		Kvs []keyValue `json:"kvs"`
+	}
+	if err := s.do("/v3/kv/range", map[string]interface{}{"key": []byte(s.keyPath(id))}, &out); err != nil {
+		return store.Key{}, err
+	}
+	if len(out.Kvs) == 0 {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	return s.decode(out.Kvs[0])
+}
+
+func (s *etcdStore) Delete(id string) error {
+	return s.do("/v3/kv/deleterange", map[string]interface{}{"key": []byte(s.keyPath(id))}, nil)
+}
+
+// prefixEnd returns the end of the range covering all keys with prefix
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
+
+func (s *etcdStore) List() (store.KeyList, error) {
+	var out struct {
+		Kvs []keyValue `json:"kvs"`
+	}
+	prefix := s.keyPath("")
+	err := s.do("/v3/kv/range", map[string]interface{}{
+		"key":       []byte(prefix),
+		"range_end": prefixEnd(prefix),
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	all := make(store.KeyList, 0, len(out.Kvs))
+	for _, kv := range out.Kvs {
+		key, err := s.decode(kv)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+func (s *etcdStore) Lock() error {
+	lease, err := s.grantLease(s.config.LockTTL)
+	if err != nil {
+		return err
+	}
+	ok, err := s.putIfAbsent(s.config.Prefix+lockKey, []byte(s.config.Owner), lease)
+	if err != nil || !ok {
+		s.revokeLease(lease)
+		if err != nil {
+			return err
+		}
+		return store.ErrLockOccupied
+	}
+	s.mu.Lock()
+	s.lockLease = lease
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *etcdStore) LockTTL() time.Duration {
+	return s.config.LockTTL
+}
+
+// RenewLock refreshes the lease the lock key is attached to
+func (s *etcdStore) RenewLock() error {
+	s.mu.Lock()
+	lease := s.lockLease
+	s.mu.Unlock()
+	if lease == 0 {
+		return store.ErrLockLost
+	}
+	var out struct {
+		Result struct {
+			TTL int64 `json:"TTL,string"`
+		} `json:"result"`
+	}
+	if err := s.do("/v3/lease/keepalive", map[string]interface{}{"ID": fmt.Sprint(lease)}, &out); err != nil {
+		return err
+	}
+	// Expired leases are reported with a TTL of zero or less
+	if out.Result.TTL <= 0 {
+		return store.ErrLockLost
+	}
+	return nil
+}
+
+func (s *etcdStore) Unlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockLease == 0 {
+		return nil
+	}
+	// Revoking the lease deletes the lock key attached to it
+	lease := s.lockLease
+	s.lockLease = 0
+	return s.revokeLease(lease)
+}
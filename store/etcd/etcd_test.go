@@ -0,0 +1,302 @@
+package etcd_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/etcd"
+)
+
+type entry struct {
+	value []byte
+	lease string
+}
+
+// fakeEtcd implements the parts of the etcd JSON gateway used by the store
+type fakeEtcd struct {
+	mu        sync.Mutex
+	kvs       map[string]entry
+	nextLease int
+	watchers  map[*watcher]struct{}
+}
+
+type watcher struct {
+	key, rangeEnd string
+	events        chan []byte
+}
+
+// notify sends a change of key to all watchers of a range including it.
+// e.mu must be held.
+func (e *fakeEtcd) notify(eventType, key string) {
+	for w := range e.watchers {
+		if key < w.key || key >= w.rangeEnd {
+			continue
+		}
+		event := map[string]interface{}{"kv": map[string][]byte{"key": []byte(key)}}
+		if eventType != "PUT" {
+			event["type"] = eventType
+		}
+		msg, _ := json.Marshal(map[string]interface{}{
+			"result": map[string]interface{}{"events": []interface{}{event}},
+		})
+		select {
+		case w.events <- msg:
+		default:
+		}
+	}
+}
+
+func (e *fakeEtcd) serveWatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CreateRequest request `json:"create_request"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	watch := &watcher{
+		key:      string(req.CreateRequest.Key),
+		rangeEnd: string(req.CreateRequest.RangeEnd),
+		events:   make(chan []byte, 16),
+	}
+	e.mu.Lock()
+	e.watchers[watch] = struct{}{}
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.watchers, watch)
+		e.mu.Unlock()
+	}()
+
+	w.Write([]byte(`{"result":{"created":true}}` + "\n"))
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case msg := <-watch.events:
+			w.Write(append(msg, '\n'))
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+type request struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end"`
+	ID       string `json:"ID"`
+	Compare  []struct {
+		Key []byte `json:"key"`
+	} `json:"compare"`
+	Success []struct {
+		RequestPut struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+			Lease string `json:"lease"`
+		} `json:"request_put"`
+	} `json:"success"`
+}
+
+func (e *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v3/watch" {
+		e.serveWatch(w, r)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var req request
+	json.NewDecoder(r.Body).Decode(&req)
+	out := map[string]interface{}{}
+
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		e.nextLease++
+		out["ID"] = strconv.Itoa(e.nextLease)
+	case "/v3/lease/revoke":
+		for k, v := range e.kvs {
+			if v.lease == req.ID {
+				delete(e.kvs, k)
+				e.notify("DELETE", k)
+			}
+		}
+	case "/v3/lease/keepalive":
+		// Leases are only kept alive while a key is attached to them
+		result := map[string]interface{}{"ID": req.ID}
+		for _, v := range e.kvs {
+			if v.lease == req.ID {
+				result["TTL"] = "30"
+			}
+		}
+		out["result"] = result
+	case "/v3/kv/txn":
+		if _, exists := e.kvs[string(req.Compare[0].Key)]; !exists {
+			put := req.Success[0].RequestPut
+			e.kvs[string(put.Key)] = entry{value: put.Value, lease: put.Lease}
+			e.notify("PUT", string(put.Key))
+			out["succeeded"] = true
+		}
+	case "/v3/kv/range":
+		var kvs []map[string][]byte
+		for k, v := range e.kvs {
+			if k == string(req.Key) || (req.RangeEnd != nil && k >= string(req.Key) && k < string(req.RangeEnd)) {
+				kvs = append(kvs, map[string][]byte{"key": []byte(k), "value": v.value})
+			}
+		}
+		if len(kvs) > 0 {
+			out["kvs"] = kvs
+		}
+	case "/v3/kv/deleterange":
+		if _, exists := e.kvs[string(req.Key)]; exists {
+			delete(e.kvs, string(req.Key))
+			e.notify("DELETE", string(req.Key))
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func newFakeEtcd() *httptest.Server {
+	return httptest.NewServer(&fakeEtcd{
+		kvs:      make(map[string]entry),
+		watchers: make(map[*watcher]struct{}),
+	})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	server := newFakeEtcd()
+	defer server.Close()
+	s := etcd.New(etcd.Config{Endpoint: server.URL})
+
+	k := store.Key{
+		ID:        "pub:AbCd",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour).Round(0),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != k.ID {
+		t.Errorf("got keys %+v", keys)
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	server := newFakeEtcd()
+	defer server.Close()
+	one := etcd.New(etcd.Config{Endpoint: server.URL, Owner: "one"})
+	two := etcd.New(etcd.Config{Endpoint: server.URL, Owner: "two"})
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := one.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	server := newFakeEtcd()
+	defer server.Close()
+
+	r := ring.New(etcd.New(etcd.Config{Endpoint: server.URL}))
+	defer r.Close()
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers, err := r.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].ID != key.ID {
+		t.Errorf("unexpected verifiers: %v", verifiers)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		server := newFakeEtcd()
+		t.Cleanup(server.Close)
+		return etcd.New(etcd.Config{Endpoint: server.URL})
+	})
+}
+
+func TestWatch(t *testing.T) {
+	server := newFakeEtcd()
+	defer server.Close()
+	s := etcd.New(etcd.Config{Endpoint: server.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := s.(store.Watcher).Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(store.Key{ID: "abc", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("abc"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []store.Event{{Type: store.EventAdded, ID: "abc"}, {Type: store.EventDeleted, ID: "abc"}} {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("got event %+v want %+v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %+v", want)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
@@ -0,0 +1,78 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hsson/ring/store"
+)
+
+// watchResponse is a message streamed by the watch endpoint
+type watchResponse struct {
+	Result struct {
+		Events []struct {
+			Type string   `json:"type"`
+			Kv   keyValue `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Watch streams changes to the keys of the store from etcd
+func (s *etcdStore) Watch(ctx context.Context) (<-chan store.Event, error) {
+	prefix := s.keyPath("")
+	body, err := json.Marshal(map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":       []byte(prefix),
+			"range_end": prefixEnd(prefix),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Endpoint+"/v3/watch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, store.Unavailable(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("hsson/ring/etcd: /v3/watch: status %d", res.StatusCode)
+	}
+
+	events := make(chan store.Event)
+	go func() {
+		defer close(events)
+		defer res.Body.Close()
+		decoder := json.NewDecoder(res.Body)
+		for {
+			var msg watchResponse
+			if err := decoder.Decode(&msg); err != nil || msg.Error != nil {
+				return
+			}
+			for _, e := range msg.Result.Events {
+				event := store.Event{Type: store.EventAdded, ID: strings.TrimPrefix(string(e.Kv.Key), prefix)}
+				// PUT is the zero value, and omitted by the gateway
+				if e.Type == "DELETE" {
+					event.Type = store.EventDeleted
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
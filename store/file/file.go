@@ -0,0 +1,283 @@
+// Package file implements a store which persists keys as PEM files in a
+// directory, allowing single-node services to keep their keys across
+// restarts. The store lock is a lock file in the same directory.
+package file
+
+import (
+	"encoding/base32"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	pemType         = "RING KEY"
+	fileExtension   = ".pem"
+	lockFileName    = "ring.lock"
+	idHeader        = "Id"
+	privateHeader   = "Private"
+	expiresAtHeader = "Expires-At"
+	metadataHeader  = "Metadata"
+
+	defaultLockTimeout = 1 * time.Minute
+)
+
+var nameEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Options customize the file store
+type Options struct {
+	// LockTimeout is how old a lock file can be before it is considered
+	// abandoned by a crashed process and removed. Default: 1 minute
+	LockTimeout time.Duration
+}
+
+// New creates a new store keeping keys in dir, which is created if it does
+// not exist.
+func New(dir string) (store.Store, error) {
+	return NewWithOptions(dir, Options{})
+}
+
+// NewWithOptions creates a new store keeping keys in dir, with custom
+// options
+func NewWithOptions(dir string, options Options) (store.Store, error) {
+	if options.LockTimeout == 0 {
+		options.LockTimeout = defaultLockTimeout
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir, options: options}, nil
+}
+
+type fileStore struct {
+	dir     string
+	options Options
+
+	mu sync.Mutex
+	// lockInfo identifies the lock file created by this store, so it can
+	// tell if the lock was taken over after expiring
+	lockInfo os.FileInfo
+}
+
+func (s *fileStore) path(id string) string {
+	// IDs are encoded as they might contain characters not allowed in
+	// file names, such as ':' on Windows
+	return filepath.Join(s.dir, strings.ToLower(nameEncoding.EncodeToString([]byte(id)))+fileExtension)
+}
+
+func (s *fileStore) Add(key store.Key) error {
+	headers := map[string]string{
+		idHeader:        key.ID,
+		privateHeader:   strconv.FormatBool(key.IsPrivate),
+		expiresAtHeader: key.ExpiresAt.UTC().Format(time.RFC3339Nano),
+	}
+	if len(key.Metadata) != 0 {
+		// Query encoding keeps the header on a single line
+		values := url.Values{}
+		for k, v := range key.Metadata {
+			values.Set(k, v)
+		}
+		headers[metadataHeader] = values.Encode()
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    pemType,
+		Headers: headers,
+		Bytes:   key.Data,
+	})
+
+	// The key is written to a temporary file which is then linked into
+	// place, so other processes never see a partially written key
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Link(tmp.Name(), s.path(key.ID)); err != nil {
+		if os.IsExist(err) {
+			return store.ErrKeyIDConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func readKey(path string) (store.Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return store.Key{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return store.Key{}, fmt.Errorf("hsson/ring/file: %s is not a key file", path)
+	}
+	expiresAt, err := time.Parse(time.RFC3339Nano, block.Headers[expiresAtHeader])
+	if err != nil {
+		return store.Key{}, err
+	}
+	var metadata map[string]string
+	if header, ok := block.Headers[metadataHeader]; ok {
+		values, err := url.ParseQuery(header)
+		if err != nil {
+			return store.Key{}, err
+		}
+		metadata = make(map[string]string, len(values))
+		for k := range values {
+			metadata[k] = values.Get(k)
+		}
+	}
+	return store.Key{
+		ID:        block.Headers[idHeader],
+		IsPrivate: block.Headers[privateHeader] == "true",
+		ExpiresAt: expiresAt,
+		Data:      block.Bytes,
+		Metadata:  metadata,
+	}, nil
+}
+
+func (s *fileStore) Find(id string) (store.Key, error) {
+	key, err := readKey(s.path(id))
+	if os.IsNotExist(err) {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	return key, err
+}
+
+func (s *fileStore) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SecureErase overwrites the file of the key with zeros before removing it.
+// Filesystems which copy on write, journal data or run on flash storage may
+// keep the old contents regardless.
+func (s *fileStore) SecureErase(id string) error {
+	path := s.path(id)
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = f.Write(make([]byte, info.Size()))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return s.Delete(id)
+}
+
+func (s *fileStore) List() (store.KeyList, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+fileExtension))
+	if err != nil {
+		return nil, err
+	}
+	all := make(store.KeyList, 0, len(paths))
+	for _, path := range paths {
+		key, err := readKey(path)
+		if os.IsNotExist(err) {
+			// Deleted since listing the directory
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+func (s *fileStore) Lock() error {
+	path := filepath.Join(s.dir, lockFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < s.options.LockTimeout {
+			return store.ErrLockOccupied
+		}
+		// The holder of the lock is assumed to have crashed
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			return store.ErrLockOccupied
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%d\n", os.Getpid()); err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.lockInfo = info
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *fileStore) LockTTL() time.Duration {
+	return s.options.LockTimeout
+}
+
+// RenewLock updates the modification time of the lock file, so it is not
+// considered abandoned
+func (s *fileStore) RenewLock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, lockFileName)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && (s.lockInfo == nil || !os.SameFile(info, s.lockInfo))) {
+		return store.ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+func (s *fileStore) Unlock() error {
+	s.mu.Lock()
+	s.lockInfo = nil
+	s.mu.Unlock()
+	err := os.Remove(filepath.Join(s.dir, lockFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package file_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/file"
+)
+
+func getStore(t *testing.T, options file.Options) (store.Store, string) {
+	dir, err := ioutil.TempDir("", "ring-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := file.NewWithOptions(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	s, dir := getStore(t, file.Options{})
+	defer os.RemoveAll(dir)
+
+	k := store.Key{
+		ID:        "pub:AbCd",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour).Round(0),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != k.ID {
+		t.Errorf("got keys %+v", keys)
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(k.ID); err != nil {
+		t.Errorf("expected deleting missing key to succeed, got %v", err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestSecureErase(t *testing.T) {
+	s, dir := getStore(t, file.Options{})
+	defer os.RemoveAll(dir)
+
+	k := store.Key{ID: "key", IsPrivate: true, ExpiresAt: time.Now().Add(time.Hour), Data: []byte("secret")}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected a single key file, got %v", err)
+	}
+	// The contents remain readable through an open file after unlinking
+	f, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := s.(store.SecureEraser).SecureErase(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Fatal("expected the key file to keep its size")
+	}
+	for _, b := range data {
+		if b != 0 {
+			t.Fatal("expected the key file to be overwritten")
+		}
+	}
+	if err := s.(store.SecureEraser).SecureErase(k.ID); err != nil {
+		t.Errorf("expected erasing missing key to succeed, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	s, dir := getStore(t, file.Options{LockTimeout: time.Hour})
+	defer os.RemoveAll(dir)
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := s.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestStaleLockIsRemoved(t *testing.T) {
+	s, dir := getStore(t, file.Options{LockTimeout: time.Minute})
+	defer os.RemoveAll(dir)
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "ring.lock"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected stale lock to be taken over, got %v", err)
+	}
+}
+
+func TestKeysSurviveRestart(t *testing.T) {
+	s, dir := getStore(t, file.Options{})
+	defer os.RemoveAll(dir)
+
+	key, err := ring.New(s).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = file.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := ring.New(s).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.ID != key.ID {
+		t.Errorf("got key %v after restart want %v", restarted.ID, key.ID)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	var dirs []string
+	defer func() {
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	}()
+	storetest.Run(t, func() store.Store {
+		s, dir := getStore(t, file.Options{})
+		dirs = append(dirs, dir)
+		return s
+	})
+}
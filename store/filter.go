@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// KeyFilter selects the keys returned by ListFiltered. The zero value
+// matches all keys.
+type KeyFilter struct {
+	// IsPrivate, if not nil, only matches private keys if true, and public
+	// keys if false
+	IsPrivate *bool
+
+	// NotExpiredAt, if not zero, only matches keys which expire after it
+	NotExpiredAt time.Time
+
+	// IDPrefix, if not empty, only matches keys whose ID starts with it
+	IDPrefix string
+}
+
+// Match reports if key is selected by the filter
+func (f KeyFilter) Match(key Key) bool {
+	if f.IsPrivate != nil && key.IsPrivate != *f.IsPrivate {
+		return false
+	}
+	if !f.NotExpiredAt.IsZero() && !key.ExpiresAt.After(f.NotExpiredAt) {
+		return false
+	}
+	return strings.HasPrefix(key.ID, f.IDPrefix)
+}
+
+// Apply returns the keys of kl selected by the filter
+func (f KeyFilter) Apply(kl KeyList) KeyList {
+	var res KeyList
+	for _, key := range kl {
+		if f.Match(key) {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+// FilteredLister is implemented by stores which can select keys themselves,
+// e.g. in a database query, instead of returning every key from List.
+type FilteredLister interface {
+	// ListFiltered returns the stored keys matched by filter
+	ListFiltered(filter KeyFilter) (KeyList, error)
+}
+
+// ContextFilteredLister is the FilteredLister of a ContextStore
+type ContextFilteredLister interface {
+	ListFiltered(ctx context.Context, filter KeyFilter) (KeyList, error)
+}
+
+// ListFiltered returns the keys of s matched by filter. Stores which
+// implement ContextFilteredLister, or adapted Stores which implement
+// FilteredLister, select the keys themselves; for others all keys are
+// iterated and filtered here, see Iterate.
+func ListFiltered(ctx context.Context, s ContextStore, filter KeyFilter) (KeyList, error) {
+	if l, ok := s.(ContextFilteredLister); ok {
+		return l.ListFiltered(ctx, filter)
+	}
+	return iterateFiltered(ctx, s, filter)
+}
+
+func (s withContext) ListFiltered(ctx context.Context, filter KeyFilter) (KeyList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if l, ok := s.store.(FilteredLister); ok {
+		return l.ListFiltered(filter)
+	}
+	return iterateFiltered(ctx, s, filter)
+}
+
+func (s withoutContext) ListFiltered(filter KeyFilter) (KeyList, error) {
+	return ListFiltered(context.Background(), s.store, filter)
+}
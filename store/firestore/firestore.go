@@ -0,0 +1,474 @@
+// Package firestore implements a store on top of Google Cloud Firestore,
+// talking to its REST API. Keys are kept as documents in a collection and
+// created with a commit requiring the document not to exist, so existing
+// keys are never overwritten. The store lock is a lease document in the
+// same collection, taken, renewed and released in transactions, which
+// expires if its holder disappears. A TTL policy on the "expires_at" field
+// can be configured to have Firestore remove expired keys.
+package firestore
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/internal/gcpauth"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	defaultEndpoint      = "https://firestore.googleapis.com"
+	defaultDatabase      = "(default)"
+	defaultCollection    = "ring_keys"
+	defaultLeaseDuration = 30 * time.Second
+	emulatorHostEnv      = "FIRESTORE_EMULATOR_HOST"
+
+	// lockDocumentID can not collide with key documents, whose IDs are
+	// base32 encoded
+	lockDocumentID = "hsson-ring:lock"
+	pageSize       = 300
+)
+
+var nameEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// TokenSource returns the OAuth2 access token used to authenticate
+type TokenSource = gcpauth.TokenSource
+
+// Config configures how the store connects to Firestore
+type Config struct {
+	// Project is the ID of the Google Cloud project
+	Project string
+	// Database is the ID of the Firestore database. Default: (default)
+	Database string
+	// Collection is the ID of the collection keys are kept in.
+	// Default: ring_keys
+	Collection string
+	// Endpoint overrides the Firestore endpoint. Default: the emulator if
+	// the FIRESTORE_EMULATOR_HOST environment variable is set, otherwise
+	// https://firestore.googleapis.com
+	Endpoint string
+	// Token returns the access token used to authenticate. Default: the
+	// token of the default service account, from the metadata server
+	Token TokenSource
+	// Owner identifies this instance as holder of the lock.
+	// Default: the hostname
+	Owner string
+	// LeaseDuration is how long the lock is held before it expires.
+	// Default: 30 seconds
+	LeaseDuration time.Duration
+	// HTTPClient is used to talk to Firestore. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New creates a new store keeping keys in a Firestore collection
+func New(config Config) store.Store {
+	if config.Database == "" {
+		config.Database = defaultDatabase
+	}
+	if config.Collection == "" {
+		config.Collection = defaultCollection
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if emulator := os.Getenv(emulatorHostEnv); emulator != "" && config.Endpoint == "" {
+		config.Endpoint = "http://" + emulator
+		if config.Token == nil {
+			config.Token = gcpauth.StaticTokenSource("owner")
+		}
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = defaultEndpoint
+	}
+	if config.Token == nil {
+		config.Token = gcpauth.MetadataTokenSource(gcpauth.MetadataTokenURL, config.HTTPClient)
+	}
+	if config.Owner == "" {
+		config.Owner, _ = os.Hostname()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+	return &firestoreStore{config: config}
+}
+
+// value is the REST representation of a Firestore value
+type value struct {
+	StringValue    *string    `json:"stringValue,omitempty"`
+	BooleanValue   *bool      `json:"booleanValue,omitempty"`
+	IntegerValue   *string    `json:"integerValue,omitempty"`
+	TimestampValue *time.Time `json:"timestampValue,omitempty"`
+	BytesValue     []byte     `json:"bytesValue,omitempty"`
+	MapValue       *mapValue  `json:"mapValue,omitempty"`
+}
+
+type mapValue struct {
+	Fields map[string]value `json:"fields"`
+}
+
+type document struct {
+	Name   string           `json:"name,omitempty"`
+	Fields map[string]value `json:"fields"`
+}
+
+type precondition struct {
+	Exists *bool `json:"exists,omitempty"`
+}
+
+type write struct {
+	Update          *document     `json:"update,omitempty"`
+	Delete          string        `json:"delete,omitempty"`
+	CurrentDocument *precondition `json:"currentDocument,omitempty"`
+}
+
+func stringValue(s string) value {
+	return value{StringValue: &s}
+}
+
+func boolValue(b bool) value {
+	return value{BooleanValue: &b}
+}
+
+func integerValue(n int64) value {
+	s := strconv.FormatInt(n, 10)
+	return value{IntegerValue: &s}
+}
+
+func timestampValue(t time.Time) value {
+	t = t.UTC()
+	return value{TimestampValue: &t}
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("hsson/ring/firestore: %s: %s", e.Status, e.Message)
+}
+
+func isStatus(err error, status ...string) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, s := range status {
+		if apiErr.Status == s {
+			return true
+		}
+	}
+	return false
+}
+
+type firestoreStore struct {
+	config Config
+}
+
+func (s *firestoreStore) databasePath() string {
+	return fmt.Sprintf("projects/%s/databases/%s/documents", s.config.Project, s.config.Database)
+}
+
+func (s *firestoreStore) documentName(documentID string) string {
+	return s.databasePath() + "/" + s.config.Collection + "/" + documentID
+}
+
+func documentID(id string) string {
+	return strings.ToLower(nameEncoding.EncodeToString([]byte(id)))
+}
+
+// do calls the API at path, relative to the documents of the database
+func (s *firestoreStore) do(method, path string, query url.Values, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	u := s.config.Endpoint + "/v1/" + s.databasePath() + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	token, err := s.config.Token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		var out struct {
+			Error *apiError `json:"error"`
+		}
+		if err := json.Unmarshal(data, &out); err != nil || out.Error == nil {
+			err := fmt.Errorf("hsson/ring/firestore: %s %s: unexpected status %d", method, path, res.StatusCode)
+			if res.StatusCode >= http.StatusInternalServerError {
+				return store.Unavailable(err)
+			}
+			return err
+		}
+		if isStatus(out.Error, "UNAVAILABLE", "DEADLINE_EXCEEDED", "RESOURCE_EXHAUSTED", "INTERNAL") {
+			return store.Unavailable(out.Error)
+		}
+		return out.Error
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// commit applies writes atomically, within transaction if it is not empty
+func (s *firestoreStore) commit(transaction string, writes ...write) error {
+	in := map[string]interface{}{"writes": writes}
+	if transaction != "" {
+		in["transaction"] = transaction
+	}
+	return s.do(http.MethodPost, ":commit", nil, in, nil)
+}
+
+// get fetches a document, within transaction if it is not empty. It returns
+// ring.ErrKeyNotFound if the document does not exist.
+func (s *firestoreStore) get(documentID, transaction string) (document, error) {
+	var query url.Values
+	if transaction != "" {
+		query = url.Values{"transaction": {transaction}}
+	}
+	var doc document
+	err := s.do(http.MethodGet, "/"+s.config.Collection+"/"+documentID, query, nil, &doc)
+	if isStatus(err, "NOT_FOUND") {
+		return document{}, ring.ErrKeyNotFound
+	}
+	return doc, err
+}
+
+func (s *firestoreStore) Add(key store.Key) error {
+	fields := map[string]value{
+		"id":         stringValue(key.ID),
+		"is_private": boolValue(key.IsPrivate),
+		// Timestamps only have microsecond precision, so the exact
+		// expiry is kept separately
+		"expires_at":    timestampValue(key.ExpiresAt),
+		"expires_at_ns": integerValue(key.ExpiresAt.UnixNano()),
+		"data":          {BytesValue: key.Data},
+	}
+	if len(key.Metadata) != 0 {
+		metadata := make(map[string]value, len(key.Metadata))
+		for k, v := range key.Metadata {
+			metadata[k] = stringValue(v)
+		}
+		fields["metadata"] = value{MapValue: &mapValue{Fields: metadata}}
+	}
+	exists := false
+	err := s.commit("", write{
+		Update:          &document{Name: s.documentName(documentID(key.ID)), Fields: fields},
+		CurrentDocument: &precondition{Exists: &exists},
+	})
+	if isStatus(err, "ALREADY_EXISTS", "FAILED_PRECONDITION") {
+		return store.ErrKeyIDConflict
+	}
+	return err
+}
+
+func documentToKey(doc document) (store.Key, error) {
+	id, expiresAtNs := doc.Fields["id"].StringValue, doc.Fields["expires_at_ns"].IntegerValue
+	if id == nil || expiresAtNs == nil {
+		return store.Key{}, errors.New("hsson/ring/firestore: malformed key document")
+	}
+	expiresAt, err := strconv.ParseInt(*expiresAtNs, 10, 64)
+	if err != nil {
+		return store.Key{}, err
+	}
+	var metadata map[string]string
+	if m := doc.Fields["metadata"].MapValue; m != nil {
+		metadata = make(map[string]string, len(m.Fields))
+		for k, v := range m.Fields {
+			if v.StringValue != nil {
+				metadata[k] = *v.StringValue
+			}
+		}
+	}
+	isPrivate := doc.Fields["is_private"].BooleanValue
+	return store.Key{
+		ID:        *id,
+		IsPrivate: isPrivate != nil && *isPrivate,
+		ExpiresAt: time.Unix(0, expiresAt),
+		Data:      doc.Fields["data"].BytesValue,
+		Metadata:  metadata,
+	}, nil
+}
+
+func (s *firestoreStore) Find(id string) (store.Key, error) {
+	doc, err := s.get(documentID(id), "")
+	if err != nil {
+		return store.Key{}, err
+	}
+	return documentToKey(doc)
+}
+
+func (s *firestoreStore) Delete(id string) error {
+	err := s.do(http.MethodDelete, "/"+s.config.Collection+"/"+documentID(id), nil, nil, nil)
+	if isStatus(err, "NOT_FOUND") {
+		return nil
+	}
+	return err
+}
+
+func (s *firestoreStore) List() (store.KeyList, error) {
+	var all store.KeyList
+	query := url.Values{"pageSize": {strconv.Itoa(pageSize)}}
+	for {
+		var out struct {
+			Documents     []document `json:"documents"`
+			NextPageToken string     `json:"nextPageToken"`
+		}
+		if err := s.do(http.MethodGet, "/"+s.config.Collection, query, nil, &out); err != nil {
+			return nil, err
+		}
+		for _, doc := range out.Documents {
+			if doc.Name == s.documentName(lockDocumentID) {
+				continue
+			}
+			key, err := documentToKey(doc)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, key)
+		}
+		if out.NextPageToken == "" {
+			return all, nil
+		}
+		query.Set("pageToken", out.NextPageToken)
+	}
+}
+
+// lease is the content of the lock document
+type lease struct {
+	Owner     string
+	ExpiresAt time.Time
+}
+
+func (s *firestoreStore) leaseWrite(expiresAt time.Time) write {
+	return write{Update: &document{
+		Name: s.documentName(lockDocumentID),
+		Fields: map[string]value{
+			"owner":      stringValue(s.config.Owner),
+			"expires_at": timestampValue(expiresAt),
+		},
+	}}
+}
+
+// updateLease reads the lock document and commits the write returned by
+// update in a transaction. update is passed nil if nobody holds the lock,
+// and may return nil to write nothing. It reports false if the transaction
+// was aborted because another instance changed the lock concurrently.
+func (s *firestoreStore) updateLease(update func(current *lease) (*write, error)) (bool, error) {
+	var tx struct {
+		Transaction string `json:"transaction"`
+	}
+	if err := s.do(http.MethodPost, ":beginTransaction", nil, map[string]interface{}{}, &tx); err != nil {
+		return false, err
+	}
+	w, err := s.readLease(tx.Transaction, update)
+	if err != nil || w == nil {
+		_ = s.do(http.MethodPost, ":rollback", nil, map[string]string{"transaction": tx.Transaction}, nil)
+		return true, err
+	}
+	err = s.commit(tx.Transaction, *w)
+	if isStatus(err, "ABORTED") {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *firestoreStore) readLease(transaction string, update func(current *lease) (*write, error)) (*write, error) {
+	doc, err := s.get(lockDocumentID, transaction)
+	if errors.Is(err, ring.ErrKeyNotFound) {
+		return update(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	current := &lease{}
+	if owner := doc.Fields["owner"].StringValue; owner != nil {
+		current.Owner = *owner
+	}
+	if expiresAt := doc.Fields["expires_at"].TimestampValue; expiresAt != nil {
+		current.ExpiresAt = *expiresAt
+	}
+	return update(current)
+}
+
+func (s *firestoreStore) Lock() error {
+	now := time.Now()
+	ok, err := s.updateLease(func(current *lease) (*write, error) {
+		// The lock can be taken if nobody holds it, or if the lease of
+		// the current holder has run out
+		if current != nil && now.Before(current.ExpiresAt) {
+			return nil, store.ErrLockOccupied
+		}
+		w := s.leaseWrite(now.Add(s.config.LeaseDuration))
+		return &w, nil
+	})
+	if err == nil && !ok {
+		return store.ErrLockOccupied
+	}
+	return err
+}
+
+func (s *firestoreStore) LockTTL() time.Duration {
+	return s.config.LeaseDuration
+}
+
+// RenewLock extends the lease, as long as it is still held by this instance
+func (s *firestoreStore) RenewLock() error {
+	now := time.Now()
+	ok, err := s.updateLease(func(current *lease) (*write, error) {
+		if current == nil || current.Owner != s.config.Owner || !now.Before(current.ExpiresAt) {
+			return nil, store.ErrLockLost
+		}
+		w := s.leaseWrite(now.Add(s.config.LeaseDuration))
+		return &w, nil
+	})
+	if err == nil && !ok {
+		return store.ErrLockLost
+	}
+	return err
+}
+
+func (s *firestoreStore) Unlock() error {
+	// If the lease expired and was taken over by another instance, there
+	// is nothing to release
+	_, err := s.updateLease(func(current *lease) (*write, error) {
+		if current == nil || current.Owner != s.config.Owner {
+			return nil, nil
+		}
+		return &write{Delete: s.documentName(lockDocumentID)}, nil
+	})
+	return err
+}
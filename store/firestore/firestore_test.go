@@ -0,0 +1,311 @@
+package firestore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/firestore"
+)
+
+const (
+	testToken = "token"
+	pageSize  = 2
+)
+
+type storedDocument struct {
+	doc     map[string]interface{}
+	version int
+}
+
+// fakeFirestore implements the document operations, preconditions and
+// optimistic transactions used by the store.
+type fakeFirestore struct {
+	mu        sync.Mutex
+	documents map[string]storedDocument
+	// transactions holds the versions of the documents read in each
+	// transaction, 0 meaning the document did not exist
+	transactions map[string]map[string]int
+	versions     int
+	nextTx       int
+	lists        int
+}
+
+type commitRequest struct {
+	Transaction string `json:"transaction"`
+	Writes      []struct {
+		Update          map[string]interface{} `json:"update"`
+		Delete          string                 `json:"delete"`
+		CurrentDocument *struct {
+			Exists *bool `json:"exists"`
+		} `json:"currentDocument"`
+	} `json:"writes"`
+}
+
+func writeError(w http.ResponseWriter, code int, status string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": status, "status": status},
+	})
+}
+
+func (db *fakeFirestore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		writeError(w, http.StatusUnauthorized, "UNAUTHENTICATED")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case strings.HasSuffix(path, ":beginTransaction"):
+		db.nextTx++
+		tx := fmt.Sprintf("tx-%d", db.nextTx)
+		db.transactions[tx] = make(map[string]int)
+		json.NewEncoder(w).Encode(map[string]string{"transaction": tx})
+	case strings.HasSuffix(path, ":rollback"):
+		var req commitRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		delete(db.transactions, req.Transaction)
+		w.Write([]byte("{}"))
+	case strings.HasSuffix(path, ":commit"):
+		db.commit(w, r)
+	case r.Method == http.MethodGet && strings.Count(path, "/") == 5:
+		db.list(w, r, path)
+	case r.Method == http.MethodGet:
+		stored, ok := db.documents[path]
+		if tx := r.URL.Query().Get("transaction"); tx != "" {
+			db.transactions[tx][path] = stored.version
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND")
+			return
+		}
+		json.NewEncoder(w).Encode(stored.doc)
+	case r.Method == http.MethodDelete:
+		delete(db.documents, path)
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (db *fakeFirestore) commit(w http.ResponseWriter, r *http.Request) {
+	var req commitRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.Transaction != "" {
+		reads, ok := db.transactions[req.Transaction]
+		delete(db.transactions, req.Transaction)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT")
+			return
+		}
+		for name, version := range reads {
+			if db.documents[name].version != version {
+				writeError(w, http.StatusConflict, "ABORTED")
+				return
+			}
+		}
+	}
+	for _, write := range req.Writes {
+		if write.CurrentDocument != nil && write.CurrentDocument.Exists != nil {
+			name, _ := write.Update["name"].(string)
+			if _, exists := db.documents[name]; exists != *write.CurrentDocument.Exists {
+				writeError(w, http.StatusConflict, "ALREADY_EXISTS")
+				return
+			}
+		}
+	}
+	for _, write := range req.Writes {
+		if write.Delete != "" {
+			delete(db.documents, write.Delete)
+			continue
+		}
+		db.versions++
+		db.documents[write.Update["name"].(string)] = storedDocument{doc: write.Update, version: db.versions}
+	}
+	w.Write([]byte("{}"))
+}
+
+func (db *fakeFirestore) list(w http.ResponseWriter, r *http.Request, collection string) {
+	db.lists++
+	var names []string
+	for name := range db.documents {
+		if strings.HasPrefix(name, collection+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	out := map[string]interface{}{}
+	var docs []interface{}
+	for i := start; i < len(names) && i < start+pageSize; i++ {
+		docs = append(docs, db.documents[names[i]].doc)
+	}
+	out["documents"] = docs
+	if start+pageSize < len(names) {
+		out["nextPageToken"] = strconv.Itoa(start + pageSize)
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func newFakeFirestore() (*fakeFirestore, *httptest.Server) {
+	db := &fakeFirestore{
+		documents:    make(map[string]storedDocument),
+		transactions: make(map[string]map[string]int),
+	}
+	return db, httptest.NewServer(db)
+}
+
+func getStore(endpoint, owner string, leaseDuration time.Duration) store.Store {
+	return firestore.New(firestore.Config{
+		Project:       "project",
+		Endpoint:      endpoint,
+		Token:         func() (string, error) { return testToken, nil },
+		Owner:         owner,
+		LeaseDuration: leaseDuration,
+	})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	db, server := newFakeFirestore()
+	defer server.Close()
+	s := getStore(server.URL, "one", time.Minute)
+
+	k := store.Key{
+		ID:        "ns/pub:AbCd",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	// The lock document is not listed, and more keys than fit on a page
+	// are listed page by page
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"pub:1", "pub:2"} {
+		if err := s.Add(store.Key{ID: id, ExpiresAt: k.ExpiresAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Errorf("expected 3 keys, got %d", len(list))
+	}
+	if db.lists != 2 {
+		t.Errorf("expected 2 pages, got %d", db.lists)
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); err == nil {
+		t.Error("expected deleted key to be gone")
+	}
+}
+
+func TestLeaseLock(t *testing.T) {
+	_, server := newFakeFirestore()
+	defer server.Close()
+	one := getStore(server.URL, "one", time.Minute)
+	two := getStore(server.URL, "two", time.Minute)
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := two.(store.Locker).Unlock(); err != nil {
+		t.Errorf("expected unlocking a lock held by another owner to be a no-op, got %v", err)
+	}
+	if err := one.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	_, server := newFakeFirestore()
+	defer server.Close()
+	crashed := getStore(server.URL, "crashed", time.Millisecond)
+	other := getStore(server.URL, "other", time.Minute)
+
+	if err := crashed.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := other.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected expired lease to be taken over, got %v", err)
+	}
+	renewer, _ := store.AsLockRenewer(store.WithContext(crashed))
+	if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+}
+
+func TestConcurrentLock(t *testing.T) {
+	_, server := newFakeFirestore()
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acquired := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := getStore(server.URL, fmt.Sprint(i), time.Minute).(store.Locker).Lock()
+			if err == nil {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			} else if !errors.Is(err, store.ErrLockOccupied) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if acquired != 1 {
+		t.Errorf("expected exactly one instance to get the lock, got %d", acquired)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		_, server := newFakeFirestore()
+		t.Cleanup(server.Close)
+		return getStore(server.URL, "one", time.Minute)
+	})
+}
@@ -0,0 +1,158 @@
+package inmem
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// ErrInjected is returned by a ChaosStore for injected failures, wrapped
+// like the errors of a store which can't be reached, see
+// store.ErrUnavailable
+var ErrInjected = errors.New("hsson/ring/inmem: injected failure")
+
+// ChaosOptions configure the failures injected by a ChaosStore. Rates are
+// probabilities between 0 and 1, evaluated for every operation.
+type ChaosOptions struct {
+	// Latency delays every operation. Default: 0
+	Latency time.Duration
+	// Jitter adds a random delay of up to Jitter to Latency. Default: 0
+	Jitter time.Duration
+	// ErrorRate is the rate of operations failing with ErrInjected
+	ErrorRate float64
+	// LockContentionRate is the rate of Lock calls failing with
+	// store.ErrLockOccupied, as if another instance held the lock
+	LockContentionRate float64
+	// LostUpdateRate is the rate of Add and Delete calls reporting success
+	// without changing the store
+	LostUpdateRate float64
+	// Seed seeds the choice of failures, so a test run can be reproduced
+	Seed int64
+	// Store customizes the wrapped in-memory store
+	Store Options
+}
+
+// ChaosStore is an in-memory store which misbehaves on purpose, e.g. to
+// test how a service copes with a slow or flaky store. Failures can be
+// changed during a test with SetOptions.
+type ChaosStore struct {
+	store.Store
+
+	mu       sync.Mutex
+	options  ChaosOptions
+	rand     *rand.Rand
+	injected int
+}
+
+// NewChaosStore creates an empty in-memory store injecting the failures of
+// options
+func NewChaosStore(options ChaosOptions) *ChaosStore {
+	return &ChaosStore{
+		Store:   NewInMemoryStoreWithOptions(options.Store),
+		options: options,
+		rand:    rand.New(rand.NewSource(options.Seed)),
+	}
+}
+
+// SetOptions replaces the failures injected from now on. The seed and the
+// options of the wrapped store are left unchanged.
+func (s *ChaosStore) SetOptions(options ChaosOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options = options
+}
+
+// Injected returns the number of failures injected so far, not counting
+// latency
+func (s *ChaosStore) Injected() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.injected
+}
+
+// roll delays an operation, and returns ErrInjected or reports whether the
+// failure specific to the operation, with the rate selected from the
+// options, is injected
+func (s *ChaosStore) roll(rate func(ChaosOptions) float64) (fail bool, err error) {
+	s.mu.Lock()
+	delay := s.options.Latency
+	if s.options.Jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(s.options.Jitter)))
+	}
+	switch {
+	case s.rand.Float64() < s.options.ErrorRate:
+		err = store.Unavailable(ErrInjected)
+	case rate != nil && s.rand.Float64() < rate(s.options):
+		fail = true
+	}
+	if err != nil || fail {
+		s.injected++
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return fail, err
+}
+
+func lostUpdateRate(o ChaosOptions) float64 {
+	return o.LostUpdateRate
+}
+
+// Add implements store.Store
+func (s *ChaosStore) Add(key store.Key) error {
+	lost, err := s.roll(lostUpdateRate)
+	if err != nil || lost {
+		return err
+	}
+	return s.Store.Add(key)
+}
+
+// Find implements store.Store
+func (s *ChaosStore) Find(id string) (store.Key, error) {
+	if _, err := s.roll(nil); err != nil {
+		return store.Key{}, err
+	}
+	return s.Store.Find(id)
+}
+
+// Delete implements store.Store
+func (s *ChaosStore) Delete(id string) error {
+	lost, err := s.roll(lostUpdateRate)
+	if err != nil || lost {
+		return err
+	}
+	return s.Store.Delete(id)
+}
+
+// List implements store.Store
+func (s *ChaosStore) List() (store.KeyList, error) {
+	if _, err := s.roll(nil); err != nil {
+		return nil, err
+	}
+	return s.Store.List()
+}
+
+// Lock implements store.Locker
+func (s *ChaosStore) Lock() error {
+	contended, err := s.roll(func(o ChaosOptions) float64 { return o.LockContentionRate })
+	if err != nil {
+		return err
+	}
+	if contended {
+		return store.ErrLockOccupied
+	}
+	return store.AsLocker(s.Store).Lock()
+}
+
+// Unlock implements store.Locker
+func (s *ChaosStore) Unlock() error {
+	if _, err := s.roll(nil); err != nil {
+		return err
+	}
+	return store.AsLocker(s.Store).Unlock()
+}
@@ -1,6 +1,7 @@
 package inmem
 
 import (
+	"errors"
 	"sync"
 	"time"
 
@@ -8,21 +9,54 @@ import (
 	"github.com/hsson/ring/store"
 )
 
+const defaultLockTimeout = 1 * time.Minute
+
+// ErrClosed is returned by Watch after the store has been closed
+var ErrClosed = errors.New("hsson/ring/inmem: store closed")
+
+// Options customize the in-memory store
+type Options struct {
+	// LockTimeout is how long the lock is held before it expires, unless
+	// it is unlocked or renewed. Default: 1 minute
+	LockTimeout time.Duration
+
+	// Clock is used to expire the lock. Default: the system clock
+	Clock ring.Clock
+}
+
 // NewInMemoryStore creates a new in-memory storage
-// container which can be used with the ring keychain.
+// container which can be used with the ring keychain. The store implements
+// io.Closer, to end all watches of it.
 func NewInMemoryStore() store.Store {
-	store := &inmemStore{
-		data: make(map[string]store.Key),
+	return NewInMemoryStoreWithOptions(Options{})
+}
+
+// NewInMemoryStoreWithOptions creates a new in-memory store with custom
+// options
+func NewInMemoryStoreWithOptions(options Options) store.Store {
+	if options.LockTimeout == 0 {
+		options.LockTimeout = defaultLockTimeout
+	}
+	return &inmemStore{
+		data:    make(map[string]store.Key),
+		options: options,
+		closed:  make(chan struct{}),
 	}
-	ticker := time.NewTicker(5 * time.Minute)
-	go checkForTTL(ticker, store)
-	return store
 }
 
 type inmemStore struct {
-	sync.RWMutex
+	mu sync.RWMutex
+
+	options Options
 
 	data map[string]store.Key
+	// lockExpiresAt is zero while the store is unlocked
+	lockExpiresAt time.Time
+
+	watchers map[chan store.Event]struct{}
+	// closed is closed by Close, ending all watches
+	closed  chan struct{}
+	watches sync.WaitGroup
 }
 
 func (s *inmemStore) copy(key store.Key) store.Key {
@@ -31,22 +65,35 @@ func (s *inmemStore) copy(key store.Key) store.Key {
 		IsPrivate: key.IsPrivate,
 		ExpiresAt: key.ExpiresAt,
 		Data:      key.Data,
+		Metadata:  copyMetadata(key.Metadata),
 	}
 }
 
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	c := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		c[k] = v
+	}
+	return c
+}
+
 func (s *inmemStore) Add(key store.Key) error {
-	s.Lock()
-	defer s.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if _, exists := s.data[key.ID]; exists {
 		return store.ErrKeyIDConflict
 	}
 	s.data[key.ID] = s.copy(key)
+	s.notify(store.Event{Type: store.EventAdded, ID: key.ID})
 	return nil
 }
 
 func (s *inmemStore) Find(id string) (store.Key, error) {
-	s.RLock()
-	defer s.RUnlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	key, exists := s.data[id]
 	if !exists {
@@ -56,15 +103,18 @@ func (s *inmemStore) Find(id string) (store.Key, error) {
 }
 
 func (s *inmemStore) Delete(id string) error {
-	s.Lock()
-	defer s.Unlock()
-	delete(s.data, id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.data[id]; exists {
+		delete(s.data, id)
+		s.notify(store.Event{Type: store.EventDeleted, ID: id})
+	}
 	return nil
 }
 
 func (s *inmemStore) List() (store.KeyList, error) {
-	s.RLock()
-	defer s.RUnlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	all := make(store.KeyList, len(s.data))
 	i := 0
 	for _, k := range s.data {
@@ -73,3 +123,96 @@ func (s *inmemStore) List() (store.KeyList, error) {
 	}
 	return all, nil
 }
+
+// Iterate holds the read lock of the store while calling yield
+func (s *inmemStore) Iterate(yield func(store.Key) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.data {
+		if !yield(s.copy(k)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *inmemStore) FindMany(ids []string) (store.KeyList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res store.KeyList
+	for _, id := range ids {
+		if key, exists := s.data[id]; exists {
+			res = append(res, s.copy(key))
+		}
+	}
+	return res, nil
+}
+
+func (s *inmemStore) ListFiltered(filter store.KeyFilter) (store.KeyList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res store.KeyList
+	for _, k := range s.data {
+		if filter.Match(k) {
+			res = append(res, s.copy(k))
+		}
+	}
+	return res, nil
+}
+
+func (s *inmemStore) Stats() (store.Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var stats store.Stats
+	for _, k := range s.data {
+		stats.Add(k)
+	}
+	return stats, nil
+}
+
+func (s *inmemStore) now() time.Time {
+	if s.options.Clock != nil {
+		return s.options.Clock.Now()
+	}
+	return time.Now()
+}
+
+// locked reports if the lock is held and has not expired. s.mu must be held.
+func (s *inmemStore) locked(now time.Time) bool {
+	return !s.lockExpiresAt.IsZero() && now.Before(s.lockExpiresAt)
+}
+
+func (s *inmemStore) Lock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.locked(now) {
+		return store.ErrLockOccupied
+	}
+	s.lockExpiresAt = now.Add(s.options.LockTimeout)
+	return nil
+}
+
+func (s *inmemStore) LockTTL() time.Duration {
+	return s.options.LockTimeout
+}
+
+// RenewLock extends the lock, unless it has already expired. As the store
+// does not know who is holding the lock, it is renewed for any caller.
+func (s *inmemStore) RenewLock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !s.locked(now) {
+		return store.ErrLockLost
+	}
+	s.lockExpiresAt = now.Add(s.options.LockTimeout)
+	return nil
+}
+
+func (s *inmemStore) Unlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockExpiresAt = time.Time{}
+	return nil
+}
@@ -1,13 +1,17 @@
 package inmem_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"testing"
 	"time"
 
 	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/sim"
 	"github.com/hsson/ring/store"
 	"github.com/hsson/ring/store/inmem"
 )
@@ -159,3 +163,140 @@ func TestListKeys(t *testing.T) {
 		t.Errorf("did not find key 3 in list")
 	}
 }
+
+func TestLock(t *testing.T) {
+	s := getStore()
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := s.(store.Locker).Lock()
+	if !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+
+	if err := s.(store.Locker).Unlock(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStoreWithOptions(inmem.Options{LockTimeout: time.Minute, Clock: clock})
+	renewer := s.(store.LockRenewer)
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(50 * time.Second)
+	if err := renewer.RenewLock(); err != nil {
+		t.Fatalf("expected lock to be renewed, got %v", err)
+	}
+	clock.Advance(50 * time.Second)
+	if err := s.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected renewed lock to be held, got %v", err)
+	}
+
+	// The holder crashes without unlocking
+	clock.Advance(time.Minute)
+	if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+		t.Errorf("expected ErrLockLost after expiry, got %v", err)
+	}
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected expired lock to be taken over, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	s := getStore()
+	events, err := s.(store.Watcher).Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-events; ok {
+		t.Error("expected watch to end when the store is closed")
+	}
+	if _, err := s.(store.Watcher).Watch(context.Background()); !errors.Is(err, inmem.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if err := s.(io.Closer).Close(); err != nil {
+		t.Errorf("expected closing twice to succeed, got %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, getStore)
+}
+
+func TestChaosStore(t *testing.T) {
+	s := inmem.NewChaosStore(inmem.ChaosOptions{ErrorRate: 1})
+	if err := s.Add(dummyKey()); !errors.Is(err, inmem.ErrInjected) || !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("expected injected unavailable error, got %v", err)
+	}
+
+	s.SetOptions(inmem.ChaosOptions{LostUpdateRate: 1, LockContentionRate: 1})
+	k := dummyKey()
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected update to be lost, got %v", err)
+	}
+	if err := s.Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected lock contention, got %v", err)
+	}
+	if n := s.Injected(); n != 3 {
+		t.Errorf("expected 3 injected failures, got %d", n)
+	}
+
+	s.SetOptions(inmem.ChaosOptions{Latency: 20 * time.Millisecond})
+	start := time.Now()
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected latency to be injected, took %v", elapsed)
+	}
+	if _, err := s.Find(k.ID); err != nil {
+		t.Errorf("expected key to be added, got %v", err)
+	}
+}
+
+func TestChaosStoreKeychain(t *testing.T) {
+	// Keychains must get by with a store failing now and then
+	s := inmem.NewChaosStore(inmem.ChaosOptions{ErrorRate: 0.2, LockContentionRate: 0.2, Seed: 42})
+	keychain, err := ring.NewKeychain(s, ring.Options{
+		Algorithm:           ring.Ed25519,
+		LockRetryPolicy:     ring.LockRetryPolicy{Attempts: 10, Backoff: time.Millisecond},
+		DeferInitialization: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keychain.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := keychain.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		signature, keyID, err := keychain.Sign([]byte("data"))
+		if err != nil {
+			continue
+		}
+		if err := keychain.Verify(keyID, []byte("data"), signature); err != nil && !errors.Is(err, store.ErrUnavailable) {
+			t.Errorf("unexpected verification error %v", err)
+		}
+	}
+	if s.Injected() == 0 {
+		t.Error("expected failures to be injected")
+	}
+}
@@ -0,0 +1,66 @@
+package inmem
+
+import (
+	"context"
+
+	"github.com/hsson/ring/store"
+)
+
+// watchBuffer is how many events are buffered for each watcher before
+// further events are dropped
+const watchBuffer = 64
+
+func (s *inmemStore) Watch(ctx context.Context) (<-chan store.Event, error) {
+	events := make(chan store.Event, watchBuffer)
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return nil, ErrClosed
+	default:
+	}
+	if s.watchers == nil {
+		s.watchers = make(map[chan store.Event]struct{})
+	}
+	s.watchers[events] = struct{}{}
+	s.watches.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.watches.Done()
+		select {
+		case <-ctx.Done():
+		case <-s.closed:
+		}
+		s.mu.Lock()
+		delete(s.watchers, events)
+		close(events)
+		s.mu.Unlock()
+	}()
+	return events, nil
+}
+
+// Close ends all watches of the store and waits for them to stop. The keys
+// are kept, so the store can still be used, but can no longer be watched.
+func (s *inmemStore) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+	s.mu.Unlock()
+	s.watches.Wait()
+	return nil
+}
+
+// notify sends event to all watchers. s.mu must be held.
+func (s *inmemStore) notify(event store.Event) {
+	for events := range s.watchers {
+		select {
+		case events <- event:
+		default:
+			// Slow watchers miss events rather than blocking the store
+		}
+	}
+}
@@ -0,0 +1,26 @@
+//go:build go1.23
+// +build go1.23
+
+package store
+
+import (
+	"context"
+	"iter"
+)
+
+// All returns an iterator over the keys of s, see Iterate. An error ends
+// the iteration, and is yielded with a zero Key.
+func All(ctx context.Context, s ContextStore) iter.Seq2[Key, error] {
+	return func(yield func(Key, error) bool) {
+		stopped := false
+		err := Iterate(ctx, s, func(key Key) bool {
+			if !yield(key, nil) {
+				stopped = true
+			}
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(Key{}, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build go1.23
+// +build go1.23
+
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
+)
+
+func TestAll(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	for _, id := range []string{"a", "b"} {
+		if err := s.Add(store.Key{ID: id, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := 0
+	for key, err := range store.All(context.Background(), store.WithContext(s)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.ID != "a" && key.ID != "b" {
+			t.Errorf("unexpected key %v", key.ID)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected 2 keys, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range store.All(ctx, store.WithContext(s)) {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	}
+}
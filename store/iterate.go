@@ -0,0 +1,74 @@
+package store
+
+import "context"
+
+// Iterator is implemented by stores which can stream their keys, e.g. from a
+// database cursor, instead of returning all of them at once from List.
+type Iterator interface {
+	// Iterate calls yield for each stored key, until yield returns false.
+	// yield must not modify the store.
+	Iterate(yield func(Key) bool) error
+}
+
+// ContextIterator is the Iterator of a ContextStore
+type ContextIterator interface {
+	Iterate(ctx context.Context, yield func(Key) bool) error
+}
+
+// Iterate calls yield for each key of s, until yield returns false. Stores
+// which implement ContextIterator, or adapted Stores which implement
+// Iterator, stream the keys; for others all keys are listed first.
+func Iterate(ctx context.Context, s ContextStore, yield func(Key) bool) error {
+	if it, ok := s.(ContextIterator); ok {
+		return it.Iterate(ctx, yield)
+	}
+	keys, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	yieldAll(keys, yield)
+	return nil
+}
+
+func yieldAll(keys KeyList, yield func(Key) bool) {
+	for _, key := range keys {
+		if !yield(key) {
+			return
+		}
+	}
+}
+
+// iterateFiltered returns the keys matched by filter, without listing the
+// keys which are not
+func iterateFiltered(ctx context.Context, s ContextStore, filter KeyFilter) (KeyList, error) {
+	var res KeyList
+	err := Iterate(ctx, s, func(key Key) bool {
+		if filter.Match(key) {
+			res = append(res, key)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s withContext) Iterate(ctx context.Context, yield func(Key) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if it, ok := s.store.(Iterator); ok {
+		return it.Iterate(yield)
+	}
+	keys, err := s.store.List()
+	if err != nil {
+		return err
+	}
+	yieldAll(keys, yield)
+	return nil
+}
+
+func (s withoutContext) Iterate(yield func(Key) bool) error {
+	return Iterate(context.Background(), s.store, yield)
+}
@@ -0,0 +1,474 @@
+// Package kubernetes implements a store which persists keys as Kubernetes
+// Secrets, one Secret per key, and uses a Lease object as the store lock.
+// This allows replicas in a cluster to share keys without any external
+// database. The service account used needs permission to create, get, list
+// and delete secrets, and to create, get and update leases.
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	managedByLabel      = "app.kubernetes.io/managed-by"
+	managedByValue      = "hsson-ring"
+	nameLabel           = "ring.hsson.se/name"
+	idAnnotation        = "ring.hsson.se/id"
+	privateAnnotation   = "ring.hsson.se/private"
+	expiresAtAnnotation = "ring.hsson.se/expires-at"
+	metadataAnnotation  = "ring.hsson.se/metadata"
+	secretDataKey       = "key"
+
+	// microTimeFormat is the format of metav1.MicroTime used by leases
+	microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+	defaultName          = "ring"
+	defaultLeaseDuration = 30 * time.Second
+)
+
+var nameEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Config configures how the store connects to the Kubernetes API server
+type Config struct {
+	// Host is the base URL of the API server, e.g. https://10.0.0.1:443
+	Host string
+	// Token is the bearer token used for authentication
+	Token string
+	// TokenFile is read for a bearer token on every request, which allows
+	// rotated service account tokens to be picked up. Takes precedence
+	// over Token.
+	TokenFile string
+	// Namespace in which secrets and the lease are kept
+	Namespace string
+	// Name is used to label secrets and name the lease, so that several
+	// keychains can share a namespace. Default: ring
+	Name string
+	// Identity identifies this instance as holder of the lease.
+	// Default: the hostname
+	Identity string
+	// LeaseDuration is how long the lock is held before it expires.
+	// Default: 30 seconds
+	LeaseDuration time.Duration
+	// HTTPClient is used to talk to the API server.
+	// Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// InClusterConfig creates a config for use from within a pod, using the
+// mounted service account for authentication.
+func InClusterConfig() (Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return Config{}, errors.New("hsson/ring/kubernetes: not running in a cluster")
+	}
+	namespace, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return Config{}, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return Config{}, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return Config{}, errors.New("hsson/ring/kubernetes: invalid cluster CA certificate")
+	}
+	return Config{
+		Host:      "https://" + net.JoinHostPort(host, port),
+		TokenFile: serviceAccountDir + "/token",
+		Namespace: strings.TrimSpace(string(namespace)),
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// New creates a new store persisting keys as Kubernetes Secrets
+func New(config Config) store.Store {
+	if config.Name == "" {
+		config.Name = defaultName
+	}
+	if config.Identity == "" {
+		config.Identity, _ = os.Hostname()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	config.Host = strings.TrimSuffix(config.Host, "/")
+	return &kubeStore{config: config}
+}
+
+type objectMeta struct {
+	Name            string            `json:"name"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+}
+
+type secret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   objectMeta        `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data"`
+}
+
+type secretList struct {
+	Items []secret `json:"items"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+type lease struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       leaseSpec  `json:"spec"`
+}
+
+type kubeStore struct {
+	config Config
+}
+
+func (s *kubeStore) secretsPath() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets", s.config.Namespace)
+}
+
+func (s *kubeStore) leasesPath() string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", s.config.Namespace)
+}
+
+func (s *kubeStore) secretName(id string) string {
+	return fmt.Sprintf("%s-%s", s.config.Name, strings.ToLower(nameEncoding.EncodeToString([]byte(id))))
+}
+
+func (s *kubeStore) token() (string, error) {
+	if s.config.TokenFile == "" {
+		return s.config.Token, nil
+	}
+	token, err := ioutil.ReadFile(s.config.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// do sends a request to the API server. The response body is decoded into
+// out if the request was successful, while any other status is left for
+// the caller to handle.
+func (s *kubeStore) do(method, path string, in, out interface{}) (int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, s.config.Host+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token, err := s.token()
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return 0, store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 && out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			return res.StatusCode, err
+		}
+	}
+	return res.StatusCode, nil
+}
+
+func unexpectedStatus(method, path string, status int) error {
+	err := fmt.Errorf("hsson/ring/kubernetes: %s %s: unexpected status %d", method, path, status)
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		return store.Unavailable(err)
+	}
+	return err
+}
+
+func (s *kubeStore) Add(key store.Key) error {
+	private := strconv.FormatBool(key.IsPrivate)
+	obj := secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: objectMeta{
+			Name: s.secretName(key.ID),
+			Labels: map[string]string{
+				managedByLabel: managedByValue,
+				nameLabel:      s.config.Name,
+			},
+			Annotations: map[string]string{
+				idAnnotation:        key.ID,
+				privateAnnotation:   private,
+				expiresAtAnnotation: key.ExpiresAt.UTC().Format(time.RFC3339Nano),
+			},
+		},
+		Type: "Opaque",
+		Data: map[string][]byte{secretDataKey: key.Data},
+	}
+	if len(key.Metadata) != 0 {
+		metadata, err := json.Marshal(key.Metadata)
+		if err != nil {
+			return err
+		}
+		obj.Metadata.Annotations[metadataAnnotation] = string(metadata)
+	}
+	status, err := s.do(http.MethodPost, s.secretsPath(), obj, nil)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusCreated, http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return store.ErrKeyIDConflict
+	default:
+		return unexpectedStatus(http.MethodPost, s.secretsPath(), status)
+	}
+}
+
+func secretToKey(obj secret) (store.Key, error) {
+	expiresAt, err := time.Parse(time.RFC3339Nano, obj.Metadata.Annotations[expiresAtAnnotation])
+	if err != nil {
+		return store.Key{}, err
+	}
+	var metadata map[string]string
+	if annotation, ok := obj.Metadata.Annotations[metadataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(annotation), &metadata); err != nil {
+			return store.Key{}, err
+		}
+	}
+	return store.Key{
+		ID:        obj.Metadata.Annotations[idAnnotation],
+		IsPrivate: obj.Metadata.Annotations[privateAnnotation] == "true",
+		ExpiresAt: expiresAt,
+		Data:      obj.Data[secretDataKey],
+		Metadata:  metadata,
+	}, nil
+}
+
+func (s *kubeStore) Find(id string) (store.Key, error) {
+	path := s.secretsPath() + "/" + s.secretName(id)
+	var obj secret
+	status, err := s.do(http.MethodGet, path, nil, &obj)
+	if err != nil {
+		return store.Key{}, err
+	}
+	switch status {
+	case http.StatusOK:
+		return secretToKey(obj)
+	case http.StatusNotFound:
+		return store.Key{}, ring.ErrKeyNotFound
+	default:
+		return store.Key{}, unexpectedStatus(http.MethodGet, path, status)
+	}
+}
+
+func (s *kubeStore) Delete(id string) error {
+	path := s.secretsPath() + "/" + s.secretName(id)
+	status, err := s.do(http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK, http.StatusAccepted, http.StatusNotFound:
+		return nil
+	default:
+		return unexpectedStatus(http.MethodDelete, path, status)
+	}
+}
+
+func (s *kubeStore) List() (store.KeyList, error) {
+	selector := fmt.Sprintf("%s=%s,%s=%s", managedByLabel, managedByValue, nameLabel, s.config.Name)
+	path := s.secretsPath() + "?labelSelector=" + url.QueryEscape(selector)
+	var list secretList
+	status, err := s.do(http.MethodGet, path, nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, unexpectedStatus(http.MethodGet, path, status)
+	}
+	all := make(store.KeyList, 0, len(list.Items))
+	for _, obj := range list.Items {
+		key, err := secretToKey(obj)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+func (s *kubeStore) Lock() error {
+	path := s.leasesPath() + "/" + s.config.Name
+	var l lease
+	status, err := s.do(http.MethodGet, path, nil, &l)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	method := http.MethodPut
+	switch status {
+	case http.StatusOK:
+		held, err := l.held(now)
+		if err != nil {
+			return err
+		}
+		if held {
+			return store.ErrLockOccupied
+		}
+	case http.StatusNotFound:
+		method, path = http.MethodPost, s.leasesPath()
+		l = lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   objectMeta{Name: s.config.Name},
+		}
+	default:
+		return unexpectedStatus(http.MethodGet, path, status)
+	}
+
+	l.Spec = leaseSpec{
+		HolderIdentity:       s.config.Identity,
+		LeaseDurationSeconds: int(s.config.LeaseDuration.Seconds()),
+		RenewTime:            now.UTC().Format(microTimeFormat),
+	}
+	// The resource version is kept from the fetched lease, so the update
+	// fails with a conflict if another instance acquired it in between
+	status, err = s.do(method, path, l, nil)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return store.ErrLockOccupied
+	default:
+		return unexpectedStatus(method, path, status)
+	}
+}
+
+func (l lease) held(now time.Time) (bool, error) {
+	if l.Spec.HolderIdentity == "" {
+		return false, nil
+	}
+	renewed, err := time.Parse(microTimeFormat, l.Spec.RenewTime)
+	if err != nil {
+		return false, err
+	}
+	duration := time.Duration(l.Spec.LeaseDurationSeconds) * time.Second
+	return now.Before(renewed.Add(duration)), nil
+}
+
+func (s *kubeStore) LockTTL() time.Duration {
+	return s.config.LeaseDuration
+}
+
+// RenewLock updates the renew time of the lease, as long as it is still held
+// by this instance
+func (s *kubeStore) RenewLock() error {
+	path := s.leasesPath() + "/" + s.config.Name
+	var l lease
+	status, err := s.do(http.MethodGet, path, nil, &l)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return store.ErrLockLost
+	}
+	if status != http.StatusOK {
+		return unexpectedStatus(http.MethodGet, path, status)
+	}
+	now := time.Now()
+	held, err := l.held(now)
+	if err != nil {
+		return err
+	}
+	if !held || l.Spec.HolderIdentity != s.config.Identity {
+		return store.ErrLockLost
+	}
+
+	l.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+	status, err = s.do(http.MethodPut, path, l, nil)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return store.ErrLockLost
+	default:
+		return unexpectedStatus(http.MethodPut, path, status)
+	}
+}
+
+func (s *kubeStore) Unlock() error {
+	path := s.leasesPath() + "/" + s.config.Name
+	var l lease
+	status, err := s.do(http.MethodGet, path, nil, &l)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return nil
+	}
+	if status != http.StatusOK {
+		return unexpectedStatus(http.MethodGet, path, status)
+	}
+	if l.Spec.HolderIdentity != s.config.Identity {
+		// The lease has expired and been taken over by another instance
+		return nil
+	}
+
+	l.Spec = leaseSpec{}
+	status, err = s.do(http.MethodPut, path, l, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusConflict {
+		return unexpectedStatus(http.MethodPut, path, status)
+	}
+	return nil
+}
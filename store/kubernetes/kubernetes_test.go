@@ -0,0 +1,207 @@
+package kubernetes_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/kubernetes"
+)
+
+// fakeAPIServer implements the small subset of the Kubernetes API used by
+// the store, keeping objects as raw JSON.
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+	leases  map[string]map[string]interface{}
+	version int
+}
+
+func newFakeAPIServer() *httptest.Server {
+	api := &fakeAPIServer{
+		secrets: make(map[string]map[string]interface{}),
+		leases:  make(map[string]map[string]interface{}),
+	}
+	return httptest.NewServer(api)
+}
+
+func (api *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	// The path is /api/v1/namespaces/<ns>/secrets[/<name>] for secrets and
+	// /apis/coordination.k8s.io/v1/namespaces/<ns>/leases[/<name>] for leases
+	objects := api.secrets
+	if parts[0] == "apis" {
+		objects = api.leases
+		parts = parts[1:]
+	}
+	name := ""
+	if len(parts) == 6 {
+		name = parts[5]
+	}
+
+	var obj map[string]interface{}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		var items []interface{}
+		for _, item := range objects {
+			items = append(items, item)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case r.Method == http.MethodGet:
+		existing, ok := objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(existing)
+	case r.Method == http.MethodPost:
+		name = obj["metadata"].(map[string]interface{})["name"].(string)
+		if _, ok := objects[name]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		api.store(objects, name, obj)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(obj)
+	case r.Method == http.MethodPut:
+		existing, ok := objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		current := existing["metadata"].(map[string]interface{})["resourceVersion"]
+		if obj["metadata"].(map[string]interface{})["resourceVersion"] != current {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		api.store(objects, name, obj)
+		json.NewEncoder(w).Encode(obj)
+	case r.Method == http.MethodDelete:
+		if _, ok := objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(objects, name)
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	}
+}
+
+func (api *fakeAPIServer) store(objects map[string]map[string]interface{}, name string, obj map[string]interface{}) {
+	api.version++
+	obj["metadata"].(map[string]interface{})["resourceVersion"] = strconv.Itoa(api.version)
+	objects[name] = obj
+}
+
+func getStore(host, identity string) store.Store {
+	return kubernetes.New(kubernetes.Config{
+		Host:      host,
+		Namespace: "default",
+		Identity:  identity,
+	})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	server := newFakeAPIServer()
+	defer server.Close()
+	s := getStore(server.URL, "one")
+
+	k := store.Key{
+		ID:        "pub:AbCd",
+		IsPrivate: false,
+		ExpiresAt: time.Now().Add(time.Hour).Round(0),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != k.ID {
+		t.Errorf("got keys %+v", keys)
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(k.ID); err != nil {
+		t.Errorf("expected deleting missing key to succeed, got %v", err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestLeaseLock(t *testing.T) {
+	server := newFakeAPIServer()
+	defer server.Close()
+	one := getStore(server.URL, "one")
+	two := getStore(server.URL, "two")
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := one.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	server := newFakeAPIServer()
+	defer server.Close()
+
+	r := ring.New(getStore(server.URL, "one"))
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetVerifier(key.ID); err != nil {
+		t.Errorf("could not get verifier: %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		server := newFakeAPIServer()
+		t.Cleanup(server.Close)
+		return getStore(server.URL, "one")
+	})
+}
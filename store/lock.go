@@ -0,0 +1,89 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLockLost is returned by RenewLock if the lock is no longer held, for
+// example because it expired before being renewed.
+var ErrLockLost = errors.New("hsson/ring: lock lost")
+
+// Locker is implemented by stores with a store wide lock, which is held
+// while creating new signing keys so that only a single instance creates
+// keys at a time. Stores which don't implement it are locked by a process
+// local lock, see AsLocker, which does not exclude instances in other
+// processes.
+type Locker interface {
+	// Lock acquires the lock. If the lock is already held,
+	// ErrLockOccupied should be returned. The lock should expire once a
+	// timeout has elapsed without it being unlocked or renewed, after
+	// which Lock succeeds again, so a crashed instance can not hold it
+	// forever. Stores with such a timeout should also implement
+	// LockRenewer, so the lock can be kept during slow operations.
+	Lock() error
+
+	// Unlock releases a lock previously acquired with Lock.
+	Unlock() error
+}
+
+// AsLocker returns s as a Locker if it implements one, or otherwise a new
+// process local lock. Wrappers of stores should keep the returned Locker,
+// so all users of the wrapper share the process local lock.
+func AsLocker(s Store) Locker {
+	if l, ok := s.(Locker); ok {
+		return l
+	}
+	return &localLock{}
+}
+
+// localLock is a Locker for a single process
+type localLock struct {
+	mu     sync.Mutex
+	locked bool
+}
+
+func (l *localLock) Lock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locked {
+		return ErrLockOccupied
+	}
+	l.locked = true
+	return nil
+}
+
+func (l *localLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.locked = false
+	return nil
+}
+
+// LockRenewer is implemented by stores whose lock expires after a TTL. While
+// a keychain holds the lock it renews it regularly, so that slow operations
+// such as generating large RSA keys don't outlive the lock.
+type LockRenewer interface {
+	// LockTTL returns how long the lock is held after being acquired or
+	// renewed, before it expires.
+	LockTTL() time.Duration
+
+	// RenewLock extends the lock held by this instance by LockTTL. If the
+	// lock is no longer held by this instance, ErrLockLost should be
+	// returned.
+	RenewLock() error
+}
+
+// AsLockRenewer returns s as a LockRenewer, if it, or the Store adapted by
+// WithContext, supports renewing its lock.
+func AsLockRenewer(s ContextStore) (LockRenewer, bool) {
+	if l, ok := s.(LockRenewer); ok {
+		return l, true
+	}
+	if w, ok := s.(withContext); ok {
+		renewer, ok := w.store.(LockRenewer)
+		return renewer, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,244 @@
+// Package middleware provides store decorators for use with store.Chain.
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+// Operation names passed to Observe and Trace hooks
+const (
+	OpAdd    = "add"
+	OpFind   = "find"
+	OpDelete = "delete"
+	OpList   = "list"
+	OpLock   = "lock"
+	OpUnlock = "unlock"
+)
+
+// Cache caches the list of keys for ttl, and serves both List and Find from
+// it. The cache is dropped when keys are added or deleted through the
+// wrapped store, but keys written by other instances are only seen once the
+// cache expires.
+func Cache(ttl time.Duration) store.Middleware {
+	return func(next store.Store) store.Store {
+		return &cache{Store: next, locker: store.AsLocker(next), ttl: ttl}
+	}
+}
+
+type cache struct {
+	store.Store
+	locker store.Locker
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	keys     store.KeyList
+	cachedAt time.Time
+}
+
+func (c *cache) invalidate() {
+	c.mu.Lock()
+	c.keys = nil
+	c.mu.Unlock()
+}
+
+func (c *cache) Add(key store.Key) error {
+	defer c.invalidate()
+	return c.Store.Add(key)
+}
+
+func (c *cache) Delete(id string) error {
+	defer c.invalidate()
+	return c.Store.Delete(id)
+}
+
+func (c *cache) List() (store.KeyList, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil || time.Since(c.cachedAt) >= c.ttl {
+		keys, err := c.Store.List()
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(store.KeyList{}, keys...)
+		c.cachedAt = time.Now()
+	}
+	return append(store.KeyList{}, c.keys...), nil
+}
+
+func (c *cache) Lock() error {
+	return c.locker.Lock()
+}
+
+func (c *cache) Unlock() error {
+	return c.locker.Unlock()
+}
+
+func (c *cache) Find(id string) (store.Key, error) {
+	keys, err := c.List()
+	if err != nil {
+		return store.Key{}, err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return store.Key{}, ring.ErrKeyNotFound
+}
+
+// RetryOptions configures the Retry middleware
+type RetryOptions struct {
+	// Attempts is the maximum number of attempts. Default: 3
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for every
+	// following retry. Default: 100 milliseconds
+	Backoff time.Duration
+	// MaxBackoff limits the delay between retries. Default: 2 seconds
+	MaxBackoff time.Duration
+}
+
+// Retry retries failed Find, List, Delete and Unlock calls with exponential
+// backoff. Add and Lock are not retried, since an attempt which failed on
+// the client side may still have succeeded in the store. ErrKeyNotFound is
+// never retried.
+func Retry(options RetryOptions) store.Middleware {
+	if options.Attempts <= 0 {
+		options.Attempts = 3
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = 100 * time.Millisecond
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = 2 * time.Second
+	}
+	return func(next store.Store) store.Store {
+		return &retry{Store: next, locker: store.AsLocker(next), options: options}
+	}
+}
+
+type retry struct {
+	store.Store
+	locker  store.Locker
+	options RetryOptions
+}
+
+func (r *retry) do(f func() error) error {
+	backoff := r.options.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || errors.Is(err, ring.ErrKeyNotFound) || attempt >= r.options.Attempts {
+			return err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > r.options.MaxBackoff {
+			backoff = r.options.MaxBackoff
+		}
+	}
+}
+
+func (r *retry) Find(id string) (store.Key, error) {
+	var key store.Key
+	err := r.do(func() (err error) {
+		key, err = r.Store.Find(id)
+		return err
+	})
+	return key, err
+}
+
+func (r *retry) Delete(id string) error {
+	return r.do(func() error {
+		return r.Store.Delete(id)
+	})
+}
+
+func (r *retry) List() (store.KeyList, error) {
+	var keys store.KeyList
+	err := r.do(func() (err error) {
+		keys, err = r.Store.List()
+		return err
+	})
+	return keys, err
+}
+
+// Lock is not retried, as ErrLockOccupied is expected while another
+// instance holds the lock
+func (r *retry) Lock() error {
+	return r.locker.Lock()
+}
+
+func (r *retry) Unlock() error {
+	return r.do(r.locker.Unlock)
+}
+
+// Observe calls observe after every store operation with its duration and
+// error, e.g. to record metrics.
+func Observe(observe func(op string, duration time.Duration, err error)) store.Middleware {
+	return Trace(func(op string) func(error) {
+		start := time.Now()
+		return func(err error) {
+			observe(op, time.Since(start), err)
+		}
+	})
+}
+
+// Trace calls start before every store operation, and the returned function
+// once it completes, e.g. to start and end tracing spans.
+func Trace(start func(op string) (end func(err error))) store.Middleware {
+	return func(next store.Store) store.Store {
+		return &trace{next: next, locker: store.AsLocker(next), start: start}
+	}
+}
+
+type trace struct {
+	next   store.Store
+	locker store.Locker
+	start  func(op string) func(error)
+}
+
+func (t *trace) Add(key store.Key) error {
+	end := t.start(OpAdd)
+	err := t.next.Add(key)
+	end(err)
+	return err
+}
+
+func (t *trace) Find(id string) (store.Key, error) {
+	end := t.start(OpFind)
+	key, err := t.next.Find(id)
+	end(err)
+	return key, err
+}
+
+func (t *trace) Delete(id string) error {
+	end := t.start(OpDelete)
+	err := t.next.Delete(id)
+	end(err)
+	return err
+}
+
+func (t *trace) List() (store.KeyList, error) {
+	end := t.start(OpList)
+	keys, err := t.next.List()
+	end(err)
+	return keys, err
+}
+
+func (t *trace) Lock() error {
+	end := t.start(OpLock)
+	err := t.locker.Lock()
+	end(err)
+	return err
+}
+
+func (t *trace) Unlock() error {
+	end := t.start(OpUnlock)
+	err := t.locker.Unlock()
+	end(err)
+	return err
+}
@@ -0,0 +1,90 @@
+package middleware_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
+	"github.com/hsson/ring/store/middleware"
+)
+
+// flakyStore fails List a number of times and counts the calls
+type flakyStore struct {
+	store.Store
+	failures int
+	lists    int
+}
+
+func (s *flakyStore) List() (store.KeyList, error) {
+	s.lists++
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("unavailable")
+	}
+	return s.Store.List()
+}
+
+func TestCache(t *testing.T) {
+	inner := &flakyStore{Store: inmem.NewInMemoryStore()}
+	s := store.Chain(inner, middleware.Cache(time.Hour))
+
+	key := store.Key{ID: "key", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := s.Find(key.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.List(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.lists != 1 {
+		t.Errorf("expected 1 list from the store, got %d", inner.lists)
+	}
+
+	if err := s.Delete(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(key.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected deleted key to be gone, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	inner := &flakyStore{Store: inmem.NewInMemoryStore(), failures: 2}
+	s := store.Chain(inner, middleware.Retry(middleware.RetryOptions{Backoff: time.Millisecond}))
+	if _, err := s.List(); err != nil {
+		t.Errorf("expected list to succeed after retries, got %v", err)
+	}
+	if inner.lists != 3 {
+		t.Errorf("expected 3 attempts, got %d", inner.lists)
+	}
+
+	inner.failures, inner.lists = 5, 0
+	if _, err := s.List(); err == nil {
+		t.Errorf("expected list to fail after all attempts")
+	}
+	if inner.lists != 3 {
+		t.Errorf("expected 3 attempts, got %d", inner.lists)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	var ops []string
+	s := store.Chain(inmem.NewInMemoryStore(), middleware.Observe(func(op string, d time.Duration, err error) {
+		ops = append(ops, op)
+	}))
+
+	keychain := ring.New(s)
+	if _, err := keychain.SigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) == 0 || ops[0] != middleware.OpList {
+		t.Errorf("unexpected operations: %v", ops)
+	}
+}
@@ -0,0 +1,318 @@
+// Package mongo implements a store on top of MongoDB. Keys are kept as
+// documents in a collection with the key ID as _id, so the unique _id index
+// detects ID conflicts. A TTL index on "expires_at" has MongoDB remove
+// expired keys, and the store lock is a lease document taken and renewed
+// with findAndModify, which expires if its holder disappears.
+//
+// The store speaks the MongoDB wire protocol (OP_MSG) directly, and
+// supports SCRAM-SHA-256 authentication and TLS.
+package mongo
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/internal/bson"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	defaultAddress        = "localhost:27017"
+	defaultDatabase       = "ring"
+	defaultCollection     = "ring_keys"
+	defaultLockCollection = "ring_locks"
+	defaultAuthSource     = "admin"
+	defaultLeaseDuration  = 30 * time.Second
+	defaultTimeout        = 10 * time.Second
+
+	codeDuplicateKey = 11000
+)
+
+// Config configures how the store connects to MongoDB
+type Config struct {
+	// Address of the server, as host:port. Default: localhost:27017
+	Address string
+	// Database the collections are kept in. Default: ring
+	Database string
+	// Collection is the name of the collection keys are kept in.
+	// Default: ring_keys
+	Collection string
+	// LockCollection is the name of the collection the lock document is
+	// kept in. Default: ring_locks
+	LockCollection string
+	// Username and Password authenticate using SCRAM-SHA-256. No
+	// authentication is done if Username is empty.
+	Username string
+	Password string
+	// AuthSource is the database the user is defined in. Default: admin
+	AuthSource string
+	// TLSConfig enables TLS when set
+	TLSConfig *tls.Config
+	// Owner identifies this instance as holder of the lock.
+	// Default: the hostname
+	Owner string
+	// LeaseDuration is how long the lock is held before it expires.
+	// Default: 30 seconds
+	LeaseDuration time.Duration
+	// Timeout limits each round trip to the server. Default: 10 seconds
+	Timeout time.Duration
+}
+
+// New creates a new store keeping keys in a MongoDB collection. The
+// connection is established, and the TTL index created, on first use.
+func New(config Config) store.Store {
+	if config.Address == "" {
+		config.Address = defaultAddress
+	}
+	if config.Database == "" {
+		config.Database = defaultDatabase
+	}
+	if config.Collection == "" {
+		config.Collection = defaultCollection
+	}
+	if config.LockCollection == "" {
+		config.LockCollection = defaultLockCollection
+	}
+	if config.AuthSource == "" {
+		config.AuthSource = defaultAuthSource
+	}
+	if config.Owner == "" {
+		config.Owner, _ = os.Hostname()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	return &mongoStore{config: config}
+}
+
+type mongoStore struct {
+	config Config
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+func isDuplicateKey(err error) bool {
+	var cmdErr *commandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == codeDuplicateKey
+}
+
+func (s *mongoStore) Add(key store.Key) error {
+	doc := bson.D{
+		{Key: "_id", Value: key.ID},
+		{Key: "private", Value: key.IsPrivate},
+		// expires_at drives the TTL index, which only has millisecond
+		// precision, so the exact expiry is kept separately
+		{Key: "expires_at", Value: key.ExpiresAt},
+		{Key: "expires_at_ns", Value: key.ExpiresAt.UnixNano()},
+		{Key: "data", Value: key.Data},
+	}
+	if len(key.Metadata) != 0 {
+		metadata := make(bson.D, 0, len(key.Metadata))
+		for k, v := range key.Metadata {
+			metadata = append(metadata, bson.E{Key: k, Value: v})
+		}
+		doc = append(doc, bson.E{Key: "metadata", Value: metadata})
+	}
+	_, err := s.command(bson.D{
+		{Key: "insert", Value: s.config.Collection},
+		{Key: "documents", Value: []interface{}{doc}},
+	})
+	if isDuplicateKey(err) {
+		return store.ErrKeyIDConflict
+	}
+	return err
+}
+
+func documentToKey(doc bson.D) (store.Key, error) {
+	id, ok := doc.Lookup("_id").(string)
+	expiresAt, hasExpiry := doc.Lookup("expires_at_ns").(int64)
+	if !ok || !hasExpiry {
+		return store.Key{}, errors.New("hsson/ring/mongo: malformed key document")
+	}
+	private, _ := doc.Lookup("private").(bool)
+	data, _ := doc.Lookup("data").([]byte)
+	var metadata map[string]string
+	if m, ok := doc.Lookup("metadata").(bson.D); ok {
+		metadata = make(map[string]string, len(m))
+		for _, e := range m {
+			if v, ok := e.Value.(string); ok {
+				metadata[e.Key] = v
+			}
+		}
+	}
+	return store.Key{
+		ID:        id,
+		IsPrivate: private,
+		ExpiresAt: time.Unix(0, expiresAt),
+		Data:      data,
+		Metadata:  metadata,
+	}, nil
+}
+
+func (s *mongoStore) Find(id string) (store.Key, error) {
+	docs, err := s.find(bson.D{{Key: "_id", Value: id}}, 1)
+	if err != nil {
+		return store.Key{}, err
+	}
+	if len(docs) == 0 {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	return documentToKey(docs[0])
+}
+
+func (s *mongoStore) Delete(id string) error {
+	_, err := s.command(bson.D{
+		{Key: "delete", Value: s.config.Collection},
+		{Key: "deletes", Value: []interface{}{bson.D{
+			{Key: "q", Value: bson.D{{Key: "_id", Value: id}}},
+			{Key: "limit", Value: int32(1)},
+		}}},
+	})
+	return err
+}
+
+func (s *mongoStore) List() (store.KeyList, error) {
+	docs, err := s.find(bson.D{}, 0)
+	if err != nil {
+		return nil, err
+	}
+	all := make(store.KeyList, 0, len(docs))
+	for _, doc := range docs {
+		key, err := documentToKey(doc)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+// find returns the documents in the key collection matching filter,
+// following the cursor until it is exhausted
+func (s *mongoStore) find(filter bson.D, limit int64) ([]bson.D, error) {
+	cmd := bson.D{
+		{Key: "find", Value: s.config.Collection},
+		{Key: "filter", Value: filter},
+	}
+	if limit > 0 {
+		cmd = append(cmd, bson.E{Key: "limit", Value: limit}, bson.E{Key: "singleBatch", Value: true})
+	}
+	res, err := s.command(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.D
+	batch := "firstBatch"
+	for {
+		cursor, ok := res.Lookup("cursor").(bson.D)
+		if !ok {
+			return nil, errors.New("hsson/ring/mongo: malformed cursor")
+		}
+		items, _ := cursor.Lookup(batch).([]interface{})
+		for _, item := range items {
+			if doc, ok := item.(bson.D); ok {
+				docs = append(docs, doc)
+			}
+		}
+		cursorID, _ := cursor.Lookup("id").(int64)
+		if cursorID == 0 {
+			return docs, nil
+		}
+		res, err = s.command(bson.D{
+			{Key: "getMore", Value: cursorID},
+			{Key: "collection", Value: s.config.Collection},
+		})
+		if err != nil {
+			return nil, err
+		}
+		batch = "nextBatch"
+	}
+}
+
+// lockID is the _id of the lock document. It is named after the key
+// collection, so several keychains can share a lock collection.
+func (s *mongoStore) lockID() string {
+	return s.config.Database + "." + s.config.Collection
+}
+
+func (s *mongoStore) Lock() error {
+	now := time.Now()
+	// The lock document is only matched if its lease has run out. If
+	// somebody holds the lock the upsert instead collides with the
+	// existing document on _id.
+	_, err := s.command(bson.D{
+		{Key: "findAndModify", Value: s.config.LockCollection},
+		{Key: "query", Value: bson.D{
+			{Key: "_id", Value: s.lockID()},
+			{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}},
+		}},
+		{Key: "update", Value: bson.D{{Key: "$set", Value: bson.D{
+			{Key: "owner", Value: s.config.Owner},
+			{Key: "expires_at", Value: now.Add(s.config.LeaseDuration)},
+		}}}},
+		{Key: "upsert", Value: true},
+		{Key: "new", Value: true},
+	})
+	if isDuplicateKey(err) {
+		return store.ErrLockOccupied
+	}
+	return err
+}
+
+func (s *mongoStore) LockTTL() time.Duration {
+	return s.config.LeaseDuration
+}
+
+// RenewLock extends the lease, as long as it is still held by this instance
+func (s *mongoStore) RenewLock() error {
+	now := time.Now()
+	res, err := s.command(bson.D{
+		{Key: "findAndModify", Value: s.config.LockCollection},
+		{Key: "query", Value: bson.D{
+			{Key: "_id", Value: s.lockID()},
+			{Key: "owner", Value: s.config.Owner},
+			{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: now}}},
+		}},
+		{Key: "update", Value: bson.D{{Key: "$set", Value: bson.D{
+			{Key: "expires_at", Value: now.Add(s.config.LeaseDuration)},
+		}}}},
+		{Key: "new", Value: true},
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := res.Lookup("value").(bson.D); !ok {
+		return store.ErrLockLost
+	}
+	return nil
+}
+
+func (s *mongoStore) Unlock() error {
+	// Only the holder's document is deleted. If the lease expired and was
+	// taken over by another instance, nothing matches.
+	_, err := s.command(bson.D{
+		{Key: "delete", Value: s.config.LockCollection},
+		{Key: "deletes", Value: []interface{}{bson.D{
+			{Key: "q", Value: bson.D{
+				{Key: "_id", Value: s.lockID()},
+				{Key: "owner", Value: s.config.Owner},
+			}},
+			{Key: "limit", Value: int32(1)},
+		}}},
+	})
+	return err
+}
+
+// HandlesTTL reports that MongoDB removes expired keys through the TTL
+// index
+func (s *mongoStore) HandlesTTL() bool {
+	return true
+}
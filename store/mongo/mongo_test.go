@@ -0,0 +1,460 @@
+package mongo_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring/internal/bson"
+	"github.com/hsson/ring/internal/pbkdf2"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/mongo"
+)
+
+const (
+	testUser     = "ring"
+	testPassword = "secret"
+	batchSize    = 2
+)
+
+// fakeMongo is a server speaking OP_MSG, implementing the commands and
+// query operators used by the store, and SCRAM-SHA-256 for a single user
+type fakeMongo struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	collections map[string][]bson.D
+	cursors     map[int64][]interface{}
+	nextCursor  int64
+	indexes     []bson.D
+}
+
+func newFakeMongo(t *testing.T) *fakeMongo {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakeMongo{
+		listener:    l,
+		collections: make(map[string][]bson.D),
+		cursors:     make(map[int64][]interface{}),
+	}
+	go db.serve()
+	t.Cleanup(func() { l.Close() })
+	return db
+}
+
+func (db *fakeMongo) serve() {
+	for {
+		c, err := db.listener.Accept()
+		if err != nil {
+			return
+		}
+		go db.serveConn(c)
+	}
+}
+
+func (db *fakeMongo) serveConn(c net.Conn) {
+	defer c.Close()
+	auth := &scramServer{}
+	for {
+		var header [16]byte
+		if _, err := io.ReadFull(c, header[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.LittleEndian.Uint32(header[:])-16)
+		if _, err := io.ReadFull(c, msg); err != nil {
+			return
+		}
+		cmd, err := bson.Unmarshal(msg[5:])
+		if err != nil {
+			return
+		}
+		res := db.handle(auth, cmd)
+		body, _ := bson.Marshal(res)
+		reply := make([]byte, 21, 21+len(body))
+		binary.LittleEndian.PutUint32(reply[0:], uint32(21+len(body)))
+		copy(reply[8:12], header[4:8])
+		binary.LittleEndian.PutUint32(reply[12:], 2013)
+		if _, err := c.Write(append(reply, body...)); err != nil {
+			return
+		}
+	}
+}
+
+func ok(fields ...bson.E) bson.D {
+	return append(bson.D{{Key: "ok", Value: float64(1)}}, fields...)
+}
+
+func failed(code int32, message string) bson.D {
+	return bson.D{
+		{Key: "ok", Value: float64(0)},
+		{Key: "code", Value: code},
+		{Key: "errmsg", Value: message},
+	}
+}
+
+func duplicateKey() bson.D {
+	return ok(bson.E{Key: "n", Value: int32(0)}, bson.E{Key: "writeErrors", Value: []interface{}{bson.D{
+		{Key: "index", Value: int32(0)},
+		{Key: "code", Value: int32(11000)},
+		{Key: "errmsg", Value: "E11000 duplicate key error"},
+	}}})
+}
+
+func (db *fakeMongo) handle(auth *scramServer, cmd bson.D) bson.D {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	name := cmd[0].Key
+	switch name {
+	case "saslStart", "saslContinue":
+		return auth.step(cmd)
+	}
+	if !auth.done {
+		return failed(13, "command requires authentication")
+	}
+	collection, _ := cmd[0].Value.(string)
+	switch name {
+	case "createIndexes":
+		for _, index := range cmd.Lookup("indexes").([]interface{}) {
+			db.indexes = append(db.indexes, index.(bson.D))
+		}
+		return ok()
+	case "insert":
+		for _, doc := range cmd.Lookup("documents").([]interface{}) {
+			doc := doc.(bson.D)
+			if db.indexOf(collection, bson.D{{Key: "_id", Value: doc.Lookup("_id")}}) >= 0 {
+				return duplicateKey()
+			}
+			db.collections[collection] = append(db.collections[collection], doc)
+		}
+		return ok(bson.E{Key: "n", Value: int32(1)})
+	case "find":
+		var found []interface{}
+		for _, doc := range db.collections[collection] {
+			if matches(doc, cmd.Lookup("filter").(bson.D)) {
+				found = append(found, doc)
+			}
+		}
+		return db.batch(collection, "firstBatch", found)
+	case "getMore":
+		cursorID := cmd[0].Value.(int64)
+		found := db.cursors[cursorID]
+		delete(db.cursors, cursorID)
+		return db.batch(cmd.Lookup("collection").(string), "nextBatch", found)
+	case "delete":
+		n := int32(0)
+		for _, del := range cmd.Lookup("deletes").([]interface{}) {
+			if i := db.indexOf(collection, del.(bson.D).Lookup("q").(bson.D)); i >= 0 {
+				docs := db.collections[collection]
+				db.collections[collection] = append(docs[:i:i], docs[i+1:]...)
+				n++
+			}
+		}
+		return ok(bson.E{Key: "n", Value: n})
+	case "findAndModify":
+		query := cmd.Lookup("query").(bson.D)
+		set := cmd.Lookup("update").(bson.D).Lookup("$set").(bson.D)
+		if i := db.indexOf(collection, query); i >= 0 {
+			doc := db.collections[collection][i]
+			for _, e := range set {
+				doc = setField(doc, e.Key, e.Value)
+			}
+			db.collections[collection][i] = doc
+			return ok(bson.E{Key: "value", Value: doc})
+		}
+		if upsert, _ := cmd.Lookup("upsert").(bool); !upsert {
+			return ok(bson.E{Key: "value", Value: nil})
+		}
+		id := query.Lookup("_id")
+		if db.indexOf(collection, bson.D{{Key: "_id", Value: id}}) >= 0 {
+			return failed(11000, "E11000 duplicate key error")
+		}
+		doc := append(bson.D{{Key: "_id", Value: id}}, set...)
+		db.collections[collection] = append(db.collections[collection], doc)
+		return ok(bson.E{Key: "value", Value: doc})
+	}
+	return failed(59, "no such command: "+name)
+}
+
+// batch returns the first documents of found, keeping the rest behind a
+// cursor
+func (db *fakeMongo) batch(collection, name string, found []interface{}) bson.D {
+	cursorID := int64(0)
+	if len(found) > batchSize {
+		db.nextCursor++
+		cursorID = db.nextCursor
+		db.cursors[cursorID] = found[batchSize:]
+		found = found[:batchSize]
+	}
+	if found == nil {
+		found = []interface{}{}
+	}
+	return ok(bson.E{Key: "cursor", Value: bson.D{
+		{Key: name, Value: found},
+		{Key: "id", Value: cursorID},
+		{Key: "ns", Value: "ring." + collection},
+	}})
+}
+
+func (db *fakeMongo) indexOf(collection string, query bson.D) int {
+	for i, doc := range db.collections[collection] {
+		if matches(doc, query) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matches(doc, query bson.D) bool {
+	for _, cond := range query {
+		value := doc.Lookup(cond.Key)
+		if ops, ok := cond.Value.(bson.D); ok {
+			t, _ := value.(time.Time)
+			for _, op := range ops {
+				switch op.Key {
+				case "$lt":
+					if !t.Before(op.Value.(time.Time)) {
+						return false
+					}
+				case "$gt":
+					if !t.After(op.Value.(time.Time)) {
+						return false
+					}
+				}
+			}
+		} else if !reflect.DeepEqual(value, cond.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func setField(doc bson.D, key string, value interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+// scramServer is the server side of a SCRAM-SHA-256 conversation
+type scramServer struct {
+	clientFirstBare string
+	serverFirst     string
+	done            bool
+}
+
+var testSalt = []byte("0123456789abcdef")
+
+func testSaltedPassword() []byte {
+	return pbkdf2.Key([]byte(testPassword), testSalt, 4096, sha256.Size, sha256.New)
+}
+
+func mac(key []byte, message string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return h.Sum(nil)
+}
+
+func attributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(msg, ",") {
+		if len(part) >= 2 && part[1] == '=' {
+			attrs[part[:1]] = part[2:]
+		}
+	}
+	return attrs
+}
+
+func (s *scramServer) step(cmd bson.D) bson.D {
+	authFailed := failed(18, "Authentication failed.")
+	if cmd.Lookup("$db") != "admin" {
+		return authFailed
+	}
+	payload := string(cmd.Lookup("payload").([]byte))
+	if cmd[0].Key == "saslStart" {
+		if cmd.Lookup("mechanism") != "SCRAM-SHA-256" || !strings.HasPrefix(payload, "n,,") {
+			return authFailed
+		}
+		s.clientFirstBare = strings.TrimPrefix(payload, "n,,")
+		attrs := attributes(s.clientFirstBare)
+		if attrs["n"] != testUser {
+			return authFailed
+		}
+		s.serverFirst = "r=" + attrs["r"] + "server-nonce,s=" + base64.StdEncoding.EncodeToString(testSalt) + ",i=4096"
+		return ok(
+			bson.E{Key: "conversationId", Value: int32(1)},
+			bson.E{Key: "done", Value: false},
+			bson.E{Key: "payload", Value: []byte(s.serverFirst)},
+		)
+	}
+
+	attrs := attributes(payload)
+	proof, _ := base64.StdEncoding.DecodeString(attrs["p"])
+	authMessage := s.clientFirstBare + "," + s.serverFirst + ",c=" + attrs["c"] + ",r=" + attrs["r"]
+	saltedPassword := testSaltedPassword()
+	storedKey := sha256.Sum256(mac(saltedPassword, "Client Key"))
+	signature := mac(storedKey[:], authMessage)
+	if len(proof) != len(signature) {
+		return authFailed
+	}
+	for i := range proof {
+		proof[i] ^= signature[i]
+	}
+	if clientKey := sha256.Sum256(proof); clientKey != storedKey {
+		return authFailed
+	}
+	s.done = true
+	serverSignature := mac(mac(saltedPassword, "Server Key"), authMessage)
+	return ok(
+		bson.E{Key: "conversationId", Value: int32(1)},
+		bson.E{Key: "done", Value: true},
+		bson.E{Key: "payload", Value: []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature))},
+	)
+}
+
+func getStore(db *fakeMongo, owner string, leaseDuration time.Duration) store.Store {
+	return mongo.New(mongo.Config{
+		Address:       db.listener.Addr().String(),
+		Username:      testUser,
+		Password:      testPassword,
+		Owner:         owner,
+		LeaseDuration: leaseDuration,
+	})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	db := newFakeMongo(t)
+	s := getStore(db, "one", time.Minute)
+
+	k := store.Key{
+		ID:        "pub:AbCd",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	// More keys than fit in a batch are read through the cursor
+	for _, id := range []string{"pub:1", "pub:2", "pub:3"} {
+		if err := s.Add(store.Key{ID: id, ExpiresAt: k.ExpiresAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 4 {
+		t.Errorf("expected 4 keys, got %d", len(list))
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); err == nil {
+		t.Error("expected deleted key to be gone")
+	}
+}
+
+func TestTTLIndex(t *testing.T) {
+	db := newFakeMongo(t)
+	if _, err := getStore(db, "one", time.Minute).List(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.indexes) != 1 {
+		t.Fatalf("expected one index, got %v", db.indexes)
+	}
+	index := db.indexes[0]
+	if index.Lookup("expireAfterSeconds") != int32(0) || !reflect.DeepEqual(index.Lookup("key"), bson.D{{Key: "expires_at", Value: int32(1)}}) {
+		t.Errorf("unexpected TTL index %v", index)
+	}
+	if !store.HandlesTTL(store.WithContext(getStore(db, "one", time.Minute))) {
+		t.Error("expected store to handle TTL")
+	}
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	db := newFakeMongo(t)
+	s := mongo.New(mongo.Config{
+		Address:  db.listener.Addr().String(),
+		Username: testUser,
+		Password: "wrong",
+	})
+	if _, err := s.List(); err == nil {
+		t.Error("expected authentication to fail")
+	}
+}
+
+func TestLeaseLock(t *testing.T) {
+	db := newFakeMongo(t)
+	one := getStore(db, "one", time.Minute)
+	two := getStore(db, "two", time.Minute)
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := two.(store.Locker).Unlock(); err != nil {
+		t.Errorf("expected unlocking a lock held by another owner to be a no-op, got %v", err)
+	}
+	if err := one.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	db := newFakeMongo(t)
+	crashed := getStore(db, "crashed", time.Millisecond)
+	other := getStore(db, "other", time.Minute)
+
+	if err := crashed.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := other.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected expired lease to be taken over, got %v", err)
+	}
+	renewer, _ := store.AsLockRenewer(store.WithContext(crashed))
+	if err := renewer.RenewLock(); !errors.Is(err, store.ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		return getStore(newFakeMongo(t), "one", time.Minute)
+	})
+}
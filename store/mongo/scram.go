@@ -0,0 +1,114 @@
+package mongo
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hsson/ring/internal/bson"
+	"github.com/hsson/ring/internal/pbkdf2"
+)
+
+const scramMechanism = "SCRAM-SHA-256"
+
+var errAuthentication = errors.New("hsson/ring/mongo: authentication failed")
+
+// authenticate runs a SCRAM-SHA-256 conversation (RFC 7677) on c
+func (s *mongoStore) authenticate(c *conn) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	clientNonce := base64.StdEncoding.EncodeToString(nonce)
+	clientFirstBare := "n=" + escapeUsername(s.config.Username) + ",r=" + clientNonce
+
+	res, err := s.sasl(c, bson.D{
+		{Key: "saslStart", Value: int32(1)},
+		{Key: "mechanism", Value: scramMechanism},
+		{Key: "payload", Value: []byte("n,," + clientFirstBare)},
+		{Key: "options", Value: bson.D{{Key: "skipEmptyExchange", Value: true}}},
+	})
+	if err != nil {
+		return err
+	}
+	serverFirst, _ := res.Lookup("payload").([]byte)
+	attrs := parseScram(string(serverFirst))
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return errAuthentication
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 4096 || !strings.HasPrefix(attrs["r"], clientNonce) {
+		return errAuthentication
+	}
+
+	saltedPassword := pbkdf2.Key([]byte(s.config.Password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	clientFinal := "c=biws,r=" + attrs["r"]
+	authMessage := clientFirstBare + "," + string(serverFirst) + "," + clientFinal
+	proof := hmacSHA256(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	clientFinal += ",p=" + base64.StdEncoding.EncodeToString(proof)
+
+	conversationID := res.Lookup("conversationId")
+	res, err = s.sasl(c, bson.D{
+		{Key: "saslContinue", Value: int32(1)},
+		{Key: "conversationId", Value: conversationID},
+		{Key: "payload", Value: []byte(clientFinal)},
+	})
+	if err != nil {
+		return err
+	}
+	serverFinal, _ := res.Lookup("payload").([]byte)
+	serverSignature := hmacSHA256(hmacSHA256(saltedPassword, "Server Key"), authMessage)
+	verifier, err := base64.StdEncoding.DecodeString(parseScram(string(serverFinal))["v"])
+	if err != nil || !hmac.Equal(verifier, serverSignature) {
+		return errAuthentication
+	}
+	// Servers not supporting skipEmptyExchange expect a final empty message
+	if done, _ := res.Lookup("done").(bool); !done {
+		_, err = s.sasl(c, bson.D{
+			{Key: "saslContinue", Value: int32(1)},
+			{Key: "conversationId", Value: conversationID},
+			{Key: "payload", Value: []byte{}},
+		})
+	}
+	return err
+}
+
+func (s *mongoStore) sasl(c *conn, cmd bson.D) (bson.D, error) {
+	res, err := c.roundTrip(append(cmd, bson.E{Key: "$db", Value: s.config.AuthSource}))
+	if err != nil {
+		return nil, err
+	}
+	return res, checkReply(res)
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// escapeUsername escapes the characters SCRAM gives special meaning
+func escapeUsername(username string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(username)
+}
+
+// parseScram splits a SCRAM message into its attributes
+func parseScram(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(msg, ",") {
+		if len(part) >= 2 && part[1] == '=' {
+			attrs[part[:1]] = part[2:]
+		}
+	}
+	return attrs
+}
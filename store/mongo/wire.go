@@ -0,0 +1,189 @@
+package mongo
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/hsson/ring/internal/bson"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	opMsg = 2013
+
+	// maxMessageSize is the default maxMessageSizeBytes of MongoDB
+	maxMessageSize = 48 * 1000 * 1000
+
+	flagChecksumPresent = 1 << 0
+)
+
+// commandError is returned when the server reports a failed command, or a
+// failed write within a command
+type commandError struct {
+	Code    int32
+	Message string
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("hsson/ring/mongo: %s (code %d)", e.Message, e.Code)
+}
+
+// conn is a connection to the server, speaking OP_MSG
+type conn struct {
+	net.Conn
+	timeout   time.Duration
+	requestID int32
+}
+
+// roundTrip sends cmd as an OP_MSG and reads the reply
+func (c *conn) roundTrip(cmd bson.D) (bson.D, error) {
+	body, err := bson.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	c.requestID++
+	msg := make([]byte, 21, 21+len(body))
+	binary.LittleEndian.PutUint32(msg[0:], uint32(21+len(body)))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(c.requestID))
+	binary.LittleEndian.PutUint32(msg[12:], opMsg)
+	// msg[16:20] holds the flags and msg[20] the section kind, a single
+	// body document, all zero
+	msg = append(msg, body...)
+
+	if err := c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, store.Unavailable(err)
+	}
+	if _, err := c.Write(msg); err != nil {
+		return nil, store.Unavailable(err)
+	}
+
+	var header [16]byte
+	if _, err := io.ReadFull(c, header[:]); err != nil {
+		return nil, store.Unavailable(err)
+	}
+	length := binary.LittleEndian.Uint32(header[0:])
+	if length < 21 || length > maxMessageSize {
+		return nil, errors.New("hsson/ring/mongo: invalid reply length")
+	}
+	if binary.LittleEndian.Uint32(header[12:]) != opMsg {
+		return nil, errors.New("hsson/ring/mongo: unexpected reply opcode")
+	}
+	reply := make([]byte, length-16)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		return nil, store.Unavailable(err)
+	}
+	flags := binary.LittleEndian.Uint32(reply)
+	sections := reply[4:]
+	if flags&flagChecksumPresent != 0 {
+		sections = sections[:len(sections)-4]
+	}
+	if len(sections) == 0 || sections[0] != 0 {
+		return nil, errors.New("hsson/ring/mongo: unexpected reply section")
+	}
+	return bson.Unmarshal(sections[1:])
+}
+
+// checkReply turns a reply reporting failure into a *commandError
+func checkReply(res bson.D) error {
+	if !isOK(res.Lookup("ok")) {
+		code, _ := toInt32(res.Lookup("code"))
+		message, _ := res.Lookup("errmsg").(string)
+		return &commandError{Code: code, Message: message}
+	}
+	// Writes report errors per document while the command succeeds
+	if writeErrors, ok := res.Lookup("writeErrors").([]interface{}); ok && len(writeErrors) > 0 {
+		writeErr, _ := writeErrors[0].(bson.D)
+		code, _ := toInt32(writeErr.Lookup("code"))
+		message, _ := writeErr.Lookup("errmsg").(string)
+		return &commandError{Code: code, Message: message}
+	}
+	return nil
+}
+
+func isOK(v interface{}) bool {
+	n, ok := toInt32(v)
+	return ok && n == 1
+}
+
+func toInt32(v interface{}) (int32, bool) {
+	switch n := v.(type) {
+	case int32:
+		return n, true
+	case int64:
+		return int32(n), true
+	case float64:
+		return int32(n), true
+	}
+	return 0, false
+}
+
+// command runs cmd against the configured database, connecting first if
+// needed. The connection is dropped on failure and re-established by the
+// next command.
+func (s *mongoStore) command(cmd bson.D) (bson.D, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		c, err := s.connect()
+		if err != nil {
+			return nil, err
+		}
+		s.conn = c
+	}
+	res, err := s.conn.roundTrip(append(cmd, bson.E{Key: "$db", Value: s.config.Database}))
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return nil, err
+	}
+	return res, checkReply(res)
+}
+
+// connect dials the server, authenticates and makes sure the TTL index
+// exists
+func (s *mongoStore) connect() (*conn, error) {
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	var nc net.Conn
+	var err error
+	if s.config.TLSConfig != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", s.config.Address, s.config.TLSConfig)
+	} else {
+		nc, err = dialer.Dial("tcp", s.config.Address)
+	}
+	if err != nil {
+		return nil, store.Unavailable(err)
+	}
+	c := &conn{Conn: nc, timeout: s.config.Timeout}
+	if err := s.setup(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *mongoStore) setup(c *conn) error {
+	if s.config.Username != "" {
+		if err := s.authenticate(c); err != nil {
+			return err
+		}
+	}
+	res, err := c.roundTrip(bson.D{
+		{Key: "createIndexes", Value: s.config.Collection},
+		{Key: "indexes", Value: []interface{}{bson.D{
+			{Key: "key", Value: bson.D{{Key: "expires_at", Value: int32(1)}}},
+			{Key: "name", Value: "expires_at_ttl"},
+			{Key: "expireAfterSeconds", Value: int32(0)},
+		}}},
+		{Key: "$db", Value: s.config.Database},
+	})
+	if err != nil {
+		return err
+	}
+	return checkReply(res)
+}
@@ -0,0 +1,134 @@
+// Package multi implements a store replicating keys to several underlying
+// stores, e.g. Redis in two regions, for active-active deployments: tokens
+// signed in one region verify in the other as soon as the key is written,
+// without waiting for replication of the underlying stores.
+//
+// Keys are written to every store and read from the nearest one holding
+// them. Key IDs identify keys across the stores: when stores hold different
+// versions of a key, the version of the nearest store wins.
+package multi
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+// New creates a store replicating keys to nearest and others. Reads try
+// nearest first and fall back to the others in order, and the store lock is
+// the lock of nearest, so instances sharing nearest rotate together while
+// other regions rotate independently. If nearest supports renewing its
+// lock, so does the returned store.
+func New(nearest store.Store, others ...store.Store) store.Store {
+	s := &multiStore{stores: append([]store.Store{nearest}, others...), locker: store.AsLocker(nearest)}
+	if renewer, ok := nearest.(store.LockRenewer); ok {
+		return &renewingStore{multiStore: s, renewer: renewer}
+	}
+	return s
+}
+
+type multiStore struct {
+	stores []store.Store
+	// locker is the lock of the nearest store
+	locker store.Locker
+}
+
+// Add writes key to every store. If any write fails, including with
+// store.ErrKeyIDConflict, the key is deleted from the stores it was already
+// written to, so the keychain can retry with another ID.
+func (s *multiStore) Add(key store.Key) error {
+	for i, st := range s.stores {
+		if err := st.Add(key); err != nil {
+			for _, written := range s.stores[:i] {
+				_ = written.Delete(key.ID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns the key from the first store holding it. Unavailable stores
+// are skipped, and their error is only returned if no store has the key.
+func (s *multiStore) Find(id string) (store.Key, error) {
+	var firstErr error
+	for _, st := range s.stores {
+		key, err := st.Find(id)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, ring.ErrKeyNotFound) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return store.Key{}, firstErr
+	}
+	return store.Key{}, ring.ErrKeyNotFound
+}
+
+// Delete removes the key from every store, returning the first error
+func (s *multiStore) Delete(id string) error {
+	var firstErr error
+	for _, st := range s.stores {
+		if err := st.Delete(id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// List merges the keys of all stores by ID. Unavailable stores are skipped,
+// and an error is only returned if no store could be listed.
+func (s *multiStore) List() (store.KeyList, error) {
+	var (
+		keys     store.KeyList
+		seen     = make(map[string]bool)
+		listed   bool
+		firstErr error
+	)
+	for _, st := range s.stores {
+		stored, err := st.List()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		listed = true
+		for _, key := range stored {
+			if !seen[key.ID] {
+				seen[key.ID] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	if !listed {
+		return nil, firstErr
+	}
+	return keys, nil
+}
+
+func (s *multiStore) Lock() error {
+	return s.locker.Lock()
+}
+
+func (s *multiStore) Unlock() error {
+	return s.locker.Unlock()
+}
+
+// renewingStore is a multiStore whose nearest store can renew its lock
+type renewingStore struct {
+	*multiStore
+	renewer store.LockRenewer
+}
+
+func (s *renewingStore) LockTTL() time.Duration {
+	return s.renewer.LockTTL()
+}
+
+func (s *renewingStore) RenewLock() error {
+	return s.renewer.RenewLock()
+}
@@ -0,0 +1,122 @@
+package multi_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
+	"github.com/hsson/ring/store/multi"
+)
+
+// downStore fails all operations as if its region could not be reached
+type downStore struct {
+	store.Store
+	down bool
+}
+
+func (s *downStore) err() error {
+	if s.down {
+		return store.Unavailable(errors.New("connection refused"))
+	}
+	return nil
+}
+
+func (s *downStore) Add(key store.Key) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+	return s.Store.Add(key)
+}
+
+func (s *downStore) Find(id string) (store.Key, error) {
+	if err := s.err(); err != nil {
+		return store.Key{}, err
+	}
+	return s.Store.Find(id)
+}
+
+func (s *downStore) List() (store.KeyList, error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	return s.Store.List()
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		return multi.New(inmem.NewInMemoryStore(), inmem.NewInMemoryStore())
+	})
+}
+
+func TestActiveActive(t *testing.T) {
+	east := &downStore{Store: inmem.NewInMemoryStore()}
+	west := &downStore{Store: inmem.NewInMemoryStore()}
+	inEast, inWest := multi.New(east, west), multi.New(west, east)
+
+	keychain, err := ring.NewKeychain(inEast, ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, keyID, err := keychain.Sign([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := ring.NewVerifierOnly(inWest)
+	key, err := verifier.GetVerifier(keyID)
+	if err != nil {
+		t.Fatalf("expected key signed in the east to verify in the west, got %v", err)
+	}
+	if key.ID != keyID {
+		t.Errorf("expected key %s, got %s", keyID, key.ID)
+	}
+	if err := keychain.Verify(keyID, []byte("data"), signature); err != nil {
+		t.Error(err)
+	}
+
+	// Reads tolerate the other region being down
+	east.down = true
+	if _, err := inWest.Find("pub:" + keyID); err != nil {
+		t.Errorf("expected key to be found in the west, got %v", err)
+	}
+	if keys, err := inWest.List(); err != nil || len(keys) == 0 {
+		t.Errorf("expected keys of the west, got %v", err)
+	}
+	if _, err := inWest.Find("unknown"); !errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected ErrStoreUnavailable while a region is down, got %v", err)
+	}
+
+	// Failed writes are rolled back
+	added := store.Key{ID: "added", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := inWest.Add(added); !errors.Is(err, ring.ErrStoreUnavailable) {
+		t.Errorf("expected ErrStoreUnavailable, got %v", err)
+	}
+	if _, err := west.Find(added.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected failed write to be rolled back, got %v", err)
+	}
+}
+
+func TestNearestWins(t *testing.T) {
+	east, west := inmem.NewInMemoryStore(), inmem.NewInMemoryStore()
+	expiresAt := time.Now().Add(time.Hour)
+	if err := east.Add(store.Key{ID: "key", ExpiresAt: expiresAt, Data: []byte("east")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := west.Add(store.Key{ID: "key", ExpiresAt: expiresAt, Data: []byte("west")}); err != nil {
+		t.Fatal(err)
+	}
+	s := multi.New(west, east)
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || string(keys[0].Data) != "west" {
+		t.Errorf("expected the key of the nearest store, got %v", keys)
+	}
+	if key, err := s.Find("key"); err != nil || string(key.Data) != "west" {
+		t.Errorf("expected the key of the nearest store, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package oskeyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const securityExitItemNotFound = 44
+
+// keychainBackend stores secrets as generic passwords in the macOS
+// login keychain using the security command line tool.
+type keychainBackend struct{}
+
+func platformBackend() backend {
+	return keychainBackend{}
+}
+
+func (keychainBackend) get(service, account string) ([]byte, error) {
+	out, err := exec.Command("/usr/bin/security", "find-generic-password",
+		"-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return nil, securityError(err)
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+// addCommand returns the command storing data. The secret would be visible
+// to other users in the process list if passed as an argument, so the
+// command is instead read from stdin by security in interactive mode.
+func addCommand(service, account string, data []byte) *exec.Cmd {
+	cmd := exec.Command("/usr/bin/security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		securityQuote(service), securityQuote(account), base64.StdEncoding.EncodeToString(data)))
+	return cmd
+}
+
+// securityQuote quotes an argument of a command read by security in
+// interactive mode
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (keychainBackend) set(service, account string, data []byte) error {
+	cmd := addCommand(service, account, data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return securityError(err)
+	}
+	// security does not exit with an error if a command read from stdin
+	// fails, but reports it on stderr
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("hsson/ring/oskeyring: %s", msg)
+	}
+	return nil
+}
+
+func (keychainBackend) delete(service, account string) error {
+	err := exec.Command("/usr/bin/security", "delete-generic-password",
+		"-s", service, "-a", account).Run()
+	return securityError(err)
+}
+
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityExitItemNotFound {
+		return errNotFound
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package oskeyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestAddCommandKeepsSecretOutOfArgs(t *testing.T) {
+	data := []byte("private key")
+	encoded := base64.StdEncoding.EncodeToString(data)
+	cmd := addCommand("test", "pub:key", data)
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, encoded) || strings.Contains(arg, string(data)) {
+			t.Errorf("expected secret not to be passed as argument, got %q", cmd.Args)
+		}
+	}
+	stdin, err := ioutil.ReadAll(cmd.Stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(stdin, []byte(encoded)) {
+		t.Errorf("expected secret to be passed on stdin, got %q", stdin)
+	}
+}
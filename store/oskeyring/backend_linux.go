@@ -0,0 +1,64 @@
+package oskeyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// secretServiceBackend stores secrets in the Secret Service (e.g. GNOME
+// Keyring or KWallet) using the secret-tool command line tool.
+type secretServiceBackend struct{}
+
+func platformBackend() backend {
+	return secretServiceBackend{}
+}
+
+func (secretServiceBackend) get(service, account string) ([]byte, error) {
+	cmd := exec.Command("secret-tool", "lookup",
+		"service", service, "account", account)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, lookupError(err, stderr.Bytes())
+	}
+	if len(out) == 0 {
+		return nil, errNotFound
+	}
+	return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(out)))
+}
+
+// lookupError maps a failed secret-tool lookup to errNotFound if the secret
+// does not exist, in which case secret-tool exits with 1 and no message. A
+// locked collection, a dismissed unlock prompt or an unreachable D-Bus
+// session are reported on stderr, and must not be mistaken for a missing
+// secret.
+func lookupError(err error, stderr []byte) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	msg := bytes.TrimSpace(stderr)
+	if exitErr.ExitCode() == 1 && len(msg) == 0 {
+		return errNotFound
+	}
+	if len(msg) == 0 {
+		return fmt.Errorf("hsson/ring/oskeyring: secret-tool lookup failed: %w", err)
+	}
+	return fmt.Errorf("hsson/ring/oskeyring: secret-tool lookup failed: %s", msg)
+}
+
+func (secretServiceBackend) set(service, account string, data []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label", service+" "+account,
+		"service", service, "account", account)
+	cmd.Stdin = bytes.NewBufferString(base64.StdEncoding.EncodeToString(data))
+	return cmd.Run()
+}
+
+func (secretServiceBackend) delete(service, account string) error {
+	return exec.Command("secret-tool", "clear",
+		"service", service, "account", account).Run()
+}
@@ -0,0 +1,29 @@
+package oskeyring
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestLookupError(t *testing.T) {
+	exit := func(code string) error {
+		return exec.Command("sh", "-c", "exit "+code).Run()
+	}
+	if err := lookupError(exit("1"), nil); !errors.Is(err, errNotFound) {
+		t.Errorf("expected errNotFound for a missing secret, got %v", err)
+	}
+	for _, test := range []struct {
+		err    error
+		stderr string
+	}{
+		{exit("1"), "Cannot create an item in a locked collection"},
+		{exit("1"), "Cannot autolaunch D-Bus without X11 $DISPLAY"},
+		{exit("2"), ""},
+		{errors.New("exec: \"secret-tool\": executable file not found in $PATH"), ""},
+	} {
+		if err := lookupError(test.err, []byte(test.stderr)); err == nil || errors.Is(err, errNotFound) {
+			t.Errorf("expected %v (%q) not to be reported as missing, got %v", test.err, test.stderr, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package oskeyring
+
+type unsupportedBackend struct{}
+
+func platformBackend() backend {
+	return unsupportedBackend{}
+}
+
+func (unsupportedBackend) get(service, account string) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (unsupportedBackend) set(service, account string, data []byte) error {
+	return errUnsupported
+}
+
+func (unsupportedBackend) delete(service, account string) error {
+	return errUnsupported
+}
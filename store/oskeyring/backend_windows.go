@@ -0,0 +1,114 @@
+package oskeyring
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+)
+
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+func newBlob(data []byte) *dataBlob {
+	if len(data) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{size: uint32(len(data)), data: &data[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	out := make([]byte, b.size)
+	copy(out, (*[1 << 30]byte)(unsafe.Pointer(b.data))[:b.size:b.size])
+	return out
+}
+
+// dpapiBackend stores secrets as files in the user's application data
+// directory, encrypted with DPAPI so that only the current user can
+// decrypt them.
+type dpapiBackend struct{}
+
+func platformBackend() backend {
+	return dpapiBackend{}
+}
+
+// path returns the file of a secret. Accounts are key IDs like pub:<id>,
+// which are hex encoded as ':' would refer to an alternate data stream on
+// NTFS, and IDs of namespaces may contain path separators. Hex rather than
+// base64 keeps names distinct on case-insensitive file systems.
+func (dpapiBackend) path(service, account string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hsson-ring", service, accountFile(account)), nil
+}
+
+func accountFile(account string) string {
+	return hex.EncodeToString([]byte(account))
+}
+
+func (b dpapiBackend) get(service, account string) ([]byte, error) {
+	path, err := b.path(service, account)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out dataBlob
+	r, _, err := procCryptUnprotectData.Call(uintptr(unsafe.Pointer(newBlob(encrypted))),
+		0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, err
+	}
+	defer syscall.LocalFree(syscall.Handle(unsafe.Pointer(out.data)))
+	return out.bytes(), nil
+}
+
+func (b dpapiBackend) set(service, account string, data []byte) error {
+	path, err := b.path(service, account)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	var out dataBlob
+	r, _, err := procCryptProtectData.Call(uintptr(unsafe.Pointer(newBlob(data))),
+		0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return err
+	}
+	defer syscall.LocalFree(syscall.Handle(unsafe.Pointer(out.data)))
+	return ioutil.WriteFile(path, out.bytes(), 0600)
+}
+
+func (b dpapiBackend) delete(service, account string) error {
+	path, err := b.path(service, account)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return errNotFound
+	}
+	return err
+}
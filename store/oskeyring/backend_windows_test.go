@@ -0,0 +1,20 @@
+package oskeyring
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccountFile(t *testing.T) {
+	seen := map[string]string{}
+	for _, account := range []string{indexAccount, "pub:key", "priv:key", "pub:tenant/key", "pub:other/key", "pub:KEY", `pub:a\key`} {
+		name := accountFile(account)
+		if strings.ContainsAny(name, `:/\`) {
+			t.Errorf("expected file name of %q without separators, got %q", account, name)
+		}
+		if other, ok := seen[strings.ToLower(name)]; ok {
+			t.Errorf("expected %q and %q to be stored in different files, got %q", account, other, name)
+		}
+		seen[strings.ToLower(name)] = account
+	}
+}
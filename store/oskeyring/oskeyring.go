@@ -0,0 +1,215 @@
+// Package oskeyring implements a store which keeps keys in the native
+// credential storage of the operating system: the Keychain on macOS, the
+// Secret Service (via secret-tool) on Linux and DPAPI protected files on
+// Windows. It is intended for desktop and command-line applications, where
+// keeping private keys in plaintext files is not desirable.
+package oskeyring
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+const indexAccount = "ring:index"
+
+var (
+	errNotFound    = errors.New("hsson/ring/oskeyring: secret not found")
+	errUnsupported = errors.New("hsson/ring/oskeyring: platform not supported")
+)
+
+// backend is the platform specific credential storage
+type backend interface {
+	get(service, account string) ([]byte, error)
+	set(service, account string, data []byte) error
+	delete(service, account string) error
+}
+
+type indexEntry struct {
+	ID        string            `json:"id"`
+	IsPrivate bool              `json:"private"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// New creates a new store keeping keys in the operating system's credential
+// storage. All keys are saved under the given service name, which should be
+// unique to the application.
+func New(service string) store.Store {
+	return &keyringStore{
+		service: service,
+		backend: platformBackend(),
+	}
+}
+
+type keyringStore struct {
+	mu sync.Mutex
+
+	service string
+	backend backend
+	locked  bool
+}
+
+func (s *keyringStore) index() ([]indexEntry, error) {
+	data, err := s.backend.get(s.service, indexAccount)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index []indexEntry
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (s *keyringStore) saveIndex(index []indexEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return s.backend.set(s.service, indexAccount, data)
+}
+
+func (s *keyringStore) Add(key store.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.index()
+	if err != nil {
+		return err
+	}
+	for i, entry := range index {
+		if entry.ID != key.ID {
+			continue
+		}
+		// An entry whose secret is gone, e.g. deleted outside of the
+		// store, is replaced
+		if _, err := s.backend.get(s.service, key.ID); !errors.Is(err, errNotFound) {
+			if err != nil {
+				return err
+			}
+			return store.ErrKeyIDConflict
+		}
+		index = append(index[:i], index[i+1:]...)
+		break
+	}
+
+	if err := s.backend.set(s.service, key.ID, key.Data); err != nil {
+		return err
+	}
+	index = append(index, indexEntry{
+		ID:        key.ID,
+		IsPrivate: key.IsPrivate,
+		ExpiresAt: key.ExpiresAt,
+		Metadata:  key.Metadata,
+	})
+	return s.saveIndex(index)
+}
+
+// load reads the secret of entry. The index is saved after adding the
+// secret and before deleting it, so a secret without an entry is never
+// found, and an entry without a secret is reported as ErrKeyNotFound.
+func (s *keyringStore) load(entry indexEntry) (store.Key, error) {
+	data, err := s.backend.get(s.service, entry.ID)
+	if errors.Is(err, errNotFound) {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	if err != nil {
+		return store.Key{}, err
+	}
+	return store.Key{
+		ID:        entry.ID,
+		IsPrivate: entry.IsPrivate,
+		ExpiresAt: entry.ExpiresAt,
+		Data:      data,
+		Metadata:  entry.Metadata,
+	}, nil
+}
+
+func (s *keyringStore) Find(id string) (store.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.index()
+	if err != nil {
+		return store.Key{}, err
+	}
+	for _, entry := range index {
+		if entry.ID == id {
+			return s.load(entry)
+		}
+	}
+	return store.Key{}, ring.ErrKeyNotFound
+}
+
+func (s *keyringStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.index()
+	if err != nil {
+		return err
+	}
+	for i, entry := range index {
+		if entry.ID == id {
+			index = append(index[:i], index[i+1:]...)
+			if err := s.saveIndex(index); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	if err := s.backend.delete(s.service, id); err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *keyringStore) List() (store.KeyList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+	all := make(store.KeyList, 0, len(index))
+	for _, entry := range index {
+		key, err := s.load(entry)
+		if errors.Is(err, ring.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+// Lock only guards against concurrent key creation within the current
+// process, as the credential storage is private to a single user.
+func (s *keyringStore) Lock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return store.ErrLockOccupied
+	}
+	s.locked = true
+	return nil
+}
+
+func (s *keyringStore) Unlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locked = false
+	return nil
+}
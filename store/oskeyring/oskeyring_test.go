@@ -0,0 +1,151 @@
+package oskeyring
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+)
+
+// fakeBackend keeps secrets in memory. Deletes fail with failDelete, if
+// set.
+type fakeBackend struct {
+	secrets    map[string][]byte
+	failDelete error
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{secrets: map[string][]byte{}}
+}
+
+func (b *fakeBackend) get(service, account string) ([]byte, error) {
+	data, ok := b.secrets[service+"/"+account]
+	if !ok {
+		return nil, errNotFound
+	}
+	return data, nil
+}
+
+func (b *fakeBackend) set(service, account string, data []byte) error {
+	b.secrets[service+"/"+account] = data
+	return nil
+}
+
+func (b *fakeBackend) delete(service, account string) error {
+	if b.failDelete != nil {
+		return b.failDelete
+	}
+	if _, ok := b.secrets[service+"/"+account]; !ok {
+		return errNotFound
+	}
+	delete(b.secrets, service+"/"+account)
+	return nil
+}
+
+func getStore() (*fakeBackend, store.Store) {
+	backend := newFakeBackend()
+	return backend, &keyringStore{service: "test", backend: backend}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		_, s := getStore()
+		return s
+	})
+}
+
+func TestAddFindDelete(t *testing.T) {
+	_, s := getStore()
+	k := store.Key{
+		ID:        "key",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour).Round(0),
+		Data:      []byte("data"),
+		Metadata:  map[string]string{"algorithm": "Ed25519"},
+	}
+
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	// The ExpiresAt and Metadata round-trip through the JSON index
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) || !reflect.DeepEqual(found.Metadata, k.Metadata) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("got %d keys want 1", len(keys))
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(k.ID); err != nil {
+		t.Errorf("expected deleting missing key to succeed, got %v", err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestIndexAndSecretDisagree(t *testing.T) {
+	backend, s := getStore()
+	k := store.Key{ID: "key", ExpiresAt: time.Now().Add(time.Hour), Data: []byte("data")}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+
+	// The secret is left behind if deleting it fails after the index is
+	// saved, but the key is gone
+	backend.failDelete = errors.New("keyring locked")
+	if err := s.Delete(k.ID); !errors.Is(err, backend.failDelete) {
+		t.Errorf("expected the error of the backend, got %v", err)
+	}
+	backend.failDelete = nil
+	if _, ok := backend.secrets["test/"+k.ID]; !ok {
+		t.Fatal("expected the secret to be left behind")
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound for a secret without an index entry, got %v", err)
+	}
+	if keys, err := s.List(); err != nil || len(keys) != 0 {
+		t.Errorf("expected no keys, got %+v: %v", keys, err)
+	}
+	k.Data = []byte("new data")
+	if err := s.Add(k); err != nil {
+		t.Fatalf("expected the ID to be reusable, got %v", err)
+	}
+	if found, err := s.Find(k.ID); err != nil || string(found.Data) != "new data" {
+		t.Errorf("expected the secret to be replaced, got %+v: %v", found, err)
+	}
+
+	// An index entry whose secret is gone is not found, and replaced by Add
+	delete(backend.secrets, "test/"+k.ID)
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound for an index entry without a secret, got %v", err)
+	}
+	if keys, err := s.List(); err != nil || len(keys) != 0 {
+		t.Errorf("expected no keys, got %+v: %v", keys, err)
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatalf("expected the entry to be replaced, got %v", err)
+	}
+	if keys, err := s.List(); err != nil || len(keys) != 1 {
+		t.Errorf("expected a single key, got %+v: %v", keys, err)
+	}
+}
@@ -0,0 +1,344 @@
+// Package sql implements a store on top of database/sql, supporting
+// Postgres and MySQL. Keys are kept in a single table, and the store lock is
+// implemented using session level advisory locks (pg_try_advisory_lock in
+// Postgres and GET_LOCK in MySQL), which are released automatically by the
+// database if the holding connection is lost.
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+// Dialect is the SQL dialect of the database
+type Dialect int
+
+const (
+	// Postgres dialect
+	Postgres Dialect = iota
+	// MySQL dialect
+	MySQL
+)
+
+const defaultTable = "ring_keys"
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Options customize the SQL store
+type Options struct {
+	// Dialect of the database. Default: Postgres
+	Dialect Dialect
+	// Table in which keys are kept. It is created if it does not exist.
+	// Default: ring_keys
+	Table string
+}
+
+// New creates a new store keeping keys in the given database, creating the
+// key table if it does not already exist. The database driver must be
+// imported by the caller.
+func New(db *sql.DB, options Options) (store.Store, error) {
+	if options.Table == "" {
+		options.Table = defaultTable
+	}
+	if !identifierPattern.MatchString(options.Table) {
+		return nil, fmt.Errorf("hsson/ring/sql: invalid table name %q", options.Table)
+	}
+
+	s := &sqlStore{db: db, options: options}
+	dataType := "BYTEA"
+	if options.Dialect == MySQL {
+		dataType = "BLOB"
+	}
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id VARCHAR(255) PRIMARY KEY,
+		is_private BOOLEAN NOT NULL,
+		expires_at BIGINT NOT NULL,
+		data %s NOT NULL,
+		metadata TEXT
+	)`, options.Table, dataType))
+	if err != nil {
+		return nil, err
+	}
+	// Tables created by earlier versions lack the metadata column
+	if _, err := db.Exec(fmt.Sprintf("SELECT metadata FROM %s WHERE 1 = 0", options.Table)); err != nil {
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN metadata TEXT", options.Table)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+type sqlStore struct {
+	db      *sql.DB
+	options Options
+
+	mu       sync.Mutex
+	lockConn *sql.Conn
+}
+
+// query rewrites ? placeholders to the $n form used by Postgres
+func (s *sqlStore) query(query string) string {
+	if s.options.Dialect == MySQL {
+		return query
+	}
+	var out []byte
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			out = append(out, fmt.Sprintf("$%d", n)...)
+			continue
+		}
+		out = append(out, query[i])
+	}
+	return string(out)
+}
+
+// transient marks failures to reach the database as store.Unavailable,
+// leaving errors reported by the database itself as they are
+func transient(err error) error {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return store.Unavailable(err)
+	}
+	return err
+}
+
+func (s *sqlStore) Add(key store.Key) error {
+	var metadata sql.NullString
+	if len(key.Metadata) != 0 {
+		data, err := json.Marshal(key.Metadata)
+		if err != nil {
+			return err
+		}
+		metadata = sql.NullString{String: string(data), Valid: true}
+	}
+	insert := "INSERT INTO %s (id, is_private, expires_at, data, metadata) VALUES (?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING"
+	if s.options.Dialect == MySQL {
+		insert = "INSERT IGNORE INTO %s (id, is_private, expires_at, data, metadata) VALUES (?, ?, ?, ?, ?)"
+	}
+	res, err := s.db.Exec(s.query(fmt.Sprintf(insert, s.options.Table)),
+		key.ID, key.IsPrivate, key.ExpiresAt.UnixNano(), key.Data, metadata)
+	if err != nil {
+		return transient(err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return store.ErrKeyIDConflict
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row scanner) (store.Key, error) {
+	var key store.Key
+	var expiresAt int64
+	var metadata sql.NullString
+	if err := row.Scan(&key.ID, &key.IsPrivate, &expiresAt, &key.Data, &metadata); err != nil {
+		return store.Key{}, err
+	}
+	key.ExpiresAt = time.Unix(0, expiresAt)
+	if metadata.Valid {
+		if err := json.Unmarshal([]byte(metadata.String), &key.Metadata); err != nil {
+			return store.Key{}, err
+		}
+	}
+	return key, nil
+}
+
+func (s *sqlStore) Find(id string) (store.Key, error) {
+	row := s.db.QueryRow(s.query(fmt.Sprintf(
+		"SELECT id, is_private, expires_at, data, metadata FROM %s WHERE id = ?", s.options.Table)), id)
+	key, err := scanKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Key{}, ring.ErrKeyNotFound
+	}
+	return key, transient(err)
+}
+
+func (s *sqlStore) Delete(id string) error {
+	_, err := s.db.Exec(s.query(fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.options.Table)), id)
+	return transient(err)
+}
+
+func (s *sqlStore) List() (store.KeyList, error) {
+	return s.ListFiltered(store.KeyFilter{})
+}
+
+// likeEscaper escapes the LIKE wildcards of an ID prefix, using ! as the
+// escape character since backslashes are treated differently by the dialects
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// ListFiltered selects the keys in the query
+func (s *sqlStore) ListFiltered(filter store.KeyFilter) (store.KeyList, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.IsPrivate != nil {
+		conditions = append(conditions, "is_private = ?")
+		args = append(args, *filter.IsPrivate)
+	}
+	if !filter.NotExpiredAt.IsZero() {
+		conditions = append(conditions, "expires_at > ?")
+		args = append(args, filter.NotExpiredAt.UnixNano())
+	}
+	if filter.IDPrefix != "" {
+		conditions = append(conditions, "id LIKE ? ESCAPE '!'")
+		args = append(args, likeEscaper.Replace(filter.IDPrefix)+"%")
+	}
+	return s.selectKeys(conditions, args)
+}
+
+// FindMany selects all keys with the ids in a single query
+func (s *sqlStore) FindMany(ids []string) (store.KeyList, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	return s.selectKeys([]string{"id IN (" + placeholders + ")"}, args)
+}
+
+// Iterate streams the keys from the rows of the query
+func (s *sqlStore) Iterate(yield func(store.Key) bool) error {
+	return s.eachKey(nil, nil, yield)
+}
+
+// selectKeys returns the keys matching all conditions
+func (s *sqlStore) selectKeys(conditions []string, args []interface{}) (store.KeyList, error) {
+	var all store.KeyList
+	err := s.eachKey(conditions, args, func(key store.Key) bool {
+		all = append(all, key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// eachKey calls yield for the keys matching all conditions, until it
+// returns false
+func (s *sqlStore) eachKey(conditions []string, args []interface{}, yield func(store.Key) bool) error {
+	query := fmt.Sprintf("SELECT id, is_private, expires_at, data, metadata FROM %s", s.options.Table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := s.db.Query(s.query(query), args...)
+	if err != nil {
+		return transient(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return err
+		}
+		if !yield(key) {
+			return nil
+		}
+	}
+	return transient(rows.Err())
+}
+
+// mysqlMaxLockName is the longest lock name accepted by GET_LOCK
+const mysqlMaxLockName = 64
+
+func (s *sqlStore) lockName() string {
+	return "hsson-ring:" + s.options.Table
+}
+
+// mysqlLockName is the lockName, or for tables whose lockName is too long
+// for GET_LOCK, a hash of the table name
+func (s *sqlStore) mysqlLockName() string {
+	if name := s.lockName(); len(name) <= mysqlMaxLockName {
+		return name
+	}
+	sum := sha256.Sum256([]byte(s.options.Table))
+	return "hsson-ring:" + hex.EncodeToString(sum[:16])
+}
+
+func (s *sqlStore) lockID() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(s.lockName()))
+	return int64(h.Sum64())
+}
+
+func (s *sqlStore) Lock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockConn != nil {
+		return store.ErrLockOccupied
+	}
+
+	// Advisory locks belong to a database session, so a dedicated
+	// connection is held for as long as the lock is
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return transient(err)
+	}
+
+	var acquired bool
+	if s.options.Dialect == MySQL {
+		err = conn.QueryRowContext(ctx, "SELECT COALESCE(GET_LOCK(?, 0), 0) = 1", s.mysqlLockName()).Scan(&acquired)
+	} else {
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", s.lockID()).Scan(&acquired)
+	}
+	if err != nil || !acquired {
+		conn.Close()
+		if err != nil {
+			return transient(err)
+		}
+		return store.ErrLockOccupied
+	}
+
+	s.lockConn = conn
+	return nil
+}
+
+func (s *sqlStore) Unlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockConn == nil {
+		return nil
+	}
+	defer func() {
+		s.lockConn.Close()
+		s.lockConn = nil
+	}()
+
+	var err error
+	ctx := context.Background()
+	if s.options.Dialect == MySQL {
+		_, err = s.lockConn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", s.mysqlLockName())
+	} else {
+		_, err = s.lockConn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", s.lockID())
+	}
+	return err
+}
@@ -0,0 +1,548 @@
+package sql_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	ringsql "github.com/hsson/ring/store/sql"
+)
+
+type fakeRow struct {
+	id        string
+	isPrivate bool
+	expiresAt int64
+	data      []byte
+	// metadata is nil for NULL, or a string
+	metadata driver.Value
+}
+
+// fakeDB is an in-memory database understanding the statements of the store
+// in one dialect. Statements of the other dialect, or with placeholders of
+// the other dialect, fail like a syntax error.
+type fakeDB struct {
+	dialect ringsql.Dialect
+
+	mu     sync.Mutex
+	tables map[string]map[string]fakeRow
+	// locks are the advisory locks held, by name or ID, and the connection
+	// holding them
+	locks map[string]*fakeConn
+	// lockNames are the names passed to GET_LOCK
+	lockNames []string
+	down      bool
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("ringfake", fakeDriver{})
+}
+
+// newFakeDB creates an empty database of dialect, and returns it along with
+// its name to open it with
+func newFakeDB(dialect ringsql.Dialect) (*fakeDB, string) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	name := strconv.Itoa(len(fakeDBs))
+	db := &fakeDB{dialect: dialect, tables: map[string]map[string]fakeRow{}, locks: map[string]*fakeConn{}}
+	fakeDBs[name] = db
+	return db, name
+}
+
+func openFakeDB(t *testing.T, name string) *sql.DB {
+	db, err := sql.Open("ringfake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newStore(t *testing.T, dialect ringsql.Dialect, options ringsql.Options) (*fakeDB, store.Store) {
+	fake, name := newFakeDB(dialect)
+	options.Dialect = dialect
+	s, err := ringsql.New(openFakeDB(t, name), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, s
+}
+
+func (db *fakeDB) setDown(down bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.down = down
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	db, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown database %q", name)
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+// Close ends the session, releasing its advisory locks
+func (c *fakeConn) Close() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for name, holder := range c.db.locks {
+		if holder == c {
+			delete(c.db.locks, name)
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	affected, _, err := s.conn.db.run(s.conn, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, rows, err := s.conn.db.run(s.conn, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &fakeRows{columns: []string{"result"}}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var (
+	postgresPlaceholder = regexp.MustCompile(`\$(\d+)`)
+	insertPattern       = regexp.MustCompile(`^INSERT (IGNORE )?INTO (\w+) \(id, is_private, expires_at, data, metadata\) VALUES \(\?, \?, \?, \?, \?\)( ON CONFLICT \(id\) DO NOTHING)?$`)
+	selectPattern       = regexp.MustCompile(`^SELECT id, is_private, expires_at, data, metadata FROM (\w+)(?: WHERE (.*))?$`)
+	deletePattern       = regexp.MustCompile(`^DELETE FROM (\w+) WHERE id = \?$`)
+	inPattern           = regexp.MustCompile(`^id IN \(\?(?:, \?)*\)$`)
+)
+
+// placeholders checks that the placeholders of query are of the dialect
+// and match args, and returns query with ? placeholders
+func (db *fakeDB) placeholders(query string, args []driver.Value) (string, error) {
+	if db.dialect == ringsql.MySQL {
+		if strings.Contains(query, "$") || strings.Count(query, "?") != len(args) {
+			return "", fmt.Errorf("syntax error in %q", query)
+		}
+		return query, nil
+	}
+	matches := postgresPlaceholder.FindAllStringSubmatch(query, -1)
+	if strings.Contains(query, "?") || len(matches) != len(args) {
+		return "", fmt.Errorf("syntax error in %q", query)
+	}
+	for i, match := range matches {
+		if match[1] != strconv.Itoa(i+1) {
+			return "", fmt.Errorf("unexpected placeholder %s in %q", match[0], query)
+		}
+	}
+	return postgresPlaceholder.ReplaceAllString(query, "?"), nil
+}
+
+// run runs query, returning the number of affected rows and the selected
+// rows
+func (db *fakeDB) run(conn *fakeConn, query string, args []driver.Value) (int64, *fakeRows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.down {
+		return 0, nil, driver.ErrBadConn
+	}
+	query, err := db.placeholders(strings.Join(strings.Fields(query), " "), args)
+	if err != nil {
+		return 0, nil, err
+	}
+	mysql := db.dialect == ringsql.MySQL
+
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS "):
+		dataType := "data BYTEA"
+		if mysql {
+			dataType = "data BLOB"
+		}
+		if !strings.Contains(query, dataType) {
+			return 0, nil, fmt.Errorf("syntax error in %q", query)
+		}
+		if table := strings.Fields(query)[5]; db.tables[table] == nil {
+			db.tables[table] = map[string]fakeRow{}
+		}
+		return 0, nil, nil
+	case strings.HasPrefix(query, "SELECT metadata FROM "):
+		if db.tables[strings.Fields(query)[3]] == nil {
+			return 0, nil, fmt.Errorf("no such table in %q", query)
+		}
+		return 0, &fakeRows{columns: []string{"metadata"}}, nil
+	case query == "SELECT COALESCE(GET_LOCK(?, 0), 0) = 1" && mysql:
+		name := args[0].(string)
+		if len(name) > 64 {
+			return 0, nil, fmt.Errorf("incorrect user-level lock name %q", name)
+		}
+		db.lockNames = append(db.lockNames, name)
+		return 0, db.lock(conn, name), nil
+	case query == "SELECT RELEASE_LOCK(?)" && mysql:
+		return 0, db.unlock(conn, args[0].(string)), nil
+	case query == "SELECT pg_try_advisory_lock(?)" && !mysql:
+		return 0, db.lock(conn, strconv.FormatInt(args[0].(int64), 10)), nil
+	case query == "SELECT pg_advisory_unlock(?)" && !mysql:
+		return 0, db.unlock(conn, strconv.FormatInt(args[0].(int64), 10)), nil
+	}
+
+	if m := insertPattern.FindStringSubmatch(query); m != nil && (m[1] != "") == mysql && (m[3] != "") == !mysql {
+		table, err := db.table(m[2])
+		if err != nil {
+			return 0, nil, err
+		}
+		id := args[0].(string)
+		if _, ok := table[id]; ok {
+			return 0, nil, nil
+		}
+		data := append([]byte(nil), args[3].([]byte)...)
+		table[id] = fakeRow{id: id, isPrivate: args[1].(bool), expiresAt: args[2].(int64), data: data, metadata: args[4]}
+		return 1, nil, nil
+	}
+	if m := deletePattern.FindStringSubmatch(query); m != nil {
+		table, err := db.table(m[1])
+		if err != nil {
+			return 0, nil, err
+		}
+		id := args[0].(string)
+		if _, ok := table[id]; !ok {
+			return 0, nil, nil
+		}
+		delete(table, id)
+		return 1, nil, nil
+	}
+	if m := selectPattern.FindStringSubmatch(query); m != nil {
+		table, err := db.table(m[1])
+		if err != nil {
+			return 0, nil, err
+		}
+		match, err := where(m[2], args)
+		if err != nil {
+			return 0, nil, err
+		}
+		rows := &fakeRows{columns: []string{"id", "is_private", "expires_at", "data", "metadata"}}
+		for _, row := range table {
+			if match(row) {
+				rows.values = append(rows.values, []driver.Value{row.id, row.isPrivate, row.expiresAt, row.data, row.metadata})
+			}
+		}
+		sort.Slice(rows.values, func(i, j int) bool { return rows.values[i][0].(string) < rows.values[j][0].(string) })
+		return 0, rows, nil
+	}
+	return 0, nil, fmt.Errorf("syntax error in %q", query)
+}
+
+func (db *fakeDB) table(name string) (map[string]fakeRow, error) {
+	table, ok := db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("no such table %s", name)
+	}
+	return table, nil
+}
+
+// lock takes the advisory lock name for the session of conn, returning
+// whether it succeeded
+func (db *fakeDB) lock(conn *fakeConn, name string) *fakeRows {
+	holder, held := db.locks[name]
+	if !held {
+		db.locks[name] = conn
+	}
+	return &fakeRows{columns: []string{"acquired"}, values: [][]driver.Value{{!held || holder == conn}}}
+}
+
+func (db *fakeDB) unlock(conn *fakeConn, name string) *fakeRows {
+	released := db.locks[name] == conn
+	if released {
+		delete(db.locks, name)
+	}
+	return &fakeRows{columns: []string{"released"}, values: [][]driver.Value{{released}}}
+}
+
+// where parses the conditions of a SELECT joined by AND, taking their
+// arguments from args in order
+func where(conditions string, args []driver.Value) (func(fakeRow) bool, error) {
+	var matches []func(fakeRow) bool
+	if conditions != "" {
+		for _, condition := range strings.Split(conditions, " AND ") {
+			n := strings.Count(condition, "?")
+			switch {
+			case condition == "id = ?":
+				id := args[0].(string)
+				matches = append(matches, func(row fakeRow) bool { return row.id == id })
+			case condition == "is_private = ?":
+				private := args[0].(bool)
+				matches = append(matches, func(row fakeRow) bool { return row.isPrivate == private })
+			case condition == "expires_at > ?":
+				at := args[0].(int64)
+				matches = append(matches, func(row fakeRow) bool { return row.expiresAt > at })
+			case condition == "id LIKE ? ESCAPE '!'":
+				pattern, err := likePattern(args[0].(string))
+				if err != nil {
+					return nil, err
+				}
+				matches = append(matches, func(row fakeRow) bool { return pattern.MatchString(row.id) })
+			case inPattern.MatchString(condition):
+				ids := map[string]bool{}
+				for _, id := range args[:n] {
+					ids[id.(string)] = true
+				}
+				matches = append(matches, func(row fakeRow) bool { return ids[row.id] })
+			default:
+				return nil, fmt.Errorf("unsupported condition %q", condition)
+			}
+			args = args[n:]
+		}
+	}
+	return func(row fakeRow) bool {
+		for _, match := range matches {
+			if !match(row) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// likePattern compiles a LIKE pattern escaped with !
+func likePattern(like string) (*regexp.Regexp, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^(?s)")
+	for i := 0; i < len(like); i++ {
+		switch c := like[i]; c {
+		case '!':
+			i++
+			if i == len(like) || !strings.ContainsRune("!%_", rune(like[i])) {
+				return nil, fmt.Errorf("invalid escape in LIKE pattern %q", like)
+			}
+			pattern.WriteString(regexp.QuoteMeta(like[i : i+1]))
+		case '%':
+			pattern.WriteString(".*")
+		case '_':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(like[i : i+1]))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.Compile(pattern.String())
+}
+
+var dialects = map[string]ringsql.Dialect{"Postgres": ringsql.Postgres, "MySQL": ringsql.MySQL}
+
+func TestConformance(t *testing.T) {
+	for name, dialect := range dialects {
+		dialect := dialect
+		t.Run(name, func(t *testing.T) {
+			storetest.Run(t, func() store.Store {
+				_, s := newStore(t, dialect, ringsql.Options{})
+				return s
+			})
+		})
+	}
+}
+
+func TestInvalidTableName(t *testing.T) {
+	if _, err := ringsql.New(nil, ringsql.Options{Table: "keys; DROP TABLE users"}); err == nil {
+		t.Errorf("expected invalid table name to be rejected")
+	}
+}
+
+func TestListFiltered(t *testing.T) {
+	for name, dialect := range dialects {
+		_, s := newStore(t, dialect, ringsql.Options{})
+		now := time.Now()
+		keys := []store.Key{
+			{ID: "pub_a", ExpiresAt: now.Add(time.Hour), Data: []byte("a")},
+			{ID: "pubxa", ExpiresAt: now.Add(time.Hour), Data: []byte("a")},
+			{ID: "50%off", ExpiresAt: now.Add(time.Hour), Data: []byte("a")},
+			{ID: "50xoff", ExpiresAt: now.Add(time.Hour), Data: []byte("a")},
+			{ID: "a!b", ExpiresAt: now.Add(time.Hour), Data: []byte("a")},
+			{ID: "a!!b", ExpiresAt: now.Add(time.Hour), Data: []byte("a")},
+			{ID: "private", IsPrivate: true, ExpiresAt: now.Add(time.Hour), Data: []byte("a")},
+			{ID: "pub_expired", ExpiresAt: now.Add(-time.Hour), Data: []byte("a")},
+		}
+		for _, key := range keys {
+			if err := s.Add(key); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		public := false
+		for _, test := range []struct {
+			filter store.KeyFilter
+			want   string
+		}{
+			{store.KeyFilter{IDPrefix: "pub_"}, "pub_a pub_expired"},
+			{store.KeyFilter{IDPrefix: "pub_", NotExpiredAt: now}, "pub_a"},
+			{store.KeyFilter{IDPrefix: "50%"}, "50%off"},
+			{store.KeyFilter{IDPrefix: "a!"}, "a!!b a!b"},
+			{store.KeyFilter{IDPrefix: "a!!"}, "a!!b"},
+			{store.KeyFilter{IsPrivate: &public, NotExpiredAt: now}, "50%off 50xoff a!!b a!b pub_a pubxa"},
+		} {
+			found, err := s.(store.FilteredLister).ListFiltered(test.filter)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			ids := make([]string, len(found))
+			for i, key := range found {
+				ids[i] = key.ID
+			}
+			sort.Strings(ids)
+			if got := strings.Join(ids, " "); got != test.want {
+				t.Errorf("%s: expected %+v to list %q, got %q", name, test.filter, test.want, got)
+			}
+		}
+
+		found, err := s.(store.BatchFinder).FindMany([]string{"pub_a", "missing", "private"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(found) != 2 || found[0].ID != "private" || found[1].ID != "pub_a" {
+			t.Errorf("%s: expected FindMany to find private and pub_a, got %+v", name, found)
+		}
+	}
+}
+
+func TestLockIsSharedByStores(t *testing.T) {
+	for name, dialect := range dialects {
+		_, dbName := newFakeDB(dialect)
+		var lockers []store.Locker
+		for i := 0; i < 2; i++ {
+			s, err := ringsql.New(openFakeDB(t, dbName), ringsql.Options{Dialect: dialect})
+			if err != nil {
+				t.Fatal(err)
+			}
+			lockers = append(lockers, s.(store.Locker))
+		}
+		if err := lockers[0].Lock(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := lockers[1].Lock(); !errors.Is(err, store.ErrLockOccupied) {
+			t.Errorf("%s: expected ErrLockOccupied while another store holds the lock, got %v", name, err)
+		}
+		if err := lockers[0].Unlock(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := lockers[1].Lock(); err != nil {
+			t.Errorf("%s: expected the lock to be released, got %v", name, err)
+		}
+		if err := lockers[1].Unlock(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestMySQLLockName(t *testing.T) {
+	for table, want := range map[string]string{"": "hsson-ring:ring_keys", "keys": "hsson-ring:keys"} {
+		fake, s := newStore(t, ringsql.MySQL, ringsql.Options{Table: table})
+		if err := s.(store.Locker).Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if fake.lockNames[0] != want {
+			t.Errorf("expected lock name %q, got %q", want, fake.lockNames[0])
+		}
+	}
+
+	// MySQL rejects lock names longer than 64 characters, so those of long
+	// table names are shortened, without sharing a lock
+	long := strings.Repeat("t", 60)
+	var names []string
+	for _, table := range []string{long + "_a", long + "_b"} {
+		fake, s := newStore(t, ringsql.MySQL, ringsql.Options{Table: table})
+		if err := s.(store.Locker).Lock(); err != nil {
+			t.Fatalf("%s: %v", table, err)
+		}
+		if name := fake.lockNames[0]; len(name) > 64 || !strings.HasPrefix(name, "hsson-ring:") {
+			t.Errorf("expected a shortened lock name for %s, got %q", table, name)
+		}
+		names = append(names, fake.lockNames[0])
+	}
+	if names[0] == names[1] {
+		t.Errorf("expected different lock names for different tables, got %q", names[0])
+	}
+}
+
+func TestTransientErrors(t *testing.T) {
+	fake, s := newStore(t, ringsql.Postgres, ringsql.Options{})
+	if err := s.Add(store.Key{ID: "key", Data: []byte("data")}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.setDown(true)
+	if _, err := s.Find("key"); !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable while the database is down, got %v", err)
+	}
+	if err := s.Add(store.Key{ID: "other", Data: []byte("data")}); !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable while the database is down, got %v", err)
+	}
+	if err := s.(store.Locker).Lock(); !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable while the database is down, got %v", err)
+	}
+	fake.setDown(false)
+
+	// Errors reported by the database are passed on as they are
+	fake.mu.Lock()
+	delete(fake.tables, "ring_keys")
+	fake.mu.Unlock()
+	if _, err := s.Find("key"); err == nil || errors.Is(err, store.ErrUnavailable) || errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected the database error, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Stats summarizes the keys of a store, e.g. for capacity planning or to
+// notice a number of keys growing out of bounds
+type Stats struct {
+	PrivateKeys int
+	PublicKeys  int
+	// OldestExpiry and NewestExpiry are the earliest and the latest
+	// ExpiresAt of the keys, or zero if the store is empty
+	OldestExpiry time.Time
+	NewestExpiry time.Time
+	// Bytes approximates the storage used by the keys, as the size of
+	// their IDs, data and metadata
+	Bytes int64
+}
+
+// Statter is implemented by stores which can compute Stats without listing
+// all keys, e.g. from an index
+type Statter interface {
+	Stats() (Stats, error)
+}
+
+// ContextStatter is the Statter of a ContextStore
+type ContextStatter interface {
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// CollectStats returns the Stats of s, computed by s if it, or the Store
+// adapted by WithContext, implements Statter, or else from all its keys
+func CollectStats(ctx context.Context, s ContextStore) (Stats, error) {
+	if statter, ok := s.(ContextStatter); ok {
+		return statter.Stats(ctx)
+	}
+	keys, err := s.List(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	return keys.Stats(), nil
+}
+
+// Stats computes the Stats of the keys
+func (kl KeyList) Stats() Stats {
+	var stats Stats
+	for _, key := range kl {
+		stats.Add(key)
+	}
+	return stats
+}
+
+// Add counts key in the stats
+func (s *Stats) Add(key Key) {
+	if key.IsPrivate {
+		s.PrivateKeys++
+	} else {
+		s.PublicKeys++
+	}
+	if s.OldestExpiry.IsZero() || key.ExpiresAt.Before(s.OldestExpiry) {
+		s.OldestExpiry = key.ExpiresAt
+	}
+	if key.ExpiresAt.After(s.NewestExpiry) {
+		s.NewestExpiry = key.ExpiresAt
+	}
+	s.Bytes += int64(len(key.ID) + len(key.Data))
+	for k, v := range key.Metadata {
+		s.Bytes += int64(len(k) + len(v))
+	}
+}
+
+func (s withContext) Stats(ctx context.Context) (Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return Stats{}, err
+	}
+	if statter, ok := s.store.(Statter); ok {
+		return statter.Stats()
+	}
+	keys, err := s.store.List()
+	if err != nil {
+		return Stats{}, err
+	}
+	return keys.Stats(), nil
+}
+
+func (s withoutContext) Stats() (Stats, error) {
+	return CollectStats(context.Background(), s.store)
+}
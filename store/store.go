@@ -10,6 +10,10 @@ var (
 	// ErrKeyIDConflict is returned if trying to add a key to the store
 	// with an occupied ID.
 	ErrKeyIDConflict = errors.New("hsson/ring: key id conflict")
+
+	// ErrLockOccupied is returned if trying to lock the store while
+	// it is already locked.
+	ErrLockOccupied = errors.New("hsson/ring: lock occupied")
 )
 
 // Key is a simple representation of either a private or a public key
@@ -19,6 +23,10 @@ type Key struct {
 	IsPrivate bool
 	ExpiresAt time.Time
 	Data      []byte
+	// Metadata describes the key, e.g. its algorithm and when it was
+	// created. Stores should keep it as is, but may return an empty map
+	// as nil. See the Metadata constants of package ring.
+	Metadata map[string]string
 }
 
 // KeyList is a slice of Key
@@ -48,6 +56,20 @@ type Store interface {
 	// should NOT give an error.
 	Delete(id string) error
 
-	// List returns all currently stored keys.
+	// List returns all currently stored keys. Stores which can select
+	// keys in their queries should also implement FilteredLister, and
+	// stores which can stream keys should implement Iterator.
 	List() (KeyList, error)
 }
+
+// Middleware decorates a Store, e.g. to add caching, retries or metrics.
+// See package store/middleware for the middleware provided.
+type Middleware func(Store) Store
+
+// Chain wraps s with the middleware, the first being the outermost.
+func Chain(s Store, middleware ...Middleware) Store {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		s = middleware[i](s)
+	}
+	return s
+}
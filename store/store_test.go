@@ -1,10 +1,13 @@
 package store_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/inmem"
 )
 
 func TestSortKeyListByExpiresAt(t *testing.T) {
@@ -28,3 +31,154 @@ func TestSortKeyListByExpiresAt(t *testing.T) {
 		t.Errorf("expected third item to be %v was %v", third.ID, kl[2].ID)
 	}
 }
+
+func TestContextAdapters(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	cs := store.WithContext(s)
+	if store.WithoutContext(cs) != store.Store(s) {
+		t.Errorf("expected WithoutContext to unwrap the original store")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cs.Add(ctx, store.Key{ID: "key"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := s.Find("key"); err == nil {
+		t.Errorf("expected key not to be added")
+	}
+
+	if err := cs.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Unlock(ctx); err != nil {
+		t.Errorf("expected unlock with done context to succeed, got %v", err)
+	}
+}
+
+func TestCollectStats(t *testing.T) {
+	now := time.Now()
+	s := inmem.NewInMemoryStore()
+	for _, key := range []store.Key{
+		{ID: "a", Data: []byte("private"), IsPrivate: true, ExpiresAt: now.Add(time.Hour)},
+		{ID: "b", Data: []byte("public"), ExpiresAt: now},
+		{ID: "c", Data: []byte("public"), ExpiresAt: now.Add(2 * time.Hour), Metadata: map[string]string{"k": "v"}},
+	} {
+		if err := s.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := store.CollectStats(context.Background(), store.WithContext(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PrivateKeys != 1 || stats.PublicKeys != 2 || !stats.OldestExpiry.Equal(now) || !stats.NewestExpiry.Equal(now.Add(2*time.Hour)) || stats.Bytes != 24 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := store.Unavailable(cause)
+	if !errors.Is(err, store.ErrUnavailable) || !errors.Is(err, cause) {
+		t.Errorf("expected %v to match both ErrUnavailable and its cause", err)
+	}
+	if store.Unavailable(err) != err {
+		t.Error("expected already wrapped errors to be returned as is")
+	}
+	if store.Unavailable(nil) != nil {
+		t.Error("expected nil to stay nil")
+	}
+}
+
+func TestListFiltered(t *testing.T) {
+	now := time.Now()
+	s := inmem.NewInMemoryStore()
+	for _, key := range []store.Key{
+		{ID: "private", IsPrivate: true, ExpiresAt: now.Add(time.Hour)},
+		{ID: "pub:valid", ExpiresAt: now.Add(time.Hour)},
+		{ID: "pub:expired", ExpiresAt: now.Add(-time.Hour)},
+		{ID: "rev:valid", ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := s.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	public := false
+	filter := store.KeyFilter{IsPrivate: &public, NotExpiredAt: now, IDPrefix: "pub:"}
+	// The second store hides the filtering of the in-memory store, so the
+	// keys are filtered by ListFiltered instead
+	for _, s := range []store.Store{s, struct{ store.Store }{s}} {
+		keys, err := store.ListFiltered(context.Background(), store.WithContext(s), filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0].ID != "pub:valid" {
+			t.Errorf("expected only pub:valid, got %v", keys)
+		}
+	}
+}
+
+func TestIterate(t *testing.T) {
+	s := inmem.NewInMemoryStore()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Add(store.Key{ID: id, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The second store hides the iterator of the in-memory store, so its
+	// keys are listed instead
+	for _, s := range []store.Store{s, struct{ store.Store }{s}} {
+		var ids []string
+		err := store.Iterate(context.Background(), store.WithContext(s), func(key store.Key) bool {
+			ids = append(ids, key.ID)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 3 {
+			t.Errorf("expected 3 keys, got %v", ids)
+		}
+
+		ids = nil
+		err = store.Iterate(context.Background(), store.WithContext(s), func(key store.Key) bool {
+			ids = append(ids, key.ID)
+			return false
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 1 {
+			t.Errorf("expected iteration to stop after the first key, got %v", ids)
+		}
+	}
+}
+
+// unlockedStore is a store without a lock of its own
+type unlockedStore struct {
+	store.Store
+}
+
+func TestWithContextLocksStoresWithoutLocker(t *testing.T) {
+	s := unlockedStore{Store: inmem.NewInMemoryStore()}
+	if _, ok := store.Store(s).(store.Locker); ok {
+		t.Fatal("expected the store not to implement store.Locker")
+	}
+
+	ctx := context.Background()
+	cs := store.WithContext(s)
+	if err := cs.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Lock(ctx); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied while locked, got %v", err)
+	}
+	if err := cs.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Lock(ctx); err != nil {
+		t.Errorf("expected the lock to be released, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package store
+
+// TTLHandler is implemented by stores which can report if they delete keys
+// by themselves once they expire. Keychains periodically delete expired keys
+// from all other stores.
+type TTLHandler interface {
+	// HandlesTTL reports whether keys are removed from the store once
+	// their ExpiresAt has passed.
+	HandlesTTL() bool
+}
+
+// HandlesTTL reports whether s, or the Store adapted by WithContext,
+// deletes expired keys by itself.
+func HandlesTTL(s ContextStore) bool {
+	if h, ok := s.(TTLHandler); ok {
+		return h.HandlesTTL()
+	}
+	if w, ok := s.(withContext); ok {
+		h, ok := w.store.(TTLHandler)
+		return ok && h.HandlesTTL()
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package store
+
+import "errors"
+
+// ErrUnavailable is matched by errors returned when the store could not be
+// reached, e.g. because of a timeout, a connection failure or an overloaded
+// backend. Unlike a key not being found such failures are transient, so
+// the operation may succeed if retried.
+var ErrUnavailable = errors.New("hsson/ring: store unavailable")
+
+// UnavailableError wraps the error of a transient store failure. It matches
+// ErrUnavailable with errors.Is, as well as the wrapped error.
+type UnavailableError struct {
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return "hsson/ring: store unavailable: " + e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrUnavailable
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// Unavailable wraps err in an UnavailableError, for stores to mark
+// transient failures. It returns nil if err is nil.
+func Unavailable(err error) error {
+	if err == nil || errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	return &UnavailableError{Err: err}
+}
@@ -0,0 +1,368 @@
+// Package vault implements a store on top of the KV version 2 secrets engine
+// of HashiCorp Vault. Each key is kept as a secret, written with
+// check-and-set so existing keys are never overwritten, and configured to
+// have Vault delete it once it expires. The store lock is a secret holding
+// the owner and expiry of a lease, taken over with check-and-set once the
+// lease has expired.
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/store"
+)
+
+const (
+	defaultMountPath     = "secret"
+	defaultPath          = "hsson-ring"
+	defaultLeaseDuration = 30 * time.Second
+	lockName             = "lock"
+	keysDir              = "keys/"
+)
+
+// Config configures how the store connects to Vault
+type Config struct {
+	// Address of the Vault server. Default: the VAULT_ADDR environment
+	// variable
+	Address string
+	// Token used to authenticate. Default: the VAULT_TOKEN environment
+	// variable
+	Token string
+	// MountPath is where the KV version 2 engine is mounted.
+	// Default: secret
+	MountPath string
+	// Path is the directory within the engine keys are kept in.
+	// Default: hsson-ring
+	Path string
+	// Owner identifies this instance as holder of the lock.
+	// Default: the hostname
+	Owner string
+	// LeaseDuration is how long the lock is held before it expires.
+	// Default: 30 seconds
+	LeaseDuration time.Duration
+	// HTTPClient is used to talk to Vault. Default: http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New creates a new store keeping keys in Vault
+func New(config Config) store.Store {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.MountPath == "" {
+		config.MountPath = defaultMountPath
+	}
+	if config.Path == "" {
+		config.Path = defaultPath
+	}
+	if config.Owner == "" {
+		config.Owner, _ = os.Hostname()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	config.Path = strings.Trim(config.Path, "/")
+	return &vaultStore{config: config}
+}
+
+type secret struct {
+	IsPrivate bool              `json:"private"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Data      []byte            `json:"data"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+type lease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// apiError is returned for unexpected responses from Vault
+type apiError struct {
+	status int
+	errors []string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("hsson/ring/vault: status %d: %s", e.status, strings.Join(e.errors, ", "))
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.status == status
+}
+
+type vaultStore struct {
+	config Config
+}
+
+func (s *vaultStore) do(method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	u := fmt.Sprintf("%s/v1/%s/%s", s.config.Address, s.config.MountPath, path)
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", s.config.Token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return store.Unavailable(err)
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		var errs struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(data, &errs)
+		err := &apiError{status: res.StatusCode, errors: errs.Errors}
+		// Vault responds with 503 while sealed or in standby
+		if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+			return store.Unavailable(err)
+		}
+		return err
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func (s *vaultStore) secretPath(name string) string {
+	return s.config.Path + "/" + name
+}
+
+func (s *vaultStore) keyName(id string) string {
+	return keysDir + url.PathEscape(id)
+}
+
+// write stores value with check-and-set, only succeeding if the current
+// version of the secret matches version. Version 0 means the secret must not
+// exist. It reports false if the version did not match.
+func (s *vaultStore) write(name string, version int, value interface{}) (bool, error) {
+	err := s.do(http.MethodPost, "data/"+s.secretPath(name), map[string]interface{}{
+		"options": map[string]int{"cas": version},
+		"data":    value,
+	}, nil)
+	// Vault responds with 400 if check-and-set fails
+	if isStatus(err, http.StatusBadRequest) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// read fetches the current version of a secret, returning
+// ring.ErrKeyNotFound if it does not exist or has been deleted.
+func (s *vaultStore) read(name string, value interface{}) (int, error) {
+	var out struct {
+		Data struct {
+			Data     json.RawMessage `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	err := s.do(http.MethodGet, "data/"+s.secretPath(name), nil, &out)
+	if isStatus(err, http.StatusNotFound) {
+		return 0, ring.ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(out.Data.Data) == 0 || string(out.Data.Data) == "null" {
+		return 0, ring.ErrKeyNotFound
+	}
+	return out.Data.Metadata.Version, json.Unmarshal(out.Data.Data, value)
+}
+
+// destroy permanently removes all versions of a secret
+func (s *vaultStore) destroy(name string) error {
+	err := s.do(http.MethodDelete, "metadata/"+s.secretPath(name), nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *vaultStore) Add(key store.Key) error {
+	name := s.keyName(key.ID)
+	ok, err := s.write(name, 0, secret{
+		IsPrivate: key.IsPrivate,
+		ExpiresAt: key.ExpiresAt,
+		Data:      key.Data,
+		Metadata:  key.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrKeyIDConflict
+	}
+
+	// Have Vault delete the key once it expires. The keychain ignores
+	// expired keys, so failing to set this only leaves garbage behind.
+	ttl := time.Until(key.ExpiresAt)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	_ = s.do(http.MethodPost, "metadata/"+s.secretPath(name), map[string]string{
+		"delete_version_after": ttl.Round(time.Second).String(),
+	}, nil)
+	return nil
+}
+
+// HandlesTTL reports true, as Vault is told to delete keys once they expire
+func (s *vaultStore) HandlesTTL() bool {
+	return true
+}
+
+func (s *vaultStore) Find(id string) (store.Key, error) {
+	var sec secret
+	if _, err := s.read(s.keyName(id), &sec); err != nil {
+		return store.Key{}, err
+	}
+	return store.Key{
+		ID:        id,
+		IsPrivate: sec.IsPrivate,
+		ExpiresAt: sec.ExpiresAt,
+		Data:      sec.Data,
+		Metadata:  sec.Metadata,
+	}, nil
+}
+
+func (s *vaultStore) Delete(id string) error {
+	return s.destroy(s.keyName(id))
+}
+
+func (s *vaultStore) List() (store.KeyList, error) {
+	var out struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := s.do("LIST", "metadata/"+s.secretPath(keysDir), nil, &out)
+	if isStatus(err, http.StatusNotFound) {
+		return store.KeyList{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(store.KeyList, 0, len(out.Data.Keys))
+	for _, name := range out.Data.Keys {
+		id, err := url.PathUnescape(name)
+		if err != nil {
+			return nil, err
+		}
+		key, err := s.Find(id)
+		if err == ring.ErrKeyNotFound {
+			// Deleted by Vault after expiring, only metadata is left
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, key)
+	}
+	return all, nil
+}
+
+func (s *vaultStore) Lock() error {
+	now := time.Now()
+	next := lease{Owner: s.config.Owner, ExpiresAt: now.Add(s.config.LeaseDuration)}
+
+	var current lease
+	version, err := s.read(lockName, &current)
+	switch {
+	case err == ring.ErrKeyNotFound:
+		// Either never locked, or unlocked by destroying the secret
+	case err != nil:
+		return err
+	case now.Before(current.ExpiresAt):
+		return store.ErrLockOccupied
+	}
+
+	ok, err := s.write(lockName, version, next)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrLockOccupied
+	}
+	return nil
+}
+
+func (s *vaultStore) LockTTL() time.Duration {
+	return s.config.LeaseDuration
+}
+
+// RenewLock extends the lease, as long as it is still held by this instance
+func (s *vaultStore) RenewLock() error {
+	now := time.Now()
+	var current lease
+	version, err := s.read(lockName, &current)
+	if err == ring.ErrKeyNotFound {
+		return store.ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	if current.Owner != s.config.Owner || !now.Before(current.ExpiresAt) {
+		return store.ErrLockLost
+	}
+
+	next := lease{Owner: s.config.Owner, ExpiresAt: now.Add(s.config.LeaseDuration)}
+	ok, err := s.write(lockName, version, next)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrLockLost
+	}
+	return nil
+}
+
+func (s *vaultStore) Unlock() error {
+	var current lease
+	_, err := s.read(lockName, &current)
+	if err == ring.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.Owner != s.config.Owner {
+		return nil
+	}
+	return s.destroy(lockName)
+}
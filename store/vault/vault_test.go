@@ -0,0 +1,223 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/ringtest/storetest"
+	"github.com/hsson/ring/store"
+	"github.com/hsson/ring/store/vault"
+)
+
+type version struct {
+	data    json.RawMessage
+	version int
+}
+
+// fakeVault implements the parts of the KV version 2 API used by the store
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string]version
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/v1/secret/")
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "data/"):
+		var in struct {
+			Options struct {
+				CAS int `json:"cas"`
+			} `json:"options"`
+			Data json.RawMessage `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		name := strings.TrimPrefix(path, "data/")
+		if v.secrets[name].version != in.Options.CAS {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"check-and-set parameter did not match the current version"}})
+			return
+		}
+		v.secrets[name] = version{data: in.Data, version: in.Options.CAS + 1}
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "data/"):
+		secret, ok := v.secrets[strings.TrimPrefix(path, "data/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     secret.data,
+				"metadata": map[string]int{"version": secret.version},
+			},
+		})
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "metadata/"):
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "metadata/"):
+		delete(v.secrets, strings.TrimPrefix(path, "metadata/"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "LIST" && strings.HasPrefix(path, "metadata/"):
+		dir := strings.TrimPrefix(path, "metadata/")
+		var keys []string
+		for name := range v.secrets {
+			if strings.HasPrefix(name, dir) {
+				keys = append(keys, strings.TrimPrefix(name, dir))
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string][]string{"keys": keys}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeVault() *httptest.Server {
+	return httptest.NewServer(&fakeVault{secrets: make(map[string]version)})
+}
+
+func TestAddFindListDelete(t *testing.T) {
+	server := newFakeVault()
+	defer server.Close()
+	s := vault.New(vault.Config{Address: server.URL, Token: "token"})
+
+	k := store.Key{
+		ID:        "pub:AbCd",
+		IsPrivate: true,
+		ExpiresAt: time.Now().Add(time.Hour).Round(0),
+		Data:      []byte{1, 2, 3},
+	}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, store.ErrKeyIDConflict) {
+		t.Errorf("expected ErrKeyIDConflict, got %v", err)
+	}
+
+	found, err := s.Find(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.IsPrivate != k.IsPrivate || !found.ExpiresAt.Equal(k.ExpiresAt) || string(found.Data) != string(k.Data) {
+		t.Errorf("got key %+v want %+v", found, k)
+	}
+
+	if err := s.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != k.ID {
+		t.Errorf("got keys %+v", keys)
+	}
+
+	if err := s.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(k.ID); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	server := newFakeVault()
+	defer server.Close()
+	one := vault.New(vault.Config{Address: server.URL, Token: "token", Owner: "one"})
+	two := vault.New(vault.Config{Address: server.URL, Token: "token", Owner: "two"})
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); !errors.Is(err, store.ErrLockOccupied) {
+		t.Errorf("expected ErrLockOccupied, got %v", err)
+	}
+	if err := two.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := one.(store.Locker).Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected lock to be released, got %v", err)
+	}
+}
+
+func TestExpiredLockIsTakenOver(t *testing.T) {
+	server := newFakeVault()
+	defer server.Close()
+	one := vault.New(vault.Config{Address: server.URL, Token: "token", Owner: "one", LeaseDuration: time.Millisecond})
+	two := vault.New(vault.Config{Address: server.URL, Token: "token", Owner: "two"})
+
+	if err := one.(store.Locker).Lock(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := two.(store.Locker).Lock(); err != nil {
+		t.Errorf("expected expired lock to be taken over, got %v", err)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	sealed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"errors":["Vault is sealed"]}`))
+	}))
+	defer sealed.Close()
+	if _, err := vault.New(vault.Config{Address: sealed.URL, Token: "token"}).Find("pub:AbCd"); !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("expected sealed Vault to be unavailable, got %v", err)
+	}
+
+	sealed.Close()
+	if _, err := vault.New(vault.Config{Address: sealed.URL, Token: "token"}).Find("pub:AbCd"); !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("expected unreachable Vault to be unavailable, got %v", err)
+	}
+
+	server := newFakeVault()
+	defer server.Close()
+	if _, err := vault.New(vault.Config{Address: server.URL, Token: "token"}).Find("pub:AbCd"); !errors.Is(err, ring.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	server := newFakeVault()
+	defer server.Close()
+
+	r := ring.New(vault.New(vault.Config{Address: server.URL, Token: "token"}))
+	key, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers, err := r.ListVerifiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifiers) != 1 || verifiers[0].ID != key.ID {
+		t.Errorf("unexpected verifiers: %v", verifiers)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func() store.Store {
+		server := newFakeVault()
+		t.Cleanup(server.Close)
+		return vault.New(vault.Config{Address: server.URL, Token: "token"})
+	})
+}
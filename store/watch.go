@@ -0,0 +1,46 @@
+package store
+
+import "context"
+
+// EventType is the kind of change described by an Event
+type EventType int
+
+const (
+	// EventAdded is sent when a key is added to the store
+	EventAdded EventType = iota + 1
+	// EventDeleted is sent when a key is deleted from the store, including
+	// when it expires in stores which support TTL
+	EventDeleted
+)
+
+// Event describes a change to a key in the store
+type Event struct {
+	Type EventType
+	ID   string
+}
+
+// Watcher is implemented by stores which can notify about changes to their
+// keys, including changes made by other processes. A keychain using such a
+// store invalidates its caches and replaces a revoked signing key as soon
+// as the change is seen, instead of waiting for entries to expire.
+type Watcher interface {
+	// Watch sends an Event for every key added to or deleted from the
+	// store, until ctx is done. The channel is closed when ctx is done or
+	// the watch fails, after which Watch may be called again. Events may
+	// be dropped or delivered more than once, so they should only be used
+	// as hints.
+	Watch(ctx context.Context) (<-chan Event, error)
+}
+
+// AsWatcher returns s as a Watcher, if it, or the Store adapted by
+// WithContext, supports watching.
+func AsWatcher(s ContextStore) (Watcher, bool) {
+	if w, ok := s.(Watcher); ok {
+		return w, true
+	}
+	if w, ok := s.(withContext); ok {
+		watcher, ok := w.store.(Watcher)
+		return watcher, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,83 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+	"hash"
+	"io"
+)
+
+// StreamSigner hashes the data written to it, so large data such as files
+// can be signed without holding it in memory. It signs with the signing key
+// which was current when it was created, see NewStreamSigner.
+type StreamSigner struct {
+	hash.Hash
+	keychain Keychain
+	key      *SigningKey
+}
+
+// streamHash returns the hash data is streamed through before signing. It
+// is the messageHash of the key, or SHA-512 for Ed25519 keys, which sign
+// the digest as their message.
+func streamHash(publicKey crypto.PublicKey, alg SignatureAlgorithm) crypto.Hash {
+	if hash := messageHash(publicKey, alg); hash != crypto.Hash(0) {
+		return hash
+	}
+	return crypto.SHA512
+}
+
+// NewStreamSigner creates a StreamSigner using the current signing key of
+// keychain. RSA and ECDSA signatures are the same as those created by
+// Keychain.Sign over the whole data, so they can be checked by
+// Keychain.Verify. Ed25519 keys sign the SHA-512 digest of the data
+// instead. VerifyStream checks signatures of either kind.
+func NewStreamSigner(keychain Keychain) (*StreamSigner, error) {
+	key, err := keychain.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return &StreamSigner{Hash: streamHash(key.Key.Public(), key.SignatureAlgorithm).New(), keychain: keychain, key: key}, nil
+}
+
+// KeyID returns the ID of the key the data is meant to be signed with,
+// unless it is replaced when calling Finalize
+func (s *StreamSigner) KeyID() string {
+	return s.key.ID
+}
+
+// Finalize signs the data written so far, and returns the signature
+// together with the ID of the key used. The signature is counted towards
+// Options.MaxSignaturesPerKey like those of Keychain.Sign. If the key has
+// reached it, the data is signed with its replacement instead, unless that
+// uses another hash, in which case ErrKeyRotation is returned.
+func (s *StreamSigner) Finalize() (signature []byte, keyID string, err error) {
+	key := s.key
+	if counting, ok := s.keychain.(countingKeychain); ok {
+		if key, err = counting.countSignature(context.Background(), s.key); err != nil {
+			return nil, "", err
+		}
+	}
+	if key.ID != s.key.ID && streamHash(key.Key.Public(), key.SignatureAlgorithm) != streamHash(s.key.Key.Public(), s.key.SignatureAlgorithm) {
+		return nil, "", ErrKeyRotation
+	}
+	signature, err = signDigest(key, s.Sum(nil))
+	if err != nil {
+		return nil, "", err
+	}
+	return signature, key.ID, nil
+}
+
+// VerifyStream checks a signature created by a StreamSigner over the data
+// read from r, using the verifier key identified by keyID.
+// ErrInvalidSignature is returned if the signature does not match.
+func VerifyStream(verifier Verifier, keyID string, r io.Reader, signature []byte) error {
+	key, err := verifier.GetVerifier(keyID)
+	if err != nil {
+		return err
+	}
+	h := streamHash(key.Key, key.SignatureAlgorithm).New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	return verifyDigest(key, h.Sum(nil), signature)
+}
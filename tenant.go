@@ -0,0 +1,124 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// TenantSeparator separates the ID of the root key from the tenant ID in
+// the key IDs of a TenantSigner
+const TenantSeparator = "~"
+
+// ErrInvalidTenant is returned for tenant IDs which are empty or contain
+// TenantSeparator
+var ErrInvalidTenant = errors.New("hsson/ring: invalid tenant ID")
+
+// TenantKeyID returns the key ID used by the TenantSigner of tenantID while
+// keyID is the current signing key
+func TenantKeyID(keyID, tenantID string) string {
+	return keyID + TenantSeparator + tenantID
+}
+
+// ParseTenantKeyID splits a key ID created by TenantKeyID into the ID of
+// the root key and the tenant ID. ok is false if id is not a tenant key ID.
+func ParseTenantKeyID(id string) (keyID, tenantID string, ok bool) {
+	i := strings.LastIndex(id, TenantSeparator)
+	if i <= 0 || i == len(id)-len(TenantSeparator) {
+		return "", "", false
+	}
+	return id[:i], id[i+len(TenantSeparator):], true
+}
+
+// TenantSigner signs on behalf of a single tenant, giving every tenant its
+// own key IDs without storing keys per tenant. It signs with the current
+// signing key of the keychain, identified by TenantKeyID, which verifiers
+// resolve to the public key of the root key.
+//
+// The tenant is bound to a signature only through the key ID, e.g. in the
+// protected header of a JWS. Data signed with Sign verifies under the key
+// ID of any tenant, so it must identify the tenant itself.
+type TenantSigner struct {
+	keychain Keychain
+	tenantID string
+}
+
+// NewTenantSigner creates a TenantSigner for tenantID using the signing keys
+// of keychain, see Keychain.TenantSigner
+func NewTenantSigner(keychain Keychain, tenantID string) (*TenantSigner, error) {
+	if tenantID == "" || strings.Contains(tenantID, TenantSeparator) {
+		return nil, ErrInvalidTenant
+	}
+	return &TenantSigner{keychain: keychain, tenantID: tenantID}, nil
+}
+
+// TenantID returns the ID of the tenant
+func (s *TenantSigner) TenantID() string {
+	return s.tenantID
+}
+
+// SigningKey returns the current signing key of the keychain, identified by
+// the key ID of the tenant
+func (s *TenantSigner) SigningKey() (*SigningKey, error) {
+	return s.SigningKeyContext(context.Background())
+}
+
+// SigningKeyContext is like SigningKey, but the context is used for any
+// store operations needed to rotate the key
+func (s *TenantSigner) SigningKeyContext(ctx context.Context) (*SigningKey, error) {
+	key, err := s.keychain.SigningKeyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.tenantKey(key), nil
+}
+
+// signingKeyToSign implements countingSigner, counting the signature
+// towards the root key
+func (s *TenantSigner) signingKeyToSign(ctx context.Context) (*SigningKey, error) {
+	key, err := signingKeyToSignContext(ctx, s.keychain)
+	if err != nil {
+		return nil, err
+	}
+	return s.tenantKey(key), nil
+}
+
+// tenantKey returns a copy of the root key, identified by the key ID of the
+// tenant
+func (s *TenantSigner) tenantKey(key *SigningKey) *SigningKey {
+	tenantKey := *key
+	tenantKey.ID = TenantKeyID(key.ID, s.tenantID)
+	return &tenantKey
+}
+
+// Sign signs data using Keychain.Sign, returning the key ID of the tenant
+func (s *TenantSigner) Sign(data []byte) ([]byte, string, error) {
+	signature, keyID, err := s.keychain.Sign(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return signature, TenantKeyID(keyID, s.tenantID), nil
+}
+
+func (r *ring) TenantSigner(tenantID string) (*TenantSigner, error) {
+	return NewTenantSigner(r, tenantID)
+}
+
+// findTenantVerifier returns the verifier key of the root key identified by
+// keyID, as seen by the tenant
+func (v *verifier) findTenantVerifier(ctx context.Context, keyID, tenantID string) (*VerifierKey, error) {
+	root, err := v.findVerifier(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return root.ForTenant(tenantID), nil
+}
+
+// ForTenant returns a copy of the verifier key as used by the TenantSigner
+// of tenantID
+func (vk *VerifierKey) ForTenant(tenantID string) *VerifierKey {
+	tenantKey := *vk
+	tenantKey.ID = TenantKeyID(vk.ID, tenantID)
+	tenantKey.TenantID = tenantID
+	return &tenantKey
+}
@@ -0,0 +1,108 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// withStoreTimeout bounds every operation on s by timeout, if it is set
+func withStoreTimeout(s store.ContextStore, timeout time.Duration) store.ContextStore {
+	if timeout == 0 {
+		return s
+	}
+	return &timeoutStore{ContextStore: s, timeout: timeout}
+}
+
+// timeoutStore passes a deadline to every store operation. Operations
+// exceeding it fail with an error matching ErrStoreUnavailable.
+type timeoutStore struct {
+	store.ContextStore
+	timeout time.Duration
+}
+
+// bound runs op with a context which is done after the timeout
+func (s *timeoutStore) bound(ctx context.Context, op func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := op(ctx)
+	if errors.Is(err, context.DeadlineExceeded) || err != nil && ctx.Err() == context.DeadlineExceeded {
+		return store.Unavailable(err)
+	}
+	return err
+}
+
+func (s *timeoutStore) Add(ctx context.Context, key store.Key) error {
+	return s.bound(ctx, func(ctx context.Context) error {
+		return s.ContextStore.Add(ctx, key)
+	})
+}
+
+func (s *timeoutStore) Find(ctx context.Context, id string) (key store.Key, err error) {
+	err = s.bound(ctx, func(ctx context.Context) error {
+		key, err = s.ContextStore.Find(ctx, id)
+		return err
+	})
+	return key, err
+}
+
+func (s *timeoutStore) Delete(ctx context.Context, id string) error {
+	return s.bound(ctx, func(ctx context.Context) error {
+		return s.ContextStore.Delete(ctx, id)
+	})
+}
+
+func (s *timeoutStore) SecureErase(ctx context.Context, id string) error {
+	return s.bound(ctx, func(ctx context.Context) error {
+		return store.SecureErase(ctx, s.ContextStore, id)
+	})
+}
+
+func (s *timeoutStore) Stats(ctx context.Context) (stats store.Stats, err error) {
+	err = s.bound(ctx, func(ctx context.Context) error {
+		stats, err = store.CollectStats(ctx, s.ContextStore)
+		return err
+	})
+	return stats, err
+}
+
+func (s *timeoutStore) List(ctx context.Context) (keys store.KeyList, err error) {
+	err = s.bound(ctx, func(ctx context.Context) error {
+		keys, err = s.ContextStore.List(ctx)
+		return err
+	})
+	return keys, err
+}
+
+func (s *timeoutStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (keys store.KeyList, err error) {
+	err = s.bound(ctx, func(ctx context.Context) error {
+		keys, err = store.ListFiltered(ctx, s.ContextStore, filter)
+		return err
+	})
+	return keys, err
+}
+
+// Iterate bounds the whole iteration by the timeout
+func (s *timeoutStore) Iterate(ctx context.Context, yield func(store.Key) bool) error {
+	return s.bound(ctx, func(ctx context.Context) error {
+		return store.Iterate(ctx, s.ContextStore, yield)
+	})
+}
+
+func (s *timeoutStore) FindMany(ctx context.Context, ids []string) (keys store.KeyList, err error) {
+	err = s.bound(ctx, func(ctx context.Context) error {
+		keys, err = findMany(ctx, s.ContextStore, ids)
+		return err
+	})
+	return keys, err
+}
+
+func (s *timeoutStore) Lock(ctx context.Context) error {
+	return s.bound(ctx, s.ContextStore.Lock)
+}
+
+func (s *timeoutStore) Unlock(ctx context.Context) error {
+	return s.bound(ctx, s.ContextStore.Unlock)
+}
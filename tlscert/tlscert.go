@@ -0,0 +1,160 @@
+// Package tlscert issues short-lived TLS certificates for the current
+// signing key of a keychain, signed by a CA supplied by the user. Services
+// using the tls.Config of an Issuer present a new certificate after every
+// rotation, which automates the rotation of mTLS credentials.
+package tlscert
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring"
+)
+
+// DefaultValidity is the default of Options.Validity
+const DefaultValidity = time.Hour
+
+// Options customize the issued certificates
+type Options struct {
+	// CA signs the certificates. Required.
+	CA crypto.Signer
+	// CACertificate is the certificate of CA, which issued certificates
+	// chain to and peers are verified against. Required.
+	CACertificate *x509.Certificate
+
+	// Template is the base of the issued certificates, e.g. with the
+	// DNSNames or IPAddresses of the service. The serial number, validity
+	// and, unless set, the subject are filled in. Default: no names
+	Template x509.Certificate
+
+	// Validity is how long issued certificates are valid. Certificates
+	// are renewed once half of it has passed, or when the signing key is
+	// rotated. Default: DefaultValidity
+	Validity time.Duration
+
+	// Clock tells the validity of certificates. Default: the system clock
+	Clock ring.Clock
+}
+
+func (o Options) now() time.Time {
+	if o.Clock != nil {
+		return o.Clock.Now()
+	}
+	return time.Now()
+}
+
+// Issuer issues the certificates of a keychain
+type Issuer struct {
+	keychain ring.Keychain
+	options  Options
+
+	mu sync.Mutex
+	// current is the last issued certificate, of the signing key keyID
+	current *tls.Certificate
+	keyID   string
+	renewAt time.Time
+}
+
+// New creates an Issuer of certificates for the signing keys of keychain
+func New(keychain ring.Keychain, options Options) (*Issuer, error) {
+	if options.CA == nil || options.CACertificate == nil {
+		return nil, errors.New("hsson/ring/tlscert: CA and CACertificate are required")
+	}
+	if options.Validity < 0 {
+		return nil, errors.New("hsson/ring/tlscert: Validity must be >= 0")
+	}
+	if options.Validity == 0 {
+		options.Validity = DefaultValidity
+	}
+	return &Issuer{keychain: keychain, options: options}, nil
+}
+
+// Certificate returns a certificate for the current signing key, issuing a
+// new one if the key has been rotated or the last one is due for renewal.
+// Every call is counted as a signature towards
+// ring.Options.MaxSignaturesPerKey, as the key signs a TLS handshake with
+// the certificate.
+func (i *Issuer) Certificate() (*tls.Certificate, error) {
+	signingKey, err := ring.SigningKeyToSign(context.Background(), i.keychain)
+	if err != nil {
+		return nil, err
+	}
+	now := i.options.now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.current != nil && i.keyID == signingKey.ID && now.Before(i.renewAt) {
+		return i.current, nil
+	}
+	cert, err := i.issue(signingKey, now)
+	if err != nil {
+		return nil, err
+	}
+	i.current, i.keyID, i.renewAt = cert, signingKey.ID, now.Add(i.options.Validity/2)
+	return cert, nil
+}
+
+func (i *Issuer) issue(signingKey *ring.SigningKey, now time.Time) (*tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := i.options.Template
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-time.Minute)
+	template.NotAfter = now.Add(i.options.Validity)
+	if template.Subject.CommonName == "" {
+		template.Subject = pkix.Name{CommonName: signingKey.ID}
+	}
+	template.KeyUsage |= x509.KeyUsageDigitalSignature
+	if len(template.ExtKeyUsage) == 0 {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, i.options.CACertificate, signingKey.Key.Public(), i.options.CA)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, i.options.CACertificate.Raw},
+		PrivateKey:  signingKey.Key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (i *Issuer) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return i.Certificate()
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate
+func (i *Issuer) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return i.Certificate()
+}
+
+// Config returns a tls.Config for mutual TLS between services sharing the
+// CA: it presents the certificates of the issuer both as server and
+// client, and requires peers to present certificates issued by the CA.
+func (i *Issuer) Config() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(i.options.CACertificate)
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		GetCertificate:       i.GetCertificate,
+		GetClientCertificate: i.GetClientCertificate,
+		RootCAs:              pool,
+		ClientCAs:            pool,
+		ClientAuth:           tls.RequireAndVerifyClientCert,
+	}
+}
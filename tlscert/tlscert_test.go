@@ -0,0 +1,156 @@
+package tlscert_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/sim"
+	"github.com/hsson/ring/store/inmem"
+	"github.com/hsson/ring/tlscert"
+)
+
+func newCA(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestMutualTLS(t *testing.T) {
+	caKey, caCert := newCA(t)
+	newIssuer := func() (ring.Keychain, *tlscert.Issuer) {
+		keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.ECDSAP256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		issuer, err := tlscert.New(keychain, tlscert.Options{
+			CA:            caKey,
+			CACertificate: caCert,
+			Template:      x509.Certificate{DNSNames: []string{"service.internal"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keychain, issuer
+	}
+	_, server := newIssuer()
+	clientKeychain, client := newIssuer()
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	clientConfig := client.Config()
+	clientConfig.ServerName = "service.internal"
+	done := make(chan error, 1)
+	go func() {
+		done <- tls.Server(serverConn, server.Config()).Handshake()
+	}()
+	tlsClient := tls.Client(clientConn, clientConfig)
+	if err := tlsClient.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, err := clientKeychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := client.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.Subject.CommonName != signingKey.ID {
+		t.Errorf("expected certificate of the signing key %s, got %s", signingKey.ID, cert.Leaf.Subject.CommonName)
+	}
+	if again, err := client.Certificate(); err != nil || again != cert {
+		t.Errorf("expected the certificate to be reused, got %v", err)
+	}
+	if err := clientKeychain.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := client.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Leaf.Subject.CommonName == signingKey.ID {
+		t.Error("expected a new certificate after rotation")
+	}
+}
+
+func TestRenewal(t *testing.T) {
+	caKey, caCert := newCA(t)
+	clock := sim.NewClock(time.Now())
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := tlscert.New(keychain, tlscert.Options{CA: caKey, CACertificate: caCert, Validity: time.Hour, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := issuer.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(31 * time.Minute)
+	second, err := issuer.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first || !second.Leaf.NotAfter.After(first.Leaf.NotAfter) {
+		t.Error("expected the certificate to be renewed after half its validity")
+	}
+}
+
+func TestCertificateCountsSignatures(t *testing.T) {
+	caKey, caCert := newCA(t)
+	keychain, err := ring.NewKeychain(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := tlscert.New(keychain, tlscert.Options{CA: caKey, CACertificate: caCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := issuer.Certificate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signingKey, err := keychain.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := keychain.SignatureCount(signingKey.ID); err != nil || count != 2 {
+		t.Errorf("expected 2 signatures, got %d: %v", count, err)
+	}
+}
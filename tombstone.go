@@ -0,0 +1,103 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+var (
+	// ErrKeyRevoked is matched by the errors of GetVerifier for keys which
+	// have been revoked, while their tombstone is kept, see
+	// Options.TombstoneTTL
+	ErrKeyRevoked = errors.New("hsson/ring: key revoked")
+	// ErrKeyExpired is like ErrKeyRevoked, but for keys which have expired
+	ErrKeyExpired = errors.New("hsson/ring: key expired")
+)
+
+// Reasons of tombstones
+const (
+	TombstoneRevoked = "revoked"
+	TombstoneExpired = "expired"
+)
+
+// Tombstone records a verifier key which was valid, but has been revoked or
+// has expired
+type Tombstone struct {
+	KeyID string `json:"-"`
+	// Reason is TombstoneRevoked or TombstoneExpired
+	Reason string `json:"reason"`
+	// At is when the key was revoked or expired
+	At time.Time `json:"at"`
+}
+
+// TombstoneError is returned by GetVerifier for keys with a tombstone. It
+// matches ErrKeyRevoked or ErrKeyExpired depending on the reason, as well as
+// ErrKeyNotFound.
+type TombstoneError struct {
+	Tombstone Tombstone
+}
+
+func (e *TombstoneError) Error() string {
+	return fmt.Sprintf("hsson/ring: key %s %s at %s", e.Tombstone.KeyID, e.Tombstone.Reason, e.Tombstone.At.Format(time.RFC3339))
+}
+
+func (e *TombstoneError) Unwrap() error {
+	return ErrKeyNotFound
+}
+
+func (e *TombstoneError) Is(target error) bool {
+	switch e.Tombstone.Reason {
+	case TombstoneRevoked:
+		return target == ErrKeyRevoked
+	case TombstoneExpired:
+		return target == ErrKeyExpired
+	}
+	return false
+}
+
+// addTombstone keeps a tombstone of the verifier key id for TombstoneTTL
+func (v *verifier) addTombstone(ctx context.Context, id, reason string, at time.Time) error {
+	if v.options.TombstoneTTL == 0 {
+		return nil
+	}
+	data, err := json.Marshal(Tombstone{Reason: reason, At: at.UTC()})
+	if err != nil {
+		return err
+	}
+	err = v.store.Add(ctx, store.Key{
+		ID:        tombstoneIDPrefix + id,
+		ExpiresAt: at.Add(v.options.TombstoneTTL),
+		Data:      data,
+	})
+	if errors.Is(err, store.ErrKeyIDConflict) {
+		return nil
+	}
+	return err
+}
+
+// findTombstone returns the error of GetVerifier for the verifier key id,
+// which was not found: a TombstoneError if it has a tombstone, otherwise
+// ErrKeyNotFound
+func (v *verifier) findTombstone(ctx context.Context, id string) error {
+	if v.options.TombstoneTTL == 0 {
+		return ErrKeyNotFound
+	}
+	key, err := v.reads.Find(ctx, tombstoneIDPrefix+id)
+	if err != nil {
+		return err
+	}
+	if !key.ExpiresAt.After(v.options.Clock.Now()) {
+		return ErrKeyNotFound
+	}
+	var tombstone Tombstone
+	if err := json.Unmarshal(key.Data, &tombstone); err != nil {
+		return ErrKeyNotFound
+	}
+	tombstone.KeyID = id
+	return &TombstoneError{Tombstone: tombstone}
+}
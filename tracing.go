@@ -0,0 +1,131 @@
+package ring
+
+import (
+	"context"
+
+	"github.com/hsson/ring/store"
+)
+
+// Tracer starts tracing spans around keychain and store operations. It is
+// modeled after OpenTelemetry, to which it can be adapted with a few lines:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string) (context.Context, ring.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) End(err error) {
+//		if err != nil {
+//			s.Span.RecordError(err)
+//			s.Span.SetStatus(codes.Error, err.Error())
+//		}
+//		s.Span.End()
+//	}
+type Tracer interface {
+	// Start starts a span with the given name as a child of any span in
+	// ctx, and returns a context containing the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a tracing span started by a Tracer
+type Span interface {
+	// End ends the span, recording err if it is not nil
+	End(err error)
+}
+
+// startSpan starts a span if a Tracer is configured. The returned function
+// ends it.
+func (v *verifier) startSpan(ctx context.Context, name string) (context.Context, func(error)) {
+	if v.options.Tracer == nil {
+		return ctx, func(error) {}
+	}
+	ctx, span := v.options.Tracer.Start(ctx, name)
+	return ctx, span.End
+}
+
+// tracedStore starts a span around every store operation
+type tracedStore struct {
+	store.ContextStore
+	tracer Tracer
+}
+
+func (s *tracedStore) Add(ctx context.Context, key store.Key) error {
+	ctx, span := s.tracer.Start(ctx, "ring.store.Add")
+	err := s.ContextStore.Add(ctx, key)
+	span.End(err)
+	return err
+}
+
+func (s *tracedStore) Find(ctx context.Context, id string) (store.Key, error) {
+	ctx, span := s.tracer.Start(ctx, "ring.store.Find")
+	key, err := s.ContextStore.Find(ctx, id)
+	span.End(err)
+	return key, err
+}
+
+func (s *tracedStore) Delete(ctx context.Context, id string) error {
+	ctx, span := s.tracer.Start(ctx, "ring.store.Delete")
+	err := s.ContextStore.Delete(ctx, id)
+	span.End(err)
+	return err
+}
+
+func (s *tracedStore) SecureErase(ctx context.Context, id string) error {
+	ctx, span := s.tracer.Start(ctx, "ring.store.SecureErase")
+	err := store.SecureErase(ctx, s.ContextStore, id)
+	span.End(err)
+	return err
+}
+
+func (s *tracedStore) Stats(ctx context.Context) (store.Stats, error) {
+	ctx, span := s.tracer.Start(ctx, "ring.store.Stats")
+	stats, err := store.CollectStats(ctx, s.ContextStore)
+	span.End(err)
+	return stats, err
+}
+
+func (s *tracedStore) List(ctx context.Context) (store.KeyList, error) {
+	ctx, span := s.tracer.Start(ctx, "ring.store.List")
+	keys, err := s.ContextStore.List(ctx)
+	span.End(err)
+	return keys, err
+}
+
+func (s *tracedStore) ListFiltered(ctx context.Context, filter store.KeyFilter) (store.KeyList, error) {
+	ctx, span := s.tracer.Start(ctx, "ring.store.List")
+	keys, err := store.ListFiltered(ctx, s.ContextStore, filter)
+	span.End(err)
+	return keys, err
+}
+
+func (s *tracedStore) Iterate(ctx context.Context, yield func(store.Key) bool) error {
+	ctx, span := s.tracer.Start(ctx, "ring.store.Iterate")
+	err := store.Iterate(ctx, s.ContextStore, yield)
+	span.End(err)
+	return err
+}
+
+func (s *tracedStore) FindMany(ctx context.Context, ids []string) (store.KeyList, error) {
+	ctx, span := s.tracer.Start(ctx, "ring.store.FindMany")
+	keys, err := findMany(ctx, s.ContextStore, ids)
+	span.End(err)
+	return keys, err
+}
+
+func (s *tracedStore) Lock(ctx context.Context) error {
+	ctx, span := s.tracer.Start(ctx, "ring.store.Lock")
+	err := s.ContextStore.Lock(ctx)
+	span.End(err)
+	return err
+}
+
+func (s *tracedStore) Unlock(ctx context.Context) error {
+	ctx, span := s.tracer.Start(ctx, "ring.store.Unlock")
+	err := s.ContextStore.Unlock(ctx)
+	span.End(err)
+	return err
+}
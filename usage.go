@@ -0,0 +1,133 @@
+package ring
+
+import (
+	"context"
+	"sync"
+)
+
+// maxCountedKeys is how many keys the default SignatureCounter keeps counts
+// for, dropping the oldest first
+const maxCountedKeys = 64
+
+// SignatureCounter counts the signatures made with each key, see
+// Options.SignatureCounter. A counter shared by all instances, e.g. in
+// Redis, makes Options.MaxSignaturesPerKey apply across instances.
+type SignatureCounter interface {
+	// Increment counts a signature made with the key keyID, and returns
+	// the number of signatures counted for it including this one
+	Increment(keyID string) (uint64, error)
+	// Count returns the number of signatures counted for keyID
+	Count(keyID string) (uint64, error)
+}
+
+// memoryCounter counts the signatures of this instance, for the most recent
+// keys
+type memoryCounter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+	// order holds the counted key IDs, oldest first
+	order []string
+}
+
+func newMemoryCounter() *memoryCounter {
+	return &memoryCounter{counts: make(map[string]uint64)}
+}
+
+func (c *memoryCounter) Increment(keyID string) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.counts[keyID]; !ok {
+		if len(c.order) >= maxCountedKeys {
+			delete(c.counts, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, keyID)
+	}
+	c.counts[keyID]++
+	return c.counts[keyID], nil
+}
+
+func (c *memoryCounter) Count(keyID string) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[keyID], nil
+}
+
+// countingSigner is implemented by keychains and signers counting
+// signatures, which SigningKeyToSign and a SignatureService sign through
+type countingSigner interface {
+	signingKeyToSign(ctx context.Context) (*SigningKey, error)
+}
+
+// countingKeychain is implemented by keychains counting signatures made
+// with a key obtained earlier, such as by a StreamSigner
+type countingKeychain interface {
+	countingSigner
+	countSignature(ctx context.Context, key *SigningKey) (*SigningKey, error)
+}
+
+// SigningKeyToSign returns the signing key of keychain to make a single
+// signature with, and counts the signature towards
+// Options.MaxSignaturesPerKey, replacing a key which reached it. Code
+// signing with the private key of a SigningKey itself, such as packages
+// jose and tlscert, should use it instead of SigningKey. Signing keys of
+// keychains not created by this package are returned uncounted.
+func SigningKeyToSign(ctx context.Context, keychain interface {
+	SigningKey() (*SigningKey, error)
+}) (*SigningKey, error) {
+	if counting, ok := keychain.(countingSigner); ok {
+		return counting.signingKeyToSign(ctx)
+	}
+	return keychain.SigningKey()
+}
+
+// signingKeyToSignContext is like SigningKeyToSign, but uses the context
+// for the store operations of keychains which don't count signatures
+func signingKeyToSignContext(ctx context.Context, keychain interface {
+	SigningKeyContext(ctx context.Context) (*SigningKey, error)
+}) (*SigningKey, error) {
+	if counting, ok := keychain.(countingSigner); ok {
+		return counting.signingKeyToSign(ctx)
+	}
+	return keychain.SigningKeyContext(ctx)
+}
+
+// signingKeyToSign returns the signing key to make a signature with, and
+// counts the signature, see countSignature
+func (r *ring) signingKeyToSign(ctx context.Context) (*SigningKey, error) {
+	key, err := r.SigningKeyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.countSignature(ctx, key)
+}
+
+// countSignature counts a signature made with key, and returns the key to
+// make it with. A key which has made MaxSignaturesPerKey signatures is
+// rotated first, and the signature is made with its replacement instead.
+func (r *ring) countSignature(ctx context.Context, key *SigningKey) (*SigningKey, error) {
+	count, err := r.options.SignatureCounter.Increment(key.ID)
+	if err != nil {
+		return nil, err
+	}
+	if r.options.MaxSignaturesPerKey == 0 || count <= uint64(r.options.MaxSignaturesPerKey) {
+		return key, nil
+	}
+
+	// Another caller may have rotated the key already
+	next, _ := r.currentSigningKey.Load().(*SigningKey)
+	if next == nil || next.ID == key.ID {
+		r.options.Logger.Info("signing key reached MaxSignaturesPerKey", "key_id", key.ID, "signatures", count)
+		if next, err = r.rotateSigningKey(ctx); err != nil {
+			return nil, &RotationError{Cause: err}
+		}
+	}
+	if _, err := r.options.SignatureCounter.Increment(next.ID); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func (r *ring) SignatureCount(keyID string) (uint64, error) {
+	return r.options.SignatureCounter.Count(keyID)
+}
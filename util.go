@@ -1,30 +1,68 @@
 package ring
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/hsson/ring/store"
 	nanoid "github.com/matoous/go-nanoid/v2"
 )
 
-func createStoreKeyPairFromSigningKey(signingKey *SigningKey) (store.Key, store.Key, error) {
-	privateKeyData, err := x509.MarshalPKCS8PrivateKey(signingKey.Key)
+func (r *ring) createStoreKeyPairFromSigningKey(signingKey *SigningKey) (store.Key, store.Key, error) {
+	privateMetadata := r.keyMetadata(signingKey, PurposeSigning)
+	var privateKeyData []byte
+	var err error
+	if signingKey.reference != nil {
+		privateMetadata[MetadataKeyReference] = "true"
+		privateKeyData, err = r.encodeKeyData(encodingReference, signingKey.Algorithm, signingKey.reference)
+	} else {
+		var der []byte
+		if der, err = r.options.codec().MarshalPrivateKey(signingKey.Key); err != nil {
+			return store.Key{}, store.Key{}, err
+		}
+		privateKeyData, err = r.encodeKeyData(encodingPKCS8, signingKey.Algorithm, der)
+		if r.options.ZeroizeKeys && err == nil && !sameBuffer(der, privateKeyData) {
+			zeroize(der)
+		}
+	}
 	if err != nil {
 		return store.Key{}, store.Key{}, err
 	}
 
+	// The schedule is stored, as other instances may be configured with
+	// another RotationFrequency or VerificationPeriod
+	privateMetadata[MetadataRotatedAt] = signingKey.RotatedAt.UTC().Format(time.RFC3339Nano)
+	privateMetadata[MetadataVerifiableUntil] = signingKey.VerifiableUntil.UTC().Format(time.RFC3339Nano)
 	privateStoreKey := store.Key{
 		ID:        signingKey.ID,
 		IsPrivate: true,
-		ExpiresAt: signingKey.RotatedAt,
+		ExpiresAt: signingKey.RotatedAt.Add(r.privateKeyRetention()),
 		Data:      privateKeyData,
+		Metadata:  privateMetadata,
+	}
+	if signingKey.customSchedule {
+		// Keys with their own schedule are never rotated, so they are not
+		// retained past RotatedAt
+		privateStoreKey.ExpiresAt = signingKey.RotatedAt
+		privateMetadata[MetadataCustomSchedule] = "true"
 	}
 
-	publicKeyData, err := x509.MarshalPKIXPublicKey(&signingKey.Key.PublicKey)
+	der, err := r.options.codec().MarshalPublicKey(signingKey.Key.Public())
+	if err != nil {
+		return store.Key{}, store.Key{}, err
+	}
+	publicKeyData, err := r.encodeKeyData(encodingPKIX, signingKey.Algorithm, der)
 	if err != nil {
 		return store.Key{}, store.Key{}, err
 	}
@@ -34,63 +72,424 @@ func createStoreKeyPairFromSigningKey(signingKey *SigningKey) (store.Key, store.
 		IsPrivate: false,
 		ExpiresAt: signingKey.VerifiableUntil,
 		Data:      publicKeyData,
+		Metadata:  r.keyMetadata(signingKey, PurposeVerification),
 	}
 
 	return privateStoreKey, publicStoreKey, nil
 }
 
-func (r *ring) storeKeyPair(privateKey, publicKey store.Key) error {
-	if err := r.store.Add(privateKey); err != nil {
+// parseVerifierKey parses the public key stored in key
+func (v *verifier) parseVerifierKey(key store.Key) (crypto.PublicKey, error) {
+	if pub, ok := v.parsed.get(key); ok {
+		return pub, nil
+	}
+	der, err := v.decodeKeyData(key, encodingPKIX)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := v.options.codec().UnmarshalPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.options.checkKeyPolicy(pub); err != nil {
+		return nil, err
+	}
+	v.parsed.put(key, pub)
+	return pub, nil
+}
+
+func (r *ring) storedPrivateKeyToSigningKey(key store.Key) (*SigningKey, error) {
+	encoding := privateKeyEncoding(key.Metadata)
+	data, err := r.decodeKeyData(key, encoding)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == encodingReference {
+		signer, err := r.loadReferencedKey(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.options.checkKeyPolicy(signer.Public()); err != nil {
+			return nil, err
+		}
+		signingKey := r.storedSigningKey(key, signer)
+		signingKey.reference = data
+		return signingKey, r.loadPostQuantumKey(context.Background(), signingKey)
+	}
+	privateKey, err := r.options.codec().UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("private key data could not be parsed: %w", err)
+	}
+	if err := r.options.checkKeyPolicy(privateKey.Public()); err != nil {
+		return nil, err
+	}
+	signingKey := r.storedSigningKey(key, privateKey)
+	return signingKey, r.loadPostQuantumKey(context.Background(), signingKey)
+}
+
+// storedSigningKey returns the signing key of a stored private key, with
+// privateKey loaded from its data
+func (r *ring) storedSigningKey(key store.Key, privateKey crypto.Signer) *SigningKey {
+	if customSchedule(key) {
+		algorithm, createdAt := parseMetadata(key.Metadata, privateKey.Public())
+		verifiableUntil, _ := time.Parse(time.RFC3339Nano, key.Metadata[MetadataVerifiableUntil])
+		return &SigningKey{
+			ID:                 key.ID,
+			RotatedAt:          key.ExpiresAt,
+			VerifiableUntil:    verifiableUntil,
+			Key:                privateKey,
+			CreatedAt:          createdAt,
+			Algorithm:          algorithm,
+			SignatureAlgorithm: parseSignatureAlgorithm(key.Metadata, privateKey.Public()),
+			customSchedule:     true,
+		}
+	}
+	rotatedAt := r.privateKeyRotatedAt(key)
+	verifiableUntil, err := time.Parse(time.RFC3339Nano, key.Metadata[MetadataVerifiableUntil])
+	if err != nil {
+		// Stored by an earlier version, assuming the same options
+		verifiableUntil = rotatedAt.Add(r.options.VerificationPeriod).Add(-r.options.RotationFrequency)
+	}
+	algorithm, createdAt := parseMetadata(key.Metadata, privateKey.Public())
+	return &SigningKey{
+		ID:                 key.ID,
+		RotatedAt:          rotatedAt,
+		VerifiableUntil:    verifiableUntil,
+		Key:                privateKey,
+		CreatedAt:          createdAt,
+		Algorithm:          algorithm,
+		SignatureAlgorithm: parseSignatureAlgorithm(key.Metadata, privateKey.Public()),
+	}
+}
+
+// privateKeyRetention is how long private keys are kept in the store after
+// being rotated
+func (r *ring) privateKeyRetention() time.Duration {
+	return r.options.SigningGracePeriod + time.Duration(r.options.RetainSigningKeys)*r.options.RotationFrequency
+}
+
+// privateKeyRotatedAt returns when a stored private key stops being the
+// active signing key. It is kept in the store for the retention after.
+func (r *ring) privateKeyRotatedAt(key store.Key) time.Time {
+	if rotatedAt, err := time.Parse(time.RFC3339Nano, key.Metadata[MetadataRotatedAt]); err == nil {
+		return rotatedAt
+	}
+	// Stored by an earlier version, assuming the same retention
+	return key.ExpiresAt.Add(-r.privateKeyRetention())
+}
+
+func (r *ring) GetSigningKey(id string) (*SigningKey, error) {
+	return r.GetSigningKeyContext(context.Background(), id)
+}
+
+func (r *ring) GetSigningKeyContext(ctx context.Context, id string) (*SigningKey, error) {
+	key, err := r.store.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !key.IsPrivate || r.options.expired(key.ExpiresAt, r.options.Clock.Now()) {
+		return nil, ErrKeyNotFound
+	}
+	return r.storedPrivateKeyToSigningKey(key)
+}
+
+func (r *ring) PreviousSigningKey() (*SigningKey, error) {
+	current, err := r.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	privateKeys, err := r.getNonExpiredPrivateKeys(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var previous *store.Key
+	for i, key := range privateKeys {
+		rotatedAt := r.privateKeyRotatedAt(key)
+		if key.ID == current.ID || rotatedAt.After(current.RotatedAt) {
+			continue
+		}
+		if previous == nil || rotatedAt.After(r.privateKeyRotatedAt(*previous)) {
+			previous = &privateKeys[i]
+		}
+	}
+	if previous == nil {
+		return nil, ErrKeyNotFound
+	}
+	return r.storedPrivateKeyToSigningKey(*previous)
+}
+
+// storeSigningKey stores signingKey in the store. If its ID is already taken
+// a new ID is chosen, up to Options.IDConflictRetries times, which changes
+// the ID (and for thumbprint IDs also the key) of signingKey.
+func (r *ring) storeSigningKey(ctx context.Context, signingKey *SigningKey) error {
+	for attempt := 0; ; attempt++ {
+		privateStoreKey, publicStoreKey, err := r.createStoreKeyPairFromSigningKey(signingKey)
+		if err != nil {
+			return err
+		}
+		var records []store.Key
+		if r.options.certificates() {
+			certificateStoreKey, err := r.createCertificateStoreKey(signingKey)
+			if err != nil {
+				return err
+			}
+			records = append(records, certificateStoreKey)
+		}
+		postQuantumStoreKeys, err := r.createPostQuantumStoreKeys(signingKey, privateStoreKey, publicStoreKey)
+		if err != nil {
+			return err
+		}
+		records = append(records, postQuantumStoreKeys...)
+		err = r.storeKeyPair(ctx, signingKey, privateStoreKey, publicStoreKey, records...)
+		if !errors.Is(err, store.ErrKeyIDConflict) {
+			return err
+		}
+		if attempt >= r.options.IDConflictRetries {
+			return &IDConflictError{Attempts: attempt + 1}
+		}
+		r.options.Logger.Warn("key id conflict, retrying with new id", "key_id", signingKey.ID)
+		if err := r.regenerateID(signingKey); err != nil {
+			return err
+		}
+	}
+}
+
+// regenerateID assigns a new ID to signingKey. IDs derived from the key
+// require a new key.
+func (r *ring) regenerateID(signingKey *SigningKey) error {
+	if r.options.IDStrategy != RandomID {
+		_, size := keyAlgorithm(signingKey.Key.Public())
+		privateKey, err := r.generateKeyOfSize(size)
+		if err != nil {
+			return err
+		}
+		signingKey.setKey(privateKey)
+	}
+	id, err := r.generateID(signingKey.Key)
+	if err != nil {
 		return err
 	}
-	if err := r.store.Add(publicKey); err != nil {
+	signingKey.ID = id
+	return nil
+}
+
+// storeKeyPair stores the halves of a keypair, and the records kept next to
+// it, such as its certificate. The public key is added last, so the records
+// are in place once the verifier can be found.
+func (r *ring) storeKeyPair(ctx context.Context, signingKey *SigningKey, privateKey, publicKey store.Key, records ...store.Key) error {
+	if err := r.options.IDPrefixes.validateKeyID(privateKey.ID); err != nil {
 		return err
 	}
+	if err := r.store.Add(ctx, privateKey); err != nil {
+		return err
+	}
+	// Do not leave a private key without its public key behind
+	rollback := func(added []store.Key) {
+		_ = r.deleteKey(ctx, privateKey)
+		for _, record := range added {
+			_ = r.deleteKey(ctx, record)
+		}
+	}
+	for i, record := range records {
+		if err := r.store.Add(ctx, record); err != nil {
+			rollback(records[:i])
+			return err
+		}
+	}
+	if err := r.store.Add(ctx, publicKey); err != nil {
+		rollback(records)
+		return err
+	}
+	r.cache.forget(privateKey.ID)
+	r.auditKey(AuditKeyCreated, signingKey, "")
 	return nil
 }
 
 func (r *ring) createNewSigningKey() (*SigningKey, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, r.options.KeySize)
-	if err != nil {
-		return nil, err
+	privateKey := r.takePregeneratedKey()
+	if privateKey == nil {
+		var err error
+		privateKey, err = r.generateKey()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	id, err := nanoid.Generate(r.options.IDAlphabet, r.options.IDLength)
+	id, err := r.generateID(privateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now()
+	now := r.options.Clock.Now()
+	rotatedAt, verifiableUntil := r.nextRotation(now)
+	algorithm, _ := keyAlgorithm(privateKey.Public())
 	signingKey := SigningKey{
-		ID:              id,
-		RotatedAt:       now.Add(r.options.RotationFrequency),
-		VerifiableUntil: now.Add(r.options.VerificationPeriod),
-		Key:             privateKey,
+		ID:                 id,
+		RotatedAt:          rotatedAt,
+		VerifiableUntil:    verifiableUntil,
+		CreatedAt:          now,
+		Algorithm:          algorithm,
+		SignatureAlgorithm: r.signatureAlgorithm(privateKey.Public()),
 	}
+	signingKey.setKey(privateKey)
 	return &signingKey, nil
 }
 
-func (r *ring) getNonExpiredPrivateKeys() (store.KeyList, error) {
-	return r.getNonExpiredKeys(true)
+// rotationPeriod returns how long a new signing key is active, which is
+// RotationFrequency brought forward by a random part of RotationJitter
+func (r *ring) rotationPeriod() time.Duration {
+	if r.options.RotationJitter == 0 {
+		return r.options.RotationFrequency
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(r.random(), b[:]); err != nil {
+		return r.options.RotationFrequency
+	}
+	// A uniform fraction in [0, 1) from the 53 bits a float64 can hold
+	fraction := float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+	jitter := time.Duration(fraction * r.options.RotationJitter * float64(r.options.RotationFrequency))
+	return r.options.RotationFrequency - jitter
 }
 
-func (r *ring) getNonExpiredPublicKeys() (store.KeyList, error) {
-	return r.getNonExpiredKeys(false)
+func (r *ring) generateID(privateKey crypto.Signer) (string, error) {
+	verifier := &VerifierKey{Key: privateKey.Public()}
+	switch r.options.IDStrategy {
+	case JWKThumbprintID:
+		return verifier.Thumbprint()
+	case SPKIThumbprintID:
+		f, err := fingerprint(verifier.Key)
+		if err != nil {
+			return "", err
+		}
+		return f.Base64(), nil
+	default:
+		return randomID(r.options)
+	}
 }
 
-func (r *ring) getNonExpiredKeys(private bool) (store.KeyList, error) {
-	allKeys, err := r.store.List()
+// randomID generates a random ID using the IDAlphabet and IDLength of
+// options
+func randomID(options Options) (string, error) {
+	if options.Rand == nil {
+		return nanoid.Generate(options.IDAlphabet, options.IDLength)
+	}
+	alphabet := []rune(options.IDAlphabet)
+	if len(alphabet) == 0 || len(alphabet) > 256 {
+		return "", fmt.Errorf("hsson/ring: IDAlphabet must have between 1 and 256 characters")
+	}
+	// Bytes are masked to the smallest power of two covering the alphabet,
+	// and rejected if out of range, so every character is equally likely
+	mask := 1
+	for mask < len(alphabet) {
+		mask <<= 1
+	}
+	id := make([]rune, 0, options.IDLength)
+	var b [1]byte
+	for len(id) < options.IDLength {
+		if _, err := io.ReadFull(options.Rand, b[:]); err != nil {
+			return "", err
+		}
+		if i := int(b[0]) & (mask - 1); i < len(alphabet) {
+			id = append(id, alphabet[i])
+		}
+	}
+	return string(id), nil
+}
+
+// random returns the source of randomness of the keychain
+func (r *ring) random() io.Reader {
+	if r.options.Rand != nil {
+		return r.options.Rand
+	}
+	return rand.Reader
+}
+
+func (r *ring) generateKey() (crypto.Signer, error) {
+	return r.generateKeyOfSize(r.options.KeySize)
+}
+
+// generateKeyOfSize is like generateKey, but with size instead of
+// Options.KeySize
+func (r *ring) generateKeyOfSize(size int) (crypto.Signer, error) {
+	if r.options.MetricsCollector != nil {
+		defer func(start time.Time) {
+			r.options.MetricsCollector.KeyGenerated(r.options.Algorithm, time.Since(start))
+		}(time.Now())
+	}
+	privateKey, err := r.newPrivateKey(size)
 	if err != nil {
-		return store.KeyList{}, err
+		return nil, &causeError{kind: ErrKeyGeneration, cause: err}
+	}
+	return privateKey, nil
+}
+
+// newPrivateKey generates a private key of size using the KeyGenerator,
+// GenerateKey or the standard library
+func (r *ring) newPrivateKey(size int) (crypto.Signer, error) {
+	if r.options.GenerateKey != nil {
+		signer, err := r.options.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkKeyType(signer); err != nil {
+			return nil, err
+		}
+		if err := r.options.checkKeyPolicy(signer.Public()); err != nil {
+			return nil, err
+		}
+		return signer, nil
 	}
-	var allPrivateOrPublicKeys store.KeyList
-	now := time.Now()
-	for _, key := range allKeys {
-		if key.IsPrivate == private && key.ExpiresAt.After(now) {
-			allPrivateOrPublicKeys = append(allPrivateOrPublicKeys, key)
+	if r.options.KeyGenerator != nil {
+		signer, ref, err := r.options.KeyGenerator.GenerateKey(r.options.Algorithm, size)
+		if err != nil {
+			return nil, err
 		}
+		if err := checkKeyType(signer); err != nil {
+			return nil, err
+		}
+		return &referencedSigner{Signer: signer, ref: ref}, nil
+	}
+	switch r.options.Algorithm {
+	case RSA:
+		if r.options.RSAPrimes > 2 {
+			return rsa.GenerateMultiPrimeKey(r.random(), r.options.RSAPrimes, size)
+		}
+		return rsa.GenerateKey(r.random(), size)
+	case Ed25519:
+		_, privateKey, err := ed25519.GenerateKey(r.random())
+		return privateKey, err
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), r.random())
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), r.random())
+	case ECDSAP521:
+		return ecdsa.GenerateKey(elliptic.P521(), r.random())
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", r.options.Algorithm)
 	}
+}
+
+// getNonExpiredPrivateKeys returns the private keys taking part in
+// rotation, which excludes keys created by NewKeyWithOptions, the secrets of
+// a SecretKeychain or EncryptionKeychain and keys violating the key policy
+func (r *ring) getNonExpiredPrivateKeys(ctx context.Context) (store.KeyList, error) {
+	return r.getNonExpiredKeys(ctx, store.KeyFilter{IsPrivate: &private}, func(key store.Key) bool {
+		return key.IsPrivate && !isSecretID(key.ID) && !isPostQuantumKeyID(key.ID) && !customSchedule(key) && r.options.storedKeyAllowed(key)
+	})
+}
+
+// getReusablePrivateKeys returns the non-expired private keys which may
+// become the signing key, see Options.KeyMismatch
+func (r *ring) getReusablePrivateKeys(ctx context.Context) (store.KeyList, error) {
+	privateKeys, err := r.getNonExpiredPrivateKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.options.reusablePrivateKeys(privateKeys)
+}
 
-	allPrivateOrPublicKeys.SortByExpiresAt()
-	return allPrivateOrPublicKeys, nil
+func (r *ring) getNonExpiredRevocations(ctx context.Context) (store.KeyList, error) {
+	return r.getNonExpiredKeys(ctx, store.KeyFilter{IsPrivate: &public, IDPrefix: revocationIDPrefix}, func(key store.Key) bool {
+		return !key.IsPrivate && strings.HasPrefix(key.ID, revocationIDPrefix)
+	})
 }
@@ -0,0 +1,317 @@
+package ring
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// Verifier looks up the public keys used to verify data signed by a
+// Keychain. Services which only verify data can depend on it instead of the
+// full Keychain.
+type Verifier interface {
+	// GetVerifier can be used to get the public key for a specific keypair
+	// identified by an ID. It returns ErrKeyNotFound if there is no such
+	// key, and an error matching ErrStoreUnavailable if the store could
+	// not be reached.
+	GetVerifier(id string) (*VerifierKey, error)
+	// GetVerifierContext is like GetVerifier, but uses the context for the
+	// store lookup.
+	GetVerifierContext(ctx context.Context, id string) (*VerifierKey, error)
+	// ListVerifiers lists all currently active public keys, ordered by
+	// ExpiresAt and then by ID
+	ListVerifiers() ([]*VerifierKey, error)
+	// ListVerifiersContext is like ListVerifiers, but uses the context for
+	// the store lookup.
+	ListVerifiersContext(ctx context.Context) ([]*VerifierKey, error)
+}
+
+// NewVerifierOnly creates a Verifier reading the verifier keys written to
+// the store by keychains elsewhere. Unlike New it never creates keys, takes
+// the store lock or writes to the store.
+func NewVerifierOnly(s store.Store) Verifier {
+	return NewVerifierOnlyWithOptions(s, defaultOptions)
+}
+
+// NewVerifierOnlyWithOptions is like NewVerifierOnly, but with custom
+// options. Only Options.Clock, Options.Namespace, Options.StoreTimeout,
+// Options.ReadReplicas, Options.StaticVerifiers and the verifier cache
+// options are used.
+func NewVerifierOnlyWithOptions(s store.Store, options Options) Verifier {
+	if options.Clock == nil {
+		options.Clock = defaultOptions.Clock
+	}
+	v := newVerifier(withKeyLayout(withStoreTimeout(store.WithContext(s), options.StoreTimeout), options), options)
+	v.reads = withKeyLayout(withStoreTimeout(withReadReplicas(store.WithContext(s), options.ReadReplicas), options.StoreTimeout), options)
+	return &v
+}
+
+// verifier implements Verifier by reading public keys from the store. It is
+// embedded in the keychain, which adds signing on top.
+type verifier struct {
+	store store.ContextStore
+	// reads serves verifier lookups, see Options.ReadReplicas
+	reads   store.ContextStore
+	options Options
+
+	cache   *verifierCache
+	parsed  *publicKeyCache
+	breaker *circuitBreaker
+	// lookups coalesces concurrent lookups of the same ID
+	lookups *lookupGroup
+
+	// expiredMu guards expired, the IDs already passed to OnKeyExpired
+	expiredMu sync.Mutex
+	expired   map[string]bool
+}
+
+func newVerifier(s store.ContextStore, options Options) verifier {
+	return verifier{
+		store:   s,
+		reads:   s,
+		options: options,
+		cache:   newVerifierCache(options),
+		parsed:  newPublicKeyCache(),
+		lookups: &lookupGroup{},
+		breaker: newCircuitBreaker(options),
+	}
+}
+
+func (v *verifier) GetVerifier(id string) (*VerifierKey, error) {
+	return v.GetVerifierContext(context.Background(), id)
+}
+
+func (v *verifier) GetVerifierContext(ctx context.Context, id string) (verifierKey *VerifierKey, err error) {
+	ctx, end := v.startSpan(ctx, "ring.GetVerifier")
+	defer func() { end(err) }()
+
+	if static, ok := v.staticVerifier(id); ok {
+		v.audit(AuditVerifierFetched, id, "")
+		return static, nil
+	}
+	if cached, ok := v.cache.get(id); ok {
+		if cached == nil {
+			return nil, ErrKeyNotFound
+		}
+		v.audit(AuditVerifierFetched, id, "")
+		return cached, nil
+	}
+
+	verifierKey, err = v.lookups.do(ctx, id, func() (*VerifierKey, error) {
+		return v.lookupVerifier(ctx, id)
+	})
+	if errors.Is(err, ErrStoreUnavailable) && v.breaker != nil {
+		if stale := v.cache.stale(id); stale != nil {
+			v.audit(AuditVerifierFetched, id, "")
+			return stale, nil
+		}
+	}
+	var tombstone *TombstoneError
+	if errors.Is(err, ErrKeyNotFound) && !errors.As(err, &tombstone) {
+		v.cache.put(id, nil)
+	} else if err == nil {
+		v.cache.put(id, verifierKey)
+	}
+	if err == nil {
+		v.audit(AuditVerifierFetched, id, "")
+	}
+	return verifierKey, err
+}
+
+// lookupVerifier looks up the verifier key id in the store, unless the
+// circuit breaker is open
+func (v *verifier) lookupVerifier(ctx context.Context, id string) (*VerifierKey, error) {
+	if !v.breaker.allow() {
+		return nil, &causeError{kind: ErrCircuitOpen, cause: ErrStoreUnavailable}
+	}
+	verifierKey, err := v.findVerifier(ctx, id)
+	if errors.Is(err, ErrKeyNotFound) {
+		if keyID, tenantID, ok := ParseTenantKeyID(id); ok {
+			verifierKey, err = v.findTenantVerifier(ctx, keyID, tenantID)
+		}
+	}
+	if err == ErrKeyNotFound {
+		err = v.findTombstone(ctx, id)
+	}
+	v.breaker.record(err)
+	return verifierKey, err
+}
+
+func (v *verifier) findVerifier(ctx context.Context, id string) (*VerifierKey, error) {
+	key, err := v.reads.Find(ctx, publicKeyIDPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if now := v.options.Clock.Now(); v.options.expired(key.ExpiresAt, now) {
+		if v.options.TombstoneTTL > 0 && key.ExpiresAt.Add(v.options.TombstoneTTL).After(now) {
+			return nil, &TombstoneError{Tombstone: Tombstone{KeyID: id, Reason: TombstoneExpired, At: key.ExpiresAt}}
+		}
+		return nil, ErrKeyNotFound
+	}
+	cert, err := v.findCertificate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	verifierKey, err := v.verifierFromKey(id, key, cert)
+	if err != nil {
+		return nil, err
+	}
+	if verifierKey.PostQuantum, err = v.findPostQuantumKey(ctx, id); err != nil {
+		return nil, err
+	}
+	return verifierKey, nil
+}
+
+// verifierFromKey parses the stored public key of verifier id
+func (v *verifier) verifierFromKey(id string, key store.Key, cert *x509.Certificate) (*VerifierKey, error) {
+	pub, err := v.parseVerifierKey(key)
+	if err != nil {
+		return nil, ErrKeyNotFound
+	}
+	algorithm, createdAt := parseMetadata(key.Metadata, pub)
+	return VerifierKey{
+		ID:                 id,
+		Key:                pub,
+		ExpiresAt:          key.ExpiresAt,
+		Certificate:        cert,
+		CreatedAt:          createdAt,
+		Algorithm:          algorithm,
+		SignatureAlgorithm: parseSignatureAlgorithm(key.Metadata, pub),
+	}.withChain(v.options), nil
+}
+
+func (v *verifier) ListVerifiers() ([]*VerifierKey, error) {
+	return v.ListVerifiersContext(context.Background())
+}
+
+func (v *verifier) ListVerifiersContext(ctx context.Context) ([]*VerifierKey, error) {
+	keys, err := v.getNonExpiredKeysFrom(ctx, v.reads, store.KeyFilter{IsPrivate: &public}, func(key store.Key) bool {
+		return !key.IsPrivate && (strings.HasPrefix(key.ID, publicKeyIDPrefix) || strings.HasPrefix(key.ID, certificateIDPrefix) ||
+			strings.HasPrefix(key.ID, postQuantumIDPrefix))
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*VerifierKey, 0, len(keys))
+	certs := make(map[string]*x509.Certificate)
+	for _, key := range keys {
+		if !strings.HasPrefix(key.ID, certificateIDPrefix) || !v.options.certificates() {
+			continue
+		}
+		cert, err := v.parseCertificate(key)
+		if err != nil {
+			return nil, err
+		}
+		certs[strings.TrimPrefix(key.ID, certificateIDPrefix)] = cert
+	}
+	postQuantumKeys := make(map[string]*PostQuantumKey)
+	for _, key := range keys {
+		if !strings.HasPrefix(key.ID, postQuantumIDPrefix) || v.options.PostQuantum == "" {
+			continue
+		}
+		id := strings.TrimPrefix(key.ID, postQuantumIDPrefix)
+		pqKey, err := v.parsePostQuantumKey(id, key)
+		if err != nil {
+			return nil, err
+		}
+		postQuantumKeys[id] = pqKey
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key.ID, publicKeyIDPrefix) {
+			continue
+		}
+		pub, err := v.parseVerifierKey(key)
+		if errors.Is(err, ErrKeyPolicy) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimPrefix(key.ID, publicKeyIDPrefix)
+		algorithm, createdAt := parseMetadata(key.Metadata, pub)
+		res = append(res, VerifierKey{
+			ID:                 id,
+			Key:                pub,
+			ExpiresAt:          key.ExpiresAt,
+			Certificate:        certs[id],
+			CreatedAt:          createdAt,
+			Algorithm:          algorithm,
+			SignatureAlgorithm: parseSignatureAlgorithm(key.Metadata, pub),
+			PostQuantum:        postQuantumKeys[id],
+		}.withChain(v.options))
+	}
+	res = v.withStaticVerifiers(res)
+	sortVerifiers(res)
+	return res, nil
+}
+
+// private and public are referenced by the IsPrivate field of store filters
+var private, public = true, false
+
+func (v *verifier) getNonExpiredPublicKeys(ctx context.Context) (store.KeyList, error) {
+	return v.getNonExpiredKeysFrom(ctx, v.reads, store.KeyFilter{IsPrivate: &public, IDPrefix: publicKeyIDPrefix}, func(key store.Key) bool {
+		return !key.IsPrivate && strings.HasPrefix(key.ID, publicKeyIDPrefix)
+	})
+}
+
+// getNonExpiredKeys returns the non-expired keys selected by both filter,
+// which stores may apply themselves, and match
+func (v *verifier) getNonExpiredKeys(ctx context.Context, filter store.KeyFilter, match func(store.Key) bool) (store.KeyList, error) {
+	return v.getNonExpiredKeysFrom(ctx, v.store, filter, match)
+}
+
+// getNonExpiredKeysFrom is like getNonExpiredKeys, but lists the keys of s
+func (v *verifier) getNonExpiredKeysFrom(ctx context.Context, s store.ContextStore, filter store.KeyFilter, match func(store.Key) bool) (store.KeyList, error) {
+	now := v.options.Clock.Now()
+	if v.options.OnKeyExpired != nil {
+		// Expired verifiers must be listed as well to be notified about
+		filter = store.KeyFilter{}
+	} else {
+		filter.NotExpiredAt = now.Add(-v.options.ClockSkewTolerance)
+	}
+	allKeys, err := store.ListFiltered(ctx, s, filter)
+	if err != nil {
+		return store.KeyList{}, err
+	}
+	var matchingKeys store.KeyList
+	for _, key := range allKeys {
+		if match(key) && !v.options.expired(key.ExpiresAt, now) {
+			matchingKeys = append(matchingKeys, key)
+		}
+	}
+	if v.options.OnKeyExpired != nil {
+		v.notifyExpired(allKeys, now)
+	}
+
+	matchingKeys.SortByExpiresAt()
+	return matchingKeys, nil
+}
+
+// notifyExpired calls OnKeyExpired for verifier keys which have expired
+// since the last time the store was listed.
+func (v *verifier) notifyExpired(allKeys store.KeyList, now time.Time) {
+	var expired []string
+	v.expiredMu.Lock()
+	seen := make(map[string]bool, len(v.expired))
+	for _, key := range allKeys {
+		if key.IsPrivate || !strings.HasPrefix(key.ID, publicKeyIDPrefix) || !v.options.expired(key.ExpiresAt, now) {
+			continue
+		}
+		seen[key.ID] = true
+		if !v.expired[key.ID] {
+			expired = append(expired, strings.TrimPrefix(key.ID, publicKeyIDPrefix))
+		}
+	}
+	// Forget keys removed from the store, so the set does not grow forever
+	v.expired = seen
+	v.expiredMu.Unlock()
+
+	for _, id := range expired {
+		v.options.OnKeyExpired(id)
+	}
+}
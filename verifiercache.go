@@ -0,0 +1,180 @@
+package ring
+
+import (
+	"bytes"
+	"crypto"
+	"sync"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// defaultVerifierCacheSize is the default maximum number of cached lookups
+const defaultVerifierCacheSize = 1024
+
+// verifierCache caches the results of looking up verifier keys by ID,
+// including lookups of IDs which do not exist.
+type verifierCache struct {
+	clock       Clock
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+
+	mu      sync.Mutex
+	entries map[string]verifierCacheEntry
+}
+
+type verifierCacheEntry struct {
+	// key is nil for IDs which were not found
+	key        *VerifierKey
+	validUntil time.Time
+}
+
+func newVerifierCache(options Options) *verifierCache {
+	if options.VerifierCacheTTL <= 0 {
+		return nil
+	}
+	size := options.VerifierCacheSize
+	if size <= 0 {
+		size = defaultVerifierCacheSize
+	}
+	return &verifierCache{
+		clock:       options.Clock,
+		ttl:         options.VerifierCacheTTL,
+		negativeTTL: options.VerifierNegativeCacheTTL,
+		size:        size,
+		entries:     make(map[string]verifierCacheEntry),
+	}
+}
+
+// get returns the cached lookup of id. The returned key is nil if the ID was
+// cached as not found.
+func (c *verifierCache) get(id string) (key *VerifierKey, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok || !c.clock.Now().Before(entry.validUntil) {
+		// Outdated entries are kept until evicted, for stale
+		return nil, false
+	}
+	if entry.key == nil {
+		return nil, true
+	}
+	copied := *entry.key
+	return &copied, true
+}
+
+// stale returns the cached key of id even if its entry is outdated, as long
+// as the key has not expired. It is used while the store is unavailable.
+func (c *verifierCache) stale(id string) *VerifierKey {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok || entry.key == nil || !c.clock.Now().Before(entry.key.ExpiresAt) {
+		return nil
+	}
+	copied := *entry.key
+	return &copied
+}
+
+// put caches the lookup of id, where key is nil if it was not found
+func (c *verifierCache) put(id string, key *VerifierKey) {
+	if c == nil {
+		return
+	}
+	now := c.clock.Now()
+	entry := verifierCacheEntry{validUntil: now.Add(c.negativeTTL)}
+	if key != nil {
+		copied := *key
+		entry.key = &copied
+		entry.validUntil = now.Add(c.ttl)
+		// Never serve a key past its expiry
+		if key.ExpiresAt.Before(entry.validUntil) {
+			entry.validUntil = key.ExpiresAt
+		}
+	}
+	if !now.Before(entry.validUntil) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[id]; !exists && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[id] = entry
+}
+
+// evict removes expired entries, or an arbitrary entry if none has expired.
+// The lock must be held.
+func (c *verifierCache) evict(now time.Time) {
+	for id, entry := range c.entries {
+		if !now.Before(entry.validUntil) {
+			delete(c.entries, id)
+		}
+	}
+	if len(c.entries) < c.size {
+		return
+	}
+	for id := range c.entries {
+		delete(c.entries, id)
+		return
+	}
+}
+
+// forget removes id from the cache, e.g. after its expiry changed
+func (c *verifierCache) forget(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+// publicKeyCache caches parsed public keys by store ID, as parsing them
+// dominates the cost of looking up verifiers. Entries are only used while
+// the stored data is unchanged.
+type publicKeyCache struct {
+	mu      sync.RWMutex
+	entries map[string]parsedPublicKey
+}
+
+type parsedPublicKey struct {
+	data []byte
+	key  crypto.PublicKey
+}
+
+func newPublicKeyCache() *publicKeyCache {
+	return &publicKeyCache{entries: make(map[string]parsedPublicKey)}
+}
+
+// get returns the parsed public key of key, if cached
+func (c *publicKeyCache) get(key store.Key) (crypto.PublicKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key.ID]
+	if !ok || !bytes.Equal(entry.data, key.Data) {
+		return nil, false
+	}
+	return entry.key, true
+}
+
+// put caches pub as the parsed public key of key
+func (c *publicKeyCache) put(key store.Key, pub crypto.PublicKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key.ID]; !exists && len(c.entries) >= defaultVerifierCacheSize {
+		for id := range c.entries {
+			delete(c.entries, id)
+			break
+		}
+	}
+	c.entries[key.ID] = parsedPublicKey{data: key.Data, key: pub}
+}
@@ -0,0 +1,71 @@
+package ring
+
+import (
+	"context"
+	"time"
+)
+
+// VerifierListMeta describes the verifier keys listed by
+// ListVerifiersWithMeta
+type VerifierListMeta struct {
+	// CacheUntil is until when the list may be cached, e.g. by a CDN in
+	// front of a JWKS endpoint: the next rotation of the signing key, or
+	// PrePublishWindow later if the next signing key is already listed,
+	// but no later than the expiry of the first listed key
+	CacheUntil time.Time
+	// MaxAge is how long from now the list may be cached, the time until
+	// CacheUntil as measured by the Clock of the keychain, e.g. for the
+	// max-age of a Cache-Control header
+	MaxAge time.Duration
+}
+
+func (r *ring) ListVerifiersWithMeta(ctx context.Context) ([]*VerifierKey, VerifierListMeta, error) {
+	current, err := r.SigningKeyContext(ctx)
+	if err != nil {
+		return nil, VerifierListMeta{}, err
+	}
+	verifiers, err := r.ListVerifiersContext(ctx)
+	if err != nil {
+		return nil, VerifierListMeta{}, err
+	}
+
+	until := current.RotatedAt
+	if r.options.PrePublishWindow > 0 {
+		next, err := r.findNextPrivateKey(ctx, current)
+		if err != nil {
+			return nil, VerifierListMeta{}, err
+		}
+		if next != nil && listed(verifiers, next.ID) {
+			until = until.Add(r.options.PrePublishWindow)
+		}
+	}
+	return verifiers, newVerifierListMeta(cacheUntil(verifiers, until), r.options.Clock.Now()), nil
+}
+
+func newVerifierListMeta(cacheUntil, now time.Time) VerifierListMeta {
+	meta := VerifierListMeta{CacheUntil: cacheUntil}
+	if cacheUntil.After(now) {
+		meta.MaxAge = cacheUntil.Sub(now)
+	}
+	return meta
+}
+
+// cacheUntil returns until, or the expiry of the first verifier key if
+// earlier
+func cacheUntil(verifiers []*VerifierKey, until time.Time) time.Time {
+	for _, verifier := range verifiers {
+		if verifier.ExpiresAt.Before(until) {
+			until = verifier.ExpiresAt
+		}
+	}
+	return until
+}
+
+func listed(verifiers []*VerifierKey, id string) bool {
+	for _, verifier := range verifiers {
+		if verifier.ID == id {
+			return true
+		}
+	}
+	return false
+}
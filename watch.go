@@ -0,0 +1,96 @@
+package ring
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// watchRetryInterval is how long to wait before watching the store again
+// after the watch failed
+const watchRetryInterval = 5 * time.Second
+
+// storeWatcher watches the keys of a single namespace of a store
+type storeWatcher struct {
+	watcher  store.Watcher
+	prefix   string
+	prefixes IDPrefixes
+}
+
+func newStoreWatcher(s store.ContextStore, options Options) *storeWatcher {
+	watcher, ok := store.AsWatcher(s)
+	if !ok {
+		return nil
+	}
+	return &storeWatcher{watcher: watcher, prefix: namespacePrefix(options), prefixes: options.IDPrefixes.withDefaults()}
+}
+
+// startWatching invalidates caches and replaces a revoked signing key when
+// other instances change the store, until Close is called.
+func (r *ring) startWatching(w *storeWatcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.stopWatch = cancel
+	r.watchDone = done
+	// The first watch is started right away, so no changes made after the
+	// keychain was created are missed
+	events, err := w.watcher.Watch(ctx)
+	go func() {
+		defer close(done)
+		for {
+			if err != nil {
+				r.options.Logger.Warn("failed to watch store", "error", err)
+			} else {
+				for event := range events {
+					if !strings.HasPrefix(event.ID, w.prefix) {
+						continue
+					}
+					if id, ok := w.prefixes.fromStore(strings.TrimPrefix(event.ID, w.prefix)); ok {
+						event.ID = id
+						r.handleStoreEvent(event)
+					}
+				}
+			}
+
+			timer := r.newTimer(watchRetryInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			events, err = w.watcher.Watch(ctx)
+		}
+	}()
+}
+
+func (r *ring) handleStoreEvent(event store.Event) {
+	switch {
+	case strings.HasPrefix(event.ID, heartbeatIDPrefix):
+		return
+	case strings.HasPrefix(event.ID, publicKeyIDPrefix):
+		r.cache.forget(strings.TrimPrefix(event.ID, publicKeyIDPrefix))
+	case strings.HasPrefix(event.ID, revocationIDPrefix):
+		r.cache.forget(strings.TrimPrefix(event.ID, revocationIDPrefix))
+	case strings.HasPrefix(event.ID, certificateIDPrefix):
+		r.cache.forget(strings.TrimPrefix(event.ID, certificateIDPrefix))
+	default:
+		r.cache.forget(event.ID)
+		current, ok := r.currentSigningKey.Load().(*SigningKey)
+		if event.Type == store.EventDeleted && ok && current.ID == event.ID {
+			// The key was revoked, or has expired, so it is replaced on
+			// the next call to SigningKey
+			r.options.Logger.Info("signing key deleted from store", "key_id", event.ID)
+			r.deletedSigningKey.Store(event.ID)
+		}
+	}
+}
+
+// signingKeyDeleted reports whether key has been deleted from the store by
+// another instance.
+func (r *ring) signingKeyDeleted(key *SigningKey) bool {
+	id, _ := r.deletedSigningKey.Load().(string)
+	return id == key.ID
+}
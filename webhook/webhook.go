@@ -0,0 +1,231 @@
+// Package webhook signs outgoing webhook requests and verifies inbound ones
+// with the keys of a keychain. The signature header holds a timestamp, the
+// ID of the signing key and the signature of the timestamp and body:
+//
+//	Ring-Signature: t=1700000000,kid=hJsgOmRq,v1=MEUCIQD...
+//
+// Receivers look up the verifier key by its ID, so requests signed before a
+// rotation keep verifying for the verification period of their key.
+package webhook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsson/ring"
+)
+
+const (
+	// DefaultHeader is the default name of the signature header
+	DefaultHeader = "Ring-Signature"
+	// DefaultTolerance is the default of Options.Tolerance
+	DefaultTolerance = 5 * time.Minute
+	// DefaultMaxBodySize is the default of Options.MaxBodySize
+	DefaultMaxBodySize = 1 << 20
+)
+
+var (
+	// ErrMissingSignature is returned if a request has no signature header
+	ErrMissingSignature = errors.New("hsson/ring/webhook: missing signature")
+	// ErrInvalidSignature is returned if the signature header is malformed
+	// or the signature does not match
+	ErrInvalidSignature = errors.New("hsson/ring/webhook: invalid signature")
+	// ErrTimestampOutOfRange is returned if the timestamp of a request is
+	// further from the current time than Options.Tolerance
+	ErrTimestampOutOfRange = errors.New("hsson/ring/webhook: timestamp outside tolerance")
+	// ErrBodyTooLarge is returned if a request body is larger than
+	// Options.MaxBodySize
+	ErrBodyTooLarge = errors.New("hsson/ring/webhook: body too large")
+)
+
+// Signer signs webhook bodies, e.g. a ring.Keychain
+type Signer interface {
+	Sign(data []byte) (signature []byte, keyID string, err error)
+}
+
+// Verifier checks signatures made by a Signer, e.g. a ring.Keychain sharing
+// the store of the sender
+type Verifier interface {
+	Verify(keyID string, data, signature []byte) error
+}
+
+// Options customize the signature header
+type Options struct {
+	// Header is the name of the signature header. Default: DefaultHeader
+	Header string
+
+	// Tolerance is how far the timestamp of an inbound request may be from
+	// the current time, which limits how long a captured request can be
+	// replayed. Default: DefaultTolerance
+	Tolerance time.Duration
+
+	// MaxBodySize is the largest inbound body read, in bytes.
+	// Default: DefaultMaxBodySize
+	MaxBodySize int64
+
+	// Clock tells the time of signatures and verification. Default: the
+	// system clock
+	Clock ring.Clock
+}
+
+func (o Options) withDefaults() Options {
+	if o.Header == "" {
+		o.Header = DefaultHeader
+	}
+	if o.Tolerance == 0 {
+		o.Tolerance = DefaultTolerance
+	}
+	if o.MaxBodySize == 0 {
+		o.MaxBodySize = DefaultMaxBodySize
+	}
+	return o
+}
+
+func (o Options) now() time.Time {
+	if o.Clock != nil {
+		return o.Clock.Now()
+	}
+	return time.Now()
+}
+
+// signedPayload is the data signed for body at timestamp
+func signedPayload(timestamp int64, body []byte) []byte {
+	return append([]byte(strconv.FormatInt(timestamp, 10)+"."), body...)
+}
+
+// SignatureHeader returns the value of the signature header for body, signed
+// at timestamp
+func SignatureHeader(signer Signer, body []byte, timestamp time.Time) (string, error) {
+	t := timestamp.Unix()
+	signature, keyID, err := signer.Sign(signedPayload(t, body))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("t=%d,kid=%s,v1=%s", t, keyID, base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
+// VerifyHeader checks the signature header value of body
+func VerifyHeader(verifier Verifier, header string, body []byte, options Options) error {
+	options = options.withDefaults()
+	if header == "" {
+		return ErrMissingSignature
+	}
+	var t int64
+	var keyID string
+	var signature []byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidSignature
+		}
+		var err error
+		switch kv[0] {
+		case "t":
+			t, err = strconv.ParseInt(kv[1], 10, 64)
+		case "kid":
+			keyID = kv[1]
+		case "v1":
+			signature, err = base64.RawURLEncoding.DecodeString(kv[1])
+		}
+		if err != nil {
+			return ErrInvalidSignature
+		}
+	}
+	if t == 0 || keyID == "" || signature == nil {
+		return ErrInvalidSignature
+	}
+	if age := options.now().Sub(time.Unix(t, 0)); age > options.Tolerance || age < -options.Tolerance {
+		return ErrTimestampOutOfRange
+	}
+	err := verifier.Verify(keyID, signedPayload(t, body), signature)
+	if errors.Is(err, ring.ErrInvalidSignature) || errors.Is(err, ring.ErrKeyNotFound) {
+		return ErrInvalidSignature
+	}
+	return err
+}
+
+// SignRequest sets the signature header of an outgoing request. The body
+// is read and replaced, so the request can still be sent.
+func SignRequest(signer Signer, req *http.Request, options Options) error {
+	options = options.withDefaults()
+	body, err := readBody(req, -1)
+	if err != nil {
+		return err
+	}
+	header, err := SignatureHeader(signer, body, options.now())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(options.Header, header)
+	return nil
+}
+
+// VerifyRequest checks the signature header of an inbound request and
+// returns its body. The body of the request is replaced, so it can be read
+// again.
+func VerifyRequest(verifier Verifier, req *http.Request, options Options) ([]byte, error) {
+	options = options.withDefaults()
+	header := req.Header.Get(options.Header)
+	if header == "" {
+		return nil, ErrMissingSignature
+	}
+	body, err := readBody(req, options.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyHeader(verifier, header, body, options); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Middleware rejects requests to next without a valid signature with 401,
+// or 503 if the verifier keys could not be fetched
+func Middleware(verifier Verifier, options Options, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := VerifyRequest(verifier, r, options)
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r)
+		case errors.Is(err, ErrBodyTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, ring.ErrStoreUnavailable):
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		default:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+	})
+}
+
+// readBody reads and replaces the body of req, failing if it is larger than
+// limit, unless limit is negative
+func readBody(req *http.Request, limit int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	var r io.Reader = req.Body
+	if limit >= 0 {
+		r = io.LimitReader(req.Body, limit+1)
+	}
+	body, err := ioutil.ReadAll(r)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
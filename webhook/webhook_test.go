@@ -0,0 +1,94 @@
+package webhook_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsson/ring"
+	"github.com/hsson/ring/sim"
+	"github.com/hsson/ring/store/inmem"
+	"github.com/hsson/ring/webhook"
+)
+
+func TestSignAndVerifyRequest(t *testing.T) {
+	clock := sim.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := inmem.NewInMemoryStore()
+	sender, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := ring.NewKeychain(s, ring.Options{Algorithm: ring.Ed25519, RotationFrequency: time.Hour, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := webhook.Options{Clock: clock}
+
+	body := []byte(`{"event":"invoice.paid"}`)
+	req := httptest.NewRequest(http.MethodPost, "/hooks", bytes.NewReader(body))
+	if err := webhook.SignRequest(sender, req, options); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(req.Header.Get(webhook.DefaultHeader), "kid=") {
+		t.Errorf("expected key ID in header, got %q", req.Header.Get(webhook.DefaultHeader))
+	}
+
+	// Requests signed before a rotation still verify
+	clock.Advance(time.Minute)
+	if err := sender.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := webhook.VerifyRequest(receiver, req, options)
+	if err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("expected body %s, got %s", body, got)
+	}
+	if replaced, _ := ioutil.ReadAll(req.Body); !bytes.Equal(replaced, body) {
+		t.Errorf("expected body to be readable again, got %s", replaced)
+	}
+
+	header := req.Header.Get(webhook.DefaultHeader)
+	if err := webhook.VerifyHeader(receiver, header, []byte(`{"event":"invoice.void"}`), options); !errors.Is(err, webhook.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for another body, got %v", err)
+	}
+	clock.Advance(webhook.DefaultTolerance)
+	if err := webhook.VerifyHeader(receiver, header, body, options); !errors.Is(err, webhook.ErrTimestampOutOfRange) {
+		t.Errorf("expected ErrTimestampOutOfRange, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	keychain := ring.NewWithOptions(inmem.NewInMemoryStore(), ring.Options{Algorithm: ring.Ed25519})
+	handler := webhook.Middleware(keychain, webhook.Options{MaxBodySize: 16}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for name, test := range map[string]struct {
+		body   string
+		sign   bool
+		status int
+	}{
+		"signed":    {body: "hello", sign: true, status: http.StatusNoContent},
+		"unsigned":  {body: "hello", status: http.StatusUnauthorized},
+		"too large": {body: strings.Repeat("a", 17), sign: true, status: http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(test.body))
+		if test.sign {
+			if err := webhook.SignRequest(keychain, req, webhook.Options{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", name, test.status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrWorkerRunning is returned by Start if the background rotation worker
+// is already running.
+var ErrWorkerRunning = errors.New("hsson/ring: background rotation is already running")
+
+// autoRotateRetryInterval is how long the worker waits before trying again
+// after a failed rotation.
+const autoRotateRetryInterval = 30 * time.Second
+
+func (r *ring) Start(ctx context.Context) error {
+	r.workerMu.Lock()
+	defer r.workerMu.Unlock()
+	if r.stopWorker != nil {
+		return ErrWorkerRunning
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	r.stopWorker = cancel
+	r.workerDone = done
+	go func() {
+		defer close(done)
+		r.runWorker(ctx)
+	}()
+	return nil
+}
+
+func (r *ring) Close() error {
+	r.workerMu.Lock()
+	defer r.workerMu.Unlock()
+	if r.stopWatch != nil {
+		r.stopWatch()
+		<-r.watchDone
+		r.stopWatch = nil
+	}
+	if r.stopCleanup != nil {
+		r.stopCleanup()
+		<-r.cleanupDone
+		r.stopCleanup = nil
+	}
+	if r.stopKeyPool != nil {
+		r.stopKeyPool()
+		<-r.keyPoolDone
+		r.stopKeyPool = nil
+	}
+	if r.stopWorker == nil {
+		return nil
+	}
+	r.stopWorker()
+	<-r.workerDone
+	r.stopWorker = nil
+	r.workerDone = nil
+	return nil
+}
+
+func (r *ring) runWorker(ctx context.Context) {
+	for {
+		// Generating keys can be slow, so do it well ahead of the rotation
+		r.pregenerateKey()
+
+		wait := autoRotateRetryInterval
+		if key, ok := r.currentSigningKey.Load().(*SigningKey); ok {
+			// The key is only rotated once it is ClockSkewTolerance past its
+			// RotatedAt, like by SigningKey
+			rotateAt := key.RotatedAt.Add(r.options.ClockSkewTolerance)
+			if r.prePublishing(key) {
+				if err := r.prePublishNextKey(ctx, key); err != nil {
+					wait = autoRotateRetryInterval
+				} else {
+					wait = rotateAt.Sub(r.options.Clock.Now())
+				}
+			} else if r.options.PrePublishWindow > 0 && r.options.Clock.Now().Before(key.RotatedAt.Add(-r.options.PrePublishWindow)) {
+				wait = key.RotatedAt.Add(-r.options.PrePublishWindow).Sub(r.options.Clock.Now())
+			} else {
+				wait = rotateAt.Sub(r.options.Clock.Now())
+			}
+		}
+
+		// Wake up regularly to refresh the heartbeat, so that an instance
+		// failing to rotate keeps reporting its stale key
+		if interval := r.heartbeatInterval(); wait > interval {
+			wait = interval
+		}
+		timer := r.newTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		key, ok := r.currentSigningKey.Load().(*SigningKey)
+		if ok && !r.options.expired(key.RotatedAt, r.options.Clock.Now()) {
+			// Already rotated, e.g. lazily by SigningKey, or woken up to
+			// publish the next key or refresh the heartbeat
+			r.refreshHeartbeat(ctx)
+			continue
+		}
+		if _, err := r.rotateSigningKey(ctx); err != nil {
+			r.refreshHeartbeat(ctx)
+			timer := r.newTimer(autoRotateRetryInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+		}
+	}
+}
+
+// refreshHeartbeat writes the heartbeat of the instance and checks for
+// drift, see Options.DriftThreshold
+func (r *ring) refreshHeartbeat(ctx context.Context) {
+	// Heartbeats are only used for drift detection, which should not stop
+	// the worker
+	if err := r.heartbeat(ctx); err != nil {
+		r.options.Logger.Warn("failed to write heartbeat", "error", err)
+	}
+	r.checkDrift()
+}
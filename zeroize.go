@@ -0,0 +1,119 @@
+package ring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"math/big"
+	"time"
+
+	"github.com/hsson/ring/store"
+)
+
+// retiredKey is a signing key which was rotated out, to be zeroized once
+// its grace period has ended, see Options.ZeroizeKeys
+type retiredKey struct {
+	key       *SigningKey
+	retiredAt time.Time
+}
+
+// retire schedules key, which is no longer the current signing key, to be
+// zeroized
+func (r *ring) retire(key *SigningKey) {
+	if !r.options.ZeroizeKeys || key == nil {
+		return
+	}
+	r.retiredMu.Lock()
+	defer r.retiredMu.Unlock()
+	r.retired = append(r.retired, retiredKey{key: key, retiredAt: r.options.Clock.Now()})
+}
+
+// zeroizeRetiredKeys zeroizes the retired keys past their grace period.
+// Keys are kept for the grace period after being retired as well, as
+// callers may still hold keys rotated out ahead of time.
+func (r *ring) zeroizeRetiredKeys() {
+	if !r.options.ZeroizeKeys {
+		return
+	}
+	now := r.options.Clock.Now()
+	current, _ := r.currentSigningKey.Load().(*SigningKey)
+	r.retiredMu.Lock()
+	defer r.retiredMu.Unlock()
+	kept := r.retired[:0]
+	for _, retired := range r.retired {
+		graceEnd := retired.key.RotatedAt
+		if retired.retiredAt.After(graceEnd) {
+			graceEnd = retired.retiredAt
+		}
+		if (current != nil && retired.key.ID == current.ID) || now.Before(graceEnd.Add(r.options.SigningGracePeriod)) {
+			kept = append(kept, retired)
+			continue
+		}
+		zeroizeKey(retired.key.Key)
+		r.options.Logger.Debug("zeroized signing key", "key_id", retired.key.ID)
+	}
+	for i := len(kept); i < len(r.retired); i++ {
+		r.retired[i] = retiredKey{}
+	}
+	r.retired = kept
+}
+
+// deleteKey deletes key from the store, erasing private keys if the store
+// supports it
+func (r *ring) deleteKey(ctx context.Context, key store.Key) error {
+	if key.IsPrivate {
+		return store.SecureErase(ctx, r.store, key.ID)
+	}
+	return r.store.Delete(ctx, key.ID)
+}
+
+// zeroizeKey overwrites the private values of key in memory, after which it
+// can no longer sign. This is best-effort: copies made by the standard
+// library, e.g. precomputed values of RSA keys since Go 1.20, are out of
+// reach, as are keys of a KeyGenerator.
+func zeroizeKey(key crypto.Signer) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		zeroizeInt(key.D)
+		for _, prime := range key.Primes {
+			zeroizeInt(prime)
+		}
+		zeroizeInt(key.Precomputed.Dp)
+		zeroizeInt(key.Precomputed.Dq)
+		zeroizeInt(key.Precomputed.Qinv)
+		for _, crt := range key.Precomputed.CRTValues {
+			zeroizeInt(crt.Exp)
+			zeroizeInt(crt.Coeff)
+			zeroizeInt(crt.R)
+		}
+	case *ecdsa.PrivateKey:
+		zeroizeInt(key.D)
+	case ed25519.PrivateKey:
+		zeroize(key)
+	}
+}
+
+func zeroizeInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	words := x.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	x.SetInt64(0)
+}
+
+func zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// sameBuffer reports if a and b start at the same address, e.g. as the
+// key data of LegacyStorageFormat is the DER itself
+func sameBuffer(a, b []byte) bool {
+	return len(a) > 0 && len(b) > 0 && &a[0] == &b[0]
+}